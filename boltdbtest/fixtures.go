@@ -0,0 +1,275 @@
+// Package boltdbtest generates fixture databases and serves the viewer API
+// for integration tests.
+package boltdbtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Contents of the Containerd fixture
+const (
+	// Snapshotter of all fixture snapshots
+	Snapshotter = "overlayfs"
+	// Image present in every namespace
+	Image = "docker.io/library/busybox:latest"
+	// Container present in every namespace
+	Container = "ctr1"
+	// StaleSnapshot snapshot no gc root references
+	StaleSnapshot = "stale-snap"
+	// StaleIngest ingest that expired an hour before generation
+	StaleIngest = "stale-ingest"
+	// DBVersion containerd db version of the fixture
+	DBVersion = 3
+)
+
+// Namespaces of the Containerd fixture
+var Namespaces = []string{"default", "k8s.io", "moby"}
+
+// OrphanDigest returns the digest of the content blob in ns that nothing
+// references
+func OrphanDigest(ns string) string {
+	return "sha256:orphan-" + ns
+}
+
+// New creates a database in a temporary directory removed after the test,
+// fill populates it in a single transaction
+func New(t testing.TB, fill func(tx *bolt.Tx) error) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "meta.db")
+	db, err := bolt.Open(path, 0600, &bolt.Options{NoSync: true})
+	if err != nil {
+		t.Fatalf("failed to create fixture: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Update(fill); err != nil {
+		t.Fatalf("failed to fill fixture: %v", err)
+	}
+	return path
+}
+
+// Tiny creates a database with a handful of values of each kind:
+// misc/{counter,json,text} and the nested bucket misc/nested/{key}
+func Tiny(t testing.TB) string {
+	t.Helper()
+
+	return New(t, func(tx *bolt.Tx) error {
+		misc, err := tx.CreateBucket([]byte("misc"))
+		if err != nil {
+			return err
+		}
+		misc.Put([]byte("counter"), []byte{0, 0, 0, 0, 0, 0, 0, 42})
+		misc.Put([]byte("json"), []byte(`{"a":1,"b":"x"}`))
+		misc.Put([]byte("text"), []byte("hello"))
+
+		nested, err := misc.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		return nested.Put([]byte("key"), []byte("value"))
+	})
+}
+
+// Containerd creates a containerd metadata database with the same content in
+// every namespace: Image referencing an index, manifest, config and layer
+// blob, Container on a snapshot chain, a pull lease, plus OrphanDigest,
+// StaleSnapshot and StaleIngest that the garbage collector would remove
+func Containerd(t testing.TB) string {
+	t.Helper()
+
+	now := time.Now()
+	return New(t, func(tx *bolt.Tx) error {
+		v1, err := tx.CreateBucket([]byte("v1"))
+		if err != nil {
+			return err
+		}
+		v1.Put([]byte("version"), varint(DBVersion))
+
+		for i, ns := range Namespaces {
+			nsb, err := v1.CreateBucket([]byte(ns))
+			if err != nil {
+				return err
+			}
+
+			content := bucket(nsb, "content")
+			blobs := bucket(content, "blob")
+			addBlob := func(digest string, size int64, age time.Duration, labels map[string]string) {
+				b := bucket(blobs, digest)
+				b.Put([]byte("size"), varint(size))
+				b.Put([]byte("createdat"), timestamp(now.Add(-age)))
+				b.Put([]byte("updatedat"), timestamp(now.Add(-age)))
+				putLabels(b, labels)
+			}
+			addBlob("sha256:index1", 500, time.Hour, map[string]string{
+				"containerd.io/gc.ref.content.m.0": "sha256:manifest1",
+			})
+			addBlob("sha256:manifest1", 1000, time.Hour, map[string]string{
+				"containerd.io/gc.ref.content.config":          "sha256:config1",
+				"containerd.io/gc.ref.content.l.0":             "sha256:layer1",
+				"containerd.io/gc.ref.snapshot." + Snapshotter: "sha256:chain1",
+			})
+			addBlob("sha256:config1", 2000, time.Hour, nil)
+			addBlob("sha256:layer1", 3000000, time.Hour, nil)
+			addBlob(OrphanDigest(ns), int64(10000*(i+1)), time.Duration(i*240+1)*time.Hour, nil)
+
+			ingest := bucket(bucket(content, "ingests"), StaleIngest)
+			ingest.Put([]byte("ref"), []byte(ns+"-1"))
+			ingest.Put([]byte("expireat"), timestamp(now.Add(-time.Hour)))
+
+			img := bucket(bucket(nsb, "images"), Image)
+			img.Put([]byte("createdat"), timestamp(now))
+			img.Put([]byte("updatedat"), timestamp(now))
+			target := bucket(img, "target")
+			target.Put([]byte("digest"), []byte("sha256:index1"))
+			target.Put([]byte("mediatype"), []byte("application/vnd.oci.image.index.v1+json"))
+			target.Put([]byte("size"), varint(500))
+
+			snapshots := bucket(bucket(nsb, "snapshots"), Snapshotter)
+			chain := bucket(snapshots, "sha256:chain1")
+			chain.Put([]byte("name"), []byte(fmt.Sprintf("%s/%d/sha256:chain1", ns, 1)))
+			chain.Put([]byte("createdat"), timestamp(now))
+			rw := bucket(snapshots, Container+"-rw")
+			rw.Put([]byte("name"), []byte(fmt.Sprintf("%s/%d/%s-rw", ns, 2, Container)))
+			rw.Put([]byte("parent"), []byte("sha256:chain1"))
+			stale := bucket(snapshots, StaleSnapshot)
+			stale.Put([]byte("name"), []byte(fmt.Sprintf("%s/%d/%s", ns, 3, StaleSnapshot)))
+
+			ctr := bucket(bucket(nsb, "containers"), Container)
+			ctr.Put([]byte("image"), []byte(Image))
+			ctr.Put([]byte("snapshotter"), []byte(Snapshotter))
+			ctr.Put([]byte("snapshotKey"), []byte(Container+"-rw"))
+			ctr.Put([]byte("createdat"), timestamp(now))
+			ctr.Put([]byte("updatedat"), timestamp(now))
+			bucket(ctr, "runtime").Put([]byte("name"), []byte("io.containerd.runc.v2"))
+			putLabels(ctr, map[string]string{"io.kubernetes.pod.name": "foo"})
+
+			lease := bucket(bucket(nsb, "leases"), "pull-lease")
+			lease.Put([]byte("createdat"), timestamp(now))
+			bucket(lease, "content").Put([]byte("sha256:layer1"), nil)
+		}
+		return nil
+	})
+}
+
+// HugeOptions shape of a Huge fixture, zero values use the defaults
+type HugeOptions struct {
+	Buckets       int // top level buckets, default 10
+	KeysPerBucket int // keys in every bucket, default 10000
+	ValueSize     int // bytes per value, default 128
+	Depth         int // nested buckets below every top level bucket, default 0
+}
+
+// Huge creates a synthetic database of opts.Buckets buckets named
+// bucket-0000, each optionally nesting Depth levels named level-N, with keys
+// named key-00000000 on the innermost level
+func Huge(t testing.TB, opts HugeOptions) string {
+	t.Helper()
+
+	if opts.Buckets <= 0 {
+		opts.Buckets = 10
+	}
+	if opts.KeysPerBucket <= 0 {
+		opts.KeysPerBucket = 10000
+	}
+	if opts.ValueSize <= 0 {
+		opts.ValueSize = 128
+	}
+
+	value := bytes.Repeat([]byte{'x'}, opts.ValueSize)
+	return New(t, func(tx *bolt.Tx) error {
+		for i := 0; i < opts.Buckets; i++ {
+			b, err := tx.CreateBucket([]byte(fmt.Sprintf("bucket-%04d", i)))
+			if err != nil {
+				return err
+			}
+			for d := 0; d < opts.Depth; d++ {
+				if b, err = b.CreateBucket([]byte(fmt.Sprintf("level-%d", d))); err != nil {
+					return err
+				}
+			}
+			// Sequential keys fill pages completely
+			b.FillPercent = 1
+			for k := 0; k < opts.KeysPerBucket; k++ {
+				if err := b.Put([]byte(fmt.Sprintf("key-%08d", k)), value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Corrupted creates a database that opens but fails the consistency check:
+// a key in the leaf page of bucket "data" is rewritten so the page is no
+// longer sorted
+func Corrupted(t testing.TB) string {
+	t.Helper()
+
+	path := New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("data"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 500; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%04d", i)), make([]byte, 100)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	i := bytes.Index(data, []byte("key-0001"))
+	if i < 0 {
+		t.Fatalf("fixture key not found in %s", path)
+	}
+	copy(data[i:], "key-9999")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to corrupt fixture: %v", err)
+	}
+	return path
+}
+
+// bucket returns the named sub-bucket, creating it if needed
+func bucket(b *bolt.Bucket, name string) *bolt.Bucket {
+	sub, err := b.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		panic(fmt.Sprintf("create bucket %s: %v", name, err))
+	}
+	return sub
+}
+
+// putLabels stores labels in the labels sub-bucket like containerd
+func putLabels(b *bolt.Bucket, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	lb := bucket(b, "labels")
+	for k, v := range labels {
+		lb.Put([]byte(k), []byte(v))
+	}
+}
+
+// varint encodes sizes and versions like containerd
+func varint(v int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutVarint(buf, v)]
+}
+
+// timestamp encodes times like containerd
+func timestamp(t time.Time) []byte {
+	b, _ := t.MarshalBinary()
+	return b
+}
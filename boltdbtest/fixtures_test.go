@@ -0,0 +1,131 @@
+package boltdbtest
+
+import (
+	"net/http"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// view opens a fixture read-only for assertions
+func view(t *testing.T, path string, fn func(tx *bolt.Tx) error) {
+	t.Helper()
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer db.Close()
+
+	if err := db.View(fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkErrors runs the consistency check
+func checkErrors(t *testing.T, path string) []error {
+	var errs []error
+	view(t, path, func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	return errs
+}
+
+func TestTiny(t *testing.T) {
+	path := Tiny(t)
+
+	view(t, path, func(tx *bolt.Tx) error {
+		misc := tx.Bucket([]byte("misc"))
+		if misc == nil {
+			t.Fatal("bucket misc missing")
+		}
+		if got := string(misc.Get([]byte("json"))); got != `{"a":1,"b":"x"}` {
+			t.Errorf("misc/json = %q", got)
+		}
+		if misc.Bucket([]byte("nested")) == nil {
+			t.Error("bucket misc/nested missing")
+		}
+		return nil
+	})
+	if errs := checkErrors(t, path); len(errs) > 0 {
+		t.Errorf("consistency errors: %v", errs)
+	}
+}
+
+func TestContainerd(t *testing.T) {
+	path := Containerd(t)
+
+	view(t, path, func(tx *bolt.Tx) error {
+		v1 := tx.Bucket([]byte("v1"))
+		if v1 == nil {
+			t.Fatal("bucket v1 missing")
+		}
+		for _, ns := range Namespaces {
+			nsb := v1.Bucket([]byte(ns))
+			if nsb == nil {
+				t.Fatalf("namespace %s missing", ns)
+			}
+			blobs := nsb.Bucket([]byte("content")).Bucket([]byte("blob"))
+			if blobs.Bucket([]byte(OrphanDigest(ns))) == nil {
+				t.Errorf("%s: orphan blob missing", ns)
+			}
+			if nsb.Bucket([]byte("images")).Bucket([]byte(Image)) == nil {
+				t.Errorf("%s: image missing", ns)
+			}
+			if nsb.Bucket([]byte("snapshots")).Bucket([]byte(Snapshotter)).Bucket([]byte(StaleSnapshot)) == nil {
+				t.Errorf("%s: stale snapshot missing", ns)
+			}
+		}
+		return nil
+	})
+}
+
+func TestHuge(t *testing.T) {
+	path := Huge(t, HugeOptions{Buckets: 3, KeysPerBucket: 1000, Depth: 2})
+
+	view(t, path, func(tx *bolt.Tx) error {
+		n := 0
+		tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			n++
+			inner := b.Bucket([]byte("level-0")).Bucket([]byte("level-1"))
+			if inner == nil {
+				t.Fatalf("%s: nested levels missing", name)
+			}
+			if keys := inner.Stats().KeyN; keys != 1000 {
+				t.Errorf("%s: %d keys, want 1000", name, keys)
+			}
+			return nil
+		})
+		if n != 3 {
+			t.Errorf("%d buckets, want 3", n)
+		}
+		return nil
+	})
+}
+
+func TestCorrupted(t *testing.T) {
+	if errs := checkErrors(t, Corrupted(t)); len(errs) == 0 {
+		t.Error("corrupted fixture passes the consistency check")
+	}
+}
+
+func TestServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":{"n":1},"partial":true,"cursor":"c"}`))
+	})
+	s := NewServer(t, mux)
+
+	resp := s.Get("/api/ok")
+	if !resp.Partial || resp.Cursor != "c" {
+		t.Errorf("partial=%v cursor=%q", resp.Partial, resp.Cursor)
+	}
+	var data struct{ N int }
+	resp.Decode(t, &data)
+	if data.N != 1 {
+		t.Errorf("n = %d, want 1", data.N)
+	}
+}
@@ -0,0 +1,99 @@
+package boltdbtest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Response the viewer API envelope
+type Response struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Partial bool            `json:"partial,omitempty"`
+	Cursor  string          `json:"cursor,omitempty"`
+	Meta    json.RawMessage `json:"meta,omitempty"`
+
+	// Status HTTP status code of the response
+	Status int `json:"-"`
+}
+
+// Decode unmarshals the data field into v, failing the test on error
+func (r *Response) Decode(t testing.TB, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("failed to decode response data %s: %v", r.Data, err)
+	}
+}
+
+// Server serves a viewer handler for the duration of a test
+type Server struct {
+	*httptest.Server
+	t testing.TB
+}
+
+// NewServer starts a server for handler, closed when the test ends
+func NewServer(t testing.TB, handler http.Handler) *Server {
+	t.Helper()
+
+	s := &Server{Server: httptest.NewServer(handler), t: t}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Do sends a request and returns the status and body
+func (s *Server) Do(method, path string, body io.Reader) (int, []byte) {
+	s.t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		s.t.Fatalf("invalid request %s %s: %v", method, path, err)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("%s %s: failed to read body: %v", method, path, err)
+	}
+	return resp.StatusCode, data
+}
+
+// API sends a request to an API path and decodes the envelope
+func (s *Server) API(method, path string, body string) *Response {
+	s.t.Helper()
+
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	status, data := s.Do(method, path, r)
+
+	resp := &Response{Status: status}
+	if err := json.Unmarshal(data, resp); err != nil {
+		s.t.Fatalf("%s %s: response is not JSON (status %d): %s", method, path, status, data)
+	}
+	resp.Status = status
+	return resp
+}
+
+// Get sends a GET request to an API path and fails the test unless it
+// succeeded
+func (s *Server) Get(path string) *Response {
+	s.t.Helper()
+
+	resp := s.API(http.MethodGet, path, "")
+	if resp.Status != http.StatusOK || !resp.Success {
+		s.t.Fatalf("GET %s: status %d: %s %s", path, resp.Status, resp.Error, resp.Message)
+	}
+	return resp
+}
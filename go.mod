@@ -5,14 +5,26 @@ go 1.23
 toolchain go1.24.6
 
 require (
+	github.com/containerd/containerd/api v1.8.0
+	github.com/coreos/go-oidc/v3 v3.11.0
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/cobra v1.8.1
+	github.com/spf13/pflag v1.0.6
 	go.etcd.io/bbolt v1.4.2
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/oauth2 v0.21.0
+	golang.org/x/sync v0.10.0
+	golang.org/x/sys v0.29.0
+	google.golang.org/protobuf v1.36.7
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/go-logr/logr v1.4.1 // indirect
-	golang.org/x/sys v0.29.0 // indirect
-	google.golang.org/protobuf v1.36.7 // indirect
-	k8s.io/klog/v2 v2.130.1 // indirect
+	github.com/go-jose/go-jose/v4 v4.0.2 // indirect
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/opencontainers/image-spec v1.1.0 // indirect
+	golang.org/x/crypto v0.25.0 // indirect
 )
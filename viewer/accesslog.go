@@ -0,0 +1,245 @@
+// accesslog.go - an access log of every request for auditing, written to
+// its own file in Apache combined or JSON format and rotated by size,
+// separate from the diagnostic log and the request log
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// access log formats
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// Defaults of the access log rotation
+const (
+	defaultAccessLogMaxBytes = 100 * 1024 * 1024
+	defaultAccessLogBackups  = 5
+)
+
+// AccessLogOptions where and how requests are audited
+type AccessLogOptions struct {
+	// Path file the log is appended to, "-" for stdout; empty disables
+	// the access log
+	Path string
+	// Format AccessLogCombined (default) or AccessLogJSON
+	Format string
+	// MaxBytes size at which the file is rotated, 0 uses the default of
+	// 100MB, a negative value disables rotation
+	MaxBytes int64
+	// Backups rotated files kept as Path.1 (newest) to Path.N, 0 uses the
+	// default of 5
+	Backups int
+}
+
+// AccessLogEntry one request of the access log, JSON lines carry the
+// request log fields and these
+type AccessLogEntry struct {
+	RequestLogEntry
+	Proto     string `json:"proto"`
+	Referer   string `json:"referer,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// accessLog writes entries to its destination
+type accessLog struct {
+	format string
+
+	mu  sync.Mutex
+	out io.Writer
+	// closer of out, nil for stdout
+	closer io.Closer
+}
+
+// newAccessLog opens the destination of opts, nil if the access log is
+// disabled
+func newAccessLog(opts AccessLogOptions) (*accessLog, error) {
+	if opts.Path == "" {
+		return nil, nil
+	}
+	l := &accessLog{format: opts.Format}
+	switch l.format {
+	case "":
+		l.format = AccessLogCombined
+	case AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("invalid access log format %q, expected %s or %s", opts.Format, AccessLogCombined, AccessLogJSON)
+	}
+	if opts.Path == "-" {
+		l.out = os.Stdout
+		return l, nil
+	}
+
+	f := &rotatingFile{path: opts.Path, maxBytes: opts.MaxBytes, backups: opts.Backups}
+	switch {
+	case f.maxBytes == 0:
+		f.maxBytes = defaultAccessLogMaxBytes
+	case f.maxBytes < 0:
+		f.maxBytes = 0
+	}
+	if f.backups <= 0 {
+		f.backups = defaultAccessLogBackups
+	}
+	if err := f.open(); err != nil {
+		return nil, fmt.Errorf("failed to open access log: %v", err)
+	}
+	l.out, l.closer = f, f
+	return l, nil
+}
+
+// log writes the entry of a completed request
+func (l *accessLog) log(e *RequestLogEntry, r *http.Request) error {
+	entry := AccessLogEntry{
+		RequestLogEntry: *e,
+		Proto:           r.Proto,
+		Referer:         r.Referer(),
+		UserAgent:       r.UserAgent(),
+	}
+	var line []byte
+	if l.format == AccessLogJSON {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(combinedLogLine(&entry))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.out == nil {
+		return nil // closed
+	}
+	_, err := l.out.Write(line)
+	return err
+}
+
+// close closes the file, later entries are dropped
+func (l *accessLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = nil
+	if l.closer == nil {
+		return nil
+	}
+	err := l.closer.Close()
+	l.closer = nil
+	return err
+}
+
+// combinedLogLine formats an entry like Apache's combined log format:
+// host - user [time] "request" status bytes "referer" "user agent"
+func combinedLogLine(e *AccessLogEntry) string {
+	host := e.Remote
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	target := e.Path
+	if e.Query != "" {
+		target += "?" + e.Query
+	}
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		host, orDash(escapeLogField(e.User)), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeLogField(e.Method), escapeLogField(target), escapeLogField(e.Proto), e.Status, bytes,
+		orDash(escapeLogField(e.Referer)), orDash(escapeLogField(e.UserAgent)))
+}
+
+// escapeLogField escapes quotes, backslashes and control characters the
+// way Apache does, so a client cannot forge log lines
+func escapeLogField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// orDash the combined log format's placeholder for empty fields
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// rotatingFile appends to a file, renaming it to path.1 and shifting older
+// backups once it would grow past maxBytes (0 never)
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	backups  int
+
+	f    *os.File
+	size int64
+}
+
+// open opens the file for appending
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.f, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it does not fit; callers serialize
+// writes
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file to path.1 and opens a new one, the oldest backup
+// is dropped
+func (f *rotatingFile) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	for i := f.backups - 1; i >= 1; i-- {
+		os.Rename(f.path+"."+strconv.Itoa(i), f.path+"."+strconv.Itoa(i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes the file
+func (f *rotatingFile) Close() error {
+	return f.f.Close()
+}
@@ -0,0 +1,92 @@
+package viewer
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestCombinedLogLine(t *testing.T) {
+	e := &AccessLogEntry{
+		RequestLogEntry: RequestLogEntry{
+			Time:   time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			Method: "GET", Path: "/api/search", Query: "q=a", Status: 200, Bytes: 42,
+			Remote: "10.0.0.1:40424", User: "alice@example.com",
+		},
+		Proto:     "HTTP/1.1",
+		UserAgent: "curl/8.0 \"x\"\n",
+	}
+	want := `10.0.0.1 - alice@example.com [01/May/2024:10:00:00 +0000] "GET /api/search?q=a HTTP/1.1" 200 42 "-" "curl/8.0 \"x\"\x0a"` + "\n"
+	if got := combinedLogLine(e); got != want {
+		t.Errorf("line =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.requestLog.level = RequestLogNone
+		var err error
+		if c.accessLog, err = newAccessLog(AccessLogOptions{Path: path, Format: AccessLogJSON}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	s.Get("/api/buckets")
+	s.Do(http.MethodGet, "/api/missing", nil)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []AccessLogEntry
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var e AccessLogEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("%s: %v", sc.Bytes(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 || entries[0].Path != "/api/buckets" || entries[0].Proto != "HTTP/1.1" || entries[0].UserAgent == "" || entries[1].Status != http.StatusNotFound {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	if _, err := newAccessLog(AccessLogOptions{Path: path, Format: "common"}); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f := &rotatingFile{path: path, maxBytes: 10, backups: 2}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	// Each file holds what fit in 10 bytes, the third oldest was dropped
+	for name, want := range map[string]string{path: "six\n", path + ".1": "four\nfive\n", path + ".2": "three\n"} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("more backups than configured")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 3 || !strings.HasPrefix(entries[0].Name(), "access.log") {
+		t.Errorf("files = %v", entries)
+	}
+}
@@ -0,0 +1,40 @@
+// anytypes.go - containerd API messages linked in, so Any values of their
+// type URLs are unmarshalled into named fields instead of shown as bytes
+package viewer
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	// Registered with protoregistry.GlobalTypes by their init functions:
+	// mounts, platforms, descriptors and sandboxes; task process state; the
+	// runc shim's containerd.runc.v1.Options and CheckpointOptions; CRI's
+	// runtimeoptions.v1.Options of other runtimes
+	_ "github.com/containerd/containerd/api/types"
+	_ "github.com/containerd/containerd/api/types/runc/options"
+	_ "github.com/containerd/containerd/api/types/runtimeoptions/v1"
+	_ "github.com/containerd/containerd/api/types/task"
+)
+
+// resolveAny unmarshals the value of an Any whose message type is linked in,
+// returning its fields by their proto names; false for unknown types and
+// values that do not parse as the type
+func resolveAny(any *anypb.Any) (map[string]interface{}, bool) {
+	msg, err := any.UnmarshalNew()
+	if err != nil {
+		return resolveLegacyOptions(any)
+	}
+	// Nested Any of unknown types fail here, the caller falls back to the
+	// raw fields
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
@@ -0,0 +1,319 @@
+// auth.go - OIDC authentication for the web interface and API
+package viewer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// idTokenCookie holds the ID token of a browser session
+	idTokenCookie = "boltdbui_id_token"
+	// oauthStateCookie protects the login redirect against CSRF
+	oauthStateCookie = "boltdbui_oauth_state"
+)
+
+// User roles; editors may use the mutating endpoints of read-write mode,
+// viewers only read
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+)
+
+// OIDCConfig OIDC provider settings
+type OIDCConfig struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	GroupsClaim   string
+	AllowedGroups []string
+	// EditorGroups members get the editor role, other users are viewers;
+	// empty makes every user an editor
+	EditorGroups []string
+}
+
+// User authenticated user extracted from a verified ID token
+type User struct {
+	Subject string   `json:"subject"`
+	Email   string   `json:"email,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Role    string   `json:"role"`
+}
+
+type userContextKey struct{}
+
+// userFromContext returns the authenticated user of a request, if any
+func userFromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(userContextKey{}).(*User)
+	return u, ok
+}
+
+// oidcAuth validates ID tokens issued by an OIDC provider
+type oidcAuth struct {
+	config   OIDCConfig
+	verifier *oidc.IDTokenVerifier
+	oauth2   oauth2.Config
+}
+
+// newOIDCAuth discovers the provider configuration from the issuer
+func newOIDCAuth(ctx context.Context, config OIDCConfig) (*oidcAuth, error) {
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("OIDC client ID is required")
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: %v", config.IssuerURL, err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID, "profile", "email"}
+	if len(config.AllowedGroups) > 0 || len(config.EditorGroups) > 0 {
+		scopes = append(scopes, config.GroupsClaim)
+	}
+
+	return &oidcAuth{
+		config:   config,
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+	}, nil
+}
+
+// verify validates a raw ID token and enforces the group restriction
+func (a *oidcAuth) verify(ctx context.Context, rawIDToken string) (*User, error) {
+	idToken, err := a.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse claims: %v", err)
+	}
+
+	user := &User{
+		Subject: idToken.Subject,
+		Groups:  claimStrings(claims[a.config.GroupsClaim]),
+	}
+	user.Email, _ = claims["email"].(string)
+	user.Name, _ = claims["name"].(string)
+	user.Role = a.config.role(user.Groups)
+
+	if len(a.config.AllowedGroups) > 0 && !hasAnyGroup(user.Groups, a.config.AllowedGroups) {
+		return user, fmt.Errorf("user %s is not a member of an allowed group", user.Subject)
+	}
+
+	return user, nil
+}
+
+// role returns the role of a member of groups
+func (config OIDCConfig) role(groups []string) string {
+	if len(config.EditorGroups) == 0 || hasAnyGroup(groups, config.EditorGroups) {
+		return RoleEditor
+	}
+	return RoleViewer
+}
+
+// canEdit reports whether the user of a request may use mutating
+// endpoints; without authentication everyone may
+func canEdit(r *http.Request) bool {
+	user, ok := userFromContext(r.Context())
+	return !ok || user.Role == RoleEditor
+}
+
+// rawToken extracts the ID token from the Authorization header or session cookie
+func (a *oidcAuth) rawToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if cookie, err := r.Cookie(idTokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// authenticate middleware rejects requests without a valid ID token; browser
+// page loads are redirected to the provider login instead. Without login the
+// user a frontend proxied the request for applies, see forwardedUser
+func (c *Viewer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.requiresAuth(r) {
+			next.ServeHTTP(w, forwardedUser(r))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/auth/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		raw := c.auth.rawToken(r)
+		if raw == "" {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Redirect(w, r, c.absolutePath("/auth/login"), http.StatusFound)
+				return
+			}
+			c.sendErrorCode(w, http.StatusUnauthorized, "Authentication required", nil)
+			return
+		}
+
+		user, err := c.auth.verify(r.Context(), raw)
+		if err != nil {
+			if user != nil {
+				c.sendErrorCode(w, http.StatusForbidden, "Access denied", err)
+				return
+			}
+			c.sendErrorCode(w, http.StatusUnauthorized, "Invalid ID token", err)
+			return
+		}
+
+		if user.Email != "" {
+			setRequestUser(r, user.Email)
+		} else {
+			setRequestUser(r, user.Subject)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// handleLogin redirects the browser to the OIDC provider
+func (c *Viewer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if c.auth == nil {
+		http.Redirect(w, r, c.absolutePath("/"), http.StatusFound)
+		return
+	}
+
+	state, err := randomState()
+	if err != nil {
+		c.sendError(w, "Failed to start login", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     c.absolutePath("/auth/"),
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, c.auth.oauth2.AuthCodeURL(state), http.StatusFound)
+}
+
+// handleCallback exchanges the authorization code and stores the ID token
+func (c *Viewer) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if c.auth == nil {
+		http.Redirect(w, r, c.absolutePath("/"), http.StatusFound)
+		return
+	}
+
+	state, err := r.Cookie(oauthStateCookie)
+	if err != nil || state.Value == "" || state.Value != r.URL.Query().Get("state") {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid login state", nil)
+		return
+	}
+
+	token, err := c.auth.oauth2.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusUnauthorized, "Failed to exchange authorization code", err)
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		c.sendErrorCode(w, http.StatusUnauthorized, "Provider returned no ID token", nil)
+		return
+	}
+
+	user, err := c.auth.verify(r.Context(), rawIDToken)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusForbidden, "Access denied", err)
+		return
+	}
+	slog.Info("User logged in", "user", user.Subject)
+
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: c.absolutePath("/auth/"), MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name:     idTokenCookie,
+		Value:    rawIDToken,
+		Path:     c.absolutePath("/"),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, c.absolutePath("/"), http.StatusFound)
+}
+
+// handleLogout clears the browser session
+func (c *Viewer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: idTokenCookie, Path: c.absolutePath("/"), MaxAge: -1})
+	c.sendSuccess(w, nil)
+}
+
+// handleWhoAmI returns the authenticated user
+func (c *Viewer) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	c.sendSuccess(w, map[string]interface{}{
+		"authEnabled":   c.auth != nil,
+		"authenticated": ok,
+		"user":          user,
+	})
+}
+
+// randomState returns an unguessable OAuth2 state value
+func randomState() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// claimStrings converts a string or list claim to a string slice
+func claimStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// hasAnyGroup reports whether groups contains one of allowed
+func hasAnyGroup(groups, allowed []string) bool {
+	for _, g := range groups {
+		for _, a := range allowed {
+			if g == a {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package viewer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// fakeIssuer an OIDC provider serving its discovery document and signing
+// key, issuing RS256 ID tokens
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.URL,
+			"authorization_endpoint":                issuer.URL + "/auth",
+			"token_endpoint":                        issuer.URL + "/token",
+			"jwks_uri":                              issuer.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// token signs an ID token for the boltdbui client with key, valid for an
+// hour unless claims override exp
+func (i *fakeIssuer) token(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	now := time.Now()
+	payload := map[string]interface{}{
+		"iss": i.URL,
+		"aud": "boltdbui",
+		"sub": "alice",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// bearer adds an Authorization header to the requests of a client
+type bearer struct {
+	token string
+}
+
+func (b *bearer) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if b.token != "" {
+		r.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestOIDCAuthentication(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	auth, err := newOIDCAuth(context.Background(), OIDCConfig{
+		IssuerURL:     issuer.URL,
+		ClientID:      "boltdbui",
+		AllowedGroups: []string{"sre", "dev"},
+		EditorGroups:  []string{"sre"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.auth = auth
+		c.mode = ModeReadWrite
+	})
+	client := &bearer{}
+	s.Client().Transport = client
+
+	if resp := s.API(http.MethodGet, "/api/buckets", ""); resp.Status != http.StatusUnauthorized {
+		t.Errorf("without a token: status %d, want 401", resp.Status)
+	}
+
+	// Valid tokens map the groups to a role
+	for _, tc := range []struct {
+		group     string
+		role      string
+		putStatus int
+	}{
+		{"sre", RoleEditor, http.StatusOK},
+		{"dev", RoleViewer, http.StatusForbidden},
+	} {
+		client.token = issuer.token(t, issuer.key, map[string]interface{}{"groups": []string{tc.group}})
+		var caps Capabilities
+		s.Get("/api/capabilities").Decode(t, &caps)
+		if caps.Role != tc.role || caps.ReadOnly != (tc.role != RoleEditor) {
+			t.Errorf("%s member: role %q, read-only %v, want %s", tc.group, caps.Role, caps.ReadOnly, tc.role)
+		}
+		if resp := s.API(http.MethodPut, "/api/key/misc/text", "changed"); resp.Status != tc.putStatus {
+			t.Errorf("%s member: PUT status %d, want %d", tc.group, resp.Status, tc.putStatus)
+		}
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		token  string
+		status int
+		err    string
+	}{
+		"wrong group": {issuer.token(t, issuer.key, map[string]interface{}{"groups": []string{"sales"}}), http.StatusForbidden, "not a member of an allowed group"},
+		"no groups":   {issuer.token(t, issuer.key, nil), http.StatusForbidden, "not a member of an allowed group"},
+		"expired": {issuer.token(t, issuer.key, map[string]interface{}{
+			"groups": []string{"sre"},
+			"iat":    time.Now().Add(-2 * time.Hour).Unix(),
+			"exp":    time.Now().Add(-time.Hour).Unix(),
+		}), http.StatusUnauthorized, "expired"},
+		"other audience": {issuer.token(t, issuer.key, map[string]interface{}{"groups": []string{"sre"}, "aud": "other"}), http.StatusUnauthorized, "audience"},
+		"other key":      {issuer.token(t, other, map[string]interface{}{"groups": []string{"sre"}}), http.StatusUnauthorized, "signature"},
+		"malformed":      {"not-a-jwt", http.StatusUnauthorized, "malformed"},
+	} {
+		client.token = tc.token
+		resp := s.API(http.MethodGet, "/api/buckets", "")
+		if resp.Status != tc.status || !strings.Contains(resp.Error, tc.err) {
+			t.Errorf("%s: status %d %q, want %d %q", name, resp.Status, resp.Error, tc.status, tc.err)
+		}
+	}
+}
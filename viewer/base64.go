@@ -0,0 +1,180 @@
+// base64.go - base64 strings nested in values, decoded and typed again
+package viewer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minBase64Length shorter strings are too often plain words to guess at
+const minBase64Length = 16
+
+// maxBase64Findings bounds the strings decoded from one value
+const maxBase64Findings = 100
+
+// Base64Value a base64 string found in a value and its decoded content
+type Base64Value struct {
+	// Path locates the string: "$" for the whole value, JSON paths for
+	// fields, joined by " > " for strings inside decoded content
+	Path          string `json:"path"`
+	EncodedLength int    `json:"encodedLength"`
+	Size          int    `json:"size"`
+	// Type is the detected type of the decoded bytes, Value their
+	// decoding as that type
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// decodeBase64 decodes s if it looks like standard or URL-safe base64,
+// padded or not
+func decodeBase64(s string) ([]byte, bool) {
+	if len(s) < minBase64Length {
+		return nil, false
+	}
+	digit, upper, lower, hexOnly := false, false, false, true
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digit = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+			hexOnly = hexOnly && r <= 'f'
+		case r >= 'A' && r <= 'Z':
+			upper = true
+			hexOnly = false
+		case r == '+' || r == '/' || r == '-' || r == '_' || r == '=':
+			hexOnly = false
+		default:
+			return nil, false
+		}
+	}
+	// Hex digests and identifiers are valid base64 too, real payloads mix
+	// cases and digits
+	if hexOnly || !(upper && lower) && !digit {
+		return nil, false
+	}
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding}
+	for _, enc := range encodings {
+		if data, err := enc.DecodeString(s); err == nil && len(data) > 0 {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// hasBase64 reports whether a string in a decoded JSON value looks like
+// base64, for the decode hint
+func hasBase64(v interface{}) bool {
+	switch t := v.(type) {
+	case string:
+		_, ok := decodeBase64(t)
+		return ok
+	case map[string]interface{}:
+		for _, e := range t {
+			if hasBase64(e) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range t {
+			if hasBase64(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findBase64 decodes the base64 strings of value, the value itself when it
+// is one or the strings of its JSON
+func findBase64(value []byte) ([]Base64Value, error) {
+	var found []Base64Value
+	if data, ok := decodeBase64(strings.TrimSpace(string(value))); ok {
+		found = appendBase64(found, "$", len(strings.TrimSpace(string(value))), data, 0)
+	} else {
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return nil, fmt.Errorf("value is neither base64 nor JSON")
+		}
+		found = walkBase64(found, "$", v, 0)
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no base64 strings found")
+	}
+	return found, nil
+}
+
+// walkBase64 decodes the base64 strings of a JSON value, fields in key order
+func walkBase64(found []Base64Value, path string, v interface{}, depth int) []Base64Value {
+	if depth > maxDecodeDepth || len(found) >= maxBase64Findings {
+		return found
+	}
+	switch t := v.(type) {
+	case string:
+		if data, ok := decodeBase64(t); ok {
+			found = appendBase64(found, path, len(t), data, depth)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			found = walkBase64(found, path+"."+k, t[k], depth+1)
+		}
+	case []interface{}:
+		for i, e := range t {
+			found = walkBase64(found, path+"["+strconv.Itoa(i)+"]", e, depth+1)
+		}
+	}
+	return found
+}
+
+// appendBase64 types decoded bytes, decompressed if need be, and adds them
+// followed by the base64 strings of decoded JSON
+func appendBase64(found []Base64Value, path string, encoded int, data []byte, depth int) []Base64Value {
+	if len(found) >= maxBase64Findings {
+		return found
+	}
+	f := Base64Value{Path: path, EncodedLength: encoded, Size: len(data)}
+	if _, inflated, err := decompressValue(data); err == nil && inflated != nil {
+		data = inflated
+	}
+	f.Type = detectValueType(data)
+	var nested interface{}
+	switch f.Type {
+	case "JSON":
+		json.Unmarshal(data, &nested)
+		f.Value = nested
+	case "Protobuf":
+		f.Value, _ = decodeProtobufValue(data)
+	case "Timestamp":
+		f.Value, _ = decodeTimeValue(data)
+	case codecMsgpack, codecCBOR:
+		_, f.Value = detectCodec(data)
+	case "String":
+		f.Value = string(data)
+	default:
+		f.Value = hexPreview(data, 256)
+	}
+	found = append(found, f)
+	if nested != nil {
+		found = walkBase64(found, path+" > $", nested, depth+1)
+	}
+	return found
+}
+
+// decodeBase64Value decodes the base64 strings of a value for
+// /api/decode/base64
+func decodeBase64Value(value []byte) (map[string]interface{}, error) {
+	found, err := findBase64(value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"found": found}, nil
+}
@@ -0,0 +1,70 @@
+package viewer
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestDecodeBase64(t *testing.T) {
+	anyData, err := proto.Marshal(&anypb.Any{TypeUrl: "types.containerd.io/example/Options", Value: []byte(`{"debug":true}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := base64.StdEncoding.EncodeToString([]byte("a secret token value"))
+	nested := base64.StdEncoding.EncodeToString([]byte(`{"token":"` + inner + `"}`))
+	value := `{"digest":"0123456789abcdef0123456789abcdef","extension":{"value":"` +
+		base64.StdEncoding.EncodeToString(anyData) + `"},"nested":"` + nested + `"}`
+
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("values"))
+		if err != nil {
+			return err
+		}
+		b.Put([]byte("json"), []byte(value))
+		b.Put([]byte("plain"), []byte(`{"name":"configuration"}`))
+		return b.Put([]byte("whole"), []byte(inner))
+	})
+	s := newTestServer(t, path)
+
+	var kv KeyValuePair
+	s.Get("/api/key/values/json").Decode(t, &kv)
+	if len(kv.DecodeHints) != 1 || kv.DecodeHints[0] != hintBase64 {
+		t.Errorf("hints = %v, want [base64]", kv.DecodeHints)
+	}
+
+	var decoded struct {
+		Found []Base64Value `json:"found"`
+	}
+	s.Get("/api/decode/base64/values/json").Decode(t, &decoded)
+	types := map[string]string{}
+	for _, f := range decoded.Found {
+		types[f.Path] = f.Type
+	}
+	want := map[string]string{
+		"$.extension.value":  "Protobuf",
+		"$.nested":           "JSON",
+		"$.nested > $.token": "String",
+	}
+	if len(types) != len(want) {
+		t.Errorf("found = %v, want %v", types, want)
+	}
+	for p, typ := range want {
+		if types[p] != typ {
+			t.Errorf("%s: type %q, want %q", p, types[p], typ)
+		}
+	}
+
+	s.Get("/api/decode/base64/values/whole").Decode(t, &decoded)
+	if len(decoded.Found) != 1 || decoded.Found[0].Path != "$" || decoded.Found[0].Value != "a secret token value" {
+		t.Errorf("whole = %+v", decoded.Found)
+	}
+
+	if resp := s.API("GET", "/api/decode/base64/values/plain", ""); resp.Success {
+		t.Error("decoding a value without base64 succeeded")
+	}
+}
@@ -0,0 +1,51 @@
+// basepath.go - serving below a URL path such as /boltdbui, for ingress and
+// nginx path routing that passes the path on unchanged
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseBasePath normalizes a --base-path to a leading slash and no trailing
+// one, empty for the root
+func parseBasePath(path string) (string, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(path, "?#%\\ ") {
+		return "", fmt.Errorf("invalid base path %q, want a plain path such as /boltdbui", path)
+	}
+	return "/" + path, nil
+}
+
+// withBasePath serves h below the base path: the prefix is stripped from
+// requests, the base path itself redirects to the page and other paths are
+// not found
+func (c *Viewer) withBasePath(h http.Handler) http.Handler {
+	if c.basePath == "" {
+		return h
+	}
+	strip := http.StripPrefix(c.basePath, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == c.basePath:
+			target := c.basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, c.basePath+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// absolutePath the URL path of a route, below the base path
+func (c *Viewer) absolutePath(route string) string {
+	return c.basePath + route
+}
@@ -0,0 +1,186 @@
+// bookmarks.go - favorite bucket paths and keys kept in a sidecar bolt file,
+// which also holds the preferences of preferences.go
+package viewer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bookmarksBucket the bucket of the sidecar file holding the bookmarks
+var bookmarksBucket = []byte("bookmarks")
+
+// errBookmarkNotFound deleting an unknown bookmark id
+var errBookmarkNotFound = errors.New("bookmark not found")
+
+// bookmarksLockTimeout how long a request waits for another boltdbui process
+// using the same bookmarks file
+const bookmarksLockTimeout = time.Second
+
+// Bookmark a bucket, or a key when Key is set
+type Bookmark struct {
+	ID      uint64    `json:"id"`
+	Bucket  string    `json:"bucket"`
+	Key     string    `json:"key,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// defaultBookmarksFile the bookmarks file in the user's configuration
+// directory, e.g. ~/.config/boltdbui/bookmarks.db; never next to the served
+// database, which may be containerd's state directory
+func defaultBookmarksFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "boltdbui", "bookmarks.db")
+}
+
+// withSidecar opens the bookmarks file for one transaction on one of its
+// buckets; the file is not held open so several viewers can share it
+func (c *Viewer) withSidecar(bucket []byte, writable bool, fn func(b *bolt.Bucket) error) error {
+	if c.bookmarksPath == "" {
+		return errors.New("the bookmarks file is disabled")
+	}
+	if writable {
+		if err := os.MkdirAll(filepath.Dir(c.bookmarksPath), 0700); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(c.bookmarksPath); os.IsNotExist(err) {
+		// Nothing bookmarked yet, do not create the file for reading
+		return fn(nil)
+	}
+
+	db, err := bolt.Open(c.bookmarksPath, 0600, &bolt.Options{Timeout: bookmarksLockTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to open bookmarks file %s: %v", c.bookmarksPath, err)
+	}
+	defer db.Close()
+
+	if !writable {
+		return db.View(func(tx *bolt.Tx) error {
+			return fn(tx.Bucket(bucket))
+		})
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// bookmarkKey the bolt key of a bookmark id, big-endian to list them in order
+func bookmarkKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+// handleListBookmarks lists the bookmarks in the order they were added
+func (c *Viewer) handleListBookmarks(w http.ResponseWriter, r *http.Request) {
+	bookmarks := []Bookmark{}
+	err := c.withSidecar(bookmarksBucket, false, func(b *bolt.Bucket) error {
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var bm Bookmark
+			if err := json.Unmarshal(v, &bm); err != nil {
+				slog.Warn("Skipping invalid bookmark", "id", fmt.Sprintf("%x", k), "error", err)
+				return nil
+			}
+			bookmarks = append(bookmarks, bm)
+			return nil
+		})
+	})
+	if err != nil {
+		c.sendError(w, "Failed to read bookmarks", err)
+		return
+	}
+	c.sendSuccess(w, bookmarks)
+}
+
+// handleAddBookmark stores the bookmark of the JSON body; bookmarking the
+// same bucket and key again returns the existing bookmark
+func (c *Viewer) handleAddBookmark(w http.ResponseWriter, r *http.Request) {
+	var req Bookmark
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bookmark", err)
+		return
+	}
+	req.Bucket = strings.Trim(req.Bucket, "/")
+	if req.Bucket == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bookmark", errors.New("bucket is required"))
+		return
+	}
+
+	var bm Bookmark
+	err := c.withSidecar(bookmarksBucket, true, func(b *bolt.Bucket) error {
+		found := false
+		b.ForEach(func(k, v []byte) error {
+			var existing Bookmark
+			if json.Unmarshal(v, &existing) == nil && existing.Bucket == req.Bucket && existing.Key == req.Key {
+				bm, found = existing, true
+			}
+			return nil
+		})
+		if found {
+			return nil
+		}
+
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		bm = Bookmark{ID: id, Bucket: req.Bucket, Key: req.Key, Name: req.Name, Created: time.Now().UTC()}
+		data, err := json.Marshal(bm)
+		if err != nil {
+			return err
+		}
+		return b.Put(bookmarkKey(id), data)
+	})
+	if err != nil {
+		c.sendError(w, "Failed to add bookmark", err)
+		return
+	}
+	c.sendSuccess(w, bm)
+}
+
+// handleDeleteBookmark removes a bookmark by id
+func (c *Viewer) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bookmark id", err)
+		return
+	}
+
+	err = c.withSidecar(bookmarksBucket, true, func(b *bolt.Bucket) error {
+		if b.Get(bookmarkKey(id)) == nil {
+			return errBookmarkNotFound
+		}
+		return b.Delete(bookmarkKey(id))
+	})
+	if errors.Is(err, errBookmarkNotFound) {
+		c.sendErrorCode(w, http.StatusNotFound, "Failed to delete bookmark", err)
+		return
+	}
+	if err != nil {
+		c.sendError(w, "Failed to delete bookmark", err)
+		return
+	}
+	c.sendSuccess(w, map[string]interface{}{"id": id})
+}
@@ -0,0 +1,51 @@
+package viewer
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestBookmarks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config", "bookmarks.db")
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) { c.bookmarksPath = file })
+
+	var list []Bookmark
+	s.Get("/api/bookmarks").Decode(t, &list)
+	if len(list) != 0 {
+		t.Fatalf("bookmarks = %+v, want none", list)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("listing created the bookmarks file: %v", err)
+	}
+
+	var bucket, key, again Bookmark
+	s.API(http.MethodPost, "/api/bookmarks", `{"bucket": "/misc/nested/"}`).Decode(t, &bucket)
+	s.API(http.MethodPost, "/api/bookmarks", `{"bucket": "misc", "key": "json", "name": "config"}`).Decode(t, &key)
+	s.API(http.MethodPost, "/api/bookmarks", `{"bucket": "misc/nested"}`).Decode(t, &again)
+	if bucket.Bucket != "misc/nested" || key.ID == bucket.ID || again.ID != bucket.ID {
+		t.Fatalf("added %+v, %+v and %+v, want the duplicate to be the first", bucket, key, again)
+	}
+
+	s.Get("/api/bookmarks").Decode(t, &list)
+	if len(list) != 2 || list[0].ID != bucket.ID || list[1].Key != "json" || list[1].Name != "config" {
+		t.Fatalf("bookmarks = %+v, want misc/nested and misc:json", list)
+	}
+
+	if resp := s.API(http.MethodDelete, "/api/bookmarks/1", ""); !resp.Success {
+		t.Fatalf("delete: %s", resp.Error)
+	}
+	if resp := s.API(http.MethodDelete, "/api/bookmarks/1", ""); resp.Status != http.StatusNotFound {
+		t.Errorf("deleting again: status %d, want 404", resp.Status)
+	}
+	if resp := s.API(http.MethodPost, "/api/bookmarks", `{"key": "json"}`); resp.Status != http.StatusBadRequest {
+		t.Errorf("bookmark without bucket: status %d, want 400", resp.Status)
+	}
+	s.Get("/api/bookmarks").Decode(t, &list)
+	if len(list) != 1 || list[0].ID != key.ID {
+		t.Errorf("bookmarks after delete = %+v, want misc:json", list)
+	}
+}
@@ -0,0 +1,257 @@
+// cbor.go - CBOR (RFC 8949) values decoded into generic structures
+package viewer
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+// CBOR major types
+const (
+	cborUint = iota
+	cborNegint
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborIndefinite additional info of indefinite lengths, and of the break
+// ending them
+const cborIndefinite = 31
+
+// CBOR tags with a known meaning
+const (
+	cborTagDateTime     = 0
+	cborTagEpoch        = 1
+	cborTagBignum       = 2
+	cborTagNegBignum    = 3
+	cborTagSelfDescribe = 55799
+)
+
+// errCBORBreak the break of an indefinite length item
+var errCBORBreak = fmt.Errorf("unexpected CBOR break")
+
+// decodeCBOR decodes value as exactly one CBOR data item
+func decodeCBOR(value []byte) (interface{}, error) {
+	r := &byteReader{data: value}
+	v, err := cborValue(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.data) > 0 {
+		return nil, fmt.Errorf("%d bytes after the data item", len(r.data))
+	}
+	return v, nil
+}
+
+// cborHead reads an item's major type, additional info and argument
+func cborHead(r *byteReader) (major int, info byte, arg uint64, err error) {
+	b, err := r.uint(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = int(b>>5), byte(b&0x1f)
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		arg, err = r.uint(1 << (info - 24))
+		return major, info, arg, err
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, fmt.Errorf("reserved CBOR additional info %d", info)
+}
+
+// cborValue reads one data item
+func cborValue(r *byteReader, depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, fmt.Errorf("values nested deeper than %d", maxDecodeDepth)
+	}
+	major, info, arg, err := cborHead(r)
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == cborIndefinite
+	if indefinite && (major < cborBytes || major == cborTag) {
+		return nil, fmt.Errorf("major type %d has no indefinite length", major)
+	}
+
+	switch major {
+	case cborUint:
+		return arg, nil
+	case cborNegint:
+		if arg > math.MaxInt64 {
+			return new(big.Int).Sub(big.NewInt(-1), new(big.Int).SetUint64(arg)).String(), nil
+		}
+		return -1 - int64(arg), nil
+	case cborBytes, cborText:
+		data, err := cborString(r, major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(data), nil
+		}
+		return textOrHex(data), nil
+	case cborArray:
+		// Every item takes at least a byte
+		if !indefinite && arg > uint64(len(r.data)) {
+			return nil, fmt.Errorf("array of %d items exceeds the %d bytes left", arg, len(r.data))
+		}
+		items := []interface{}{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			v, err := cborValue(r, depth+1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case cborMap:
+		if !indefinite && arg > uint64(len(r.data))/2 {
+			return nil, fmt.Errorf("map of %d pairs exceeds the %d bytes left", arg, len(r.data))
+		}
+		// Keys other than strings are formatted, JSON objects only have
+		// string keys
+		entries := map[string]interface{}{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			k, err := cborValue(r, depth+1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := cborValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			entries[fmt.Sprint(k)] = v
+		}
+		return entries, nil
+	case cborTag:
+		return cborTagged(r, arg, depth)
+	}
+
+	// Major type 7: simple values, floats and the break
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return jsonFloat(halfFloat(uint16(arg))), nil
+	case 26:
+		return jsonFloat(float64(math.Float32frombits(uint32(arg)))), nil
+	case 27:
+		return jsonFloat(math.Float64frombits(arg)), nil
+	case cborIndefinite:
+		return nil, errCBORBreak
+	}
+	return map[string]interface{}{"simple": arg}, nil
+}
+
+// cborString reads a byte or text string, joining the chunks of indefinite
+// length strings
+func cborString(r *byteReader, major int, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return r.take(n)
+	}
+	var data []byte
+	for {
+		chunkMajor, info, n, err := cborHead(r)
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor == cborSimple && info == cborIndefinite {
+			return data, nil
+		}
+		if chunkMajor != major || info == cborIndefinite {
+			return nil, fmt.Errorf("invalid chunk of major type %d", chunkMajor)
+		}
+		chunk, err := r.take(n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// cborTagged reads the item of a tag: times as RFC 3339, bignums as decimal
+// strings, other tags as their number and item
+func cborTagged(r *byteReader, tag uint64, depth int) (interface{}, error) {
+	if tag == cborTagBignum || tag == cborTagNegBignum {
+		major, info, n, err := cborHead(r)
+		if err != nil {
+			return nil, err
+		}
+		data, err := cborString(r, major, n, info == cborIndefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major != cborBytes {
+			return nil, fmt.Errorf("bignum of major type %d", major)
+		}
+		v := new(big.Int).SetBytes(data)
+		if tag == cborTagNegBignum {
+			v.Sub(big.NewInt(-1), v)
+		}
+		return v.String(), nil
+	}
+
+	v, err := cborValue(r, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case cborTagSelfDescribe:
+		return v, nil
+	case cborTagDateTime:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case cborTagEpoch:
+		switch t := v.(type) {
+		case uint64:
+			return time.Unix(int64(t), 0).UTC().Format(time.RFC3339Nano), nil
+		case int64:
+			return time.Unix(t, 0).UTC().Format(time.RFC3339Nano), nil
+		case float64:
+			sec, frac := math.Modf(t)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return map[string]interface{}{"tag": tag, "value": v}, nil
+}
+
+// halfFloat converts an IEEE 754 half precision float
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,611 @@
+// cli.go - command line interface: server and one-shot subcommands
+package viewer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// exitCode ends the process with a specific code without printing an error,
+// e.g. doctor reporting a failed check
+type exitCode int
+
+func (e exitCode) Error() string { return "exit code " + strconv.Itoa(int(e)) }
+
+// verbose keeps server logs of one-shot commands on stderr and logs at
+// debug level, e.g. the bucket lookups of handlers
+var verbose bool
+
+// serveOptions flags of the server
+type serveOptions struct {
+	mode             string
+	oidc             OIDCConfig
+	allowedGroups    string
+	editorGroups     string
+	listen           []string
+	basePath         string
+	idleTimeout      time.Duration
+	once             bool
+	maxResponseBytes int64
+	staticDir        string
+	treeCacheTTL     time.Duration
+	treeWorkers      int
+	watchInterval    time.Duration
+	snapshotInterval time.Duration
+	statsInterval    time.Duration
+	historySize      int
+	bookmarksFile    string
+	enablePprof      bool
+	maxUploadBytes   int64
+	bolt             BoltOptions
+	discover         bool
+	discoverRoots    []string
+	agents           []string
+	agentService     string
+	nodeName         string
+	requestLog       string
+	requestLogFormat string
+	accessLog        AccessLogOptions
+}
+
+// addFlags registers the server flags on fs
+func (o *serveOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.mode, "mode", ModeReadOnly, "Server mode: read-only or read-write (enables mutating endpoints)")
+	fs.StringArrayVar(&o.listen, "listen", nil, "Address to serve on, repeat to serve on several: host:port, or unix:///run/boltdbui.sock to accept only local processes and a reverse proxy; options follow after commas: tls-cert=FILE,tls-key=FILE serve HTTPS, auth=none skips the OIDC login, e.g. 127.0.0.1:8081,auth=none (default :$PORT, :8081)")
+	fs.StringVar(&o.basePath, "base-path", "", "URL path to serve the UI and API below, e.g. /boltdbui behind an ingress or nginx routing by path")
+	fs.StringVar(&o.oidc.IssuerURL, "oidc-issuer", "", "OIDC issuer URL, enables authentication")
+	fs.StringVar(&o.oidc.ClientID, "oidc-client-id", "", "OIDC client ID")
+	fs.StringVar(&o.oidc.ClientSecret, "oidc-client-secret", os.Getenv("OIDC_CLIENT_SECRET"), "OIDC client secret (default $OIDC_CLIENT_SECRET)")
+	fs.StringVar(&o.oidc.RedirectURL, "oidc-redirect-url", "", "OIDC redirect URL, e.g. https://viewer.example.com/auth/callback")
+	fs.StringVar(&o.oidc.GroupsClaim, "oidc-groups-claim", "groups", "ID token claim holding group membership")
+	fs.StringVar(&o.allowedGroups, "oidc-allowed-groups", "", "Comma separated groups allowed to access the viewer (default any authenticated user)")
+	fs.StringVar(&o.editorGroups, "oidc-editor-groups", "", "Comma separated groups whose members may use the mutating endpoints of read-write mode, other users only read (default every authenticated user)")
+	fs.DurationVar(&o.idleTimeout, "idle-timeout", 0, "Shut down after this long without requests, e.g. 10m (default never)")
+	fs.BoolVar(&o.once, "once", false, "Serve a single browser session, then exit")
+	fs.Int64Var(&o.maxResponseBytes, "max-response-bytes", defaultMaxResponseBytes, "Per-response byte budget, larger results are returned partially with a cursor (0 disables)")
+	fs.StringVar(&o.staticDir, "static-dir", "", "Directory with templates/ and static/ files overriding the embedded frontend")
+	fs.DurationVar(&o.treeCacheTTL, "tree-cache-ttl", defaultTreeCacheTTL, "How long the bucket tree is cached while the database is unchanged (0 disables)")
+	fs.IntVar(&o.treeWorkers, "tree-workers", defaultTreeWorkers, "Top level buckets whose trees are built at once, each in a read transaction of its own (1 builds them in one)")
+	fs.DurationVar(&o.watchInterval, "watch-interval", defaultWatchInterval, "How often the database file is polled for changes by other processes, shown as stale data in the UI (0 disables)")
+	fs.DurationVar(&o.snapshotInterval, "snapshot-interval", 0, "Serve reads from a consistent copy of the database, refreshed at this interval when the file changed, so browsing sees one state while containerd writes (0 serves the file directly; read-only mode only)")
+	fs.DurationVar(&o.statsInterval, "stats-interval", defaultStatsInterval, "How often bolt statistics and the last transaction id are sampled for /api/stats/timeseries, the last 360 samples are kept (0 disables)")
+	fs.IntVar(&o.historySize, "history-size", defaultHistorySize, "Recently viewed buckets and keys kept per browser session for /api/history (0 disables)")
+	fs.StringVar(&o.bookmarksFile, "bookmarks-file", defaultBookmarksFile(), "Bolt file storing bookmarks of buckets and keys and UI preferences (empty disables both)")
+	fs.Int64Var(&o.maxUploadBytes, "max-upload-bytes", defaultMaxUploadBytes, "Largest database accepted by /api/databases/upload (0 disables uploads)")
+	fs.DurationVar(&o.bolt.Timeout, "bolt-timeout", dbLockTimeout, "How long opening the database waits for its file lock, held by a running containerd (0 waits forever)")
+	fs.BoolVar(&o.bolt.NoFreelistSync, "bolt-no-freelist-sync", false, "Do not write the freelist on commits in read-write mode, it is rebuilt when the database is opened")
+	fs.StringVar(&o.bolt.FreelistType, "bolt-freelist-type", freelistArray, "Freelist type of bolt: array or map (faster with many free pages)")
+	fs.IntVar(&o.bolt.InitialMmapSize, "bolt-initial-mmap-size", 0, "Bytes of the database mapped on open, growth within them needs no remapping (default the file size)")
+	fs.BoolVar(&o.bolt.Mlock, "bolt-mlock", false, "Lock the mapped database in memory (not supported on Windows)")
+	fs.BoolVar(&o.discover, "discover", false, "Also serve the bolt databases found below --discover-roots, listed in /api/databases, e.g. snapshotter and buildkit metadata")
+	fs.StringSliceVar(&o.discoverRoots, "discover-roots", defaultDiscoverRoots, "Directories searched by --discover, three levels deep, for *.db bolt files")
+	fs.StringVar(&o.requestLog, "request-log", RequestLogAll, "Requests to log: all, errors (status 400 and above) or none")
+	fs.StringVar(&o.requestLogFormat, "request-log-format", RequestLogText, "Request log format: text (entries of the diagnostic log) or json (JSON lines on stderr)")
+	fs.StringVar(&o.accessLog.Path, "access-log", "", "Audit every request to this file, - for stdout, separate from the request log (default none)")
+	fs.StringVar(&o.accessLog.Format, "access-log-format", AccessLogCombined, "Access log format: combined (Apache) or json (JSON lines)")
+	fs.Int64Var(&o.accessLog.MaxBytes, "access-log-max-bytes", defaultAccessLogMaxBytes, "Size at which the access log is rotated to FILE.1 (0 disables rotation)")
+	fs.IntVar(&o.accessLog.Backups, "access-log-backups", defaultAccessLogBackups, "Rotated access logs kept")
+	fs.StringSliceVar(&o.agents, "agents", nil, "Frontend mode: node=http://host:port agents that requests with ?node= or the X-Boltdbui-Node header are proxied to")
+	fs.StringVar(&o.agentService, "agent-service", "", "Frontend mode: host:port of a headless service whose pods are agents, e.g. boltdbui-agent.kube-system.svc:8081")
+	fs.StringVar(&o.nodeName, "node-name", os.Getenv("NODE_NAME"), "Node name an agent reports to the frontend (default $NODE_NAME)")
+	fs.BoolVar(&o.enablePprof, "enable-pprof", false, "Serve net/http/pprof below /debug/pprof/ and expvar at /debug/vars")
+}
+
+// Main runs the boltdbui command line and exits the process with its result
+func Main() {
+	if err := NewCommand().Execute(); err != nil {
+		var code exitCode
+		if errors.As(err, &code) {
+			os.Exit(int(code))
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// NewCommand builds the boltdbui command tree; without a subcommand the
+// root serves the database like "serve" for compatibility
+func NewCommand() *cobra.Command {
+	opts := &serveOptions{}
+	root := &cobra.Command{
+		Use:           "boltdbui [db]",
+		Short:         "Browse and analyze bolt databases such as containerd's meta.db",
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(opts, locationArg(args, 0))
+		},
+	}
+	opts.addFlags(root.Flags())
+	root.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log details of one-shot commands to stderr and log at debug level")
+	addLogFlags(root.PersistentFlags())
+
+	root.AddCommand(
+		newServeCommand(),
+		newDumpCommand(),
+		newGetCommand(),
+		newLsCommand(),
+		newStatsCommand(),
+		newRunCommand(),
+		newDoctorCommand(),
+		newCompactCommand(),
+	)
+	return root
+}
+
+// locationArg returns args[i] or the default database location
+func locationArg(args []string, i int) string {
+	if len(args) > i {
+		return args[i]
+	}
+	return defaultDBPath
+}
+
+func newServeCommand() *cobra.Command {
+	opts := &serveOptions{}
+	cmd := &cobra.Command{
+		Use:   "serve [db]",
+		Short: "Start the web interface and API",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(opts, locationArg(args, 0))
+		},
+	}
+	opts.addFlags(cmd.Flags())
+	return cmd
+}
+
+// runServe acquires the database and serves it until shutdown
+func runServe(opts *serveOptions, location string) error {
+	if err := setupLogging(os.Stderr); err != nil {
+		return err
+	}
+
+	// A frontend proxies to agents and needs no database of its own
+	frontend := len(opts.agents) > 0 || opts.agentService != ""
+	source := &Source{}
+	if _, err := os.Stat(location); !frontend || location != defaultDBPath || err == nil {
+		// Resolve the location to a local database file
+		source, err = acquireSource(context.Background(), location)
+		if err != nil {
+			return fmt.Errorf("failed to acquire database: %v", err)
+		}
+		defer source.Close()
+	}
+
+	var listeners []Listener
+	for _, spec := range opts.listen {
+		l, err := ParseListener(spec)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	if opts.allowedGroups != "" {
+		opts.oidc.AllowedGroups = strings.Split(opts.allowedGroups, ",")
+	}
+	if opts.editorGroups != "" {
+		opts.oidc.EditorGroups = strings.Split(opts.editorGroups, ",")
+	}
+	maxResponseBytes := opts.maxResponseBytes
+	if maxResponseBytes == 0 {
+		maxResponseBytes = -1 // --max-response-bytes 0 disables the budget
+	}
+	accessLog := opts.accessLog
+	if accessLog.MaxBytes == 0 {
+		accessLog.MaxBytes = -1 // --access-log-max-bytes 0 disables rotation
+	}
+	maxUploadBytes := opts.maxUploadBytes
+	if maxUploadBytes == 0 {
+		maxUploadBytes = -1 // --max-upload-bytes 0 disables uploads
+	}
+	treeCacheTTL := opts.treeCacheTTL
+	if treeCacheTTL == 0 {
+		treeCacheTTL = -1 // --tree-cache-ttl 0 disables the cache
+	}
+	watchInterval := opts.watchInterval
+	if watchInterval == 0 {
+		watchInterval = -1 // --watch-interval 0 disables polling
+	}
+	statsInterval := opts.statsInterval
+	if statsInterval == 0 {
+		statsInterval = -1 // --stats-interval 0 disables sampling
+	}
+	historySize := opts.historySize
+	if historySize == 0 {
+		historySize = -1 // --history-size 0 disables the history
+	}
+	bolt := opts.bolt
+	if bolt.Timeout == 0 {
+		bolt.Timeout = -1 // --bolt-timeout 0 waits forever
+	}
+	var discoverRoots []string
+	if opts.discover {
+		discoverRoots = opts.discoverRoots
+	}
+
+	viewer, err := NewViewer(Options{
+		DBPath:           source.Path,
+		Mode:             opts.mode,
+		MaxResponseBytes: maxResponseBytes,
+		StaticDir:        opts.staticDir,
+		TreeCacheTTL:     treeCacheTTL,
+		TreeWorkers:      opts.treeWorkers,
+		WatchInterval:    watchInterval,
+		SnapshotInterval: opts.snapshotInterval,
+		StatsInterval:    statsInterval,
+		HistorySize:      historySize,
+		BookmarksFile:    opts.bookmarksFile,
+		EnablePprof:      opts.enablePprof,
+		MaxUploadBytes:   maxUploadBytes,
+		Bolt:             bolt,
+		DiscoverRoots:    discoverRoots,
+		Agents:           opts.agents,
+		AgentService:     opts.agentService,
+		NodeName:         opts.nodeName,
+		RequestLog:       opts.requestLog,
+		RequestLogFormat: opts.requestLogFormat,
+		AccessLog:        accessLog,
+		OIDC:             opts.oidc,
+		BasePath:         opts.basePath,
+	})
+	if err != nil {
+		return err
+	}
+	viewer.sourceLocation = source.Location
+	viewer.idleTimeout = opts.idleTimeout
+	viewer.once = opts.once
+	if viewer.writable() {
+		slog.Warn("Running in read-write mode, mutating endpoints are enabled")
+	}
+	if viewer.auth != nil {
+		slog.Info("OIDC authentication enabled", "issuer", opts.oidc.IssuerURL)
+	}
+
+	if sessionFile := os.Getenv("SESSION_FILE"); sessionFile != "" {
+		viewer.session, err = newSessionRecorder(sessionFile)
+		if err != nil {
+			return fmt.Errorf("failed to open session file: %v", err)
+		}
+		slog.Info("Recording session", "file", sessionFile)
+	}
+
+	if len(listeners) == 0 {
+		port := 8081
+		if portStr := os.Getenv("PORT"); portStr != "" {
+			if p, err := strconv.Atoi(portStr); err == nil {
+				port = p
+			}
+		}
+		listeners = []Listener{{Address: fmt.Sprintf(":%d", port)}}
+	}
+
+	if err := viewer.Serve(listeners); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// openViewer acquires a database for a one-shot command, the returned
+// function releases it
+func openViewer(location string) (*Viewer, func(), error) {
+	var logOut io.Writer = io.Discard
+	if verbose {
+		logOut = os.Stderr
+	}
+	if err := setupLogging(logOut); err != nil {
+		return nil, nil, err
+	}
+
+	source, err := acquireSource(context.Background(), location)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to acquire database: %v", err)
+	}
+
+	viewer := newViewer(source.Path)
+	viewer.sourceLocation = source.Location
+	// One-shot output goes to a terminal or a pipe, not through a proxy
+	viewer.maxResponseBytes = 0
+
+	return viewer, func() {
+		viewer.Close()
+		source.Close()
+	}, nil
+}
+
+// printJSON writes v as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func newDumpCommand() *cobra.Command {
+	var format string
+	var decode bool
+	cmd := &cobra.Command{
+		Use:   "dump <db> [bucket-path]",
+		Short: "Print the bucket and key tree as JSON, an indented tree or bbolt compatible text",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch format {
+			case "json", "tree", dumpFormatBbolt, dumpFormatBrowser:
+			default:
+				return fmt.Errorf("invalid format %q, expected json, tree, bbolt or boltbrowser", format)
+			}
+
+			viewer, release, err := openViewer(args[0])
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			bucketPath := ""
+			if len(args) == 2 {
+				bucketPath = args[1]
+			}
+			if format == dumpFormatBbolt || format == dumpFormatBrowser {
+				out := bufio.NewWriter(cmd.OutOrStdout())
+				if err := viewer.dumpText(out, bucketPath, format); err != nil {
+					return err
+				}
+				return out.Flush()
+			}
+			tree, err := viewer.dump(bucketPath, decode)
+			if err != nil {
+				return err
+			}
+
+			if format == "tree" {
+				printDumpTree(cmd.OutOrStdout(), tree, 0)
+				return nil
+			}
+			return printJSON(cmd.OutOrStdout(), tree)
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "o", "json", "Output format: json, tree, or bbolt and boltbrowser for text compatible with those tools")
+	cmd.Flags().BoolVar(&decode, "decode", false, "Decode timestamps, varints and protobuf values of well-known containerd keys")
+	return cmd
+}
+
+func newGetCommand() *cobra.Command {
+	var asJSON, raw bool
+	cmd := &cobra.Command{
+		Use:   "get <db> <bucket-path> <key>",
+		Short: "Print the value of a key",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			viewer, release, err := openViewer(args[0])
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			bucketPath := strings.Trim(args[1], "/")
+			if raw {
+				value, err := viewer.getRawValue(bucketPath, args[2])
+				if err != nil {
+					return err
+				}
+				_, err = cmd.OutOrStdout().Write(value)
+				return err
+			}
+
+			kv, err := viewer.getFullKeyData(bucketPath, args[2])
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return printJSON(cmd.OutOrStdout(), kv)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), kv.Preview)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the key details as JSON")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Write the raw value bytes")
+	return cmd
+}
+
+// LsEntry one line of "boltdbui ls"
+type LsEntry struct {
+	Name   string `json:"name"`
+	Bucket bool   `json:"bucket"`
+	Type   string `json:"type,omitempty"`
+	Size   int    `json:"size,omitempty"`
+}
+
+func newLsCommand() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "ls <db> [bucket-path]",
+		Short: "List the sub-buckets and keys of a bucket",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			viewer, release, err := openViewer(args[0])
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			bucketPath := ""
+			if len(args) == 2 {
+				bucketPath = strings.Trim(args[1], "/")
+			}
+
+			buckets, err := viewer.listChildren(context.Background(), bucketPath, true, 0)
+			if err != nil {
+				return err
+			}
+			entries := make([]LsEntry, 0, len(buckets))
+			for _, name := range buckets {
+				entries = append(entries, LsEntry{Name: name, Bucket: true})
+			}
+			if bucketPath != "" {
+				bucket, _, err := viewer.getBucketDetails(bucketPath, keyOrder{}, nil, nil)
+				if err != nil {
+					return err
+				}
+				for _, kv := range bucket.Keys {
+					entries = append(entries, LsEntry{Name: kv.Key, Type: kv.ValueType, Size: kv.ValueSize})
+				}
+			}
+
+			if asJSON {
+				return printJSON(cmd.OutOrStdout(), entries)
+			}
+			for _, e := range entries {
+				if e.Bucket {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s/\n", e.Name)
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\t%d\n", e.Name, e.Type, e.Size)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print entries as JSON")
+	return cmd
+}
+
+func newStatsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats [db]",
+		Short: "Print database statistics as JSON",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			viewer, release, err := openViewer(locationArg(args, 0))
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			stats, err := viewer.getDatabaseStats()
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), stats)
+		},
+	}
+}
+
+func newRunCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "run <script.star> [db]",
+		Short: "Run a Starlark script against a database",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			src, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read script: %v", err)
+			}
+
+			viewer, release, err := openViewer(locationArg(args, 1))
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			result, err := viewer.runScript(context.Background(), args[0], src)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), result.Output)
+			if result.Result != nil {
+				if err := printJSON(cmd.OutOrStdout(), result.Result); err != nil {
+					return fmt.Errorf("failed to encode result: %v", err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newCompactCommand() *cobra.Command {
+	var txMaxSize int64
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "compact <db> <dest>",
+		Short: "Copy a database into a new compacted file and report the size reduction",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			viewer, release, err := openViewer(args[0])
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			result, err := viewer.compact(args[1], txMaxSize)
+			if err != nil {
+				return fmt.Errorf("failed to compact database: %v", err)
+			}
+			result.Source = viewer.sourceLocation
+
+			if asJSON {
+				return printJSON(cmd.OutOrStdout(), result)
+			}
+			printCompactResult(cmd.OutOrStdout(), result)
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&txMaxSize, "tx-max-size", defaultCompactTxMaxSize, "Bytes copied per destination transaction, 0 for one transaction")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+	return cmd
+}
+
+func newDoctorCommand() *cobra.Command {
+	var location string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "doctor [--db db]",
+		Short: "Run health checks and print a pass/warn/fail report",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				location = args[0]
+			}
+
+			viewer, release, err := openViewer(location)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			report, err := viewer.runDoctor(time.Now(), nil)
+			if err != nil {
+				return fmt.Errorf("failed to run health checks: %v", err)
+			}
+			report.Database = viewer.sourceLocation
+
+			if asJSON {
+				printJSON(cmd.OutOrStdout(), report)
+			} else {
+				printDoctorReport(cmd.OutOrStdout(), report)
+			}
+
+			// A failed check is reported through the exit code only
+			if report.Status == DoctorFail {
+				return exitCode(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&location, "db", defaultDBPath, "Database location")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	return cmd
+}
@@ -0,0 +1,146 @@
+// compact.go - bbolt-style compaction into a new database file
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultCompactTxMaxSize bytes copied per write transaction of the
+// destination, the default of "bbolt compact"
+const defaultCompactTxMaxSize = 65536
+
+// CompactResult the outcome of a compaction
+type CompactResult struct {
+	Source        string `json:"source"`
+	Destination   string `json:"destination"`
+	SourceSize    int64  `json:"sourceSize"`
+	CompactedSize int64  `json:"compactedSize"`
+	// Reclaimed bytes saved by the compacted file, negative if it grew
+	Reclaimed int64 `json:"reclaimed"`
+	// Reduction Reclaimed as a percentage of SourceSize
+	Reduction float64 `json:"reduction"`
+	Duration  string  `json:"duration"`
+}
+
+// handleCompact compacts the database into ?dest=, which must not exist
+func (c *Viewer) handleCompact(w http.ResponseWriter, r *http.Request) {
+	dst := r.URL.Query().Get("dest")
+	if dst == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Missing destination", errors.New("dest is required"))
+		return
+	}
+	txMaxSize := int64(defaultCompactTxMaxSize)
+	if s := r.URL.Query().Get("txMaxSize"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid txMaxSize", err)
+			return
+		}
+		txMaxSize = n
+	}
+
+	result, err := c.compact(dst, txMaxSize)
+	if err != nil {
+		c.sendError(w, "Failed to compact database", err)
+		return
+	}
+	c.sendSuccess(w, result)
+}
+
+// compact copies all buckets and keys of the database into a new file at
+// dst within a single read transaction of the source; the destination is
+// committed every txMaxSize bytes, 0 uses one transaction
+func (c *Viewer) compact(dst string, txMaxSize int64) (*CompactResult, error) {
+	src, err := filepath.Abs(c.databasePath())
+	if err != nil {
+		return nil, err
+	}
+	if dst, err = filepath.Abs(dst); err != nil {
+		return nil, err
+	}
+	if samePath(src, dst) {
+		return nil, fmt.Errorf("destination is the source database")
+	}
+	// Never replace an existing file, bolt would open and extend it
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	db, err := c.openDB()
+	if err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := compactInto(dst, db.DB, txMaxSize); err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CompactResult{
+		Source:        src,
+		Destination:   dst,
+		SourceSize:    srcInfo.Size(),
+		CompactedSize: dstInfo.Size(),
+		Reclaimed:     srcInfo.Size() - dstInfo.Size(),
+		Duration:      time.Since(start).String(),
+	}
+	if result.SourceSize > 0 {
+		result.Reduction = float64(result.Reclaimed) * 100 / float64(result.SourceSize)
+	}
+	slog.Info("Compacted database", "source", src, "destination", dst, "sourceSize", result.SourceSize, "compactedSize", result.CompactedSize)
+	return result, nil
+}
+
+// compactInto opens dst with the page size of the source and copies src
+// into it
+func compactInto(dst string, src *bolt.DB, txMaxSize int64) error {
+	out, err := bolt.Open(dst, 0600, &bolt.Options{
+		Timeout:  time.Second,
+		PageSize: src.Info().PageSize,
+		NoSync:   true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(out, src, txMaxSize); err != nil {
+		out.Close()
+		return err
+	}
+	// Written with NoSync, flush once at the end
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// printCompactResult writes a compaction summary like "bbolt compact"
+func printCompactResult(w io.Writer, r *CompactResult) {
+	fmt.Fprintf(w, "%s -> %s\n", r.Source, r.Destination)
+	fmt.Fprintf(w, "%d -> %d bytes (gain=%.2fx, reclaimed %d bytes, %.1f%%) in %s\n",
+		r.SourceSize, r.CompactedSize, float64(r.SourceSize)/float64(max(r.CompactedSize, 1)),
+		r.Reclaimed, r.Reduction, r.Duration)
+}
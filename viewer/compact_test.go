@@ -0,0 +1,97 @@
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bloated creates a database whose file still holds the pages of a deleted
+// bucket
+func bloated(t *testing.T) string {
+	t.Helper()
+
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		keep, err := tx.CreateBucket([]byte("keep"))
+		if err != nil {
+			return err
+		}
+		if err := keep.Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket([]byte("garbage"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2000; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%04d", i)), make([]byte, 1024)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte("garbage")) }); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompact(t *testing.T) {
+	c := newViewer(bloated(t))
+	defer c.Close()
+
+	dst := filepath.Join(t.TempDir(), "compacted.db")
+	result, err := c.compact(dst, defaultCompactTxMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CompactedSize >= result.SourceSize || result.Reclaimed <= 0 || result.Reduction <= 0 {
+		t.Errorf("result = %+v, want a smaller file", result)
+	}
+
+	var kv KeyValuePair
+	newTestServer(t, dst).Get("/api/key/keep/key").Decode(t, &kv)
+	if kv.Value != "value" {
+		t.Errorf("keep/key = %v, want value", kv.Value)
+	}
+
+	if _, err := c.compact(dst, 0); err == nil {
+		t.Error("compaction replaced an existing file")
+	}
+	if _, err := c.compact(c.dbPath, 0); err == nil {
+		t.Error("compaction into the source succeeded")
+	}
+}
+
+func TestCompactEndpoint(t *testing.T) {
+	path := "/api/compact?dest=" + url.QueryEscape(filepath.Join(t.TempDir(), "compacted.db"))
+
+	ro := newTestServer(t, boltdbtest.Tiny(t))
+	if resp := ro.API(http.MethodPost, path, ""); resp.Status != http.StatusForbidden {
+		t.Errorf("compact in read-only mode: status %d, want 403", resp.Status)
+	}
+
+	rw := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+	var result CompactResult
+	resp := rw.API(http.MethodPost, path, "")
+	if !resp.Success {
+		t.Fatalf("compact failed: %s %s", resp.Error, resp.Message)
+	}
+	resp.Decode(t, &result)
+	if result.CompactedSize == 0 {
+		t.Errorf("result = %+v, want a compacted file", result)
+	}
+}
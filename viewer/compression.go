@@ -0,0 +1,110 @@
+// compression.go - transparent decompression of gzip and zstd values
+package viewer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// maxDecompressedBytes values inflating beyond this are left compressed
+	maxDecompressedBytes = 16 << 20
+	// previewDecompressedBytes how much of a value bucket listings inflate,
+	// the rest is decompressed when the key is opened
+	previewDecompressedBytes = 64 << 10
+)
+
+// Compression formats recognised by their magic bytes
+const (
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressValue inflates a gzip or zstd value, returning its compression
+// and content; the compression is empty for other values
+func decompressValue(value []byte) (string, []byte, error) {
+	compression, data, complete, err := decompressPrefix(value, maxDecompressedBytes)
+	if err == nil && compression != "" && !complete {
+		return compression, nil, fmt.Errorf("decompresses to more than %d bytes", maxDecompressedBytes)
+	}
+	return compression, data, err
+}
+
+// decompressPrefix inflates at most limit bytes of a gzip or zstd value;
+// complete reports whether that is all of its content
+func decompressPrefix(value []byte, limit int) (compression string, data []byte, complete bool, err error) {
+	var r io.Reader
+	switch {
+	case bytes.HasPrefix(value, gzipMagic):
+		zr, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return compressionGzip, nil, false, err
+		}
+		defer zr.Close()
+		compression, r = compressionGzip, zr
+	case bytes.HasPrefix(value, zstdMagic):
+		// One value at a time, without the decoder's goroutines
+		zr, err := zstd.NewReader(bytes.NewReader(value),
+			zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxMemory(4*maxDecompressedBytes))
+		if err != nil {
+			return compressionZstd, nil, false, err
+		}
+		defer zr.Close()
+		compression, r = compressionZstd, zr
+	default:
+		return "", nil, false, nil
+	}
+
+	data, err = io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return compression, nil, false, err
+	}
+	if len(data) > limit {
+		return compression, data[:limit], false, nil
+	}
+	return compression, data, true, nil
+}
+
+// truncatedJSON reports whether data, the start of a longer value, starts a
+// JSON object or array that is valid up to where it was cut
+func truncatedJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 || data[0] != '{' && data[0] != '[' {
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// trimPartialRune drops a multi-byte character cut at the end of data
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
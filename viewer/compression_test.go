@@ -0,0 +1,170 @@
+package viewer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	"github.com/klauspost/compress/zstd"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDecompressedValues(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"name":"web","replicas":3}`))
+	zw.Close()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := `{"a":1}`
+	zst := enc.EncodeAll([]byte(content), nil)
+	// Highly compressible, listings inflate only its first 64 KiB
+	large := strings.Repeat("line of a large log\n", 1<<16)
+	zstLarge := enc.EncodeAll([]byte(large), nil)
+	enc.Close()
+
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("blobs"))
+		if err != nil {
+			return err
+		}
+		b.Put([]byte("gz"), gz.Bytes())
+		b.Put([]byte("zst"), zst)
+		b.Put([]byte("zst-large"), zstLarge)
+		return b.Put([]byte("corrupt"), []byte{0x1f, 0x8b, 0, 1, 2})
+	})
+	s := newTestServer(t, path)
+
+	var kv KeyValuePair
+	s.Get("/api/key/blobs/gz").Decode(t, &kv)
+	if kv.Compression != compressionGzip || kv.ValueType != "JSON" || kv.ValueSize != gz.Len() || kv.DecompressedSize != 27 {
+		t.Errorf("gzip = %+v", kv)
+	}
+	if !strings.HasPrefix(kv.Preview, "gzip, ") || !strings.Contains(kv.Preview, `"replicas": 3`) {
+		t.Errorf("gzip preview = %q", kv.Preview)
+	}
+
+	s.Get("/api/key/blobs/zst").Decode(t, &kv)
+	if kv.Compression != compressionZstd || kv.ValueType != "JSON" || kv.DecompressedSize != len(content) {
+		t.Errorf("zstd = %+v", kv)
+	}
+
+	s.Get("/api/key/blobs/zst-large").Decode(t, &kv)
+	if kv.DecompressedSize != len(large) || kv.DecompressedPartial {
+		t.Errorf("large zstd details = %+v, want all %d bytes", kv.DecompressedSize, len(large))
+	}
+	var bucket BucketInfo
+	s.Get("/api/bucket/blobs").Decode(t, &bucket)
+	listed := false
+	for _, key := range bucket.Keys {
+		if key.Key != "zst-large" {
+			continue
+		}
+		listed = true
+		if key.Compression != compressionZstd || key.DecompressedSize != previewDecompressedBytes || !key.DecompressedPartial {
+			t.Errorf("large zstd listing = %s %d partial %v, want the first %d bytes", key.Compression, key.DecompressedSize, key.DecompressedPartial, previewDecompressedBytes)
+		}
+		if !strings.Contains(key.Preview, "first 65536 decompressed") {
+			t.Errorf("large zstd listing preview = %.80q", key.Preview)
+		}
+	}
+	if !listed {
+		t.Error("zst-large not listed")
+	}
+
+	var corrupt KeyValuePair
+	s.Get("/api/key/blobs/corrupt").Decode(t, &corrupt)
+	if corrupt.Compression != "" || corrupt.ValueType != "Binary" || !strings.HasPrefix(corrupt.Preview, "gzip, not decompressed") {
+		t.Errorf("corrupt = %+v", corrupt)
+	}
+}
+
+func TestCompressedValueChunks(t *testing.T) {
+	// A small value inflating to a megabyte of binary data
+	content := bytes.Repeat([]byte{0xff, 0xfe}, 1<<19)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(content)
+	zw.Close()
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("blobs"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("bin"), gz.Bytes())
+	})
+	s := newTestServer(t, path, func(c *Viewer) {
+		c.maxResponseBytes = 64 << 10
+	})
+
+	// The budget and the chunks apply to the content, not the stored bytes
+	resp := s.Get("/api/key/blobs/bin?full=1")
+	var kv KeyValuePair
+	resp.Decode(t, &kv)
+	if !resp.Partial || kv.Compression != compressionGzip || kv.ValueSize != gz.Len() || kv.DecompressedSize != len(content) {
+		t.Fatalf("first chunk: partial %v, %+v", resp.Partial, kv)
+	}
+	if kv.Offset != 0 || kv.Length == 0 || int64(kv.Length)*5 > 64<<10 || resp.Cursor != strconv.Itoa(kv.Length) {
+		t.Errorf("first chunk: offset %d length %d, cursor %q", kv.Offset, kv.Length, resp.Cursor)
+	}
+	if !strings.Contains(kv.Preview, "ff fe ff fe") {
+		t.Errorf("first chunk is not of the content: %.120q", kv.Preview)
+	}
+
+	resp = s.Get("/api/key/blobs/bin?full=1&cursor=" + resp.Cursor)
+	resp.Decode(t, &kv)
+	if kv.Offset == 0 || kv.DecompressedSize != len(content) {
+		t.Errorf("second chunk: %+v", kv)
+	}
+}
+
+func TestTruncatedCompressedJSON(t *testing.T) {
+	// A JSON document inflating past what listings decompress
+	doc := `{"items":[` + strings.Repeat(`{"name":"café","size":1},`, 1<<13) + `{}]}`
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zst := enc.EncodeAll([]byte(doc), nil)
+	enc.Close()
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("blobs"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("doc"), zst)
+	})
+	s := newTestServer(t, path)
+
+	var bucket BucketInfo
+	s.Get("/api/bucket/blobs").Decode(t, &bucket)
+	if len(bucket.Keys) != 1 || bucket.Keys[0].ValueType != "JSON" || !bucket.Keys[0].DecompressedPartial {
+		t.Errorf("listing = %+v, want the start of a JSON document", bucket.Keys)
+	}
+	var kv KeyValuePair
+	s.Get("/api/key/blobs/doc").Decode(t, &kv)
+	if kv.ValueType != "JSON" || kv.DecompressedPartial || kv.DecompressedSize != len(doc) {
+		t.Errorf("details = %s, partial %v, %d decompressed", kv.ValueType, kv.DecompressedPartial, kv.DecompressedSize)
+	}
+	if typ := detectValueType(zst); typ != "JSON" {
+		t.Errorf("detected type = %s, want JSON", typ)
+	}
+
+	for data, want := range map[string]bool{
+		`{"a":[1,2,{"b":"c`: true,
+		` [1, 2`:            true,
+		`{"a" 1`:            false,
+		`"text`:             false,
+		`plain text`:        false,
+	} {
+		if got := truncatedJSON([]byte(data)); got != want {
+			t.Errorf("truncatedJSON(%q) = %v, want %v", data, got, want)
+		}
+	}
+}
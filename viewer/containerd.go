@@ -0,0 +1,521 @@
+// containerd.go - containerd metadata schema helpers and analysis reports
+package viewer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// containerd metadata bucket keys (mirrors containerd/metadata/buckets.go)
+var (
+	bucketKeyVersion          = []byte("v1")
+	bucketKeyObjectLabels     = []byte("labels")
+	bucketKeyObjectImages     = []byte("images")
+	bucketKeyObjectContainers = []byte("containers")
+	bucketKeyObjectSnapshots  = []byte("snapshots")
+	bucketKeyObjectContent    = []byte("content")
+	bucketKeyObjectBlob       = []byte("blob")
+	bucketKeyObjectIngests    = []byte("ingests")
+	bucketKeyObjectLeases     = []byte("leases")
+	bucketKeyObjectSandboxes  = []byte("sandboxes")
+
+	bucketKeyDigest      = []byte("digest")
+	bucketKeyMediaType   = []byte("mediatype")
+	bucketKeySize        = []byte("size")
+	bucketKeyTarget      = []byte("target")
+	bucketKeyCreatedAt   = []byte("createdat")
+	bucketKeyUpdatedAt   = []byte("updatedat")
+	bucketKeyImage       = []byte("image")
+	bucketKeyName        = []byte("name")
+	bucketKeyParent      = []byte("parent")
+	bucketKeyChildren    = []byte("children")
+	bucketKeySnapshotKey = []byte("snapshotKey")
+	bucketKeySnapshotter = []byte("snapshotter")
+	bucketKeyExpireAt    = []byte("expireat")
+	bucketKeyRuntime     = []byte("runtime")
+	bucketKeyOptions     = []byte("options")
+	bucketKeySpec        = []byte("spec")
+	bucketKeyExtensions  = []byte("extensions")
+	bucketKeySandboxer   = []byte("sandboxer")
+)
+
+// containerd garbage collection label prefixes
+const (
+	labelGCRoot        = "containerd.io/gc.root"
+	labelGCRefContent  = "containerd.io/gc.ref.content"
+	labelGCRefSnapshot = "containerd.io/gc.ref.snapshot."
+	labelGCExpire      = "containerd.io/gc.expire"
+)
+
+// ImageRecord image record decoded from a namespace images bucket
+type ImageRecord struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Digest    string            `json:"digest"`
+	MediaType string            `json:"mediaType"`
+	Size      int64             `json:"size"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// ContainerRecord container record decoded from a namespace containers bucket
+type ContainerRecord struct {
+	Namespace   string            `json:"namespace"`
+	ID          string            `json:"id"`
+	Image       string            `json:"image"`
+	Runtime     string            `json:"runtime"`
+	Snapshotter string            `json:"snapshotter"`
+	SnapshotKey string            `json:"snapshotKey"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// RuntimeOptions the fields of the runtime's options, e.g. the runc
+	// binary and cgroup driver
+	RuntimeOptions map[string]interface{} `json:"runtimeOptions,omitempty"`
+	// SandboxID the pod sandbox of CRI containers, from their metadata
+	// extension
+	SandboxID string `json:"sandboxId,omitempty"`
+}
+
+// SandboxRecord sandbox record decoded from a namespace sandboxes bucket,
+// written by containerd 2.0 and later
+type SandboxRecord struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+	// Sandboxer the controller running the sandbox, e.g. podsandbox or shim
+	Sandboxer      string                 `json:"sandboxer"`
+	Runtime        string                 `json:"runtime"`
+	RuntimeOptions map[string]interface{} `json:"runtimeOptions,omitempty"`
+	// Spec the OCI runtime spec of the sandbox, or the JSON document or
+	// message its type URL resolves to
+	Spec interface{} `json:"spec,omitempty"`
+	// CRI the CRI plugin's pod sandbox metadata extension
+	CRI        *CRIMetadata      `json:"cri,omitempty"`
+	Extensions []string          `json:"extensions,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// ContentRecord content blob record decoded from a namespace content bucket
+type ContentRecord struct {
+	Namespace string            `json:"namespace"`
+	Digest    string            `json:"digest"`
+	Size      int64             `json:"size"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// ImageNamespaceRef one namespace's copy of a duplicated image
+type ImageNamespaceRef struct {
+	Namespace   string `json:"namespace"`
+	Digest      string `json:"digest"`
+	MediaType   string `json:"mediaType"`
+	BlobCount   int    `json:"blobCount"`
+	ContentSize int64  `json:"contentSize"`
+	UniqueBlobs int    `json:"uniqueBlobs"`
+	UniqueBytes int64  `json:"uniqueBytes"`
+}
+
+// DuplicateImage image name present in more than one namespace
+type DuplicateImage struct {
+	Name        string              `json:"name"`
+	Namespaces  []ImageNamespaceRef `json:"namespaces"`
+	SameTarget  bool                `json:"sameTarget"`
+	SharedBlobs int                 `json:"sharedBlobs"`
+	SharedBytes int64               `json:"sharedBytes"`
+}
+
+// DuplicateImageReport cross-namespace duplicate image report
+type DuplicateImageReport struct {
+	Namespaces      []string         `json:"namespaces"`
+	TotalImages     int              `json:"totalImages"`
+	DuplicatedNames int              `json:"duplicatedNames"`
+	SameTarget      int              `json:"sameTarget"`
+	DivergedTarget  int              `json:"divergedTarget"`
+	SharedBytes     int64            `json:"sharedBytes"`
+	Duplicates      []DuplicateImage `json:"duplicates"`
+}
+
+// handleImageDuplicates reports images present in multiple namespaces
+func (c *Viewer) handleImageDuplicates(w http.ResponseWriter, r *http.Request) {
+	report, err := c.getImageDuplicates()
+	if err != nil {
+		c.sendError(w, "Failed to analyze images", err)
+		return
+	}
+
+	c.sendSuccess(w, report)
+}
+
+// getImageDuplicates groups image records by name across namespaces and
+// compares the content each copy references
+func (c *Viewer) getImageDuplicates() (*DuplicateImageReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DuplicateImageReport{}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		byName := make(map[string][]ImageRecord)
+		blobs := make(map[string]map[string]ContentRecord)
+
+		err := forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+			report.Namespaces = append(report.Namespaces, ns)
+			blobs[ns] = readContentRecords(ns, nsb)
+			for _, img := range readImageRecords(ns, nsb) {
+				byName[img.Name] = append(byName[img.Name], img)
+				report.TotalImages++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for name, records := range byName {
+			if len(records) < 2 {
+				continue
+			}
+
+			dup := DuplicateImage{Name: name, SameTarget: true}
+			closures := make([]map[string]int64, len(records))
+			for i, img := range records {
+				closures[i] = contentClosure(blobs[img.Namespace], img.Digest)
+				if img.Digest != records[0].Digest {
+					dup.SameTarget = false
+				}
+			}
+
+			// Blobs referenced by every copy are stored once on disk but
+			// tracked by each namespace
+			shared := make(map[string]int64)
+			for dgst, size := range closures[0] {
+				inAll := true
+				for _, other := range closures[1:] {
+					if _, ok := other[dgst]; !ok {
+						inAll = false
+						break
+					}
+				}
+				if inAll {
+					shared[dgst] = size
+					dup.SharedBlobs++
+					dup.SharedBytes += size
+				}
+			}
+
+			for i, img := range records {
+				ref := ImageNamespaceRef{
+					Namespace: img.Namespace,
+					Digest:    img.Digest,
+					MediaType: img.MediaType,
+					BlobCount: len(closures[i]),
+				}
+				for dgst, size := range closures[i] {
+					ref.ContentSize += size
+					if _, ok := shared[dgst]; !ok {
+						ref.UniqueBlobs++
+						ref.UniqueBytes += size
+					}
+				}
+				dup.Namespaces = append(dup.Namespaces, ref)
+			}
+			sort.Slice(dup.Namespaces, func(i, j int) bool {
+				return dup.Namespaces[i].Namespace < dup.Namespaces[j].Namespace
+			})
+
+			if dup.SameTarget {
+				report.SameTarget++
+			} else {
+				report.DivergedTarget++
+			}
+			report.SharedBytes += dup.SharedBytes
+			report.Duplicates = append(report.Duplicates, dup)
+		}
+		report.DuplicatedNames = len(report.Duplicates)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Largest shared footprint first, these are the best consolidation candidates
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		if report.Duplicates[i].SharedBytes != report.Duplicates[j].SharedBytes {
+			return report.Duplicates[i].SharedBytes > report.Duplicates[j].SharedBytes
+		}
+		return report.Duplicates[i].Name < report.Duplicates[j].Name
+	})
+
+	return report, nil
+}
+
+// forEachNamespace iterates namespace buckets under v1
+func forEachNamespace(tx *bolt.Tx, fn func(ns string, nsb *bolt.Bucket) error) error {
+	v1 := tx.Bucket(bucketKeyVersion)
+	if v1 == nil {
+		return fmt.Errorf("not a containerd metadata database: bucket %q not found", bucketKeyVersion)
+	}
+
+	return v1.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil // schema version key, not a namespace
+		}
+		nsb := v1.Bucket(k)
+		if nsb == nil {
+			return nil
+		}
+		return fn(string(k), nsb)
+	})
+}
+
+// readImageRecords reads all image records of a namespace
+func readImageRecords(ns string, nsb *bolt.Bucket) []ImageRecord {
+	ib := nsb.Bucket(bucketKeyObjectImages)
+	if ib == nil {
+		return nil
+	}
+
+	var images []ImageRecord
+	ib.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		b := ib.Bucket(k)
+		img := ImageRecord{
+			Namespace: ns,
+			Name:      string(k),
+			CreatedAt: readTime(b, bucketKeyCreatedAt),
+			UpdatedAt: readTime(b, bucketKeyUpdatedAt),
+			Labels:    readLabels(b),
+		}
+		if tb := b.Bucket(bucketKeyTarget); tb != nil {
+			img.Digest = string(tb.Get(bucketKeyDigest))
+			img.MediaType = string(tb.Get(bucketKeyMediaType))
+			img.Size = readVarint(tb, bucketKeySize)
+		}
+		images = append(images, img)
+		return nil
+	})
+
+	return images
+}
+
+// readContainerRecords reads all container records of a namespace
+func readContainerRecords(ns string, nsb *bolt.Bucket) []ContainerRecord {
+	cb := nsb.Bucket(bucketKeyObjectContainers)
+	if cb == nil {
+		return nil
+	}
+
+	var containers []ContainerRecord
+	cb.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		b := cb.Bucket(k)
+		ctr := ContainerRecord{
+			Namespace:   ns,
+			ID:          string(k),
+			Image:       string(b.Get(bucketKeyImage)),
+			Snapshotter: string(b.Get(bucketKeySnapshotter)),
+			SnapshotKey: string(b.Get(bucketKeySnapshotKey)),
+			CreatedAt:   readTime(b, bucketKeyCreatedAt),
+			UpdatedAt:   readTime(b, bucketKeyUpdatedAt),
+			Labels:      readLabels(b),
+		}
+		if rb := b.Bucket(bucketKeyRuntime); rb != nil {
+			ctr.Runtime = string(rb.Get(bucketKeyName))
+			ctr.RuntimeOptions = decodeRuntimeOptions(rb.Get(bucketKeyOptions))
+		}
+		if md := readCRIMetadata(b); md != nil {
+			ctr.SandboxID = md.SandboxID
+		}
+		containers = append(containers, ctr)
+		return nil
+	})
+
+	return containers
+}
+
+// readSandboxRecords reads all sandbox records of a namespace
+func readSandboxRecords(ns string, nsb *bolt.Bucket) []SandboxRecord {
+	sb := nsb.Bucket(bucketKeyObjectSandboxes)
+	if sb == nil {
+		return nil
+	}
+
+	var sandboxes []SandboxRecord
+	sb.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		b := sb.Bucket(k)
+		sandbox := SandboxRecord{
+			Namespace: ns,
+			ID:        string(k),
+			Sandboxer: string(b.Get(bucketKeySandboxer)),
+			Spec:      decodeSandboxSpec(b.Get(bucketKeySpec)),
+			CRI:       readCRIMetadata(b),
+			CreatedAt: readTime(b, bucketKeyCreatedAt),
+			UpdatedAt: readTime(b, bucketKeyUpdatedAt),
+			Labels:    readLabels(b),
+		}
+		if rb := b.Bucket(bucketKeyRuntime); rb != nil {
+			sandbox.Runtime = string(rb.Get(bucketKeyName))
+			sandbox.RuntimeOptions = decodeRuntimeOptions(rb.Get(bucketKeyOptions))
+		}
+		if eb := b.Bucket(bucketKeyExtensions); eb != nil {
+			eb.ForEach(func(k, v []byte) error {
+				sandbox.Extensions = append(sandbox.Extensions, string(k))
+				return nil
+			})
+		}
+		sandboxes = append(sandboxes, sandbox)
+		return nil
+	})
+
+	return sandboxes
+}
+
+// decodeSandboxSpec decodes the spec Any of a sandbox, nil if it has none
+// or it is not understood
+func decodeSandboxSpec(value []byte) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	decoded, err := decodeProtobufValue(value)
+	if err != nil {
+		return nil
+	}
+	for _, key := range []string{"spec", "message", "json"} {
+		if v := decoded[key]; v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// readContentRecords reads all content blob records of a namespace keyed by digest
+func readContentRecords(ns string, nsb *bolt.Bucket) map[string]ContentRecord {
+	records := make(map[string]ContentRecord)
+
+	cb := nsb.Bucket(bucketKeyObjectContent)
+	if cb == nil {
+		return records
+	}
+	bb := cb.Bucket(bucketKeyObjectBlob)
+	if bb == nil {
+		return records
+	}
+
+	bb.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		b := bb.Bucket(k)
+		records[string(k)] = ContentRecord{
+			Namespace: ns,
+			Digest:    string(k),
+			Size:      readVarint(b, bucketKeySize),
+			CreatedAt: readTime(b, bucketKeyCreatedAt),
+			UpdatedAt: readTime(b, bucketKeyUpdatedAt),
+			Labels:    readLabels(b),
+		}
+		return nil
+	})
+
+	return records
+}
+
+// contentClosure follows gc.ref.content labels from root and returns every
+// reachable blob known to the namespace with its size
+func contentClosure(blobs map[string]ContentRecord, root string) map[string]int64 {
+	closure := make(map[string]int64)
+	queue := []string{root}
+
+	for len(queue) > 0 {
+		dgst := queue[0]
+		queue = queue[1:]
+		if _, seen := closure[dgst]; seen {
+			continue
+		}
+		rec, ok := blobs[dgst]
+		if !ok {
+			continue
+		}
+		closure[dgst] = rec.Size
+		queue = append(queue, contentRefs(rec.Labels)...)
+	}
+
+	return closure
+}
+
+// contentRefs returns content digests referenced by gc.ref.content labels
+func contentRefs(labels map[string]string) []string {
+	var refs []string
+	for k, v := range labels {
+		if k == labelGCRefContent || strings.HasPrefix(k, labelGCRefContent+".") {
+			refs = append(refs, v)
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// readLabels reads the labels sub-bucket of an object bucket
+func readLabels(b *bolt.Bucket) map[string]string {
+	if b == nil {
+		return nil
+	}
+	lb := b.Bucket(bucketKeyObjectLabels)
+	if lb == nil {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	lb.ForEach(func(k, v []byte) error {
+		if v != nil {
+			labels[string(k)] = string(v)
+		}
+		return nil
+	})
+
+	return labels
+}
+
+// readVarint reads a signed varint value as written by containerd
+func readVarint(b *bolt.Bucket, key []byte) int64 {
+	if b == nil {
+		return 0
+	}
+	v, n := binary.Varint(b.Get(key))
+	if n <= 0 {
+		return 0
+	}
+	return v
+}
+
+// readTime reads a time.Time value stored with MarshalBinary
+func readTime(b *bolt.Bucket, key []byte) time.Time {
+	var t time.Time
+	if b == nil {
+		return t
+	}
+	if value := b.Get(key); value != nil {
+		t.UnmarshalBinary(value)
+	}
+	return t
+}
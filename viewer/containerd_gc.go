@@ -0,0 +1,565 @@
+// containerd_gc.go - read-only containerd garbage collection reference walk
+package viewer
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// gc resource types, named after containerd/gc resource kinds
+const (
+	gcResourceContent  = "content"
+	gcResourceSnapshot = "snapshot"
+	gcResourceIngest   = "ingest"
+)
+
+// gcNode a resource in a namespace's reference graph; snapshot keys are
+// qualified as "<snapshotter>/<key>"
+type gcNode struct {
+	Type string
+	Key  string
+}
+
+// gcGraph reference graph of a single namespace
+type gcGraph struct {
+	Namespace string
+	Roots     map[gcNode]string // node -> reason it is a root
+	Refs      map[gcNode][]gcNode
+	Nodes     map[gcNode]bool
+}
+
+// reachable walks references from all roots
+func (g *gcGraph) reachable() map[gcNode]bool {
+	seen := make(map[gcNode]bool)
+	queue := make([]gcNode, 0, len(g.Roots))
+	for n := range g.Roots {
+		queue = append(queue, n)
+	}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		queue = append(queue, g.Refs[n]...)
+	}
+
+	return seen
+}
+
+// buildGCGraph scans a namespace bucket and collects roots and references
+// following containerd's metadata garbage collector
+func buildGCGraph(ns string, nsb *bolt.Bucket, now time.Time) *gcGraph {
+	g := &gcGraph{
+		Namespace: ns,
+		Roots:     make(map[gcNode]string),
+		Refs:      make(map[gcNode][]gcNode),
+		Nodes:     make(map[gcNode]bool),
+	}
+
+	addRoot := func(n gcNode, reason string) {
+		if _, ok := g.Roots[n]; !ok {
+			g.Roots[n] = reason
+		}
+	}
+
+	// Content blobs, referenced through gc.ref labels
+	for dgst, rec := range readContentRecords(ns, nsb) {
+		n := gcNode{Type: gcResourceContent, Key: dgst}
+		g.Nodes[n] = true
+		g.Refs[n] = labelRefs(rec.Labels)
+		if _, ok := rec.Labels[labelGCRoot]; ok {
+			addRoot(n, "label "+labelGCRoot)
+		}
+	}
+
+	// Snapshots reference their parent and label targets
+	if sb := nsb.Bucket(bucketKeyObjectSnapshots); sb != nil {
+		sb.ForEach(func(snapshotter, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			ssb := sb.Bucket(snapshotter)
+			return ssb.ForEach(func(key, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				kb := ssb.Bucket(key)
+				n := gcNode{Type: gcResourceSnapshot, Key: string(snapshotter) + "/" + string(key)}
+				g.Nodes[n] = true
+
+				labels := readLabels(kb)
+				refs := labelRefs(labels)
+				if parent := kb.Get(bucketKeyParent); len(parent) > 0 {
+					refs = append(refs, gcNode{Type: gcResourceSnapshot, Key: string(snapshotter) + "/" + string(parent)})
+				}
+				g.Refs[n] = refs
+				if _, ok := labels[labelGCRoot]; ok {
+					addRoot(n, "label "+labelGCRoot)
+				}
+				return nil
+			})
+		})
+	}
+
+	// Ingests are kept until they expire
+	if cb := nsb.Bucket(bucketKeyObjectContent); cb != nil {
+		if ib := cb.Bucket(bucketKeyObjectIngests); ib != nil {
+			ib.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				n := gcNode{Type: gcResourceIngest, Key: string(k)}
+				g.Nodes[n] = true
+				expireAt := readTime(ib.Bucket(k), bucketKeyExpireAt)
+				if expireAt.IsZero() || expireAt.After(now) {
+					addRoot(n, "active ingest")
+				}
+				return nil
+			})
+		}
+	}
+
+	// Images root their target and label references
+	for _, img := range readImageRecords(ns, nsb) {
+		if img.Digest != "" {
+			addRoot(gcNode{Type: gcResourceContent, Key: img.Digest}, "image "+img.Name)
+		}
+		for _, n := range labelRefs(img.Labels) {
+			addRoot(n, "image "+img.Name)
+		}
+	}
+
+	// Containers root their snapshot and label references
+	if cb := nsb.Bucket(bucketKeyObjectContainers); cb != nil {
+		cb.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			b := cb.Bucket(k)
+			reason := "container " + string(k)
+			snapshotter := b.Get(bucketKeySnapshotter)
+			snapshotKey := b.Get(bucketKeySnapshotKey)
+			if len(snapshotter) > 0 && len(snapshotKey) > 0 {
+				addRoot(gcNode{Type: gcResourceSnapshot, Key: string(snapshotter) + "/" + string(snapshotKey)}, reason)
+			}
+			for _, n := range labelRefs(readLabels(b)) {
+				addRoot(n, reason)
+			}
+			return nil
+		})
+	}
+
+	// Unexpired leases root everything they hold
+	if lb := nsb.Bucket(bucketKeyObjectLeases); lb != nil {
+		lb.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			b := lb.Bucket(k)
+			if leaseExpired(readLabels(b), now) {
+				return nil
+			}
+			for _, n := range leaseResources(b) {
+				addRoot(n, "lease "+string(k))
+			}
+			return nil
+		})
+	}
+
+	return g
+}
+
+// leaseExpired reports whether a lease's gc.expire label is in the past
+func leaseExpired(labels map[string]string, now time.Time) bool {
+	expire, ok := labels[labelGCExpire]
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, expire)
+	if err != nil {
+		return false
+	}
+	return now.After(t)
+}
+
+// leaseResources lists the content, snapshots and ingests held by a lease
+func leaseResources(b *bolt.Bucket) []gcNode {
+	var nodes []gcNode
+
+	if cb := b.Bucket(bucketKeyObjectContent); cb != nil {
+		cb.ForEach(func(k, v []byte) error {
+			nodes = append(nodes, gcNode{Type: gcResourceContent, Key: string(k)})
+			return nil
+		})
+	}
+	if sb := b.Bucket(bucketKeyObjectSnapshots); sb != nil {
+		sb.ForEach(func(snapshotter, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			return sb.Bucket(snapshotter).ForEach(func(k, v []byte) error {
+				nodes = append(nodes, gcNode{Type: gcResourceSnapshot, Key: string(snapshotter) + "/" + string(k)})
+				return nil
+			})
+		})
+	}
+	if ib := b.Bucket(bucketKeyObjectIngests); ib != nil {
+		ib.ForEach(func(k, v []byte) error {
+			nodes = append(nodes, gcNode{Type: gcResourceIngest, Key: string(k)})
+			return nil
+		})
+	}
+
+	return nodes
+}
+
+// labelRefs converts gc.ref labels into graph nodes
+func labelRefs(labels map[string]string) []gcNode {
+	var nodes []gcNode
+	for _, dgst := range contentRefs(labels) {
+		nodes = append(nodes, gcNode{Type: gcResourceContent, Key: dgst})
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if strings.HasPrefix(k, labelGCRefSnapshot) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		snapshotter := strings.TrimPrefix(k, labelGCRefSnapshot)
+		// Labels may carry a suffix, e.g. gc.ref.snapshot.overlayfs/1
+		if i := strings.Index(snapshotter, "/"); i >= 0 {
+			snapshotter = snapshotter[:i]
+		}
+		nodes = append(nodes, gcNode{Type: gcResourceSnapshot, Key: snapshotter + "/" + labels[k]})
+	}
+
+	return nodes
+}
+
+// OrphanContent unreferenced content blob
+type OrphanContent struct {
+	Namespace   string    `json:"namespace"`
+	Digest      string    `json:"digest"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+	AgeSeconds  int64     `json:"ageSeconds"`
+	AgeBucket   string    `json:"ageBucket"`
+	Reclaimable bool      `json:"reclaimable"`
+}
+
+// OrphanAgeBucket orphan count and size within an age range
+type OrphanAgeBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// OrphanContentReport orphaned content age report
+type OrphanContentReport struct {
+	GeneratedAt      time.Time         `json:"generatedAt"`
+	TotalOrphans     int               `json:"totalOrphans"`
+	OrphanBytes      int64             `json:"orphanBytes"`
+	ReclaimableBytes int64             `json:"reclaimableBytes"`
+	Distribution     []OrphanAgeBucket `json:"distribution"`
+	Orphans          []OrphanContent   `json:"orphans"`
+}
+
+// orphanAgeBuckets age ranges used for the distribution, last one is open ended
+var orphanAgeBuckets = []struct {
+	label string
+	max   time.Duration
+}{
+	{"<1h", time.Hour},
+	{"1h-24h", 24 * time.Hour},
+	{"1d-7d", 7 * 24 * time.Hour},
+	{"7d-30d", 30 * 24 * time.Hour},
+	{">30d", 0},
+}
+
+// handleContentOrphans reports unreferenced content blobs by age
+func (c *Viewer) handleContentOrphans(w http.ResponseWriter, r *http.Request) {
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+
+	report, err := c.getContentOrphans(time.Now(), ns)
+	if err != nil {
+		c.sendError(w, "Failed to analyze content", err)
+		return
+	}
+
+	c.sendSuccess(w, report)
+}
+
+// getContentOrphans finds content blobs not reachable from any gc root, of
+// namespace ns if not empty
+func (c *Viewer) getContentOrphans(now time.Time, ns string) (*OrphanContentReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OrphanContentReport{GeneratedAt: now}
+	for _, ab := range orphanAgeBuckets {
+		report.Distribution = append(report.Distribution, OrphanAgeBucket{Label: ab.label})
+	}
+
+	// A blob is only freed on disk when no namespace references it
+	referenced := make(map[string]bool)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if ns != "" {
+			if _, err := namespaceBucket(tx, ns); err != nil {
+				return err
+			}
+		}
+		return forEachNamespace(tx, func(name string, nsb *bolt.Bucket) error {
+			reachable := buildGCGraph(name, nsb, now).reachable()
+			for dgst, rec := range readContentRecords(name, nsb) {
+				if reachable[gcNode{Type: gcResourceContent, Key: dgst}] {
+					referenced[dgst] = true
+					continue
+				}
+				// Other namespaces still count for what is reclaimable
+				if ns != "" && name != ns {
+					continue
+				}
+
+				age := now.Sub(rec.CreatedAt)
+				if rec.CreatedAt.IsZero() {
+					age = 0
+				}
+				report.Orphans = append(report.Orphans, OrphanContent{
+					Namespace:  name,
+					Digest:     dgst,
+					Size:       rec.Size,
+					CreatedAt:  rec.CreatedAt,
+					AgeSeconds: int64(age.Seconds()),
+					AgeBucket:  orphanAgeBucket(report.Distribution, age, rec.Size),
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counted := make(map[string]bool)
+	for i := range report.Orphans {
+		o := &report.Orphans[i]
+		report.OrphanBytes += o.Size
+		o.Reclaimable = !referenced[o.Digest]
+		if o.Reclaimable && !counted[o.Digest] {
+			counted[o.Digest] = true
+			report.ReclaimableBytes += o.Size
+		}
+	}
+	report.TotalOrphans = len(report.Orphans)
+
+	// Reclaimable, large and old blobs are the best cleanup targets
+	sort.Slice(report.Orphans, func(i, j int) bool {
+		a, b := report.Orphans[i], report.Orphans[j]
+		if a.Reclaimable != b.Reclaimable {
+			return a.Reclaimable
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.AgeSeconds > b.AgeSeconds
+	})
+
+	return report, nil
+}
+
+// orphanAgeBucket accounts an orphan in the distribution and returns its bucket label
+func orphanAgeBucket(dist []OrphanAgeBucket, age time.Duration, size int64) string {
+	i := len(orphanAgeBuckets) - 1
+	for j, ab := range orphanAgeBuckets {
+		if ab.max > 0 && age < ab.max {
+			i = j
+			break
+		}
+	}
+	dist[i].Count++
+	dist[i].Bytes += size
+	return dist[i].Label
+}
+
+// GCResource a resource of the gc report; Reason why a root is one
+type GCResource struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Reason string `json:"reason,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	// Shared collected content another namespace still references, only
+	// its metadata record would go
+	Shared bool `json:"shared,omitempty"`
+}
+
+// GCCounts resources of a gc report by type
+type GCCounts struct {
+	Content   int `json:"content"`
+	Snapshots int `json:"snapshots"`
+	Ingests   int `json:"ingests"`
+}
+
+// add counts a resource of type typ
+func (c *GCCounts) add(typ string) {
+	switch typ {
+	case gcResourceContent:
+		c.Content++
+	case gcResourceSnapshot:
+		c.Snapshots++
+	case gcResourceIngest:
+		c.Ingests++
+	}
+}
+
+// GCNamespaceReport outcome of a simulated collection of one namespace:
+// roots, resources reachable from them and resources that would be removed
+type GCNamespaceReport struct {
+	Namespace       string       `json:"namespace"`
+	Roots           []GCResource `json:"roots"`
+	Reachable       []GCResource `json:"reachable"`
+	Collected       []GCResource `json:"collected"`
+	RootCounts      GCCounts     `json:"rootCounts"`
+	ReachableCounts GCCounts     `json:"reachableCounts"`
+	CollectedCounts GCCounts     `json:"collectedCounts"`
+	CollectedBytes  int64        `json:"collectedBytes"`
+}
+
+// GCReport simulated garbage collection of the metadata database
+type GCReport struct {
+	GeneratedAt    time.Time           `json:"generatedAt"`
+	Collected      GCCounts            `json:"collected"`
+	CollectedBytes int64               `json:"collectedBytes"`
+	Namespaces     []GCNamespaceReport `json:"namespaces"`
+}
+
+// handleGCReport simulates containerd's garbage collector read-only
+func (c *Viewer) handleGCReport(w http.ResponseWriter, r *http.Request) {
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+
+	report, err := c.getGCReport(time.Now(), ns)
+	if err != nil {
+		c.sendError(w, "Failed to simulate garbage collection", err)
+		return
+	}
+
+	c.sendSuccess(w, report)
+}
+
+// getGCReport walks the reference graph of every namespace (or ns) from its
+// roots; resources not reached would be collected. Reachable resources are
+// listed without the roots; CollectedBytes counts content sizes only
+func (c *Viewer) getGCReport(now time.Time, ns string) (*GCReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GCReport{GeneratedAt: now, Namespaces: []GCNamespaceReport{}}
+	referenced := make(map[string]bool)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if ns != "" {
+			if _, err := namespaceBucket(tx, ns); err != nil {
+				return err
+			}
+		}
+		return forEachNamespace(tx, func(name string, nsb *bolt.Bucket) error {
+			g := buildGCGraph(name, nsb, now)
+			reachable := g.reachable()
+			for n := range reachable {
+				if n.Type == gcResourceContent && g.Nodes[n] {
+					referenced[n.Key] = true
+				}
+			}
+			if ns != "" && name != ns {
+				return nil
+			}
+
+			blobs := readContentRecords(name, nsb)
+			nr := GCNamespaceReport{
+				Namespace: name,
+				Roots:     []GCResource{},
+				Reachable: []GCResource{},
+				Collected: []GCResource{},
+			}
+			for n, reason := range g.Roots {
+				// Roots may name resources that do not exist (anymore)
+				if !g.Nodes[n] {
+					continue
+				}
+				nr.Roots = append(nr.Roots, GCResource{Type: n.Type, Key: n.Key, Reason: reason, Size: blobs[n.Key].Size})
+				nr.RootCounts.add(n.Type)
+			}
+			for n := range g.Nodes {
+				res := GCResource{Type: n.Type, Key: n.Key}
+				if n.Type == gcResourceContent {
+					res.Size = blobs[n.Key].Size
+				}
+				switch _, root := g.Roots[n]; {
+				case root:
+				case reachable[n]:
+					nr.Reachable = append(nr.Reachable, res)
+					nr.ReachableCounts.add(n.Type)
+				default:
+					nr.Collected = append(nr.Collected, res)
+					nr.CollectedCounts.add(n.Type)
+					nr.CollectedBytes += res.Size
+				}
+			}
+			sortGCResources(nr.Roots)
+			sortGCResources(nr.Reachable)
+			sortGCResources(nr.Collected)
+			report.Namespaces = append(report.Namespaces, nr)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A blob collected here stays on disk while another namespace needs it
+	for i := range report.Namespaces {
+		nr := &report.Namespaces[i]
+		for j := range nr.Collected {
+			res := &nr.Collected[j]
+			res.Shared = res.Type == gcResourceContent && referenced[res.Key]
+		}
+		report.Collected.Content += nr.CollectedCounts.Content
+		report.Collected.Snapshots += nr.CollectedCounts.Snapshots
+		report.Collected.Ingests += nr.CollectedCounts.Ingests
+		report.CollectedBytes += nr.CollectedBytes
+	}
+
+	return report, nil
+}
+
+// sortGCResources orders resources by type and key
+func sortGCResources(resources []GCResource) {
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+		return resources[i].Key < resources[j].Key
+	})
+}
@@ -0,0 +1,174 @@
+// containerd_search.go - label search across containerd objects
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// containerd object types matched by label search
+const (
+	labelObjectContainer = "container"
+	labelObjectImage     = "image"
+	labelObjectContent   = "content"
+	labelObjectSnapshot  = "snapshot"
+)
+
+// LabelMatch a containerd object whose labels match a label search; Key is
+// the container id, image name, digest or snapshotter/key and Path the
+// bucket of the object
+type LabelMatch struct {
+	Namespace string            `json:"namespace"`
+	Type      string            `json:"type"`
+	Key       string            `json:"key"`
+	Path      string            `json:"path"`
+	Labels    map[string]string `json:"labels"`
+}
+
+// labelSelector one ?label= of a search, key=value or a bare key matching
+// any value
+type labelSelector struct {
+	key      string
+	value    string
+	anyValue bool
+}
+
+// parseLabelSelectors parses the ?label= parameters of a request
+func parseLabelSelectors(r *http.Request) ([]labelSelector, error) {
+	var selectors []labelSelector
+	for _, l := range r.URL.Query()["label"] {
+		key, value, ok := strings.Cut(l, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid label selector %q, expected key=value or key", l)
+		}
+		selectors = append(selectors, labelSelector{key: key, value: value, anyValue: !ok})
+	}
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("no label selector, use ?label=key=value")
+	}
+	return selectors, nil
+}
+
+// matchLabels reports whether labels satisfy every selector
+func matchLabels(labels map[string]string, selectors []labelSelector) bool {
+	for _, s := range selectors {
+		v, ok := labels[s.key]
+		if !ok || !s.anyValue && v != s.value {
+			return false
+		}
+	}
+	return true
+}
+
+// handleLabelSearch finds containers, images, content and snapshots by label
+func (c *Viewer) handleLabelSearch(w http.ResponseWriter, r *http.Request) {
+	selectors, err := parseLabelSelectors(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid label search", err)
+		return
+	}
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+	offset, err := decodeOffsetCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	matches, err := c.searchLabels(ns, selectors)
+	if err != nil {
+		c.sendError(w, "Label search failed", err)
+		return
+	}
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+
+	budget := c.newResponseBudget()
+	for i, m := range matches {
+		if !budget.take(m) {
+			c.sendPartial(w, matches[:i], strconv.Itoa(offset+i))
+			return
+		}
+	}
+	c.sendSuccess(w, matches)
+}
+
+// searchLabels matches the label buckets of the containers, images, content
+// blobs and snapshots of every namespace (or ns); all selectors must match
+func (c *Viewer) searchLabels(ns string, selectors []labelSelector) ([]LabelMatch, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []LabelMatch{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if ns != "" {
+			if _, err := namespaceBucket(tx, ns); err != nil {
+				return err
+			}
+		}
+		return forEachNamespace(tx, func(name string, nsb *bolt.Bucket) error {
+			if ns != "" && name != ns {
+				return nil
+			}
+			root := namespacePath(name)
+			add := func(typ, key, path string, labels map[string]string) {
+				if matchLabels(labels, selectors) {
+					matches = append(matches, LabelMatch{Namespace: name, Type: typ, Key: key, Path: root + "/" + path, Labels: labels})
+				}
+			}
+
+			for _, ctr := range readContainerRecords(name, nsb) {
+				add(labelObjectContainer, ctr.ID, string(bucketKeyObjectContainers)+"/"+ctr.ID, ctr.Labels)
+			}
+			for _, img := range readImageRecords(name, nsb) {
+				add(labelObjectImage, img.Name, string(bucketKeyObjectImages)+"/"+img.Name, img.Labels)
+			}
+			for dgst, blob := range readContentRecords(name, nsb) {
+				add(labelObjectContent, dgst, string(bucketKeyObjectContent)+"/"+string(bucketKeyObjectBlob)+"/"+dgst, blob.Labels)
+			}
+			if sb := nsb.Bucket(bucketKeyObjectSnapshots); sb != nil {
+				sb.ForEach(func(snapshotter, v []byte) error {
+					if v != nil {
+						return nil
+					}
+					ssb := sb.Bucket(snapshotter)
+					return ssb.ForEach(func(key, v []byte) error {
+						if v == nil {
+							path := string(bucketKeyObjectSnapshots) + "/" + string(snapshotter) + "/" + string(key)
+							add(labelObjectSnapshot, string(snapshotter)+"/"+string(key), path, readLabels(ssb.Bucket(key)))
+						}
+						return nil
+					})
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Key < b.Key
+	})
+	return matches, nil
+}
@@ -0,0 +1,360 @@
+package viewer
+
+import (
+	"encoding/binary"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/api/types/runc/options"
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestImageDuplicates(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var report DuplicateImageReport
+	s.Get("/api/containerd/images/duplicates").Decode(t, &report)
+
+	if report.DuplicatedNames != 1 || len(report.Duplicates) != 1 {
+		t.Fatalf("duplicates = %+v, want only %s", report.Duplicates, boltdbtest.Image)
+	}
+	dup := report.Duplicates[0]
+	if dup.Name != boltdbtest.Image || !dup.SameTarget {
+		t.Errorf("duplicate = %+v, want %s with the same target", dup, boltdbtest.Image)
+	}
+	if len(dup.Namespaces) != len(boltdbtest.Namespaces) {
+		t.Errorf("%d namespaces, want %d", len(dup.Namespaces), len(boltdbtest.Namespaces))
+	}
+}
+
+func TestContentOrphans(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var report OrphanContentReport
+	s.Get("/api/containerd/content/orphans").Decode(t, &report)
+
+	if report.TotalOrphans != len(boltdbtest.Namespaces) {
+		t.Fatalf("%d orphans, want one per namespace: %+v", report.TotalOrphans, report.Orphans)
+	}
+	for _, o := range report.Orphans {
+		if o.Digest != boltdbtest.OrphanDigest(o.Namespace) {
+			t.Errorf("unexpected orphan %s in %s", o.Digest, o.Namespace)
+		}
+		if !o.Reclaimable {
+			t.Errorf("%s is not reclaimable", o.Digest)
+		}
+	}
+}
+
+func TestContainerViews(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var views []ContainerView
+	s.Get("/api/containerd/containers").Decode(t, &views)
+	if len(views) != len(boltdbtest.Namespaces) {
+		t.Fatalf("containers = %+v, want one per namespace", views)
+	}
+	v := views[0]
+	if v.Namespace != "default" || v.ID != boltdbtest.Container || v.Image != boltdbtest.Image {
+		t.Errorf("container = %+v, want %s of %s in default", v, boltdbtest.Container, boltdbtest.Image)
+	}
+	if v.ImageDigest != "sha256:index1" || v.ImageMissing {
+		t.Errorf("image digest = %q (missing %v), want sha256:index1", v.ImageDigest, v.ImageMissing)
+	}
+	if v.SnapshotKey != boltdbtest.Container+"-rw" || v.SnapshotParent != "sha256:chain1" || v.SnapshotMissing {
+		t.Errorf("snapshot = %q parent %q (missing %v)", v.SnapshotKey, v.SnapshotParent, v.SnapshotMissing)
+	}
+	if v.Runtime != "io.containerd.runc.v2" || v.Pod != "foo" || v.CreatedAt.IsZero() {
+		t.Errorf("runtime %q pod %q created %v", v.Runtime, v.Pod, v.CreatedAt)
+	}
+	// pull-lease holds layer1, part of the image's content
+	if len(v.Leases) != 1 || v.Leases[0] != "pull-lease" {
+		t.Errorf("leases = %v, want [pull-lease]", v.Leases)
+	}
+
+	s.Get("/api/containerd/containers?namespace=moby").Decode(t, &views)
+	if len(views) != 1 || views[0].Namespace != "moby" {
+		t.Errorf("moby containers = %+v", views)
+	}
+}
+
+func TestContainerRuntimeOptions(t *testing.T) {
+	runc, err := anypb.New(&options.Options{BinaryName: "crun", Root: "/run/crun", SystemdCgroup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// io.containerd.runtime.v1.linux options: runtime, systemd_cgroup and
+	// a field unknown to the decoder
+	var legacy []byte
+	legacy = protowire.AppendTag(legacy, 1, protowire.BytesType)
+	legacy = protowire.AppendString(legacy, "runc")
+	legacy = protowire.AppendTag(legacy, 4, protowire.VarintType)
+	legacy = protowire.AppendVarint(legacy, 1)
+	legacy = protowire.AppendTag(legacy, 9, protowire.BytesType)
+	legacy = protowire.AppendString(legacy, "x")
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		v1, _ := tx.CreateBucket([]byte("v1"))
+		nsb, _ := v1.CreateBucket([]byte("default"))
+		containers, _ := nsb.CreateBucket([]byte("containers"))
+		for id, opts := range map[string]*anypb.Any{
+			"ctr-runc":   runc,
+			"ctr-legacy": {TypeUrl: "containerd.linux.runc.RuncOptions", Value: legacy},
+		} {
+			ctr, _ := containers.CreateBucket([]byte(id))
+			rb, _ := ctr.CreateBucket([]byte("runtime"))
+			rb.Put([]byte("name"), []byte("io.containerd.runc.v2"))
+			value, err := proto.Marshal(opts)
+			if err != nil {
+				return err
+			}
+			if err := rb.Put([]byte("options"), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s := newTestServer(t, path)
+
+	var views []ContainerView
+	s.Get("/api/containerd/containers").Decode(t, &views)
+	if len(views) != 2 {
+		t.Fatalf("containers = %+v, want two", views)
+	}
+	if opts := views[0].RuntimeOptions; opts["runtime"] != "runc" || opts["systemd_cgroup"] != true || len(opts) != 2 {
+		t.Errorf("legacy options = %v, want runtime and systemd_cgroup", opts)
+	}
+	if opts := views[1].RuntimeOptions; opts["binary_name"] != "crun" || opts["root"] != "/run/crun" || opts["systemd_cgroup"] != true {
+		t.Errorf("runc options = %v, want crun rooted at /run/crun", opts)
+	}
+
+	var decoded struct {
+		Message map[string]interface{} `json:"message"`
+	}
+	s.Get("/api/decode/protobuf/v1/default/containers/ctr-legacy/runtime/options").Decode(t, &decoded)
+	if decoded.Message["runtime"] != "runc" {
+		t.Errorf("decoded = %v, want the legacy runc options", decoded.Message)
+	}
+}
+
+func TestImageViews(t *testing.T) {
+	root := t.TempDir()
+	writeBlob := func(dgst, data string) {
+		path, err := blobPath(root, dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeBlob("sha256:index1", `{"manifests":[
+		{"digest":"sha256:manifest1","platform":{"os":"linux","architecture":"arm64","variant":"v8"}},
+		{"digest":"sha256:manifest2","platform":{"os":"linux","architecture":"amd64"}},
+		{"digest":"sha256:att","platform":{"os":"unknown","architecture":"unknown"}}]}`)
+	t.Setenv("CONTENT_ROOT", root)
+
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var views []ImageView
+	s.Get("/api/containerd/images?namespace=k8s.io").Decode(t, &views)
+	if len(views) != 1 {
+		t.Fatalf("images = %+v, want %s", views, boltdbtest.Image)
+	}
+	v := views[0]
+	if v.Name != boltdbtest.Image || v.Digest != "sha256:index1" || v.TargetSize != 500 {
+		t.Errorf("image = %+v", v)
+	}
+	// index1, manifest1, config1 and layer1
+	if v.Blobs != 4 || v.Size != 500+1000+2000+3000000 || len(v.MissingBlobs) != 0 {
+		t.Errorf("%d blobs of %d bytes, missing %v", v.Blobs, v.Size, v.MissingBlobs)
+	}
+	if strings.Join(v.Platforms, ",") != "linux/arm64/v8,linux/amd64" || v.PlatformsError != "" {
+		t.Errorf("platforms = %v (%s)", v.Platforms, v.PlatformsError)
+	}
+
+	t.Setenv("CONTENT_ROOT", t.TempDir())
+	s.Get("/api/containerd/images").Decode(t, &views)
+	if len(views) != len(boltdbtest.Namespaces) || views[0].PlatformsError == "" {
+		t.Errorf("images without content store = %+v", views)
+	}
+}
+
+func TestSnapshotChain(t *testing.T) {
+	root := t.TempDir()
+	backend, err := bolt.Open(filepath.Join(root, "metadata.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backend.Update(func(tx *bolt.Tx) error {
+		v1, _ := tx.CreateBucket(bucketKeyVersion)
+		sb, _ := v1.CreateBucket(snapshotterKeySnapshots)
+		for i, key := range []string{"k8s.io/1/sha256:chain1", "k8s.io/2/" + boltdbtest.Container + "-rw"} {
+			b, _ := sb.CreateBucket([]byte(key))
+			b.Put(snapshotterKeyID, binary.AppendUvarint(nil, uint64(i+1)))
+			b.Put(snapshotterKeyKind, []byte{byte(3 - i)})
+			b.Put(bucketKeySize, binary.AppendVarint(nil, int64(1000*(i+1))))
+		}
+		return nil
+	})
+	backend.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SNAPSHOTTER_ROOT", root)
+
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var chain SnapshotChain
+	s.Get("/api/containerd/snapshots/chain?namespace=k8s.io&key="+boltdbtest.Container+"-rw&backend=1").Decode(t, &chain)
+	if chain.Depth != 2 || chain.Chain[1].Key != "sha256:chain1" || chain.Chain[1].Parent != "" {
+		t.Fatalf("chain = %+v, want %s-rw on sha256:chain1", chain.Chain, boltdbtest.Container)
+	}
+	if chain.BackendError != "" || chain.Chain[0].Kind != "Active" || chain.Chain[1].Kind != "Committed" || chain.TotalSize != 3000 {
+		t.Errorf("backend %q (%s): %+v, total %d", chain.Backend, chain.BackendError, chain.Chain, chain.TotalSize)
+	}
+
+	if resp := s.API(http.MethodGet, "/api/containerd/snapshots/chain?namespace=k8s.io&key=missing", ""); resp.Success {
+		t.Error("unknown snapshot succeeded")
+	}
+	if status, _ := s.Do(http.MethodGet, "/api/containerd/snapshots/chain?key=sha256:chain1", nil); status != http.StatusBadRequest {
+		t.Errorf("chain without namespace = %d, want 400", status)
+	}
+}
+
+func TestLeases(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var leases []LeaseView
+	s.Get("/api/containerd/leases?namespace=default").Decode(t, &leases)
+	if len(leases) != 1 || leases[0].ID != "pull-lease" || leases[0].Expired {
+		t.Fatalf("leases = %+v, want pull-lease", leases)
+	}
+	if len(leases[0].Content) != 1 || leases[0].Content[0] != "sha256:layer1" {
+		t.Errorf("content = %v, want [sha256:layer1]", leases[0].Content)
+	}
+
+	s.Get("/api/containerd/leases?digest=sha256:layer1").Decode(t, &leases)
+	if len(leases) != len(boltdbtest.Namespaces) || leases[0].Via != "" {
+		t.Errorf("leases of layer1 = %+v, want pull-lease of every namespace", leases)
+	}
+	s.Get("/api/containerd/leases?digest=sha256:index1").Decode(t, &leases)
+	if len(leases) != 0 {
+		t.Errorf("leases of index1 = %+v, want none", leases)
+	}
+	if status, _ := s.Do(http.MethodGet, "/api/containerd/leases?digest=../x", nil); status != http.StatusBadRequest {
+		t.Errorf("invalid digest = %d, want 400", status)
+	}
+}
+
+func TestGCReport(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var report GCReport
+	s.Get("/api/containerd/gc-report?namespace=k8s.io").Decode(t, &report)
+	if len(report.Namespaces) != 1 {
+		t.Fatalf("namespaces = %+v, want k8s.io", report.Namespaces)
+	}
+	nr := report.Namespaces[0]
+
+	collected := map[string]bool{}
+	for _, res := range nr.Collected {
+		collected[res.Type+" "+res.Key] = true
+	}
+	for _, want := range []string{
+		"content " + boltdbtest.OrphanDigest("k8s.io"),
+		"snapshot " + boltdbtest.Snapshotter + "/" + boltdbtest.StaleSnapshot,
+		"ingest " + boltdbtest.StaleIngest,
+	} {
+		if !collected[want] {
+			t.Errorf("%s not collected: %+v", want, nr.Collected)
+		}
+	}
+	if len(nr.Collected) != 3 || report.CollectedBytes != 20000 {
+		t.Errorf("collected = %+v (%d bytes), want the orphan, stale snapshot and ingest", nr.Collected, report.CollectedBytes)
+	}
+
+	roots := map[string]string{}
+	for _, res := range nr.Roots {
+		roots[res.Key] = res.Reason
+	}
+	if roots["sha256:index1"] != "image "+boltdbtest.Image || roots["sha256:layer1"] != "lease pull-lease" {
+		t.Errorf("roots = %v", roots)
+	}
+	// The manifest, config and committed layer snapshot hang off the roots
+	if nr.ReachableCounts.Content != 2 || nr.ReachableCounts.Snapshots != 1 {
+		t.Errorf("reachable = %+v", nr.Reachable)
+	}
+}
+
+func TestLabelSearch(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var matches []LabelMatch
+	s.Get("/api/containerd/search?label=io.kubernetes.pod.name=foo").Decode(t, &matches)
+	if len(matches) != len(boltdbtest.Namespaces) {
+		t.Fatalf("matches = %+v, want the container of every namespace", matches)
+	}
+	m := matches[0]
+	if m.Type != "container" || m.Key != boltdbtest.Container || m.Path != "v1/default/containers/"+boltdbtest.Container {
+		t.Errorf("match = %+v", m)
+	}
+	s.Get("/api/bucket/" + bucketURL(m.Path))
+
+	s.Get("/api/containerd/search?label=containerd.io/gc.ref.content.config&namespace=moby").Decode(t, &matches)
+	if len(matches) != 1 || matches[0].Type != "content" || matches[0].Key != "sha256:manifest1" {
+		t.Errorf("key only matches = %+v, want sha256:manifest1 of moby", matches)
+	}
+
+	s.Get("/api/containerd/search?label=io.kubernetes.pod.name=foo&label=other").Decode(t, &matches)
+	if len(matches) != 0 {
+		t.Errorf("matches of two selectors = %+v, want none", matches)
+	}
+	if status, _ := s.Do(http.MethodGet, "/api/containerd/search", nil); status != http.StatusBadRequest {
+		t.Errorf("search without label = %d, want 400", status)
+	}
+}
+
+func TestBlob(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "blobs", "sha256"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "blobs", "sha256", "config1"), []byte("config"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONTENT_ROOT", root)
+
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var info BlobInfo
+	s.Get("/api/containerd/blob?digest=sha256:config1").Decode(t, &info)
+	if !info.Exists || info.Size != 6 || info.Path != filepath.Join(root, "blobs", "sha256", "config1") {
+		t.Errorf("blob = %+v, want the 6 byte file", info)
+	}
+	if len(info.Namespaces) != len(boltdbtest.Namespaces) || info.RecordedSize != 2000 || !info.SizeMismatch {
+		t.Errorf("records = %v of %d bytes (mismatch %v)", info.Namespaces, info.RecordedSize, info.SizeMismatch)
+	}
+
+	s.Get("/api/containerd/blob?digest=sha256:layer1").Decode(t, &info)
+	if info.Exists || len(info.Namespaces) == 0 {
+		t.Errorf("missing blob = %+v", info)
+	}
+
+	status, body := s.Do(http.MethodGet, "/api/containerd/blob?digest=sha256:config1&download=1", nil)
+	if status != http.StatusOK || string(body) != "config" {
+		t.Errorf("download = %d %q", status, body)
+	}
+	if status, _ := s.Do(http.MethodGet, "/api/containerd/blob?digest=sha256:../../etc", nil); status != http.StatusBadRequest {
+		t.Errorf("traversal = %d, want 400", status)
+	}
+}
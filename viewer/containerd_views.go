@@ -0,0 +1,781 @@
+// containerd_views.go - containerd objects joined across buckets
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Kubernetes labels set by the CRI plugin on containers
+const (
+	labelPodName       = "io.kubernetes.pod.name"
+	labelPodNamespace  = "io.kubernetes.pod.namespace"
+	labelContainerName = "io.kubernetes.container.name"
+)
+
+// ContainerView a container joined with its image, snapshot and leases
+type ContainerView struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+	// Name, Pod and PodNamespace from the CRI labels, empty otherwise
+	Name         string `json:"name,omitempty"`
+	Pod          string `json:"pod,omitempty"`
+	PodNamespace string `json:"podNamespace,omitempty"`
+
+	Image        string `json:"image"`
+	ImageDigest  string `json:"imageDigest,omitempty"`
+	ImageMissing bool   `json:"imageMissing,omitempty"`
+
+	Runtime         string `json:"runtime"`
+	Snapshotter     string `json:"snapshotter"`
+	SnapshotKey     string `json:"snapshotKey"`
+	SnapshotParent  string `json:"snapshotParent,omitempty"`
+	SnapshotMissing bool   `json:"snapshotMissing,omitempty"`
+
+	RuntimeOptions map[string]interface{} `json:"runtimeOptions,omitempty"`
+	// SandboxID the pod sandbox of CRI containers
+	SandboxID string `json:"sandboxId,omitempty"`
+
+	// Leases holding the container's snapshot or content of its image
+	Leases []string `json:"leases,omitempty"`
+
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// handleContainers returns one row per container, ?namespace= scoped
+func (c *Viewer) handleContainers(w http.ResponseWriter, r *http.Request) {
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+	offset, err := decodeOffsetCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	views, err := c.getContainerViews(ns)
+	if err != nil {
+		c.sendError(w, "Failed to read containers", err)
+		return
+	}
+	if offset > len(views) {
+		offset = len(views)
+	}
+	views = views[offset:]
+
+	budget := c.newResponseBudget()
+	for i, v := range views {
+		if !budget.take(v) {
+			c.sendPartial(w, views[:i], strconv.Itoa(offset+i))
+			return
+		}
+	}
+	c.sendSuccess(w, views)
+}
+
+// getContainerViews joins the containers of every namespace (or ns) with
+// the images, snapshots and leases of the same namespace, sorted by
+// namespace and id
+func (c *Viewer) getContainerViews(ns string) ([]ContainerView, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	views := []ContainerView{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if ns != "" {
+			if _, err := namespaceBucket(tx, ns); err != nil {
+				return err
+			}
+		}
+		return forEachNamespace(tx, func(name string, nsb *bolt.Bucket) error {
+			if ns != "" && name != ns {
+				return nil
+			}
+
+			images := map[string]ImageRecord{}
+			for _, img := range readImageRecords(name, nsb) {
+				images[img.Name] = img
+			}
+			blobs := readContentRecords(name, nsb)
+			leases := readLeaseHolders(nsb)
+
+			for _, ctr := range readContainerRecords(name, nsb) {
+				v := ContainerView{
+					Namespace:      name,
+					ID:             ctr.ID,
+					Name:           ctr.Labels[labelContainerName],
+					Pod:            ctr.Labels[labelPodName],
+					PodNamespace:   ctr.Labels[labelPodNamespace],
+					Image:          ctr.Image,
+					Runtime:        ctr.Runtime,
+					RuntimeOptions: ctr.RuntimeOptions,
+					SandboxID:      ctr.SandboxID,
+					Snapshotter:    ctr.Snapshotter,
+					SnapshotKey:    ctr.SnapshotKey,
+					CreatedAt:      ctr.CreatedAt,
+					UpdatedAt:      ctr.UpdatedAt,
+					Labels:         ctr.Labels,
+				}
+
+				held := map[string]bool{}
+				if img, ok := images[ctr.Image]; ok {
+					v.ImageDigest = img.Digest
+					for dgst := range contentClosure(blobs, img.Digest) {
+						for _, lease := range leases[gcNode{Type: gcResourceContent, Key: dgst}] {
+							held[lease] = true
+						}
+					}
+				} else if ctr.Image != "" {
+					v.ImageMissing = true
+				}
+
+				if ctr.SnapshotKey != "" {
+					if sb := snapshotBucket(nsb, ctr.Snapshotter, ctr.SnapshotKey); sb != nil {
+						v.SnapshotParent = string(sb.Get(bucketKeyParent))
+					} else {
+						v.SnapshotMissing = true
+					}
+					for _, lease := range leases[gcNode{Type: gcResourceSnapshot, Key: ctr.Snapshotter + "/" + ctr.SnapshotKey}] {
+						held[lease] = true
+					}
+				}
+
+				for lease := range held {
+					v.Leases = append(v.Leases, lease)
+				}
+				sort.Strings(v.Leases)
+				views = append(views, v)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(views, func(i, j int) bool {
+		if views[i].Namespace != views[j].Namespace {
+			return views[i].Namespace < views[j].Namespace
+		}
+		return views[i].ID < views[j].ID
+	})
+	return views, nil
+}
+
+// SandboxView a sandbox with the containers running in it
+type SandboxView struct {
+	SandboxRecord
+	// Containers the ids of the containers whose CRI metadata names the
+	// sandbox
+	Containers []string `json:"containers"`
+}
+
+// handleSandboxes returns one row per sandbox, ?namespace= scoped
+func (c *Viewer) handleSandboxes(w http.ResponseWriter, r *http.Request) {
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+	offset, err := decodeOffsetCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	views, err := c.getSandboxViews(ns)
+	if err != nil {
+		c.sendError(w, "Failed to read sandboxes", err)
+		return
+	}
+	if offset > len(views) {
+		offset = len(views)
+	}
+	views = views[offset:]
+
+	budget := c.newResponseBudget()
+	for i, v := range views {
+		if !budget.take(v) {
+			c.sendPartial(w, views[:i], strconv.Itoa(offset+i))
+			return
+		}
+	}
+	c.sendSuccess(w, views)
+}
+
+// getSandboxViews joins the sandboxes of every namespace (or ns) with the
+// containers of the same namespace, sorted by namespace and id
+func (c *Viewer) getSandboxViews(ns string) ([]SandboxView, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	views := []SandboxView{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if ns != "" {
+			if _, err := namespaceBucket(tx, ns); err != nil {
+				return err
+			}
+		}
+		return forEachNamespace(tx, func(name string, nsb *bolt.Bucket) error {
+			if ns != "" && name != ns {
+				return nil
+			}
+
+			sandboxes := readSandboxRecords(name, nsb)
+			if len(sandboxes) == 0 {
+				return nil
+			}
+			containers := map[string][]string{}
+			for _, ctr := range readContainerRecords(name, nsb) {
+				if ctr.SandboxID != "" {
+					containers[ctr.SandboxID] = append(containers[ctr.SandboxID], ctr.ID)
+				}
+			}
+			for _, sandbox := range sandboxes {
+				v := SandboxView{SandboxRecord: sandbox, Containers: containers[sandbox.ID]}
+				if v.Containers == nil {
+					v.Containers = []string{}
+				}
+				sort.Strings(v.Containers)
+				views = append(views, v)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(views, func(i, j int) bool {
+		if views[i].Namespace != views[j].Namespace {
+			return views[i].Namespace < views[j].Namespace
+		}
+		return views[i].ID < views[j].ID
+	})
+	return views, nil
+}
+
+// ImageView an image with its content resolved through gc.ref.content labels
+type ImageView struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	// TargetSize size of the target descriptor, Size the bytes of all blobs
+	// reachable from it that the namespace knows
+	TargetSize int64 `json:"targetSize"`
+	Size       int64 `json:"size"`
+	Blobs      int   `json:"blobs"`
+	// MissingBlobs referenced digests without a content record
+	MissingBlobs []string `json:"missingBlobs,omitempty"`
+	// Platforms os/architecture[/variant] read from the index or config
+	// blob in the content store, PlatformsError why they are unknown
+	Platforms      []string          `json:"platforms"`
+	PlatformsError string            `json:"platformsError,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+// handleImages returns one row per image, ?namespace= scoped
+func (c *Viewer) handleImages(w http.ResponseWriter, r *http.Request) {
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+	offset, err := decodeOffsetCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	views, err := c.getImageViews(ns, contentRoot())
+	if err != nil {
+		c.sendError(w, "Failed to read images", err)
+		return
+	}
+	if offset > len(views) {
+		offset = len(views)
+	}
+	views = views[offset:]
+
+	budget := c.newResponseBudget()
+	for i, v := range views {
+		if !budget.take(v) {
+			c.sendPartial(w, views[:i], strconv.Itoa(offset+i))
+			return
+		}
+	}
+	c.sendSuccess(w, views)
+}
+
+// getImageViews resolves the images of every namespace (or ns) against the
+// content records of the same namespace, platforms against the content
+// store at root; sorted by namespace and name
+func (c *Viewer) getImageViews(ns, root string) ([]ImageView, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	views := []ImageView{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if ns != "" {
+			if _, err := namespaceBucket(tx, ns); err != nil {
+				return err
+			}
+		}
+		return forEachNamespace(tx, func(name string, nsb *bolt.Bucket) error {
+			if ns != "" && name != ns {
+				return nil
+			}
+
+			blobs := readContentRecords(name, nsb)
+			for _, img := range readImageRecords(name, nsb) {
+				v := ImageView{
+					Namespace:  name,
+					Name:       img.Name,
+					Digest:     img.Digest,
+					MediaType:  img.MediaType,
+					TargetSize: img.Size,
+					Platforms:  []string{},
+					CreatedAt:  img.CreatedAt,
+					UpdatedAt:  img.UpdatedAt,
+					Labels:     img.Labels,
+				}
+
+				closure := contentClosure(blobs, img.Digest)
+				missing := map[string]bool{}
+				if _, ok := closure[img.Digest]; !ok && img.Digest != "" {
+					missing[img.Digest] = true
+				}
+				for dgst, size := range closure {
+					v.Size += size
+					for _, ref := range contentRefs(blobs[dgst].Labels) {
+						if _, ok := blobs[ref]; !ok {
+							missing[ref] = true
+						}
+					}
+				}
+				v.Blobs = len(closure)
+				for dgst := range missing {
+					v.MissingBlobs = append(v.MissingBlobs, dgst)
+				}
+				sort.Strings(v.MissingBlobs)
+
+				platforms, err := imagePlatforms(root, img.Digest)
+				if err != nil {
+					v.PlatformsError = err.Error()
+				} else {
+					v.Platforms = platforms
+				}
+				views = append(views, v)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(views, func(i, j int) bool {
+		if views[i].Namespace != views[j].Namespace {
+			return views[i].Namespace < views[j].Namespace
+		}
+		return views[i].Name < views[j].Name
+	})
+	return views, nil
+}
+
+// ociPlatform platform of an index entry or image config
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p ociPlatform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// imagePlatforms reads the platforms of an image target: the manifests of
+// an index (attestations for unknown/unknown skipped) or the config of a
+// single manifest
+func imagePlatforms(root, dgst string) ([]string, error) {
+	data, err := readBlob(root, dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Manifests []struct {
+			Platform *ociPlatform `json:"platform"`
+		} `json:"manifests"`
+		Config *struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", dgst, err)
+	}
+
+	platforms := []string{}
+	switch {
+	case doc.Manifests != nil:
+		seen := map[string]bool{}
+		for _, m := range doc.Manifests {
+			if m.Platform == nil || m.Platform.OS == "unknown" {
+				continue
+			}
+			if p := m.Platform.String(); !seen[p] {
+				seen[p] = true
+				platforms = append(platforms, p)
+			}
+		}
+	case doc.Config != nil:
+		config, err := readBlob(root, doc.Config.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var p ociPlatform
+		if err := json.Unmarshal(config, &p); err != nil {
+			return nil, fmt.Errorf("%s: %v", doc.Config.Digest, err)
+		}
+		platforms = append(platforms, p.String())
+	default:
+		return nil, fmt.Errorf("%s is neither an index nor a manifest", dgst)
+	}
+	return platforms, nil
+}
+
+// SnapshotLink one snapshot of a parent chain; ID, Kind, Size and Inodes
+// come from the snapshotter's metadata.db
+type SnapshotLink struct {
+	Key        string            `json:"key"`
+	BackendKey string            `json:"backendKey"`
+	Parent     string            `json:"parent,omitempty"`
+	Children   int               `json:"children"`
+	ID         uint64            `json:"id,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Size       int64             `json:"size"`
+	Inodes     int64             `json:"inodes"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// Missing the parent named by the previous link has no record
+	Missing bool `json:"missing,omitempty"`
+}
+
+// SnapshotChain a snapshot and its ancestors, the snapshot first and the
+// base layer last
+type SnapshotChain struct {
+	Namespace   string `json:"namespace"`
+	Snapshotter string `json:"snapshotter"`
+	Key         string `json:"key"`
+	// Backend the snapshotter metadata.db joined, BackendError why not
+	Backend      string         `json:"backend,omitempty"`
+	BackendError string         `json:"backendError,omitempty"`
+	Depth        int            `json:"depth"`
+	TotalSize    int64          `json:"totalSize"`
+	Chain        []SnapshotLink `json:"chain"`
+}
+
+// handleSnapshotChain walks the parents of ?key= in ?namespace=
+func (c *Viewer) handleSnapshotChain(w http.ResponseWriter, r *http.Request) {
+	ns, err := parseNamespace(r)
+	if err != nil || ns == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "A valid namespace is required", err)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Snapshot key cannot be empty", nil)
+		return
+	}
+	snapshotter := r.URL.Query().Get("snapshotter")
+	if snapshotter == "" {
+		snapshotter = "overlayfs"
+	}
+
+	backend := ""
+	if r.URL.Query().Get("backend") == "1" {
+		backend = filepath.Join(snapshotterRoot(), "metadata.db")
+	}
+
+	chain, err := c.getSnapshotChain(ns, snapshotter, key, backend)
+	if err != nil {
+		c.sendError(w, "Failed to resolve snapshot chain", err)
+		return
+	}
+	c.sendSuccess(w, chain)
+}
+
+// getSnapshotChain follows the parent keys of a snapshot in the metadata
+// snapshots bucket, joining each link with the snapshotter's metadata.db at
+// backend unless it is empty; the walk stops at a missing parent or a cycle
+func (c *Viewer) getSnapshotChain(ns, snapshotter, key, backend string) (*SnapshotChain, error) {
+	var entries map[string]snapshotterEntry
+	report := &SnapshotChain{
+		Namespace:   ns,
+		Snapshotter: snapshotter,
+		Key:         key,
+		Chain:       []SnapshotLink{},
+	}
+	if backend != "" {
+		var err error
+		if entries, err = readSnapshotterEntries(backend, c.boltOptions); err != nil {
+			report.BackendError = err.Error()
+		} else {
+			report.Backend = backend
+		}
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		nsb, err := namespaceBucket(tx, ns)
+		if err != nil {
+			return err
+		}
+		if snapshotBucket(nsb, snapshotter, key) == nil {
+			return fmt.Errorf("snapshot not found: %s/%s", snapshotter, key)
+		}
+
+		seen := map[string]bool{}
+		for next := key; next != "" && !seen[next]; {
+			seen[next] = true
+			link := SnapshotLink{Key: next}
+			sb := snapshotBucket(nsb, snapshotter, next)
+			if sb == nil {
+				link.Missing = true
+				report.Chain = append(report.Chain, link)
+				break
+			}
+
+			link.BackendKey = string(sb.Get(bucketKeyName))
+			link.Parent = string(sb.Get(bucketKeyParent))
+			link.Children = countKeys(sb.Bucket(bucketKeyChildren))
+			link.CreatedAt = readTime(sb, bucketKeyCreatedAt)
+			link.UpdatedAt = readTime(sb, bucketKeyUpdatedAt)
+			link.Labels = readLabels(sb)
+			if entry, ok := entries[link.BackendKey]; ok {
+				link.ID, link.Kind, link.Size, link.Inodes = entry.id, entry.kind, entry.size, entry.inodes
+			}
+			report.TotalSize += link.Size
+			report.Chain = append(report.Chain, link)
+			next = link.Parent
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Depth = len(report.Chain)
+	return report, nil
+}
+
+// countKeys counts the keys of b, 0 if b is nil
+func countKeys(b *bolt.Bucket) int {
+	if b == nil {
+		return 0
+	}
+	n := 0
+	b.ForEach(func(k, v []byte) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// LeaseView a lease and the resources it protects from garbage collection
+type LeaseView struct {
+	Namespace string            `json:"namespace"`
+	ID        string            `json:"id"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Expired leases (gc.expire in the past) no longer protect anything
+	Expired   bool     `json:"expired"`
+	Content   []string `json:"content"`
+	Snapshots []string `json:"snapshots"` // snapshotter/key
+	Ingests   []string `json:"ingests"`
+	// Via the leased resource that reaches ?digest= through gc.ref labels
+	// or snapshot parents, empty when the lease holds the digest itself
+	Via string `json:"via,omitempty"`
+}
+
+// handleLeases lists the leases with what they hold, with ?digest= only
+// those keeping that blob alive
+func (c *Viewer) handleLeases(w http.ResponseWriter, r *http.Request) {
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+	dgst := r.URL.Query().Get("digest")
+	if dgst != "" && !digestPattern.MatchString(dgst) {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid digest", fmt.Errorf("invalid digest %q", dgst))
+		return
+	}
+
+	leases, err := c.getLeaseViews(ns, dgst, time.Now())
+	if err != nil {
+		c.sendError(w, "Failed to read leases", err)
+		return
+	}
+	c.sendSuccess(w, leases)
+}
+
+// getLeaseViews reads the leases of every namespace (or ns), sorted by
+// namespace and id; a non-empty dgst keeps the leases holding that content
+// directly or through the references of a resource they hold
+func (c *Viewer) getLeaseViews(ns, dgst string, now time.Time) ([]LeaseView, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	leases := []LeaseView{}
+	target := gcNode{Type: gcResourceContent, Key: dgst}
+	err = db.View(func(tx *bolt.Tx) error {
+		if ns != "" {
+			if _, err := namespaceBucket(tx, ns); err != nil {
+				return err
+			}
+		}
+		return forEachNamespace(tx, func(name string, nsb *bolt.Bucket) error {
+			if ns != "" && name != ns {
+				return nil
+			}
+			lb := nsb.Bucket(bucketKeyObjectLeases)
+			if lb == nil {
+				return nil
+			}
+			var graph *gcGraph
+			if dgst != "" {
+				graph = buildGCGraph(name, nsb, now)
+			}
+
+			return lb.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				b := lb.Bucket(k)
+				lease := LeaseView{
+					Namespace: name,
+					ID:        string(k),
+					CreatedAt: readTime(b, bucketKeyCreatedAt),
+					Labels:    readLabels(b),
+					Content:   []string{},
+					Snapshots: []string{},
+					Ingests:   []string{},
+				}
+				lease.Expired = leaseExpired(lease.Labels, now)
+
+				held := leaseResources(b)
+				for _, n := range held {
+					switch n.Type {
+					case gcResourceContent:
+						lease.Content = append(lease.Content, n.Key)
+					case gcResourceSnapshot:
+						lease.Snapshots = append(lease.Snapshots, n.Key)
+					case gcResourceIngest:
+						lease.Ingests = append(lease.Ingests, n.Key)
+					}
+				}
+
+				if graph != nil {
+					via, ok := graph.reaches(held, target)
+					if !ok {
+						return nil
+					}
+					if via != target {
+						lease.Via = via.Type + " " + via.Key
+					}
+				}
+				leases = append(leases, lease)
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+// reaches reports whether target is one of from or referenced by them,
+// returning the node of from it was reached through
+func (g *gcGraph) reaches(from []gcNode, target gcNode) (gcNode, bool) {
+	for _, start := range from {
+		seen := map[gcNode]bool{}
+		queue := []gcNode{start}
+		for len(queue) > 0 {
+			n := queue[0]
+			queue = queue[1:]
+			if n == target {
+				return start, true
+			}
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			queue = append(queue, g.Refs[n]...)
+		}
+	}
+	return gcNode{}, false
+}
+
+// snapshotBucket returns the metadata bucket of a snapshot, nil if missing
+func snapshotBucket(nsb *bolt.Bucket, snapshotter, key string) *bolt.Bucket {
+	sb := nsb.Bucket(bucketKeyObjectSnapshots)
+	if sb == nil {
+		return nil
+	}
+	ssb := sb.Bucket([]byte(snapshotter))
+	if ssb == nil {
+		return nil
+	}
+	return ssb.Bucket([]byte(key))
+}
+
+// readLeaseHolders maps the resources of a namespace to the leases holding
+// them, expired leases included
+func readLeaseHolders(nsb *bolt.Bucket) map[gcNode][]string {
+	holders := map[gcNode][]string{}
+	lb := nsb.Bucket(bucketKeyObjectLeases)
+	if lb == nil {
+		return holders
+	}
+	lb.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		for _, n := range leaseResources(lb.Bucket(k)) {
+			holders[n] = append(holders[n], string(k))
+		}
+		return nil
+	})
+	return holders
+}
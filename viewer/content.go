@@ -0,0 +1,154 @@
+// content.go - containerd content store blobs on disk
+package viewer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultContentRoot default content store directory
+var defaultContentRoot = filepath.Join(defaultContainerdRoot, "io.containerd.content.v1.content")
+
+// maxManifestBytes largest index, manifest or config blob decoded
+const maxManifestBytes = 4 * 1024 * 1024
+
+// digestPattern an OCI digest, algorithm:encoded
+var digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+// contentRoot returns the content store root from CONTENT_ROOT or the default
+func contentRoot() string {
+	if root := os.Getenv("CONTENT_ROOT"); root != "" {
+		return root
+	}
+	return defaultContentRoot
+}
+
+// blobPath returns the file of a digest in a content store,
+// <root>/blobs/<algorithm>/<encoded>
+func blobPath(root, dgst string) (string, error) {
+	if !digestPattern.MatchString(dgst) {
+		return "", fmt.Errorf("invalid digest %q", dgst)
+	}
+	algorithm, encoded, _ := strings.Cut(dgst, ":")
+	return filepath.Join(root, "blobs", algorithm, encoded), nil
+}
+
+// readBlob reads a small blob of the content store
+func readBlob(root, dgst string) ([]byte, error) {
+	path, err := blobPath(root, dgst)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxManifestBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestBytes {
+		return nil, fmt.Errorf("blob %s is larger than %d bytes", dgst, maxManifestBytes)
+	}
+	return data, nil
+}
+
+// BlobInfo a digest resolved to its file in the content store and to the
+// namespaces recording it
+type BlobInfo struct {
+	Digest  string    `json:"digest"`
+	Path    string    `json:"path"`
+	Exists  bool      `json:"exists"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime,omitempty"`
+	// Namespaces with a content record of the digest and the size recorded
+	RecordedSize int64    `json:"recordedSize,omitempty"`
+	Namespaces   []string `json:"namespaces"`
+	// SizeMismatch the file and the records disagree, e.g. a partial write
+	SizeMismatch bool `json:"sizeMismatch,omitempty"`
+}
+
+// handleBlob resolves ?digest= to its blob file, with ?download=1 the file
+// itself is sent (ranges supported)
+func (c *Viewer) handleBlob(w http.ResponseWriter, r *http.Request) {
+	dgst := r.URL.Query().Get("digest")
+	path, err := blobPath(contentRoot(), dgst)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid digest", err)
+		return
+	}
+
+	if r.URL.Query().Get("download") == "1" {
+		f, err := os.Open(path)
+		if err != nil {
+			c.sendErrorCode(w, http.StatusNotFound, "Blob not found", err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			c.sendError(w, "Failed to read blob", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.ReplaceAll(dgst, ":", "-")))
+		http.ServeContent(w, r, "", info.ModTime(), f)
+		return
+	}
+
+	info, err := c.getBlobInfo(dgst, path)
+	if err != nil {
+		c.sendError(w, "Failed to resolve blob", err)
+		return
+	}
+	c.sendSuccess(w, info)
+}
+
+// getBlobInfo stats the file of dgst at path and looks the digest up in the
+// content buckets of the namespaces
+func (c *Viewer) getBlobInfo(dgst, path string) (*BlobInfo, error) {
+	info := &BlobInfo{Digest: dgst, Path: path, Namespaces: []string{}}
+	if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+		info.Exists, info.Size, info.ModTime = true, fi.Size(), fi.ModTime()
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketKeyVersion) == nil {
+			return nil // not a containerd database, only the file is resolved
+		}
+		return forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+			cb := nsb.Bucket(bucketKeyObjectContent)
+			if cb == nil {
+				return nil
+			}
+			bb := cb.Bucket(bucketKeyObjectBlob)
+			if bb == nil {
+				return nil
+			}
+			if b := bb.Bucket([]byte(dgst)); b != nil {
+				info.Namespaces = append(info.Namespaces, ns)
+				info.RecordedSize = readVarint(b, bucketKeySize)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.SizeMismatch = info.Exists && len(info.Namespaces) > 0 && info.Size != info.RecordedSize
+	return info, nil
+}
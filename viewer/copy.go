@@ -0,0 +1,299 @@
+// copy.go - copying keys and bucket subtrees, also out of uploaded backups,
+// and renaming buckets
+package viewer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CopyRequest the body of /api/copy: a key, or the bucket FromBucket when
+// FromKey is empty, copied to ToBucket
+type CopyRequest struct {
+	// Source the id of an uploaded database to copy from, empty for the
+	// served database
+	Source     string `json:"source,omitempty"`
+	FromBucket string `json:"fromBucket"`
+	FromKey    string `json:"fromKey,omitempty"`
+	// ToBucket the bucket receiving the key, created if missing, or the
+	// path of the copied bucket
+	ToBucket string `json:"toBucket"`
+	// ToKey the name of the copied key, FromKey if empty
+	ToKey string `json:"toKey,omitempty"`
+	// Overwrite replaces an existing key or bucket at the destination
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+// CopyResult what a copy wrote
+type CopyResult struct {
+	Source  string `json:"source,omitempty"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Keys    int    `json:"keys"`
+	Buckets int    `json:"buckets"`
+}
+
+// handleCopy copies a key or bucket subtree within one write transaction
+func (c *Viewer) handleCopy(w http.ResponseWriter, r *http.Request) {
+	var req CopyRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid copy request", err)
+		return
+	}
+	req.FromBucket = strings.Trim(req.FromBucket, "/")
+	req.ToBucket = strings.Trim(req.ToBucket, "/")
+	if req.FromBucket == "" || req.ToBucket == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid copy request", errors.New("fromBucket and toBucket are required"))
+		return
+	}
+	// Copies within the database must not write into the copied bucket or
+	// replace a bucket holding it
+	if req.FromKey == "" && req.Source == "" &&
+		(isBucketWithin(req.ToBucket, req.FromBucket) || isBucketWithin(req.FromBucket, req.ToBucket)) {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid copy request", errors.New("source and destination buckets overlap"))
+		return
+	}
+
+	result, err := c.copyEntry(req)
+	if err != nil {
+		c.sendError(w, "Failed to copy", err)
+		return
+	}
+	slog.Info("Copied bucket", "from", result.From, "to", result.To, "keys", result.Keys, "buckets", result.Buckets)
+	c.sendSuccess(w, result)
+}
+
+// copyEntry runs a copy, reading an uploaded source in a read transaction
+// around the write transaction of the served database
+func (c *Viewer) copyEntry(req CopyRequest) (*CopyResult, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	if req.Source == "" {
+		var result *CopyResult
+		err := db.Update(func(tx *bolt.Tx) error {
+			result, err = c.copyInTx(tx, tx, req)
+			return err
+		})
+		return result, err
+	}
+
+	upload, ok := c.uploads.get(req.Source)
+	if !ok {
+		return nil, fmt.Errorf("no uploaded database %s", req.Source)
+	}
+	srcDB, err := upload.viewer.openDB()
+	if err != nil {
+		return nil, err
+	}
+	var result *CopyResult
+	err = srcDB.View(func(src *bolt.Tx) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			result, err = c.copyInTx(tx, src, req)
+			return err
+		})
+	})
+	return result, err
+}
+
+// copyInTx copies from src, which may be tx itself, into tx
+func (c *Viewer) copyInTx(tx, src *bolt.Tx, req CopyRequest) (*CopyResult, error) {
+	from := c.findBucket(src, req.FromBucket)
+	if from == nil {
+		return nil, fmt.Errorf("bucket not found: %s", req.FromBucket)
+	}
+	result := &CopyResult{Source: req.Source, From: req.FromBucket, To: req.ToBucket}
+
+	if req.FromKey != "" {
+		value := from.Get([]byte(req.FromKey))
+		if value == nil {
+			return nil, fmt.Errorf("key not found: %s/%s", req.FromBucket, req.FromKey)
+		}
+		to, err := createBucketPath(tx, req.ToBucket)
+		if err != nil {
+			return nil, err
+		}
+		key := req.ToKey
+		if key == "" {
+			key = req.FromKey
+		}
+		if to.Bucket([]byte(key)) != nil {
+			return nil, fmt.Errorf("%s/%s is a bucket", req.ToBucket, key)
+		}
+		if to.Get([]byte(key)) != nil && !req.Overwrite {
+			return nil, fmt.Errorf("key exists: %s/%s", req.ToBucket, key)
+		}
+		result.From += "/" + req.FromKey
+		result.To += "/" + key
+		result.Keys = 1
+		// Values of the same transaction must not be modified while put
+		return result, to.Put([]byte(key), append([]byte(nil), value...))
+	}
+
+	parentPath, name := splitBucketPath(req.ToBucket)
+	var parent bucketParent = tx
+	if parentPath != "" {
+		b, err := createBucketPath(tx, parentPath)
+		if err != nil {
+			return nil, err
+		}
+		if b.Get([]byte(name)) != nil {
+			return nil, fmt.Errorf("%s is a key", req.ToBucket)
+		}
+		parent = b
+	}
+	if parent.Bucket([]byte(name)) != nil {
+		if !req.Overwrite {
+			return nil, fmt.Errorf("bucket exists: %s", req.ToBucket)
+		}
+		if err := parent.DeleteBucket([]byte(name)); err != nil {
+			return nil, err
+		}
+	}
+	to, err := parent.CreateBucket([]byte(name))
+	if err != nil {
+		return nil, err
+	}
+	result.Keys, result.Buckets, err = copyBucket(to, from)
+	return result, err
+}
+
+// RenameRequest the body of /api/rename
+type RenameRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// handleRename moves a bucket to a new path; bolt has no rename, the
+// subtree is copied and the original deleted in one write transaction
+func (c *Viewer) handleRename(w http.ResponseWriter, r *http.Request) {
+	var req RenameRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid rename request", err)
+		return
+	}
+	req.From = strings.Trim(req.From, "/")
+	req.To = strings.Trim(req.To, "/")
+	if req.From == "" || req.To == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid rename request", errors.New("from and to are required"))
+		return
+	}
+	if isBucketWithin(req.To, req.From) || isBucketWithin(req.From, req.To) {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid rename request", errors.New("a bucket can not move into itself or its parents"))
+		return
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		c.sendError(w, "Failed to open database", err)
+		return
+	}
+	var result *CopyResult
+	err = db.Update(func(tx *bolt.Tx) error {
+		result, err = c.renameBucket(tx, req.From, req.To)
+		return err
+	})
+	if err != nil {
+		c.sendError(w, "Failed to rename bucket", err)
+		return
+	}
+	slog.Info("Renamed bucket", "from", req.From, "to", req.To, "keys", result.Keys, "buckets", result.Buckets)
+	c.sendSuccess(w, result)
+}
+
+// renameBucket copies the bucket at from to the new path to, which must
+// not exist, and deletes it
+func (c *Viewer) renameBucket(tx *bolt.Tx, from, to string) (*CopyResult, error) {
+	// The exact path, findBucket would also match names containing "/"
+	fromParentPath, fromName := splitBucketPath(from)
+	var fromParent bucketParent = tx
+	if fromParentPath != "" {
+		b := c.findBucket(tx, fromParentPath)
+		if b == nil {
+			return nil, fmt.Errorf("bucket not found: %s", from)
+		}
+		fromParent = b
+	}
+	if fromParent.Bucket([]byte(fromName)) == nil {
+		return nil, fmt.Errorf("bucket not found: %s", from)
+	}
+
+	result, err := c.copyInTx(tx, tx, CopyRequest{FromBucket: from, ToBucket: to})
+	if err != nil {
+		return nil, err
+	}
+	return result, fromParent.DeleteBucket([]byte(fromName))
+}
+
+// bucketParent the child bucket methods of bolt.Tx and bolt.Bucket
+type bucketParent interface {
+	Bucket(name []byte) *bolt.Bucket
+	CreateBucket(name []byte) (*bolt.Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+// copyBucket copies the keys, nested buckets and sequence of src into dst,
+// returning the keys and buckets written
+func copyBucket(dst, src *bolt.Bucket) (keys, buckets int, err error) {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return 0, 0, err
+	}
+	err = src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			keys++
+			return dst.Put(append([]byte(nil), k...), append([]byte(nil), v...))
+		}
+		sub, err := dst.CreateBucket(append([]byte(nil), k...))
+		if err != nil {
+			return err
+		}
+		buckets++
+		n, m, err := copyBucket(sub, src.Bucket(k))
+		keys += n
+		buckets += m
+		return err
+	})
+	return keys, buckets, err
+}
+
+// createBucketPath returns the bucket at path, creating missing buckets on
+// the way; nil for the empty path, the root
+func createBucketPath(tx *bolt.Tx, path string) (*bolt.Bucket, error) {
+	var b *bolt.Bucket
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		var err error
+		if b == nil {
+			b, err = tx.CreateBucketIfNotExists([]byte(name))
+		} else {
+			b, err = b.CreateBucketIfNotExists([]byte(name))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bucket %s: %v", name, err)
+		}
+	}
+	return b, nil
+}
+
+// splitBucketPath splits a bucket path into its parent's path and its name
+func splitBucketPath(path string) (string, string) {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return "", path
+}
+
+// isBucketWithin reports whether path is bucket or below it
+func isBucketWithin(path, bucket string) bool {
+	return path == bucket || strings.HasPrefix(path, bucket+"/")
+}
@@ -0,0 +1,98 @@
+package viewer
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestCopy(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+
+	var result CopyResult
+	resp := s.API(http.MethodPost, "/api/copy", `{"fromBucket":"misc","fromKey":"text","toBucket":"restored/misc","toKey":"greeting"}`)
+	if !resp.Success {
+		t.Fatalf("key copy failed: %s %s", resp.Error, resp.Message)
+	}
+	resp.Decode(t, &result)
+	if result.To != "restored/misc/greeting" || result.Keys != 1 {
+		t.Errorf("key copy = %+v", result)
+	}
+	var kv KeyValuePair
+	s.Get("/api/key/restored%2Fmisc/greeting").Decode(t, &kv)
+	if kv.Value != "hello" {
+		t.Errorf("copied value = %v, want hello", kv.Value)
+	}
+	if resp := s.API(http.MethodPost, "/api/copy", `{"fromBucket":"misc","fromKey":"text","toBucket":"restored/misc","toKey":"greeting"}`); resp.Success {
+		t.Error("copy over an existing key without overwrite succeeded")
+	}
+
+	resp = s.API(http.MethodPost, "/api/copy", `{"fromBucket":"misc","toBucket":"backup/misc"}`)
+	if !resp.Success {
+		t.Fatalf("bucket copy failed: %s %s", resp.Error, resp.Message)
+	}
+	resp.Decode(t, &result)
+	if result.Keys != 4 || result.Buckets != 1 {
+		t.Errorf("bucket copy = %+v, want 4 keys and 1 bucket", result)
+	}
+	s.Get("/api/key/backup%2Fmisc%2Fnested/key").Decode(t, &kv)
+	if kv.Value != "value" {
+		t.Errorf("copied nested value = %v, want value", kv.Value)
+	}
+
+	if resp := s.API(http.MethodPost, "/api/copy", `{"fromBucket":"misc","toBucket":"misc/nested/copy"}`); resp.Status != http.StatusBadRequest {
+		t.Errorf("copy into itself: status %d, want 400", resp.Status)
+	}
+}
+
+func TestCopyFromUpload(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+	data, err := os.ReadFile(boltdbtest.Containerd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info DatabaseInfo
+	upload(t, s, "backup.db", data).Decode(t, &info)
+
+	resp := s.API(http.MethodPost, "/api/copy", `{"source":"`+info.ID+`","fromBucket":"v1/default/images","toBucket":"v1/default/images"}`)
+	if !resp.Success {
+		t.Fatalf("copy from upload failed: %s %s", resp.Error, resp.Message)
+	}
+	var images []ImageView
+	s.Get("/api/containerd/images?namespace=default").Decode(t, &images)
+	if len(images) != 1 || images[0].Name != boltdbtest.Image {
+		t.Errorf("restored images = %+v", images)
+	}
+}
+
+func TestRename(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+
+	resp := s.API(http.MethodPost, "/api/rename", `{"from":"misc/nested","to":"archive/nested"}`)
+	if !resp.Success {
+		t.Fatalf("rename failed: %s %s", resp.Error, resp.Message)
+	}
+	var kv KeyValuePair
+	s.Get("/api/key/archive%2Fnested/key").Decode(t, &kv)
+	if kv.Value != "value" {
+		t.Errorf("moved value = %v, want value", kv.Value)
+	}
+	if resp := s.API(http.MethodGet, "/api/bucket/misc%2Fnested", ""); resp.Success {
+		t.Error("renamed bucket still readable at its old path")
+	}
+
+	if resp := s.API(http.MethodPost, "/api/rename", `{"from":"misc","to":"archive"}`); resp.Success {
+		t.Error("rename over an existing bucket succeeded")
+	}
+	if resp := s.API(http.MethodPost, "/api/rename", `{"from":"misc","to":"misc/inner"}`); resp.Status != http.StatusBadRequest {
+		t.Errorf("rename into itself: status %d, want 400", resp.Status)
+	}
+}
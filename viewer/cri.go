@@ -0,0 +1,161 @@
+// cri.go - CRI plugin metadata stored in container extensions
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// CRI extension type URLs end in these suffixes, the package path before
+// them changed between containerd releases (containerd/cri, containerd/v2)
+const (
+	criContainerTypeSuffix = "/store/container/Metadata"
+	criSandboxTypeSuffix   = "/store/sandbox/Metadata"
+)
+
+// CRIMetadata the CRI plugin's metadata of a container or pod sandbox
+type CRIMetadata struct {
+	// Kind is container or sandbox, Version the versioned metadata format
+	Kind    string `json:"kind"`
+	Version string `json:"version"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+
+	PodName      string `json:"podName,omitempty"`
+	PodNamespace string `json:"podNamespace,omitempty"`
+	PodUID       string `json:"podUid,omitempty"`
+	// ContainerName the name in the pod spec, empty for sandboxes
+	ContainerName string `json:"containerName,omitempty"`
+	Attempt       uint32 `json:"attempt"`
+
+	SandboxID      string   `json:"sandboxId,omitempty"`
+	Image          string   `json:"image,omitempty"`
+	ImageRef       string   `json:"imageRef,omitempty"`
+	LogPath        string   `json:"logPath,omitempty"`
+	NetNSPath      string   `json:"netnsPath,omitempty"`
+	IP             string   `json:"ip,omitempty"`
+	AdditionalIPs  []string `json:"additionalIps,omitempty"`
+	RuntimeHandler string   `json:"runtimeHandler,omitempty"`
+
+	// Config the CRI ContainerConfig or PodSandboxConfig as stored
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// criVersionedMetadata the envelope of both metadata kinds; fields are
+// untagged in the CRI plugin, the config is a CRI API message
+type criVersionedMetadata struct {
+	Version  string
+	Metadata struct {
+		ID             string
+		Name           string
+		SandboxID      string
+		ImageRef       string
+		LogPath        string
+		NetNSPath      string
+		IP             string
+		AdditionalIPs  []string
+		RuntimeHandler string
+		Config         json.RawMessage
+	}
+}
+
+// criConfig the fields of ContainerConfig and PodSandboxConfig surfaced
+type criConfig struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		UID       string `json:"uid"`
+		Namespace string `json:"namespace"`
+		Attempt   uint32 `json:"attempt"`
+	} `json:"metadata"`
+	Image struct {
+		Image string `json:"image"`
+	} `json:"image"`
+	Labels map[string]string `json:"labels"`
+}
+
+// criMetadataKind returns container or sandbox for a CRI extension type URL,
+// empty for other types
+func criMetadataKind(typeURL string) string {
+	switch {
+	case strings.HasSuffix(typeURL, criContainerTypeSuffix):
+		return "container"
+	case strings.HasSuffix(typeURL, criSandboxTypeSuffix):
+		return "sandbox"
+	}
+	return ""
+}
+
+// decodeCRIMetadata decodes the JSON value of a CRI metadata extension
+func decodeCRIMetadata(kind string, value []byte) (*CRIMetadata, error) {
+	var v criVersionedMetadata
+	if err := json.Unmarshal(value, &v); err != nil {
+		return nil, err
+	}
+	if v.Version == "" {
+		return nil, fmt.Errorf("no metadata version")
+	}
+
+	m := v.Metadata
+	md := &CRIMetadata{
+		Kind:           kind,
+		Version:        v.Version,
+		ID:             m.ID,
+		Name:           m.Name,
+		SandboxID:      m.SandboxID,
+		ImageRef:       m.ImageRef,
+		LogPath:        m.LogPath,
+		NetNSPath:      m.NetNSPath,
+		IP:             m.IP,
+		AdditionalIPs:  m.AdditionalIPs,
+		RuntimeHandler: m.RuntimeHandler,
+		Config:         m.Config,
+	}
+
+	var config criConfig
+	if len(m.Config) > 0 {
+		if err := json.Unmarshal(m.Config, &config); err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+	}
+	md.Attempt = config.Metadata.Attempt
+	if kind == "sandbox" {
+		md.PodName = config.Metadata.Name
+		md.PodNamespace = config.Metadata.Namespace
+		md.PodUID = config.Metadata.UID
+	} else {
+		// kubelet labels containers with their pod
+		md.ContainerName = config.Metadata.Name
+		md.PodName = config.Labels[labelPodName]
+		md.PodNamespace = config.Labels[labelPodNamespace]
+		md.PodUID = config.Labels["io.kubernetes.pod.uid"]
+		md.Image = config.Image.Image
+	}
+	return md, nil
+}
+
+// readCRIMetadata decodes the CRI metadata extension of a container or
+// sandbox record, nil if it has none. Extensions are matched by type URL,
+// the sandbox store names the extension "metadata".
+func readCRIMetadata(b *bolt.Bucket) *CRIMetadata {
+	eb := b.Bucket(bucketKeyExtensions)
+	if eb == nil {
+		return nil
+	}
+	var md *CRIMetadata
+	eb.ForEach(func(k, v []byte) error {
+		var any anypb.Any
+		if md != nil || v == nil || proto.Unmarshal(v, &any) != nil {
+			return nil
+		}
+		if kind := criMetadataKind(any.GetTypeUrl()); kind != "" {
+			md, _ = decodeCRIMetadata(kind, any.GetValue())
+		}
+		return nil
+	})
+	return md
+}
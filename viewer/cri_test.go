@@ -0,0 +1,126 @@
+package viewer
+
+import (
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestDecodeCRIMetadata(t *testing.T) {
+	container := `{"Version":"v1","Metadata":{"ID":"ctr1","Name":"app_foo_default_uid1_2","SandboxID":"sb1",
+		"Config":{"metadata":{"name":"app","attempt":2},"image":{"image":"sha256:abc"},
+		"labels":{"io.kubernetes.pod.name":"foo","io.kubernetes.pod.namespace":"default","io.kubernetes.pod.uid":"uid1"}},
+		"ImageRef":"sha256:abc","LogPath":"/var/log/pods/default_foo_uid1/app/2.log"}}`
+	sandbox := `{"Version":"v1","Metadata":{"ID":"sb1","Name":"foo_default_uid1_0",
+		"Config":{"metadata":{"name":"foo","uid":"uid1","namespace":"default"}},
+		"NetNSPath":"/var/run/netns/cni-1","IP":"10.0.0.5","RuntimeHandler":"runc"}}`
+
+	put := func(b *bolt.Bucket, key, typeURL, value string) error {
+		data, err := proto.Marshal(&anypb.Any{TypeUrl: typeURL, Value: []byte(value)})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("extensions"))
+		if err != nil {
+			return err
+		}
+		if err := put(b, "io.cri-containerd.container.metadata", "github.com/containerd/cri/pkg/store/container/Metadata", container); err != nil {
+			return err
+		}
+		return put(b, "io.cri-containerd.sandbox.metadata", "github.com/containerd/containerd/v2/internal/cri/store/sandbox/Metadata", sandbox)
+	})
+	s := newTestServer(t, path)
+
+	var decoded struct {
+		CRI *CRIMetadata `json:"cri"`
+	}
+	s.Get("/api/decode/protobuf/extensions/io.cri-containerd.container.metadata").Decode(t, &decoded)
+	md := decoded.CRI
+	if md == nil || md.Kind != "container" || md.ContainerName != "app" || md.Attempt != 2 {
+		t.Fatalf("container metadata = %+v", md)
+	}
+	if md.PodName != "foo" || md.PodNamespace != "default" || md.PodUID != "uid1" || md.SandboxID != "sb1" || md.Image != "sha256:abc" {
+		t.Errorf("container metadata = %+v", md)
+	}
+
+	s.Get("/api/decode/protobuf/extensions/io.cri-containerd.sandbox.metadata").Decode(t, &decoded)
+	md = decoded.CRI
+	if md == nil || md.Kind != "sandbox" || md.PodName != "foo" || md.PodUID != "uid1" || md.IP != "10.0.0.5" || md.RuntimeHandler != "runc" {
+		t.Errorf("sandbox metadata = %+v", md)
+	}
+}
+
+func TestSandboxViews(t *testing.T) {
+	container := `{"Version":"v1","Metadata":{"ID":"ctr1","SandboxID":"sb1","Config":{"metadata":{"name":"app"}}}}`
+	sandbox := `{"Version":"v1","Metadata":{"ID":"sb1","Config":{"metadata":{"name":"foo","uid":"uid1","namespace":"default"}},"IP":"10.0.0.5"}}`
+	spec := `{"ociVersion":"1.1.0","hostname":"foo","linux":{"cgroupsPath":"kubepods-besteffort-poduid1.slice:cri-containerd:sb1"}}`
+
+	put := func(b *bolt.Bucket, key, typeURL, value string) error {
+		data, err := proto.Marshal(&anypb.Any{TypeUrl: typeURL, Value: []byte(value)})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		v1, _ := tx.CreateBucket([]byte("v1"))
+		nsb, _ := v1.CreateBucket([]byte("k8s.io"))
+		sandboxes, _ := nsb.CreateBucket([]byte("sandboxes"))
+		sb, _ := sandboxes.CreateBucket([]byte("sb1"))
+		sb.Put([]byte("sandboxer"), []byte("podsandbox"))
+		rb, _ := sb.CreateBucket([]byte("runtime"))
+		rb.Put([]byte("name"), []byte("io.containerd.runc.v2"))
+		if err := put(sb, "spec", runtimeSpecTypeURL, spec); err != nil {
+			return err
+		}
+		sbExt, _ := sb.CreateBucket([]byte("extensions"))
+		if err := put(sbExt, "metadata", "github.com/containerd/containerd/v2/internal/cri/store/sandbox/Metadata", sandbox); err != nil {
+			return err
+		}
+
+		containers, _ := nsb.CreateBucket([]byte("containers"))
+		for _, id := range []string{"ctr1", "ctr2"} {
+			ctr, _ := containers.CreateBucket([]byte(id))
+			ctr.Put([]byte("image"), []byte("docker.io/library/nginx:latest"))
+			if id == "ctr1" {
+				ext, _ := ctr.CreateBucket([]byte("extensions"))
+				if err := put(ext, "io.cri-containerd.container.metadata", "github.com/containerd/containerd/v2/internal/cri/store/container/Metadata", container); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	s := newTestServer(t, path)
+
+	var views []SandboxView
+	s.Get("/api/containerd/sandboxes?namespace=k8s.io").Decode(t, &views)
+	if len(views) != 1 {
+		t.Fatalf("sandboxes = %+v, want sb1", views)
+	}
+	v := views[0]
+	if v.ID != "sb1" || v.Sandboxer != "podsandbox" || v.Runtime != "io.containerd.runc.v2" {
+		t.Errorf("sandbox = %+v", v)
+	}
+	if v.CRI == nil || v.CRI.PodName != "foo" || v.CRI.IP != "10.0.0.5" {
+		t.Errorf("CRI metadata = %+v, want pod foo at 10.0.0.5", v.CRI)
+	}
+	if spec, ok := v.Spec.(map[string]interface{}); !ok || spec["hostname"] != "foo" {
+		t.Errorf("spec = %#v, want the runtime spec", v.Spec)
+	}
+	if len(v.Containers) != 1 || v.Containers[0] != "ctr1" || len(v.Extensions) != 1 {
+		t.Errorf("containers = %v extensions = %v, want ctr1 and metadata", v.Containers, v.Extensions)
+	}
+
+	var containers []ContainerView
+	s.Get("/api/containerd/containers").Decode(t, &containers)
+	if len(containers) != 2 || containers[0].SandboxID != "sb1" || containers[1].SandboxID != "" {
+		t.Errorf("containers = %+v, want ctr1 in sb1", containers)
+	}
+}
@@ -0,0 +1,97 @@
+// csv.go - key listings as CSV for spreadsheets
+package viewer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Listing formats selected with ?format= on /api/bucket and /api/search
+const (
+	listFormatJSON = "json"
+	listFormatCSV  = "csv"
+)
+
+// listFormat returns the format parameter of a key listing, json if absent
+func listFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", listFormatJSON, listFormatYAML:
+		// negotiateYAML converts the JSON
+		return listFormatJSON, nil
+	case listFormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, want json, yaml or csv", format)
+	}
+}
+
+// startCSV sets the headers of a CSV download named after name
+func startCSV(w http.ResponseWriter, name string) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", downloadFilename(name, ".csv")))
+	return csv.NewWriter(w)
+}
+
+// streamBucketCSV writes the keys of a bucket in order, from the cursor on, as
+// key,type,size,preview rows; like streamBucketDetails rows are written as
+// the cursor moves, there is no response budget
+func (c *Viewer) streamBucketCSV(w http.ResponseWriter, bucketPath string, order keyOrder, from []byte) error {
+	db, err := c.openDB()
+	if err != nil {
+		return err
+	}
+
+	return db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+
+		out := startCSV(w, filepath.Base(bucketPath))
+		out.Write([]string{"key", "type", "size", "preview"})
+		var err error
+		order.forEach(b, from, func(k, v []byte) bool {
+			kv := c.parseKeyValue(k, v)
+			err = out.Write([]string{kv.Key, kv.ValueType, strconv.Itoa(kv.ValueSize), kv.Preview})
+			return err == nil
+		})
+		if err != nil {
+			slog.Warn("Stopped streaming bucket", "bucket", bucketPath, "error", err)
+			return nil
+		}
+		if err := flushCSV(out); err != nil {
+			slog.Warn("Stopped streaming bucket", "bucket", bucketPath, "error", err)
+		}
+		return nil
+	})
+}
+
+// sendSearchCSV writes search results as bucket,key,type,size,preview rows
+func (c *Viewer) sendSearchCSV(w http.ResponseWriter, query string, results []map[string]interface{}) {
+	out := startCSV(w, "search-"+query)
+	out.Write([]string{"bucket", "key", "type", "size", "preview"})
+	for _, result := range results {
+		out.Write([]string{
+			fmt.Sprint(result["bucket"]),
+			fmt.Sprint(result["key"]),
+			fmt.Sprint(result["type"]),
+			fmt.Sprint(result["size"]),
+			fmt.Sprint(result["preview"]),
+		})
+	}
+	if err := flushCSV(out); err != nil {
+		slog.Warn("Failed to write search results", "error", err)
+	}
+}
+
+// flushCSV writes buffered rows and returns the first write error
+func flushCSV(out *csv.Writer) error {
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,55 @@
+package viewer
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestCSVListings(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	status, body := s.Do(http.MethodGet, "/api/bucket/misc?format=csv", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"key", "type", "size", "preview"},
+		{"counter", "Binary", "8"},
+		{"json", "JSON", "15"},
+		{"text", "String", "5", "hello"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %q, want %d", rows, len(want))
+	}
+	for i, row := range want {
+		for j, cell := range row {
+			if rows[i][j] != cell {
+				t.Errorf("row %d column %d = %q, want %q", i, j, rows[i][j], cell)
+			}
+		}
+	}
+
+	status, body = s.Do(http.MethodGet, "/api/search?q=key&format=csv", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	rows, err = csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][0] != "misc/nested" || rows[1][1] != "key" || rows[1][4] != "value" {
+		t.Errorf("search rows = %q, want misc/nested key", rows)
+	}
+
+	if status, _ := s.Do(http.MethodGet, "/api/bucket/misc?format=xml", nil); status != http.StatusBadRequest {
+		t.Errorf("format=xml status = %d, want 400", status)
+	}
+}
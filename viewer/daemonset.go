@@ -0,0 +1,332 @@
+// daemonset.go - frontend mode proxying API requests to per-node agents
+package viewer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// nodeHeader and nodeParam select the agent serving a request
+	nodeHeader = "X-Boltdbui-Node"
+	nodeParam  = "node"
+	// userHeader and roleHeader the frontend user a proxied request is
+	// made for, which the agent applies instead of its anonymous editor
+	userHeader = "X-Boltdbui-User"
+	roleHeader = "X-Boltdbui-Role"
+
+	// agentRefreshInterval how long resolved agents of a service are reused
+	agentRefreshInterval = 30 * time.Second
+	// agentProbeTimeout limit of the capabilities request asking an agent
+	// for its node name
+	agentProbeTimeout = 2 * time.Second
+	// agentResolveTimeout limit of resolving the service and probing its
+	// agents, independent of the request that found the result expired
+	agentResolveTimeout = 5 * time.Second
+)
+
+var (
+	// frontendPaths API path prefixes always served by the frontend itself,
+	// uploads are kept by the frontend
+	frontendPaths = []string{"/api/nodes", "/api/databases"}
+	// frontendLocalPaths API paths a frontend without a database answers
+	// itself when no node is named
+	frontendLocalPaths = []string{"/api/capabilities", "/api/openapi.json", "/api/perf"}
+)
+
+// nodeSource lists the databases of DaemonSet nodes among the sources; they
+// stay on their nodes and are browsed through the agents with ?node=
+type nodeSource struct{}
+
+func (nodeSource) Scheme() string { return "node" }
+func (nodeSource) Description() string {
+	return "Database of a node's agent, browsed through the frontend with ?node= rather than acquired"
+}
+func (nodeSource) Example() string { return "node://node-1" }
+func (nodeSource) Available() bool { return false }
+
+func (nodeSource) Acquire(ctx context.Context, node string) (*Source, error) {
+	return nil, fmt.Errorf("databases of nodes are not copied, select %s with ?node= or the %s header", node, nodeHeader)
+}
+
+// NodeInfo an agent reachable through the frontend
+type NodeInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// agentPool the agents of a frontend: a static node to URL list and/or the
+// pods behind a headless service, asked for their node name
+type agentPool struct {
+	static  map[string]*url.URL
+	service string // host:port of a headless service, empty for none
+	client  *http.Client
+
+	mu       sync.Mutex
+	resolved map[string]*url.URL
+	expires  time.Time
+	// refreshing closed when the running refresh is done, nil if none runs
+	refreshing chan struct{}
+}
+
+// newAgentPool parses "node=http://host:port" agents
+func newAgentPool(agents []string, service string) (*agentPool, error) {
+	p := &agentPool{
+		static:  map[string]*url.URL{},
+		service: service,
+		client:  &http.Client{Timeout: agentProbeTimeout},
+	}
+	for _, a := range agents {
+		name, raw, ok := strings.Cut(a, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid agent %q, expected node=http://host:port", a)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid agent URL %q of node %s", raw, name)
+		}
+		p.static[name] = u
+	}
+	if service != "" {
+		if _, _, err := net.SplitHostPort(service); err != nil {
+			return nil, fmt.Errorf("invalid agent service %q, expected host:port: %v", service, err)
+		}
+	}
+	return p, nil
+}
+
+// nodes returns all agents by node name. Once the resolved agents expired a
+// refresh is started in the background and the previous ones are returned;
+// only the first resolution is waited for, at most until ctx is done
+func (p *agentPool) nodes(ctx context.Context) map[string]*url.URL {
+	nodes := map[string]*url.URL{}
+	for name, u := range p.static {
+		nodes[name] = u
+	}
+	if p.service == "" {
+		return nodes
+	}
+
+	p.mu.Lock()
+	if p.resolved == nil || time.Now().After(p.expires) {
+		if p.refreshing == nil {
+			p.refreshing = make(chan struct{})
+			go p.refresh(p.refreshing)
+		}
+		if p.resolved == nil {
+			refreshing := p.refreshing
+			p.mu.Unlock()
+			select {
+			case <-refreshing:
+			case <-ctx.Done():
+			}
+			p.mu.Lock()
+		}
+	}
+	for name, u := range p.resolved {
+		if _, ok := nodes[name]; !ok {
+			nodes[name] = u
+		}
+	}
+	p.mu.Unlock()
+	return nodes
+}
+
+// refresh resolves the service without holding the pool lock and swaps the
+// result in, the previous agents are kept when the lookup fails
+func (p *agentPool) refresh(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), agentResolveTimeout)
+	defer cancel()
+	resolved, err := p.resolveService(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.resolved = resolved
+		p.expires = time.Now().Add(agentRefreshInterval)
+	} else if p.resolved != nil {
+		p.expires = time.Now().Add(agentRefreshInterval)
+	}
+	p.refreshing = nil
+	close(done)
+}
+
+// resolveService looks up the pod IPs of the service and asks each agent
+// for its node name, the IP is used when an agent does not know it
+func (p *agentPool) resolveService(ctx context.Context) (map[string]*url.URL, error) {
+	host, port, _ := net.SplitHostPort(p.service)
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		slog.Error("Failed to resolve agent service", "service", p.service, "error", err)
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	resolved := map[string]*url.URL{}
+	for _, ip := range ips {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			u := &url.URL{Scheme: "http", Host: net.JoinHostPort(ip, port)}
+			name, err := p.nodeName(ctx, u)
+			if err != nil {
+				slog.Warn("Agent did not report its node", "agent", u.Host, "error", err)
+				name = ip
+			}
+			mu.Lock()
+			resolved[name] = u
+			mu.Unlock()
+		}(ip)
+	}
+	wg.Wait()
+	slog.Debug("Resolved agents", "agents", len(resolved), "service", p.service)
+	return resolved, nil
+}
+
+// nodeName reads the node of an agent from its capabilities
+func (p *agentPool) nodeName(ctx context.Context, u *url.URL) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String()+"/api/capabilities", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var caps struct {
+		Data Capabilities `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+		return "", err
+	}
+	if caps.Data.Node == "" {
+		return "", fmt.Errorf("no node name, start agents with --node-name")
+	}
+	return caps.Data.Node, nil
+}
+
+// routeToNode proxies API requests naming a node (?node= or the
+// X-Boltdbui-Node header) to its agent; a frontend without a database of
+// its own requires one except for its capabilities and the OpenAPI document
+func (c *Viewer) routeToNode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.agents == nil || !strings.HasPrefix(r.URL.Path, "/api/") || isFrontendPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		node := r.Header.Get(nodeHeader)
+		if node == "" {
+			node = r.URL.Query().Get(nodeParam)
+		}
+		if node == "" {
+			if c.databasePath() == "" && !isFrontendLocalPath(r.URL.Path) {
+				c.sendErrorCode(w, http.StatusBadRequest, "Select a node with ?node= or the "+nodeHeader+" header, see /api/nodes", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target, ok := c.agents.nodes(r.Context())[node]
+		if !ok {
+			c.sendErrorCode(w, http.StatusNotFound, "Unknown node", fmt.Errorf("no agent for node %s", node))
+			return
+		}
+		c.agentProxy(target).ServeHTTP(w, r)
+	})
+}
+
+// isFrontendPath reports whether a path is always served by the frontend
+func isFrontendPath(path string) bool {
+	for _, prefix := range frontendPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFrontendLocalPath reports whether a frontend without a database serves
+// a path itself
+func isFrontendLocalPath(path string) bool {
+	for _, p := range frontendLocalPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// agentProxy forwards a request to an agent without the node selection and
+// the frontend's credentials, but with the user they were verified for so
+// the agent enforces the role
+func (c *Viewer) agentProxy(target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			q := pr.Out.URL.Query()
+			q.Del(nodeParam)
+			pr.Out.URL.RawQuery = q.Encode()
+			pr.Out.Header.Del(nodeHeader)
+			pr.Out.Header.Del("Cookie")
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header.Del(userHeader)
+			pr.Out.Header.Del(roleHeader)
+			if user, ok := userFromContext(pr.In.Context()); ok {
+				pr.Out.Header.Set(userHeader, user.Subject)
+				pr.Out.Header.Set(roleHeader, user.Role)
+			}
+		},
+		// Bucket listings are streamed, pass them on as they arrive
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			c.sendErrorCode(w, http.StatusBadGateway, "Agent unavailable", err)
+		},
+	}
+}
+
+// forwardedUser applies the user a frontend proxied a request for. It is
+// only trusted where requests need no login, an anonymous caller is an
+// editor there anyway, and any role other than editor is read as viewer
+func forwardedUser(r *http.Request) *http.Request {
+	role := r.Header.Get(roleHeader)
+	if _, ok := userFromContext(r.Context()); ok || role == "" {
+		return r
+	}
+	user := &User{Subject: r.Header.Get(userHeader), Role: RoleViewer}
+	if role == RoleEditor {
+		user.Role = RoleEditor
+	}
+	if user.Subject != "" {
+		setRequestUser(r, user.Subject)
+	}
+	return r.WithContext(context.WithValue(r.Context(), userContextKey{}, user))
+}
+
+// handleListNodes lists the nodes reachable through this frontend, empty
+// unless agents are configured
+func (c *Viewer) handleListNodes(w http.ResponseWriter, r *http.Request) {
+	nodes := []NodeInfo{}
+	if c.agents != nil {
+		for name, u := range c.agents.nodes(r.Context()) {
+			nodes = append(nodes, NodeInfo{Name: name, URL: u.String()})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	c.sendSuccess(w, nodes)
+}
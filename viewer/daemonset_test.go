@@ -0,0 +1,161 @@
+package viewer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// newFrontend starts a frontend without a database of its own
+func newFrontend(t *testing.T, opts Options) *boltdbtest.Server {
+	t.Helper()
+
+	frontend, err := NewViewer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { frontend.Close() })
+	return boltdbtest.NewServer(t, frontend.Handler())
+}
+
+func TestFrontendProxiesToAgents(t *testing.T) {
+	agent := newTestServer(t, boltdbtest.Containerd(t), func(c *Viewer) {
+		c.nodeName = "node-a"
+	})
+	s := newFrontend(t, Options{Agents: []string{"node-a=" + agent.URL}})
+
+	var nodes []NodeInfo
+	s.Get("/api/nodes").Decode(t, &nodes)
+	if len(nodes) != 1 || nodes[0].Name != "node-a" || nodes[0].URL != agent.URL {
+		t.Errorf("nodes = %+v, want node-a", nodes)
+	}
+
+	var buckets []BucketInfo
+	s.Get("/api/buckets?node=node-a").Decode(t, &buckets)
+	if len(buckets) != 1 || buckets[0].Name != "v1" {
+		t.Errorf("buckets of node-a = %+v, want v1", buckets)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/api/capabilities", nil)
+	req.Header.Set(nodeHeader, "node-a")
+	if resp, err := s.Client().Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("capabilities with %s header: %v %v", nodeHeader, resp, err)
+	}
+
+	if resp := s.API(http.MethodGet, "/api/buckets", ""); resp.Status != http.StatusBadRequest {
+		t.Errorf("request without node status = %d, want 400", resp.Status)
+	}
+	if resp := s.API(http.MethodGet, "/api/buckets?node=node-b", ""); resp.Status != http.StatusNotFound {
+		t.Errorf("unknown node status = %d, want 404", resp.Status)
+	}
+}
+
+func TestFrontendAgentService(t *testing.T) {
+	agent := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.nodeName = "node-a"
+	})
+	s := newFrontend(t, Options{AgentService: strings.Replace(agent.Listener.Addr().String(), "127.0.0.1", "localhost", 1)})
+
+	var nodes []NodeInfo
+	s.Get("/api/nodes").Decode(t, &nodes)
+	found := false
+	for _, n := range nodes {
+		found = found || n.Name == "node-a"
+	}
+	if !found {
+		t.Fatalf("nodes = %+v, want node-a resolved from the service", nodes)
+	}
+
+	var buckets []BucketInfo
+	s.Get("/api/buckets?node=node-a").Decode(t, &buckets)
+	if len(buckets) != 1 || buckets[0].Name != "misc" {
+		t.Errorf("buckets of node-a = %+v, want misc", buckets)
+	}
+}
+
+func TestAgentPoolResolvesInBackground(t *testing.T) {
+	release := make(chan struct{})
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"success":true,"data":{"node":"node-a"}}`))
+	}))
+	t.Cleanup(agent.Close)
+	pool, err := newAgentPool(nil, strings.Replace(agent.Listener.Addr().String(), "127.0.0.1", "localhost", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A cancelled request neither waits for the slow agent nor decides
+	// what is cached
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if nodes := pool.nodes(ctx); len(nodes) != 0 {
+		t.Errorf("nodes of a cancelled request = %v, want none yet", nodes)
+	}
+
+	close(release)
+	nodes := pool.nodes(context.Background())
+	if _, ok := nodes["node-a"]; !ok {
+		t.Errorf("nodes = %v, want node-a", nodes)
+	}
+	if _, ok := nodes["127.0.0.1"]; ok {
+		t.Errorf("nodes = %v, the agent was named by its IP", nodes)
+	}
+}
+
+func TestFrontendForwardsRole(t *testing.T) {
+	agent := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+		c.nodeName = "node-a"
+	})
+	frontend, err := NewViewer(Options{Agents: []string{"node-a=" + agent.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { frontend.Close() })
+	handler := frontend.Handler()
+	// As authenticate stores the verified user
+	s := boltdbtest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := &User{Subject: r.URL.Query().Get("as"), Role: RoleViewer}
+		if user.Subject == "editor" {
+			user.Role = RoleEditor
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	}))
+
+	// A viewer claiming the editor role is still a viewer on the agent
+	req, _ := http.NewRequest(http.MethodPut, s.URL+"/api/key/misc/text?node=node-a&as=viewer", strings.NewReader("changed"))
+	req.Header.Set(roleHeader, RoleEditor)
+	if resp, err := s.Client().Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("write as viewer through the frontend: %v %v, want 403", resp, err)
+	}
+	var caps Capabilities
+	s.Get("/api/capabilities?node=node-a&as=viewer").Decode(t, &caps)
+	if caps.Role != RoleViewer || caps.Actions["write"] {
+		t.Errorf("capabilities of a viewer on the agent = %+v", caps)
+	}
+
+	if resp := s.API(http.MethodPut, "/api/key/misc/text?node=node-a&as=editor", "changed"); !resp.Success {
+		t.Errorf("write as editor through the frontend: status %d: %s", resp.Status, resp.Error)
+	}
+	var kv KeyValuePair
+	agent.Get("/api/key/misc/text").Decode(t, &kv)
+	if kv.Preview != "changed" {
+		t.Errorf("text = %q, want changed", kv.Preview)
+	}
+}
+
+func TestNewAgentPoolRejectsInvalidAgents(t *testing.T) {
+	for _, agents := range [][]string{{"node-a"}, {"=http://a:1"}, {"node-a=ftp://a"}, {"node-a=a:1"}} {
+		if _, err := newAgentPool(agents, ""); err == nil {
+			t.Errorf("agents %q accepted", agents)
+		}
+	}
+	if _, err := newAgentPool(nil, "agents.svc"); err == nil {
+		t.Error("service without port accepted")
+	}
+}
@@ -0,0 +1,26 @@
+// debug.go - optional pprof and expvar endpoints
+package viewer
+
+import (
+	"expvar"
+	"net/http/pprof"
+
+	"github.com/gorilla/mux"
+)
+
+// registerDebugRoutes serves net/http/pprof below /debug/pprof/ and expvar
+// at /debug/vars when enabled with --enable-pprof; they are behind
+// authentication like every other route
+func (c *Viewer) registerDebugRoutes(r *mux.Router) {
+	if !c.enablePprof {
+		return
+	}
+
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// Index also serves the named profiles, e.g. /debug/pprof/heap
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	r.Handle("/debug/vars", expvar.Handler())
+}
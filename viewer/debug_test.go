@@ -0,0 +1,31 @@
+package viewer
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestDebugRoutes(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+
+	off := newTestServer(t, path)
+	if status, _ := off.Do(http.MethodGet, "/debug/pprof/", nil); status != http.StatusNotFound {
+		t.Errorf("pprof without --enable-pprof: status %d, want 404", status)
+	}
+
+	on := newTestServer(t, path, func(c *Viewer) {
+		c.enablePprof = true
+	})
+	for _, p := range []string{"/debug/pprof/", "/debug/pprof/heap?debug=1", "/debug/pprof/cmdline"} {
+		if status, _ := on.Do(http.MethodGet, p, nil); status != http.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", p, status)
+		}
+	}
+	status, body := on.Do(http.MethodGet, "/debug/vars", nil)
+	if status != http.StatusOK || !strings.Contains(string(body), `"memstats"`) {
+		t.Errorf("GET /debug/vars: status %d, want expvar JSON", status)
+	}
+}
@@ -0,0 +1,187 @@
+// decoders.go - value decoders for encodings other than containerd's
+package viewer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// decode hints, names of /api/decode/{kind} endpoints likely to apply to a
+// value, shown as decode buttons
+const (
+	hintInteger = "integer"
+	hintGob     = "gob"
+	hintBase64  = "base64"
+)
+
+// Binary codecs detected as value types
+const (
+	codecMsgpack = "MessagePack"
+	codecCBOR    = "CBOR"
+)
+
+// maxDecodeDepth nesting limit of values decoded into generic structures
+const maxDecodeDepth = 100
+
+// valueDecoder decodes a raw value for /api/decode/{kind}
+type valueDecoder func(value []byte) (map[string]interface{}, error)
+
+// decodeHandler serves a decoder for the value of {bucketPath}/{key},
+// decompressing gzip and zstd values first
+func (c *Viewer) decodeHandler(decode valueDecoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		bucketPath, err := url.QueryUnescape(vars["bucketPath"])
+		if err != nil {
+			c.sendError(w, "Invalid bucket path", err)
+			return
+		}
+		keyName, err := url.QueryUnescape(vars["key"])
+		if err != nil {
+			c.sendError(w, "Invalid key name", err)
+			return
+		}
+
+		value, err := c.getRawValue(bucketPath, keyName)
+		if err != nil {
+			c.sendError(w, "Failed to get key", err)
+			return
+		}
+		if _, data, err := decompressValue(value); err == nil && data != nil {
+			value = data
+		}
+		result, err := decode(value)
+		if err != nil {
+			c.sendError(w, "Decoding failed", err)
+			return
+		}
+		c.sendSuccess(w, result)
+	}
+}
+
+// decodeHints suggests decoders for a value that type detection alone
+// leaves opaque
+func decodeHints(value []byte) []string {
+	var hints []string
+	// Counters and sequence numbers are commonly 8 byte integers
+	if len(value) == 8 {
+		hints = append(hints, hintInteger)
+	}
+	if isGob(value) {
+		hints = append(hints, hintGob)
+	}
+	return hints
+}
+
+// detectCodec returns the codec and decoded structure of a MessagePack or
+// CBOR map or array, tried in that order as the first bytes overlap; other
+// values and scalars, which any short binary could pass for, return ""
+func detectCodec(value []byte) (string, interface{}) {
+	if len(value) < 2 {
+		return "", nil
+	}
+	// fixmap, fixarray, array 16/32 and map 16/32
+	if b := value[0]; b >= 0x80 && b <= 0x9f || b >= 0xdc && b <= 0xdf {
+		if v, err := decodeMsgpack(value); err == nil {
+			return codecMsgpack, v
+		}
+	}
+	// Arrays, maps and the self-described CBOR tag 55799 (0xd9d9f7)
+	if major := value[0] >> 5; major == cborArray || major == cborMap || value[0] == 0xd9 {
+		if v, err := decodeCBOR(value); err == nil {
+			return codecCBOR, v
+		}
+	}
+	return "", nil
+}
+
+// decodeMsgpackValue decodes a MessagePack value for /api/decode/msgpack
+func decodeMsgpackValue(value []byte) (map[string]interface{}, error) {
+	v, err := decodeMsgpack(value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"codec": codecMsgpack, "value": v}, nil
+}
+
+// decodeCBORValue decodes a CBOR data item for /api/decode/cbor
+func decodeCBORValue(value []byte) (map[string]interface{}, error) {
+	v, err := decodeCBOR(value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"codec": codecCBOR, "value": v}, nil
+}
+
+// decodeIntegerValue reads a 1, 2, 4 or 8 byte value as unsigned and signed
+// integer in both byte orders, and any value as a varint when it is exactly
+// one; numbers are strings, JavaScript cannot hold 64 bit integers
+func decodeIntegerValue(value []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"size": len(value),
+		"hex":  fmt.Sprintf("0x%x", value),
+	}
+
+	var be, le uint64
+	var signed func(uint64) int64
+	switch len(value) {
+	case 1:
+		be, le = uint64(value[0]), uint64(value[0])
+		signed = func(v uint64) int64 { return int64(int8(v)) }
+	case 2:
+		be, le = uint64(binary.BigEndian.Uint16(value)), uint64(binary.LittleEndian.Uint16(value))
+		signed = func(v uint64) int64 { return int64(int16(v)) }
+	case 4:
+		be, le = uint64(binary.BigEndian.Uint32(value)), uint64(binary.LittleEndian.Uint32(value))
+		signed = func(v uint64) int64 { return int64(int32(v)) }
+	case 8:
+		be, le = binary.BigEndian.Uint64(value), binary.LittleEndian.Uint64(value)
+		signed = func(v uint64) int64 { return int64(v) }
+	}
+	if signed != nil {
+		result["bigEndian"] = map[string]string{
+			"unsigned": strconv.FormatUint(be, 10),
+			"signed":   strconv.FormatInt(signed(be), 10),
+		}
+		result["littleEndian"] = map[string]string{
+			"unsigned": strconv.FormatUint(le, 10),
+			"signed":   strconv.FormatInt(signed(le), 10),
+		}
+	}
+
+	if n, read := binary.Varint(value); read > 0 && read == len(value) {
+		result["varint"] = strconv.FormatInt(n, 10)
+	}
+	if n, read := binary.Uvarint(value); read > 0 && read == len(value) {
+		result["uvarint"] = strconv.FormatUint(n, 10)
+	}
+
+	if signed == nil && result["varint"] == nil {
+		return nil, fmt.Errorf("%d bytes are neither a fixed width integer nor a varint", len(value))
+	}
+	return result, nil
+}
+
+// jsonFloat keeps floats JSON can not encode as text
+func jsonFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+	return f
+}
+
+// textOrHex shows text as is, other bytes as hex
+func textOrHex(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
@@ -0,0 +1,160 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDecodeInteger(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("counters"))
+		if err != nil {
+			return err
+		}
+		b.Put([]byte("seq"), []byte{0, 0, 0, 0, 0, 0, 1, 0})
+		return b.Put([]byte("text"), []byte("hello"))
+	})
+	s := newTestServer(t, path)
+
+	var kv KeyValuePair
+	s.Get("/api/key/counters/seq").Decode(t, &kv)
+	if len(kv.DecodeHints) != 1 || kv.DecodeHints[0] != hintInteger {
+		t.Errorf("hints = %v, want [integer]", kv.DecodeHints)
+	}
+
+	var decoded struct {
+		BigEndian    map[string]string `json:"bigEndian"`
+		LittleEndian map[string]string `json:"littleEndian"`
+	}
+	s.Get("/api/decode/integer/counters/seq").Decode(t, &decoded)
+	if decoded.BigEndian["unsigned"] != "256" || decoded.LittleEndian["unsigned"] != "281474976710656" {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	if resp := s.API("GET", "/api/decode/integer/counters/text", ""); resp.Success {
+		t.Error("decoding a 5 byte string succeeded")
+	}
+}
+
+type gobSession struct {
+	User    string
+	Expires int64
+	Scopes  []string
+	Attrs   map[string]float64
+	Owner   interface{}
+}
+
+type gobOwner struct {
+	ID int
+}
+
+func TestDecodeGob(t *testing.T) {
+	gob.Register(gobOwner{})
+	var buf bytes.Buffer
+	session := gobSession{User: "alice", Expires: -5, Scopes: []string{"read"}, Attrs: map[string]float64{"ratio": 0.5}, Owner: gobOwner{ID: 7}}
+	if err := gob.NewEncoder(&buf).Encode(session); err != nil {
+		t.Fatal(err)
+	}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("sessions"))
+		if err != nil {
+			return err
+		}
+		b.Put([]byte("s1"), buf.Bytes())
+		return b.Put([]byte("text"), []byte("hello"))
+	})
+	s := newTestServer(t, path)
+
+	var kv KeyValuePair
+	s.Get("/api/key/sessions/s1").Decode(t, &kv)
+	if len(kv.DecodeHints) != 1 || kv.DecodeHints[0] != hintGob {
+		t.Errorf("hints = %v, want [gob]", kv.DecodeHints)
+	}
+
+	var decoded struct {
+		Types  []GobType  `json:"types"`
+		Values []GobValue `json:"values"`
+	}
+	s.Get("/api/decode/gob/sessions/s1").Decode(t, &decoded)
+	if len(decoded.Types) == 0 || decoded.Types[0].Name != "gobSession" || len(decoded.Types[0].Fields) != 5 {
+		t.Fatalf("types = %+v", decoded.Types)
+	}
+	if len(decoded.Values) != 1 || decoded.Values[0].Type != "gobSession" {
+		t.Fatalf("values = %+v", decoded.Values)
+	}
+	v := decoded.Values[0].Value.(map[string]interface{})
+	if v["User"] != "alice" || v["Expires"] != float64(-5) {
+		t.Errorf("value = %v", v)
+	}
+	if scopes, _ := v["Scopes"].([]interface{}); len(scopes) != 1 || scopes[0] != "read" {
+		t.Errorf("Scopes = %v", v["Scopes"])
+	}
+	if attrs, _ := v["Attrs"].(map[string]interface{}); attrs["ratio"] != 0.5 {
+		t.Errorf("Attrs = %v", v["Attrs"])
+	}
+	owner, _ := v["Owner"].(map[string]interface{})
+	if inner, _ := owner["value"].(map[string]interface{}); inner["ID"] != float64(7) {
+		t.Errorf("Owner = %v", v["Owner"])
+	}
+
+	if resp := s.API("GET", "/api/decode/gob/sessions/text", ""); resp.Success {
+		t.Error("decoding a string as gob succeeded")
+	}
+}
+
+func TestDetectCodecs(t *testing.T) {
+	msgpack := []byte{0x84,
+		0xa4, 'n', 'a', 'm', 'e', 0xa3, 'w', 'e', 'b',
+		0xa4, 'p', 'o', 'r', 't', 0xcd, 0x1f, 0x90,
+		0xa4, 't', 'a', 'g', 's', 0x91, 0xa1, 'a',
+		0xa2, 't', 's', 0xd6, 0xff, 0, 0, 0, 0}
+	cbor := []byte{0xa4,
+		0x64, 'n', 'a', 'm', 'e', 0x63, 'w', 'e', 'b',
+		0x63, 'n', 'e', 'g', 0x39, 0x01, 0xf3,
+		0x61, 'f', 0xf9, 0x3e, 0x00,
+		0x63, 'b', 'i', 'g', 0xc2, 0x42, 0x01, 0x00}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("values"))
+		if err != nil {
+			return err
+		}
+		b.Put([]byte("msgpack"), msgpack)
+		b.Put([]byte("cbor"), cbor)
+		return b.Put([]byte("port"), []byte{0xcd, 0x1f, 0x90})
+	})
+	s := newTestServer(t, path)
+
+	var kv KeyValuePair
+	s.Get("/api/key/values/msgpack").Decode(t, &kv)
+	v, _ := kv.Value.(map[string]interface{})
+	if kv.ValueType != codecMsgpack || v["name"] != "web" || v["port"] != float64(8080) || v["ts"] != "1970-01-01T00:00:00Z" {
+		t.Errorf("msgpack = %s %v", kv.ValueType, kv.Value)
+	}
+
+	s.Get("/api/key/values/cbor").Decode(t, &kv)
+	v, _ = kv.Value.(map[string]interface{})
+	if kv.ValueType != codecCBOR || v["neg"] != float64(-500) || v["f"] != 1.5 || v["big"] != "256" {
+		t.Errorf("cbor = %s %v", kv.ValueType, kv.Value)
+	}
+
+	// Scalars are left binary, the decoders still read them
+	s.Get("/api/key/values/port").Decode(t, &kv)
+	if kv.ValueType != "Binary" {
+		t.Errorf("scalar detected as %s", kv.ValueType)
+	}
+	var decoded struct {
+		Codec string      `json:"codec"`
+		Value interface{} `json:"value"`
+	}
+	s.Get("/api/decode/msgpack/values/port").Decode(t, &decoded)
+	if decoded.Codec != codecMsgpack || decoded.Value != float64(8080) {
+		t.Errorf("decoded = %+v", decoded)
+	}
+	if resp := s.API("GET", "/api/decode/cbor/values/msgpack", ""); resp.Success {
+		t.Error("decoding MessagePack as CBOR succeeded")
+	}
+}
@@ -0,0 +1,131 @@
+// dedup.go - concurrent identical requests share one database walk
+package viewer
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+var (
+	// errResponseNotShared the leader's response was too large to keep for
+	// the requests waiting on it, they run the handler themselves
+	errResponseNotShared = errors.New("response too large to share")
+	// errClientGone stops a leader that has neither a client nor a
+	// recording left to write to
+	errClientGone = errors.New("client went away")
+)
+
+// sharedResponse a response recorded for requests waiting on the leader
+type sharedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// teeWriter writes the leader's response to its client and records it; the
+// recording continues if the leader's client goes away, others still wait
+type teeWriter struct {
+	w          http.ResponseWriter
+	resp       sharedResponse
+	buf        bytes.Buffer
+	limit      int
+	overflow   bool
+	clientGone bool
+}
+
+func (t *teeWriter) Header() http.Header { return t.w.Header() }
+
+func (t *teeWriter) WriteHeader(status int) {
+	if t.resp.header != nil {
+		return
+	}
+	t.resp.status = status
+	t.resp.header = t.w.Header().Clone()
+	t.w.WriteHeader(status)
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if t.resp.header == nil {
+		t.WriteHeader(http.StatusOK)
+	}
+	if !t.overflow {
+		if t.buf.Len()+len(p) > t.limit {
+			t.overflow = true
+			t.buf = bytes.Buffer{}
+		} else {
+			t.buf.Write(p)
+		}
+	}
+	if !t.clientGone {
+		if _, err := t.w.Write(p); err != nil {
+			t.clientGone = true
+		}
+	}
+	if t.clientGone && t.overflow {
+		// Nobody is left to read the rest
+		return 0, errClientGone
+	}
+	return len(p), nil
+}
+
+// deduplicated wraps GET handlers of expensive scans: while a request is
+// running, identical requests (same URL, database version and locale) wait
+// for it and receive a copy of its response instead of walking the
+// database again
+func (c *Viewer) deduplicated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version, err := c.dbVersion()
+		if err != nil {
+			h(w, r)
+			return
+		}
+
+		leader := false
+		// Error messages are in the locale of the request, see localize
+		key := r.URL.RequestURI() + "@" + version + "@" + w.Header().Get("Content-Language")
+		v, err, _ := c.flight.Do(key, func() (interface{}, error) {
+			leader = true
+			tee := &teeWriter{w: w, limit: c.sharedResponseLimit()}
+			h(tee, r)
+			if tee.overflow {
+				return nil, errResponseNotShared
+			}
+			if tee.resp.header == nil {
+				tee.resp.status, tee.resp.header = http.StatusOK, w.Header().Clone()
+			}
+			tee.resp.body = tee.buf.Bytes()
+			return &tee.resp, nil
+		})
+		if leader {
+			return
+		}
+		if err != nil {
+			h(w, r)
+			return
+		}
+
+		resp := v.(*sharedResponse)
+		slog.Info("Shared response", "uri", r.URL.RequestURI())
+		for k, values := range resp.header {
+			if k == "Set-Cookie" {
+				// Cookies belong to the leader's session, see recordHistory
+				continue
+			}
+			w.Header()[k] = values
+		}
+		w.WriteHeader(resp.status)
+		w.Write(resp.body)
+	}
+}
+
+// sharedResponseLimit bytes of a response kept for waiting requests, the
+// response budget if enabled
+func (c *Viewer) sharedResponseLimit() int {
+	if c.maxResponseBytes > 0 {
+		// The budget is checked per item, the last one may exceed it
+		return int(c.maxResponseBytes) * 2
+	}
+	return defaultMaxResponseBytes
+}
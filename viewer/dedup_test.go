@@ -0,0 +1,79 @@
+package viewer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestDeduplicated(t *testing.T) {
+	c := newViewer(boltdbtest.Tiny(t))
+	defer c.Close()
+
+	const clients = 5
+	var arrived sync.WaitGroup
+	arrived.Add(clients)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	scan := c.deduplicated(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("X-Scan", "done")
+		io.WriteString(w, "result")
+	})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		scan(w, r)
+	}))
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	bodies := make(chan string, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(s.URL + "/api/buckets")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			bodies <- resp.Header.Get("X-Scan") + " " + string(body)
+		}()
+	}
+	arrived.Wait()
+	// Give the last arrivals time to join the running scan
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(bodies)
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d scans ran, want 1", n)
+	}
+	for body := range bodies {
+		if body != "done result" {
+			t.Errorf("response = %q, want the shared header and body", body)
+		}
+	}
+}
+
+func TestDeduplicatedTooLarge(t *testing.T) {
+	c := newViewer(boltdbtest.Tiny(t))
+	c.maxResponseBytes = 4
+	defer c.Close()
+
+	tee := &teeWriter{w: httptest.NewRecorder(), limit: c.sharedResponseLimit()}
+	io.WriteString(tee, "too large to share")
+	if !tee.overflow || tee.buf.Len() != 0 {
+		t.Errorf("overflow %v with %d bytes kept, want the recording dropped", tee.overflow, tee.buf.Len())
+	}
+}
@@ -0,0 +1,98 @@
+// digest.go - content digests referenced by values, linked to their blobs
+package viewer
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxDigestRefs bounds the digests reported for one value
+const maxDigestRefs = 100
+
+// digestRefPattern digests embedded in values, of the algorithms containerd
+// supports; digestPattern validates a whole string instead
+var digestRefPattern = regexp.MustCompile(`\b(?:sha256:[0-9a-f]{64}|sha512:[0-9a-f]{128})\b`)
+
+// DigestRef a digest found in a value and the content blob it names
+type DigestRef struct {
+	Digest string `json:"digest"`
+	// Path the bucket of the blob, v1/{namespace}/content/blob/{digest},
+	// empty if no namespace has it
+	Path string `json:"path,omitempty"`
+	// URL the API URL of the blob bucket, relative to the page
+	URL string `json:"url,omitempty"`
+}
+
+// findDigests returns the distinct digests in value in order of appearance;
+// JSON, protobuf strings and plain text all hold them as ASCII
+func findDigests(value []byte) []string {
+	if _, data, err := decompressValue(value); err == nil && data != nil {
+		value = data
+	}
+	var digests []string
+	seen := map[string]bool{}
+	for _, m := range digestRefPattern.FindAll(value, -1) {
+		d := string(m)
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		digests = append(digests, d)
+		if len(digests) == maxDigestRefs {
+			break
+		}
+	}
+	return digests
+}
+
+// digestRefs links the digests of a value at bucketPath to content blobs:
+// those of the key's namespace, or of any namespace for keys outside v1
+func (c *Viewer) digestRefs(tx *bolt.Tx, bucketPath string, value []byte) []DigestRef {
+	digests := findDigests(value)
+	if len(digests) == 0 {
+		return nil
+	}
+
+	var namespaces []string
+	if parts := strings.SplitN(bucketPath, "/", 3); len(parts) >= 2 && parts[0] == string(bucketKeyVersion) {
+		namespaces = []string{parts[1]}
+	} else if v1 := tx.Bucket(bucketKeyVersion); v1 != nil {
+		v1.ForEach(func(k, v []byte) error {
+			if v == nil {
+				namespaces = append(namespaces, string(k))
+			}
+			return nil
+		})
+	}
+
+	refs := make([]DigestRef, 0, len(digests))
+	for _, d := range digests {
+		ref := DigestRef{Digest: d}
+		for _, ns := range namespaces {
+			blobs := contentBlobs(tx, ns)
+			if blobs == nil || blobs.Bucket([]byte(d)) == nil {
+				continue
+			}
+			ref.Path = namespacePath(ns) + "/" + string(bucketKeyObjectContent) + "/" + string(bucketKeyObjectBlob) + "/" + d
+			ref.URL = "api/bucket/" + url.PathEscape(ref.Path)
+			break
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// contentBlobs returns the v1/{ns}/content/blob bucket, nil if missing
+func contentBlobs(tx *bolt.Tx, ns string) *bolt.Bucket {
+	nsb, err := namespaceBucket(tx, ns)
+	if err != nil {
+		return nil
+	}
+	if cb := nsb.Bucket(bucketKeyObjectContent); cb != nil {
+		return cb.Bucket(bucketKeyObjectBlob)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package viewer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDigestRefs(t *testing.T) {
+	present := "sha256:" + strings.Repeat("ab", 32)
+	missing := "sha256:" + strings.Repeat("cd", 32)
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		v1, _ := tx.CreateBucket([]byte("v1"))
+		ns, _ := v1.CreateBucket([]byte("default"))
+		content, _ := ns.CreateBucket([]byte("content"))
+		blobs, _ := content.CreateBucket([]byte("blob"))
+		if _, err := blobs.CreateBucket([]byte(present)); err != nil {
+			return err
+		}
+		images, _ := ns.CreateBucket([]byte("images"))
+		target, _ := images.CreateBucket([]byte("img"))
+		manifest := `{"config":{"digest":"` + present + `"},"layers":[{"digest":"` + missing + `"},{"digest":"` + present + `"}]}`
+		if err := target.Put([]byte("manifest"), []byte(manifest)); err != nil {
+			return err
+		}
+		misc, _ := tx.CreateBucket([]byte("misc"))
+		return misc.Put([]byte("ref"), []byte("see "+present))
+	})
+	s := newTestServer(t, path)
+
+	var kv KeyValuePair
+	s.Get("/api/key/"+bucketURL("v1/default/images/img")+"/manifest").Decode(t, &kv)
+	if len(kv.Digests) != 2 {
+		t.Fatalf("digests = %+v, want 2 distinct", kv.Digests)
+	}
+	want := "v1/default/content/blob/" + present
+	if kv.Digests[0].Digest != present || kv.Digests[0].Path != want {
+		t.Errorf("first digest = %+v, want a link to %s", kv.Digests[0], want)
+	}
+	if kv.Digests[1].Digest != missing || kv.Digests[1].Path != "" {
+		t.Errorf("second digest = %+v, want no link", kv.Digests[1])
+	}
+
+	// The linked bucket can be requested as is
+	var blob BucketInfo
+	s.Get("/"+kv.Digests[0].URL).Decode(t, &blob)
+	if blob.Path != want {
+		t.Errorf("linked bucket = %q, want %q", blob.Path, want)
+	}
+
+	// Keys outside v1 look in every namespace
+	s.Get("/api/key/misc/ref").Decode(t, &kv)
+	if len(kv.Digests) != 1 || kv.Digests[0].Path != want {
+		t.Errorf("misc/ref digests = %+v, want %s", kv.Digests, want)
+	}
+}
@@ -0,0 +1,193 @@
+// discover.go - bolt databases found below containerd's and buildkit's state
+// directories, each served read-only like an upload
+package viewer
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxDiscoverDepth how many levels below a root databases are searched;
+// buildkit's runc-overlayfs/snapshots/snapshots.db is three levels down,
+// deeper ones are container file systems such as the overlayfs
+// snapshotter's snapshots/{id}/fs
+const maxDiscoverDepth = 3
+
+// Kinds of discovered databases
+const (
+	DatabaseKindMetadata    = "metadata"
+	DatabaseKindSnapshotter = "snapshotter"
+	DatabaseKindBuildkit    = "buildkit"
+	DatabaseKindBolt        = "bolt"
+)
+
+// discovery the databases found below the roots, rescanned on each listing
+type discovery struct {
+	roots []string
+
+	mu  sync.Mutex
+	dbs map[string]*uploadedDB
+}
+
+// discoveredID a stable identifier derived from the path, so the URL of a
+// database survives restarts of the viewer
+func discoveredID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:8])
+}
+
+// databaseKind classifies a database by the plugin directory holding it
+func databaseKind(root, path string) string {
+	switch dir := filepath.Base(filepath.Dir(path)); {
+	case strings.HasPrefix(dir, "io.containerd.metadata."):
+		return DatabaseKindMetadata
+	case strings.HasPrefix(dir, "io.containerd.snapshotter."):
+		return DatabaseKindSnapshotter
+	case strings.Contains(filepath.Base(root), "buildkit"):
+		return DatabaseKindBuildkit
+	}
+	return DatabaseKindBolt
+}
+
+// isBoltFile checks the magic of the first meta page, which unlike opening
+// the file does not wait for the lock of a running containerd
+func isBoltFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, pageHeaderSize+4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(header[pageHeaderSize:]) == metaMagic
+}
+
+// findDatabases walks the roots for *.db files that are bolt databases;
+// missing roots are skipped, most nodes lack buildkit
+func findDatabases(roots []string) map[string]string {
+	found := map[string]string{}
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path != root {
+					slog.Debug("Skipping file during discovery", "path", path, "error", err)
+				}
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			depth := strings.Count(rel, string(filepath.Separator))
+			if d.IsDir() {
+				if path != root && depth >= maxDiscoverDepth-1 {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && strings.HasSuffix(d.Name(), ".db") && isBoltFile(path) {
+				found[path] = root
+			}
+			return nil
+		})
+	}
+	return found
+}
+
+// refreshDiscovered rescans the roots, serving new databases and closing
+// the viewers of vanished ones; the configured database is not listed twice
+func (c *Viewer) refreshDiscovered() {
+	d := c.discovery
+	found := findDatabases(d.roots)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.dbs == nil {
+		d.dbs = map[string]*uploadedDB{}
+	}
+	seen := map[string]bool{}
+	current := c.databasePath()
+	for path, root := range found {
+		if samePath(path, current) {
+			continue
+		}
+		id := discoveredID(path)
+		seen[id] = true
+		if db, ok := d.dbs[id]; ok {
+			if info, err := statFile(path); err == nil {
+				db.info.Size = info.Size()
+			}
+			continue
+		}
+
+		info := DatabaseInfo{ID: id, Name: path, Kind: databaseKind(root, path), URL: "db/" + id + "/"}
+		if fi, err := statFile(path); err == nil {
+			info.Size = fi.Size()
+		}
+		v := c.subViewer(path, "file://"+path)
+		d.dbs[id] = &uploadedDB{info: info, viewer: v, handler: subViewerHandler(id, v)}
+		slog.Info("Discovered database", "kind", info.Kind, "path", path, "id", id)
+	}
+	for id, db := range d.dbs {
+		if !seen[id] {
+			db.viewer.closeWebSockets()
+			db.viewer.Close()
+			delete(d.dbs, id)
+			slog.Info("Discovered database is gone", "name", db.info.Name)
+		}
+	}
+}
+
+// list the discovered databases ordered by path
+func (d *discovery) list() []DatabaseInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dbs := make([]DatabaseInfo, 0, len(d.dbs))
+	for _, db := range d.dbs {
+		dbs = append(dbs, db.info)
+	}
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].Name < dbs[j].Name })
+	return dbs
+}
+
+// get returns a discovered database by id
+func (d *discovery) get(id string) (*uploadedDB, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[id]
+	return db, ok
+}
+
+// discoveredDB returns a discovered database by id, rescanning the roots
+// when it is unknown, e.g. for a link opened before the first listing
+func (c *Viewer) discoveredDB(id string) (*uploadedDB, bool) {
+	if db, ok := c.discovery.get(id); ok {
+		return db, true
+	}
+	c.refreshDiscovered()
+	return c.discovery.get(id)
+}
+
+// close closes the viewers of the discovered databases
+func (d *discovery) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, db := range d.dbs {
+		db.viewer.closeWebSockets()
+		db.viewer.Close()
+	}
+	d.dbs = nil
+}
@@ -0,0 +1,83 @@
+package viewer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// placeDB copies the database at src to root/rel
+func placeDB(t *testing.T, src, root, rel string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiscoverDatabases(t *testing.T) {
+	root := t.TempDir()
+	tiny := boltdbtest.Tiny(t)
+	meta := placeDB(t, boltdbtest.Containerd(t), root, "io.containerd.metadata.v1.bolt/meta.db")
+	snapshotter := placeDB(t, tiny, root, "io.containerd.snapshotter.v1.overlayfs/metadata.db")
+	// Container file systems are not searched
+	placeDB(t, tiny, root, "io.containerd.snapshotter.v1.overlayfs/snapshots/1/fs/app.db")
+	if err := os.WriteFile(filepath.Join(root, "notes.db"), []byte("not bolt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, meta, func(c *Viewer) {
+		c.discovery = &discovery{roots: []string{root, filepath.Join(root, "missing")}}
+	})
+
+	var dbs []DatabaseInfo
+	s.Get("/api/databases").Decode(t, &dbs)
+	if len(dbs) != 2 || dbs[0].ID != "default" {
+		t.Fatalf("databases = %+v, want the configured and the snapshotter database", dbs)
+	}
+	found := dbs[1]
+	if found.Name != snapshotter || found.Kind != DatabaseKindSnapshotter || found.ID != discoveredID(snapshotter) {
+		t.Errorf("discovered = %+v, want the snapshotter's %s", found, snapshotter)
+	}
+
+	var buckets []BucketInfo
+	s.Get("/"+found.URL+"api/buckets").Decode(t, &buckets)
+	if len(buckets) != 1 || buckets[0].Name != "misc" {
+		t.Errorf("discovered buckets = %+v, want misc", buckets)
+	}
+
+	// Removed files are dropped on the next listing
+	if err := os.Remove(snapshotter); err != nil {
+		t.Fatal(err)
+	}
+	s.Get("/api/databases").Decode(t, &dbs)
+	if len(dbs) != 1 {
+		t.Errorf("databases after removal = %+v, want the configured one", dbs)
+	}
+}
+
+func TestDatabaseKind(t *testing.T) {
+	for _, tc := range []struct {
+		root, path, want string
+	}{
+		{"/var/lib/containerd", "/var/lib/containerd/io.containerd.metadata.v1.bolt/meta.db", DatabaseKindMetadata},
+		{"/var/lib/containerd", "/var/lib/containerd/io.containerd.snapshotter.v1.native/metadata.db", DatabaseKindSnapshotter},
+		{"/var/lib/buildkit", "/var/lib/buildkit/runc-overlayfs/snapshots/snapshots.db", DatabaseKindBuildkit},
+		{"/var/lib/containerd", "/var/lib/containerd/plugin/state.db", DatabaseKindBolt},
+	} {
+		if got := databaseKind(filepath.FromSlash(tc.root), filepath.FromSlash(tc.path)); got != tc.want {
+			t.Errorf("databaseKind(%s) = %s, want %s", tc.path, got, tc.want)
+		}
+	}
+}
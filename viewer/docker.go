@@ -0,0 +1,232 @@
+// docker.go - Docker bolt databases: libnetwork local-kv.db and volumes metadata.db
+package viewer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Docker bolt buckets: libkv stores of /var/lib/docker/network/files/local-kv.db
+// keep every key in one bucket, /var/lib/docker/volumes/metadata.db one
+// JSON document per volume
+var (
+	dockerLibkvBucket   = []byte("libnetwork")
+	dockerVolumesBucket = []byte("volumes")
+)
+
+const (
+	// libkvIndexSize bytes of the little-endian index libkv's boltdb store
+	// prepends to every value
+	libkvIndexSize = 8
+	// libnetworkKeyPrefix prefix of the libnetwork datastore keys
+	libnetworkKeyPrefix = "docker/network/v1.0/"
+)
+
+// splitLibkvValue splits a libkv value into its index and JSON payload; ok
+// is false unless the payload after the index is a JSON object or array
+func splitLibkvValue(value []byte) (index uint64, payload []byte, ok bool) {
+	if len(value) <= libkvIndexSize {
+		return 0, nil, false
+	}
+	payload = value[libkvIndexSize:]
+	if payload[0] != '{' && payload[0] != '[' || !json.Valid(payload) {
+		return 0, nil, false
+	}
+	return binary.LittleEndian.Uint64(value[:libkvIndexSize]), payload, true
+}
+
+// DockerEndpoint a libnetwork endpoint
+type DockerEndpoint struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Sandbox     string `json:"sandbox,omitempty"`
+	Address     string `json:"address,omitempty"`
+	AddressIPv6 string `json:"addressIPv6,omitempty"`
+	MAC         string `json:"mac,omitempty"`
+	Index       uint64 `json:"index"`
+}
+
+// DockerNetwork a libnetwork network with its endpoints
+type DockerNetwork struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Scope      string            `json:"scope,omitempty"`
+	Internal   bool              `json:"internal,omitempty"`
+	Attachable bool              `json:"attachable,omitempty"`
+	Ingress    bool              `json:"ingress,omitempty"`
+	EnableIPv6 bool              `json:"enableIPv6,omitempty"`
+	Created    string            `json:"created,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Index      uint64            `json:"index"`
+	Endpoints  []DockerEndpoint  `json:"endpoints"`
+}
+
+// DockerNetworkReport the networks of a local-kv.db; Other counts the keys
+// of other libnetwork objects (bridge, endpoint_count, ipam, ...) by kind
+type DockerNetworkReport struct {
+	Networks []DockerNetwork `json:"networks"`
+	Other    map[string]int  `json:"other"`
+	// Orphaned endpoints whose network is gone
+	Orphaned []DockerEndpoint `json:"orphaned"`
+}
+
+// DockerVolume a volume of metadata.db
+type DockerVolume struct {
+	Name    string            `json:"name"`
+	Driver  string            `json:"driver"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// isDockerNetwork reports whether the database is a libnetwork local-kv.db
+func isDockerNetwork(tx *bolt.Tx) bool {
+	return tx.Bucket(dockerLibkvBucket) != nil
+}
+
+// isDockerVolumes reports whether the database is a volumes metadata.db
+func isDockerVolumes(tx *bolt.Tx) bool {
+	return tx.Bucket(dockerVolumesBucket) != nil
+}
+
+// handleDockerNetworks returns the networks and endpoints of local-kv.db
+func (c *Viewer) handleDockerNetworks(w http.ResponseWriter, r *http.Request) {
+	report, err := c.getDockerNetworks()
+	if err != nil {
+		c.sendError(w, "Failed to read docker networks", err)
+		return
+	}
+	c.sendSuccess(w, report)
+}
+
+// getDockerNetworks decodes the network and endpoint objects of the
+// libnetwork datastore, keyed network/<id>/ and endpoint/<network>/<id>/
+func (c *Viewer) getDockerNetworks() (*DockerNetworkReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DockerNetworkReport{
+		Networks: []DockerNetwork{},
+		Other:    map[string]int{},
+		Orphaned: []DockerEndpoint{},
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dockerLibkvBucket)
+		if b == nil {
+			return fmt.Errorf("not a docker network database, bucket %q not found", dockerLibkvBucket)
+		}
+
+		networks := map[string]*DockerNetwork{}
+		endpoints := map[string][]DockerEndpoint{}
+		err := b.ForEach(func(k, v []byte) error {
+			parts := strings.Split(strings.Trim(strings.TrimPrefix(string(k), libnetworkKeyPrefix), "/"), "/")
+			index, payload, ok := splitLibkvValue(v)
+			if !ok {
+				report.Other[parts[0]]++
+				return nil
+			}
+
+			switch {
+			case parts[0] == "network" && len(parts) == 2:
+				var n struct {
+					DockerNetwork
+					NetworkType string `json:"networkType"`
+				}
+				if err := json.Unmarshal(payload, &n); err != nil {
+					return fmt.Errorf("network %s: %v", parts[1], err)
+				}
+				network := n.DockerNetwork
+				network.Driver, network.Index, network.Endpoints = n.NetworkType, index, []DockerEndpoint{}
+				networks[network.ID] = &network
+			case parts[0] == "endpoint" && len(parts) == 3:
+				var e struct {
+					DockerEndpoint
+					Iface struct {
+						Addr   string `json:"addr"`
+						AddrV6 string `json:"addrv6"`
+						MAC    string `json:"mac"`
+					} `json:"ep_iface"`
+				}
+				if err := json.Unmarshal(payload, &e); err != nil {
+					return fmt.Errorf("endpoint %s: %v", parts[2], err)
+				}
+				ep := e.DockerEndpoint
+				ep.Address, ep.AddressIPv6, ep.MAC, ep.Index = e.Iface.Addr, e.Iface.AddrV6, e.Iface.MAC, index
+				endpoints[parts[1]] = append(endpoints[parts[1]], ep)
+			default:
+				report.Other[parts[0]]++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for id, eps := range endpoints {
+			if n, ok := networks[id]; ok {
+				n.Endpoints = append(n.Endpoints, eps...)
+			} else {
+				report.Orphaned = append(report.Orphaned, eps...)
+			}
+		}
+		for _, n := range networks {
+			sort.Slice(n.Endpoints, func(i, j int) bool { return n.Endpoints[i].Name < n.Endpoints[j].Name })
+			report.Networks = append(report.Networks, *n)
+		}
+		sort.Slice(report.Networks, func(i, j int) bool { return report.Networks[i].Name < report.Networks[j].Name })
+		sort.Slice(report.Orphaned, func(i, j int) bool { return report.Orphaned[i].ID < report.Orphaned[j].ID })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// handleDockerVolumes returns the volumes of metadata.db
+func (c *Viewer) handleDockerVolumes(w http.ResponseWriter, r *http.Request) {
+	volumes, err := c.getDockerVolumes()
+	if err != nil {
+		c.sendError(w, "Failed to read docker volumes", err)
+		return
+	}
+	c.sendSuccess(w, volumes)
+}
+
+// getDockerVolumes decodes the volumes bucket, sorted by name
+func (c *Viewer) getDockerVolumes() ([]DockerVolume, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := []DockerVolume{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dockerVolumesBucket)
+		if b == nil {
+			return fmt.Errorf("not a docker volumes database, bucket %q not found", dockerVolumesBucket)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			// Field names are untagged in docker, json matches them case-insensitively
+			vol := DockerVolume{Name: string(k)}
+			if err := json.Unmarshal(v, &vol); err != nil {
+				return fmt.Errorf("volume %s: %v", k, err)
+			}
+			volumes = append(volumes, vol)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// ForEach visits keys in byte order already
+	return volumes, nil
+}
@@ -0,0 +1,95 @@
+package viewer
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// libkvValue prepends the index the way libkv's boltdb store does
+func libkvValue(index uint64, payload string) []byte {
+	v := make([]byte, libkvIndexSize, libkvIndexSize+len(payload))
+	binary.LittleEndian.PutUint64(v, index)
+	return append(v, payload...)
+}
+
+func TestDockerNetworks(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(dockerLibkvBucket)
+		if err != nil {
+			return err
+		}
+		entries := map[string][]byte{
+			"docker/network/v1.0/network/n1/":        libkvValue(3, `{"id":"n1","name":"bridge","networkType":"bridge","scope":"local","labels":{"a":"b"}}`),
+			"docker/network/v1.0/endpoint/n1/e1/":    libkvValue(5, `{"id":"e1","name":"web","sandbox":"s1","ep_iface":{"addr":"172.17.0.2/16","mac":"02:42:ac:11:00:02"}}`),
+			"docker/network/v1.0/endpoint/gone/e2/":  libkvValue(6, `{"id":"e2","name":"stale"}`),
+			"docker/network/v1.0/endpoint_count/n1/": libkvValue(4, `{"Count":1}`),
+			"docker/network/v1.0/bridge/n1/":         libkvValue(2, `{"ID":"n1"}`),
+		}
+		for k, v := range entries {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s := newTestServer(t, path)
+
+	var report DockerNetworkReport
+	s.Get("/api/docker/networks").Decode(t, &report)
+	if len(report.Networks) != 1 {
+		t.Fatalf("networks = %+v, want bridge", report.Networks)
+	}
+	n := report.Networks[0]
+	if n.Name != "bridge" || n.Driver != "bridge" || n.Index != 3 || n.Labels["a"] != "b" {
+		t.Errorf("network = %+v", n)
+	}
+	if len(n.Endpoints) != 1 || n.Endpoints[0].Address != "172.17.0.2/16" || n.Endpoints[0].Sandbox != "s1" {
+		t.Errorf("endpoints = %+v, want web at 172.17.0.2/16", n.Endpoints)
+	}
+	if len(report.Orphaned) != 1 || report.Orphaned[0].ID != "e2" {
+		t.Errorf("orphaned = %+v, want e2", report.Orphaned)
+	}
+	if report.Other["endpoint_count"] != 1 || report.Other["bridge"] != 1 {
+		t.Errorf("other = %v", report.Other)
+	}
+
+	// The generic bucket view decodes the JSON behind the index
+	var kv KeyValuePair
+	s.Get("/api/key/libnetwork/"+"docker%2Fnetwork%2Fv1.0%2Fbridge%2Fn1%2F").Decode(t, &kv)
+	if kv.ValueType != "JSON" || !strings.HasPrefix(kv.Preview, "libkv index 2\n") {
+		t.Errorf("value = %s %q, want JSON with the libkv index", kv.ValueType, kv.Preview)
+	}
+}
+
+func TestDockerVolumes(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(dockerVolumesBucket)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("data"), []byte(`{"Name":"data","Driver":"local","Labels":{"com.docker.compose.project":"app"}}`)); err != nil {
+			return err
+		}
+		return b.Put([]byte("cache"), []byte(`{"Name":"cache","Driver":"local","Options":{"type":"tmpfs"}}`))
+	})
+	s := newTestServer(t, path)
+
+	var volumes []DockerVolume
+	s.Get("/api/docker/volumes").Decode(t, &volumes)
+	if len(volumes) != 2 || volumes[0].Name != "cache" || volumes[0].Options["type"] != "tmpfs" {
+		t.Fatalf("volumes = %+v, want cache and data", volumes)
+	}
+	if volumes[1].Labels["com.docker.compose.project"] != "app" {
+		t.Errorf("labels = %v", volumes[1].Labels)
+	}
+
+	var caps Capabilities
+	s.Get("/api/capabilities").Decode(t, &caps)
+	if !caps.Features["dockerVolumes"] || caps.Features["dockerNetwork"] || caps.Features["etcd"] {
+		t.Errorf("features = %v, want dockerVolumes only", caps.Features)
+	}
+}
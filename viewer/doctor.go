@@ -0,0 +1,367 @@
+// doctor.go - rules-based health checks for containerd metadata databases
+package viewer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// doctor check statuses, ordered by severity
+const (
+	DoctorPass = "pass"
+	DoctorSkip = "skip"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+)
+
+const (
+	// maxDoctorDetails limits the details listed per check
+	maxDoctorDetails = 20
+	// leaseMaxAge leases without expiration older than this are reported
+	leaseMaxAge = 7 * 24 * time.Hour
+	// knownDBVersion newest containerd metadata db version this tool knows
+	knownDBVersion = 4
+)
+
+var bucketKeyDBVersion = []byte("version")
+
+// DoctorCheck result of a single check
+type DoctorCheck struct {
+	Name    string   `json:"name"`
+	Title   string   `json:"title"`
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// DoctorReport result of all checks
+type DoctorReport struct {
+	Database    string        `json:"database"`
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Status      string        `json:"status"`
+	Checks      []DoctorCheck `json:"checks"`
+}
+
+// doctorRule a built-in health check
+type doctorRule struct {
+	name  string
+	title string
+	run   func(tx *bolt.Tx, now time.Time) DoctorCheck
+}
+
+// doctorRules all checks in the order they are reported
+var doctorRules = []doctorRule{
+	{"integrity", "Page integrity", checkIntegrity},
+	{"schema-version", "Schema version", checkSchemaVersion},
+	{"orphaned-snapshots", "Orphaned snapshots", checkOrphanedSnapshots},
+	{"orphaned-content", "Unreferenced content", checkOrphanedContent},
+	{"stale-ingests", "Stale ingests", checkStaleIngests},
+	{"lease-hygiene", "Lease hygiene", checkLeaseHygiene},
+}
+
+// handleDoctor runs the health checks against the served database
+func (c *Viewer) handleDoctor(w http.ResponseWriter, r *http.Request) {
+	report, err := c.runDoctor(time.Now(), nil)
+	if err != nil {
+		c.sendError(w, "Failed to run health checks", err)
+		return
+	}
+
+	c.sendSuccess(w, report)
+}
+
+// runDoctor runs every rule within one read transaction; progress, if set,
+// is called after each rule and stops the checks with its error
+func (c *Viewer) runDoctor(now time.Time, progress func() error) (*DoctorReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	c.stats.checking.Lock()
+	defer c.stats.checking.Unlock()
+
+	report := &DoctorReport{
+		Database:    c.databasePath(),
+		GeneratedAt: now,
+		Status:      DoctorPass,
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, rule := range doctorRules {
+			check := rule.run(tx, now)
+			check.Name = rule.name
+			check.Title = rule.title
+			if len(check.Details) > maxDoctorDetails {
+				more := len(check.Details) - maxDoctorDetails
+				check.Details = append(check.Details[:maxDoctorDetails], fmt.Sprintf("... %d more", more))
+			}
+			if doctorSeverity(check.Status) > doctorSeverity(report.Status) {
+				report.Status = check.Status
+			}
+			report.Checks = append(report.Checks, check)
+			if progress != nil {
+				if err := progress(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return report, err
+}
+
+// doctorSeverity orders statuses, skipped checks do not degrade the result
+func doctorSeverity(status string) int {
+	switch status {
+	case DoctorWarn:
+		return 1
+	case DoctorFail:
+		return 2
+	}
+	return 0
+}
+
+// checkIntegrity verifies page consistency like `bbolt check`
+func checkIntegrity(tx *bolt.Tx, now time.Time) DoctorCheck {
+	var details []string
+	for err := range tx.Check() {
+		details = append(details, err.Error())
+	}
+
+	if len(details) > 0 {
+		return DoctorCheck{Status: DoctorFail, Message: fmt.Sprintf("%d consistency errors found", len(details)), Details: details}
+	}
+	return DoctorCheck{Status: DoctorPass, Message: "no consistency errors"}
+}
+
+// checkSchemaVersion verifies the containerd schema bucket and db version
+func checkSchemaVersion(tx *bolt.Tx, now time.Time) DoctorCheck {
+	v := readSchemaVersion(tx)
+	switch {
+	case v == nil:
+		return DoctorCheck{Status: DoctorFail, Message: fmt.Sprintf("schema bucket %q not found, not a containerd metadata database", bucketKeyVersion)}
+	case v.Migration == MigrationUnmigrated:
+		return DoctorCheck{Status: DoctorFail, Message: "db version key missing, database was never migrated"}
+	case v.Migration == MigrationInvalid:
+		return DoctorCheck{Status: DoctorFail, Message: fmt.Sprintf("invalid db version %d", v.Version)}
+	case v.Migration == MigrationNewer:
+		return DoctorCheck{Status: DoctorWarn, Message: fmt.Sprintf("db version %d is newer than the known version %d, checks may be incomplete", v.Version, knownDBVersion)}
+	}
+	return DoctorCheck{Status: DoctorPass, Message: fmt.Sprintf("schema %s, db version %d", v.Schema, v.Version)}
+}
+
+// Migration states of a containerd metadata database, see SchemaVersion
+const (
+	// MigrationCurrent the db version is the newest known one
+	MigrationCurrent = "current"
+	// MigrationPending an older db version, containerd migrates it when it
+	// next starts
+	MigrationPending = "pending"
+	// MigrationNewer written by a newer containerd than this tool knows,
+	// the usual state after a downgrade
+	MigrationNewer = "newer"
+	// MigrationUnmigrated the db version key is missing
+	MigrationUnmigrated = "unmigrated"
+	// MigrationInvalid the db version is not a positive varint
+	MigrationInvalid = "invalid"
+)
+
+// SchemaVersion the schema and db version of a containerd metadata
+// database
+type SchemaVersion struct {
+	Schema  string `json:"schema"`
+	Version int64  `json:"version"`
+	// Known the newest db version this tool knows
+	Known     int64  `json:"known"`
+	Migration string `json:"migration"`
+}
+
+// readSchemaVersion reads the db version in the schema bucket, nil if the
+// database has none
+func readSchemaVersion(tx *bolt.Tx) *SchemaVersion {
+	v1 := tx.Bucket(bucketKeyVersion)
+	if v1 == nil {
+		return nil
+	}
+
+	v := &SchemaVersion{Schema: string(bucketKeyVersion), Known: knownDBVersion}
+	if v1.Get(bucketKeyDBVersion) == nil {
+		v.Migration = MigrationUnmigrated
+		return v
+	}
+	v.Version = readVarint(v1, bucketKeyDBVersion)
+	switch {
+	case v.Version <= 0:
+		v.Migration = MigrationInvalid
+	case v.Version > knownDBVersion:
+		v.Migration = MigrationNewer
+	case v.Version < knownDBVersion:
+		v.Migration = MigrationPending
+	default:
+		v.Migration = MigrationCurrent
+	}
+	return v
+}
+
+// checkOrphanedSnapshots reports snapshots no gc root references
+func checkOrphanedSnapshots(tx *bolt.Tx, now time.Time) DoctorCheck {
+	return checkUnreachable(tx, now, gcResourceSnapshot, "snapshots")
+}
+
+// checkOrphanedContent reports content blobs no gc root references
+func checkOrphanedContent(tx *bolt.Tx, now time.Time) DoctorCheck {
+	return checkUnreachable(tx, now, gcResourceContent, "content blobs")
+}
+
+// checkUnreachable reports resources of a type that the next gc would remove
+func checkUnreachable(tx *bolt.Tx, now time.Time, resource, noun string) DoctorCheck {
+	if tx.Bucket(bucketKeyVersion) == nil {
+		return DoctorCheck{Status: DoctorSkip, Message: "not a containerd metadata database"}
+	}
+
+	var details []string
+	total := 0
+	forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+		g := buildGCGraph(ns, nsb, now)
+		reachable := g.reachable()
+		for n := range g.Nodes {
+			if n.Type != resource {
+				continue
+			}
+			total++
+			if !reachable[n] {
+				details = append(details, ns+"/"+n.Key)
+			}
+		}
+		return nil
+	})
+	sort.Strings(details)
+
+	if len(details) > 0 {
+		return DoctorCheck{
+			Status:  DoctorWarn,
+			Message: fmt.Sprintf("%d of %d %s are unreferenced and will be garbage collected", len(details), total, noun),
+			Details: details,
+		}
+	}
+	return DoctorCheck{Status: DoctorPass, Message: fmt.Sprintf("all %d %s are referenced", total, noun)}
+}
+
+// checkStaleIngests reports ingests whose expiration has passed
+func checkStaleIngests(tx *bolt.Tx, now time.Time) DoctorCheck {
+	if tx.Bucket(bucketKeyVersion) == nil {
+		return DoctorCheck{Status: DoctorSkip, Message: "not a containerd metadata database"}
+	}
+
+	var details []string
+	total := 0
+	forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+		cb := nsb.Bucket(bucketKeyObjectContent)
+		if cb == nil {
+			return nil
+		}
+		ib := cb.Bucket(bucketKeyObjectIngests)
+		if ib == nil {
+			return nil
+		}
+		return ib.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			total++
+			expireAt := readTime(ib.Bucket(k), bucketKeyExpireAt)
+			if !expireAt.IsZero() && expireAt.Before(now) {
+				details = append(details, fmt.Sprintf("%s/%s expired %s ago", ns, k, now.Sub(expireAt).Round(time.Second)))
+			}
+			return nil
+		})
+	})
+
+	if len(details) > 0 {
+		return DoctorCheck{
+			Status:  DoctorWarn,
+			Message: fmt.Sprintf("%d of %d ingests are expired, interrupted pulls left partial data", len(details), total),
+			Details: details,
+		}
+	}
+	return DoctorCheck{Status: DoctorPass, Message: fmt.Sprintf("%d active ingests", total)}
+}
+
+// checkLeaseHygiene reports expired leases and long-lived leases without expiration
+func checkLeaseHygiene(tx *bolt.Tx, now time.Time) DoctorCheck {
+	if tx.Bucket(bucketKeyVersion) == nil {
+		return DoctorCheck{Status: DoctorSkip, Message: "not a containerd metadata database"}
+	}
+
+	var details []string
+	total, expired, unbounded := 0, 0, 0
+	forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+		lb := nsb.Bucket(bucketKeyObjectLeases)
+		if lb == nil {
+			return nil
+		}
+		return lb.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			total++
+			b := lb.Bucket(k)
+			labels := readLabels(b)
+			resources := len(leaseResources(b))
+			if leaseExpired(labels, now) {
+				expired++
+				details = append(details, fmt.Sprintf("%s/%s expired at %s and still holds %d resources", ns, k, labels[labelGCExpire], resources))
+				return nil
+			}
+			if _, ok := labels[labelGCExpire]; !ok {
+				createdAt := readTime(b, bucketKeyCreatedAt)
+				if !createdAt.IsZero() && now.Sub(createdAt) > leaseMaxAge {
+					unbounded++
+					details = append(details, fmt.Sprintf("%s/%s has no expiration, created %s ago, holds %d resources", ns, k, now.Sub(createdAt).Round(time.Hour), resources))
+				}
+			}
+			return nil
+		})
+	})
+
+	if len(details) > 0 {
+		return DoctorCheck{
+			Status:  DoctorWarn,
+			Message: fmt.Sprintf("%d of %d leases are expired, %d have no expiration and are older than %s", expired, total, unbounded, leaseMaxAge),
+			Details: details,
+		}
+	}
+	return DoctorCheck{Status: DoctorPass, Message: fmt.Sprintf("%d leases look healthy", total)}
+}
+
+// printDoctorReport renders a report for terminals
+func printDoctorReport(w io.Writer, report *DoctorReport) {
+	fmt.Fprintf(w, "Database: %s\n\n", report.Database)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		fmt.Fprintf(tw, "[%s]\t%s\t%s\n", strings.ToUpper(check.Status), check.Title, check.Message)
+	}
+	tw.Flush()
+
+	for _, check := range report.Checks {
+		if len(check.Details) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", check.Title)
+		for _, d := range check.Details {
+			fmt.Fprintf(w, "  - %s\n", d)
+		}
+	}
+
+	fmt.Fprintf(w, "\nOverall: %s\n", strings.ToUpper(report.Status))
+}
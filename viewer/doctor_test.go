@@ -0,0 +1,107 @@
+package viewer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// doctorStatuses runs the doctor endpoint and returns the status per check
+func doctorStatuses(t *testing.T, path string) (string, map[string]string) {
+	t.Helper()
+
+	var report DoctorReport
+	newTestServer(t, path).Get("/api/doctor").Decode(t, &report)
+
+	statuses := map[string]string{}
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	return report.Status, statuses
+}
+
+func TestDoctorContainerd(t *testing.T) {
+	status, checks := doctorStatuses(t, boltdbtest.Containerd(t))
+
+	want := map[string]string{
+		"integrity":          DoctorPass,
+		"schema-version":     DoctorPass,
+		"orphaned-snapshots": DoctorWarn,
+		"orphaned-content":   DoctorWarn,
+		"stale-ingests":      DoctorWarn,
+		"lease-hygiene":      DoctorPass,
+	}
+	for name, s := range want {
+		if checks[name] != s {
+			t.Errorf("%s = %q, want %q", name, checks[name], s)
+		}
+	}
+	if status != DoctorWarn {
+		t.Errorf("overall = %q, want %q", status, DoctorWarn)
+	}
+}
+
+func TestDoctorNotContainerd(t *testing.T) {
+	status, checks := doctorStatuses(t, boltdbtest.Tiny(t))
+
+	if checks["schema-version"] != DoctorFail {
+		t.Errorf("schema-version = %q, want %q", checks["schema-version"], DoctorFail)
+	}
+	if checks["stale-ingests"] != DoctorSkip {
+		t.Errorf("stale-ingests = %q, want %q", checks["stale-ingests"], DoctorSkip)
+	}
+	if status != DoctorFail {
+		t.Errorf("overall = %q, want %q", status, DoctorFail)
+	}
+}
+
+func TestDoctorCorrupted(t *testing.T) {
+	_, checks := doctorStatuses(t, boltdbtest.Corrupted(t))
+
+	if checks["integrity"] != DoctorFail {
+		t.Errorf("integrity = %q, want %q", checks["integrity"], DoctorFail)
+	}
+}
+
+func TestSchemaVersionStats(t *testing.T) {
+	withVersion := func(version []byte) string {
+		return boltdbtest.New(t, func(tx *bolt.Tx) error {
+			v1, err := tx.CreateBucket(bucketKeyVersion)
+			if err != nil {
+				return err
+			}
+			if _, err := v1.CreateBucket([]byte("default")); err != nil {
+				return err
+			}
+			if version == nil {
+				return nil
+			}
+			return v1.Put(bucketKeyDBVersion, version)
+		})
+	}
+	varint := func(v int64) []byte { return binary.AppendVarint(nil, v) }
+
+	for want, path := range map[string]string{
+		MigrationCurrent:    withVersion(varint(knownDBVersion)),
+		MigrationPending:    withVersion(varint(knownDBVersion - 1)),
+		MigrationNewer:      withVersion(varint(knownDBVersion + 1)),
+		MigrationUnmigrated: withVersion(nil),
+		MigrationInvalid:    withVersion([]byte{0x80}),
+	} {
+		var stats struct {
+			Schema *SchemaVersion `json:"schema"`
+		}
+		newTestServer(t, path).Get("/api/stats").Decode(t, &stats)
+		if stats.Schema == nil || stats.Schema.Migration != want || stats.Schema.Known != knownDBVersion {
+			t.Errorf("%s: schema = %+v", want, stats.Schema)
+		}
+	}
+
+	var stats map[string]interface{}
+	newTestServer(t, boltdbtest.Tiny(t)).Get("/api/stats").Decode(t, &stats)
+	if _, ok := stats["schema"]; ok {
+		t.Errorf("schema reported for a database without one: %v", stats["schema"])
+	}
+}
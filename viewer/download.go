@@ -0,0 +1,78 @@
+// download.go - values downloaded as files for offline analysis
+package viewer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// unsafeFilenameChars characters replaced in download file names
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// downloadFilename a file name for a key with the given extension
+func downloadFilename(keyName, ext string) string {
+	name := unsafeFilenameChars.ReplaceAllString(keyName, "_")
+	if name == "" || name == "_" {
+		name = "value"
+	}
+	return name + ext
+}
+
+// valueETag a strong validator of a value in a representation: a resumed
+// download only continues if the value is unchanged, the database version
+// would change with any write
+func valueETag(value []byte, format string) string {
+	sum := sha256.Sum256(value)
+	return `"` + format + "-" + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// handleDownload serves the stored bytes of a value as a .bin file, or a
+// hex dump of them as a .hex file with format=hex; http.ServeContent answers
+// Range requests, If-Range and If-None-Match against the value's ETag
+func (c *Viewer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucketPath, err := url.QueryUnescape(vars["bucketPath"])
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+	keyName, err := url.QueryUnescape(vars["key"])
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid key name", err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "bin" && format != "hex" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid format", fmt.Errorf("format must be bin or hex"))
+		return
+	}
+
+	value, err := c.getRawValue(bucketPath, keyName)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusNotFound, "Key not found", err)
+		return
+	}
+
+	if format == "" {
+		format = "bin"
+	}
+	w.Header().Set("ETag", valueETag(value, format))
+	w.Header().Set("Cache-Control", "no-cache")
+	if format == "hex" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", downloadFilename(keyName, ".hex")))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(hexDump(value, 0))))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", downloadFilename(keyName, ".bin")))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(value))
+}
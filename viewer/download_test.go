@@ -0,0 +1,103 @@
+package viewer
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDownload(t *testing.T) {
+	value := []byte{0xde, 0xad, 0xbe, 0xef, 'h', 'i'}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("blobs"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("a/b key"), value)
+	})
+	s := newTestServer(t, path)
+
+	resp, err := http.Get(s.URL + "/api/download/blobs/a%2Fb%20key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename="a_b_key.bin"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	status, body := s.Do("GET", "/api/download/blobs/a%2Fb%20key", nil)
+	if status != http.StatusOK || !bytes.Equal(body, value) {
+		t.Errorf("bin = %d %x", status, body)
+	}
+	status, body = s.Do("GET", "/api/download/blobs/a%2Fb%20key?format=hex", nil)
+	if status != http.StatusOK || !strings.HasPrefix(string(body), "0000: de ad be ef 68 69") || !strings.Contains(string(body), "|....hi|") {
+		t.Errorf("hex = %d %q", status, body)
+	}
+
+	if status, _ := s.Do("GET", "/api/download/blobs/missing", nil); status != http.StatusNotFound {
+		t.Errorf("missing key status = %d", status)
+	}
+	if status, _ := s.Do("GET", "/api/download/blobs/a%2Fb%20key?format=pdf", nil); status != http.StatusBadRequest {
+		t.Errorf("invalid format status = %d", status)
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	value := bytes.Repeat([]byte("0123456789"), 1000)
+	s := newTestServer(t, boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("blobs"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("big"), value)
+	}), func(c *Viewer) { c.mode = ModeReadWrite })
+
+	get := func(header ...string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/api/download/blobs/big", nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get("Range", "bytes=100-109")
+	etag := resp.Header.Get("ETag")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "0123456789" ||
+		resp.Header.Get("Content-Range") != "bytes 100-109/10000" || !strings.HasPrefix(etag, `"bin-`) {
+		t.Fatalf("range: status %d, %q, Content-Range %q, ETag %q", resp.StatusCode, body, resp.Header.Get("Content-Range"), etag)
+	}
+
+	// Resuming an unchanged value continues it
+	resp = get("Range", "bytes=9990-", "If-Range", etag)
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusPartialContent || len(body) != 10 {
+		t.Errorf("resume: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+	if resp := get("If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match: status %d, want 304", resp.StatusCode)
+	}
+	if resp := get("Range", "bytes=20000-"); resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("beyond the end: status %d, want 416", resp.StatusCode)
+	}
+
+	// A changed value is sent whole
+	if r := s.API(http.MethodPut, "/api/key/blobs/big", "changed"); !r.Success {
+		t.Fatalf("PUT: %+v", r)
+	}
+	resp = get("Range", "bytes=9990-", "If-Range", etag)
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "changed" {
+		t.Errorf("resume after change: status %d, %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,232 @@
+// dump.go - one-shot dump of buckets and keys
+package viewer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// dumpPreviewWidth limits values in the tree format to one short line
+const dumpPreviewWidth = 80
+
+// DumpBucket a bucket with its keys and sub-buckets
+type DumpBucket struct {
+	Name    string       `json:"name"`
+	Path    string       `json:"path"`
+	Keys    []DumpKey    `json:"keys,omitempty"`
+	Buckets []DumpBucket `json:"buckets,omitempty"`
+}
+
+// DumpKey a key with its value and, if requested and recognized, the
+// decoded value
+type DumpKey struct {
+	KeyValuePair
+	Decoded interface{} `json:"decoded,omitempty"`
+}
+
+// dump reads all buckets and keys below bucketPath, the whole database if
+// empty; decode adds decoded values of well-known containerd keys
+func (c *Viewer) dump(bucketPath string, decode bool) ([]DumpBucket, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	bucketPath = strings.Trim(bucketPath, "/")
+	var buckets []DumpBucket
+	err = db.View(func(tx *bolt.Tx) error {
+		if bucketPath != "" {
+			b := c.findBucket(tx, bucketPath)
+			if b == nil {
+				return fmt.Errorf("bucket not found: %s", bucketPath)
+			}
+			name := bucketPath[strings.LastIndex(bucketPath, "/")+1:]
+			buckets = append(buckets, c.dumpBucket(b, name, bucketPath, decode))
+			return nil
+		}
+
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets = append(buckets, c.dumpBucket(b, string(name), string(name), decode))
+			return nil
+		})
+	})
+
+	return buckets, err
+}
+
+// dumpBucket reads a bucket recursively
+func (c *Viewer) dumpBucket(b *bolt.Bucket, name, path string, decode bool) DumpBucket {
+	out := DumpBucket{Name: name, Path: path}
+
+	var n int64
+	b.ForEach(func(k, v []byte) error {
+		n += int64(len(k) + len(v))
+		if v == nil {
+			out.Buckets = append(out.Buckets, c.dumpBucket(b.Bucket(k), string(k), path+"/"+string(k), decode))
+			return nil
+		}
+		key := DumpKey{KeyValuePair: c.parseKeyValue(k, v)}
+		if decode {
+			key.Decoded = decodeKnownValue(string(k), v)
+		}
+		out.Keys = append(out.Keys, key)
+		return nil
+	})
+	scanned(b.Tx(), n)
+
+	return out
+}
+
+// decodeKnownValue decodes values of keys containerd stores in binary form,
+// nil if the key is not recognized
+func decodeKnownValue(key string, value []byte) interface{} {
+	switch key {
+	case "createdat", "updatedat", "expireat":
+		if t, err := decodeTimeValue(value); err == nil {
+			return t["iso"]
+		}
+	case "size", "version", "inodes":
+		if n, read := binary.Varint(value); read > 0 {
+			return n
+		}
+	case "spec", "options", "extensions", "io.cri-containerd.container.metadata", "io.cri-containerd.sandbox.metadata":
+		if v, err := decodeProtobufValue(value); err == nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// printDumpTree writes buckets as an indented tree, keys with a one line value
+func printDumpTree(w io.Writer, buckets []DumpBucket, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, b := range buckets {
+		fmt.Fprintf(w, "%s%s/\n", indent, b.Name)
+		for _, k := range b.Keys {
+			fmt.Fprintf(w, "%s  %s = %s\n", indent, k.Key, dumpKeyLine(k))
+		}
+		printDumpTree(w, b.Buckets, depth+1)
+	}
+}
+
+// dumpKeyLine renders the value of a key on a single line
+func dumpKeyLine(k DumpKey) string {
+	var line string
+	switch {
+	case k.Decoded != nil:
+		line = fmt.Sprint(k.Decoded)
+	case k.IsBinary:
+		line = fmt.Sprintf("<%d bytes binary>", k.ValueSize)
+	default:
+		line = strings.Join(strings.Fields(k.Preview), " ")
+		if strings.IndexFunc(line, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+			line = strconv.Quote(line)
+		}
+	}
+
+	if len(line) > dumpPreviewWidth {
+		line = line[:dumpPreviewWidth] + "..."
+	}
+	return line
+}
+
+// Text dump formats compatible with existing tooling
+const (
+	// dumpFormatBbolt one section per bucket: its path as the arguments of
+	// "bbolt keys", then "key: value" lines with keys and values formatted
+	// like bbolt's default --format auto
+	dumpFormatBbolt = "bbolt"
+	// dumpFormatBrowser the bucket tree as boltbrowser shows it expanded
+	dumpFormatBrowser = "boltbrowser"
+)
+
+// dumpText writes the buckets and keys below bucketPath, the whole database
+// if empty, in a text format; values are read from the transaction as they
+// are written, nothing is buffered
+func (c *Viewer) dumpText(w io.Writer, bucketPath, format string) error {
+	db, err := c.openDB()
+	if err != nil {
+		return err
+	}
+
+	bucketPath = strings.Trim(bucketPath, "/")
+	return db.View(func(tx *bolt.Tx) error {
+		if bucketPath != "" {
+			b := c.findBucket(tx, bucketPath)
+			if b == nil {
+				return fmt.Errorf("bucket not found: %s", bucketPath)
+			}
+			return writeTextBucket(w, b, strings.Split(bucketPath, "/"), format)
+		}
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return writeTextBucket(w, b, []string{bboltAuto(name)}, format)
+		})
+	})
+}
+
+// writeTextBucket writes one bucket and its sub-buckets
+func writeTextBucket(w io.Writer, b *bolt.Bucket, path []string, format string) error {
+	if format == dumpFormatBrowser {
+		indent := strings.Repeat("  ", len(path)-1)
+		if _, err := fmt.Fprintf(w, "%s+ %s\n", indent, path[len(path)-1]); err != nil {
+			return err
+		}
+		var n int64
+		defer func() { scanned(b.Tx(), n) }()
+		return b.ForEach(func(k, v []byte) error {
+			n += int64(len(k) + len(v))
+			if v == nil {
+				return writeTextBucket(w, b.Bucket(k), append(path[:len(path):len(path)], bboltAuto(k)), format)
+			}
+			_, err := fmt.Fprintf(w, "%s  %s: %s\n", indent, bboltAuto(k), bboltAuto(v))
+			return err
+		})
+	}
+
+	// Keys first, then the sections of the sub-buckets, so the lines of a
+	// section are what "bbolt keys" and "bbolt get" print for it
+	if _, err := fmt.Fprintf(w, "%s\n", strings.Join(path, " ")); err != nil {
+		return err
+	}
+	var subs [][]byte
+	var n int64
+	err := b.ForEach(func(k, v []byte) error {
+		n += int64(len(k) + len(v))
+		if v == nil {
+			subs = append(subs, k)
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "%s: %s\n", bboltAuto(k), bboltAuto(v))
+		return err
+	})
+	scanned(b.Tx(), n)
+	if err != nil {
+		return err
+	}
+	for _, k := range subs {
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+		if err := writeTextBucket(w, b.Bucket(k), append(path[:len(path):len(path)], bboltAuto(k)), format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bboltAuto formats bytes like the bbolt command's --format auto: printable
+// UTF-8 as is, anything else as hex
+func bboltAuto(b []byte) string {
+	if utf8.Valid(b) && strings.IndexFunc(string(b), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return string(b)
+	}
+	return hex.EncodeToString(b)
+}
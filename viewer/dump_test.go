@@ -0,0 +1,78 @@
+package viewer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestDumpDecode(t *testing.T) {
+	viewer := newViewer(boltdbtest.Containerd(t))
+	t.Cleanup(func() { viewer.Close() })
+
+	buckets, err := viewer.dump("v1/default/containers", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || len(buckets[0].Buckets) != 1 {
+		t.Fatalf("dump = %+v, want containers/%s", buckets, boltdbtest.Container)
+	}
+
+	ctr := buckets[0].Buckets[0]
+	decoded := map[string]interface{}{}
+	for _, k := range ctr.Keys {
+		decoded[k.Key] = k.Decoded
+	}
+	if s, ok := decoded["createdat"].(string); !ok || !strings.Contains(s, "T") {
+		t.Errorf("createdat decoded = %v, want an ISO time", decoded["createdat"])
+	}
+	if decoded["image"] != nil {
+		t.Errorf("image decoded = %v, want nothing", decoded["image"])
+	}
+
+	var out bytes.Buffer
+	printDumpTree(&out, buckets, 0)
+	if !strings.Contains(out.String(), "\n  "+boltdbtest.Container+"/\n") {
+		t.Errorf("tree output misses %s:\n%s", boltdbtest.Container, out.String())
+	}
+}
+
+func TestDumpMissingBucket(t *testing.T) {
+	viewer := newViewer(boltdbtest.Tiny(t))
+	t.Cleanup(func() { viewer.Close() })
+
+	if _, err := viewer.dump("misc/missing", false); err == nil {
+		t.Error("dump of a missing bucket succeeded")
+	}
+}
+
+func TestDumpText(t *testing.T) {
+	viewer := newViewer(boltdbtest.Tiny(t))
+	t.Cleanup(func() { viewer.Close() })
+
+	var out bytes.Buffer
+	if err := viewer.dumpText(&out, "", dumpFormatBbolt); err != nil {
+		t.Fatal(err)
+	}
+	want := "misc\n" +
+		"counter: 000000000000002a\n" +
+		"json: {\"a\":1,\"b\":\"x\"}\n" +
+		"text: hello\n" +
+		"\n" +
+		"misc nested\n" +
+		"key: value\n"
+	if out.String() != want {
+		t.Errorf("bbolt dump:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := viewer.dumpText(&out, "misc", dumpFormatBrowser); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "+ misc\n  counter: 000000000000002a\n") ||
+		!strings.Contains(out.String(), "  + nested\n    key: value\n") {
+		t.Errorf("boltbrowser dump:\n%s", out.String())
+	}
+}
@@ -0,0 +1,74 @@
+// etag.go - conditional GET of read endpoints
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// dbVersion a token that changes whenever the database may have changed:
+// the last committed transaction id plus size and mtime of the file, which
+// also catch writes by another process between our transactions
+func (c *Viewer) dbVersion() (string, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return "", err
+	}
+	// The snapshot in snapshot mode
+	info, err := statFile(db.Path())
+	if err != nil {
+		return "", err
+	}
+
+	var txid int
+	if err := db.View(func(tx *bolt.Tx) error {
+		txid = tx.ID()
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%x-%x", txid, info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// versioned wraps GET handlers whose response only depends on the request
+// and the database content: they carry an ETag and answer 304 when the
+// client's If-None-Match still matches
+func (c *Viewer) versioned(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version, err := c.dbVersion()
+		if err != nil {
+			// Let the handler report the database error
+			h(w, r)
+			return
+		}
+
+		etag := `W/"` + version + `"`
+		w.Header().Set("ETag", etag)
+		// Caches must revalidate, the token is cheap to compute
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, compared
+// weakly as RFC 9110 requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
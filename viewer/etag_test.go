@@ -0,0 +1,69 @@
+package viewer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// conditionalGet sends a GET with If-None-Match and returns the status and
+// the ETag of the response
+func conditionalGet(t *testing.T, s *boltdbtest.Server, path, etag string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("ETag")
+}
+
+func TestETag(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+
+	status, etag := conditionalGet(t, s, "/api/bucket/misc", "")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("first GET: status %d etag %q, want 200 with an ETag", status, etag)
+	}
+	if status, _ := conditionalGet(t, s, "/api/bucket/misc", etag); status != http.StatusNotModified {
+		t.Errorf("unchanged GET: status %d, want 304", status)
+	}
+
+	if resp := s.API(http.MethodPut, "/api/key/misc/text", "changed"); !resp.Success {
+		t.Fatalf("write failed: %s %s", resp.Error, resp.Message)
+	}
+	status, changed := conditionalGet(t, s, "/api/bucket/misc", etag)
+	if status != http.StatusOK || changed == etag {
+		t.Errorf("GET after write: status %d etag %q, want 200 with a new ETag", status, changed)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{``, false},
+		{`W/"1-2-3"`, true},
+		{`"1-2-3"`, true},
+		{`"other", W/"1-2-3"`, true},
+		{`*`, true},
+		{`W/"1-2-4"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `W/"1-2-3"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
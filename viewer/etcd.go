@@ -0,0 +1,293 @@
+// etcd.go - etcd v3 backend databases (member/snap/db) and their MVCC keys
+package viewer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// etcd backend buckets and meta keys, see go.etcd.io/etcd/server/storage/schema
+var (
+	etcdKeyBucket  = []byte("key")
+	etcdMetaBucket = []byte("meta")
+
+	etcdMetaKeys = []string{"consistent_index", "term", "scheduledCompactRev", "finishedCompactRev"}
+)
+
+const (
+	// etcdRevisionSize bytes of a revision key: main, '_', sub
+	etcdRevisionSize = 17
+	// etcdTombstone marks the revision of a delete
+	etcdTombstone = 't'
+)
+
+// EtcdRevision the key of a revision in the key bucket
+type EtcdRevision struct {
+	Main      int64 `json:"main"`
+	Sub       int64 `json:"sub"`
+	Tombstone bool  `json:"tombstone,omitempty"`
+}
+
+func (r EtcdRevision) String() string {
+	s := fmt.Sprintf("%d_%d", r.Main, r.Sub)
+	if r.Tombstone {
+		s += " (deleted)"
+	}
+	return s
+}
+
+// EtcdKeyValue an mvccpb.KeyValue stored at a revision
+type EtcdKeyValue struct {
+	Revision       EtcdRevision `json:"revision"`
+	Key            string       `json:"key"`
+	CreateRevision int64        `json:"createRevision"`
+	ModRevision    int64        `json:"modRevision"`
+	Version        int64        `json:"version"`
+	Lease          int64        `json:"lease,omitempty"`
+	ValueType      string       `json:"valueType"`
+	ValueSize      int          `json:"valueSize"`
+	Preview        string       `json:"preview"`
+}
+
+// EtcdMeta the meta bucket and revision counts of an etcd database
+type EtcdMeta struct {
+	ConsistentIndex          uint64 `json:"consistentIndex"`
+	Term                     uint64 `json:"term"`
+	ScheduledCompactRevision int64  `json:"scheduledCompactRevision"`
+	FinishedCompactRevision  int64  `json:"finishedCompactRevision"`
+	// Revisions stored in the key bucket, CurrentRevision the newest
+	Revisions       int      `json:"revisions"`
+	CurrentRevision int64    `json:"currentRevision"`
+	Buckets         []string `json:"buckets"`
+}
+
+// isEtcd reports whether the database has the etcd backend schema
+func isEtcd(tx *bolt.Tx) bool {
+	return tx.Bucket(etcdKeyBucket) != nil && tx.Bucket(etcdMetaBucket) != nil
+}
+
+// parseEtcdRevision decodes a revision key, big-endian main and sub
+// revision separated by '_', with a trailing 't' for deletes
+func parseEtcdRevision(k []byte) (EtcdRevision, error) {
+	if len(k) < etcdRevisionSize || k[8] != '_' {
+		return EtcdRevision{}, fmt.Errorf("invalid revision key %x", k)
+	}
+	rev := EtcdRevision{
+		Main: int64(binary.BigEndian.Uint64(k[0:8])),
+		Sub:  int64(binary.BigEndian.Uint64(k[9:17])),
+	}
+	rev.Tombstone = len(k) == etcdRevisionSize+1 && k[etcdRevisionSize] == etcdTombstone
+	return rev, nil
+}
+
+// decodeEtcdKeyValue decodes an mvccpb.KeyValue without depending on etcd:
+// key = 1, create_revision = 2, mod_revision = 3, version = 4, value = 5,
+// lease = 6
+func (c *Viewer) decodeEtcdKeyValue(rev EtcdRevision, data []byte) (EtcdKeyValue, error) {
+	kv := EtcdKeyValue{Revision: rev}
+	var value []byte
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return kv, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case typ == protowire.BytesType && (num == 1 || num == 5):
+			b, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return kv, protowire.ParseError(n)
+			}
+			if num == 1 {
+				kv.Key = string(b)
+			} else {
+				value = b
+			}
+			data = data[n:]
+		case typ == protowire.VarintType && num >= 2 && num <= 6:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return kv, protowire.ParseError(n)
+			}
+			switch num {
+			case 2:
+				kv.CreateRevision = int64(v)
+			case 3:
+				kv.ModRevision = int64(v)
+			case 4:
+				kv.Version = int64(v)
+			case 6:
+				kv.Lease = int64(v)
+			}
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return kv, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+
+	parsed := c.parseKeyValue([]byte(kv.Key), value)
+	kv.ValueType, kv.ValueSize, kv.Preview = parsed.ValueType, parsed.ValueSize, parsed.Preview
+	return kv, nil
+}
+
+// handleEtcdKeys lists the keys below ?prefix=: the latest revision of every
+// live key sorted by key, or with ?history=1 every revision in order
+func (c *Viewer) handleEtcdKeys(w http.ResponseWriter, r *http.Request) {
+	after, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	keys, next, err := c.getEtcdKeys(r.URL.Query().Get("prefix"), r.URL.Query().Get("history") == "1", after, c.newResponseBudget())
+	if err != nil {
+		c.sendError(w, "Failed to read etcd keys", err)
+		return
+	}
+	c.sendPartial(w, keys, encodeCursor(next))
+}
+
+// getEtcdKeys reads the key bucket; after is the revision key (history) or
+// the key (latest) to continue from, next the first one that did not fit
+func (c *Viewer) getEtcdKeys(prefix string, history bool, after []byte, budget *responseBudget) (keys []EtcdKeyValue, next []byte, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys = []EtcdKeyValue{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(etcdKeyBucket)
+		if b == nil || !isEtcd(tx) {
+			return fmt.Errorf("not an etcd database, bucket %q not found", etcdKeyBucket)
+		}
+
+		latest := map[string]EtcdKeyValue{}
+		cur := b.Cursor()
+		k, v := cur.First()
+		if history && after != nil {
+			k, v = cur.Seek(after)
+		}
+		for ; k != nil; k, v = cur.Next() {
+			rev, err := parseEtcdRevision(k)
+			if err != nil {
+				return err
+			}
+			kv, err := c.decodeEtcdKeyValue(rev, v)
+			if err != nil {
+				return fmt.Errorf("revision %s: %v", rev, err)
+			}
+			if !strings.HasPrefix(kv.Key, prefix) {
+				continue
+			}
+			if !history {
+				// Revisions are in order, the last one of a key wins
+				latest[kv.Key] = kv
+				continue
+			}
+			if !budget.take(kv) {
+				next = append([]byte(nil), k...)
+				return nil
+			}
+			keys = append(keys, kv)
+		}
+
+		if history {
+			return nil
+		}
+		names := make([]string, 0, len(latest))
+		for name, kv := range latest {
+			if !kv.Revision.Tombstone && (after == nil || bytes.Compare([]byte(name), after) >= 0) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !budget.take(latest[name]) {
+				next = []byte(name)
+				return nil
+			}
+			keys = append(keys, latest[name])
+		}
+		return nil
+	})
+
+	return keys, next, err
+}
+
+// handleEtcdMeta returns the meta bucket of an etcd database
+func (c *Viewer) handleEtcdMeta(w http.ResponseWriter, r *http.Request) {
+	meta, err := c.getEtcdMeta()
+	if err != nil {
+		c.sendError(w, "Failed to read etcd meta", err)
+		return
+	}
+	c.sendSuccess(w, meta)
+}
+
+// getEtcdMeta reads the consistent index, term and compaction revisions
+func (c *Viewer) getEtcdMeta() (*EtcdMeta, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &EtcdMeta{Buckets: []string{}}
+	err = db.View(func(tx *bolt.Tx) error {
+		if !isEtcd(tx) {
+			return fmt.Errorf("not an etcd database, buckets %q and %q not found", etcdKeyBucket, etcdMetaBucket)
+		}
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			meta.Buckets = append(meta.Buckets, string(name))
+			return nil
+		})
+
+		mb := tx.Bucket(etcdMetaBucket)
+		for _, name := range etcdMetaKeys {
+			v := mb.Get([]byte(name))
+			if len(v) < 8 {
+				continue
+			}
+			switch name {
+			case "consistent_index":
+				meta.ConsistentIndex = binary.BigEndian.Uint64(v)
+			case "term":
+				meta.Term = binary.BigEndian.Uint64(v)
+			case "scheduledCompactRev", "finishedCompactRev":
+				// Stored as a revision key
+				if rev, err := parseEtcdRevision(v); err == nil {
+					if name == "scheduledCompactRev" {
+						meta.ScheduledCompactRevision = rev.Main
+					} else {
+						meta.FinishedCompactRevision = rev.Main
+					}
+				}
+			}
+		}
+
+		kb := tx.Bucket(etcdKeyBucket)
+		meta.Revisions = kb.Stats().KeyN
+		if k, _ := kb.Cursor().Last(); k != nil {
+			if rev, err := parseEtcdRevision(k); err == nil {
+				meta.CurrentRevision = rev.Main
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
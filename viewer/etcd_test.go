@@ -0,0 +1,141 @@
+package viewer
+
+import (
+	"encoding/binary"
+	"net/http"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// etcdRevisionKey encodes a revision the way etcd's mvcc package does
+func etcdRevisionKey(main, sub int64, tombstone bool) []byte {
+	k := make([]byte, etcdRevisionSize, etcdRevisionSize+1)
+	binary.BigEndian.PutUint64(k[0:8], uint64(main))
+	k[8] = '_'
+	binary.BigEndian.PutUint64(k[9:17], uint64(sub))
+	if tombstone {
+		k = append(k, etcdTombstone)
+	}
+	return k
+}
+
+// etcdKeyValue encodes an mvccpb.KeyValue
+func etcdKeyValue(key, value string, create, mod, version int64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, key)
+	for num, v := range map[protowire.Number]int64{2: create, 3: mod, 4: version} {
+		if v != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		}
+	}
+	if value != "" {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, value)
+	}
+	return b
+}
+
+func etcdFixture(t *testing.T) string {
+	return boltdbtest.New(t, func(tx *bolt.Tx) error {
+		kb, err := tx.CreateBucket(etcdKeyBucket)
+		if err != nil {
+			return err
+		}
+		mb, err := tx.CreateBucket(etcdMetaBucket)
+		if err != nil {
+			return err
+		}
+		revisions := []struct {
+			key   []byte
+			value []byte
+		}{
+			{etcdRevisionKey(2, 0, false), etcdKeyValue("/registry/pods/a", `{"v":1}`, 2, 2, 1)},
+			{etcdRevisionKey(3, 0, false), etcdKeyValue("/registry/pods/b", "b", 3, 3, 1)},
+			{etcdRevisionKey(4, 0, false), etcdKeyValue("/registry/pods/a", `{"v":2}`, 2, 4, 2)},
+			{etcdRevisionKey(5, 0, true), etcdKeyValue("/registry/pods/b", "", 0, 0, 0)},
+			{etcdRevisionKey(6, 0, false), etcdKeyValue("/registry/services/c", "c", 6, 6, 1)},
+		}
+		for _, r := range revisions {
+			if err := kb.Put(r.key, r.value); err != nil {
+				return err
+			}
+		}
+
+		index := make([]byte, 8)
+		binary.BigEndian.PutUint64(index, 42)
+		if err := mb.Put([]byte("consistent_index"), index); err != nil {
+			return err
+		}
+		return mb.Put([]byte("finishedCompactRev"), etcdRevisionKey(3, 0, false))
+	})
+}
+
+func TestEtcdKeysLatest(t *testing.T) {
+	s := newTestServer(t, etcdFixture(t))
+
+	var keys []EtcdKeyValue
+	s.Get("/api/etcd/keys?prefix=/registry/pods/").Decode(t, &keys)
+	if len(keys) != 1 {
+		t.Fatalf("keys = %+v, want only /registry/pods/a", keys)
+	}
+	a := keys[0]
+	if a.Key != "/registry/pods/a" || a.ModRevision != 4 || a.CreateRevision != 2 || a.Version != 2 {
+		t.Errorf("key = %+v, want the revision 4 of /registry/pods/a", a)
+	}
+	if a.ValueType != "JSON" || a.ValueSize != 7 {
+		t.Errorf("value = %s of %d bytes, want JSON of 7", a.ValueType, a.ValueSize)
+	}
+
+	s.Get("/api/etcd/keys").Decode(t, &keys)
+	if len(keys) != 2 || keys[1].Key != "/registry/services/c" {
+		t.Errorf("keys = %+v, want pods/a and services/c", keys)
+	}
+}
+
+func TestEtcdKeysHistory(t *testing.T) {
+	s := newTestServer(t, etcdFixture(t), func(c *Viewer) {
+		c.maxResponseBytes = 400
+	})
+
+	var all []EtcdKeyValue
+	cursor, pages := "", 0
+	for pages = 1; ; pages++ {
+		resp := s.Get("/api/etcd/keys?history=1&cursor=" + cursor)
+		var keys []EtcdKeyValue
+		resp.Decode(t, &keys)
+		all = append(all, keys...)
+		if !resp.Partial {
+			break
+		}
+		cursor = resp.Cursor
+	}
+	if len(all) != 5 || pages < 2 {
+		t.Fatalf("revisions = %d in %d pages, want 5 in several", len(all), pages)
+	}
+	if deleted := all[3]; !deleted.Revision.Tombstone || deleted.Key != "/registry/pods/b" {
+		t.Errorf("revision 5 = %+v, want the delete of /registry/pods/b", deleted)
+	}
+}
+
+func TestEtcdMeta(t *testing.T) {
+	s := newTestServer(t, etcdFixture(t))
+
+	var meta EtcdMeta
+	s.Get("/api/etcd/meta").Decode(t, &meta)
+	if meta.ConsistentIndex != 42 || meta.FinishedCompactRevision != 3 {
+		t.Errorf("meta = %+v, want consistent index 42 and compacted at 3", meta)
+	}
+	if meta.Revisions != 5 || meta.CurrentRevision != 6 {
+		t.Errorf("revisions = %d current %d, want 5 and 6", meta.Revisions, meta.CurrentRevision)
+	}
+
+	s = newTestServer(t, boltdbtest.Tiny(t))
+	if resp := s.API(http.MethodGet, "/api/etcd/meta", ""); resp.Success {
+		t.Error("meta of a non-etcd database succeeded")
+	}
+}
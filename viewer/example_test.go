@@ -0,0 +1,23 @@
+package viewer_test
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/hysyeah/boltdbui/viewer"
+)
+
+// Mount the viewer in an existing server below /debug/boltdb/
+func ExampleViewer_Handler() {
+	v, err := viewer.NewViewer(viewer.Options{
+		DBPath: "/var/lib/containerd/io.containerd.metadata.v1.bolt/meta.db",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer v.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/boltdb/", http.StripPrefix("/debug/boltdb", v.Handler()))
+	log.Fatal(http.ListenAndServe(":8080", mux))
+}
@@ -0,0 +1,91 @@
+// export.go - the whole keyspace streamed as NDJSON
+package viewer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ExportRecord one line of /api/export/ndjson; keys and values are base64
+// so binary data survives, []byte marshals as standard base64
+type ExportRecord struct {
+	// Path the bucket holding the key
+	Path  string `json:"path"`
+	Key   []byte `json:"key_b64"`
+	Value []byte `json:"value_b64"`
+	Size  int    `json:"size"`
+	Type  string `json:"type"`
+}
+
+// handleExportNDJSON streams one ExportRecord per key of every bucket, or
+// of the bucket in ?path= and its sub-buckets, as the cursors visit them
+func (c *Viewer) handleExportNDJSON(w http.ResponseWriter, r *http.Request) {
+	path, err := scopedPathParam(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		c.sendError(w, "Failed to open database", err)
+		return
+	}
+	var keys int
+	err = db.View(func(tx *bolt.Tx) error {
+		var b *bolt.Bucket
+		if path = strings.Trim(path, "/"); path != "" {
+			if b = c.findBucket(tx, path); b == nil {
+				return fmt.Errorf("bucket not found: %s", path)
+			}
+		}
+
+		// Nothing is written before the bucket is known, errors above are
+		// still reported as JSON
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		out := bufio.NewWriterSize(w, streamFlushBytes)
+		enc := json.NewEncoder(out)
+		var werr error
+		if b != nil {
+			werr = exportBucket(enc, b, path, &keys)
+		} else {
+			werr = tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				return exportBucket(enc, b, string(name), &keys)
+			})
+		}
+		if werr == nil {
+			werr = out.Flush()
+		}
+		if werr != nil {
+			// The client went away, nothing left to report to
+			slog.Warn("Stopped export", "keys", keys, "error", werr)
+		}
+		return nil
+	})
+	if err != nil {
+		c.sendError(w, "Failed to export", err)
+		return
+	}
+	slog.Info("Exported keys", "keys", keys)
+}
+
+// exportBucket writes the keys of a bucket in key order, those of a
+// sub-bucket where its name sorts; json.Encoder ends each record with "\n"
+func exportBucket(enc *json.Encoder, b *bolt.Bucket, path string, keys *int) error {
+	var n int64
+	defer func() { scanned(b.Tx(), n) }()
+	return b.ForEach(func(k, v []byte) error {
+		n += int64(len(k) + len(v))
+		if v == nil {
+			return exportBucket(enc, b.Bucket(k), path+"/"+string(k), keys)
+		}
+		*keys++
+		return enc.Encode(ExportRecord{Path: path, Key: k, Value: v, Size: len(v), Type: detectValueType(v)})
+	})
+}
@@ -0,0 +1,46 @@
+package viewer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestExportNDJSON(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	status, body := s.Do(http.MethodGet, "/api/export/ndjson", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	var records []ExportRecord
+	lines := bufio.NewScanner(bytes.NewReader(body))
+	for lines.Scan() {
+		var rec ExportRecord
+		if err := json.Unmarshal(lines.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", lines.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 4 {
+		t.Fatalf("records = %+v, want 4", records)
+	}
+	counter := records[0]
+	if counter.Path != "misc" || string(counter.Key) != "counter" || counter.Size != 8 || counter.Value[7] != 42 || counter.Type != "Binary" {
+		t.Errorf("first record = %+v, want misc/counter", counter)
+	}
+	if nested := records[2]; nested.Path != "misc/nested" || string(nested.Value) != "value" {
+		t.Errorf("third record = %+v, want misc/nested/key", nested)
+	}
+	if !bytes.Contains(body, []byte(`"key_b64":"Y291bnRlcg=="`)) {
+		t.Errorf("keys are not base64 encoded: %s", body)
+	}
+
+	if status, _ := s.Do(http.MethodGet, "/api/export/ndjson?path=misc/missing", nil); status != http.StatusInternalServerError {
+		t.Errorf("missing bucket status = %d, want 500", status)
+	}
+}
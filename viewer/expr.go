@@ -0,0 +1,570 @@
+// expr.go - jq-style path expressions evaluated on decoded values, so a field
+// of many values is extracted server-side, see ?expr=
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxExprLength longer expressions are rejected
+const maxExprLength = 1024
+
+// maxExprResults values an expression may yield for one value, ".." on a
+// large document yields every node
+const maxExprResults = 10000
+
+// exprStepKind what a path step does with its input
+type exprStepKind int
+
+const (
+	stepField   exprStepKind = iota // .name, ."name", ["name"]
+	stepIndex                       // [0], [-1]
+	stepIterate                     // [], [*], .*
+	stepRecurse                     // .., the input and all values below it
+)
+
+// exprStep one step of a path
+type exprStep struct {
+	kind  exprStepKind
+	name  string
+	index int
+	// optional the ? suffix: errors yield nothing instead
+	optional bool
+	// descendant a field following .., which skips values without it like
+	// JSONPath's $..name
+	descendant bool
+}
+
+// exprStage one stage of a pipeline, a path or a builtin
+type exprStage struct {
+	steps   []exprStep
+	builtin string // keys, length or type
+}
+
+// valueExpr a compiled expression: paths in jq syntax (.spec.linux, .a[0],
+// .a[], ."odd key", ..), their JSONPath equivalents ($.spec.linux, $.a[*],
+// $['odd key'], $..name) and the builtins keys, length and type, joined by |
+type valueExpr struct {
+	stages []exprStage
+}
+
+// exprBuiltins the functions a stage may name
+var exprBuiltins = map[string]bool{"keys": true, "length": true, "type": true}
+
+// compileExpr parses an expression
+func compileExpr(src string) (*valueExpr, error) {
+	if len(src) > maxExprLength {
+		return nil, fmt.Errorf("expression longer than %d bytes", maxExprLength)
+	}
+	expr := &valueExpr{}
+	for _, part := range splitPipeline(src) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty stage in %q", src)
+		}
+		if exprBuiltins[part] {
+			expr.stages = append(expr.stages, exprStage{builtin: part})
+			continue
+		}
+		steps, err := parsePath(part)
+		if err != nil {
+			return nil, err
+		}
+		expr.stages = append(expr.stages, exprStage{steps: steps})
+	}
+	return expr, nil
+}
+
+// splitPipeline splits at the | outside quotes
+func splitPipeline(src string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(src); i++ {
+		switch ch := src[i]; {
+		case quote != 0 && ch == '\\':
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '|':
+			parts = append(parts, src[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, src[start:])
+}
+
+// parsePath parses the steps of one path
+func parsePath(src string) ([]exprStep, error) {
+	var steps []exprStep
+	pos := 0
+	switch {
+	case strings.HasPrefix(src, "$"):
+		pos = 1
+	case !strings.HasPrefix(src, "."):
+		return nil, fmt.Errorf("path %q must start with . or $", src)
+	}
+
+	for pos < len(src) {
+		switch {
+		case strings.HasPrefix(src[pos:], ".."):
+			steps = append(steps, exprStep{kind: stepRecurse})
+			pos += 2
+			// $..name and ..name: the field of every value below
+			if pos < len(src) && isIdentStart(src[pos]) {
+				name, n := scanIdent(src[pos:])
+				steps = append(steps, exprStep{kind: stepField, name: name, descendant: true})
+				pos += n
+			}
+		case src[pos] == '.':
+			pos++
+			switch {
+			case pos == len(src) || src[pos] == '[':
+				// . alone, or .[...]
+			case src[pos] == '*':
+				steps = append(steps, exprStep{kind: stepIterate})
+				pos++
+			case src[pos] == '"':
+				name, n, err := scanQuoted(src[pos:])
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, exprStep{kind: stepField, name: name})
+				pos += n
+			case isIdentStart(src[pos]):
+				name, n := scanIdent(src[pos:])
+				steps = append(steps, exprStep{kind: stepField, name: name})
+				pos += n
+			default:
+				return nil, fmt.Errorf("unexpected %q at %d of %q", src[pos], pos, src)
+			}
+		case src[pos] == '[':
+			step, n, err := parseBracket(src[pos:])
+			if err != nil {
+				return nil, fmt.Errorf("%v in %q", err, src)
+			}
+			steps = append(steps, step)
+			pos += n
+		case src[pos] == '?':
+			if len(steps) == 0 {
+				return nil, fmt.Errorf("? without a step in %q", src)
+			}
+			steps[len(steps)-1].optional = true
+			pos++
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d of %q", src[pos], pos, src)
+		}
+	}
+	return steps, nil
+}
+
+// parseBracket parses [], [*], [n] and ["name"] or ['name'], returning the
+// bytes consumed
+func parseBracket(src string) (exprStep, int, error) {
+	end := strings.IndexByte(src, ']')
+	if end < 0 {
+		return exprStep{}, 0, errors.New("unterminated [")
+	}
+	inner := strings.TrimSpace(src[1:end])
+	switch {
+	case inner == "" || inner == "*":
+		return exprStep{kind: stepIterate}, end + 1, nil
+	case inner[0] == '"' || inner[0] == '\'':
+		// The name may contain ], parse the quotes first
+		open := strings.IndexByte(src, inner[0])
+		name, n, err := scanQuoted(src[open:])
+		if err != nil {
+			return exprStep{}, 0, err
+		}
+		rest := strings.TrimLeft(src[open+n:], " ")
+		if !strings.HasPrefix(rest, "]") {
+			return exprStep{}, 0, errors.New("expected ] after the name")
+		}
+		return exprStep{kind: stepField, name: name}, len(src) - len(rest) + 1, nil
+	}
+	i, err := strconv.Atoi(inner)
+	if err != nil {
+		return exprStep{}, 0, fmt.Errorf("invalid index %q", inner)
+	}
+	return exprStep{kind: stepIndex, index: i}, end + 1, nil
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+// scanIdent returns the field name at the start of src; - is allowed like in
+// JSONPath, label keys often contain it
+func scanIdent(src string) (string, int) {
+	n := 0
+	for n < len(src) && (isIdentStart(src[n]) || src[n] == '-' || src[n] >= '0' && src[n] <= '9') {
+		n++
+	}
+	return src[:n], n
+}
+
+// scanQuoted returns the string quoted with " or ' at the start of src
+func scanQuoted(src string) (string, int, error) {
+	quote := src[0]
+	var sb strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch ch := src[i]; {
+		case ch == quote:
+			return sb.String(), i + 1, nil
+		case ch == '\\' && i+1 < len(src):
+			i++
+			sb.WriteByte(src[i])
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string in %q", src)
+}
+
+// eval applies the expression to v, returning the values it yields
+func (e *valueExpr) eval(v interface{}) ([]interface{}, error) {
+	values := []interface{}{v}
+	for _, stage := range e.stages {
+		var next []interface{}
+		for _, in := range values {
+			var out []interface{}
+			var err error
+			if stage.builtin != "" {
+				var result interface{}
+				result, err = evalBuiltin(stage.builtin, in)
+				out = []interface{}{result}
+			} else {
+				out, err = evalSteps(stage.steps, in)
+			}
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+			if len(next) > maxExprResults {
+				return nil, fmt.Errorf("expression yields more than %d values", maxExprResults)
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// evalSteps applies the steps of a path in turn
+func evalSteps(steps []exprStep, v interface{}) ([]interface{}, error) {
+	values := []interface{}{v}
+	for _, step := range steps {
+		var next []interface{}
+		for _, in := range values {
+			out, err := evalStep(step, in)
+			if err != nil {
+				if step.optional {
+					continue
+				}
+				return nil, err
+			}
+			next = append(next, out...)
+			if len(next) > maxExprResults {
+				return nil, fmt.Errorf("expression yields more than %d values", maxExprResults)
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// evalStep applies one step to v; like jq, missing fields and indexes
+// yield null
+func evalStep(step exprStep, v interface{}) ([]interface{}, error) {
+	switch step.kind {
+	case stepField:
+		switch t := v.(type) {
+		case map[string]interface{}:
+			field, ok := t[step.name]
+			if !ok && step.descendant {
+				return nil, nil
+			}
+			return []interface{}{field}, nil
+		case nil:
+			if step.descendant {
+				return nil, nil
+			}
+			return []interface{}{nil}, nil
+		}
+		if step.descendant {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with %q", jsonTypeName(v), step.name)
+	case stepIndex:
+		switch t := v.(type) {
+		case []interface{}:
+			i := step.index
+			if i < 0 {
+				i += len(t)
+			}
+			if i < 0 || i >= len(t) {
+				return []interface{}{nil}, nil
+			}
+			return []interface{}{t[i]}, nil
+		case nil:
+			return []interface{}{nil}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with %d", jsonTypeName(v), step.index)
+	case stepIterate:
+		switch t := v.(type) {
+		case []interface{}:
+			return t, nil
+		case map[string]interface{}:
+			out := make([]interface{}, 0, len(t))
+			for _, k := range sortedKeys(t) {
+				out = append(out, t[k])
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("cannot iterate over %s", jsonTypeName(v))
+	case stepRecurse:
+		var out []interface{}
+		var walk func(v interface{})
+		walk = func(v interface{}) {
+			out = append(out, v)
+			switch t := v.(type) {
+			case []interface{}:
+				for _, e := range t {
+					walk(e)
+				}
+			case map[string]interface{}:
+				for _, k := range sortedKeys(t) {
+					walk(t[k])
+				}
+			}
+		}
+		walk(v)
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown step %d", step.kind)
+}
+
+// evalBuiltin applies keys, length or type to v
+func evalBuiltin(name string, v interface{}) (interface{}, error) {
+	switch name {
+	case "type":
+		return jsonTypeName(v), nil
+	case "keys":
+		switch t := v.(type) {
+		case map[string]interface{}:
+			keys := sortedKeys(t)
+			out := make([]interface{}, len(keys))
+			for i, k := range keys {
+				out[i] = k
+			}
+			return out, nil
+		case []interface{}:
+			out := make([]interface{}, len(t))
+			for i := range t {
+				out[i] = i
+			}
+			return out, nil
+		}
+	case "length":
+		switch t := v.(type) {
+		case nil:
+			return 0, nil
+		case map[string]interface{}:
+			return len(t), nil
+		case []interface{}:
+			return len(t), nil
+		case string:
+			return utf8.RuneCountInString(t), nil
+		case json.Number:
+			return json.Number(strings.TrimPrefix(t.String(), "-")), nil
+		case float64:
+			if t < 0 {
+				return -t, nil
+			}
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no %s", jsonTypeName(v), name)
+}
+
+// jsonTypeName the jq type of a decoded JSON value
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64, int, int64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// exprInput the value an expression is applied to: the JSON document of a
+// JSON value, or values containerd stores in binary form decoded like in
+// dumps, e.g. a container's spec
+func exprInput(key string, value []byte) (interface{}, error) {
+	if _, data, err := decompressValue(value); err == nil && data != nil {
+		value = data
+	}
+	if json.Valid(value) {
+		dec := json.NewDecoder(bytes.NewReader(value))
+		// Sizes and timestamps beyond 2^53 keep their digits
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err == nil {
+			return v, nil
+		}
+	}
+	if v := decodeKnownValue(key, value); v != nil {
+		// Round trip to the types of decoded JSON
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+	return nil, errors.New("value is neither JSON nor a known containerd encoding")
+}
+
+// ExprResult the values an expression yielded for one key
+type ExprResult struct {
+	// Bucket set when the results are of the keys of sub-buckets
+	Bucket  string        `json:"bucket,omitempty"`
+	Key     string        `json:"key"`
+	Results []interface{} `json:"results"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// evalKey applies expr to the value of key
+func evalKey(expr *valueExpr, bucket, key string, value []byte) ExprResult {
+	result := ExprResult{Bucket: bucket, Key: key, Results: []interface{}{}}
+	input, err := exprInput(key, value)
+	if err == nil {
+		var values []interface{}
+		if values, err = expr.eval(input); err == nil {
+			result.Results = values
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// parseExpr returns the compiled ?expr= of a request, nil if absent
+func parseExpr(r *http.Request) (*valueExpr, error) {
+	src := r.URL.Query().Get("expr")
+	if src == "" {
+		return nil, nil
+	}
+	return compileExpr(src)
+}
+
+// sendKeyExpr applies expr to one key
+func (c *Viewer) sendKeyExpr(w http.ResponseWriter, expr *valueExpr, bucketPath, keyName string) {
+	value, err := c.getRawValue(bucketPath, keyName)
+	if err != nil {
+		c.sendError(w, "Failed to get key details", err)
+		return
+	}
+	result := evalKey(expr, "", keyName, value)
+	if result.Error != "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Expression failed", errors.New(result.Error))
+		return
+	}
+	c.sendSuccess(w, result)
+}
+
+// sendBucketExpr applies expr to the values of a bucket in key order, or
+// with subKey to the value of subKey in each of its sub-buckets, e.g. the
+// spec of every container; from continues a partial response
+func (c *Viewer) sendBucketExpr(w http.ResponseWriter, expr *valueExpr, bucketPath, subKey string, from []byte) {
+	db, err := c.openDB()
+	if err != nil {
+		c.sendError(w, "Failed to get bucket details", err)
+		return
+	}
+
+	budget := c.newResponseBudget()
+	results := []ExprResult{}
+	var next []byte
+	err = db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		cur := b.Cursor()
+		k, v := cur.First()
+		if from != nil {
+			k, v = cur.Seek(from)
+		}
+		var n int64
+		for ; k != nil; k, v = cur.Next() {
+			n += int64(len(k) + len(v))
+			var result ExprResult
+			switch {
+			case subKey == "" && v != nil:
+				result = evalKey(expr, "", string(k), v)
+			case subKey != "" && v == nil:
+				sub := b.Bucket(k)
+				value := sub.Get([]byte(subKey))
+				if value == nil {
+					continue
+				}
+				n += int64(len(value))
+				result = evalKey(expr, bucketPath+"/"+string(k), subKey, value)
+			default:
+				continue
+			}
+			if !budget.take(result) {
+				next = append([]byte(nil), k...)
+				break
+			}
+			results = append(results, result)
+		}
+		scanned(tx, n)
+		return nil
+	})
+	if err != nil {
+		c.sendError(w, "Failed to get bucket details", err)
+		return
+	}
+	if next != nil {
+		c.sendPartial(w, results, encodeCursor(next))
+		return
+	}
+	c.sendSuccess(w, results)
+}
@@ -0,0 +1,117 @@
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestValueExpr(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"Spec":{"Linux":{"CgroupsPath":"/kubepods/a"}},"labels":{"app.kubernetes.io/name":"web","tier":"front"},
+		"mounts":[{"destination":"/proc"},{"destination":"/sys"}],"name":"ctr"}`), &doc)
+
+	for _, tc := range []struct {
+		expr string
+		want interface{}
+	}{
+		{".", []interface{}{doc}},
+		{".Spec.Linux.CgroupsPath", []interface{}{"/kubepods/a"}},
+		{"$.Spec.Linux.CgroupsPath", []interface{}{"/kubepods/a"}},
+		{".missing.field", []interface{}{nil}},
+		{`.labels."app.kubernetes.io/name"`, []interface{}{"web"}},
+		{`$['labels']['app.kubernetes.io/name']`, []interface{}{"web"}},
+		{".mounts[1].destination", []interface{}{"/sys"}},
+		{".mounts[-1].destination", []interface{}{"/sys"}},
+		{".mounts[].destination", []interface{}{"/proc", "/sys"}},
+		{"$.mounts[*].destination", []interface{}{"/proc", "/sys"}},
+		{"$..destination", []interface{}{"/proc", "/sys"}},
+		{".labels | keys", []interface{}{[]interface{}{"app.kubernetes.io/name", "tier"}}},
+		{".mounts | length", []interface{}{2}},
+		{".labels.* | type", []interface{}{"string", "string"}},
+		{".name.first?", []interface{}(nil)},
+	} {
+		expr, err := compileExpr(tc.expr)
+		if err != nil {
+			t.Errorf("compile %s: %v", tc.expr, err)
+			continue
+		}
+		got, err := expr.eval(doc)
+		if err != nil {
+			t.Errorf("eval %s: %v", tc.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s = %#v, want %#v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, src := range []string{"name", ".a[", ".a[x]", ".a | | keys", `.a."b`} {
+		if _, err := compileExpr(src); err == nil {
+			t.Errorf("compile %q: want an error", src)
+		}
+	}
+	expr, _ := compileExpr(".name.first")
+	if _, err := expr.eval(doc); err == nil {
+		t.Error("indexing a string: want an error")
+	}
+}
+
+func TestExprEndpoints(t *testing.T) {
+	spec, err := proto.Marshal(&anypb.Any{TypeUrl: runtimeSpecTypeURL, Value: []byte(`{"ociVersion":"1.1.0","linux":{"cgroupsPath":"k8s.slice:cri:ctr1"}}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		containers, err := tx.CreateBucket([]byte("containers"))
+		if err != nil {
+			return err
+		}
+		for i := 1; i <= 3; i++ {
+			ctr, err := containers.CreateBucket([]byte(fmt.Sprintf("ctr%d", i)))
+			if err != nil {
+				return err
+			}
+			ctr.Put([]byte("image"), []byte("docker.io/library/nginx:latest"))
+			if i < 3 {
+				ctr.Put([]byte("spec"), spec)
+			}
+		}
+		return containers.Put([]byte("config"), []byte(`{"size":12345678901234567890,"tags":["a","b"]}`))
+	})
+	s := newTestServer(t, path)
+
+	// Integers beyond 2^53 keep their digits
+	status, body := s.Do(http.MethodGet, "/api/key/containers/config?expr="+url.QueryEscape(".size"), nil)
+	if status != http.StatusOK || !strings.Contains(string(body), `"results":[12345678901234567890]`) {
+		t.Errorf("size: status %d, body %s", status, body)
+	}
+
+	var results []ExprResult
+	s.Get("/api/bucket/containers?key=spec&expr="+url.QueryEscape(".spec.linux.cgroupsPath")).Decode(t, &results)
+	if len(results) != 2 || results[0].Bucket != "containers/ctr1" || results[1].Results[0] != "k8s.slice:cri:ctr1" {
+		t.Errorf("cgroup paths = %+v, want those of ctr1 and ctr2", results)
+	}
+
+	s.Get("/api/bucket/containers?expr="+url.QueryEscape(".tags[]")).Decode(t, &results)
+	if len(results) != 1 || results[0].Key != "config" || len(results[0].Results) != 2 {
+		t.Errorf("tags = %+v", results)
+	}
+
+	s.Get("/api/bucket/containers/ctr1?expr="+url.QueryEscape(".linux")).Decode(t, &results)
+	if len(results) != 2 || results[0].Key != "image" || results[0].Error == "" || results[1].Error != "" {
+		t.Errorf("image is not JSON, spec is: %+v", results)
+	}
+	if r := s.API(http.MethodGet, "/api/key/containers/config?expr="+url.QueryEscape("size"), ""); r.Status != http.StatusBadRequest {
+		t.Errorf("invalid expression: status %d, want 400", r.Status)
+	}
+}
@@ -0,0 +1,510 @@
+// gob.go - encoding/gob streams decoded without the Go types that wrote them
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// gob's predefined type ids, see encoding/gob/type.go
+const (
+	gobBool      = 1
+	gobInt       = 2
+	gobUint      = 3
+	gobFloat     = 4
+	gobBytes     = 5
+	gobString    = 6
+	gobComplex   = 7
+	gobInterface = 8
+	// gobFirstUserID first id of types defined in a stream
+	gobFirstUserID = 64
+)
+
+// gobBuiltinNames names of the predefined types
+var gobBuiltinNames = map[int]string{
+	gobBool: "bool", gobInt: "int", gobUint: "uint", gobFloat: "float",
+	gobBytes: "[]byte", gobString: "string", gobComplex: "complex", gobInterface: "interface",
+}
+
+var errGobShort = errors.New("unexpected end of gob data")
+
+// GobType a type defined in a gob stream
+type GobType struct {
+	ID     int        `json:"id"`
+	Name   string     `json:"name"`
+	Kind   string     `json:"kind"` // struct, slice, array, map, GobEncoder, BinaryMarshaler, TextMarshaler
+	Elem   string     `json:"elem,omitempty"`
+	Key    string     `json:"key,omitempty"`
+	Len    int        `json:"len,omitempty"`
+	Fields []GobField `json:"fields,omitempty"`
+
+	elem, key int
+}
+
+// GobField a field of a struct type
+type GobField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	id   int
+}
+
+// GobValue a top-level value of a gob stream
+type GobValue struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// gobDecoder state of a stream: the messages left and the types defined
+// so far
+type gobDecoder struct {
+	stream gobReader
+	types  map[int]*GobType
+	order  []int
+}
+
+// gobReader reads gob's integer encodings from a message
+type gobReader struct {
+	data []byte
+}
+
+func (r *gobReader) uint() (uint64, error) {
+	if len(r.data) == 0 {
+		return 0, errGobShort
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	if b < 0x80 {
+		return uint64(b), nil
+	}
+	// A negated byte count of the big-endian value follows
+	n := int(-int8(b))
+	if n > 8 || n > len(r.data) {
+		return 0, fmt.Errorf("invalid gob uint of %d bytes", n)
+	}
+	var v uint64
+	for _, c := range r.data[:n] {
+		v = v<<8 | uint64(c)
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+func (r *gobReader) int() (int64, error) {
+	u, err := r.uint()
+	if err != nil {
+		return 0, err
+	}
+	if u&1 != 0 {
+		return ^int64(u >> 1), nil
+	}
+	return int64(u >> 1), nil
+}
+
+func (r *gobReader) float() (float64, error) {
+	u, err := r.uint()
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(bits.ReverseBytes64(u)), nil
+}
+
+func (r *gobReader) bytes() ([]byte, error) {
+	n, err := r.uint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)) {
+		return nil, errGobShort
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+func (r *gobReader) string() (string, error) {
+	b, err := r.bytes()
+	return string(b), err
+}
+
+// count reads a length, bounded by the bytes left since every element
+// takes at least one
+func (r *gobReader) count() (int, error) {
+	n, err := r.uint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(r.data)) {
+		return 0, fmt.Errorf("gob length %d exceeds the %d bytes left", n, len(r.data))
+	}
+	return int(n), nil
+}
+
+// isGob reports whether value is a gob stream starting with a type
+// definition, as every stream of a user defined type does
+func isGob(value []byte) bool {
+	r := &gobReader{data: value}
+	if n, err := r.uint(); err != nil || n == 0 || n > uint64(len(r.data)) {
+		return false
+	}
+	if id, err := r.int(); err != nil || id > -gobFirstUserID {
+		return false
+	}
+	_, _, err := decodeGob(value)
+	return err == nil
+}
+
+// decodeGob decodes every message of a gob stream into its type definitions
+// and generic values
+func decodeGob(value []byte) ([]GobType, []GobValue, error) {
+	d := &gobDecoder{stream: gobReader{data: value}, types: map[int]*GobType{}}
+	values := []GobValue{}
+	for len(d.stream.data) > 0 {
+		msg := &gobReader{}
+		if err := d.next(msg); err != nil {
+			return nil, nil, err
+		}
+
+		id, err := msg.int()
+		if err != nil {
+			return nil, nil, err
+		}
+		if id < 0 {
+			if err := d.defineType(int(-id), msg); err != nil {
+				return nil, nil, fmt.Errorf("type %d: %v", -id, err)
+			}
+			continue
+		}
+		v, err := d.topValue(int(id), msg, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("value of type %s: %v", d.typeName(int(id)), err)
+		}
+		values = append(values, GobValue{Type: d.typeName(int(id)), Value: v})
+	}
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("gob stream holds no value")
+	}
+
+	types := make([]GobType, 0, len(d.order))
+	for _, id := range d.order {
+		types = append(types, d.resolve(d.types[id]))
+	}
+	return types, values, nil
+}
+
+// next reads the next message of the stream into msg
+func (d *gobDecoder) next(msg *gobReader) error {
+	n, err := d.stream.uint()
+	if err != nil {
+		return err
+	}
+	if n > uint64(len(d.stream.data)) {
+		return errGobShort
+	}
+	msg.data = d.stream.data[:n]
+	d.stream.data = d.stream.data[n:]
+	return nil
+}
+
+// defineType reads a wireType: a struct whose only set field is the
+// arrayType (0), sliceType (1), structType (2), mapType (3) or one of the
+// GobEncoder (4), BinaryMarshaler (5) and TextMarshaler (6) types
+func (d *gobDecoder) defineType(id int, r *gobReader) error {
+	if id < gobFirstUserID {
+		return fmt.Errorf("redefines a predefined type")
+	}
+	delta, err := r.uint()
+	if err != nil {
+		return err
+	}
+
+	t := &GobType{ID: id}
+	field := int(delta) - 1
+	kinds := []string{"array", "slice", "struct", "map", "GobEncoder", "BinaryMarshaler", "TextMarshaler"}
+	if field < 0 || field >= len(kinds) {
+		return fmt.Errorf("unknown wire type field %d", field)
+	}
+	t.Kind = kinds[field]
+
+	// Every kind is a struct embedding CommonType{Name, Id} as field 0
+	err = gobStruct(r, func(f int) error {
+		switch {
+		case f == 0:
+			return gobStruct(r, func(f int) error {
+				switch f {
+				case 0:
+					name, err := r.string()
+					t.Name = name
+					return err
+				case 1:
+					_, err := r.int()
+					return err
+				}
+				return fmt.Errorf("unknown CommonType field %d", f)
+			})
+		case t.Kind == "array" && f == 1, t.Kind == "slice" && f == 1, t.Kind == "map" && f == 2:
+			elem, err := r.int()
+			t.elem = int(elem)
+			return err
+		case t.Kind == "array" && f == 2:
+			n, err := r.int()
+			t.Len = int(n)
+			return err
+		case t.Kind == "map" && f == 1:
+			key, err := r.int()
+			t.key = int(key)
+			return err
+		case t.Kind == "struct" && f == 1:
+			n, err := r.count()
+			if err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				field, err := gobFieldType(r)
+				if err != nil {
+					return err
+				}
+				t.Fields = append(t.Fields, field)
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown %s field %d", t.Kind, f)
+	})
+	if err != nil {
+		return err
+	}
+	// The wireType struct ends after its one field
+	if end, err := r.uint(); err != nil || end != 0 {
+		return fmt.Errorf("malformed wire type")
+	}
+
+	if _, ok := d.types[id]; !ok {
+		d.order = append(d.order, id)
+	}
+	d.types[id] = t
+	return nil
+}
+
+// gobFieldType reads a fieldType{Name, Id}
+func gobFieldType(r *gobReader) (GobField, error) {
+	var field GobField
+	err := gobStruct(r, func(f int) error {
+		switch f {
+		case 0:
+			name, err := r.string()
+			field.Name = name
+			return err
+		case 1:
+			id, err := r.int()
+			field.id = int(id)
+			return err
+		}
+		return fmt.Errorf("unknown fieldType field %d", f)
+	})
+	return field, err
+}
+
+// resolve names the element, key and field types of t
+func (d *gobDecoder) resolve(t *GobType) GobType {
+	resolved := *t
+	if t.Kind == "array" || t.Kind == "slice" || t.Kind == "map" {
+		resolved.Elem = d.typeName(t.elem)
+	}
+	if t.Kind == "map" {
+		resolved.Key = d.typeName(t.key)
+	}
+	resolved.Fields = make([]GobField, len(t.Fields))
+	for i, f := range t.Fields {
+		f.Type = d.typeName(f.id)
+		resolved.Fields[i] = f
+	}
+	return resolved
+}
+
+// typeName names a type id
+func (d *gobDecoder) typeName(id int) string {
+	if name, ok := gobBuiltinNames[id]; ok {
+		return name
+	}
+	if t, ok := d.types[id]; ok && t.Name != "" {
+		return t.Name
+	}
+	return fmt.Sprintf("type%d", id)
+}
+
+// gobStruct reads struct fields as field number deltas ended by 0, calling
+// field for each
+func gobStruct(r *gobReader, field func(f int) error) error {
+	f := -1
+	for {
+		delta, err := r.uint()
+		if err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		if delta > uint64(len(r.data))+1 {
+			return fmt.Errorf("invalid field delta %d", delta)
+		}
+		f += int(delta)
+		if err := field(f); err != nil {
+			return err
+		}
+	}
+}
+
+// topValue decodes a top-level or interface value; values other than
+// structs are sent as field 0 of an implicit struct, a 0 delta before them
+func (d *gobDecoder) topValue(id int, r *gobReader, depth int) (interface{}, error) {
+	if t, ok := d.types[id]; !ok || t.Kind != "struct" {
+		if delta, err := r.uint(); err != nil || delta != 0 {
+			return nil, fmt.Errorf("malformed singleton value")
+		}
+	}
+	return d.value(id, r, depth)
+}
+
+// value decodes a value of type id
+func (d *gobDecoder) value(id int, r *gobReader, depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, fmt.Errorf("values nested deeper than %d", maxDecodeDepth)
+	}
+	switch id {
+	case gobBool:
+		u, err := r.uint()
+		return u != 0, err
+	case gobInt:
+		return r.int()
+	case gobUint:
+		return r.uint()
+	case gobFloat:
+		f, err := r.float()
+		return jsonFloat(f), err
+	case gobComplex:
+		re, err := r.float()
+		if err != nil {
+			return nil, err
+		}
+		im, err := r.float()
+		return fmt.Sprint(complex(re, im)), err
+	case gobBytes:
+		b, err := r.bytes()
+		return textOrHex(b), err
+	case gobString:
+		return r.string()
+	case gobInterface:
+		return d.interfaceValue(r, depth)
+	}
+
+	t, ok := d.types[id]
+	if !ok {
+		return nil, fmt.Errorf("undefined type id %d", id)
+	}
+	switch t.Kind {
+	case "struct":
+		fields := map[string]interface{}{}
+		err := gobStruct(r, func(f int) error {
+			if f >= len(t.Fields) {
+				return fmt.Errorf("%s has no field %d", t.Name, f)
+			}
+			v, err := d.value(t.Fields[f].id, r, depth+1)
+			fields[t.Fields[f].Name] = v
+			return err
+		})
+		return fields, err
+	case "slice", "array":
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := d.value(t.elem, r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case "map":
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		entries := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := d.value(t.key, r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(t.elem, r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			entries[fmt.Sprint(k)] = v
+		}
+		return entries, nil
+	case "TextMarshaler":
+		return r.string()
+	default:
+		// GobEncoder and BinaryMarshaler output is opaque
+		b, err := r.bytes()
+		return textOrHex(b), err
+	}
+}
+
+// interfaceValue decodes an interface: the concrete type's registered name
+// (empty for nil), definitions of types first sent with it, its id, the
+// value's byte count and the value. As in encoding/gob's decodeInterface the
+// definitions may end the message, the value continuing in the next one.
+func (d *gobDecoder) interfaceValue(r *gobReader, depth int) (interface{}, error) {
+	name, err := r.string()
+	if err != nil || name == "" {
+		return nil, err
+	}
+	var id int64
+	for {
+		if len(r.data) == 0 {
+			if err := d.next(r); err != nil {
+				return nil, err
+			}
+		}
+		if id, err = r.int(); err != nil {
+			return nil, err
+		}
+		if id >= 0 {
+			break
+		}
+		if err := d.defineType(int(-id), r); err != nil {
+			return nil, fmt.Errorf("type %d: %v", -id, err)
+		}
+		// A delimited value's byte count may follow the definition
+		if len(r.data) > 0 {
+			if _, err := r.uint(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, err := r.uint(); err != nil {
+		return nil, err
+	}
+	v, err := d.topValue(int(id), r, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"type": name, "value": v}, nil
+}
+
+// decodeGobValue decodes a gob stream for /api/decode/gob
+func decodeGobValue(value []byte) (map[string]interface{}, error) {
+	types, values, err := decodeGob(value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"types":  types,
+		"values": values,
+	}, nil
+}
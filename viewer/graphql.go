@@ -0,0 +1,855 @@
+// graphql.go - GraphQL endpoint over buckets, keys, stats and containerd objects
+package viewer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// maxGraphQLQuerySize limits the size of a query document
+	maxGraphQLQuerySize = 1024 * 1024
+	// gqlDefaultLimit bounds list fields unless a limit argument is given
+	gqlDefaultLimit = 1000
+)
+
+// graphqlSchema the schema served at /api/graphql/schema; introspection
+// queries are not supported
+const graphqlSchema = `# JSON is any JSON value, Object fields can be selected by key
+scalar JSON
+
+type Query {
+  # top level buckets, or the sub-buckets of path
+  buckets(path: String, prefix: String, limit: Int): [Bucket!]!
+  bucket(path: String!): Bucket
+  key(bucket: String!, name: String!): Key
+  # keys whose name contains query, at most 100
+  search(query: String!, limit: Int): [SearchResult!]!
+  stats: Object!
+  # containerd namespaces under v1
+  namespaces: [Namespace!]!
+  containers(namespace: String): [Container!]!
+  images(namespace: String): [Image!]!
+}
+
+type Bucket {
+  name: String!
+  path: String!
+  keyCount: Int!
+  bucketCount: Int!
+  stats: Object!
+  buckets(prefix: String, limit: Int): [Bucket!]!
+  bucket(name: String!): Bucket
+  keys(prefix: String, after: String, limit: Int): [Key!]!
+  key(name: String!): Key
+  # shortcut for key(name: key) { text }
+  value(key: String!): String
+}
+
+type Key {
+  name: String!
+  size: Int!
+  type: String!
+  isBinary: Boolean!
+  isJson: Boolean!
+  preview: String!
+  # parsed JSON, the text, or a placeholder for binary values
+  value: JSON
+  text: String
+  hex: String!
+  base64: String!
+  # containerd encodings, null if the value does not decode
+  time: String
+  varint: Int
+  protobuf: Object
+  # well-known containerd keys decoded by name, see the dump command
+  decoded: JSON
+}
+
+type SearchResult { bucket: String! key: String! path: String! type: String! size: Int! preview: String! }
+
+type Namespace {
+  name: String!
+  bucket: Bucket!
+  containers: [Container!]!
+  images: [Image!]!
+}
+
+type Container {
+  namespace: String! id: String! image: String! runtime: String! runtimeOptions: Object
+  snapshotter: String! snapshotKey: String! sandboxId: String createdAt: String! updatedAt: String! labels: Object
+}
+
+type Image {
+  namespace: String! name: String! digest: String! mediaType: String! size: Int!
+  createdAt: String! updatedAt: String! labels: Object
+}
+`
+
+// gqlRequest a GraphQL request as POSTed by clients
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// gqlError a GraphQL error, path locates the failed field
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlResponse a GraphQL response, data is omitted when the request failed
+// before execution
+type gqlResponse struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []gqlError  `json:"errors,omitempty"`
+}
+
+// gqlFields an object result, fields keep the order of the selection
+type gqlFields []gqlField
+
+type gqlField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the fields in selection order
+func (f gqlFields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// gqlObject a value with selectable fields
+type gqlObject interface {
+	typeName() string
+	// resolve returns the value of a field: nil, a scalar, a gqlObject, a
+	// []gqlObject or a plain JSON value (see gqlPlain)
+	resolve(field string, args gqlArgs) (interface{}, error)
+}
+
+// gqlArgs field arguments with variables substituted
+type gqlArgs map[string]interface{}
+
+// str returns a string argument, empty if not given
+func (a gqlArgs) str(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("argument %s must be a string", name)
+}
+
+// required returns a string argument that must be given
+func (a gqlArgs) required(name string) (string, error) {
+	if a[name] == nil {
+		return "", fmt.Errorf("argument %s is required", name)
+	}
+	return a.str(name)
+}
+
+// limit returns the limit argument or gqlDefaultLimit
+func (a gqlArgs) limit() (int, error) {
+	switch v := a["limit"].(type) {
+	case nil:
+		return gqlDefaultLimit, nil
+	case int64:
+		if v >= 0 {
+			return int(v), nil
+		}
+	case float64: // from JSON variables
+		if v >= 0 && v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument limit must be a non-negative integer")
+}
+
+// gqlUnknownField the error of fields the type does not have
+func gqlUnknownField(obj gqlObject, field string) error {
+	return fmt.Errorf("cannot query field %q on type %s", field, obj.typeName())
+}
+
+// gqlPlain converts a Go value to its JSON form so that fields of structs
+// can be selected by their JSON names
+func gqlPlain(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var plain interface{}
+	err = json.Unmarshal(data, &plain)
+	return plain, err
+}
+
+// gqlMap a plain JSON object
+type gqlMap map[string]interface{}
+
+func (m gqlMap) typeName() string { return "Object" }
+
+func (m gqlMap) resolve(field string, args gqlArgs) (interface{}, error) {
+	return m[field], nil
+}
+
+// gqlExecutor executes one operation, field errors are collected and the
+// field set to null
+type gqlExecutor struct {
+	fragments map[string]*gqlFragment
+	variables map[string]interface{}
+	errors    []gqlError
+}
+
+func (e *gqlExecutor) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, gqlError{Message: err.Error(), Path: path})
+}
+
+// selectFields resolves the selection set on obj
+func (e *gqlExecutor) selectFields(obj gqlObject, sels []*gqlSelection, path []interface{}) gqlFields {
+	fields := gqlFields{}
+	index := map[string]int{}
+	for _, sel := range e.collect(sels, map[string]bool{}) {
+		key := sel.responseKey()
+		value := e.resolveField(obj, sel, appendPath(path, key))
+		if i, ok := index[key]; ok {
+			fields[i].value = value
+			continue
+		}
+		index[key] = len(fields)
+		fields = append(fields, gqlField{key: key, value: value})
+	}
+	return fields
+}
+
+// collect expands fragments and drops fields excluded by @skip or @include
+func (e *gqlExecutor) collect(sels []*gqlSelection, visiting map[string]bool) []*gqlSelection {
+	var out []*gqlSelection
+	for _, sel := range sels {
+		if !e.included(sel) {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			f, ok := e.fragments[sel.spread]
+			if !ok {
+				e.fail(nil, fmt.Errorf("unknown fragment %q", sel.spread))
+				continue
+			}
+			if visiting[f.name] {
+				e.fail(nil, fmt.Errorf("fragment %q spreads itself", f.name))
+				continue
+			}
+			visiting[f.name] = true
+			out = append(out, e.collect(f.selections, visiting)...)
+			delete(visiting, f.name)
+		case sel.inline != nil:
+			out = append(out, e.collect(sel.inline, visiting)...)
+		default:
+			out = append(out, sel)
+		}
+	}
+	return out
+}
+
+// included evaluates the @skip and @include directives
+func (e *gqlExecutor) included(sel *gqlSelection) bool {
+	if args, ok := sel.directives["skip"]; ok {
+		if skip, _ := e.value(args["if"]).(bool); skip {
+			return false
+		}
+	}
+	if args, ok := sel.directives["include"]; ok {
+		if include, _ := e.value(args["if"]).(bool); !include {
+			return false
+		}
+	}
+	return true
+}
+
+// value substitutes variables in an argument value
+func (e *gqlExecutor) value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case gqlVarRef:
+		return e.variables[string(t)]
+	case gqlEnum:
+		return string(t)
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			list[i] = e.value(item)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			obj[k] = e.value(item)
+		}
+		return obj
+	}
+	return v
+}
+
+// resolveField resolves and completes a single field
+func (e *gqlExecutor) resolveField(obj gqlObject, sel *gqlSelection, path []interface{}) interface{} {
+	if sel.name == "__typename" {
+		return obj.typeName()
+	}
+
+	args := gqlArgs{}
+	for name, v := range sel.args {
+		args[name] = e.value(v)
+	}
+
+	value, err := obj.resolve(sel.name, args)
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	return e.complete(value, sel, path)
+}
+
+// complete applies the sub-selection of sel to a resolved value
+func (e *gqlExecutor) complete(value interface{}, sel *gqlSelection, path []interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case gqlObject:
+		if sel.selections == nil {
+			e.fail(path, fmt.Errorf("field %q of type %s must have a selection of subfields", sel.name, v.typeName()))
+			return nil
+		}
+		return e.selectFields(v, sel.selections, path)
+	case []gqlObject:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.complete(item, sel, appendPath(path, i))
+		}
+		return list
+	}
+
+	if sel.selections == nil {
+		// Plain objects without a selection are returned whole as JSON
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return e.selectFields(gqlMap(v), sel.selections, path)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.complete(item, sel, appendPath(path, i))
+		}
+		return list
+	}
+	e.fail(path, fmt.Errorf("field %q is a scalar and has no subfields", sel.name))
+	return nil
+}
+
+// appendPath returns path extended by elem without sharing its array
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	return append(path[:len(path):len(path)], elem)
+}
+
+// handleGraphQL executes a GraphQL query from ?query= or the request body,
+// JSON encoded or as application/graphql
+func (c *Viewer) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				c.sendGraphQLError(w, http.StatusBadRequest, fmt.Errorf("invalid variables: %v", err))
+				return
+			}
+		}
+	} else {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLQuerySize+1))
+		if err != nil {
+			c.sendGraphQLError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(body) > maxGraphQLQuerySize {
+			c.sendGraphQLError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("query too large"))
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, &req); err != nil {
+			c.sendGraphQLError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+			return
+		}
+	}
+
+	resp, status := c.executeGraphQL(req)
+	body, err := json.Marshal(resp)
+	if err != nil {
+		c.sendGraphQLError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if c.maxResponseBytes > 0 && int64(len(body)) > c.maxResponseBytes {
+		c.sendGraphQLError(w, http.StatusOK, fmt.Errorf("response of %d bytes exceeds the limit of %d bytes, select fewer fields or pass limit arguments", len(body), c.maxResponseBytes))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// executeGraphQL runs the selected query operation in one read transaction
+func (c *Viewer) executeGraphQL(req gqlRequest) (gqlResponse, int) {
+	failed := func(err error) (gqlResponse, int) {
+		return gqlResponse{Errors: []gqlError{{Message: err.Error()}}}, http.StatusBadRequest
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return failed(fmt.Errorf("query is empty"))
+	}
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		return failed(err)
+	}
+
+	var op *gqlOperation
+	for _, candidate := range doc.operations {
+		if req.OperationName == "" || candidate.name == req.OperationName {
+			if op != nil {
+				return failed(fmt.Errorf("document has multiple operations, operationName is required"))
+			}
+			op = candidate
+		}
+	}
+	if op == nil {
+		return failed(fmt.Errorf("operation %q not found", req.OperationName))
+	}
+	if op.kind != "query" {
+		return failed(fmt.Errorf("%s operations are not supported, only queries", op.kind))
+	}
+
+	e := &gqlExecutor{fragments: doc.fragments, variables: map[string]interface{}{}}
+	for _, v := range op.variables {
+		value, ok := req.Variables[v.name]
+		if !ok {
+			value = v.defaultVal
+		}
+		if value == nil && strings.HasSuffix(v.typ, "!") {
+			return failed(fmt.Errorf("variable $%s of type %s is required", v.name, v.typ))
+		}
+		e.variables[v.name] = value
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		return gqlResponse{Errors: []gqlError{{Message: err.Error()}}}, http.StatusInternalServerError
+	}
+
+	var data gqlFields
+	db.View(func(tx *bolt.Tx) error {
+		data = e.selectFields(&gqlQuery{c: c, tx: tx}, op.selections, nil)
+		return nil
+	})
+
+	slog.Info("GraphQL query", "operation", op.name, "fields", len(data), "errors", len(e.errors))
+	return gqlResponse{Data: data, Errors: e.errors}, http.StatusOK
+}
+
+// sendGraphQLError sends a response with a single error and no data
+func (c *Viewer) sendGraphQLError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if encodeErr := json.NewEncoder(w).Encode(gqlResponse{Errors: []gqlError{{Message: err.Error()}}}); encodeErr != nil {
+		slog.Error("Failed to encode GraphQL error", "error", encodeErr)
+	}
+}
+
+// handleGraphQLSchema serves the schema in GraphQL SDL
+func (c *Viewer) handleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, graphqlSchema)
+}
+
+// gqlQuery the root Query type
+type gqlQuery struct {
+	c  *Viewer
+	tx *bolt.Tx
+}
+
+func (q *gqlQuery) typeName() string { return "Query" }
+
+func (q *gqlQuery) resolve(field string, args gqlArgs) (interface{}, error) {
+	switch field {
+	case "buckets":
+		path, err := args.str("path")
+		if err != nil {
+			return nil, err
+		}
+		if strings.Trim(path, "/") == "" {
+			return q.topBuckets(args)
+		}
+		b := q.c.findBucket(q.tx, path)
+		if b == nil {
+			return nil, fmt.Errorf("bucket not found: %s", path)
+		}
+		return q.c.gqlBucket(b, strings.Trim(path, "/")).buckets(args)
+	case "bucket":
+		path, err := args.required("path")
+		if err != nil {
+			return nil, err
+		}
+		if b := q.c.findBucket(q.tx, path); b != nil {
+			return q.c.gqlBucket(b, strings.Trim(path, "/")), nil
+		}
+		return nil, nil
+	case "key":
+		path, err := args.required("bucket")
+		if err != nil {
+			return nil, err
+		}
+		name, err := args.required("name")
+		if err != nil {
+			return nil, err
+		}
+		if b := q.c.findBucket(q.tx, path); b != nil {
+			return q.c.gqlBucket(b, strings.Trim(path, "/")).key(name), nil
+		}
+		return nil, nil
+	case "search":
+		query, err := args.required("query")
+		if err != nil {
+			return nil, err
+		}
+		limit, err := args.limit()
+		if err != nil {
+			return nil, err
+		}
+		results, err := q.c.searchKeys(context.Background(), query, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) > limit {
+			results = results[:limit]
+		}
+		if results == nil {
+			return []interface{}{}, nil
+		}
+		return gqlPlain(results)
+	case "stats":
+		stats, err := q.c.getDatabaseStats()
+		if err != nil {
+			return nil, err
+		}
+		return gqlPlain(stats)
+	case "namespaces":
+		namespaces := []gqlObject{}
+		err := forEachNamespace(q.tx, func(ns string, nsb *bolt.Bucket) error {
+			namespaces = append(namespaces, &gqlNamespace{c: q.c, name: ns, b: nsb})
+			return nil
+		})
+		return namespaces, err
+	case "containers", "images":
+		filter, err := args.str("namespace")
+		if err != nil {
+			return nil, err
+		}
+		records := []interface{}{}
+		err = forEachNamespace(q.tx, func(ns string, nsb *bolt.Bucket) error {
+			if filter != "" && ns != filter {
+				return nil
+			}
+			if field == "containers" {
+				for _, r := range readContainerRecords(ns, nsb) {
+					records = append(records, r)
+				}
+			} else {
+				for _, r := range readImageRecords(ns, nsb) {
+					records = append(records, r)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return gqlPlain(records)
+	}
+	return nil, gqlUnknownField(q, field)
+}
+
+// topBuckets lists the top level buckets
+func (q *gqlQuery) topBuckets(args gqlArgs) (interface{}, error) {
+	prefix, err := args.str("prefix")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := args.limit()
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []gqlObject{}
+	q.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if len(buckets) < limit && strings.HasPrefix(string(name), prefix) {
+			buckets = append(buckets, q.c.gqlBucket(b, string(name)))
+		}
+		return nil
+	})
+	return buckets, nil
+}
+
+// gqlBucketObject the Bucket type
+type gqlBucketObject struct {
+	c    *Viewer
+	b    *bolt.Bucket
+	path string
+}
+
+// gqlBucket wraps a bucket found at path
+func (c *Viewer) gqlBucket(b *bolt.Bucket, path string) *gqlBucketObject {
+	return &gqlBucketObject{c: c, b: b, path: path}
+}
+
+func (o *gqlBucketObject) typeName() string { return "Bucket" }
+
+func (o *gqlBucketObject) resolve(field string, args gqlArgs) (interface{}, error) {
+	switch field {
+	case "name":
+		return o.path[strings.LastIndex(o.path, "/")+1:], nil
+	case "path":
+		return o.path, nil
+	case "keyCount", "bucketCount":
+		keys, buckets := 0, 0
+		o.b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				buckets++
+			} else {
+				keys++
+			}
+			return nil
+		})
+		if field == "keyCount" {
+			return keys, nil
+		}
+		return buckets, nil
+	case "stats":
+		return gqlPlain(newBucketStats(o.b.Stats()))
+	case "buckets":
+		return o.buckets(args)
+	case "bucket":
+		name, err := args.required("name")
+		if err != nil {
+			return nil, err
+		}
+		if b := o.b.Bucket([]byte(name)); b != nil {
+			return o.c.gqlBucket(b, o.path+"/"+name), nil
+		}
+		return nil, nil
+	case "keys":
+		return o.keys(args)
+	case "key":
+		name, err := args.required("name")
+		if err != nil {
+			return nil, err
+		}
+		return o.key(name), nil
+	case "value":
+		name, err := args.required("key")
+		if err != nil {
+			return nil, err
+		}
+		if k := o.key(name); k != nil {
+			return k.resolve("text", nil)
+		}
+		return nil, nil
+	}
+	return nil, gqlUnknownField(o, field)
+}
+
+// buckets lists sub-buckets
+func (o *gqlBucketObject) buckets(args gqlArgs) (interface{}, error) {
+	prefix, err := args.str("prefix")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := args.limit()
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []gqlObject{}
+	cur := o.b.Cursor()
+	for k, v := cur.Seek([]byte(prefix)); k != nil && len(buckets) < limit; k, v = cur.Next() {
+		if !bytes.HasPrefix(k, []byte(prefix)) {
+			break
+		}
+		if v == nil {
+			buckets = append(buckets, o.c.gqlBucket(o.b.Bucket(k), o.path+"/"+string(k)))
+		}
+	}
+	return buckets, nil
+}
+
+// keys lists keys, after continues behind a key of a previous page
+func (o *gqlBucketObject) keys(args gqlArgs) (interface{}, error) {
+	prefix, err := args.str("prefix")
+	if err != nil {
+		return nil, err
+	}
+	after, err := args.str("after")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := args.limit()
+	if err != nil {
+		return nil, err
+	}
+
+	start := prefix
+	if after > start {
+		start = after
+	}
+	keys := []gqlObject{}
+	cur := o.b.Cursor()
+	for k, v := cur.Seek([]byte(start)); k != nil && len(keys) < limit; k, v = cur.Next() {
+		if !bytes.HasPrefix(k, []byte(prefix)) {
+			break
+		}
+		if v == nil || (after != "" && string(k) == after) {
+			continue
+		}
+		keys = append(keys, &gqlKey{c: o.c, name: string(k), value: v})
+	}
+	return keys, nil
+}
+
+// key returns the named key, nil if missing or a bucket
+func (o *gqlBucketObject) key(name string) *gqlKey {
+	v := o.b.Get([]byte(name))
+	if v == nil {
+		return nil
+	}
+	return &gqlKey{c: o.c, name: name, value: v}
+}
+
+// gqlKey the Key type, value points into the transaction's memory map
+type gqlKey struct {
+	c     *Viewer
+	name  string
+	value []byte
+	kv    *KeyValuePair
+}
+
+func (k *gqlKey) typeName() string { return "Key" }
+
+// parsed returns the key as shown by the REST API
+func (k *gqlKey) parsed() *KeyValuePair {
+	if k.kv == nil {
+		kv := k.c.parseKeyValue([]byte(k.name), k.value)
+		k.kv = &kv
+	}
+	return k.kv
+}
+
+func (k *gqlKey) resolve(field string, args gqlArgs) (interface{}, error) {
+	switch field {
+	case "name":
+		return k.name, nil
+	case "size":
+		return len(k.value), nil
+	case "type":
+		return k.parsed().ValueType, nil
+	case "isBinary":
+		return k.parsed().IsBinary, nil
+	case "isJson":
+		return k.parsed().IsJSON, nil
+	case "preview":
+		return k.parsed().Preview, nil
+	case "value":
+		return k.parsed().Value, nil
+	case "text":
+		if k.parsed().IsBinary {
+			return nil, nil
+		}
+		return string(k.value), nil
+	case "hex":
+		return hex.EncodeToString(k.value), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(k.value), nil
+	case "time":
+		if t, err := decodeTimeValue(k.value); err == nil {
+			return t["iso"], nil
+		}
+		return nil, nil
+	case "varint":
+		if n, read := binary.Varint(k.value); read == len(k.value) && read > 0 {
+			return n, nil
+		}
+		return nil, nil
+	case "protobuf":
+		if v, err := decodeProtobufValue(k.value); err == nil {
+			return v, nil
+		}
+		return nil, nil
+	case "decoded":
+		return decodeKnownValue(k.name, k.value), nil
+	}
+	return nil, gqlUnknownField(k, field)
+}
+
+// gqlNamespace the Namespace type
+type gqlNamespace struct {
+	c    *Viewer
+	name string
+	b    *bolt.Bucket
+}
+
+func (n *gqlNamespace) typeName() string { return "Namespace" }
+
+func (n *gqlNamespace) resolve(field string, args gqlArgs) (interface{}, error) {
+	switch field {
+	case "name":
+		return n.name, nil
+	case "bucket":
+		return n.c.gqlBucket(n.b, string(bucketKeyVersion)+"/"+n.name), nil
+	case "containers":
+		containers := readContainerRecords(n.name, n.b)
+		if containers == nil {
+			containers = []ContainerRecord{}
+		}
+		return gqlPlain(containers)
+	case "images":
+		images := readImageRecords(n.name, n.b)
+		if images == nil {
+			images = []ImageRecord{}
+		}
+		return gqlPlain(images)
+	}
+	return nil, gqlUnknownField(n, field)
+}
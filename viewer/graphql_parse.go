@@ -0,0 +1,551 @@
+// graphql_parse.go - parser for the GraphQL query subset served by /api/graphql
+package viewer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// gqlDocument a parsed GraphQL document
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+// gqlOperation a query operation
+type gqlOperation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []gqlVariable
+	selections []*gqlSelection
+}
+
+// gqlVariable a variable definition with its optional default
+type gqlVariable struct {
+	name       string
+	typ        string
+	defaultVal interface{}
+}
+
+// gqlFragment a named fragment, the type condition is not checked
+type gqlFragment struct {
+	name       string
+	selections []*gqlSelection
+}
+
+// gqlSelection a field, fragment spread (spread != "") or inline fragment
+// (inline != nil)
+type gqlSelection struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	directives map[string]map[string]interface{}
+	selections []*gqlSelection
+
+	spread string
+	inline []*gqlSelection
+}
+
+// responseKey the name of the field in the result
+func (s *gqlSelection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// gqlVarRef a reference to a variable in an argument value, resolved when
+// the query executes
+type gqlVarRef string
+
+// gqlEnum an enum value argument, passed to resolvers as a string
+type gqlEnum string
+
+// gqlToken a lexical token; kind is one of name, int, float, string or the
+// punctuator itself
+type gqlToken struct {
+	kind  string
+	value string
+	pos   int
+}
+
+// gqlParser recursive descent parser over a token list
+type gqlParser struct {
+	tokens []gqlToken
+	i      int
+}
+
+// parseGraphQL parses a GraphQL document
+func parseGraphQL(src string) (*gqlDocument, error) {
+	tokens, err := lexGraphQL(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &gqlParser{tokens: tokens}
+	doc := &gqlDocument{fragments: map[string]*gqlFragment{}}
+	for !p.done() {
+		switch {
+		case p.peek("{"):
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: sels})
+		case p.peekName("fragment"):
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			doc.fragments[f.name] = f
+		case p.peekName("query"), p.peekName("mutation"), p.peekName("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document contains no operation")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) done() bool {
+	return p.i >= len(p.tokens)
+}
+
+func (p *gqlParser) peek(kind string) bool {
+	return !p.done() && p.tokens[p.i].kind == kind
+}
+
+func (p *gqlParser) peekName(value string) bool {
+	return p.peek("name") && p.tokens[p.i].value == value
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.i]
+	p.i++
+	return t
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.done() {
+		return fmt.Errorf("syntax error: unexpected end of query")
+	}
+	t := p.tokens[p.i]
+	return fmt.Errorf("syntax error at offset %d: unexpected %q", t.pos, t.value)
+}
+
+// expect consumes a token of the given kind
+func (p *gqlParser) expect(kind string) (gqlToken, error) {
+	if !p.peek(kind) {
+		return gqlToken{}, p.unexpected()
+	}
+	return p.next(), nil
+}
+
+// operation parses `query Name($var: Type = default) { ... }`
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{kind: p.next().value}
+	if p.peek("name") {
+		op.name = p.next().value
+	}
+
+	if p.peek("(") {
+		p.next()
+		for !p.peek(")") {
+			if _, err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.expect("name")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			typ, err := p.typeRef()
+			if err != nil {
+				return nil, err
+			}
+			v := gqlVariable{name: name.value, typ: typ}
+			if p.peek("=") {
+				p.next()
+				if v.defaultVal, err = p.value(true); err != nil {
+					return nil, err
+				}
+			}
+			op.variables = append(op.variables, v)
+		}
+		p.next()
+	}
+
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = sels
+	return op, nil
+}
+
+// typeRef parses a type like [String!]! and returns it as written
+func (p *gqlParser) typeRef() (string, error) {
+	var typ string
+	if p.peek("[") {
+		p.next()
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if _, err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.expect("name")
+		if err != nil {
+			return "", err
+		}
+		typ = name.value
+	}
+	if p.peek("!") {
+		p.next()
+		typ += "!"
+	}
+	return typ, nil
+}
+
+// fragment parses `fragment Name on Type { ... }`
+func (p *gqlParser) fragment() (*gqlFragment, error) {
+	p.next()
+	name, err := p.expect("name")
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	p.next()
+	if _, err := p.expect("name"); err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &gqlFragment{name: name.value, selections: sels}, nil
+}
+
+// selectionSet parses `{ field, ...Fragment, ... on Type { } }`
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var sels []*gqlSelection
+	for !p.peek("}") {
+		if p.done() {
+			return nil, p.unexpected()
+		}
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	p.next()
+
+	if len(sels) == 0 {
+		return nil, fmt.Errorf("syntax error: empty selection set")
+	}
+	return sels, nil
+}
+
+// selection parses a single field or fragment
+func (p *gqlParser) selection() (*gqlSelection, error) {
+	sel := &gqlSelection{}
+
+	if p.peek("...") {
+		p.next()
+		if p.peek("name") && !p.peekName("on") {
+			sel.spread = p.next().value
+			var err error
+			sel.directives, err = p.directives()
+			return sel, err
+		}
+		if p.peekName("on") {
+			p.next()
+			if _, err := p.expect("name"); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if sel.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		sel.inline, err = p.selectionSet()
+		return sel, err
+	}
+
+	name, err := p.expect("name")
+	if err != nil {
+		return nil, err
+	}
+	sel.name = name.value
+	if p.peek(":") {
+		p.next()
+		field, err := p.expect("name")
+		if err != nil {
+			return nil, err
+		}
+		sel.alias, sel.name = sel.name, field.value
+	}
+
+	if p.peek("(") {
+		if sel.args, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	if sel.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if sel.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+// arguments parses `(name: value, ...)`
+func (p *gqlParser) arguments() (map[string]interface{}, error) {
+	p.next()
+	args := map[string]interface{}{}
+	for !p.peek(")") {
+		name, err := p.expect("name")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name.value], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	p.next()
+	return args, nil
+}
+
+// directives parses `@name(args) ...`
+func (p *gqlParser) directives() (map[string]map[string]interface{}, error) {
+	var dirs map[string]map[string]interface{}
+	for p.peek("@") {
+		p.next()
+		name, err := p.expect("name")
+		if err != nil {
+			return nil, err
+		}
+		var args map[string]interface{}
+		if p.peek("(") {
+			if args, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		if dirs == nil {
+			dirs = map[string]map[string]interface{}{}
+		}
+		dirs[name.value] = args
+	}
+	return dirs, nil
+}
+
+// value parses an input value, constant values may not reference variables
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	if p.done() {
+		return nil, p.unexpected()
+	}
+
+	t := p.tokens[p.i]
+	switch t.kind {
+	case "$":
+		if constant {
+			return nil, p.unexpected()
+		}
+		p.next()
+		name, err := p.expect("name")
+		if err != nil {
+			return nil, err
+		}
+		return gqlVarRef(name.value), nil
+	case "int":
+		p.next()
+		return strconv.ParseInt(t.value, 10, 64)
+	case "float":
+		p.next()
+		return strconv.ParseFloat(t.value, 64)
+	case "string":
+		p.next()
+		return t.value, nil
+	case "name":
+		p.next()
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return gqlEnum(t.value), nil
+	case "[":
+		p.next()
+		list := []interface{}{}
+		for !p.peek("]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	case "{":
+		p.next()
+		obj := map[string]interface{}{}
+		for !p.peek("}") {
+			name, err := p.expect("name")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name.value], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		return obj, nil
+	}
+	return nil, p.unexpected()
+}
+
+// lexGraphQL splits a GraphQL document into tokens, dropping whitespace,
+// commas and comments
+func lexGraphQL(src string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == ',':
+			i++
+		case ch == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, gqlToken{kind: "...", value: "...", pos: i})
+			i += 3
+		case strings.IndexByte("!$()=:@[]{}|&", ch) >= 0:
+			tokens = append(tokens, gqlToken{kind: string(ch), value: string(ch), pos: i})
+			i++
+		case ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || 'a' <= src[i] && src[i] <= 'z' ||
+				'A' <= src[i] && src[i] <= 'Z' || '0' <= src[i] && src[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: "name", value: src[start:i], pos: start})
+		case ch == '-' || '0' <= ch && ch <= '9':
+			start := i
+			kind := "int"
+			i++
+			for i < len(src) && ('0' <= src[i] && src[i] <= '9' || strings.IndexByte(".eE+-", src[i]) >= 0) {
+				if strings.IndexByte(".eE", src[i]) >= 0 {
+					kind = "float"
+				}
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: kind, value: src[start:i], pos: start})
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			if end < 0 {
+				return nil, fmt.Errorf("syntax error at offset %d: unterminated string", i)
+			}
+			tokens = append(tokens, gqlToken{kind: "string", value: src[i+3 : i+3+end], pos: i})
+			i += end + 6
+		case ch == '"':
+			s, n, err := lexGraphQLString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("syntax error at offset %d: %v", i, err)
+			}
+			tokens = append(tokens, gqlToken{kind: "string", value: s, pos: i})
+			i += n
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, fmt.Errorf("syntax error at offset %d: unexpected character %q", i, r)
+		}
+	}
+	return tokens, nil
+}
+
+// lexGraphQLString decodes a quoted string and returns it with the number of
+// bytes consumed
+func lexGraphQLString(src string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch ch := src[i]; ch {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\n', '\r':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			if i+1 >= len(src) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			i++
+			switch esc := src[i]; esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if i+4 >= len(src) {
+					return "", 0, fmt.Errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(src[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				return "", 0, fmt.Errorf("invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
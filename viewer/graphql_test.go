@@ -0,0 +1,97 @@
+package viewer
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// graphQL posts a query and decodes the GraphQL response, data is kept in
+// field order
+func graphQL(t *testing.T, s *boltdbtest.Server, query string, variables map[string]interface{}) (int, json.RawMessage, []gqlError) {
+	t.Helper()
+
+	body, _ := json.Marshal(gqlRequest{Query: query, Variables: variables})
+	status, data := s.Do(http.MethodPost, "/api/graphql", strings.NewReader(string(body)))
+
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []gqlError      `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("response is not JSON (status %d): %s", status, data)
+	}
+	return status, resp.Data, resp.Errors
+}
+
+func TestGraphQLContainers(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	_, raw, errs := graphQL(t, s, `query Containers($ns: String!) {
+		containers(namespace: $ns) { id image createdAt }
+	}`, map[string]interface{}{"ns": "k8s.io"})
+	if len(errs) > 0 {
+		t.Fatalf("errors: %+v", errs)
+	}
+
+	var data struct{ Containers []map[string]interface{} }
+	json.Unmarshal(raw, &data)
+	containers := data.Containers
+	if len(containers) != 1 {
+		t.Fatalf("containers = %v, want one", containers)
+	}
+	ctr := containers[0]
+	if ctr["id"] != boltdbtest.Container || ctr["image"] != boltdbtest.Image {
+		t.Errorf("container = %v", ctr)
+	}
+	if len(ctr) != 3 {
+		t.Errorf("container has fields %v, want only the selected ones", ctr)
+	}
+}
+
+func TestGraphQLBuckets(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	_, got, errs := graphQL(t, s, `{
+		misc: bucket(path: "misc") {
+			keyCount
+			text: value(key: "text")
+			keys(prefix: "c") { ...KeyFields }
+			nested: bucket(name: "nested") { path @include(if: false) keys { name } }
+		}
+	}
+	fragment KeyFields on Key { name size hex }`, nil)
+	if len(errs) > 0 {
+		t.Fatalf("errors: %+v", errs)
+	}
+
+	want := `{"misc":{"keyCount":3,"text":"hello","keys":[{"name":"counter","size":8,"hex":"000000000000002a"}],"nested":{"keys":[{"name":"key"}]}}}`
+	if string(got) != want {
+		t.Errorf("data = %s\nwant   %s", got, want)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	status, raw, errs := graphQL(t, s, `{ bucket(path: "misc") { name nope } }`, nil)
+	if status != http.StatusOK || len(errs) != 1 {
+		t.Fatalf("status %d, errors %+v, want one field error", status, errs)
+	}
+	if path, _ := json.Marshal(errs[0].Path); string(path) != `["bucket","nope"]` {
+		t.Errorf("error path = %s", path)
+	}
+	if want := `{"bucket":{"name":"misc","nope":null}}`; string(raw) != want {
+		t.Errorf("data = %s, want %s", raw, want)
+	}
+
+	if status, _, errs := graphQL(t, s, `{ bucket(path: "misc" { name } }`, nil); status != http.StatusBadRequest || len(errs) != 1 {
+		t.Errorf("syntax error: status %d, errors %+v", status, errs)
+	}
+	if _, _, errs := graphQL(t, s, `mutation { put }`, nil); len(errs) != 1 {
+		t.Errorf("mutation: errors %+v, want rejected", errs)
+	}
+}
@@ -0,0 +1,217 @@
+// history.go - recently viewed buckets and keys of each browser session
+package viewer
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// sessionCookie identifies the browser session of an unauthenticated
+	// user for the history and preferences; authenticated users are the
+	// same session in every browser
+	sessionCookie = "boltdbui_session"
+	// sessionCookieMaxAge keeps the cookie across browser restarts, so the
+	// preferences stored for it are found again
+	sessionCookieMaxAge = 365 * 24 * time.Hour
+	// defaultHistorySize the entries kept per session
+	defaultHistorySize = 50
+	// maxHistorySessions bounds the sessions held in memory, the least
+	// recently active one is dropped first
+	maxHistorySessions = 1000
+)
+
+// HistoryEntry a bucket, or a key of it, viewed in a session
+type HistoryEntry struct {
+	Bucket string    `json:"bucket"`
+	Key    string    `json:"key,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// viewHistory the recently viewed entries of each session, newest first;
+// it lives in memory only and is lost on restart
+type viewHistory struct {
+	mu sync.Mutex
+	// size the entries kept per session, 0 disables the history
+	size     int
+	sessions map[string]*sessionHistory
+}
+
+// sessionHistory the history of one session
+type sessionHistory struct {
+	entries []HistoryEntry
+	active  time.Time
+}
+
+// add moves the entry to the front of the session's history
+func (h *viewHistory) add(session string, e HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sessions == nil {
+		h.sessions = map[string]*sessionHistory{}
+	}
+	s := h.sessions[session]
+	if s == nil {
+		if len(h.sessions) >= maxHistorySessions {
+			h.dropOldest()
+		}
+		s = &sessionHistory{}
+		h.sessions[session] = s
+	}
+	s.active = e.Time
+
+	entries := []HistoryEntry{e}
+	for _, old := range s.entries {
+		if old.Bucket == e.Bucket && old.Key == e.Key {
+			continue
+		}
+		if len(entries) == h.size {
+			break
+		}
+		entries = append(entries, old)
+	}
+	s.entries = entries
+}
+
+// dropOldest forgets the least recently active session
+func (h *viewHistory) dropOldest() {
+	var oldest string
+	var active time.Time
+	for id, s := range h.sessions {
+		if oldest == "" || s.active.Before(active) {
+			oldest, active = id, s.active
+		}
+	}
+	delete(h.sessions, oldest)
+}
+
+// entries returns a copy of the session's history, newest first
+func (h *viewHistory) entries(session string) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := []HistoryEntry{}
+	if s := h.sessions[session]; s != nil {
+		entries = append(entries, s.entries...)
+	}
+	return entries
+}
+
+// clear forgets the session's history
+func (h *viewHistory) clear(session string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.sessions, session)
+}
+
+// requestSession identifies the session of a request, the authenticated
+// user or the session cookie; ok is false before the cookie was set
+func requestSession(r *http.Request) (id string, ok bool) {
+	if user, found := userFromContext(r.Context()); found && user.Subject != "" {
+		return "user:" + user.Subject, true
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil && cookie.Value != "" {
+		return "cookie:" + cookie.Value, true
+	}
+	return "", false
+}
+
+// startSession returns the session of a request, setting the session
+// cookie on the response if it has none
+func (c *Viewer) startSession(w http.ResponseWriter, r *http.Request) (string, error) {
+	if id, ok := requestSession(r); ok {
+		return id, nil
+	}
+	value, err := randomState()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     c.absolutePath("/"),
+		MaxAge:   int(sessionCookieMaxAge / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "cookie:" + value, nil
+}
+
+// recordHistory middleware adds the first page of bucket listings and key
+// views to the history of the request's session, starting a session with
+// the session cookie if needed
+func (c *Viewer) recordHistory(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.history.size > 0 && r.Method == http.MethodGet && r.URL.Query().Get("cursor") == "" {
+			if e, ok := historyEntry(r); ok {
+				if session, err := c.startSession(w, r); err != nil {
+					slog.Error("Failed to start history session", "error", err)
+				} else {
+					c.history.add(session, e)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// historyEntry the bucket or key viewed by a GET /api/bucket or /api/key
+func historyEntry(r *http.Request) (HistoryEntry, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return HistoryEntry{}, false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return HistoryEntry{}, false
+	}
+
+	vars := mux.Vars(r)
+	var e HistoryEntry
+	switch {
+	case strings.HasPrefix(template, "/api/bucket/"):
+		e.Bucket = vars["path"]
+	case strings.HasPrefix(template, "/api/key/"):
+		e.Bucket, e.Key = vars["bucketPath"], vars["key"]
+		if key, err := url.PathUnescape(e.Key); err == nil {
+			e.Key = key
+		}
+	default:
+		return HistoryEntry{}, false
+	}
+	if bucket, err := url.PathUnescape(e.Bucket); err == nil {
+		e.Bucket = bucket
+	}
+	if e.Bucket = strings.Trim(e.Bucket, "/"); e.Bucket == "" {
+		return HistoryEntry{}, false
+	}
+	e.Time = time.Now().UTC()
+	return e, true
+}
+
+// handleGetHistory lists the buckets and keys recently viewed in the
+// session, newest first
+func (c *Viewer) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	session, ok := requestSession(r)
+	if !ok {
+		c.sendSuccess(w, []HistoryEntry{})
+		return
+	}
+	c.sendSuccess(w, c.history.entries(session))
+}
+
+// handleClearHistory forgets the session's history
+func (c *Viewer) handleClearHistory(w http.ResponseWriter, r *http.Request) {
+	if session, ok := requestSession(r); ok {
+		c.history.clear(session)
+	}
+	c.sendSuccess(w, []HistoryEntry{})
+}
@@ -0,0 +1,51 @@
+package viewer
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestHistory(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) { c.history.size = 2 })
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Client().Jar = jar
+
+	var entries []HistoryEntry
+	s.Get("/api/history").Decode(t, &entries)
+	if len(entries) != 0 {
+		t.Fatalf("history = %+v, want none", entries)
+	}
+
+	s.Get("/api/bucket/misc")
+	s.Get("/api/key/misc/json")
+	s.Get("/api/bucket/misc%2Fnested")
+	s.Get("/api/key/misc/json")
+	s.Get("/api/bucket/misc?cursor=" + encodeCursor([]byte("json")))
+	s.Get("/api/history").Decode(t, &entries)
+	if len(entries) != 2 || entries[0].Key != "json" || entries[0].Bucket != "misc" || entries[1].Bucket != "misc/nested" {
+		t.Fatalf("history = %+v, want misc:json and misc/nested", entries)
+	}
+
+	// Another browser session has a history of its own
+	other := &http.Client{}
+	resp, err := other.Get(s.URL + "/api/history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(resp.Cookies()) != 0 {
+		t.Errorf("listing the history started a session")
+	}
+
+	s.API(http.MethodDelete, "/api/history", "")
+	s.Get("/api/history").Decode(t, &entries)
+	if len(entries) != 0 {
+		t.Errorf("history after clearing = %+v, want none", entries)
+	}
+}
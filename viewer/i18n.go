@@ -0,0 +1,174 @@
+// i18n.go - locale bundles of the page and API error messages
+package viewer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// localesDir the bundles below the web assets, one <tag>.json each mapping
+// English strings to their translation; --static-dir may add or override
+// bundles like any other asset
+const localesDir = "locales"
+
+// defaultLocale the language of the strings in the code, missing
+// translations fall back to it
+const defaultLocale = "en"
+
+// embeddedLocales the parsed embedded bundles by tag
+var embeddedLocales sync.Map
+
+// LocaleBundle the translations of /api/locale
+type LocaleBundle struct {
+	Locale    string            `json:"locale"`
+	Available []string          `json:"available"`
+	Messages  map[string]string `json:"messages"`
+}
+
+// availableLocales lists the tags of the bundles, the default one included
+func (c *Viewer) availableLocales() []string {
+	tags := []string{defaultLocale}
+	entries, err := fs.ReadDir(c.webAssets(), localesDir)
+	if err != nil {
+		return tags
+	}
+	for _, e := range entries {
+		tag := strings.TrimSuffix(e.Name(), ".json")
+		if e.IsDir() || tag == e.Name() || tag == defaultLocale {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags[1:])
+	return tags
+}
+
+// localeMessages returns the bundle of a tag, empty for the default locale
+// or a tag without bundle; embedded bundles are parsed once, those of
+// --static-dir on every call so edits show up on reload
+func (c *Viewer) localeMessages(tag string) (map[string]string, error) {
+	if c.staticDir == "" {
+		if m, ok := embeddedLocales.Load(tag); ok {
+			return m.(map[string]string), nil
+		}
+	}
+	messages := map[string]string{}
+	data, err := fs.ReadFile(c.webAssets(), path.Join(localesDir, tag+".json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return messages, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("locale %s: %v", tag, err)
+	}
+	if c.staticDir == "" {
+		embeddedLocales.Store(tag, messages)
+	}
+	return messages, nil
+}
+
+// negotiateLocale picks the bundle of a request: ?lang= if available, else
+// the Accept-Language entry with the highest weight that matches a bundle
+// exactly or by language, e.g. zh-TW gets zh-CN
+func negotiateLocale(r *http.Request, available []string) string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if tag := matchLocale(lang, available); tag != "" {
+			return tag
+		}
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if fields[0] == "" || fields[0] == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, weighted{fields[0], q})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+	for _, a := range accepted {
+		if tag := matchLocale(a.tag, available); tag != "" {
+			return tag
+		}
+	}
+	return defaultLocale
+}
+
+// matchLocale returns the available tag equal to lang, ignoring case, or
+// the first one of the same language
+func matchLocale(lang string, available []string) string {
+	for _, tag := range available {
+		if strings.EqualFold(tag, lang) {
+			return tag
+		}
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	for _, tag := range available {
+		if tagBase, _, _ := strings.Cut(tag, "-"); strings.EqualFold(tagBase, base) {
+			return tag
+		}
+	}
+	return ""
+}
+
+// localize middleware announces the locale of the response in
+// Content-Language, sendErrorCode translates error messages to it
+func (c *Viewer) localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Language", negotiateLocale(r, c.availableLocales()))
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// translate returns the translation of an English string, the string
+// itself if the locale has none
+func (c *Viewer) translate(tag, text string) string {
+	if tag == "" || tag == defaultLocale {
+		return text
+	}
+	messages, err := c.localeMessages(tag)
+	if err != nil {
+		return text
+	}
+	if t, ok := messages[text]; ok && t != "" {
+		return t
+	}
+	return text
+}
+
+// handleGetLocale returns the bundle negotiated for the request
+func (c *Viewer) handleGetLocale(w http.ResponseWriter, r *http.Request) {
+	available := c.availableLocales()
+	tag := negotiateLocale(r, available)
+	messages, err := c.localeMessages(tag)
+	if err != nil {
+		c.sendError(w, "Failed to read locale", err)
+		return
+	}
+	c.sendSuccess(w, LocaleBundle{Locale: tag, Available: available, Messages: messages})
+}
@@ -0,0 +1,100 @@
+package viewer
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestNegotiateLocale(t *testing.T) {
+	available := []string{"en", "zh-CN"}
+	for _, tc := range []struct {
+		query, accept, want string
+	}{
+		{"", "", "en"},
+		{"", "zh-CN,zh;q=0.9,en;q=0.8", "zh-CN"},
+		{"", "zh-tw", "zh-CN"},
+		{"", "fr-FR, en;q=0.5, zh;q=0.7", "zh-CN"},
+		{"", "de", "en"},
+		{"?lang=en", "zh-CN", "en"},
+		{"?lang=zh-cn", "", "zh-CN"},
+		{"?lang=xx", "zh", "zh-CN"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/"+tc.query, nil)
+		r.Header.Set("Accept-Language", tc.accept)
+		if got := negotiateLocale(r, available); got != tc.want {
+			t.Errorf("%q with Accept-Language %q = %s, want %s", tc.query, tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/api/bucket/misc?sort=bogus", nil)
+	req.Header.Set("Accept-Language", "zh-CN")
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body boltdbtest.Response
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.Header.Get("Content-Language") != "zh-CN" || !strings.HasPrefix(body.Error, "无效的排序: ") {
+		t.Errorf("error = %q in %s, want it translated", body.Error, resp.Header.Get("Content-Language"))
+	}
+
+	if resp := s.API(http.MethodGet, "/api/bucket/misc?sort=bogus", ""); !strings.HasPrefix(resp.Error, "Invalid sort order: ") {
+		t.Errorf("error = %q, want English without Accept-Language", resp.Error)
+	}
+
+	var bundle LocaleBundle
+	s.Get("/api/locale?lang=zh").Decode(t, &bundle)
+	if bundle.Locale != "zh-CN" || bundle.Messages["Refresh"] != "刷新" || len(bundle.Available) != 2 {
+		t.Errorf("bundle = %s with %d messages of %v", bundle.Locale, len(bundle.Messages), bundle.Available)
+	}
+
+	if _, page := s.Do(http.MethodGet, "/?lang=zh-CN", nil); !strings.Contains(string(page), `<html lang="zh-CN">`) || !strings.Contains(string(page), "Bucket 层级") {
+		t.Errorf("page is not translated:\n%s", page)
+	}
+}
+
+// TestLocaleBundlesComplete checks every bundle translates all strings of
+// the page and app.js, with the same placeholders
+func TestLocaleBundlesComplete(t *testing.T) {
+	c := newViewer("")
+	assets := c.webAssets()
+	js, _ := fs.ReadFile(assets, "static/app.js")
+	html, _ := fs.ReadFile(assets, indexTemplateName)
+	var keys []string
+	for _, m := range regexp.MustCompile(`\bt\('((?:[^'\\]|\\.)*)'`).FindAllSubmatch(js, -1) {
+		keys = append(keys, string(m[1]))
+	}
+	for _, m := range regexp.MustCompile(`\.T "([^"]*)"`).FindAllSubmatch(html, -1) {
+		keys = append(keys, string(m[1]))
+	}
+
+	placeholders := regexp.MustCompile(`\{\d+\}`)
+	for _, tag := range c.availableLocales()[1:] {
+		messages, err := c.localeMessages(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			translated, ok := messages[key]
+			if !ok {
+				t.Errorf("%s: no translation of %q", tag, key)
+				continue
+			}
+			if want, got := placeholders.FindAllString(key, -1), placeholders.FindAllString(translated, -1); len(want) != len(got) {
+				t.Errorf("%s: %q has placeholders %v, want %v", tag, translated, got, want)
+			}
+		}
+	}
+}
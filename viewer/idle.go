@@ -0,0 +1,114 @@
+// idle.go - exit on idle and single-session serving
+package viewer
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// onceGracePeriod how long --once waits after the browser session closed
+// before exiting, so a page reload does not end the session
+const onceGracePeriod = 5 * time.Second
+
+// activityTracker tracks in-flight requests and open browser sessions
+type activityTracker struct {
+	mu       sync.Mutex
+	inFlight int
+	last     time.Time
+	sessions int
+	// grace of --once, 0 uses onceGracePeriod
+	grace time.Duration
+}
+
+// trackActivity middleware records request activity for --idle-timeout;
+// WebSocket sessions are not requests, so a forgotten tab does not keep
+// the server alive
+func (c *Viewer) trackActivity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/ws" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		c.activity.mu.Lock()
+		c.activity.inFlight++
+		c.activity.mu.Unlock()
+
+		defer func() {
+			c.activity.mu.Lock()
+			c.activity.inFlight--
+			c.activity.last = time.Now()
+			c.activity.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionOpened records a browser session, see handleWebSocket
+func (c *Viewer) sessionOpened() {
+	c.activity.mu.Lock()
+	defer c.activity.mu.Unlock()
+
+	c.activity.sessions++
+}
+
+// sessionClosed records the end of a browser session; with --once the server
+// stops when no session reconnects within the grace period
+func (c *Viewer) sessionClosed() {
+	c.activity.mu.Lock()
+	c.activity.sessions--
+	grace := c.activity.grace
+	c.activity.mu.Unlock()
+
+	if !c.once {
+		return
+	}
+	if grace == 0 {
+		grace = onceGracePeriod
+	}
+	time.AfterFunc(grace, func() {
+		c.activity.mu.Lock()
+		ended := c.activity.sessions == 0
+		c.activity.mu.Unlock()
+
+		if ended {
+			c.requestStop("browser session ended")
+		}
+	})
+}
+
+// watchIdle stops the server once no request arrived for idleTimeout
+func (c *Viewer) watchIdle() {
+	interval := c.idleTimeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.activity.mu.Lock()
+			idle := c.activity.inFlight == 0 && time.Since(c.activity.last) >= c.idleTimeout
+			c.activity.mu.Unlock()
+
+			if idle {
+				c.requestStop("idle for " + c.idleTimeout.String())
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// requestStop asks StartServer to shut down gracefully
+func (c *Viewer) requestStop(reason string) {
+	select {
+	case c.stop <- reason:
+	default:
+	}
+}
@@ -0,0 +1,90 @@
+package viewer
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// serveViewer runs Serve on a free port, the error it returns is sent on
+// the channel once it stopped
+func serveViewer(t *testing.T, c *Viewer) (string, <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- c.Serve([]Listener{{Address: address}})
+	}()
+	t.Cleanup(func() { c.requestStop("test ended") })
+
+	// Serve listens before it starts serving
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get("http://" + address + "/api/capabilities")
+		if err == nil {
+			resp.Body.Close()
+			return address, stopped
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("server did not start: %v", err)
+		}
+	}
+}
+
+// waitStopped fails the test unless Serve returned within timeout
+func waitStopped(t *testing.T, stopped <-chan error, timeout time.Duration) {
+	t.Helper()
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("server still running after %s", timeout)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	c := newViewer(boltdbtest.Tiny(t))
+	c.idleTimeout = 200 * time.Millisecond
+	_, stopped := serveViewer(t, c)
+
+	waitStopped(t, stopped, 5*time.Second)
+}
+
+func TestOnce(t *testing.T) {
+	c := newViewer(boltdbtest.Tiny(t))
+	c.once = true
+	c.activity.grace = 100 * time.Millisecond
+	address, stopped := serveViewer(t, c)
+
+	// A reload reconnects within the grace period
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+address+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	conn, _, err = websocket.DefaultDialer.Dial("ws://"+address+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("server stopped on a page reload")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	conn.Close()
+	waitStopped(t, stopped, 5*time.Second)
+}
@@ -0,0 +1,186 @@
+// info.go - what the served file is: the bolt header and meta pages are
+// checked and the schema detected on startup, so a wrong or damaged file is
+// reported up front instead of by the first request that fails
+package viewer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Schemas detected by detectDatabaseSchema
+const (
+	SchemaContainerd    = "containerd-v1"
+	SchemaSnapshotter   = "snapshotter"
+	SchemaEtcd          = "etcd"
+	SchemaDockerNetwork = "docker-network"
+	SchemaDockerVolumes = "docker-volumes"
+	SchemaUnknown       = "unknown"
+)
+
+// boltFormatVersion the data file version bbolt writes and reads
+const boltFormatVersion = 2
+
+// DBInfo the served file as found by checkBoltFile and detectDatabaseSchema
+type DBInfo struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Valid at least one meta page is intact, which bolt needs to open the
+	// file; PageSize, Version and TxID are those of the newest intact one
+	Valid    bool   `json:"valid"`
+	PageSize int    `json:"pageSize,omitempty"`
+	Version  uint32 `json:"version,omitempty"`
+	TxID     uint64 `json:"txid,omitempty"`
+	// Schema what the buckets look like, empty unless the file could be
+	// opened
+	Schema string `json:"schema,omitempty"`
+	// Problems found in the header, or opening the file
+	Problems []string `json:"problems,omitempty"`
+}
+
+// handleGetInfo checks the served file and reports what it is
+func (c *Viewer) handleGetInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := c.databaseInfo()
+	if err != nil {
+		c.sendError(w, "Failed to check database", err)
+		return
+	}
+	c.sendSuccess(w, info)
+}
+
+// databaseInfo checks the header of the served file and, if bolt can open
+// it, detects its schema
+func (c *Viewer) databaseInfo() (*DBInfo, error) {
+	info, err := checkBoltFile(c.databasePath())
+	if err != nil || !info.Valid {
+		return info, err
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		info.Problems = append(info.Problems, err.Error())
+		return info, nil
+	}
+	db.View(func(tx *bolt.Tx) error {
+		info.Schema = detectDatabaseSchema(tx)
+		return nil
+	})
+	return info, nil
+}
+
+// logDatabaseInfo reports the served file on startup, a file bolt cannot
+// open as an error
+func (c *Viewer) logDatabaseInfo() {
+	if c.databasePath() == "" {
+		return // a frontend without a database of its own
+	}
+	info, err := c.databaseInfo()
+	switch {
+	case err != nil:
+		slog.Error("Failed to check database", "path", c.databasePath(), "error", err)
+	case !info.Valid:
+		slog.Error("Not a valid bolt database", "path", info.Path, "problems", info.Problems)
+	default:
+		slog.Info("Serving database", "path", info.Path, "schema", info.Schema, "size", info.Size, "pageSize", info.PageSize, "txid", info.TxID)
+		if len(info.Problems) > 0 {
+			slog.Warn("Database has problems", "path", info.Path, "problems", info.Problems)
+		}
+	}
+}
+
+// checkBoltFile reads the meta pages of a file the way bolt does when
+// opening it, without taking its lock
+func checkBoltFile(path string) (*DBInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &DBInfo{Path: path, Size: stat.Size()}
+	if info.Size == 0 {
+		info.Problems = append(info.Problems, "file is empty")
+		return info, nil
+	}
+
+	metas, problems := readMetaPages(f, os.Getpagesize())
+	var newest *MetaPage
+	for i, m := range metas {
+		if problems[i] != "" {
+			info.Problems = append(info.Problems, problems[i])
+			continue
+		}
+		if newest == nil || m.TxID > newest.TxID {
+			newest = m
+		}
+	}
+	if newest != nil {
+		info.Valid = true
+		info.PageSize, info.Version, info.TxID = int(newest.PageSize), newest.Version, newest.TxID
+	}
+	return info, nil
+}
+
+// readMetaPages reads both meta pages with what is wrong with them. Meta
+// page 0 records the page size; when it is damaged bolt looks for meta
+// page 1 one OS page further, osPageSize
+func readMetaPages(r io.ReaderAt, osPageSize int) (metas [2]*MetaPage, problems [2]string) {
+	metas[0], problems[0] = readMetaPage(r, 0, 0)
+	pageSize := osPageSize
+	if problems[0] == "" {
+		pageSize = int(metas[0].PageSize)
+	}
+	metas[1], problems[1] = readMetaPage(r, 1, int64(pageSize))
+	return metas, problems
+}
+
+// readMetaPage decodes the meta page at off, with what is wrong with it
+func readMetaPage(r io.ReaderAt, id int, off int64) (*MetaPage, string) {
+	data := make([]byte, pageHeaderSize+64)
+	if _, err := r.ReadAt(data, off); err != nil {
+		return nil, fmt.Sprintf("meta page %d: file ends at its header", id)
+	}
+	m := decodeMeta(data[pageHeaderSize:])
+	switch flags := binary.LittleEndian.Uint16(data[8:]); {
+	case m.Magic != metaMagic:
+		return m, fmt.Sprintf("meta page %d: invalid magic %#x", id, m.Magic)
+	case flags&metaPageFlag == 0:
+		return m, fmt.Sprintf("meta page %d: page flags %#x are not those of a meta page", id, flags)
+	case m.Version != boltFormatVersion:
+		return m, fmt.Sprintf("meta page %d: unsupported version %d", id, m.Version)
+	case !m.ChecksumValid:
+		return m, fmt.Sprintf("meta page %d: checksum mismatch", id)
+	}
+	return m, ""
+}
+
+// detectDatabaseSchema tells the known databases apart by their top level
+// buckets; containerd's metadata and snapshotter databases share bucket v1,
+// only the metadata records a db version in it
+func detectDatabaseSchema(tx *bolt.Tx) string {
+	switch {
+	case isEtcd(tx):
+		return SchemaEtcd
+	case isDockerNetwork(tx):
+		return SchemaDockerNetwork
+	case isDockerVolumes(tx):
+		return SchemaDockerVolumes
+	}
+	if v1 := tx.Bucket(bucketKeyVersion); v1 != nil {
+		if v1.Get(bucketKeyDBVersion) == nil && v1.Bucket(snapshotterKeySnapshots) != nil {
+			return SchemaSnapshotter
+		}
+		return SchemaContainerd
+	}
+	return SchemaUnknown
+}
@@ -0,0 +1,72 @@
+package viewer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDatabaseInfo(t *testing.T) {
+	snapshotter := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		v1, err := tx.CreateBucket(bucketKeyVersion)
+		if err != nil {
+			return err
+		}
+		_, err = v1.CreateBucket(snapshotterKeySnapshots)
+		return err
+	})
+	for path, want := range map[string]string{
+		boltdbtest.Containerd(t): SchemaContainerd,
+		snapshotter:              SchemaSnapshotter,
+		boltdbtest.Tiny(t):       SchemaUnknown,
+	} {
+		var info DBInfo
+		newTestServer(t, path).Get("/api/info").Decode(t, &info)
+		if !info.Valid || info.Schema != want || info.PageSize != os.Getpagesize() || info.Version != boltFormatVersion || info.TxID == 0 || len(info.Problems) > 0 {
+			t.Errorf("%s: info = %+v, want schema %s", filepath.Base(path), info, want)
+		}
+	}
+}
+
+func TestCheckBoltFile(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bolt falls back to meta page 1 when meta page 0 is damaged
+	data[pageHeaderSize+20] ^= 0xff
+	os.WriteFile(path, data, 0o600)
+	info, err := checkBoltFile(path)
+	if err != nil || !info.Valid || len(info.Problems) != 1 || !strings.Contains(info.Problems[0], "meta page 0: checksum") {
+		t.Errorf("damaged meta page 0: %+v, %v", info, err)
+	}
+
+	text := filepath.Join(t.TempDir(), "notes.db")
+	os.WriteFile(text, []byte(strings.Repeat("not a database\n", 1000)), 0o600)
+	info, err = checkBoltFile(text)
+	if err != nil || info.Valid || len(info.Problems) != 2 || !strings.Contains(info.Problems[0], "invalid magic") {
+		t.Errorf("text file: %+v, %v", info, err)
+	}
+	// The first request says why the file does not open
+	status, body := newTestServer(t, text).Do("GET", "/api/buckets", nil)
+	if status == 200 || !strings.Contains(string(body), "not a valid bolt database: meta page 0: invalid magic") {
+		t.Errorf("status %d: %s", status, body)
+	}
+	var served DBInfo
+	newTestServer(t, text).Get("/api/info").Decode(t, &served)
+	if served.Valid || served.Schema != "" {
+		t.Errorf("served info = %+v", served)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.db")
+	os.WriteFile(empty, nil, 0o600)
+	if info, err := checkBoltFile(empty); err != nil || info.Valid || len(info.Problems) != 1 {
+		t.Errorf("empty file: %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,640 @@
+// jobs.go - whole-database scans run in the background: a POST starts one
+// and returns its ID, progress and the result are polled until it finishes
+package viewer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Limits of the jobs of a viewer
+const (
+	// maxRunningJobs jobs scanning at the same time, more are refused
+	maxRunningJobs = 4
+	// maxFinishedJobs finished jobs kept for polling, the oldest are
+	// forgotten first
+	maxFinishedJobs = 50
+)
+
+// jobCheckKeys how many keys a job walks between checks for cancellation
+const jobCheckKeys = 1024
+
+// defaultCountRate keys per second of count jobs; the walk reads every
+// page, pacing it leaves disk bandwidth to containerd on busy nodes
+const defaultCountRate = 200000
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobRequest the body of POST /api/jobs
+type JobRequest struct {
+	// Kind "search", "top", "types", "doctor", "export" or "count"
+	Kind string `json:"kind"`
+	// Query the key search of kind search
+	Query string `json:"query,omitempty"`
+	// Path the bucket scanned by search, top and export, the whole database
+	// if empty; required by types
+	Path      string `json:"path,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// N the values of top (50 if 0) or results of search (1000 if 0)
+	N int `json:"n,omitempty"`
+	// Recursive includes the sub-buckets of Path in types
+	Recursive bool `json:"recursive,omitempty"`
+	// Rate the keys per second count walks, 200000 if 0
+	Rate int `json:"rate,omitempty"`
+}
+
+// JobProgress how far a job is; Total is estimated from the bucket
+// statistics before the scan starts, 0 if unknown
+type JobProgress struct {
+	Done    int64   `json:"done"`
+	Total   int64   `json:"total"`
+	Unit    string  `json:"unit"`
+	Percent float64 `json:"percent"`
+}
+
+// Job a background scan and, once done, its result: the report of the
+// endpoint of the same kind, SearchJobResult, ExportJobResult or
+// KeyCountReport
+type Job struct {
+	ID         string      `json:"id"`
+	Request    JobRequest  `json:"request"`
+	State      string      `json:"state"`
+	Progress   JobProgress `json:"progress"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+}
+
+// SearchJobResult the matches of a search job
+type SearchJobResult struct {
+	Results   []map[string]interface{} `json:"results"`
+	Truncated bool                     `json:"truncated"`
+}
+
+// ExportJobResult the NDJSON file of an export job, served by
+// /api/jobs/{id}/download until the job is deleted
+type ExportJobResult struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// job a Job and the state of its goroutine; the counters are updated
+// without the lock while it scans
+type job struct {
+	cancel context.CancelFunc
+	ctx    context.Context
+	unit   string
+	done   atomic.Int64
+	total  atomic.Int64
+
+	mu   sync.Mutex
+	info Job
+	// file the output of an export job, removed with the job
+	file string
+}
+
+// jobRegistry the jobs of a viewer
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// jobKind validates the request of a kind and runs it
+type jobKind struct {
+	unit string
+	// check normalizes the request, scoping Path to Namespace
+	check func(req *JobRequest) error
+	run   func(c *Viewer, j *job, req JobRequest) (interface{}, error)
+}
+
+// jobKinds the scans that can run as jobs
+var jobKinds = map[string]jobKind{
+	"search": {unit: "keys", check: checkSearchJob, run: (*Viewer).runSearchJob},
+	"top":    {unit: "keys", check: checkTopJob, run: (*Viewer).runTopJob},
+	"types":  {unit: "keys", check: checkTypesJob, run: (*Viewer).runTypesJob},
+	"doctor": {unit: "checks", check: checkDoctorJob, run: (*Viewer).runDoctorJob},
+	"export": {unit: "keys", check: checkExportJob, run: (*Viewer).runExportJob},
+	"count":  {unit: "keys", check: checkCountJob, run: (*Viewer).runCountJob},
+}
+
+// handleStartJob starts the job of the JSON body and returns it
+func (c *Viewer) handleStartJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid job", err)
+		return
+	}
+	c.submitJob(w, req)
+}
+
+// submitJob validates the request and starts its job
+func (c *Viewer) submitJob(w http.ResponseWriter, req JobRequest) {
+	kind, ok := jobKinds[req.Kind]
+	if !ok {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid job", fmt.Errorf("unknown kind %q", req.Kind))
+		return
+	}
+	if err := checkNamespace(req.Namespace); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid job", err)
+		return
+	}
+	if err := kind.check(&req); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid job", err)
+		return
+	}
+
+	j, err := c.startJob(kind, req)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusTooManyRequests, "Too many jobs", err)
+		return
+	}
+	slog.Info("Started job", "kind", req.Kind, "id", j.info.ID)
+	c.sendSuccess(w, j.view(false))
+}
+
+// handleListJobs returns the running and finished jobs, newest first,
+// without their results
+func (c *Viewer) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	reg := &c.jobs
+	reg.mu.Lock()
+	jobs := make([]Job, 0, len(reg.jobs))
+	for _, j := range reg.jobs {
+		jobs = append(jobs, j.view(false))
+	}
+	reg.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	c.sendSuccess(w, jobs)
+}
+
+// handleGetJob returns the progress of a job, and its result once done
+func (c *Viewer) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j := c.jobs.get(mux.Vars(r)["id"])
+	if j == nil {
+		c.sendErrorCode(w, http.StatusNotFound, "Job not found", nil)
+		return
+	}
+	c.sendSuccess(w, j.view(true))
+}
+
+// handleDeleteJob cancels a running job; a finished one is forgotten and
+// its output removed
+func (c *Viewer) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	j := c.jobs.get(id)
+	if j == nil {
+		c.sendErrorCode(w, http.StatusNotFound, "Job not found", nil)
+		return
+	}
+	j.mu.Lock()
+	running := j.info.State == JobRunning
+	j.mu.Unlock()
+	if running {
+		j.cancel()
+		slog.Info("Cancelled job", "id", id)
+	} else {
+		c.jobs.remove(id)
+	}
+	c.sendSuccess(w, map[string]interface{}{"id": id, "cancelled": running})
+}
+
+// handleJobDownload serves the NDJSON file of a finished export job
+func (c *Viewer) handleJobDownload(w http.ResponseWriter, r *http.Request) {
+	j := c.jobs.get(mux.Vars(r)["id"])
+	if j == nil {
+		c.sendErrorCode(w, http.StatusNotFound, "Job not found", nil)
+		return
+	}
+	j.mu.Lock()
+	state, file, id := j.info.State, j.file, j.info.ID
+	j.mu.Unlock()
+	if file == "" || state != JobDone {
+		c.sendErrorCode(w, http.StatusConflict, "Job has no download", fmt.Errorf("job %s is %s", id, state))
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		// Deleted concurrently
+		c.sendErrorCode(w, http.StatusNotFound, "Job not found", err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.ndjson"`, id))
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// startJob registers the job and starts its goroutine, failing when
+// maxRunningJobs are running
+func (c *Viewer) startJob(kind jobKind, req JobRequest) (*job, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{ctx: ctx, cancel: cancel, unit: kind.unit, info: Job{
+		ID:        id,
+		Request:   req,
+		State:     JobRunning,
+		StartedAt: time.Now().UTC(),
+	}}
+	if err := c.jobs.add(j); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		defer cancel()
+		result, err := kind.run(c, j, req)
+		j.finish(result, err)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Job failed", "id", id, "error", err)
+		}
+	}()
+	return j, nil
+}
+
+// add registers j, forgetting the oldest finished jobs beyond
+// maxFinishedJobs
+func (reg *jobRegistry) add(j *job) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.jobs == nil {
+		reg.jobs = map[string]*job{}
+	}
+	var finished []*job
+	running := 0
+	for _, other := range reg.jobs {
+		other.mu.Lock()
+		if other.info.State == JobRunning {
+			running++
+		} else {
+			finished = append(finished, other)
+		}
+		other.mu.Unlock()
+	}
+	if running >= maxRunningJobs {
+		return fmt.Errorf("%d jobs are running", running)
+	}
+	if n := len(finished) - maxFinishedJobs + 1; n > 0 {
+		sort.Slice(finished, func(a, b int) bool { return finished[a].info.StartedAt.Before(finished[b].info.StartedAt) })
+		for _, old := range finished[:n] {
+			delete(reg.jobs, old.info.ID)
+			old.removeFile()
+		}
+	}
+	reg.jobs[j.info.ID] = j
+	return nil
+}
+
+// get returns the job id, nil if unknown
+func (reg *jobRegistry) get(id string) *job {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.jobs[id]
+}
+
+// remove forgets the finished job id
+func (reg *jobRegistry) remove(id string) {
+	reg.mu.Lock()
+	j := reg.jobs[id]
+	delete(reg.jobs, id)
+	reg.mu.Unlock()
+	if j != nil {
+		j.removeFile()
+	}
+}
+
+// close cancels the running jobs and forgets all of them; jobs still
+// scanning remove their output when they stop
+func (reg *jobRegistry) close() {
+	reg.mu.Lock()
+	jobs := reg.jobs
+	reg.jobs = nil
+	reg.mu.Unlock()
+	for _, j := range jobs {
+		j.cancel()
+		j.removeFile()
+	}
+}
+
+// view a copy of the job with the current progress
+func (j *job) view(withResult bool) Job {
+	j.mu.Lock()
+	info := j.info
+	j.mu.Unlock()
+	if !withResult {
+		info.Result = nil
+	}
+	info.Progress = JobProgress{Done: j.done.Load(), Total: j.total.Load(), Unit: j.unit}
+	switch {
+	case info.State == JobDone:
+		info.Progress.Percent = 100
+	case info.Progress.Total > 0:
+		// The total is an estimate, the scan may pass it
+		info.Progress.Percent = min(99, float64(info.Progress.Done)*100/float64(info.Progress.Total))
+	}
+	return info
+}
+
+// finish records the result of the job's goroutine
+func (j *job) finish(result interface{}, err error) {
+	now := time.Now().UTC()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.FinishedAt = &now
+	switch {
+	case j.ctx.Err() != nil:
+		j.info.State = JobCancelled
+	case err != nil:
+		j.info.State = JobFailed
+		j.info.Error = err.Error()
+	default:
+		j.info.State = JobDone
+		j.info.Result = result
+		return
+	}
+	// Partial output is not served
+	j.removeFileLocked()
+}
+
+// removeFile deletes the output of the job, if any
+func (j *job) removeFile() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.removeFileLocked()
+}
+
+func (j *job) removeFileLocked() {
+	if j.file == "" {
+		return
+	}
+	if err := os.Remove(j.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to remove output of job", "id", j.info.ID, "error", err)
+	}
+	j.file = ""
+}
+
+// step counts a key or check, returning the context's error every
+// jobCheckKeys steps once the job is cancelled
+func (j *job) step() error {
+	if j.done.Add(1)%jobCheckKeys == 0 {
+		return j.ctx.Err()
+	}
+	return nil
+}
+
+// estimate sets the total to the keys below root, the whole database if
+// empty; bucket statistics read the pages but not the values
+func (c *Viewer) estimate(j *job, root string) error {
+	db, err := c.openDB()
+	if err != nil {
+		return err
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		if root != "" {
+			b := c.findBucket(tx, root)
+			if b == nil {
+				return fmt.Errorf("bucket not found: %s", root)
+			}
+			j.total.Store(int64(b.Stats().KeyN))
+			return nil
+		}
+		var total int64
+		err := tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			total += int64(b.Stats().KeyN)
+			return j.ctx.Err()
+		})
+		j.total.Store(total)
+		return err
+	})
+}
+
+// scopeJob scopes the path of a request to its namespace
+func scopeJob(req *JobRequest) error {
+	path, err := scopedPath(req.Namespace, req.Path)
+	if err != nil {
+		return err
+	}
+	req.Path = path
+	return nil
+}
+
+func checkSearchJob(req *JobRequest) error {
+	if strings.TrimSpace(req.Query) == "" {
+		return fmt.Errorf("search query cannot be empty")
+	}
+	if req.N < 0 || req.N > wsSearchMaxLimit {
+		return fmt.Errorf("n must be between 1 and %d", wsSearchMaxLimit)
+	}
+	if req.N == 0 {
+		req.N = wsSearchDefaultLimit
+	}
+	return scopeJob(req)
+}
+
+// runSearchJob collects up to N matches of the query
+func (c *Viewer) runSearchJob(j *job, req JobRequest) (interface{}, error) {
+	if err := c.estimate(j, req.Path); err != nil {
+		return nil, err
+	}
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchJobResult{Results: []map[string]interface{}{}}
+	var search *keySearch
+	search = &keySearch{
+		query: strings.ToLower(req.Query),
+		emit: func(match map[string]interface{}) bool {
+			result.Results = append(result.Results, match)
+			if len(result.Results) >= req.N {
+				result.Truncated = true
+				return false
+			}
+			return true
+		},
+		progress: func() bool {
+			j.done.Store(int64(search.scanned))
+			return j.ctx.Err() == nil
+		},
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		return c.walkSearch(tx, req.Path, search)
+	})
+	j.done.Store(int64(search.scanned))
+	if err == nil {
+		err = j.ctx.Err()
+	}
+	return result, err
+}
+
+func checkTopJob(req *JobRequest) error {
+	if req.N < 0 || req.N > maxTopValues {
+		return fmt.Errorf("n must be between 1 and %d", maxTopValues)
+	}
+	if req.N == 0 {
+		req.N = defaultTopValues
+	}
+	return scopeJob(req)
+}
+
+// runTopJob builds the report of /api/report/top
+func (c *Viewer) runTopJob(j *job, req JobRequest) (interface{}, error) {
+	if err := c.estimate(j, req.Path); err != nil {
+		return nil, err
+	}
+	return c.topValues(req.N, req.Path, j.step)
+}
+
+func checkTypesJob(req *JobRequest) error {
+	if err := scopeJob(req); err != nil {
+		return err
+	}
+	if req.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	return nil
+}
+
+// runTypesJob builds the report of /api/report/types
+func (c *Viewer) runTypesJob(j *job, req JobRequest) (interface{}, error) {
+	if err := c.estimate(j, req.Path); err != nil {
+		return nil, err
+	}
+	return c.typeHistogram(req.Path, req.Recursive, j.step)
+}
+
+func checkDoctorJob(req *JobRequest) error {
+	return nil
+}
+
+// runDoctorJob runs the checks of /api/doctor, counting rules
+func (c *Viewer) runDoctorJob(j *job, req JobRequest) (interface{}, error) {
+	j.total.Store(int64(len(doctorRules)))
+	return c.runDoctor(time.Now(), func() error {
+		j.done.Add(1)
+		return j.ctx.Err()
+	})
+}
+
+func checkExportJob(req *JobRequest) error {
+	return scopeJob(req)
+}
+
+// jobWriter counts the records json.Encoder writes, one Write each, and
+// stops the export once the job is cancelled
+type jobWriter struct {
+	j   *job
+	out io.Writer
+}
+
+func (w jobWriter) Write(p []byte) (int, error) {
+	if err := w.j.step(); err != nil {
+		return 0, err
+	}
+	return w.out.Write(p)
+}
+
+// runExportJob writes the records of /api/export/ndjson to a temporary
+// file kept for the download
+func (c *Viewer) runExportJob(j *job, req JobRequest) (interface{}, error) {
+	if err := c.estimate(j, req.Path); err != nil {
+		return nil, err
+	}
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "boltdbui-export-*.ndjson")
+	if err != nil {
+		return nil, err
+	}
+	j.mu.Lock()
+	j.file = f.Name()
+	j.mu.Unlock()
+	defer f.Close()
+
+	out := bufio.NewWriterSize(f, streamFlushBytes)
+	enc := json.NewEncoder(jobWriter{j: j, out: out})
+	var keys int
+	err = db.View(func(tx *bolt.Tx) error {
+		if req.Path != "" {
+			b := c.findBucket(tx, req.Path)
+			if b == nil {
+				return fmt.Errorf("bucket not found: %s", req.Path)
+			}
+			return exportBucket(enc, b, req.Path, &keys)
+		}
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return exportBucket(enc, b, string(name), &keys)
+		})
+	})
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &ExportJobResult{Keys: keys, Bytes: info.Size()}, nil
+}
+
+func checkCountJob(req *JobRequest) error {
+	if req.Rate < 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if req.Rate == 0 {
+		req.Rate = defaultCountRate
+	}
+	return scopeJob(req)
+}
+
+// runCountJob counts the keys below Path, pausing every jobCheckKeys keys
+// to stay below Rate keys per second
+func (c *Viewer) runCountJob(j *job, req JobRequest) (interface{}, error) {
+	if err := c.estimate(j, req.Path); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	return c.countKeys(req.Path, func() error {
+		n := j.done.Add(1)
+		if n%jobCheckKeys != 0 {
+			return nil
+		}
+		due := time.Duration(float64(n) / float64(req.Rate) * float64(time.Second))
+		if wait := due - time.Since(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-j.ctx.Done():
+			case <-timer.C:
+			}
+		}
+		return j.ctx.Err()
+	})
+}
@@ -0,0 +1,164 @@
+package viewer
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// waitJob polls the job until it is no longer running
+func waitJob(t *testing.T, s *boltdbtest.Server, id string) Job {
+	t.Helper()
+	var job Job
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.Get("/api/jobs/"+id).Decode(t, &job)
+		if job.State != JobRunning || time.Now().After(deadline) {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	var job Job
+	resp := s.API(http.MethodPost, "/api/jobs", `{"kind":"top","n":2}`)
+	if !resp.Success {
+		t.Fatalf("start: %+v", resp)
+	}
+	resp.Decode(t, &job)
+	if job.ID == "" || job.Request.N != 2 {
+		t.Fatalf("job = %+v", job)
+	}
+	job = waitJob(t, s, job.ID)
+	if job.State != JobDone || job.Progress.Percent != 100 || job.Progress.Done != 4 || job.Progress.Total < 4 {
+		t.Fatalf("job = %+v, want done after the 4 keys", job)
+	}
+	var top struct {
+		Result TopValuesReport `json:"result"`
+	}
+	s.Get("/api/jobs/"+job.ID).Decode(t, &top)
+	if r := top.Result; r.Scanned != 4 || len(r.Values) != 2 || r.Values[0].Key != "json" {
+		t.Errorf("result = %+v, want the 2 largest of 4 values", top.Result)
+	}
+
+	// Exports are downloaded from the job
+	s.API(http.MethodPost, "/api/jobs", `{"kind":"export","path":"misc/nested"}`).Decode(t, &job)
+	job = waitJob(t, s, job.ID)
+	if job.State != JobDone {
+		t.Fatalf("export = %+v", job)
+	}
+	status, body := s.Do(http.MethodGet, "/api/jobs/"+job.ID+"/download", nil)
+	lines := 0
+	for sc := bufio.NewScanner(bytes.NewReader(body)); sc.Scan(); lines++ {
+	}
+	if status != http.StatusOK || lines != 1 {
+		t.Errorf("download: status %d, %d records: %s", status, lines, body)
+	}
+	if resp := s.API(http.MethodDelete, "/api/jobs/"+job.ID, ""); !resp.Success {
+		t.Errorf("delete: %+v", resp)
+	}
+	if resp := s.API(http.MethodGet, "/api/jobs/"+job.ID, ""); resp.Status != http.StatusNotFound {
+		t.Errorf("deleted job: status %d, want 404", resp.Status)
+	}
+
+	var jobs []Job
+	s.Get("/api/jobs").Decode(t, &jobs)
+	if len(jobs) != 1 || jobs[0].Request.Kind != "top" || jobs[0].Result != nil {
+		t.Errorf("jobs = %+v, want the top job without its result", jobs)
+	}
+
+	for _, body := range []string{`{"kind":"nope"}`, `{"kind":"search"}`, `{"kind":"types"}`, `{"kind":"top","n":-1}`, `{"kind":"top","namespace":"../x"}`} {
+		if resp := s.API(http.MethodPost, "/api/jobs", body); resp.Status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, resp.Status)
+		}
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	var viewer *Viewer
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		// Tx.Check loads the freelist of read-only handles unsynchronized,
+		// keep the sampler's transactions out of the doctor job's way
+		c.stats.interval = 0
+		viewer = c
+	})
+
+	// Jobs that run until cancelled
+	started := make(chan struct{}, maxRunningJobs)
+	blocking := jobKind{unit: "keys", run: func(c *Viewer, j *job, req JobRequest) (interface{}, error) {
+		started <- struct{}{}
+		<-j.ctx.Done()
+		return nil, j.ctx.Err()
+	}}
+	var ids []string
+	for i := 0; i < maxRunningJobs; i++ {
+		j, err := viewer.startJob(blocking, JobRequest{Kind: "blocking"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-started
+		ids = append(ids, j.info.ID)
+	}
+	if resp := s.API(http.MethodPost, "/api/jobs", `{"kind":"doctor"}`); resp.Status != http.StatusTooManyRequests {
+		t.Errorf("status %d, want 429 with %d jobs running", resp.Status, maxRunningJobs)
+	}
+
+	var cancelled map[string]interface{}
+	s.API(http.MethodDelete, "/api/jobs/"+ids[0], "").Decode(t, &cancelled)
+	if cancelled["cancelled"] != true {
+		t.Errorf("delete = %v, want the job cancelled", cancelled)
+	}
+	if job := waitJob(t, s, ids[0]); job.State != JobCancelled || job.Error != "" || job.FinishedAt == nil {
+		t.Errorf("job = %+v, want cancelled", job)
+	}
+
+	// One slot is free again
+	var job Job
+	s.API(http.MethodPost, "/api/jobs", `{"kind":"doctor"}`).Decode(t, &job)
+	if job = waitJob(t, s, job.ID); job.State != JobDone || job.Progress.Done != int64(len(doctorRules)) {
+		t.Errorf("doctor = %+v", job)
+	}
+}
+
+func TestCountKeysJob(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	var job Job
+	s.API(http.MethodPost, "/api/report/count?rate=1000000", "").Decode(t, &job)
+	if job.Request.Kind != "count" || job.Request.Rate != 1000000 {
+		t.Fatalf("job = %+v", job)
+	}
+	if job = waitJob(t, s, job.ID); job.State != JobDone {
+		t.Fatalf("job = %+v", job)
+	}
+	var count struct {
+		Result KeyCountReport `json:"result"`
+	}
+	s.Get("/api/jobs/"+job.ID).Decode(t, &count)
+	// misc holds 3 keys and nested, nested 1 key
+	r := count.Result
+	if r.Keys != 4 || r.Buckets != 2 || len(r.Children) != 1 || r.Children[0].Keys != 4 || r.Children[0].Buckets != 1 {
+		t.Errorf("count = %+v, want 4 keys in 2 buckets", r)
+	}
+
+	s.API(http.MethodPost, "/api/report/count?path=misc", "").Decode(t, &job)
+	job = waitJob(t, s, job.ID)
+	s.Get("/api/jobs/"+job.ID).Decode(t, &count)
+	if r := count.Result; r.Bucket != "misc" || r.Keys != 4 || r.Buckets != 1 || len(r.Children) != 1 || r.Children[0].Path != "misc/nested" {
+		t.Errorf("count of misc = %+v", r)
+	}
+	if job.Request.Rate != defaultCountRate {
+		t.Errorf("rate = %d, want the default", job.Request.Rate)
+	}
+
+	if resp := s.API(http.MethodPost, "/api/report/count?rate=0", ""); resp.Status != http.StatusBadRequest {
+		t.Errorf("rate=0: status %d, want 400", resp.Status)
+	}
+}
@@ -0,0 +1,228 @@
+// listen.go - the addresses the server listens on: TCP addresses, unix
+// domain sockets only local processes and a reverse proxy can reach, so
+// production nodes need not open a port, and several at once, each with
+// its own TLS and authentication, e.g. plain HTTP on localhost for
+// debugging next to HTTPS on the node IP
+package viewer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// unixScheme prefixes --listen addresses of unix domain sockets
+const unixScheme = "unix://"
+
+// socketMode lets the owner and group of the socket connect, e.g. a reverse
+// proxy added to the group
+const socketMode = 0o660
+
+// Authentication of a listener
+const (
+	// ListenerAuthDefault requires the configured OIDC login, if any
+	ListenerAuthDefault = ""
+	// ListenerAuthNone serves without authentication, every client is an
+	// editor
+	ListenerAuthNone = "none"
+	// ListenerAuthOIDC requires the OIDC login
+	ListenerAuthOIDC = "oidc"
+)
+
+// Listener an address the server accepts connections on
+type Listener struct {
+	// Address a TCP host:port such as :8081, or unix:///run/boltdbui.sock
+	Address string
+	// TLSCert and TLSKey PEM files, HTTPS is served when both are set
+	TLSCert string
+	TLSKey  string
+	// Auth ListenerAuthDefault, ListenerAuthNone or ListenerAuthOIDC
+	Auth string
+}
+
+// ParseListener parses a --listen value, the address followed by comma
+// separated options: tls-cert=FILE,tls-key=FILE and auth=none|oidc, e.g.
+// 10.0.0.5:8443,tls-cert=node.crt,tls-key=node.key
+func ParseListener(spec string) (Listener, error) {
+	fields := strings.Split(spec, ",")
+	l := Listener{Address: fields[0]}
+	if l.Address == "" {
+		return l, fmt.Errorf("invalid listener %q, the address is missing", spec)
+	}
+	for _, field := range fields[1:] {
+		name, value, _ := strings.Cut(field, "=")
+		switch name {
+		case "tls-cert":
+			l.TLSCert = value
+		case "tls-key":
+			l.TLSKey = value
+		case "auth":
+			if value != ListenerAuthNone && value != ListenerAuthOIDC {
+				return l, fmt.Errorf("invalid listener %q, auth is %s or %s", spec, ListenerAuthNone, ListenerAuthOIDC)
+			}
+			l.Auth = value
+		default:
+			return l, fmt.Errorf("invalid listener %q, unknown option %q", spec, name)
+		}
+	}
+	if (l.TLSCert == "") != (l.TLSKey == "") {
+		return l, fmt.Errorf("invalid listener %q, tls-cert and tls-key go together", spec)
+	}
+	return l, nil
+}
+
+type listenerContextKey struct{}
+
+// requestListener returns the listener a request arrived on, false for
+// requests not served by Serve, e.g. of an embedding server
+func requestListener(r *http.Request) (Listener, bool) {
+	l, ok := r.Context().Value(listenerContextKey{}).(Listener)
+	return l, ok
+}
+
+// requiresAuth reports whether requests on the listener of r must log in
+func (c *Viewer) requiresAuth(r *http.Request) bool {
+	if c.auth == nil {
+		return false
+	}
+	l, _ := requestListener(r)
+	return l.Auth != ListenerAuthNone
+}
+
+// listenerServer the server of one listener
+type listenerServer struct {
+	Listener
+	ln  net.Listener
+	srv *http.Server
+}
+
+// openListeners listens on all addresses before any is served, so a
+// mistake in one does not leave the others running
+func (c *Viewer) openListeners(listeners []Listener) ([]*listenerServer, error) {
+	if len(listeners) == 0 {
+		return nil, errors.New("no address to listen on")
+	}
+	handler := c.Handler()
+	var servers []*listenerServer
+	closeAll := func() {
+		for _, s := range servers {
+			s.ln.Close()
+		}
+	}
+	for _, l := range listeners {
+		if l.Auth == ListenerAuthOIDC && c.auth == nil {
+			closeAll()
+			return nil, fmt.Errorf("listener %s requires OIDC, which is not configured", l.Address)
+		}
+		var config *tls.Config
+		if l.TLSCert != "" {
+			cert, err := tls.LoadX509KeyPair(l.TLSCert, l.TLSKey)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("failed to load the certificate of %s: %v", l.Address, err)
+			}
+			config = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+		ln, err := listen(l.Address)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		l := l
+		srv := &http.Server{
+			Handler:   handler,
+			TLSConfig: config,
+			BaseContext: func(net.Listener) context.Context {
+				return context.WithValue(context.Background(), listenerContextKey{}, l)
+			},
+		}
+		// Hijacked WebSocket connections are not tracked by Shutdown
+		srv.RegisterOnShutdown(c.closeWebSockets)
+		if c.auth != nil && l.Auth == ListenerAuthNone {
+			slog.Warn("Listener serves without authentication", "address", l.Address)
+		}
+		servers = append(servers, &listenerServer{Listener: l, ln: ln, srv: srv})
+	}
+	return servers, nil
+}
+
+// serve accepts connections until the server is shut down
+func (s *listenerServer) serve() error {
+	// Not TLSConfig, serving plain HTTP sets it up for HTTP/2 as well
+	if s.TLSCert != "" {
+		return s.srv.ServeTLS(s.ln, "", "")
+	}
+	return s.srv.Serve(s.ln)
+}
+
+// url the address the listener is reachable at
+func (s *listenerServer) url() string {
+	return listenURL(s.ln, s.TLSCert != "")
+}
+
+// listen opens the listener of an address, unix:///run/boltdbui.sock or a
+// TCP host:port such as :8081
+func listen(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, unixScheme)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("invalid listen address %q, want unix:///path/to/socket", address)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// The socket file is removed when the listener closes
+	if err := os.Chmod(path, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %v", path, err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket left by a server that did not exit
+// cleanly; a file that is not a socket, or a socket still accepting
+// connections, is an error
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another server", path)
+	}
+	return os.Remove(path)
+}
+
+// listenURL describes the address a listener is reachable at
+func listenURL(ln net.Listener, https bool) string {
+	if ln.Addr().Network() == "unix" {
+		return unixScheme + ln.Addr().String()
+	}
+	scheme := "http://"
+	if https {
+		scheme = "https://"
+	}
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && addr.IP.IsUnspecified() {
+		return fmt.Sprintf("%slocalhost:%d", scheme, addr.Port)
+	}
+	return scheme + ln.Addr().String()
+}
@@ -0,0 +1,168 @@
+package viewer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket permissions and stale sockets are unix behavior")
+	}
+	path := filepath.Join(t.TempDir(), "boltdbui.sock")
+	address := unixScheme + path
+
+	// Left behind by a server that was killed
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen(address)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	if got := listenURL(ln, false); got != address {
+		t.Errorf("url = %s, want %s", got, address)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != socketMode {
+		t.Errorf("socket %v: %v", info, err)
+	}
+
+	viewer := newViewer(boltdbtest.Tiny(t))
+	t.Cleanup(func() { viewer.Close() })
+	srv := &http.Server{Handler: viewer.Handler()}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://boltdbui/api/buckets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"misc"`) {
+		t.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+
+	if _, err := listen(address); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("second listener: %v, want in use", err)
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	if _, err := listen(unixScheme + file); err == nil {
+		t.Error("regular file replaced by a socket")
+	}
+	if _, err := listen(unixScheme); err == nil {
+		t.Error("empty socket path accepted")
+	}
+}
+
+func TestParseListener(t *testing.T) {
+	l, err := ParseListener("10.0.0.5:8443,tls-cert=node.crt,tls-key=node.key,auth=oidc")
+	if err != nil || l != (Listener{Address: "10.0.0.5:8443", TLSCert: "node.crt", TLSKey: "node.key", Auth: ListenerAuthOIDC}) {
+		t.Errorf("listener = %+v, %v", l, err)
+	}
+	for _, spec := range []string{"", ",auth=none", ":8081,auth=basic", ":8081,tls-cert=a.crt", ":8081,port=1"} {
+		if _, err := ParseListener(spec); err == nil {
+			t.Errorf("%q accepted", spec)
+		}
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestListeners(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	viewer := newViewer(boltdbtest.Tiny(t))
+	t.Cleanup(func() { viewer.Close() })
+	// Requests without a token are rejected before the provider is asked
+	viewer.auth = &oidcAuth{}
+
+	servers, err := viewer.openListeners([]Listener{
+		{Address: "127.0.0.1:0", TLSCert: certFile, TLSKey: keyFile, Auth: ListenerAuthNone},
+		{Address: "127.0.0.1:0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		go s.serve()
+		t.Cleanup(func() { s.srv.Close() })
+	}
+
+	insecure := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		url := servers[i].url()
+		if want := []string{"https://", "http://"}[i]; !strings.HasPrefix(url, want) {
+			t.Errorf("url %s, want %s", url, want)
+		}
+		resp, err := insecure.Get(url + "/api/buckets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: status %d, want %d", url, resp.StatusCode, want)
+		}
+	}
+
+	// Nothing is left listening when one address fails
+	taken := servers[1].ln.Addr().String()
+	if _, err := viewer.openListeners([]Listener{{Address: "127.0.0.1:0"}, {Address: taken}}); err == nil {
+		t.Errorf("%s listened on twice", taken)
+	}
+	if _, err := newViewer(boltdbtest.Tiny(t)).openListeners([]Listener{{Address: "127.0.0.1:0", Auth: ListenerAuthOIDC}}); err == nil {
+		t.Error("auth=oidc accepted without OIDC")
+	}
+}
@@ -0,0 +1,53 @@
+// logging.go - diagnostics through log/slog, leveled and with structured
+// fields, written as text or JSON lines to stderr
+package viewer
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/spf13/pflag"
+)
+
+// diagnostic log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// logOptions flags of the diagnostic log, shared by all commands
+var logOptions struct {
+	level  string
+	format string
+}
+
+// addLogFlags registers the diagnostic log flags
+func addLogFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&logOptions.level, "log-level", "info", "Lowest level logged: debug, info, warn or error")
+	fs.StringVar(&logOptions.format, "log-format", LogFormatText, "Log format: text (key=value pairs) or json (JSON lines)")
+}
+
+// setupLogging makes the default logger write to w at the configured
+// level, debug with --verbose
+func setupLogging(w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logOptions.level)); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", logOptions.level)
+	}
+	if verbose {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch logOptions.format {
+	case "", LogFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected %s or %s", logOptions.format, LogFormatText, LogFormatJSON)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
@@ -0,0 +1,38 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	previous := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		logOptions.level, logOptions.format = "", ""
+	})
+
+	var buf bytes.Buffer
+	logOptions.level, logOptions.format = "warn", LogFormatJSON
+	if err := setupLogging(&buf); err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("Wrote key", "bucket", "v1/default", "key", "a")
+	slog.Warn("Stopped streaming bucket", "bucket", "v1/default", "error", "closed")
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%s: %v", buf.Bytes(), err)
+	}
+	if entry["level"] != "WARN" || entry["msg"] != "Stopped streaming bucket" || entry["bucket"] != "v1/default" || entry["error"] != "closed" {
+		t.Errorf("entry = %v", entry)
+	}
+
+	for _, opts := range [][2]string{{"verbose", LogFormatText}, {"info", "logfmt"}} {
+		logOptions.level, logOptions.format = opts[0], opts[1]
+		if err := setupLogging(&buf); err == nil {
+			t.Errorf("%v accepted", opts)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+// metrics.go - latency and database operation histograms, exposed in the
+// Prometheus text format at /metrics and as JSON at /api/perf
+package viewer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket bounds of the histograms
+var (
+	durationBounds = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	bytesBounds    = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20, 256 << 20, 1 << 30}
+)
+
+// Transaction kinds, the label of the transaction histograms
+const (
+	txRead  = "read"
+	txWrite = "write"
+)
+
+// histogram counts observations in cumulative buckets like a Prometheus
+// histogram
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64 // per bound, the last one counting above all bounds
+	sum    float64
+	count  uint64
+}
+
+// histogramVec a histogram per combination of label values
+type histogramVec struct {
+	name   string
+	help   string
+	labels []string
+	bounds []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// histogramSeries the histogram of one combination of label values
+type histogramSeries struct {
+	values []string
+	histogram
+}
+
+func newHistogramVec(name, help string, bounds []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, bounds: bounds, series: map[string]*histogramSeries{}}
+}
+
+// observe adds v to the histogram of the label values
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := strings.Join(values, "\x00")
+	h.mu.Lock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: values, histogram: histogram{counts: make([]uint64, len(h.bounds)+1)}}
+		h.series[key] = s
+	}
+	h.mu.Unlock()
+
+	i := sort.SearchFloat64s(h.bounds, v)
+	s.mu.Lock()
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	s.mu.Unlock()
+}
+
+// perfMetrics the histograms of the process, shared by the viewers of
+// uploaded and discovered databases like expvar's variables
+type perfMetrics struct {
+	requests  *histogramVec
+	opens     *histogramVec
+	txs       *histogramVec
+	txScanned *histogramVec
+}
+
+var perf = perfMetrics{
+	requests:  newHistogramVec("boltdbui_http_request_duration_seconds", "Latency of API requests by route.", durationBounds, "method", "route"),
+	opens:     newHistogramVec("boltdbui_bolt_open_duration_seconds", "Duration of bolt.Open, including the wait for the file lock.", durationBounds),
+	txs:       newHistogramVec("boltdbui_bolt_transaction_duration_seconds", "Duration of bolt transactions by kind.", durationBounds, "kind"),
+	txScanned: newHistogramVec("boltdbui_bolt_transaction_scanned_bytes", "Bytes of keys, values and pages visited per transaction by listings, searches, dumps and exports.", bytesBounds, "kind"),
+}
+
+// meteredDB a database handle whose transactions are measured; openDB
+// returns it so every handler is covered
+type meteredDB struct {
+	*bolt.DB
+}
+
+// txMeter the bytes scanned by one transaction, see scanned
+type txMeter struct {
+	mu    sync.Mutex
+	bytes int64
+}
+
+// txMeters the meter of each running measured transaction
+var txMeters sync.Map // *bolt.Tx -> *txMeter
+
+// scanned adds n bytes visited by tx to its meter; walkers call it once per
+// bucket rather than per key
+func scanned(tx *bolt.Tx, n int64) {
+	if m, ok := txMeters.Load(tx); ok {
+		m := m.(*txMeter)
+		m.mu.Lock()
+		m.bytes += n
+		m.mu.Unlock()
+	}
+}
+
+// View runs fn in a measured read transaction
+func (db *meteredDB) View(fn func(tx *bolt.Tx) error) error {
+	return measureTx(txRead, db.DB.View, fn)
+}
+
+// Update runs fn in a measured read-write transaction
+func (db *meteredDB) Update(fn func(tx *bolt.Tx) error) error {
+	return measureTx(txWrite, db.DB.Update, fn)
+}
+
+// measureTx runs fn in a transaction of run and observes its duration and
+// the bytes it scanned
+func measureTx(kind string, run func(func(*bolt.Tx) error) error, fn func(tx *bolt.Tx) error) error {
+	m := &txMeter{}
+	start := time.Now()
+	err := run(func(tx *bolt.Tx) error {
+		txMeters.Store(tx, m)
+		defer txMeters.Delete(tx)
+		return fn(tx)
+	})
+	perf.txs.observe(time.Since(start).Seconds(), kind)
+	m.mu.Lock()
+	perf.txScanned.observe(float64(m.bytes), kind)
+	m.mu.Unlock()
+	return err
+}
+
+// measureRequests middleware observes the latency of API requests by route
+// template, so /api/bucket/{path:.*} is one series; WebSockets are skipped
+func (c *Viewer) measureRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusSwitchingProtocols {
+			return
+		}
+		route := "unknown"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if template, err := cur.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		perf.requests.observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// handleMetrics writes the histograms in the Prometheus text format
+func (c *Viewer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, h := range []*histogramVec{perf.requests, perf.opens, perf.txs, perf.txScanned} {
+		h.writeText(w)
+	}
+}
+
+// writeText writes the series of h in the Prometheus text format
+func (h *histogramVec) writeText(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, s := range h.snapshot() {
+		labels := ""
+		for i, name := range h.labels {
+			labels += fmt.Sprintf("%s=%q,", name, s.values[i])
+		}
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%g\"} %d\n", h.name, labels, bound, cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", h.name, labels, s.count)
+		labels = strings.TrimSuffix(labels, ",")
+		if labels != "" {
+			labels = "{" + labels + "}"
+		}
+		fmt.Fprintf(w, "%s_sum%s %g\n%s_count%s %d\n", h.name, labels, s.sum, h.name, labels, s.count)
+	}
+}
+
+// histogramState a consistent copy of a series
+type histogramState struct {
+	values []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// snapshot copies the series ordered by label values
+func (h *histogramVec) snapshot() []histogramState {
+	h.mu.Lock()
+	series := make([]*histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		series = append(series, s)
+	}
+	h.mu.Unlock()
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].values, "\x00") < strings.Join(series[j].values, "\x00")
+	})
+
+	states := make([]histogramState, len(series))
+	for i, s := range series {
+		s.mu.Lock()
+		states[i] = histogramState{values: s.values, counts: append([]uint64(nil), s.counts...), sum: s.sum, count: s.count}
+		s.mu.Unlock()
+	}
+	return states
+}
+
+// quantile estimates the q quantile by linear interpolation within the
+// bucket holding it, like PromQL's histogram_quantile
+func (s histogramState) quantile(bounds []float64, q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := q * float64(s.count)
+	var cumulative uint64
+	for i, n := range s.counts {
+		if float64(cumulative+n) < rank {
+			cumulative += n
+			continue
+		}
+		if i == len(bounds) {
+			// Above the largest bound, which is all that is known
+			return bounds[len(bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		}
+		return lower + (bounds[i]-lower)*(rank-float64(cumulative))/float64(n)
+	}
+	return bounds[len(bounds)-1]
+}
+
+// PerfSummary one series of a histogram in /api/perf
+type PerfSummary struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Count  uint64            `json:"count"`
+	Sum    float64           `json:"sum"`
+	Mean   float64           `json:"mean"`
+	// P50, P90 and P99 estimated from the buckets
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// PerfReport the histograms of /metrics summarized, durations in seconds
+type PerfReport struct {
+	Requests       []PerfSummary `json:"requests"`
+	Opens          []PerfSummary `json:"opens"`
+	Transactions   []PerfSummary `json:"transactions"`
+	ScannedPerTx   []PerfSummary `json:"scannedBytesPerTransaction"`
+	OpenTxN        int           `json:"openTxN"`
+	StartedReadTxN int           `json:"startedReadTxN"`
+}
+
+// summarize the series of h, the slowest first for requests
+func (h *histogramVec) summarize() []PerfSummary {
+	states := h.snapshot()
+	summaries := make([]PerfSummary, 0, len(states))
+	for _, s := range states {
+		sum := PerfSummary{
+			Count: s.count,
+			Sum:   s.sum,
+			P50:   s.quantile(h.bounds, 0.5),
+			P90:   s.quantile(h.bounds, 0.9),
+			P99:   s.quantile(h.bounds, 0.99),
+		}
+		if s.count > 0 {
+			sum.Mean = s.sum / float64(s.count)
+		}
+		if len(h.labels) > 0 {
+			sum.Labels = map[string]string{}
+			for i, name := range h.labels {
+				sum.Labels[name] = s.values[i]
+			}
+		}
+		summaries = append(summaries, sum)
+	}
+	return summaries
+}
+
+// handleGetPerf summarizes the histograms, requests ordered by total time
+// spent so the endpoints worth optimizing come first
+func (c *Viewer) handleGetPerf(w http.ResponseWriter, r *http.Request) {
+	report := PerfReport{
+		Requests:     perf.requests.summarize(),
+		Opens:        perf.opens.summarize(),
+		Transactions: perf.txs.summarize(),
+		ScannedPerTx: perf.txScanned.summarize(),
+	}
+	sort.SliceStable(report.Requests, func(i, j int) bool {
+		return report.Requests[i].Sum > report.Requests[j].Sum
+	})
+	// A frontend has no database of its own
+	if c.databasePath() != "" {
+		if db, err := c.openDB(); err == nil {
+			stats := db.Stats()
+			report.OpenTxN, report.StartedReadTxN = stats.OpenTxN, stats.TxN
+		}
+	}
+	c.sendSuccess(w, roundPerf(report))
+}
+
+// roundPerf keeps microseconds and whole bytes, the estimates are not more
+// precise than that
+func roundPerf(report PerfReport) PerfReport {
+	round := func(summaries []PerfSummary, scale float64) {
+		for i := range summaries {
+			s := &summaries[i]
+			for _, v := range []*float64{&s.Sum, &s.Mean, &s.P50, &s.P90, &s.P99} {
+				*v = math.Round(*v*scale) / scale
+			}
+		}
+	}
+	round(report.Requests, 1e6)
+	round(report.Opens, 1e6)
+	round(report.Transactions, 1e6)
+	round(report.ScannedPerTx, 1)
+	return report
+}
@@ -0,0 +1,74 @@
+package viewer
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+	s.Get("/api/buckets")
+	s.Get("/api/bucket/misc")
+	s.Get("/api/bucket/misc/nested")
+
+	status, body := s.Do(http.MethodGet, "/metrics", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /metrics: status %d", status)
+	}
+	for _, want := range []string{
+		"# TYPE boltdbui_http_request_duration_seconds histogram",
+		`boltdbui_http_request_duration_seconds_bucket{method="GET",route="/api/bucket/{path:.*}",le="+Inf"}`,
+		"boltdbui_bolt_open_duration_seconds_count ",
+		`boltdbui_bolt_transaction_duration_seconds_count{kind="read"}`,
+		`boltdbui_bolt_transaction_scanned_bytes_sum{kind="read"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics lacks %s", want)
+		}
+	}
+
+	var report PerfReport
+	s.Get("/api/perf").Decode(t, &report)
+	var bucketRoute *PerfSummary
+	for i, sum := range report.Requests {
+		if sum.Labels["route"] == "/api/bucket/{path:.*}" {
+			bucketRoute = &report.Requests[i]
+		}
+	}
+	// The histograms are shared by the tests of the package
+	if bucketRoute == nil || bucketRoute.Count < 2 || bucketRoute.P50 > bucketRoute.P99 {
+		t.Errorf("bucket route = %+v, want two requests or more", bucketRoute)
+	}
+	if len(report.Opens) != 1 || report.Opens[0].Count == 0 {
+		t.Errorf("opens = %+v, want one series", report.Opens)
+	}
+	if len(report.Transactions) == 0 || len(report.ScannedPerTx) == 0 {
+		t.Errorf("transactions = %+v, scanned = %+v, want the read series", report.Transactions, report.ScannedPerTx)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := newHistogramVec("test", "", []float64{1, 2, 4})
+	for _, v := range []float64{0.5, 1.5, 1.5, 3} {
+		h.observe(v)
+	}
+	state := h.snapshot()[0]
+	for _, tc := range []struct{ q, want float64 }{
+		{0.25, 1},
+		{0.5, 1.5},
+		{1, 4},
+	} {
+		if got := state.quantile(h.bounds, tc.q); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("quantile(%g) = %g, want %g", tc.q, got, tc.want)
+		}
+	}
+
+	h.observe(100)
+	if got := h.snapshot()[0].quantile(h.bounds, 0.99); got != 4 {
+		t.Errorf("quantile above the bounds = %g, want the largest bound", got)
+	}
+}
@@ -0,0 +1,234 @@
+// mode.go - read-only vs read-write server modes and mutating endpoints
+package viewer
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// server modes
+const (
+	ModeReadOnly  = "read-only"
+	ModeReadWrite = "read-write"
+)
+
+// maxWriteValueSize limits values written through the API
+const maxWriteValueSize = 64 * 1024 * 1024
+
+// Capabilities what the server allows, used by the frontend to hide
+// unavailable actions
+type Capabilities struct {
+	Mode string `json:"mode"`
+	// ReadOnly and Actions are for the user of the request, Role its role
+	// when authentication is enabled
+	ReadOnly bool   `json:"readOnly"`
+	Role     string `json:"role,omitempty"`
+	// Node the node of an agent, see daemonset.go
+	Node     string          `json:"node,omitempty"`
+	Actions  map[string]bool `json:"actions"`
+	Features map[string]bool `json:"features"`
+}
+
+// parseMode validates a --mode flag value
+func parseMode(mode string) (string, error) {
+	switch mode {
+	case "", ModeReadOnly, "ro":
+		return ModeReadOnly, nil
+	case ModeReadWrite, "rw":
+		return ModeReadWrite, nil
+	}
+	return "", fmt.Errorf("invalid mode %q, expected %s or %s", mode, ModeReadOnly, ModeReadWrite)
+}
+
+// writable reports whether mutating endpoints are enabled
+func (c *Viewer) writable() bool {
+	return c.mode == ModeReadWrite
+}
+
+// capabilities describes the server mode and enabled features for the user
+// of r
+func (c *Viewer) capabilities(r *http.Request) Capabilities {
+	mode := c.mode
+	if mode == "" {
+		mode = ModeReadOnly
+	}
+	edit := c.writable() && canEdit(r)
+	var role string
+	if user, ok := userFromContext(r.Context()); ok {
+		role = user.Role
+	}
+
+	return Capabilities{
+		Mode:     mode,
+		ReadOnly: !edit,
+		Role:     role,
+		Node:     c.nodeName,
+		Actions: map[string]bool{
+			"write":    edit,
+			"delete":   edit,
+			"compact":  edit,
+			"sequence": edit,
+			"copy":     edit,
+			"rename":   edit,
+			"switch":   edit,
+		},
+		Features: map[string]bool{
+			"auth":             c.auth != nil,
+			"sessionRecording": c.session != nil,
+			"scripting":        true,
+			"history":          c.history.size > 0,
+			"bookmarks":        c.bookmarksPath != "",
+			"preferences":      c.bookmarksPath != "",
+			"snapshot":         c.snapshotInterval > 0,
+			"reload":           c.databasePath() != "",
+			"upload":           edit && c.uploads.maxBytes > 0,
+			"discover":         c.discovery != nil,
+			"nodes":            c.agents != nil,
+			"etcd":             c.detectSchema(isEtcd),
+			"dockerNetwork":    c.detectSchema(isDockerNetwork),
+			"dockerVolumes":    c.detectSchema(isDockerVolumes),
+		},
+	}
+}
+
+// detectSchema reports whether the database matches a schema such as
+// isEtcd, false if it cannot be opened
+func (c *Viewer) detectSchema(is func(tx *bolt.Tx) bool) bool {
+	db, err := c.openDB()
+	if err != nil {
+		return false
+	}
+	found := false
+	db.View(func(tx *bolt.Tx) error {
+		found = is(tx)
+		return nil
+	})
+	return found
+}
+
+// handleGetCapabilities returns the server capabilities
+func (c *Viewer) handleGetCapabilities(w http.ResponseWriter, r *http.Request) {
+	c.sendSuccess(w, c.capabilities(r))
+}
+
+// mutating wraps handlers that modify data so they are rejected unless the
+// server runs in read-write mode and the user is an editor
+func (c *Viewer) mutating(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.writable() {
+			c.sendErrorCode(w, http.StatusForbidden, "Server is in read-only mode", nil)
+			return
+		}
+		if !canEdit(r) {
+			c.sendErrorCode(w, http.StatusForbidden, "Editor role required", nil)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handlePutKey stores the request body as the value of a key
+func (c *Viewer) handlePutKey(w http.ResponseWriter, r *http.Request) {
+	bucketPath, key, err := keyVars(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid key path", err)
+		return
+	}
+
+	value, err := io.ReadAll(io.LimitReader(r.Body, maxWriteValueSize+1))
+	if err != nil {
+		c.sendError(w, "Failed to read value", err)
+		return
+	}
+	if len(value) > maxWriteValueSize {
+		c.sendErrorCode(w, http.StatusRequestEntityTooLarge, "Value too large", nil)
+		return
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		c.sendError(w, "Failed to open database", err)
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		if b.Bucket([]byte(key)) != nil {
+			return fmt.Errorf("%s is a bucket", key)
+		}
+		return b.Put([]byte(key), value)
+	})
+	if err != nil {
+		c.sendError(w, "Failed to write key", err)
+		return
+	}
+
+	slog.Info("Wrote key", "bucket", bucketPath, "key", key, "size", len(value))
+	c.sendSuccess(w, map[string]interface{}{
+		"bucket": bucketPath,
+		"key":    key,
+		"size":   len(value),
+	})
+}
+
+// handleDeleteKey deletes a key
+func (c *Viewer) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
+	bucketPath, key, err := keyVars(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid key path", err)
+		return
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		c.sendError(w, "Failed to open database", err)
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		if b.Get([]byte(key)) == nil {
+			return fmt.Errorf("key not found: %s", key)
+		}
+		return b.Delete([]byte(key))
+	})
+	if err != nil {
+		c.sendError(w, "Failed to delete key", err)
+		return
+	}
+
+	slog.Info("Deleted key", "bucket", bucketPath, "key", key)
+	c.sendSuccess(w, map[string]interface{}{
+		"bucket": bucketPath,
+		"key":    key,
+	})
+}
+
+// keyVars decodes the bucketPath and key route variables
+func keyVars(r *http.Request) (string, string, error) {
+	vars := mux.Vars(r)
+
+	bucketPath, err := url.PathUnescape(vars["bucketPath"])
+	if err != nil {
+		return "", "", err
+	}
+	key, err := url.PathUnescape(vars["key"])
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.Trim(bucketPath, "/"), key, nil
+}
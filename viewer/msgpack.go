@@ -0,0 +1,202 @@
+// msgpack.go - MessagePack values decoded into generic structures
+package viewer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// msgpackTimestampExt the extension type of MessagePack timestamps
+const msgpackTimestampExt = -1
+
+// byteReader consumes a value's bytes
+type byteReader struct {
+	data []byte
+}
+
+func (r *byteReader) take(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)) {
+		return nil, fmt.Errorf("%d bytes needed, %d left", n, len(r.data))
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+// uint reads an n byte big-endian unsigned integer
+func (r *byteReader) uint(n int) (uint64, error) {
+	b, err := r.take(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// decodeMsgpack decodes value as exactly one MessagePack value
+func decodeMsgpack(value []byte) (interface{}, error) {
+	r := &byteReader{data: value}
+	v, err := msgpackValue(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.data) > 0 {
+		return nil, fmt.Errorf("%d bytes after the value", len(r.data))
+	}
+	return v, nil
+}
+
+// msgpackValue reads one value, see
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+func msgpackValue(r *byteReader, depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, fmt.Errorf("values nested deeper than %d", maxDecodeDepth)
+	}
+	b, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return b, nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b <= 0x8f:
+		return msgpackMap(r, b&0x0f, depth)
+	case b <= 0x9f:
+		return msgpackArray(r, b&0x0f, depth)
+	case b <= 0xbf:
+		s, err := r.take(b & 0x1f)
+		return string(s), err
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.take(n)
+		return textOrHex(data), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.uint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackExt(r, n)
+	case 0xca:
+		u, err := r.uint(4)
+		return jsonFloat(float64(math.Float32frombits(uint32(u)))), err
+	case 0xcb:
+		u, err := r.uint(8)
+		return jsonFloat(math.Float64frombits(u)), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return r.uint(1 << (b - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		u, err := r.uint(size)
+		// Sign extend from the top bit of the value
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return msgpackExt(r, 1<<(b-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.take(n)
+		return string(s), err
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackMap(r, n, depth)
+	}
+	return nil, fmt.Errorf("invalid MessagePack type byte 0x%02x", b)
+}
+
+func msgpackArray(r *byteReader, n uint64, depth int) (interface{}, error) {
+	// Every element takes at least a byte
+	if n > uint64(len(r.data)) {
+		return nil, fmt.Errorf("array of %d elements exceeds the %d bytes left", n, len(r.data))
+	}
+	items := make([]interface{}, 0, n)
+	for i := uint64(0); i < n; i++ {
+		v, err := msgpackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// msgpackMap reads a map; keys other than strings are formatted, JSON
+// objects only have string keys
+func msgpackMap(r *byteReader, n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(r.data))/2 {
+		return nil, fmt.Errorf("map of %d entries exceeds the %d bytes left", n, len(r.data))
+	}
+	entries := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		k, err := msgpackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := msgpackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entries[fmt.Sprint(k)] = v
+	}
+	return entries, nil
+}
+
+// msgpackExt reads an extension of n data bytes: timestamps as RFC 3339,
+// application types as their type and data
+func msgpackExt(r *byteReader, n uint64) (interface{}, error) {
+	typ, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.take(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != msgpackTimestampExt {
+		return map[string]interface{}{"ext": int8(typ), "data": textOrHex(data)}, nil
+	}
+
+	var sec, nsec int64
+	switch len(data) {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(data))
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		nsec, sec = int64(v>>34), int64(v&(1<<34-1))
+	case 12:
+		nsec, sec = int64(binary.BigEndian.Uint32(data)), int64(binary.BigEndian.Uint64(data[4:]))
+	default:
+		return nil, fmt.Errorf("invalid timestamp of %d bytes", len(data))
+	}
+	return time.Unix(sec, nsec).UTC().Format(time.RFC3339Nano), nil
+}
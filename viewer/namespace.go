@@ -0,0 +1,262 @@
+// namespace.go - scoping listings, search and reports to a containerd namespace
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// namespaceParam query parameter selecting a namespace
+	namespaceParam = "namespace"
+	// maxNamespaceLength mirrors containerd's identifiers package
+	maxNamespaceLength = 76
+)
+
+// namespacePattern valid containerd namespace, see containerd/identifiers
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9]+(?:[._-][A-Za-z0-9]+)*$`)
+
+// Namespace a containerd namespace and the objects it holds
+type Namespace struct {
+	Name       string            `json:"name"`
+	Path       string            `json:"path"`
+	Images     int               `json:"images"`
+	Containers int               `json:"containers"`
+	Snapshots  int               `json:"snapshots"`
+	Content    int               `json:"content"`
+	Leases     int               `json:"leases"`
+	Sandboxes  int               `json:"sandboxes"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// NamespaceSummary the object counts of a namespace and the bytes its
+// metadata takes
+type NamespaceSummary struct {
+	Namespace
+	// Bytes the in-use bytes of the pages of the namespace bucket: keys,
+	// values and bolt's page headers
+	Bytes int64 `json:"bytes"`
+}
+
+// ContainerdSummary an overview of a containerd database, the namespaces
+// and their sums
+type ContainerdSummary struct {
+	Namespaces []NamespaceSummary `json:"namespaces"`
+	Total      SummaryTotal       `json:"total"`
+}
+
+// SummaryTotal the counts and bytes of all namespaces
+type SummaryTotal struct {
+	Images     int   `json:"images"`
+	Containers int   `json:"containers"`
+	Snapshots  int   `json:"snapshots"`
+	Content    int   `json:"content"`
+	Leases     int   `json:"leases"`
+	Sandboxes  int   `json:"sandboxes"`
+	Bytes      int64 `json:"bytes"`
+}
+
+// parseNamespace returns the validated ?namespace= of a request, empty if
+// the request is not scoped
+func parseNamespace(r *http.Request) (string, error) {
+	ns := r.URL.Query().Get(namespaceParam)
+	if err := checkNamespace(ns); err != nil {
+		return "", err
+	}
+	return ns, nil
+}
+
+// checkNamespace validates a namespace name, empty meaning all of them
+func checkNamespace(ns string) error {
+	if ns != "" && (len(ns) > maxNamespaceLength || !namespacePattern.MatchString(ns)) {
+		return fmt.Errorf("invalid namespace %q", ns)
+	}
+	return nil
+}
+
+// namespacePath bucket path of a namespace
+func namespacePath(ns string) string {
+	return string(bucketKeyVersion) + "/" + ns
+}
+
+// namespaceBucket returns the bucket of a namespace
+func namespaceBucket(tx *bolt.Tx, ns string) (*bolt.Bucket, error) {
+	v1 := tx.Bucket(bucketKeyVersion)
+	if v1 == nil {
+		return nil, fmt.Errorf("not a containerd metadata database: bucket %q not found", bucketKeyVersion)
+	}
+	nsb := v1.Bucket([]byte(ns))
+	if nsb == nil {
+		return nil, fmt.Errorf("namespace not found: %s", ns)
+	}
+	return nsb, nil
+}
+
+// scopedPath applies ?namespace= to a bucket path parameter: an empty path
+// becomes the namespace bucket, other paths must be inside it
+func scopedPath(ns, path string) (string, error) {
+	path = strings.Trim(path, "/")
+	if ns == "" {
+		return path, nil
+	}
+	root := namespacePath(ns)
+	if path == "" {
+		return root, nil
+	}
+	if path != root && !strings.HasPrefix(path, root+"/") {
+		return "", fmt.Errorf("bucket %s is outside namespace %s", path, ns)
+	}
+	return path, nil
+}
+
+// scopedPathParam returns ?path= scoped to ?namespace=
+func scopedPathParam(r *http.Request) (string, error) {
+	ns, err := parseNamespace(r)
+	if err != nil {
+		return "", err
+	}
+	return scopedPath(ns, r.URL.Query().Get("path"))
+}
+
+// scopeBucketTree keeps the namespace in a tree of top level buckets, the
+// v1 bucket with only that namespace below it so paths stay unchanged
+func scopeBucketTree(tree []BucketInfo, ns string) []BucketInfo {
+	for _, top := range tree {
+		if top.Name != string(bucketKeyVersion) {
+			continue
+		}
+		for _, sub := range top.SubBuckets {
+			if sub.Name == ns {
+				top.SubBuckets = []BucketInfo{sub}
+				return []BucketInfo{top}
+			}
+		}
+	}
+	return []BucketInfo{}
+}
+
+// handleListNamespaces lists the namespaces with their object counts
+func (c *Viewer) handleListNamespaces(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := c.listNamespaces()
+	if err != nil {
+		c.sendError(w, "Failed to list namespaces", err)
+		return
+	}
+	c.sendSuccess(w, namespaces)
+}
+
+// listNamespaces counts the images, containers, snapshots (of all
+// snapshotters), content blobs and leases of every namespace
+func (c *Viewer) listNamespaces() ([]Namespace, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := []Namespace{}
+	err = db.View(func(tx *bolt.Tx) error {
+		return forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+			namespaces = append(namespaces, countNamespace(ns, nsb))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return namespaces, nil
+}
+
+// countNamespace counts the objects of the namespace bucket nsb
+func countNamespace(ns string, nsb *bolt.Bucket) Namespace {
+	n := Namespace{
+		Name:       ns,
+		Path:       namespacePath(ns),
+		Images:     countSubBuckets(nsb.Bucket(bucketKeyObjectImages)),
+		Containers: countSubBuckets(nsb.Bucket(bucketKeyObjectContainers)),
+		Leases:     countSubBuckets(nsb.Bucket(bucketKeyObjectLeases)),
+		Sandboxes:  countSubBuckets(nsb.Bucket(bucketKeyObjectSandboxes)),
+		Labels:     readLabels(nsb),
+	}
+	if cb := nsb.Bucket(bucketKeyObjectContent); cb != nil {
+		n.Content = countSubBuckets(cb.Bucket(bucketKeyObjectBlob))
+	}
+	if sb := nsb.Bucket(bucketKeyObjectSnapshots); sb != nil {
+		sb.ForEach(func(k, v []byte) error {
+			if v == nil {
+				n.Snapshots += countSubBuckets(sb.Bucket(k))
+			}
+			return nil
+		})
+	}
+	return n
+}
+
+// handleSummary returns the object counts and metadata bytes of every
+// namespace and their totals
+func (c *Viewer) handleSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := c.containerdSummary()
+	if err != nil {
+		c.sendError(w, "Failed to build summary", err)
+		return
+	}
+	c.sendSuccess(w, summary)
+}
+
+// containerdSummary counts the objects of every namespace like
+// listNamespaces and adds the size of their buckets
+func (c *Viewer) containerdSummary() (*ContainerdSummary, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ContainerdSummary{Namespaces: []NamespaceSummary{}}
+	err = db.View(func(tx *bolt.Tx) error {
+		return forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+			// Stats covers the nested buckets; inline buckets are part of
+			// their parent's leaf, unless the namespace itself is inline
+			stats := nsb.Stats()
+			n := NamespaceSummary{
+				Namespace: countNamespace(ns, nsb),
+				Bytes:     int64(stats.LeafInuse + stats.BranchInuse),
+			}
+			if nsb.Root() == 0 {
+				n.Bytes = int64(stats.InlineBucketInuse)
+			}
+			summary.Namespaces = append(summary.Namespaces, n)
+
+			t := &summary.Total
+			t.Images += n.Images
+			t.Containers += n.Containers
+			t.Snapshots += n.Snapshots
+			t.Content += n.Content
+			t.Leases += n.Leases
+			t.Sandboxes += n.Sandboxes
+			t.Bytes += n.Bytes
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// countSubBuckets counts the nested buckets of b, 0 if b is nil
+func countSubBuckets(b *bolt.Bucket) int {
+	if b == nil {
+		return 0
+	}
+	n := 0
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			n++
+		}
+		return nil
+	})
+	return n
+}
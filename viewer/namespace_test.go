@@ -0,0 +1,107 @@
+package viewer
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestListNamespaces(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var namespaces []Namespace
+	s.Get("/api/namespaces").Decode(t, &namespaces)
+	if len(namespaces) != len(boltdbtest.Namespaces) {
+		t.Fatalf("namespaces = %+v, want %v", namespaces, boltdbtest.Namespaces)
+	}
+	ns := namespaces[1]
+	if ns.Name != "k8s.io" || ns.Path != "v1/k8s.io" {
+		t.Errorf("namespace = %+v, want k8s.io", ns)
+	}
+	if ns.Images != 1 || ns.Containers != 1 || ns.Snapshots != 3 || ns.Content != 5 || ns.Leases != 1 {
+		t.Errorf("counts = %+v, want 1 image, 1 container, 3 snapshots, 5 blobs, 1 lease", ns)
+	}
+}
+
+func TestContainerdSummary(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var summary ContainerdSummary
+	s.Get("/api/containerd/summary").Decode(t, &summary)
+	if len(summary.Namespaces) != len(boltdbtest.Namespaces) {
+		t.Fatalf("namespaces = %+v, want %v", summary.Namespaces, boltdbtest.Namespaces)
+	}
+	var bytes int64
+	for _, ns := range summary.Namespaces {
+		if ns.Containers != 1 || ns.Content != 5 || ns.Bytes <= 0 {
+			t.Errorf("%s = %+v, want 1 container, 5 blobs and its bytes", ns.Name, ns)
+		}
+		bytes += ns.Bytes
+	}
+	n := len(boltdbtest.Namespaces)
+	total := summary.Total
+	if total.Images != n || total.Containers != n || total.Snapshots != 3*n || total.Content != 5*n || total.Leases != n || total.Bytes != bytes {
+		t.Errorf("total = %+v, want the sums of %d namespaces", total, n)
+	}
+}
+
+func TestNamespaceScope(t *testing.T) {
+	for _, cached := range []bool{true, false} {
+		s := newTestServer(t, boltdbtest.Containerd(t), func(c *Viewer) {
+			if !cached {
+				c.tree.ttl = 0
+			}
+		})
+
+		var buckets []BucketInfo
+		s.Get("/api/buckets?namespace=k8s.io").Decode(t, &buckets)
+		if len(buckets) != 1 || len(buckets[0].SubBuckets) != 1 || buckets[0].SubBuckets[0].Path != "v1/k8s.io" {
+			t.Errorf("cached %v: buckets = %+v, want only v1/k8s.io", cached, buckets)
+		}
+		if resp := s.API(http.MethodGet, "/api/buckets?namespace=missing", ""); resp.Success {
+			t.Errorf("cached %v: unknown namespace succeeded", cached)
+		}
+	}
+
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var results []map[string]interface{}
+	s.Get("/api/search?q=createdat&namespace=moby").Decode(t, &results)
+	if len(results) == 0 {
+		t.Fatal("no search results in moby")
+	}
+	for _, r := range results {
+		if !strings.HasPrefix(r["path"].(string), "v1/moby/") {
+			t.Errorf("result %v outside the namespace", r["path"])
+		}
+	}
+
+	var top TopValuesReport
+	s.Get("/api/report/top?n=100&namespace=default").Decode(t, &top)
+	for _, v := range top.Values {
+		if !strings.HasPrefix(v.Bucket, "v1/default/") {
+			t.Errorf("top value in %s outside the namespace", v.Bucket)
+		}
+	}
+
+	var tree TreemapNode
+	s.Get("/api/report/treemap?namespace=k8s.io").Decode(t, &tree)
+	if tree.Path != "v1/k8s.io" {
+		t.Errorf("treemap root = %s, want v1/k8s.io", tree.Path)
+	}
+	if resp := s.API(http.MethodGet, "/api/report/treemap?namespace=k8s.io&path=v1/moby", ""); resp.Status != http.StatusBadRequest {
+		t.Errorf("path outside the namespace status = %d, want 400", resp.Status)
+	}
+
+	var orphans OrphanContentReport
+	s.Get("/api/containerd/content/orphans?namespace=k8s.io").Decode(t, &orphans)
+	if orphans.TotalOrphans != 1 || orphans.Orphans[0].Namespace != "k8s.io" {
+		t.Errorf("orphans = %+v, want the one of k8s.io", orphans.Orphans)
+	}
+
+	if resp := s.API(http.MethodGet, "/api/search?q=x&namespace=../v1", ""); resp.Status != http.StatusBadRequest {
+		t.Errorf("invalid namespace status = %d, want 400", resp.Status)
+	}
+}
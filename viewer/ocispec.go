@@ -0,0 +1,180 @@
+// ocispec.go - OCI runtime spec stored in a container's spec key
+package viewer
+
+import "encoding/json"
+
+// runtimeSpecTypeURL type URL containerd's typeurl registers for specs.Spec;
+// the spec is not a protobuf message, the Any holds its JSON encoding
+const runtimeSpecTypeURL = "types.containerd.io/opencontainers/runtime-spec/1/Spec"
+
+// RuntimeSpec the OCI runtime spec (github.com/opencontainers/runtime-spec
+// specs-go), parts rarely needed for debugging are kept as raw JSON
+type RuntimeSpec struct {
+	Version     string            `json:"ociVersion"`
+	Process     *SpecProcess      `json:"process,omitempty"`
+	Root        *SpecRoot         `json:"root,omitempty"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Domainname  string            `json:"domainname,omitempty"`
+	Mounts      []SpecMount       `json:"mounts,omitempty"`
+	Hooks       json.RawMessage   `json:"hooks,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Linux       *SpecLinux        `json:"linux,omitempty"`
+	Windows     json.RawMessage   `json:"windows,omitempty"`
+}
+
+// SpecProcess the container process
+type SpecProcess struct {
+	Terminal        bool              `json:"terminal,omitempty"`
+	User            SpecUser          `json:"user"`
+	Args            []string          `json:"args,omitempty"`
+	CommandLine     string            `json:"commandLine,omitempty"`
+	Env             []string          `json:"env,omitempty"`
+	Cwd             string            `json:"cwd"`
+	Capabilities    *SpecCapabilities `json:"capabilities,omitempty"`
+	Rlimits         []SpecRlimit      `json:"rlimits,omitempty"`
+	NoNewPrivileges bool              `json:"noNewPrivileges,omitempty"`
+	ApparmorProfile string            `json:"apparmorProfile,omitempty"`
+	OOMScoreAdj     *int              `json:"oomScoreAdj,omitempty"`
+	SelinuxLabel    string            `json:"selinuxLabel,omitempty"`
+}
+
+// SpecUser user and groups of the process
+type SpecUser struct {
+	UID            uint32   `json:"uid"`
+	GID            uint32   `json:"gid"`
+	Umask          *uint32  `json:"umask,omitempty"`
+	AdditionalGids []uint32 `json:"additionalGids,omitempty"`
+	Username       string   `json:"username,omitempty"`
+}
+
+// SpecCapabilities capability sets of the process
+type SpecCapabilities struct {
+	Bounding    []string `json:"bounding,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Inheritable []string `json:"inheritable,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+// SpecRlimit a POSIX resource limit
+type SpecRlimit struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
+// SpecRoot the root filesystem
+type SpecRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+}
+
+// SpecMount a mount of the container
+type SpecMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// SpecLinux Linux specific configuration
+type SpecLinux struct {
+	UIDMappings       []SpecIDMapping   `json:"uidMappings,omitempty"`
+	GIDMappings       []SpecIDMapping   `json:"gidMappings,omitempty"`
+	Sysctl            map[string]string `json:"sysctl,omitempty"`
+	Resources         *SpecResources    `json:"resources,omitempty"`
+	CgroupsPath       string            `json:"cgroupsPath,omitempty"`
+	Namespaces        []SpecNamespace   `json:"namespaces,omitempty"`
+	Devices           []SpecDevice      `json:"devices,omitempty"`
+	Seccomp           json.RawMessage   `json:"seccomp,omitempty"`
+	RootfsPropagation string            `json:"rootfsPropagation,omitempty"`
+	MaskedPaths       []string          `json:"maskedPaths,omitempty"`
+	ReadonlyPaths     []string          `json:"readonlyPaths,omitempty"`
+	MountLabel        string            `json:"mountLabel,omitempty"`
+	IntelRdt          json.RawMessage   `json:"intelRdt,omitempty"`
+}
+
+// SpecIDMapping a user namespace id range
+type SpecIDMapping struct {
+	ContainerID uint32 `json:"containerID"`
+	HostID      uint32 `json:"hostID"`
+	Size        uint32 `json:"size"`
+}
+
+// SpecNamespace a namespace the container joins (Path) or creates
+type SpecNamespace struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+}
+
+// SpecDevice a device node created in the container
+type SpecDevice struct {
+	Path     string  `json:"path"`
+	Type     string  `json:"type"`
+	Major    int64   `json:"major"`
+	Minor    int64   `json:"minor"`
+	FileMode *uint32 `json:"fileMode,omitempty"`
+	UID      *uint32 `json:"uid,omitempty"`
+	GID      *uint32 `json:"gid,omitempty"`
+}
+
+// SpecResources cgroup resource limits
+type SpecResources struct {
+	Devices        []SpecDeviceCgroup `json:"devices,omitempty"`
+	Memory         *SpecMemory        `json:"memory,omitempty"`
+	CPU            *SpecCPU           `json:"cpu,omitempty"`
+	Pids           *SpecPids          `json:"pids,omitempty"`
+	BlockIO        json.RawMessage    `json:"blockIO,omitempty"`
+	HugepageLimits json.RawMessage    `json:"hugepageLimits,omitempty"`
+	Network        json.RawMessage    `json:"network,omitempty"`
+	Rdma           json.RawMessage    `json:"rdma,omitempty"`
+	Unified        map[string]string  `json:"unified,omitempty"`
+}
+
+// SpecDeviceCgroup a device cgroup rule
+type SpecDeviceCgroup struct {
+	Allow  bool   `json:"allow"`
+	Type   string `json:"type,omitempty"`
+	Major  *int64 `json:"major,omitempty"`
+	Minor  *int64 `json:"minor,omitempty"`
+	Access string `json:"access,omitempty"`
+}
+
+// SpecMemory memory cgroup limits in bytes
+type SpecMemory struct {
+	Limit            *int64  `json:"limit,omitempty"`
+	Reservation      *int64  `json:"reservation,omitempty"`
+	Swap             *int64  `json:"swap,omitempty"`
+	Kernel           *int64  `json:"kernel,omitempty"`
+	KernelTCP        *int64  `json:"kernelTCP,omitempty"`
+	Swappiness       *uint64 `json:"swappiness,omitempty"`
+	DisableOOMKiller *bool   `json:"disableOOMKiller,omitempty"`
+	UseHierarchy     *bool   `json:"useHierarchy,omitempty"`
+}
+
+// SpecCPU cpu cgroup limits
+type SpecCPU struct {
+	Shares          *uint64 `json:"shares,omitempty"`
+	Quota           *int64  `json:"quota,omitempty"`
+	Burst           *uint64 `json:"burst,omitempty"`
+	Period          *uint64 `json:"period,omitempty"`
+	RealtimeRuntime *int64  `json:"realtimeRuntime,omitempty"`
+	RealtimePeriod  *uint64 `json:"realtimePeriod,omitempty"`
+	Cpus            string  `json:"cpus,omitempty"`
+	Mems            string  `json:"mems,omitempty"`
+	Idle            *int64  `json:"idle,omitempty"`
+}
+
+// SpecPids pids cgroup limit
+type SpecPids struct {
+	Limit int64 `json:"limit"`
+}
+
+// decodeRuntimeSpec decodes the JSON value of a spec Any
+func decodeRuntimeSpec(value []byte) (*RuntimeSpec, error) {
+	var spec RuntimeSpec
+	if err := json.Unmarshal(value, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
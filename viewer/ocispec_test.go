@@ -0,0 +1,51 @@
+package viewer
+
+import (
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestDecodeRuntimeSpec(t *testing.T) {
+	spec := `{"ociVersion":"1.1.0","process":{"user":{"uid":0,"gid":0},"args":["sh"],"env":["PATH=/bin"],"cwd":"/"},
+		"mounts":[{"destination":"/proc","type":"proc","source":"proc"}],
+		"linux":{"cgroupsPath":"k8s.slice:cri:ctr1","namespaces":[{"type":"pid"},{"type":"network","path":"/proc/1/ns/net"}],
+		"resources":{"memory":{"limit":67108864},"cpu":{"shares":2,"quota":50000,"period":100000}}}}`
+	value, err := proto.Marshal(&anypb.Any{TypeUrl: runtimeSpecTypeURL, Value: []byte(spec)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("containers"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("spec"), value)
+	})
+	s := newTestServer(t, path)
+
+	var decoded struct {
+		TypeURL string       `json:"typeUrl"`
+		Spec    *RuntimeSpec `json:"spec"`
+	}
+	s.Get("/api/decode/protobuf/containers/spec").Decode(t, &decoded)
+	if decoded.TypeURL != runtimeSpecTypeURL || decoded.Spec == nil {
+		t.Fatalf("decoded = %+v, want a runtime spec", decoded)
+	}
+	got := decoded.Spec
+	if got.Process == nil || got.Process.Args[0] != "sh" || got.Process.Env[0] != "PATH=/bin" {
+		t.Errorf("process = %+v", got.Process)
+	}
+	if len(got.Mounts) != 1 || got.Mounts[0].Destination != "/proc" {
+		t.Errorf("mounts = %+v", got.Mounts)
+	}
+	if got.Linux == nil || len(got.Linux.Namespaces) != 2 || got.Linux.Namespaces[1].Path != "/proc/1/ns/net" {
+		t.Fatalf("linux = %+v", got.Linux)
+	}
+	if r := got.Linux.Resources; r == nil || *r.Memory.Limit != 64<<20 || *r.CPU.Quota != 50000 {
+		t.Errorf("resources = %+v", r)
+	}
+}
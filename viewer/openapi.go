@@ -0,0 +1,454 @@
+// openapi.go - OpenAPI 3 description of the HTTP API
+package viewer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openAPIVersion version of the OpenAPI specification the document follows
+const openAPIVersion = "3.0.3"
+
+// apiParam a path or query parameter of an API operation
+type apiParam struct {
+	name        string
+	in          string // "path" or "query"
+	description string
+}
+
+// apiOperation documents one API route; data is a value of the type returned
+// in the data field of the envelope, nil if the type varies
+type apiOperation struct {
+	method      string
+	path        string
+	summary     string
+	params      []apiParam
+	body        string // request body content type, empty if none
+	data        interface{}
+	paged       bool // may stop at the response budget and return a cursor
+	mutating    bool // rejected unless the server runs in read-write mode
+	versioned   bool // carries an ETag, 304 if If-None-Match still matches
+	rawResponse bool // not wrapped in APIResponse
+}
+
+// Parameters shared by several operations
+var (
+	bucketPathParam = apiParam{"bucketPath", "path", "Bucket path separated by /, URL-encoded as one segment (%2F)"}
+	keyParam        = apiParam{"key", "path", "Key name, URL-encoded"}
+	cursorParam     = apiParam{"cursor", "query", "Cursor of a partial response to continue from"}
+	// listFormatParam selects CSV instead of the JSON envelope
+	listFormatParam = apiParam{"format", "query", "json (default), yaml, or csv for key,type,size,preview rows"}
+	// namespaceQueryParam scopes an operation to v1/{namespace}
+	namespaceQueryParam = apiParam{"namespace", "query", "containerd namespace, e.g. k8s.io, limits the result to v1/{namespace}"}
+	jobIDParam          = apiParam{"id", "path", "Job id"}
+	// ifNoneMatchParam is added to versioned operations
+	ifNoneMatchParam = apiParam{"If-None-Match", "header", "ETag of a previous response, 304 if the database is unchanged"}
+)
+
+// apiOperations every route served below /api, keep in sync with router
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/api/buckets", summary: "List all buckets",
+		params: []apiParam{namespaceQueryParam, cursorParam,
+			{"stats", "query", "false returns names and hierarchy only, without key counts and statistics (statsOmitted)"}},
+		data: []BucketInfo{}, paged: true, versioned: true},
+	{method: "GET", path: "/api/bucket/{path}", summary: "Get bucket details and contents",
+		params: []apiParam{{"path", "path", "Bucket path separated by /, URL-encoded as one segment (%2F)"}, cursorParam, listFormatParam,
+			{"sort", "query", "name (default) or size of the value"}, {"order", "query", "asc (default) or desc"},
+			{"seek", "query", "Key to start at, like a bolt cursor Seek; descending from the last key not after it"},
+			{"direction", "query", "next (default) or prev, the same as order=asc or desc"},
+			{"limit", "query", "Return at most this many keys, with a cursor if more follow"},
+			{"keys", "query", "all (default) or none to return only the statistics and key count"},
+			{"expr", "query", "jq or JSONPath expression applied to each JSON or decoded value, returning ExprResult items instead"},
+			{"key", "query", "With expr, apply it to this key of each sub-bucket instead, e.g. spec below containers"}},
+		data: BucketInfo{}, paged: true, versioned: true},
+	{method: "GET", path: "/api/sequence/{path}", summary: "Get the sequence counter of a bucket",
+		params: []apiParam{{"path", "path", "Bucket path separated by /, URL-encoded as one segment (%2F)"}},
+		data:   BucketSequence{}},
+	{method: "PUT", path: "/api/sequence/{path}", summary: "Set the sequence counter of a bucket from {\"sequence\": N}",
+		params: []apiParam{{"path", "path", "Bucket path separated by /, URL-encoded as one segment (%2F)"}},
+		body:   "application/json", data: BucketSequence{}, mutating: true},
+	{method: "GET", path: "/api/key/{bucketPath}/{key}", summary: "Get key details",
+		params: []apiParam{bucketPathParam, keyParam, {"full", "query", "1 returns the value without truncation, in chunks of 1 MiB without a response budget"}, cursorParam,
+			{"offset", "query", "Return the chunk of the stored value starting at this byte"}, {"length", "query", "Bytes of the chunk, at most 1048576; the response budget decides if unset"},
+			{"expr", "query", "jq or JSONPath expression applied to the JSON or decoded value, returning an ExprResult instead"}},
+		data: KeyValuePair{}, paged: true, versioned: true},
+	{method: "PUT", path: "/api/key/{bucketPath}/{key}", summary: "Write the request body as the value of a key",
+		params: []apiParam{bucketPathParam, keyParam}, body: "application/octet-stream", mutating: true},
+	{method: "DELETE", path: "/api/key/{bucketPath}/{key}", summary: "Delete a key",
+		params: []apiParam{bucketPathParam, keyParam}, mutating: true},
+	{method: "GET", path: "/api/download/{bucketPath}/{key}", summary: "Download a value's stored bytes as a .bin file, or with format=hex as a hex dump",
+		params: []apiParam{bucketPathParam, keyParam, {"format", "query", "bin (default) or hex"},
+			{"Range", "header", "bytes=start-end of the file, answered with 206 Partial Content"}, {"If-Range", "header", "ETag of a previous response, the whole file if the value changed since"}},
+		rawResponse: true},
+	{method: "GET", path: "/api/decode/time/{bucketPath}/{key}", summary: "Decode a timestamp value",
+		params: []apiParam{bucketPathParam, keyParam}},
+	{method: "GET", path: "/api/decode/protobuf/{bucketPath}/{key}", summary: "Decode a protobuf Any value, OCI runtime specs, CRI metadata and containerd API messages into their structure",
+		params: []apiParam{bucketPathParam, keyParam}},
+	{method: "GET", path: "/api/decode/integer/{bucketPath}/{key}", summary: "Decode a 1, 2, 4 or 8 byte integer in both byte orders, or a varint",
+		params: []apiParam{bucketPathParam, keyParam}},
+	{method: "GET", path: "/api/decode/gob/{bucketPath}/{key}", summary: "Decode an encoding/gob stream into its type definitions and values",
+		params: []apiParam{bucketPathParam, keyParam}},
+	{method: "GET", path: "/api/decode/msgpack/{bucketPath}/{key}", summary: "Decode a MessagePack value",
+		params: []apiParam{bucketPathParam, keyParam}},
+	{method: "GET", path: "/api/decode/cbor/{bucketPath}/{key}", summary: "Decode a CBOR data item",
+		params: []apiParam{bucketPathParam, keyParam}},
+	{method: "GET", path: "/api/decode/base64/{bucketPath}/{key}", summary: "Decode the base64 strings of a value or its JSON fields and detect their types",
+		params: []apiParam{bucketPathParam, keyParam}},
+	{method: "GET", path: "/api/search", summary: "Search keys by name",
+		params: []apiParam{{"q", "query", "Substring to search for"}, namespaceQueryParam, cursorParam, listFormatParam}, paged: true, versioned: true},
+	{method: "GET", path: "/api/info", summary: "Check the bolt header of the served file and detect its schema", data: DBInfo{}},
+	{method: "GET", path: "/api/stats", summary: "Get database statistics", versioned: true},
+	{method: "GET", path: "/api/stats/timeseries", summary: "Get the periodic samples of the last transaction id, database size and bolt statistics",
+		params: []apiParam{{"since", "query", "Only samples taken after this RFC 3339 time"}}, data: StatsTimeseries{}},
+	{method: "GET", path: "/api/sources", summary: "List database source adapters and the current source"},
+	{method: "GET", path: "/api/whoami", summary: "Get the authenticated user"},
+	{method: "GET", path: "/api/capabilities", summary: "Get the server mode and the actions available to the requesting user", data: Capabilities{}},
+	{method: "GET", path: "/api/locale", summary: "Get the UI and error message translations of the locale negotiated from ?lang= and Accept-Language",
+		params: []apiParam{{"lang", "query", "Locale overriding Accept-Language, e.g. zh-CN"}}, data: LocaleBundle{}},
+	{method: "GET", path: "/api/session", summary: "List the API calls recorded in the current session"},
+	{method: "POST", path: "/api/session/replay", summary: "Replay a recorded session against another database",
+		params: []apiParam{{"db", "query", "Database location, the current database if empty; another one requires the read-write mode and the editor role"}}, body: "application/x-ndjson"},
+	{method: "POST", path: "/api/scripts/run", summary: "Run the Starlark script in the request body",
+		params: []apiParam{{"name", "query", "Script name used in error messages"}}, body: "text/plain", data: ScriptResult{}},
+	{method: "GET", path: "/api/doctor", summary: "Run the health checks", data: DoctorReport{}},
+	{method: "GET", path: "/api/pages/{id}", summary: "Decode a raw page like bbolt page",
+		params: []apiParam{{"id", "path", "Page id"}, {"hex", "query", "1 adds a hex dump of the page"}},
+		data:   PageDump{}},
+	{method: "POST", path: "/api/compact", summary: "Compact the database into a new file",
+		params: []apiParam{{"dest", "query", "Destination path on the server, must not exist"}, {"txMaxSize", "query", "Bytes per destination transaction, default 65536, 0 for one transaction"}},
+		data:   CompactResult{}, mutating: true},
+	{method: "POST", path: "/api/copy", summary: "Copy a key or bucket subtree in one transaction, from the database or an uploaded one",
+		body: "application/json", data: CopyResult{}, mutating: true},
+	{method: "POST", path: "/api/rename", summary: "Move a bucket to a new path, copying the subtree and deleting the original in one transaction",
+		body: "application/json", data: CopyResult{}, mutating: true},
+	{method: "POST", path: "/api/cache/invalidate", summary: "Drop the cached bucket tree"},
+	{method: "GET", path: "/api/perf", summary: "Latency of API requests by route and duration of bolt opens and transactions, with estimated percentiles", data: PerfReport{}},
+	{method: "POST", path: "/api/reload", summary: "Reopen the database file, or switch to the file of the optional body in read-write mode",
+		data: ReloadResult{}, body: "application/json"},
+	{method: "GET", path: "/api/history", summary: "List the buckets and keys recently viewed in this browser session, newest first", data: []HistoryEntry{}},
+	{method: "DELETE", path: "/api/history", summary: "Clear the history of this browser session", data: []HistoryEntry{}},
+	{method: "GET", path: "/api/preferences", summary: "The UI preferences of this user or browser session", data: Preferences{}},
+	{method: "PUT", path: "/api/preferences", summary: "Replace the UI preferences of this user or browser session",
+		body: "application/json", data: Preferences{}},
+	{method: "GET", path: "/api/bookmarks", summary: "List the bookmarked buckets and keys", data: []Bookmark{}},
+	{method: "POST", path: "/api/bookmarks", summary: "Bookmark a bucket, or a key, from {\"bucket\", \"key\", \"name\"}",
+		body: "application/json", data: Bookmark{}},
+	{method: "DELETE", path: "/api/bookmarks/{id}", summary: "Delete a bookmark",
+		params: []apiParam{{"id", "path", "Bookmark id"}}},
+	{method: "GET", path: "/api/export/ndjson", summary: "Stream every key as one JSON object per line: bucket path, base64 key and value, size and type",
+		params: []apiParam{{"path", "query", "Bucket path, the whole database (or namespace) if empty"}, namespaceQueryParam}, rawResponse: true},
+	{method: "GET", path: "/api/report/top", summary: "List the largest values of the database",
+		params: []apiParam{{"n", "query", "Number of values, default 50, at most 1000"}, namespaceQueryParam}, data: TopValuesReport{}, versioned: true},
+	{method: "GET", path: "/api/report/treemap", summary: "Get nested per-bucket byte sizes for a treemap",
+		params: []apiParam{{"path", "query", "Bucket path of the root, the whole database (or namespace) if empty"}, namespaceQueryParam}, data: TreemapNode{}, versioned: true},
+	{method: "GET", path: "/api/report/fill", summary: "List the buckets whose own pages are poorly used, most wasted bytes first",
+		params: []apiParam{{"path", "query", "Bucket path of the root, the whole database (or namespace) if empty"}, {"below", "query", "Report buckets used less than this percentage, default 50"},
+			{"minPages", "query", "Leave out buckets with fewer pages, default 4"}, namespaceQueryParam},
+		data: FillReport{}, versioned: true},
+	{method: "POST", path: "/api/report/count", summary: "Start a job counting the keys and buckets of all nested buckets exactly, paced to a rate of keys per second",
+		params: []apiParam{{"path", "query", "Bucket path of the root, the whole database (or namespace) if empty"}, {"rate", "query", "Keys per second, default 200000"}, namespaceQueryParam},
+		data:   Job{}},
+	{method: "GET", path: "/api/report/types", summary: "Count keys and bytes of a bucket by detected value type",
+		params: []apiParam{{"path", "query", "Bucket path, the namespace bucket if empty"}, {"recursive", "query", "1 includes sub-buckets"}, namespaceQueryParam}, data: TypeHistogram{}, versioned: true},
+	{method: "GET", path: "/api/report/schema", summary: "Infer the schema of the JSON values of a bucket from a sample: field names, types, optionality and examples",
+		params: []apiParam{{"path", "query", "Bucket path"}, {"recursive", "query", "1 includes sub-buckets"},
+			{"key", "query", "Only values of keys with this name, e.g. spec with recursive=1 below containers"},
+			{"sample", "query", "Values to read, spread evenly over the keys; default 100, at most 10000"}, namespaceQueryParam},
+		data: SchemaReport{}, versioned: true},
+	{method: "POST", path: "/api/jobs", summary: "Start a search, top, types, doctor, export or count scan in the background and return the job",
+		body: "application/json", data: Job{}},
+	{method: "GET", path: "/api/jobs", summary: "List the running and finished jobs, newest first, without their results", data: []Job{}},
+	{method: "GET", path: "/api/jobs/{id}", summary: "Get the state and progress of a job, and its result once done",
+		params: []apiParam{jobIDParam}, data: Job{}},
+	{method: "DELETE", path: "/api/jobs/{id}", summary: "Cancel a running job, or forget a finished one and remove its output",
+		params: []apiParam{jobIDParam}},
+	{method: "GET", path: "/api/jobs/{id}/download", summary: "Download the NDJSON file of a finished export job",
+		params: []apiParam{jobIDParam}, rawResponse: true},
+	{method: "GET", path: "/api/namespaces", summary: "List containerd namespaces with their image, container, snapshot, content and lease counts",
+		data: []Namespace{}, versioned: true},
+	{method: "GET", path: "/api/nodes", summary: "List the nodes whose agents this frontend proxies to (?node= or the X-Boltdbui-Node header on any API request)", data: []NodeInfo{}},
+	{method: "GET", path: "/api/databases", summary: "List the configured database, the discovered and the uploaded ones with the URL serving each", data: []DatabaseInfo{}},
+	{method: "POST", path: "/api/databases/upload", summary: "Upload a bolt database (multipart field \"file\"), served read-only below db/{id}/",
+		body: "multipart/form-data", data: DatabaseInfo{}, mutating: true},
+	{method: "DELETE", path: "/api/databases/{id}", summary: "Delete an uploaded database",
+		params: []apiParam{{"id", "path", "Upload id"}}, mutating: true},
+	{method: "GET", path: "/api/etcd/keys", summary: "List etcd keys: the latest revision of live keys, or every revision",
+		params: []apiParam{{"prefix", "query", "Key prefix, e.g. /registry/pods/"}, {"history", "query", "1 lists every revision in revision order"}, cursorParam},
+		data:   []EtcdKeyValue{}, paged: true, versioned: true},
+	{method: "GET", path: "/api/etcd/meta", summary: "Get the consistent index, term and revisions of an etcd database", data: EtcdMeta{}},
+	{method: "GET", path: "/api/docker/networks", summary: "List the networks and endpoints of a Docker libnetwork local-kv.db", data: DockerNetworkReport{}, versioned: true},
+	{method: "GET", path: "/api/docker/volumes", summary: "List the volumes of a Docker volumes metadata.db", data: []DockerVolume{}, versioned: true},
+	{method: "GET", path: "/api/containerd/blob", summary: "Resolve a content digest to its blob file in the content store, ?download=1 sends the file",
+		params: []apiParam{{"digest", "query", "Content digest, e.g. sha256:..."}, {"download", "query", "1 sends the blob as application/octet-stream instead"}},
+		data:   BlobInfo{}},
+	{method: "GET", path: "/api/containerd/containers", summary: "List containers joined with their image, snapshot and leases, one row per container",
+		params: []apiParam{namespaceQueryParam, cursorParam}, data: []ContainerView{}, paged: true, versioned: true},
+	{method: "GET", path: "/api/containerd/images", summary: "List images with their target, content size, platforms and labels",
+		params: []apiParam{namespaceQueryParam, cursorParam}, data: []ImageView{}, paged: true, versioned: true},
+	{method: "GET", path: "/api/containerd/images/duplicates", summary: "Report images present in multiple namespaces",
+		data: DuplicateImageReport{}},
+	{method: "GET", path: "/api/containerd/content/orphans", summary: "Report unreferenced content blobs",
+		params: []apiParam{namespaceQueryParam}, data: OrphanContentReport{}},
+	{method: "GET", path: "/api/containerd/gc-report", summary: "Simulate garbage collection: roots, reachable and collected content, snapshots and ingests",
+		params: []apiParam{namespaceQueryParam}, data: GCReport{}},
+	{method: "GET", path: "/api/containerd/leases", summary: "List leases with the content, snapshots and ingests they protect",
+		params: []apiParam{{"digest", "query", "Only leases keeping this content digest alive, directly or through references"}, namespaceQueryParam},
+		data:   []LeaseView{}, versioned: true},
+	{method: "GET", path: "/api/containerd/search", summary: "Find containers, images, content blobs and snapshots by label",
+		params: []apiParam{{"label", "query", "key=value or key, repeat to require several labels"}, namespaceQueryParam, cursorParam},
+		data:   []LabelMatch{}, paged: true, versioned: true},
+	{method: "GET", path: "/api/containerd/sandboxes", summary: "List sandboxes with their sandboxer, runtime, spec, CRI pod metadata and containers",
+		params: []apiParam{namespaceQueryParam, cursorParam}, data: []SandboxView{}, paged: true, versioned: true},
+	{method: "GET", path: "/api/containerd/summary", summary: "Count the containers, images, snapshots, content blobs, leases and sandboxes and the metadata bytes of every namespace",
+		data: ContainerdSummary{}, versioned: true},
+	{method: "GET", path: "/api/containerd/snapshots/chain", summary: "Walk the parent chain of a snapshot, optionally joined with the snapshotter's metadata.db",
+		params: []apiParam{{"namespace", "query", "containerd namespace of the snapshot, required"}, {"key", "query", "Snapshot key"}, {"snapshotter", "query", "Snapshotter name, default overlayfs"}, {"backend", "query", "1 adds id, kind, size and inodes from SNAPSHOTTER_ROOT/metadata.db"}},
+		data:   SnapshotChain{}, versioned: true},
+	{method: "GET", path: "/api/containerd/snapshots/disk", summary: "Report real disk usage of snapshots",
+		params: []apiParam{{"snapshotter", "query", "Snapshotter name, default overlayfs"}, {"budget", "query", "Time budget of the scan, default 10s"}},
+		data:   SnapshotDiskReport{}},
+	{method: "GET", path: "/api/graphql", summary: "Execute a GraphQL query given as ?query=",
+		params:      []apiParam{{"query", "query", "GraphQL query document"}, {"operationName", "query", "Operation to run"}, {"variables", "query", "JSON object of variables"}},
+		rawResponse: true},
+	{method: "POST", path: "/api/graphql", summary: "Execute a GraphQL query, JSON {query, operationName, variables} or application/graphql",
+		body: "application/json", rawResponse: true},
+	{method: "GET", path: "/api/graphql/schema", summary: "Get the GraphQL schema in SDL", rawResponse: true},
+	{method: "GET", path: "/api/openapi.json", summary: "Get this OpenAPI document", rawResponse: true},
+	{method: "GET", path: "/api/ws", summary: "WebSocket for real-time updates, browser sessions and streamed key searches", rawResponse: true},
+}
+
+// handleOpenAPI serves the OpenAPI document of the API
+func (c *Viewer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(c.openAPIDocument()); err != nil {
+		slog.Error("Failed to encode OpenAPI document", "error", err)
+	}
+}
+
+// openAPIDocument builds the OpenAPI document from apiOperations, schemas
+// are derived from the Go types of the responses
+func (c *Viewer) openAPIDocument() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	envelope := schemaOf(reflect.TypeOf(APIResponse{}), schemas)
+
+	paths := map[string]map[string]interface{}{}
+	for _, op := range apiOperations {
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]interface{}{}
+		}
+		paths[op.path][strings.ToLower(op.method)] = op.document(envelope, schemas)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "containerd metadata viewer",
+			"description": "Browse and analyze BoltDB databases, containerd's meta.db in particular",
+			"version":     "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+
+	if c.auth != nil {
+		doc["components"].(map[string]interface{})["securitySchemes"] = map[string]interface{}{
+			"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "OIDC ID token"},
+		}
+		doc["security"] = []interface{}{map[string]interface{}{"bearer": []string{}}}
+	}
+	return doc
+}
+
+// document renders an operation object
+func (op apiOperation) document(envelope map[string]interface{}, schemas map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{
+		"summary":     op.summary,
+		"operationId": operationID(op.method, op.path),
+	}
+
+	opParams := op.params
+	if op.versioned {
+		opParams = append(opParams[:len(opParams):len(opParams)], ifNoneMatchParam)
+	}
+	params := make([]interface{}, 0, len(opParams))
+	for _, p := range opParams {
+		params = append(params, map[string]interface{}{
+			"name":        p.name,
+			"in":          p.in,
+			"description": p.description,
+			"required":    p.in == "path",
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if op.body != "" {
+		schema := map[string]interface{}{"type": "string"}
+		if op.body == "multipart/form-data" {
+			schema = map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					uploadFormField: map[string]interface{}{"type": "string", "format": "binary"},
+				},
+			}
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				op.body: map[string]interface{}{"schema": schema},
+			},
+		}
+	}
+
+	if op.rawResponse {
+		out["responses"] = map[string]interface{}{
+			"200": map[string]interface{}{"description": op.summary},
+		}
+		return out
+	}
+
+	success := envelope
+	if op.data != nil {
+		success = map[string]interface{}{
+			"allOf": []interface{}{
+				envelope,
+				map[string]interface{}{
+					"properties": map[string]interface{}{
+						"data": schemaOf(reflect.TypeOf(op.data), schemas),
+					},
+				},
+			},
+		}
+	}
+	description := "Success"
+	if op.paged {
+		description = "Success, partial with a cursor if the response size budget was reached"
+	}
+
+	responses := map[string]interface{}{
+		"200":     jsonResponse(description, success),
+		"default": jsonResponse("Error, the error field describes it", envelope),
+	}
+	if op.method == http.MethodGet {
+		// negotiateYAML renders the same envelope
+		content := responses["200"].(map[string]interface{})["content"].(map[string]interface{})
+		content["application/yaml"] = map[string]interface{}{"schema": success}
+	}
+	if op.mutating {
+		responses["403"] = jsonResponse("Server is in read-only mode, or the user lacks the editor role", envelope)
+	}
+	if op.versioned {
+		responses["304"] = map[string]interface{}{"description": "Not modified, the database is unchanged since the ETag in If-None-Match"}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// jsonResponse a response object with a JSON body
+func jsonResponse(description string, schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+// operationID derives a unique operation id like getApiKeyBucketPathKey
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf returns the JSON schema of t; named structs are added to schemas
+// and referenced
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "description": "nanoseconds"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		if t.Name() == "" {
+			structProperties(t, properties, schemas)
+			return map[string]interface{}{"type": "object", "properties": properties}
+		}
+
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+		// Placeholder first, structs may reference themselves
+		schemas[t.Name()] = nil
+		structProperties(t, properties, schemas)
+		schemas[t.Name()] = map[string]interface{}{"type": "object", "properties": properties}
+		return ref
+	}
+
+	// interface{} and anything else may hold any value
+	return map[string]interface{}{}
+}
+
+// structProperties adds the JSON fields of a struct, flattening embedded
+// structs like encoding/json
+func structProperties(t reflect.Type, properties map[string]interface{}, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			structProperties(f.Type, properties, schemas)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = schemaOf(f.Type, schemas)
+	}
+}
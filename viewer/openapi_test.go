@@ -0,0 +1,74 @@
+package viewer
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// routeVar matches gorilla/mux variables with a pattern like {path:.*}
+var routeVar = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	viewer := newViewer(boltdbtest.Tiny(t))
+	t.Cleanup(func() { viewer.Close() })
+
+	documented := map[string]bool{}
+	for _, op := range apiOperations {
+		documented[op.method+" "+op.path] = true
+	}
+
+	viewer.router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, "/api/") {
+			return nil
+		}
+		path = routeVar.ReplaceAllString(path, "{$1}")
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"GET"}
+		}
+		for _, m := range methods {
+			if !documented[m+" "+path] {
+				t.Errorf("%s %s is missing from apiOperations", m, path)
+			}
+		}
+		return nil
+	})
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	status, body := s.Do(http.MethodGet, "/api/openapi.json", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var doc struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != openAPIVersion {
+		t.Errorf("openapi = %q, want %q", doc.OpenAPI, openAPIVersion)
+	}
+	if _, ok := doc.Paths["/api/key/{bucketPath}/{key}"]["put"]; !ok {
+		t.Error("PUT /api/key/{bucketPath}/{key} is not documented")
+	}
+	for _, name := range []string{"APIResponse", "BucketInfo", "KeyValuePair", "DoctorReport"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+}
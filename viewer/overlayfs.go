@@ -0,0 +1,274 @@
+// overlayfs.go - resolve metadata snapshots to overlayfs snapshotter directories
+package viewer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultSnapshotterRoot default overlayfs snapshotter state directory
+var defaultSnapshotterRoot = filepath.Join(defaultContainerdRoot, "io.containerd.snapshotter.v1.overlayfs")
+
+// snapshotter storage bucket keys (mirrors containerd/snapshots/storage/bolt.go)
+var (
+	snapshotterKeySnapshots = []byte("snapshots")
+	snapshotterKeyID        = []byte("id")
+	snapshotterKeyKind      = []byte("kind")
+	snapshotterKeyInodes    = []byte("inodes")
+)
+
+// snapshotKinds names of snapshots.Kind values
+var snapshotKinds = map[byte]string{
+	0: "Unknown",
+	1: "View",
+	2: "Active",
+	3: "Committed",
+}
+
+// SnapshotDiskUsage metadata snapshot joined with its on-disk directory
+type SnapshotDiskUsage struct {
+	Namespace    string `json:"namespace"`
+	Snapshotter  string `json:"snapshotter"`
+	Key          string `json:"key"`
+	BackendKey   string `json:"backendKey"`
+	Parent       string `json:"parent,omitempty"`
+	ID           uint64 `json:"id,omitempty"`
+	Kind         string `json:"kind,omitempty"`
+	Dir          string `json:"dir,omitempty"`
+	Exists       bool   `json:"exists"`
+	MetaSize     int64  `json:"metadataSize"`
+	MetaInodes   int64  `json:"metadataInodes"`
+	DiskUsage    int64  `json:"diskUsage"`
+	DiskInodes   int64  `json:"diskInodes"`
+	Partial      bool   `json:"partial"`
+	ResolveError string `json:"resolveError,omitempty"`
+}
+
+// SnapshotDiskReport disk usage report for a snapshotter
+type SnapshotDiskReport struct {
+	Root           string              `json:"root"`
+	Snapshotter    string              `json:"snapshotter"`
+	Budget         string              `json:"budget"`
+	BudgetExceeded bool                `json:"budgetExceeded"`
+	TotalDiskUsage int64               `json:"totalDiskUsage"`
+	TotalMetaSize  int64               `json:"totalMetadataSize"`
+	Missing        int                 `json:"missing"`
+	Untracked      []string            `json:"untrackedDirs,omitempty"`
+	Snapshots      []SnapshotDiskUsage `json:"snapshots"`
+}
+
+// snapshotterEntry a snapshot record in the snapshotter's own metadata.db
+type snapshotterEntry struct {
+	id     uint64
+	kind   string
+	size   int64
+	inodes int64
+}
+
+// handleSnapshotDisk reports real disk usage of overlayfs snapshots
+func (c *Viewer) handleSnapshotDisk(w http.ResponseWriter, r *http.Request) {
+	snapshotter := r.URL.Query().Get("snapshotter")
+	if snapshotter == "" {
+		snapshotter = "overlayfs"
+	}
+
+	budget := 10 * time.Second
+	if b := r.URL.Query().Get("budget"); b != "" {
+		d, err := time.ParseDuration(b)
+		if err != nil {
+			c.sendError(w, "Invalid budget", err)
+			return
+		}
+		budget = d
+	}
+
+	report, err := c.getSnapshotDiskUsage(snapshotterRoot(), snapshotter, budget)
+	if err != nil {
+		c.sendError(w, "Failed to resolve snapshot directories", err)
+		return
+	}
+
+	c.sendSuccess(w, report)
+}
+
+// snapshotterRoot returns the snapshotter root from SNAPSHOTTER_ROOT or the default
+func snapshotterRoot() string {
+	if root := os.Getenv("SNAPSHOTTER_ROOT"); root != "" {
+		return root
+	}
+	return defaultSnapshotterRoot
+}
+
+// getSnapshotDiskUsage resolves every metadata snapshot of a snapshotter to its
+// overlay directory and measures it, sharing one time budget across all walks
+func (c *Viewer) getSnapshotDiskUsage(root, snapshotter string, budget time.Duration) (*SnapshotDiskReport, error) {
+	entries, err := readSnapshotterEntries(filepath.Join(root, "metadata.db"), c.boltOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SnapshotDiskReport{
+		Root:        root,
+		Snapshotter: snapshotter,
+		Budget:      budget.String(),
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return forEachNamespace(tx, func(ns string, nsb *bolt.Bucket) error {
+			sb := nsb.Bucket(bucketKeyObjectSnapshots)
+			if sb == nil {
+				return nil
+			}
+			ssb := sb.Bucket([]byte(snapshotter))
+			if ssb == nil {
+				return nil
+			}
+			return ssb.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				kb := ssb.Bucket(k)
+				report.Snapshots = append(report.Snapshots, SnapshotDiskUsage{
+					Namespace:   ns,
+					Snapshotter: snapshotter,
+					Key:         string(k),
+					BackendKey:  string(kb.Get(bucketKeyName)),
+					Parent:      string(kb.Get(bucketKeyParent)),
+				})
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(budget)
+	tracked := make(map[string]bool)
+	for i := range report.Snapshots {
+		s := &report.Snapshots[i]
+		entry, ok := entries[s.BackendKey]
+		if !ok {
+			s.ResolveError = "not found in snapshotter metadata"
+			report.Missing++
+			continue
+		}
+
+		s.ID = entry.id
+		s.Kind = entry.kind
+		s.MetaSize = entry.size
+		s.MetaInodes = entry.inodes
+		s.Dir = filepath.Join(root, "snapshots", strconv.FormatUint(entry.id, 10))
+		tracked[strconv.FormatUint(entry.id, 10)] = true
+		report.TotalMetaSize += entry.size
+
+		if _, err := os.Stat(s.Dir); err != nil {
+			s.ResolveError = err.Error()
+			report.Missing++
+			continue
+		}
+		s.Exists = true
+
+		s.DiskUsage, s.DiskInodes, s.Partial = diskUsage(s.Dir, deadline)
+		if s.Partial {
+			report.BudgetExceeded = true
+		}
+		report.TotalDiskUsage += s.DiskUsage
+	}
+
+	// Directories on disk that no metadata snapshot points to
+	if dirs, err := os.ReadDir(filepath.Join(root, "snapshots")); err == nil {
+		for _, d := range dirs {
+			if d.IsDir() && !tracked[d.Name()] {
+				report.Untracked = append(report.Untracked, filepath.Join(root, "snapshots", d.Name()))
+			}
+		}
+	}
+
+	sort.Slice(report.Snapshots, func(i, j int) bool {
+		return report.Snapshots[i].DiskUsage > report.Snapshots[j].DiskUsage
+	})
+
+	return report, nil
+}
+
+// readSnapshotterEntries reads the snapshotter metadata.db keyed by backend key
+func readSnapshotterEntries(path string, tuning BoltOptions) (map[string]snapshotterEntry, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("snapshotter metadata not found: %v", err)
+	}
+
+	// The snapshotter holds this file open, do not wait forever for the lock
+	db, err := openBolt(path, true, tuning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshotter metadata: %v", err)
+	}
+	defer db.Close()
+
+	entries := make(map[string]snapshotterEntry)
+	err = db.View(func(tx *bolt.Tx) error {
+		v1 := tx.Bucket(bucketKeyVersion)
+		if v1 == nil {
+			return fmt.Errorf("not a snapshotter metadata database: bucket %q not found", bucketKeyVersion)
+		}
+		sb := v1.Bucket(snapshotterKeySnapshots)
+		if sb == nil {
+			return nil
+		}
+		return sb.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			b := sb.Bucket(k)
+			id, _ := binary.Uvarint(b.Get(snapshotterKeyID))
+			entry := snapshotterEntry{
+				id:     id,
+				size:   readVarint(b, bucketKeySize),
+				inodes: readVarint(b, snapshotterKeyInodes),
+			}
+			if kind := b.Get(snapshotterKeyKind); len(kind) == 1 {
+				entry.kind = snapshotKinds[kind[0]]
+			}
+			entries[string(k)] = entry
+			return nil
+		})
+	})
+
+	return entries, err
+}
+
+// diskUsage sums file sizes below dir like du, stopping at the deadline;
+// partial reports whether the walk was cut short
+func diskUsage(dir string, deadline time.Time) (size, inodes int64, partial bool) {
+	errBudget := fmt.Errorf("budget exceeded")
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable entries are skipped, not fatal
+		}
+		if inodes%1024 == 0 && time.Now().After(deadline) {
+			return errBudget
+		}
+		inodes++
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, inodes, err == errBudget
+}
@@ -0,0 +1,106 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// writeSnapshotterRoot creates an overlayfs snapshotter state directory
+// knowing the k8s.io snapshots sha256:chain1 (id 1, on disk) and the
+// container's rw snapshot (id 2, missing on disk), plus an untracked
+// directory 9
+func writeSnapshotterRoot(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	backend, err := bolt.Open(filepath.Join(root, "metadata.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backend.Update(func(tx *bolt.Tx) error {
+		v1, _ := tx.CreateBucket(bucketKeyVersion)
+		sb, _ := v1.CreateBucket(snapshotterKeySnapshots)
+		for i, key := range []string{"k8s.io/1/sha256:chain1", "k8s.io/2/" + boltdbtest.Container + "-rw"} {
+			b, _ := sb.CreateBucket([]byte(key))
+			b.Put(snapshotterKeyID, binary.AppendUvarint(nil, uint64(i+1)))
+			b.Put(snapshotterKeyKind, []byte{byte(3 - i)})
+			b.Put(bucketKeySize, binary.AppendVarint(nil, 1000))
+			b.Put(snapshotterKeyInodes, binary.AppendVarint(nil, 3))
+		}
+		return nil
+	})
+	backend.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := filepath.Join(root, "snapshots", "1", "fs")
+	os.MkdirAll(filepath.Join(fs, "etc"), 0o755)
+	os.WriteFile(filepath.Join(fs, "etc", "hostname"), make([]byte, 100), 0o644)
+	os.WriteFile(filepath.Join(fs, "bin"), make([]byte, 200), 0o644)
+	os.MkdirAll(filepath.Join(root, "snapshots", "9"), 0o755)
+	return root
+}
+
+func TestSnapshotDiskUsage(t *testing.T) {
+	root := writeSnapshotterRoot(t)
+	t.Setenv("SNAPSHOTTER_ROOT", root)
+	backend, err := os.ReadFile(filepath.Join(root, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var report SnapshotDiskReport
+	s.Get("/api/containerd/snapshots/disk").Decode(t, &report)
+	snapshots := map[string]SnapshotDiskUsage{}
+	for _, snap := range report.Snapshots {
+		snapshots[snap.Namespace+" "+snap.Key] = snap
+	}
+
+	chain := snapshots["k8s.io sha256:chain1"]
+	if !chain.Exists || chain.ID != 1 || chain.Kind != "Committed" || chain.DiskUsage != 300 || chain.MetaSize != 1000 || chain.MetaInodes != 3 || chain.Partial {
+		t.Errorf("chain1 = %+v, want 300 bytes on disk", chain)
+	}
+	if chain.Dir != filepath.Join(root, "snapshots", "1") {
+		t.Errorf("chain1 dir = %s", chain.Dir)
+	}
+	if rw := snapshots["k8s.io "+boltdbtest.Container+"-rw"]; rw.Exists || rw.Kind != "Active" || rw.ResolveError == "" {
+		t.Errorf("rw snapshot = %+v, want missing on disk", rw)
+	}
+	if stale := snapshots["k8s.io "+boltdbtest.StaleSnapshot]; stale.ResolveError != "not found in snapshotter metadata" {
+		t.Errorf("stale snapshot = %+v, want unknown to the snapshotter", stale)
+	}
+	if report.TotalDiskUsage != 300 || report.TotalMetaSize != 2000 || report.Missing != len(report.Snapshots)-1 || report.BudgetExceeded {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.Untracked) != 1 || report.Untracked[0] != filepath.Join(root, "snapshots", "9") {
+		t.Errorf("untracked = %v, want directory 9", report.Untracked)
+	}
+
+	// The snapshotter's database is only read
+	if after, _ := os.ReadFile(filepath.Join(root, "metadata.db")); !bytes.Equal(after, backend) {
+		t.Error("snapshotter metadata.db changed")
+	}
+
+	s.Get("/api/containerd/snapshots/disk?budget=-1s").Decode(t, &report)
+	if !report.BudgetExceeded || report.Budget != "-1s" {
+		t.Errorf("report without budget = %+v, want exceeded", report)
+	}
+	if resp := s.API(http.MethodGet, "/api/containerd/snapshots/disk?budget=soon", ""); resp.Success {
+		t.Error("invalid budget accepted")
+	}
+
+	t.Setenv("SNAPSHOTTER_ROOT", t.TempDir())
+	if resp := s.API(http.MethodGet, "/api/containerd/snapshots/disk", ""); resp.Success || !strings.Contains(resp.Error, "Failed to resolve") {
+		t.Errorf("missing snapshotter metadata: %+v", resp)
+	}
+}
@@ -0,0 +1,366 @@
+// pages.go - raw page inspector, the on-disk layout mirrors bbolt's
+// internal/common package (little-endian platforms)
+package viewer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bbolt page layout
+const (
+	pageHeaderSize  = 16
+	pageElementSize = 16 // branch and leaf elements have the same size
+	metaMagic       = 0xED0CDAED
+
+	branchPageFlag   = 0x01
+	leafPageFlag     = 0x02
+	metaPageFlag     = 0x04
+	freelistPageFlag = 0x10
+	bucketLeafFlag   = 0x01
+
+	// freelistCountOverflow count value marking a freelist whose real count
+	// is stored in the first element
+	freelistCountOverflow = 0xFFFF
+)
+
+const (
+	// maxPageElements bounds the elements and freelist ids rendered per page
+	maxPageElements = 1000
+	// maxPagePreview bytes of a key or value shown per element
+	maxPagePreview = 64
+	// maxPageBytes bounds how much of a page and its overflow is read
+	maxPageBytes = 16 * 1024 * 1024
+)
+
+// PageDump a decoded page as stored on disk
+type PageDump struct {
+	ID       uint64        `json:"id"`
+	Type     string        `json:"type"`
+	Free     *bool         `json:"free,omitempty"` // in the freelist, unknown unless the freelist is loaded
+	Flags    uint16        `json:"flags"`
+	Count    int           `json:"count"`
+	Overflow uint32        `json:"overflow"`
+	PageSize int           `json:"pageSize"`
+	Elements []PageElement `json:"elements,omitempty"`
+	Meta     *MetaPage     `json:"meta,omitempty"`
+	Freelist []uint64      `json:"freelist,omitempty"`
+	// Truncated more elements or ids than maxPageElements
+	Truncated bool   `json:"truncated,omitempty"`
+	Hex       string `json:"hex,omitempty"`
+	// Problems found decoding the page, e.g. elements pointing outside it
+	Problems []string `json:"problems,omitempty"`
+}
+
+// PageElement an element of a branch or leaf page
+type PageElement struct {
+	Index     int    `json:"index"`
+	Pos       uint32 `json:"pos"`
+	Flags     uint32 `json:"flags,omitempty"`
+	Key       string `json:"key"`
+	KeySize   uint32 `json:"keySize"`
+	Child     uint64 `json:"child,omitempty"` // branch pages
+	Bucket    bool   `json:"bucket,omitempty"`
+	Value     string `json:"value,omitempty"`
+	ValueSize uint32 `json:"valueSize,omitempty"`
+}
+
+// MetaPage the contents of meta pages 0 and 1
+type MetaPage struct {
+	Magic         uint32 `json:"magic"`
+	Version       uint32 `json:"version"`
+	PageSize      uint32 `json:"pageSize"`
+	Flags         uint32 `json:"flags"`
+	Root          uint64 `json:"root"`
+	Sequence      uint64 `json:"sequence"`
+	Freelist      uint64 `json:"freelist"`
+	HighWater     uint64 `json:"highWater"`
+	TxID          uint64 `json:"txid"`
+	Checksum      uint64 `json:"checksum"`
+	ChecksumValid bool   `json:"checksumValid"`
+}
+
+// MetaInfo the meta page bolt reads the database from, and both meta pages
+// as stored, to diagnose corruption or compare copies of a database
+type MetaInfo struct {
+	PageSize int    `json:"pageSize"`
+	TxID     uint64 `json:"txid"`
+	// Root page of the root bucket; Freelist page of the freelist, the
+	// largest page id when it is not synced
+	Root      uint64 `json:"root"`
+	Freelist  uint64 `json:"freelist"`
+	HighWater uint64 `json:"highWater"`
+	// Active the meta page in use, the intact one with the higher txid, -1
+	// if neither is
+	Active int          `json:"active"`
+	Pages  [2]*MetaPage `json:"pages"`
+}
+
+// handleGetPage renders a raw page, ?hex=1 adds a hex dump
+func (c *Viewer) handleGetPage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid page id", err)
+		return
+	}
+
+	page, err := c.readPage(id, r.URL.Query().Get("hex") == "1")
+	if err != nil {
+		c.sendError(w, "Failed to read page", err)
+		return
+	}
+	c.sendSuccess(w, page)
+}
+
+// readPage reads a page and its overflow from the database file within a
+// read transaction, so the page is not reused while it is decoded
+func (c *Viewer) readPage(id uint64, withHex bool) (*PageDump, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	pageSize := db.Info().PageSize
+
+	var page *PageDump
+	err = db.View(func(tx *bolt.Tx) error {
+		if int64(id) >= tx.Size()/int64(pageSize) {
+			return fmt.Errorf("page %d is beyond the high water mark", id)
+		}
+
+		f, err := os.Open(db.Path())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		data := make([]byte, pageSize)
+		if _, err := f.ReadAt(data, int64(id)*int64(pageSize)); err != nil {
+			return fmt.Errorf("failed to read page %d: %v", id, err)
+		}
+		if overflow := binary.LittleEndian.Uint32(data[12:]); overflow > 0 {
+			size := int64(pageSize) * (int64(overflow) + 1)
+			if size > maxPageBytes {
+				size = maxPageBytes
+			}
+			data = make([]byte, size)
+			if _, err := f.ReadAt(data, int64(id)*int64(pageSize)); err != nil {
+				return fmt.Errorf("failed to read overflow of page %d: %v", id, err)
+			}
+		}
+
+		page = decodePage(data, pageSize)
+		// Read-only transactions only know free pages if the freelist was loaded
+		if info, err := tx.Page(int(id)); err == nil && info != nil {
+			free := info.Type == "free"
+			page.Free = &free
+		}
+		if withHex {
+			page.Hex = hexDump(data, int64(id)*int64(pageSize))
+		}
+		return nil
+	})
+
+	return page, err
+}
+
+// readMetaInfo reads the meta pages of a database within a read
+// transaction; a commit may still write the inactive one meanwhile
+func readMetaInfo(db *meteredDB) (*MetaInfo, error) {
+	info := &MetaInfo{PageSize: db.Info().PageSize, Active: -1}
+	err := db.View(func(tx *bolt.Tx) error {
+		f, err := os.Open(db.Path())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var problems [2]string
+		info.Pages, problems = readMetaPages(f, info.PageSize)
+		for i, m := range info.Pages {
+			if problems[i] == "" && (info.Active < 0 || m.TxID > info.Pages[info.Active].TxID) {
+				info.Active = i
+			}
+		}
+		if info.Active >= 0 {
+			m := info.Pages[info.Active]
+			info.TxID, info.Root, info.Freelist, info.HighWater = m.TxID, m.Root, m.Freelist, m.HighWater
+		}
+		return nil
+	})
+	return info, err
+}
+
+// decodePage decodes the header and elements of a raw page
+func decodePage(data []byte, pageSize int) *PageDump {
+	page := &PageDump{
+		ID:       binary.LittleEndian.Uint64(data[0:]),
+		Flags:    binary.LittleEndian.Uint16(data[8:]),
+		Count:    int(binary.LittleEndian.Uint16(data[10:])),
+		Overflow: binary.LittleEndian.Uint32(data[12:]),
+		PageSize: pageSize,
+	}
+
+	switch {
+	case page.Flags&branchPageFlag != 0:
+		page.Type = "branch"
+		decodeElements(page, data, true)
+	case page.Flags&leafPageFlag != 0:
+		page.Type = "leaf"
+		decodeElements(page, data, false)
+	case page.Flags&metaPageFlag != 0:
+		page.Type = "meta"
+		page.Meta = decodeMeta(data[pageHeaderSize:])
+		if page.Meta.Magic != metaMagic {
+			page.Problems = append(page.Problems, fmt.Sprintf("invalid magic %#x", page.Meta.Magic))
+		}
+		if !page.Meta.ChecksumValid {
+			page.Problems = append(page.Problems, "checksum mismatch")
+		}
+	case page.Flags&freelistPageFlag != 0:
+		page.Type = "freelist"
+		decodeFreelist(page, data)
+	default:
+		page.Type = fmt.Sprintf("unknown<%02x>", page.Flags)
+	}
+
+	return page
+}
+
+// decodeElements decodes branch or leaf elements, positions are relative
+// to the element header
+func decodeElements(page *PageDump, data []byte, branch bool) {
+	count := page.Count
+	if count > maxPageElements {
+		count = maxPageElements
+		page.Truncated = true
+	}
+
+	var prevKey []byte
+	for i := 0; i < count; i++ {
+		off := pageHeaderSize + i*pageElementSize
+		if off+pageElementSize > len(data) {
+			page.Problems = append(page.Problems, fmt.Sprintf("element %d header is outside the page", i))
+			return
+		}
+		h := data[off : off+pageElementSize]
+
+		el := PageElement{Index: i}
+		var valueSize uint32
+		if branch {
+			el.Pos = binary.LittleEndian.Uint32(h[0:])
+			el.KeySize = binary.LittleEndian.Uint32(h[4:])
+			el.Child = binary.LittleEndian.Uint64(h[8:])
+		} else {
+			el.Flags = binary.LittleEndian.Uint32(h[0:])
+			el.Pos = binary.LittleEndian.Uint32(h[4:])
+			el.KeySize = binary.LittleEndian.Uint32(h[8:])
+			valueSize = binary.LittleEndian.Uint32(h[12:])
+			el.Bucket = el.Flags&bucketLeafFlag != 0
+			el.ValueSize = valueSize
+		}
+
+		start := uint64(off) + uint64(el.Pos)
+		end := start + uint64(el.KeySize) + uint64(valueSize)
+		if end > uint64(len(data)) {
+			page.Problems = append(page.Problems, fmt.Sprintf("element %d data at %d+%d is outside the page", i, start, end-start))
+			page.Elements = append(page.Elements, el)
+			continue
+		}
+		key := data[start : start+uint64(el.KeySize)]
+		el.Key = pageBytesString(key)
+		if prevKey != nil && bytes.Compare(key, prevKey) <= 0 {
+			page.Problems = append(page.Problems, fmt.Sprintf("element %d is out of order", i))
+		}
+		prevKey = key
+
+		if !branch {
+			value := data[start+uint64(el.KeySize) : end]
+			if el.Bucket && len(value) >= 16 {
+				el.Value = fmt.Sprintf("bucket root=%d sequence=%d",
+					binary.LittleEndian.Uint64(value[0:]), binary.LittleEndian.Uint64(value[8:]))
+				if binary.LittleEndian.Uint64(value[0:]) == 0 {
+					el.Value += " (inline)"
+				}
+			} else {
+				el.Value = pageBytesString(value)
+			}
+		}
+		page.Elements = append(page.Elements, el)
+	}
+}
+
+// decodeMeta decodes a meta page body and verifies its checksum
+func decodeMeta(data []byte) *MetaPage {
+	m := &MetaPage{
+		Magic:     binary.LittleEndian.Uint32(data[0:]),
+		Version:   binary.LittleEndian.Uint32(data[4:]),
+		PageSize:  binary.LittleEndian.Uint32(data[8:]),
+		Flags:     binary.LittleEndian.Uint32(data[12:]),
+		Root:      binary.LittleEndian.Uint64(data[16:]),
+		Sequence:  binary.LittleEndian.Uint64(data[24:]),
+		Freelist:  binary.LittleEndian.Uint64(data[32:]),
+		HighWater: binary.LittleEndian.Uint64(data[40:]),
+		TxID:      binary.LittleEndian.Uint64(data[48:]),
+		Checksum:  binary.LittleEndian.Uint64(data[56:]),
+	}
+
+	h := fnv.New64a()
+	h.Write(data[:56])
+	m.ChecksumValid = h.Sum64() == m.Checksum
+	return m
+}
+
+// decodeFreelist decodes the page ids of a freelist page
+func decodeFreelist(page *PageDump, data []byte) {
+	off := pageHeaderSize
+	count := page.Count
+	if count == freelistCountOverflow {
+		count = int(binary.LittleEndian.Uint64(data[off:]))
+		off += 8
+	}
+	page.Count = count
+
+	if count > maxPageElements {
+		count = maxPageElements
+		page.Truncated = true
+	}
+	for i := 0; i < count; i++ {
+		if off+8 > len(data) {
+			page.Problems = append(page.Problems, fmt.Sprintf("freelist id %d is outside the page", i))
+			return
+		}
+		page.Freelist = append(page.Freelist, binary.LittleEndian.Uint64(data[off:]))
+		off += 8
+	}
+}
+
+// pageBytesString renders printable keys and values as text, anything else
+// as hex, both cut at maxPagePreview bytes
+func pageBytesString(b []byte) string {
+	suffix := ""
+	if len(b) > maxPagePreview {
+		b, suffix = b[:maxPagePreview], "..."
+	}
+
+	printable := utf8.Valid(b)
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return string(b) + suffix
+	}
+	return fmt.Sprintf("0x%x", b) + suffix
+}
@@ -0,0 +1,78 @@
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestGetPageMeta(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	var page PageDump
+	s.Get("/api/pages/0?hex=1").Decode(t, &page)
+	if page.Type != "meta" || page.Meta == nil {
+		t.Fatalf("page 0 = %+v, want meta", page)
+	}
+	if page.Meta.Magic != metaMagic || !page.Meta.ChecksumValid {
+		t.Errorf("meta = %+v, want valid magic and checksum", page.Meta)
+	}
+	if page.Hex == "" {
+		t.Error("hex dump missing with ?hex=1")
+	}
+
+	var root PageDump
+	s.Get(fmt.Sprintf("/api/pages/%d", page.Meta.Root)).Decode(t, &root)
+	if root.Type != "leaf" || len(root.Elements) != 1 || root.Elements[0].Key != "misc" || !root.Elements[0].Bucket {
+		t.Errorf("root page = %+v, want a leaf with bucket misc", root)
+	}
+}
+
+func TestGetPageOutOfRange(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	if resp := s.API(http.MethodGet, "/api/pages/99999", ""); resp.Success {
+		t.Error("page beyond the high water mark succeeded")
+	}
+	if status, _ := s.Do(http.MethodGet, "/api/pages/x", nil); status != http.StatusNotFound {
+		t.Errorf("non-numeric id status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestGetPageCorrupted(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Corrupted(t))
+
+	for id := 0; ; id++ {
+		resp := s.API(http.MethodGet, fmt.Sprintf("/api/pages/%d", id), "")
+		if !resp.Success {
+			t.Fatal("no page reports the unsorted key")
+		}
+		var page PageDump
+		resp.Decode(t, &page)
+		for _, problem := range page.Problems {
+			if strings.Contains(problem, "out of order") {
+				return
+			}
+		}
+	}
+}
+
+func TestMetaInfoStats(t *testing.T) {
+	var stats struct {
+		Meta MetaInfo `json:"meta"`
+	}
+	newTestServer(t, boltdbtest.Tiny(t)).Get("/api/stats").Decode(t, &stats)
+
+	m := stats.Meta
+	if m.Active < 0 || m.PageSize != os.Getpagesize() || m.TxID == 0 || m.Root == 0 || m.Freelist == 0 || m.HighWater <= m.Root {
+		t.Fatalf("meta = %+v", m)
+	}
+	active, other := m.Pages[m.Active], m.Pages[1-m.Active]
+	if active.TxID != m.TxID || !active.ChecksumValid || other.TxID != m.TxID-1 {
+		t.Errorf("pages = %+v, %+v", active, other)
+	}
+}
@@ -0,0 +1,135 @@
+// platform.go - platform independent parts of opening databases
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+var (
+	// defaultDBPath containerd metadata database of a default installation
+	defaultDBPath = filepath.Join(defaultContainerdRoot, "io.containerd.metadata.v1.bolt", "meta.db")
+	// defaultDiscoverRoots state directories searched by --discover
+	defaultDiscoverRoots = []string{defaultContainerdRoot, defaultBuildkitRoot}
+)
+
+// dbLockTimeout bounds how long opening waits for the file lock; a live
+// containerd holds an exclusive lock, without a timeout the open hangs forever
+const dbLockTimeout = 5 * time.Second
+
+// Freelist types of BoltOptions
+const (
+	freelistArray = "array"
+	freelistMap   = "map"
+)
+
+// BoltOptions tuning of bolt.Open for the served databases, the zero value
+// uses the defaults
+type BoltOptions struct {
+	// Timeout how long opening waits for the file lock, 0 uses the default
+	// of 5 seconds, a negative value waits forever
+	Timeout time.Duration
+	// NoFreelistSync does not write the freelist on commits in read-write
+	// mode, it is rebuilt by scanning the database on open instead
+	NoFreelistSync bool
+	// FreelistType "array" (bolt's default) or "map", faster to allocate
+	// from in databases with many free pages
+	FreelistType string
+	// InitialMmapSize bytes mapped on open, a database growing within it is
+	// not remapped, which waits for all read transactions
+	InitialMmapSize int
+	// Mlock keeps the mapped database in memory, not supported on Windows
+	Mlock bool
+}
+
+// validate rejects tuning bolt.Open would fail or panic on
+func (o BoltOptions) validate() error {
+	switch o.FreelistType {
+	case "", freelistArray, freelistMap:
+	default:
+		return fmt.Errorf("invalid freelist type %q, expected %s or %s", o.FreelistType, freelistArray, freelistMap)
+	}
+	if o.InitialMmapSize < 0 {
+		return fmt.Errorf("invalid initial mmap size %d", o.InitialMmapSize)
+	}
+	if o.Mlock && !mlockSupported {
+		return errors.New("mlock is not supported on this platform")
+	}
+	return nil
+}
+
+// apply sets the tuning on the options of bolt.Open
+func (o BoltOptions) apply(opts *bolt.Options) {
+	switch {
+	case o.Timeout > 0:
+		opts.Timeout = o.Timeout
+	case o.Timeout < 0:
+		opts.Timeout = 0
+	}
+	opts.NoFreelistSync = o.NoFreelistSync
+	switch o.FreelistType {
+	case freelistArray:
+		opts.FreelistType = bolt.FreelistArrayType
+	case freelistMap:
+		opts.FreelistType = bolt.FreelistMapType
+	}
+	opts.InitialMmapSize = o.InitialMmapSize
+	opts.Mlock = o.Mlock
+}
+
+// openBolt opens a database with the platform specific options and the
+// tuning, lock contention is reported with a hint to open a copy instead
+func openBolt(path string, readOnly bool, tuning BoltOptions) (*bolt.DB, error) {
+	opts := platformOpenOptions(readOnly)
+	tuning.apply(opts)
+	start := time.Now()
+	db, err := bolt.Open(path, 0600, opts)
+	perf.opens.observe(time.Since(start).Seconds())
+	if err != nil {
+		if errors.Is(err, berrors.ErrTimeout) || platformLockError(err) {
+			return nil, fmt.Errorf("%s is locked by another process (is containerd running?), %s: %v", path, platformLockHint(path, err), err)
+		}
+		return nil, err
+	}
+	return db, nil
+}
+
+// samePath compares paths the way the platform's file system does
+func samePath(a, b string) bool {
+	if caseInsensitiveFS {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// tempFileName makes a name from an archive or remote path safe to create on
+// any platform, so copies can be moved between engineer laptops
+func tempFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+
+	// Windows reserves device names regardless of extension
+	base, _, _ := strings.Cut(strings.ToUpper(name), ".")
+	switch base {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		name = "_" + name
+	}
+
+	if name == "" {
+		return "source.db"
+	}
+	return name
+}
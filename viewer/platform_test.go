@@ -0,0 +1,96 @@
+package viewer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDefaultPaths(t *testing.T) {
+	for _, path := range []string{defaultDBPath, defaultContentRoot, defaultSnapshotterRoot} {
+		if !filepath.IsAbs(path) || !strings.HasPrefix(path, defaultContainerdRoot+string(filepath.Separator)) {
+			t.Errorf("default path %s is not below the containerd root %s", path, defaultContainerdRoot)
+		}
+	}
+}
+
+func TestStatFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta.db")
+	if err := os.WriteFile(path, []byte("0123456789"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Held open like containerd holds its database
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte("more"), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := statFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 14 {
+		t.Errorf("size = %d, want 14", info.Size())
+	}
+	if _, err := statFile(filepath.Join(t.TempDir(), "missing.db")); !os.IsNotExist(err) {
+		t.Errorf("missing file: err = %v, want not exist", err)
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	data := []byte("bolt\x00\x01 page header and more")
+	want := "" +
+		"100000000: 62 6f 6c 74 00 01 20 70 61 67 65 20 68 65 61 64  |bolt.. page head|\n" +
+		"100000010: 65 72 20 61 6e 64 20 6d 6f 72 65                 |er and more|\n"
+	// Offsets of pages past 4GB
+	if got := hexDump(data, 1<<32); got != want {
+		t.Errorf("hexDump =\n%s\nwant\n%s", got, want)
+	}
+
+	preview := hexPreview(make([]byte, 40), 16)
+	if lines := strings.Count(preview, "\n"); lines != 1 || !strings.HasSuffix(preview, "... 24 more bytes") {
+		t.Errorf("hexPreview = %q, want one line and 24 more bytes", preview)
+	}
+}
+
+func TestBoltOptions(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+
+	// A writer holds the exclusive lock, like a running containerd
+	writer, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = openBolt(path, true, BoltOptions{Timeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "locked by another process") {
+		t.Errorf("open of a locked database: err = %v, want a lock error", err)
+	}
+	if waited := time.Since(start); waited > dbLockTimeout/2 {
+		t.Errorf("open waited %s, want the 100ms timeout", waited)
+	}
+	writer.Close()
+
+	db, err := openBolt(path, false, BoltOptions{FreelistType: freelistMap, NoFreelistSync: true, InitialMmapSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.FreelistType != bolt.FreelistMapType || !db.NoFreelistSync {
+		t.Errorf("freelist %s, no sync %v, want the map without sync", db.FreelistType, db.NoFreelistSync)
+	}
+	db.Close()
+
+	if _, err := NewViewer(Options{DBPath: path, Bolt: BoltOptions{FreelistType: "tree"}}); err == nil {
+		t.Error("NewViewer accepted an unknown freelist type")
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+
+// platform_unix.go - database paths and open options on Linux and macOS
+package viewer
+
+import (
+	"os"
+	"runtime"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// State directories of default containerd and buildkit installations
+const (
+	defaultContainerdRoot = "/var/lib/containerd"
+	defaultBuildkitRoot   = "/var/lib/buildkit"
+)
+
+// mlockSupported bolt implements Options.Mlock with mlock(2)
+const mlockSupported = true
+
+// caseInsensitiveFS the default macOS file system (APFS) ignores case
+var caseInsensitiveFS = runtime.GOOS == "darwin"
+
+// platformOpenOptions bolt takes a shared flock for read-only handles, which
+// blocks while containerd holds its exclusive lock
+func platformOpenOptions(readOnly bool) *bolt.Options {
+	return &bolt.Options{
+		ReadOnly: readOnly,
+		Timeout:  dbLockTimeout,
+	}
+}
+
+// platformLockError flock reports contention as a timeout, see openBolt
+func platformLockError(err error) bool {
+	return false
+}
+
+// platformLockHint how to browse a database locked by another process
+func platformLockHint(path string, err error) string {
+	return "open a copy with copy://" + path
+}
+
+// statFile the size and mtime of a file, also while another process writes it
+func statFile(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
@@ -0,0 +1,71 @@
+//go:build windows
+
+// platform_windows.go - database paths and open options on Windows
+package viewer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/sys/windows"
+)
+
+// State directories of default containerd and buildkit installations, below
+// %ProgramData% which is not always on C:
+var (
+	defaultContainerdRoot = filepath.Join(programData(), "containerd", "root")
+	defaultBuildkitRoot   = filepath.Join(programData(), "buildkitd")
+)
+
+// programData the machine wide application data directory
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
+
+// mlockSupported bolt panics on Options.Mlock on Windows
+const mlockSupported = false
+
+// caseInsensitiveFS NTFS ignores case by default
+const caseInsensitiveFS = true
+
+// platformOpenOptions LockFileEx locks are mandatory, bolt locks a byte past
+// the end of the file so plain reads are not blocked, but a running
+// containerd's exclusive lock still makes the open wait
+func platformOpenOptions(readOnly bool) *bolt.Options {
+	return &bolt.Options{
+		ReadOnly: readOnly,
+		Timeout:  dbLockTimeout,
+	}
+}
+
+// platformLockError files opened without sharing by another process fail
+// instead of waiting for the lock
+func platformLockError(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
+
+// platformLockHint a file opened without read sharing cannot be copied
+// either, only a lock leaves copy:// as a way to browse it
+func platformLockHint(path string, err error) string {
+	if errors.Is(err, windows.ERROR_SHARING_VIOLATION) {
+		return "stop the process holding it or open a backup"
+	}
+	return "open a copy with copy://" + path
+}
+
+// statFile the size and mtime of a file from an open handle: NTFS updates
+// the directory entry read by os.Stat lazily while another process, such
+// as containerd, has the file open for writing
+func statFile(path string) (os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
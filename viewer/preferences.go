@@ -0,0 +1,192 @@
+// preferences.go - UI preferences of each user or browser session, kept in
+// the bookmarks file so they survive restarts and browser changes
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// preferencesBucket the bucket of the bookmarks file holding the
+// preferences, keyed by session, see requestSession
+var preferencesBucket = []byte("preferences")
+
+const (
+	// maxExpandedBuckets bounds the expanded buckets remembered
+	maxExpandedBuckets = 1000
+	// maxPreferenceSessions bounds the sessions whose preferences are kept,
+	// the least recently saved ones are dropped first
+	maxPreferenceSessions = 1000
+)
+
+// Preferences the UI settings of a session; zero values are the UI defaults
+type Preferences struct {
+	// SidebarWidth the width of the bucket tree in pixels
+	SidebarWidth int `json:"sidebarWidth,omitempty"`
+	// ExpandedBuckets the paths of the buckets expanded in the tree
+	ExpandedBuckets []string `json:"expandedBuckets,omitempty"`
+	// PreviewSize the characters of a value previewed in key listings
+	PreviewSize int `json:"previewSize,omitempty"`
+	// Namespace the containerd namespace the tree is scoped to
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// storedPreferences the preferences of a session as kept in the file
+type storedPreferences struct {
+	Preferences
+	// Saved when the session last saved them
+	Saved time.Time `json:"saved"`
+}
+
+// isDefault reports whether p holds only UI defaults, which are not stored
+func (p Preferences) isDefault() bool {
+	return p.SidebarWidth == 0 && len(p.ExpandedBuckets) == 0 && p.PreviewSize == 0 && p.Namespace == ""
+}
+
+// validate rejects settings the UI cannot apply
+func (p Preferences) validate() error {
+	switch {
+	case p.SidebarWidth < 0:
+		return fmt.Errorf("negative sidebarWidth %d", p.SidebarWidth)
+	case p.PreviewSize < 0:
+		return fmt.Errorf("negative previewSize %d", p.PreviewSize)
+	case len(p.ExpandedBuckets) > maxExpandedBuckets:
+		return fmt.Errorf("%d expandedBuckets, at most %d", len(p.ExpandedBuckets), maxExpandedBuckets)
+	}
+	if ns := p.Namespace; ns != "" && (len(ns) > maxNamespaceLength || !namespacePattern.MatchString(ns)) {
+		return fmt.Errorf("invalid namespace %q", ns)
+	}
+	return nil
+}
+
+// handleGetPreferences returns the preferences of the session, empty if
+// none were saved
+func (c *Viewer) handleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	var prefs Preferences
+	session, ok := requestSession(r)
+	if !ok {
+		c.sendSuccess(w, prefs)
+		return
+	}
+	err := c.withSidecar(preferencesBucket, false, func(b *bolt.Bucket) error {
+		if b == nil {
+			return nil
+		}
+		if data := b.Get([]byte(session)); data != nil {
+			var stored storedPreferences
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return err
+			}
+			prefs = stored.Preferences
+		}
+		return nil
+	})
+	if err != nil {
+		c.sendError(w, "Failed to read preferences", err)
+		return
+	}
+	c.sendSuccess(w, prefs)
+}
+
+// handlePutPreferences replaces the preferences of the session with the
+// JSON body, starting a session if the request has none; defaults are not
+// stored, they remove the saved preferences
+func (c *Viewer) handlePutPreferences(w http.ResponseWriter, r *http.Request) {
+	var prefs Preferences
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1024*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&prefs); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid preferences", err)
+		return
+	}
+	if err := prefs.validate(); err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid preferences", err)
+		return
+	}
+
+	if prefs.isDefault() {
+		session, ok := requestSession(r)
+		if !ok {
+			c.sendSuccess(w, prefs)
+			return
+		}
+		err := c.withSidecar(preferencesBucket, true, func(b *bolt.Bucket) error {
+			return b.Delete([]byte(session))
+		})
+		if err != nil {
+			c.sendError(w, "Failed to save preferences", err)
+			return
+		}
+		c.sendSuccess(w, prefs)
+		return
+	}
+
+	session, err := c.startSession(w, r)
+	if err != nil {
+		c.sendError(w, "Failed to start session", err)
+		return
+	}
+	now := time.Now()
+	data, err := json.Marshal(storedPreferences{Preferences: prefs, Saved: now})
+	if err != nil {
+		c.sendError(w, "Failed to save preferences", err)
+		return
+	}
+	err = c.withSidecar(preferencesBucket, true, func(b *bolt.Bucket) error {
+		if b.Get([]byte(session)) == nil {
+			if err := prunePreferences(b, now); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte(session), data)
+	})
+	if err != nil {
+		c.sendError(w, "Failed to save preferences", err)
+		return
+	}
+	c.sendSuccess(w, prefs)
+}
+
+// prunePreferences makes room for the preferences of a new session: those
+// of sessions whose cookie expired are deleted, then the least recently
+// saved ones beyond maxPreferenceSessions
+func prunePreferences(b *bolt.Bucket, now time.Time) error {
+	type saved struct {
+		session []byte
+		at      time.Time
+	}
+	var kept, expired []saved
+	err := b.ForEach(func(k, v []byte) error {
+		var stored storedPreferences
+		// Unreadable preferences are the first to go
+		json.Unmarshal(v, &stored)
+		s := saved{bytes.Clone(k), stored.Saved}
+		if now.Sub(s.at) > sessionCookieMaxAge {
+			expired = append(expired, s)
+		} else {
+			kept = append(kept, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(kept, func(i, j int) bool { return kept[i].at.Before(kept[j].at) })
+	if excess := len(kept) - (maxPreferenceSessions - 1); excess > 0 {
+		expired = append(expired, kept[:excess]...)
+	}
+	for _, s := range expired {
+		if err := b.Delete(s.session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
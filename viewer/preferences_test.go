@@ -0,0 +1,117 @@
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestPreferences(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bookmarks.db")
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) { c.bookmarksPath = file })
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Client().Jar = jar
+
+	var prefs Preferences
+	s.Get("/api/preferences").Decode(t, &prefs)
+	if !reflect.DeepEqual(prefs, Preferences{}) {
+		t.Fatalf("preferences = %+v, want none", prefs)
+	}
+
+	want := Preferences{SidebarWidth: 420, ExpandedBuckets: []string{"misc", "misc/nested"}, PreviewSize: 200, Namespace: "k8s.io"}
+	s.API(http.MethodPut, "/api/preferences", `{"sidebarWidth": 420, "expandedBuckets": ["misc", "misc/nested"], "previewSize": 200, "namespace": "k8s.io"}`)
+	s.Get("/api/preferences").Decode(t, &prefs)
+	if !reflect.DeepEqual(prefs, want) {
+		t.Errorf("preferences = %+v, want %+v", prefs, want)
+	}
+
+	// A restarted server, or another viewer, reads them from the file
+	again := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) { c.bookmarksPath = file })
+	again.Client().Jar = jar
+	prefs = Preferences{}
+	again.Get("/api/preferences").Decode(t, &prefs)
+	if !reflect.DeepEqual(prefs, want) {
+		t.Errorf("preferences after restart = %+v, want %+v", prefs, want)
+	}
+
+	for _, body := range []string{`{"sidebarWidth": -1}`, `{"namespace": "../x"}`, `{"theme": "dark"}`} {
+		if resp := s.API(http.MethodPut, "/api/preferences", body); resp.Status != http.StatusBadRequest {
+			t.Errorf("PUT %s: status %d, want 400", body, resp.Status)
+		}
+	}
+}
+
+func TestPreferencesBounded(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bookmarks.db")
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) { c.bookmarksPath = file })
+
+	// Defaults of a session that never saved any are not stored
+	req, _ := http.NewRequest(http.MethodPut, s.URL+"/api/preferences", strings.NewReader(`{"expandedBuckets": []}`))
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(res.Cookies()) != 0 {
+		t.Errorf("PUT of defaults: status %d, cookies %v", res.StatusCode, res.Cookies())
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("bookmarks file created for defaults: %v", err)
+	}
+
+	// Expired sessions and the least recently saved beyond the limit go
+	db, err := bolt.Open(file, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	now := time.Now()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(preferencesBucket)
+		if err != nil {
+			return err
+		}
+		put := func(session string, saved time.Time) {
+			data, _ := json.Marshal(storedPreferences{Preferences: Preferences{PreviewSize: 100}, Saved: saved})
+			b.Put([]byte(session), data)
+		}
+		put("cookie:expired", now.Add(-sessionCookieMaxAge-time.Hour))
+		for i := 0; i < maxPreferenceSessions; i++ {
+			put(fmt.Sprintf("cookie:%04d", i), now.Add(time.Duration(i-maxPreferenceSessions)*time.Minute))
+		}
+		if err := prunePreferences(b, now); err != nil {
+			return err
+		}
+
+		n := 0
+		b.ForEach(func(_, _ []byte) error { n++; return nil })
+		if n != maxPreferenceSessions-1 {
+			t.Errorf("%d sessions kept, want %d", n, maxPreferenceSessions-1)
+		}
+		for _, session := range []string{"cookie:expired", "cookie:0000"} {
+			if b.Get([]byte(session)) != nil {
+				t.Errorf("%s kept", session)
+			}
+		}
+		if b.Get([]byte("cookie:0001")) == nil {
+			t.Error("cookie:0001 dropped")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
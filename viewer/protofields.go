@@ -0,0 +1,136 @@
+// protofields.go - protobuf messages decoded without their schema, JSON
+// documents in string and bytes fields parsed
+package viewer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtoField a field of a protobuf message decoded without its schema
+type ProtoField struct {
+	Number int `json:"number"`
+	// Wire the wire type: varint, fixed32, fixed64 or bytes
+	Wire string `json:"wire"`
+	// Value the number, the parsed JSON document, the string, or the hex of
+	// binary bytes; empty for nested messages
+	Value interface{} `json:"value,omitempty"`
+	// JSON the string or bytes field held a JSON document, Value is its
+	// parsed form
+	JSON bool `json:"json,omitempty"`
+	// Message the fields of a bytes field holding a nested message
+	Message []ProtoField `json:"message,omitempty"`
+}
+
+// parseJSONDocument parses data if it is a JSON object or array; scalars
+// are left alone, too many strings and numbers are valid JSON
+func parseJSONDocument(data []byte) (interface{}, bool) {
+	trimmed := trimJSONSpace(data)
+	if len(trimmed) < 2 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal(trimmed, &v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// trimJSONSpace strips the whitespace JSON allows around a value
+func trimJSONSpace(data []byte) []byte {
+	isSpace := func(b byte) bool { return b == ' ' || b == '\t' || b == '\n' || b == '\r' }
+	for len(data) > 0 && isSpace(data[0]) {
+		data = data[1:]
+	}
+	for len(data) > 0 && isSpace(data[len(data)-1]) {
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// decodeProtoFields decodes the fields of a message like protoc
+// --decode_raw; bytes fields are tried as JSON, text and nested messages in
+// that order. Groups are rejected, they are unused and make random bytes
+// look like messages.
+func decodeProtoFields(data []byte, depth int) ([]ProtoField, error) {
+	if depth > maxDecodeDepth {
+		return nil, fmt.Errorf("nested too deeply")
+	}
+	var fields []ProtoField
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		f := ProtoField{Number: int(num)}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.Wire, f.Value, data = "varint", v, data[n:]
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.Wire, f.Value, data = "fixed32", v, data[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.Wire, f.Value, data = "fixed64", v, data[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			f.Wire, data = "bytes", data[n:]
+			decodeProtoBytes(&f, v, depth)
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d of field %d", typ, num)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// decodeProtoBytes interprets the content of a bytes field
+func decodeProtoBytes(f *ProtoField, v []byte, depth int) {
+	if doc, ok := parseJSONDocument(v); ok {
+		f.Value, f.JSON = doc, true
+		return
+	}
+	if isPrintableText(v) {
+		f.Value = string(v)
+		return
+	}
+	if msg, err := decodeProtoFields(v, depth+1); err == nil && len(msg) > 0 {
+		f.Message = msg
+		return
+	}
+	f.Value = hex.EncodeToString(v)
+}
+
+// isPrintableText reports whether data is UTF-8 text without control
+// characters other than whitespace
+func isPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package viewer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/api/types/runc/options"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestDecodeProtobufEmbeddedJSON(t *testing.T) {
+	// A message like an extension wrapping another Any
+	var inner []byte
+	inner = protowire.AppendTag(inner, 1, protowire.BytesType)
+	inner = protowire.AppendString(inner, "types.example.com/Config")
+	inner = protowire.AppendTag(inner, 2, protowire.BytesType)
+	inner = protowire.AppendBytes(inner, []byte(` {"limits": {"cpu": 2}} `))
+
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, "name")
+	msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, inner)
+	msg = protowire.AppendTag(msg, 3, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, 7)
+
+	value, err := proto.Marshal(&anypb.Any{TypeUrl: "types.example.com/Extension", Value: msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decodeProtobufValue(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, ok := result["fields"].([]ProtoField)
+	if !ok || len(fields) != 3 {
+		t.Fatalf("fields = %#v, want 3", result["fields"])
+	}
+	if fields[0].Value != "name" || fields[2].Value != uint64(7) {
+		t.Errorf("fields = %+v, want name and 7", fields)
+	}
+	nested := fields[1].Message
+	if len(nested) != 2 || !nested[1].JSON {
+		t.Fatalf("nested = %+v, want a type URL and JSON", nested)
+	}
+	got, _ := json.Marshal(nested[1].Value)
+	if string(got) != `{"limits":{"cpu":2}}` {
+		t.Errorf("embedded JSON = %s", got)
+	}
+
+	// typeurl stores Go types that are not messages as JSON
+	value, _ = proto.Marshal(&anypb.Any{TypeUrl: "types.example.com/Options", Value: []byte(`{"debug":true}`)})
+	if result, err = decodeProtobufValue(value); err != nil {
+		t.Fatal(err)
+	}
+	if doc, ok := result["json"].(map[string]interface{}); !ok || doc["debug"] != true {
+		t.Errorf("json = %#v, want {debug: true}", result["json"])
+	}
+}
+
+func TestDecodeProtobufContainerdTypes(t *testing.T) {
+	opts, err := anypb.New(&options.Options{BinaryName: "/usr/bin/runc", SystemdCgroup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := proto.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decodeProtobufValue(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := result["message"].(map[string]interface{})
+	if !ok || msg["binary_name"] != "/usr/bin/runc" || msg["systemd_cgroup"] != true {
+		t.Fatalf("message = %#v, want the runc options", result["message"])
+	}
+	if result["fields"] != nil {
+		t.Errorf("fields = %#v, want none for a resolved message", result["fields"])
+	}
+
+	// Values that are not the message of their type URL keep the raw fields
+	value, _ = proto.Marshal(&anypb.Any{TypeUrl: opts.TypeUrl, Value: []byte{0xff}})
+	if result, err = decodeProtobufValue(value); err != nil {
+		t.Fatal(err)
+	}
+	if result["message"] != nil {
+		t.Errorf("message = %#v, want none for a malformed value", result["message"])
+	}
+}
@@ -0,0 +1,288 @@
+// quota.go - per-response byte budget with partial results
+package viewer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultMaxResponseBytes keeps single responses well below what proxies in
+// front of the viewer accept
+const defaultMaxResponseBytes = 32 * 1024 * 1024
+
+// ListMeta how much of a list a response holds, so clients know whether
+// they see all of it
+type ListMeta struct {
+	// Total the items of the whole list, omitted when counting them would
+	// take another scan
+	Total    *int `json:"total,omitempty"`
+	Returned int  `json:"returned"`
+	// NextCursor continues the list as ?cursor=, Truncated is set when
+	// more items follow
+	NextCursor string `json:"nextCursor,omitempty"`
+	Truncated  bool   `json:"truncated"`
+}
+
+// responseBudget tracks the encoded size of items added to a response; a nil
+// or zero budget is unlimited
+type responseBudget struct {
+	limit int64
+	used  int64
+	taken int
+}
+
+// newResponseBudget returns the budget for one response
+func (c *Viewer) newResponseBudget() *responseBudget {
+	return &responseBudget{limit: c.maxResponseBytes}
+}
+
+// reserve accounts for a part of the response that is always sent
+func (b *responseBudget) reserve(v interface{}) {
+	if b == nil || b.limit <= 0 {
+		return
+	}
+	if data, err := json.Marshal(v); err == nil {
+		b.reserveBytes(len(data))
+	}
+}
+
+// reserveBytes is reserve for a part already encoded to n bytes
+func (b *responseBudget) reserveBytes(n int) {
+	if b == nil || b.limit <= 0 {
+		return
+	}
+	b.used += int64(n)
+}
+
+// take reports whether v still fits and accounts for it; the first item is
+// always taken so paging makes progress
+func (b *responseBudget) take(v interface{}) bool {
+	if b == nil || b.limit <= 0 {
+		return true
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return true
+	}
+	return b.takeBytes(len(data))
+}
+
+// takeBytes is take for an item already encoded to n bytes
+func (b *responseBudget) takeBytes(n int) bool {
+	if b == nil || b.limit <= 0 {
+		return true
+	}
+	if b.taken > 0 && b.used+int64(n) > b.limit {
+		return false
+	}
+	b.used += int64(n)
+	b.taken++
+	return true
+}
+
+// encodeCursor encodes a key as an opaque continuation cursor
+func encodeCursor(key []byte) string {
+	if key == nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// decodeCursor decodes a cursor created by encodeCursor
+func decodeCursor(cursor string) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	return key, nil
+}
+
+// decodeOffsetCursor decodes a numeric cursor used by offset paged endpoints
+func decodeOffsetCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(cursor)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor: %q", cursor)
+	}
+	return offset, nil
+}
+
+// maxValueChunk bounds ?length= of key requests, and the chunks of full
+// values when the response budget is disabled
+const maxValueChunk = 1 << 20
+
+// valueExceedsBudget estimates whether rendering a value (value and preview,
+// hex dumps are about five times the raw size) exceeds the response budget
+func (c *Viewer) valueExceedsBudget(value []byte) bool {
+	if c.maxResponseBytes <= 0 {
+		return false
+	}
+	return int64(len(value))*valueExpansion(value) > c.maxResponseBytes
+}
+
+// valueExpansion approximate encoded bytes per raw byte of a value
+func valueExpansion(value []byte) int64 {
+	if !utf8.Valid(value) {
+		return 5
+	}
+	return 3
+}
+
+// valueChunkSize the bytes of value per chunk: length if set, what fits
+// the response budget, or maxValueChunk without one
+func (c *Viewer) valueChunkSize(value []byte, length int) int {
+	if length > 0 {
+		return length
+	}
+	if c.maxResponseBytes <= 0 {
+		return maxValueChunk
+	}
+	size := int(c.maxResponseBytes / valueExpansion(value))
+	if size < 16 {
+		size = 16
+	}
+	return size
+}
+
+// keyChunk renders size bytes of a large value starting at offset, only
+// those are copied and hex dumped, returning the offset cursor of the rest
+func (c *Viewer) keyChunk(keyName string, value []byte, offset, size int) (*KeyValuePair, string) {
+	if offset > len(value) {
+		offset = len(value)
+	}
+	isBinary := !utf8.Valid(value)
+	if !isBinary {
+		// An explicit offset inside a character starts at the character
+		for offset > 0 && offset < len(value) && !utf8.RuneStart(value[offset]) {
+			offset--
+		}
+	}
+
+	end := offset + size
+	if end > len(value) {
+		end = len(value)
+	}
+	if !isBinary {
+		// Do not split multi-byte characters, a chunk shorter than the
+		// character at offset holds that character so paging advances
+		for end < len(value) && end > offset && !utf8.RuneStart(value[end]) {
+			end--
+		}
+		if end == offset && offset < len(value) {
+			_, n := utf8.DecodeRune(value[offset:])
+			end = offset + n
+		}
+	}
+	chunk := value[offset:end]
+
+	kv := &KeyValuePair{
+		Key:       keyName,
+		ValueSize: len(value),
+		IsBinary:  isBinary,
+		Offset:    offset,
+		Length:    len(chunk),
+	}
+	if isBinary {
+		kv.ValueType = "Binary"
+		kv.Value = fmt.Sprintf("<%d bytes binary data, showing bytes %d-%d>", len(value), offset, end)
+		kv.Preview = "Hexadecimal preview:\n" + hexDump(chunk, int64(offset))
+	} else {
+		kv.ValueType = "String"
+		kv.Value = string(chunk)
+		kv.Preview = string(chunk)
+	}
+
+	if end < len(value) {
+		return kv, strconv.Itoa(end)
+	}
+	return kv, ""
+}
+
+// valueChunk the part of a value a key request asks for
+type valueChunk struct {
+	offset int
+	// length 0 sizes chunks by the response budget
+	length int
+	// explicit chunks were requested by ?offset= or ?length=, others only
+	// when the value is too large
+	explicit bool
+	full     bool
+}
+
+// parseValueChunk reads ?offset=, overriding the offset of the cursor of a
+// previous chunk, and ?length=, at most maxValueChunk
+func parseValueChunk(r *http.Request, offset int) (valueChunk, error) {
+	q := r.URL.Query()
+	chunk := valueChunk{offset: offset, full: q.Get("full") == "1"}
+	var err error
+	if s := q.Get("offset"); s != "" {
+		if chunk.offset, err = strconv.Atoi(s); err != nil || chunk.offset < 0 {
+			return valueChunk{}, fmt.Errorf("invalid offset %q", s)
+		}
+		chunk.explicit = true
+	}
+	if s := q.Get("length"); s != "" {
+		if chunk.length, err = strconv.Atoi(s); err != nil || chunk.length <= 0 || chunk.length > maxValueChunk {
+			return valueChunk{}, fmt.Errorf("invalid length %q, want 1 to %d", s, maxValueChunk)
+		}
+		chunk.explicit = true
+	}
+	return chunk, nil
+}
+
+// getKeyChunk renders the requested chunk of a value within the read
+// transaction, copying only its bytes; nil if the value is returned whole
+func (c *Viewer) getKeyChunk(bucketPath, keyName string, chunk valueChunk) (*KeyValuePair, string, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var kv *KeyValuePair
+	var next string
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := c.findBucket(tx, bucketPath)
+		if bucket == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		value := bucket.Get([]byte(keyName))
+		if value == nil {
+			return fmt.Errorf("key not found: %s", keyName)
+		}
+		// Compressed values are shown by their content, which is what is
+		// measured against the budget and chunked
+		stored := len(value)
+		compression, content, err := decompressValue(value)
+		if err == nil && compression != "" {
+			value = content
+		} else {
+			compression = ""
+		}
+		whole := !chunk.explicit && chunk.offset == 0 && !c.valueExceedsBudget(value) &&
+			// Without a budget, full values are hex dumped chunk by chunk
+			!(c.maxResponseBytes <= 0 && chunk.full && len(value) > maxValueChunk)
+		if whole {
+			return nil
+		}
+		kv, next = c.keyChunk(keyName, value, chunk.offset, c.valueChunkSize(value, chunk.length))
+		if compression != "" {
+			kv.Compression = compression
+			kv.DecompressedSize = len(value)
+			kv.ValueSize = stored
+		}
+		return nil
+	})
+	return kv, next, err
+}
@@ -0,0 +1,159 @@
+// reload.go - reopening the database, or switching to another file, without
+// restarting the server
+package viewer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ReloadRequest the optional body of POST /api/reload
+type ReloadRequest struct {
+	// Path the database file to serve from now on, empty reopens the
+	// current one; switching requires the read-write mode
+	Path string `json:"path,omitempty"`
+}
+
+// ReloadResult the database served after a reload
+type ReloadResult struct {
+	Path     string `json:"path"`
+	TxID     int    `json:"txid"`
+	Switched bool   `json:"switched"`
+}
+
+// databasePath the file being served, which a reload may switch
+func (c *Viewer) databasePath() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dbPath
+}
+
+// databaseLocation the location the served database was acquired from
+func (c *Viewer) databaseLocation() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sourceLocation
+}
+
+// reload closes the database handle, or the snapshot in snapshot mode, and
+// opens path instead, the current file if empty. On failure the previous
+// file is still served, reopened on the next request if it was closed.
+func (c *Viewer) reload(path string) (*ReloadResult, error) {
+	switched := false
+	if path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		// bolt would create a missing file in read-write mode
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("database file does not exist: %s", path)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("not a regular file: %s", path)
+		}
+		path, switched = abs, !samePath(abs, c.databasePath())
+	}
+
+	c.mu.Lock()
+	if path == "" {
+		path = c.dbPath
+	}
+	db, old, err := c.reopen(path)
+	if err == nil {
+		c.dbPath = path
+		if switched {
+			c.sourceLocation = path
+		}
+	}
+	c.mu.Unlock()
+
+	if old != nil {
+		// Waits for the read transactions still using it
+		if closeErr := old.Close(); closeErr != nil {
+			slog.Warn("Failed to close the previous database handle", "error", closeErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.tree.invalidate()
+
+	result := &ReloadResult{Path: path, Switched: switched}
+	if err := db.View(func(tx *bolt.Tx) error {
+		result.TxID = tx.ID()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slog.Info("Reloaded database", "path", path, "txid", result.TxID)
+	return result, nil
+}
+
+// reopen opens path in place of the current handle, returning the old handle
+// for the caller to close once c.mu is released; c.mu must be held
+func (c *Viewer) reopen(path string) (db, old *bolt.DB, err error) {
+	if c.snapshotInterval > 0 {
+		if c.snapshot == nil {
+			c.dbPath = path
+			db, err := c.snapshotDB()
+			return db, nil, err
+		}
+		snap, err := takeSnapshot(path, c.boltOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.retireSnapshot(c.snapshot)
+		c.snapshot = snap
+		return snap.db, nil, nil
+	}
+
+	if c.db != nil && c.writable() {
+		// The writer holds an exclusive lock, even against ourselves
+		err := c.db.Close()
+		c.db = nil
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	db, err = openBolt(path, !c.writable(), c.boltOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	old, c.db = c.db, db
+	return db, old, nil
+}
+
+// handleReload reopens the database, e.g. after containerd replaced the file
+// on restart, or switches to the file of the optional JSON body
+func (c *Viewer) handleReload(w http.ResponseWriter, r *http.Request) {
+	var req ReloadRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid reload request", err)
+		return
+	}
+	if req.Path != "" && !c.writable() {
+		c.sendErrorCode(w, http.StatusForbidden, "Server is in read-only mode", errors.New("switching the database requires the read-write mode"))
+		return
+	}
+	if req.Path != "" && !canEdit(r) {
+		c.sendErrorCode(w, http.StatusForbidden, "Editor role required", errors.New("switching the database requires the editor role"))
+		return
+	}
+
+	result, err := c.reload(req.Path)
+	if err != nil {
+		c.sendError(w, "Failed to reload database", err)
+		return
+	}
+	c.sendSuccess(w, result)
+}
@@ -0,0 +1,92 @@
+package viewer
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// textDB creates a database holding misc/text
+func textDB(t *testing.T, text string) string {
+	return boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("misc"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("text"), []byte(text))
+	})
+}
+
+func TestReload(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+	s := newTestServer(t, path)
+
+	text := func() string {
+		var kv KeyValuePair
+		s.Get("/api/key/misc/text").Decode(t, &kv)
+		return kv.Preview
+	}
+	if got := text(); got != "hello" {
+		t.Fatalf("text = %q, want hello", got)
+	}
+
+	// containerd writes a new file and renames it over the old one, the
+	// open handle still reads the replaced file
+	if err := os.Rename(textDB(t, "rotated"), path); err != nil {
+		t.Fatal(err)
+	}
+	if got := text(); got != "hello" {
+		t.Fatalf("text before reload = %q, want the old file's hello", got)
+	}
+
+	var result ReloadResult
+	s.API(http.MethodPost, "/api/reload", "").Decode(t, &result)
+	if result.Path != path || result.Switched {
+		t.Errorf("reload = %+v, want %s not switched", result, path)
+	}
+	if got := text(); got != "rotated" {
+		t.Errorf("text after reload = %q, want rotated", got)
+	}
+
+	// Switching needs the read-write mode
+	body, _ := json.Marshal(ReloadRequest{Path: textDB(t, "other")})
+	if resp := s.API(http.MethodPost, "/api/reload", string(body)); resp.Status != http.StatusForbidden {
+		t.Errorf("switch in read-only mode: status %d, want 403", resp.Status)
+	}
+}
+
+func TestReloadSwitch(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+	s := newTestServer(t, path, func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+	s.Get("/api/key/misc/text")
+
+	other := textDB(t, "other")
+	body, _ := json.Marshal(ReloadRequest{Path: other})
+	var result ReloadResult
+	s.API(http.MethodPost, "/api/reload", string(body)).Decode(t, &result)
+	if result.Path != other || !result.Switched {
+		t.Errorf("reload = %+v, want switched to %s", result, other)
+	}
+	var kv KeyValuePair
+	s.Get("/api/key/misc/text").Decode(t, &kv)
+	if kv.Preview != "other" {
+		t.Errorf("text after switch = %q, want other", kv.Preview)
+	}
+
+	// A missing file is not created, the current one stays served
+	body, _ = json.Marshal(ReloadRequest{Path: filepath.Join(t.TempDir(), "missing.db")})
+	if resp := s.API(http.MethodPost, "/api/reload", string(body)); resp.Success {
+		t.Error("switching to a missing file succeeded")
+	}
+	s.Get("/api/key/misc/text").Decode(t, &kv)
+	if kv.Preview != "other" {
+		t.Errorf("text after failed switch = %q, want other", kv.Preview)
+	}
+}
@@ -0,0 +1,657 @@
+// report.go - whole-database reports on where space goes
+package viewer
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// defaultTopValues values returned by /api/report/top without ?n=
+	defaultTopValues = 50
+	// maxTopValues bounds ?n= of /api/report/top
+	maxTopValues = 1000
+)
+
+// TopValue a key and the size of its value
+type TopValue struct {
+	Bucket  string `json:"bucket"`
+	Key     string `json:"key"`
+	Size    int    `json:"size"`
+	KeySize int    `json:"keySize"`
+}
+
+// TopValuesReport the largest values of the database
+type TopValuesReport struct {
+	// Scanned keys walked
+	Scanned int `json:"scanned"`
+	// TotalBytes summed key and value sizes of all keys
+	TotalBytes int64      `json:"totalBytes"`
+	Values     []TopValue `json:"values"`
+}
+
+// topValueHeap a min-heap on Size, the root is evicted when a larger value
+// is found
+type topValueHeap []TopValue
+
+func (h topValueHeap) Len() int            { return len(h) }
+func (h topValueHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h topValueHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topValueHeap) Push(x interface{}) { *h = append(*h, x.(TopValue)) }
+func (h *topValueHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+// handleTopValues returns the ?n= largest values
+func (c *Viewer) handleTopValues(w http.ResponseWriter, r *http.Request) {
+	n := defaultTopValues
+	if s := r.URL.Query().Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > maxTopValues {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid n", fmt.Errorf("n must be between 1 and %d", maxTopValues))
+			return
+		}
+		n = v
+	}
+
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+	root, _ := scopedPath(ns, "")
+
+	report, err := c.topValues(n, root, nil)
+	if err != nil {
+		c.sendError(w, "Failed to build report", err)
+		return
+	}
+	c.sendSuccess(w, report)
+}
+
+// topValues walks all keys below root (the whole database if empty) and
+// keeps the n largest values, largest first; progress, if set, is called
+// for every key and stops the walk with its error
+func (c *Viewer) topValues(n int, root string, progress func() error) (*TopValuesReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TopValuesReport{}
+	h := make(topValueHeap, 0, n)
+	err = db.View(func(tx *bolt.Tx) error {
+		walk := walkKeys
+		if root != "" {
+			b := c.findBucket(tx, root)
+			if b == nil {
+				return fmt.Errorf("bucket not found: %s", root)
+			}
+			walk = func(_ *bolt.Tx, fn func(bucket string, k, v []byte) error) error {
+				return walkBucketKeys(b, root, fn)
+			}
+		}
+		return walk(tx, func(bucket string, k, v []byte) error {
+			if progress != nil {
+				if err := progress(); err != nil {
+					return err
+				}
+			}
+			report.Scanned++
+			report.TotalBytes += int64(len(k) + len(v))
+			if len(h) == n && len(v) <= h[0].Size {
+				return nil
+			}
+			// Strings are only built for values entering the heap
+			top := TopValue{Bucket: bucket, Key: string(k), Size: len(v), KeySize: len(k)}
+			if len(h) == n {
+				h[0] = top
+				heap.Fix(&h, 0)
+			} else {
+				heap.Push(&h, top)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Values = []TopValue(h)
+	sort.SliceStable(report.Values, func(i, j int) bool {
+		return report.Values[i].Size > report.Values[j].Size
+	})
+	return report, nil
+}
+
+// walkKeys calls fn for every key of the database with the path of its
+// bucket; k and v are only valid during the call
+func walkKeys(tx *bolt.Tx, fn func(bucket string, k, v []byte) error) error {
+	return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return walkBucketKeys(b, string(name), fn)
+	})
+}
+
+// walkBucketKeys calls fn for the keys of b and its sub-buckets
+func walkBucketKeys(b *bolt.Bucket, path string, fn func(bucket string, k, v []byte) error) error {
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return walkBucketKeys(b.Bucket(k), path+"/"+string(k), fn)
+		}
+		return fn(path, k, v)
+	})
+}
+
+// TreemapNode a bucket and the bytes its pages use; Size includes the
+// sub-buckets in Children, Self is what is left for the bucket's own keys
+type TreemapNode struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Size     int64         `json:"size"`
+	Self     int64         `json:"self"`
+	Keys     int           `json:"keys"`
+	Children []TreemapNode `json:"children,omitempty"`
+}
+
+// handleTreemap returns the bucket sizes below ?path=, the whole database
+// if empty
+func (c *Viewer) handleTreemap(w http.ResponseWriter, r *http.Request) {
+	path, err := scopedPathParam(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+
+	tree, err := c.treemap(path)
+	if err != nil {
+		c.sendError(w, "Failed to build report", err)
+		return
+	}
+	c.sendSuccess(w, tree)
+}
+
+// treemap sums LeafInuse and BranchInuse per bucket; inline buckets live in
+// the page of their parent and count towards the parent
+func (c *Viewer) treemap(bucketPath string) (*TreemapNode, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	bucketPath = strings.Trim(bucketPath, "/")
+	var root TreemapNode
+	err = db.View(func(tx *bolt.Tx) error {
+		if bucketPath != "" {
+			b := c.findBucket(tx, bucketPath)
+			if b == nil {
+				return fmt.Errorf("bucket not found: %s", bucketPath)
+			}
+			root = treemapBucket(b, bucketPath[strings.LastIndex(bucketPath, "/")+1:], bucketPath)
+			return nil
+		}
+
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			child := treemapBucket(b, string(name), string(name))
+			root.Size += child.Size
+			root.Keys += child.Keys
+			root.Children = append(root.Children, child)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(root.Children, func(i, j int) bool {
+		return root.Children[i].Size > root.Children[j].Size
+	})
+
+	return &root, nil
+}
+
+// treemapBucket builds the node of b from its own pages and its sub-buckets,
+// children are sorted largest first
+func treemapBucket(b *bolt.Bucket, name, path string) TreemapNode {
+	node := TreemapNode{Name: name, Path: path}
+
+	var children int64
+	b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			node.Keys++
+			return nil
+		}
+		child := treemapBucket(b.Bucket(k), string(k), path+"/"+string(k))
+		children += child.Size
+		node.Keys += child.Keys
+		node.Children = append(node.Children, child)
+		return nil
+	})
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return node.Children[i].Size > node.Children[j].Size
+	})
+
+	// Stats covers the sub-buckets too
+	stats := b.Stats()
+	node.Size = int64(stats.LeafInuse + stats.BranchInuse)
+	node.Self = node.Size - children
+	return node
+}
+
+// Defaults of /api/report/fill
+const (
+	// defaultFillBelow buckets whose own pages are used less than this
+	// percentage are reported
+	defaultFillBelow = 50
+	// defaultFillMinPages buckets with fewer pages are left out, a bucket
+	// of one page is rarely full
+	defaultFillMinPages = 4
+)
+
+// FillEntry a bucket whose own pages, not those of its sub-buckets, are
+// poorly used
+type FillEntry struct {
+	Bucket string `json:"bucket"`
+	Keys   int    `json:"keys"`
+	// Pages the leaf and branch pages, overflow pages included
+	Pages int     `json:"pages"`
+	Inuse int     `json:"inuse"`
+	Alloc int     `json:"alloc"`
+	Fill  float64 `json:"fill"`
+	// Wasted the allocated bytes not in use
+	Wasted int `json:"wasted"`
+}
+
+// FillReport the page utilization of a bucket tree
+type FillReport struct {
+	Bucket   string  `json:"bucket"`
+	Below    float64 `json:"below"`
+	MinPages int     `json:"minPages"`
+	// Buckets the buckets checked; Inuse, Alloc and Fill of all of them
+	Buckets int     `json:"buckets"`
+	Inuse   int64   `json:"inuse"`
+	Alloc   int64   `json:"alloc"`
+	Fill    float64 `json:"fill"`
+	// Entries the buckets below the fill percentage, most wasted bytes first
+	Entries []FillEntry `json:"entries"`
+}
+
+// handleFillReport lists the buckets below ?path= whose pages are less than
+// ?below= percent used
+func (c *Viewer) handleFillReport(w http.ResponseWriter, r *http.Request) {
+	bucketPath, err := scopedPathParam(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+	below := float64(defaultFillBelow)
+	if s := r.URL.Query().Get("below"); s != "" {
+		if below, err = strconv.ParseFloat(s, 64); err != nil || below <= 0 || below > 100 {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid below", fmt.Errorf("invalid below %q, want a percentage above 0 up to 100", s))
+			return
+		}
+	}
+	minPages := defaultFillMinPages
+	if s := r.URL.Query().Get("minPages"); s != "" {
+		if minPages, err = strconv.Atoi(s); err != nil || minPages < 1 {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid minPages", fmt.Errorf("invalid minPages %q", s))
+			return
+		}
+	}
+
+	report, err := c.fillReport(bucketPath, below, minPages)
+	if err != nil {
+		c.sendError(w, "Failed to build report", err)
+		return
+	}
+	c.sendSuccess(w, report)
+}
+
+// fillReport checks the buckets below bucketPath, the whole database if
+// empty
+func (c *Viewer) fillReport(bucketPath string, below float64, minPages int) (*FillReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	bucketPath = strings.Trim(bucketPath, "/")
+	report := &FillReport{Bucket: bucketPath, Below: below, MinPages: minPages, Entries: []FillEntry{}}
+	err = db.View(func(tx *bolt.Tx) error {
+		if bucketPath != "" {
+			b := c.findBucket(tx, bucketPath)
+			if b == nil {
+				return fmt.Errorf("bucket not found: %s", bucketPath)
+			}
+			fillBucket(b, bucketPath, report)
+			return nil
+		}
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			fillBucket(b, string(name), report)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Fill = fillPercent(int(report.Inuse), int(report.Alloc))
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		return report.Entries[i].Wasted > report.Entries[j].Wasted
+	})
+	return report, nil
+}
+
+// fillBucket adds b and its sub-buckets to the report and returns the
+// statistics of b including its sub-buckets; its own pages are what is left
+// after subtracting theirs
+func fillBucket(b *bolt.Bucket, path string, report *FillReport) bolt.BucketStats {
+	stats := b.Stats()
+	scanned(b.Tx(), int64(stats.BranchInuse+stats.LeafInuse))
+	own := stats
+	b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		sub := fillBucket(b.Bucket(k), path+"/"+string(k), report)
+		own.KeyN -= sub.KeyN
+		own.BranchPageN -= sub.BranchPageN
+		own.BranchOverflowN -= sub.BranchOverflowN
+		own.LeafPageN -= sub.LeafPageN
+		own.LeafOverflowN -= sub.LeafOverflowN
+		own.BranchInuse -= sub.BranchInuse
+		own.LeafInuse -= sub.LeafInuse
+		own.BranchAlloc -= sub.BranchAlloc
+		own.LeafAlloc -= sub.LeafAlloc
+		return nil
+	})
+
+	// Inline buckets live in their parent's page
+	if b.Root() == 0 {
+		return stats
+	}
+	report.Buckets++
+	inuse, alloc := own.BranchInuse+own.LeafInuse, own.BranchAlloc+own.LeafAlloc
+	report.Inuse += int64(inuse)
+	report.Alloc += int64(alloc)
+	entry := FillEntry{
+		Bucket: path,
+		Keys:   own.KeyN,
+		Pages:  own.BranchPageN + own.BranchOverflowN + own.LeafPageN + own.LeafOverflowN,
+		Inuse:  inuse,
+		Alloc:  alloc,
+		Fill:   fillPercent(inuse, alloc),
+		Wasted: alloc - inuse,
+	}
+	if entry.Pages >= report.MinPages && entry.Fill < report.Below {
+		report.Entries = append(report.Entries, entry)
+	}
+	return stats
+}
+
+// KeyCount the keys below a bucket, in all of its sub-buckets
+type KeyCount struct {
+	Path string `json:"path"`
+	// Keys values, Buckets sub-buckets, Bytes key and value bytes
+	Keys    int64 `json:"keys"`
+	Buckets int64 `json:"buckets"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// KeyCountReport the exact key count of a bucket tree, the whole database
+// if Bucket is empty; bucket statistics count sub-buckets as keys and are
+// only kept per bucket
+type KeyCountReport struct {
+	Bucket  string `json:"bucket"`
+	Keys    int64  `json:"keys"`
+	Buckets int64  `json:"buckets"`
+	Bytes   int64  `json:"bytes"`
+	// Children the counts of the buckets directly below Bucket, most keys
+	// first
+	Children []KeyCount `json:"children"`
+}
+
+// handleCountKeys starts a count job for ?path=, counting at most ?rate=
+// keys per second
+func (c *Viewer) handleCountKeys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := JobRequest{Kind: "count", Path: q.Get("path"), Namespace: q.Get(namespaceParam)}
+	if s := q.Get("rate"); s != "" {
+		rate, err := strconv.Atoi(s)
+		if err != nil || rate <= 0 {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid rate", fmt.Errorf("invalid rate %q", s))
+			return
+		}
+		req.Rate = rate
+	}
+	c.submitJob(w, req)
+}
+
+// countKeys counts the keys and buckets below bucketPath, the whole
+// database if empty; progress, if set, is called for every key and bucket
+// and stops the walk with its error
+func (c *Viewer) countKeys(bucketPath string, progress func() error) (*KeyCountReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &KeyCountReport{Bucket: bucketPath, Children: []KeyCount{}}
+	// The names of buckets count towards the bytes of their parent
+	addChild := func(b *bolt.Bucket, name []byte, path string) error {
+		child := KeyCount{Path: path}
+		if err := countBucket(b, &child, progress); err != nil {
+			return err
+		}
+		report.Keys += child.Keys
+		report.Buckets += child.Buckets + 1
+		report.Bytes += child.Bytes + int64(len(name))
+		report.Children = append(report.Children, child)
+		return nil
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if bucketPath == "" {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				return addChild(b, name, string(name))
+			})
+		}
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		var n int64
+		defer func() { scanned(tx, n) }()
+		return b.ForEach(func(k, v []byte) error {
+			if progress != nil {
+				if err := progress(); err != nil {
+					return err
+				}
+			}
+			if v == nil {
+				return addChild(b.Bucket(k), k, bucketPath+"/"+string(k))
+			}
+			n += int64(len(k) + len(v))
+			report.Keys++
+			report.Bytes += int64(len(k) + len(v))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(report.Children, func(i, j int) bool {
+		return report.Children[i].Keys > report.Children[j].Keys
+	})
+	return report, nil
+}
+
+// countBucket adds the keys and sub-buckets of b to count
+func countBucket(b *bolt.Bucket, count *KeyCount, progress func() error) error {
+	var n int64
+	defer func() { scanned(b.Tx(), n) }()
+	return b.ForEach(func(k, v []byte) error {
+		if progress != nil {
+			if err := progress(); err != nil {
+				return err
+			}
+		}
+		n += int64(len(k) + len(v))
+		count.Bytes += int64(len(k) + len(v))
+		if v == nil {
+			count.Buckets++
+			return countBucket(b.Bucket(k), count, progress)
+		}
+		count.Keys++
+		return nil
+	})
+}
+
+// TypeCount keys of one detected value type
+type TypeCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+	// Example the first key of the type
+	Example string `json:"example"`
+}
+
+// TypeHistogram the value types of a bucket
+type TypeHistogram struct {
+	Bucket    string      `json:"bucket"`
+	Recursive bool        `json:"recursive"`
+	Keys      int         `json:"keys"`
+	Bytes     int64       `json:"bytes"`
+	Types     []TypeCount `json:"types"`
+}
+
+// handleTypeHistogram counts the value types of ?path=, ?recursive=1
+// includes sub-buckets
+func (c *Viewer) handleTypeHistogram(w http.ResponseWriter, r *http.Request) {
+	bucketPath, err := scopedPathParam(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+	if bucketPath == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Missing bucket path", fmt.Errorf("path is required"))
+		return
+	}
+
+	hist, err := c.typeHistogram(bucketPath, r.URL.Query().Get("recursive") == "1", nil)
+	if err != nil {
+		c.sendError(w, "Failed to build report", err)
+		return
+	}
+	c.sendSuccess(w, hist)
+}
+
+// typeHistogram counts keys and value bytes by detectValueType, most
+// frequent type first; progress, if set, is called for every key and stops
+// the walk with its error
+func (c *Viewer) typeHistogram(bucketPath string, recursive bool, progress func() error) (*TypeHistogram, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	hist := &TypeHistogram{Bucket: bucketPath, Recursive: recursive}
+	counts := map[string]*TypeCount{}
+	add := func(_ string, k, v []byte) error {
+		if progress != nil {
+			if err := progress(); err != nil {
+				return err
+			}
+		}
+		typ := detectValueType(v)
+		tc := counts[typ]
+		if tc == nil {
+			tc = &TypeCount{Type: typ, Example: string(k)}
+			counts[typ] = tc
+		}
+		tc.Count++
+		tc.Bytes += int64(len(v))
+		hist.Keys++
+		hist.Bytes += int64(len(v))
+		return nil
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		if recursive {
+			return walkBucketKeys(b, bucketPath, add)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return nil
+			}
+			return add(bucketPath, k, v)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hist.Types = make([]TypeCount, 0, len(counts))
+	for _, tc := range counts {
+		hist.Types = append(hist.Types, *tc)
+	}
+	sort.Slice(hist.Types, func(i, j int) bool {
+		if hist.Types[i].Count != hist.Types[j].Count {
+			return hist.Types[i].Count > hist.Types[j].Count
+		}
+		return hist.Types[i].Type < hist.Types[j].Type
+	})
+	return hist, nil
+}
+
+// detectValueType classifies a value as Timestamp (time.MarshalBinary),
+// JSON, Protobuf (an Any with a type URL), MessagePack, CBOR, String or
+// Binary; gzip and zstd values by the start of their content
+func detectValueType(value []byte) string {
+	if compression, data, complete, err := decompressPrefix(value, previewDecompressedBytes); err == nil && compression != "" {
+		if !complete {
+			if truncatedJSON(data) {
+				return "JSON"
+			}
+			data = trimPartialRune(data)
+		}
+		value = data
+	}
+	// time.MarshalBinary writes 15 bytes, 16 with second-level zone offsets
+	if (len(value) == 15 || len(value) == 16) && (value[0] == 1 || value[0] == 2) {
+		var t time.Time
+		if t.UnmarshalBinary(value) == nil {
+			return "Timestamp"
+		}
+	}
+	if len(value) > 0 && json.Valid(value) {
+		return "JSON"
+	}
+	var any anypb.Any
+	if proto.Unmarshal(value, &any) == nil && strings.Contains(any.GetTypeUrl(), "/") {
+		return "Protobuf"
+	}
+	if codec, _ := detectCodec(value); codec != "" {
+		return codec
+	}
+	if len(value) > 0 && utf8.Valid(value) && bytes.IndexByte(value, 0) < 0 {
+		return "String"
+	}
+	return "Binary"
+}
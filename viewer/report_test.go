@@ -0,0 +1,248 @@
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestTopValues(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("a"))
+		if err != nil {
+			return err
+		}
+		nested, err := b.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		for i := 1; i <= 10; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("k%02d", i)), make([]byte, i*10)); err != nil {
+				return err
+			}
+		}
+		return nested.Put([]byte("big"), make([]byte, 500))
+	})
+	s := newTestServer(t, path)
+
+	var report TopValuesReport
+	s.Get("/api/report/top?n=3").Decode(t, &report)
+	want := []TopValue{
+		{Bucket: "a/nested", Key: "big", Size: 500, KeySize: 3},
+		{Bucket: "a", Key: "k10", Size: 100, KeySize: 3},
+		{Bucket: "a", Key: "k09", Size: 90, KeySize: 3},
+	}
+	if fmt.Sprint(report.Values) != fmt.Sprint(want) {
+		t.Errorf("values = %+v, want %+v", report.Values, want)
+	}
+	if report.Scanned != 11 {
+		t.Errorf("scanned = %d, want 11", report.Scanned)
+	}
+
+	if resp := s.API(http.MethodGet, "/api/report/top?n=0", ""); resp.Status != http.StatusBadRequest {
+		t.Errorf("n=0 status = %d, want 400", resp.Status)
+	}
+}
+
+func TestTreemap(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		small, err := tx.CreateBucket([]byte("small"))
+		if err != nil {
+			return err
+		}
+		if err := small.Put([]byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		big, err := tx.CreateBucket([]byte("big"))
+		if err != nil {
+			return err
+		}
+		nested, err := big.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 100; i++ {
+			if err := nested.Put([]byte(fmt.Sprintf("k%03d", i)), make([]byte, 200)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s := newTestServer(t, path)
+
+	var root TreemapNode
+	s.Get("/api/report/treemap").Decode(t, &root)
+	if len(root.Children) != 2 || root.Children[0].Name != "big" || root.Keys != 101 {
+		t.Fatalf("root = %+v, want big before small and 101 keys", root)
+	}
+	big := root.Children[0]
+	if len(big.Children) != 1 || big.Children[0].Path != "big/nested" {
+		t.Fatalf("big = %+v, want child big/nested", big)
+	}
+	if big.Size < 100*200 || big.Size != big.Self+big.Children[0].Size {
+		t.Errorf("big size = %d self = %d nested = %d", big.Size, big.Self, big.Children[0].Size)
+	}
+	if root.Size != big.Size+root.Children[1].Size {
+		t.Errorf("root size = %d, want the sum of its children", root.Size)
+	}
+
+	var nested TreemapNode
+	s.Get("/api/report/treemap?path=big/nested").Decode(t, &nested)
+	if nested.Name != "nested" || nested.Size != big.Children[0].Size {
+		t.Errorf("nested = %+v, want the big/nested node", nested)
+	}
+}
+
+func TestTypeHistogram(t *testing.T) {
+	ts, _ := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).MarshalBinary()
+	spec, _ := proto.Marshal(&anypb.Any{TypeUrl: "types.containerd.io/opencontainers/runtime-spec/1/Spec", Value: []byte("{}")})
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("mixed"))
+		if err != nil {
+			return err
+		}
+		values := map[string][]byte{
+			"createdat": ts,
+			"spec":      spec,
+			"json":      []byte(`{"a":1}`),
+			"text":      []byte("hello"),
+			"text2":     []byte("world"),
+			"counter":   {0, 0, 0, 42},
+		}
+		for k, v := range values {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		nested, err := b.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		return nested.Put([]byte("deep"), []byte("string"))
+	})
+	s := newTestServer(t, path)
+
+	counts := func(hist TypeHistogram) map[string]int {
+		m := map[string]int{}
+		for _, tc := range hist.Types {
+			m[tc.Type] = tc.Count
+		}
+		return m
+	}
+
+	var hist TypeHistogram
+	s.Get("/api/report/types?path=mixed").Decode(t, &hist)
+	want := map[string]int{"Timestamp": 1, "Protobuf": 1, "JSON": 1, "String": 2, "Binary": 1}
+	if got := counts(hist); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("types = %v, want %v", got, want)
+	}
+	if hist.Keys != 6 || hist.Types[0].Type != "String" {
+		t.Errorf("histogram = %+v, want 6 keys with String first", hist)
+	}
+
+	s.Get("/api/report/types?path=mixed&recursive=1").Decode(t, &hist)
+	if got := counts(hist); got["String"] != 3 || hist.Keys != 7 {
+		t.Errorf("recursive types = %v (%d keys), want 3 strings of 7 keys", got, hist.Keys)
+	}
+}
+
+func TestSchemaReport(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("records"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 20; i++ {
+			value := fmt.Sprintf(`{"id":%d,"name":"r%d","tags":["a","b"],"owner":{"uid":1}}`, i, i)
+			if i%2 == 1 {
+				// Odd records lack the owner and have a numeric name
+				value = fmt.Sprintf(`{"id":%d,"name":%d,"tags":[]}`, i, i)
+			}
+			b.Put([]byte(fmt.Sprintf("r%02d", i)), []byte(value))
+		}
+		return b.Put([]byte("zz-text"), []byte("not json"))
+	})
+	s := newTestServer(t, path)
+
+	var report SchemaReport
+	s.Get("/api/report/schema?path=records&sample=7").Decode(t, &report)
+	// Every third of 21 candidates
+	if report.Candidates != 21 || report.Sampled != 7 || report.Skipped != 0 {
+		t.Errorf("report = %+v, want 7 of 21 sampled", report)
+	}
+
+	s.Get("/api/report/schema?path=records").Decode(t, &report)
+	if report.Sampled != 21 || report.Skipped != 1 {
+		t.Fatalf("report = %+v, want all sampled and the text skipped", report)
+	}
+	fields := report.Schema.Fields
+	if id := fields["id"]; id == nil || id.Optional || id.Types["number"] != 20 || len(id.Examples) != maxSchemaExamples {
+		t.Errorf("id = %+v, want a required number with examples", id)
+	}
+	if name := fields["name"]; name == nil || name.Types["string"] != 10 || name.Types["number"] != 10 {
+		t.Errorf("name = %+v, want mixed string and number", name)
+	}
+	owner := fields["owner"]
+	if owner == nil || !owner.Optional || owner.Fields["uid"] == nil || owner.Fields["uid"].Optional {
+		t.Errorf("owner = %+v, want an optional object with a required uid", owner)
+	}
+	if tags := fields["tags"]; tags == nil || tags.Items == nil || tags.Items.Count != 20 {
+		t.Errorf("tags = %+v, want 20 string items", tags)
+	}
+
+	if r := s.API(http.MethodGet, "/api/report/schema?path=records&sample=0", ""); r.Status != http.StatusBadRequest {
+		t.Errorf("sample=0: status %d, want 400", r.Status)
+	}
+}
+
+func TestFillReport(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		// Pages split at a tenth of their size leave the rest unused
+		for _, name := range []string{"sparse", "dense"} {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			if name == "sparse" {
+				b.FillPercent = 0.1
+			} else {
+				b.FillPercent = 1
+			}
+			for i := 0; i < 1000; i++ {
+				if err := b.Put([]byte(fmt.Sprintf("key-%04d", i)), make([]byte, 100)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	s := newTestServer(t, path)
+
+	var report FillReport
+	s.Get("/api/report/fill").Decode(t, &report)
+	if report.Buckets != 2 || report.Fill <= 0 || report.Fill >= 100 {
+		t.Errorf("report = %+v, want two buckets partly used", report)
+	}
+	if len(report.Entries) != 1 || report.Entries[0].Bucket != "sparse" || report.Entries[0].Keys != 1000 {
+		t.Fatalf("entries = %+v, want sparse", report.Entries)
+	}
+	if e := report.Entries[0]; e.Fill >= 50 || e.Wasted != e.Alloc-e.Inuse || e.Pages < defaultFillMinPages {
+		t.Errorf("sparse = %+v", e)
+	}
+
+	var bucket BucketInfo
+	s.Get("/api/bucket/dense").Decode(t, &bucket)
+	if bucket.Stats.LeafAlloc == 0 || bucket.Stats.LeafFill < 50 || bucket.Stats.Fill == 0 {
+		t.Errorf("dense stats = %+v, want its pages mostly used", bucket.Stats)
+	}
+
+	if r := s.API(http.MethodGet, "/api/report/fill?below=0", ""); r.Status != http.StatusBadRequest {
+		t.Errorf("below=0: status %d, want 400", r.Status)
+	}
+}
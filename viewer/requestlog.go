@@ -0,0 +1,187 @@
+// requestlog.go - request logging middleware
+package viewer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// request log levels
+const (
+	RequestLogAll    = "all"
+	RequestLogErrors = "errors" // status 400 and above
+	RequestLogNone   = "none"
+)
+
+// request log formats
+const (
+	RequestLogText = "text"
+	RequestLogJSON = "json"
+)
+
+// parseRequestLog validates --request-log and --request-log-format values
+func parseRequestLog(level, format string) (string, string, error) {
+	switch level {
+	case "":
+		level = RequestLogAll
+	case RequestLogAll, RequestLogErrors, RequestLogNone:
+	default:
+		return "", "", fmt.Errorf("invalid request log level %q, expected %s, %s or %s", level, RequestLogAll, RequestLogErrors, RequestLogNone)
+	}
+	switch format {
+	case "":
+		format = RequestLogText
+	case RequestLogText, RequestLogJSON:
+	default:
+		return "", "", fmt.Errorf("invalid request log format %q, expected %s or %s", format, RequestLogText, RequestLogJSON)
+	}
+	return level, format, nil
+}
+
+// RequestLogEntry one logged request
+type RequestLogEntry struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Query    string    `json:"query,omitempty"`
+	Status   int       `json:"status"`
+	Duration float64   `json:"durationMs"`
+	Bytes    int64     `json:"bytes"`
+	Remote   string    `json:"remote"`
+	// User authenticated user, set by authenticate
+	User string `json:"user,omitempty"`
+}
+
+// requestLogger writes request log entries as log lines or JSON lines
+type requestLogger struct {
+	level  string
+	format string
+
+	mu  sync.Mutex
+	out io.Writer // JSON destination, os.Stderr unless set
+}
+
+// requestLogKey context key of the *RequestLogEntry of a request
+type requestLogKey struct{}
+
+// setRequestUser records the authenticated user in the request log entry
+func setRequestUser(r *http.Request, user string) {
+	if entry, ok := r.Context().Value(requestLogKey{}).(*RequestLogEntry); ok {
+		entry.User = user
+	}
+}
+
+// logRequests middleware logs method, path, status, duration, bytes and
+// remote address of every request according to the request log level
+func (c *Viewer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.requestLog.level == RequestLogNone && c.accessLog == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		entry := &RequestLogEntry{
+			Time:   time.Now(),
+			Method: r.Method,
+			Path:   r.URL.EscapedPath(),
+			Query:  r.URL.RawQuery,
+			Remote: r.RemoteAddr,
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, entry)))
+
+		entry.Status = rec.status
+		entry.Bytes = rec.bytes
+		entry.Duration = float64(time.Since(entry.Time).Microseconds()) / 1000
+		c.requestLog.log(entry)
+		if c.accessLog != nil {
+			if err := c.accessLog.log(entry, r); err != nil {
+				slog.Error("Failed to write access log", "error", err)
+			}
+		}
+	})
+}
+
+// log writes an entry if its status passes the level
+func (l *requestLogger) log(e *RequestLogEntry) {
+	if l.level == RequestLogNone || l.level == RequestLogErrors && e.Status < http.StatusBadRequest {
+		return
+	}
+
+	if l.format == RequestLogJSON {
+		out := l.out
+		if out == nil {
+			out = os.Stderr
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if err := json.NewEncoder(out).Encode(e); err != nil {
+			slog.Error("Failed to write request log", "error", err)
+		}
+		return
+	}
+
+	target := e.Path
+	if e.Query != "" {
+		target += "?" + e.Query
+	}
+	attrs := []any{"method", e.Method, "path", target, "status", e.Status, "durationMs", e.Duration, "bytes", e.Bytes, "remote", e.Remote}
+	if e.User != "" {
+		attrs = append(attrs, "user", e.User)
+	}
+	slog.Info("Request", attrs...)
+}
+
+// statusRecorder captures the status and body size of a response; hijacked
+// WebSocket connections are recorded as 101
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = status, true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Flush supports streamed responses
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack supports the WebSocket upgrade
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not implement http.Hijacker")
+	}
+	s.status, s.wroteHeader = http.StatusSwitchingProtocols, true
+	return h.Hijack()
+}
+
+// Unwrap gives http.ResponseController access to the original writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,71 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// loggedRequests serves a fixture with JSON request logging at level and
+// returns the entries logged for paths
+func loggedRequests(t *testing.T, level string, paths ...string) []RequestLogEntry {
+	t.Helper()
+
+	var out bytes.Buffer
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.requestLog = requestLogger{level: level, format: RequestLogJSON, out: &out}
+	})
+	for _, p := range paths {
+		s.Do(http.MethodGet, p, nil)
+	}
+
+	var entries []RequestLogEntry
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var e RequestLogEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("invalid log line: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRequestLog(t *testing.T) {
+	entries := loggedRequests(t, RequestLogAll, "/api/bucket/misc?cursor=", "/api/missing")
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2: %+v", len(entries), entries)
+	}
+	ok, missing := entries[0], entries[1]
+	if ok.Method != http.MethodGet || ok.Path != "/api/bucket/misc" || ok.Status != http.StatusOK || ok.Bytes == 0 || ok.Remote == "" {
+		t.Errorf("bucket entry = %+v", ok)
+	}
+	if missing.Status != http.StatusNotFound {
+		t.Errorf("unmatched route status = %d, want 404", missing.Status)
+	}
+
+	entries = loggedRequests(t, RequestLogErrors, "/api/buckets", "/api/bucket/nope")
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Path, "/nope") {
+		t.Errorf("errors level logged %+v, want the failed request only", entries)
+	}
+
+	if entries := loggedRequests(t, RequestLogNone, "/api/buckets"); len(entries) != 0 {
+		t.Errorf("none level logged %+v", entries)
+	}
+}
+
+func TestParseRequestLog(t *testing.T) {
+	if level, format, err := parseRequestLog("", ""); err != nil || level != RequestLogAll || format != RequestLogText {
+		t.Errorf("defaults = %q %q %v", level, format, err)
+	}
+	if _, _, err := parseRequestLog("debug", ""); err == nil {
+		t.Error("invalid level accepted")
+	}
+	if _, _, err := parseRequestLog("", "xml"); err == nil {
+		t.Error("invalid format accepted")
+	}
+}
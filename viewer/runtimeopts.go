@@ -0,0 +1,91 @@
+// runtimeopts.go - the runtime options stored with containers: the runc
+// shims' Options, the CRI plugin's runtimeoptions naming a shim config file,
+// and the options of the removed io.containerd.runtime.v1.linux runtime
+package viewer
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// legacyOptionField a field of an option message whose type is no longer
+// part of the containerd API
+type legacyOptionField struct {
+	name string
+	bool bool
+}
+
+// legacyOptionFields the fields of option messages of the v1 runtime by
+// number; containers created before upgrading to containerd 2.0 keep them
+var legacyOptionFields = map[string]map[protowire.Number]legacyOptionField{
+	"containerd.linux.runc.RuncOptions": {
+		1: {name: "runtime"},
+		2: {name: "runtime_root"},
+		3: {name: "criu_path"},
+		4: {name: "systemd_cgroup", bool: true},
+	},
+}
+
+// resolveLegacyOptions decodes the fields of a v1 runtime option message,
+// false for other types and malformed values
+func resolveLegacyOptions(any *anypb.Any) (map[string]interface{}, bool) {
+	names, ok := legacyOptionFields[any.GetTypeUrl()]
+	if !ok {
+		return nil, false
+	}
+	fields := map[string]interface{}{}
+	data := any.GetValue()
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, false
+		}
+		data = data[n:]
+		field, known := names[num]
+		switch {
+		case known && field.bool && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, false
+			}
+			fields[field.name], data = v != 0, data[n:]
+		case known && !field.bool && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, false
+			}
+			fields[field.name], data = string(v), data[n:]
+		default:
+			// Fields of later releases are skipped, not guessed at
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, false
+			}
+			data = data[n:]
+		}
+	}
+	return fields, true
+}
+
+// decodeRuntimeOptions the fields of a container's runtime options, nil if
+// it has none or their type is unknown
+func decodeRuntimeOptions(value []byte) map[string]interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	var any anypb.Any
+	if err := proto.Unmarshal(value, &any); err != nil {
+		return nil
+	}
+	if fields, ok := resolveAny(&any); ok {
+		return fields
+	}
+	// typeurl stores options of Go types that are not messages as JSON
+	if doc, ok := parseJSONDocument(any.GetValue()); ok {
+		if fields, ok := doc.(map[string]interface{}); ok {
+			return fields
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// schema.go - a schema inferred from a sample of the JSON values of a bucket,
+// for buckets whose format is not documented
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Sample sizes of schema inference
+const (
+	defaultSchemaSample = 100
+	maxSchemaSample     = 10000
+)
+
+// maxSchemaExamples distinct example values kept per field
+const maxSchemaExamples = 3
+
+// maxSchemaExampleLength strings of examples are cut to this many bytes
+const maxSchemaExampleLength = 100
+
+// SchemaNode what the sampled values at one position looked like
+type SchemaNode struct {
+	// Types how often each jq type (object, array, string, number,
+	// boolean, null) was seen, more than one for mixed positions
+	Types map[string]int `json:"types"`
+	// Count the values seen at this position
+	Count int `json:"count"`
+	// Optional the field is missing from some of the objects holding it
+	Optional bool `json:"optional,omitempty"`
+	// Examples distinct scalar values, strings cut to 100 bytes
+	Examples []interface{} `json:"examples,omitempty"`
+	// Fields of the objects seen here, Items the elements of the arrays
+	Fields map[string]*SchemaNode `json:"fields,omitempty"`
+	Items  *SchemaNode            `json:"items,omitempty"`
+}
+
+// SchemaReport the schema inferred from the values of a bucket
+type SchemaReport struct {
+	Bucket    string `json:"bucket"`
+	Recursive bool   `json:"recursive"`
+	Key       string `json:"key,omitempty"`
+	// Candidates the values considered, Sampled those read, every
+	// Candidates/sample-th; Skipped the sampled values that are not JSON
+	Candidates int         `json:"candidates"`
+	Sampled    int         `json:"sampled"`
+	Skipped    int         `json:"skipped"`
+	Schema     *SchemaNode `json:"schema"`
+}
+
+// add records v at this position
+func (n *SchemaNode) add(v interface{}) {
+	typ := jsonTypeName(v)
+	if n.Types == nil {
+		n.Types = map[string]int{}
+	}
+	n.Types[typ]++
+	n.Count++
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if n.Fields == nil {
+			n.Fields = map[string]*SchemaNode{}
+		}
+		for k, fv := range t {
+			field := n.Fields[k]
+			if field == nil {
+				field = &SchemaNode{}
+				n.Fields[k] = field
+			}
+			field.add(fv)
+		}
+	case []interface{}:
+		if n.Items == nil && len(t) > 0 {
+			n.Items = &SchemaNode{}
+		}
+		for _, e := range t {
+			n.Items.add(e)
+		}
+	default:
+		n.addExample(v)
+	}
+}
+
+// addExample keeps v if it is not among the examples yet
+func (n *SchemaNode) addExample(v interface{}) {
+	if len(n.Examples) >= maxSchemaExamples {
+		return
+	}
+	if s, ok := v.(string); ok && len(s) > maxSchemaExampleLength {
+		v = s[:maxSchemaExampleLength] + "..."
+	}
+	for _, e := range n.Examples {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return
+		}
+	}
+	n.Examples = append(n.Examples, v)
+}
+
+// markOptional flags the fields missing from some of the objects, once all
+// values were added
+func (n *SchemaNode) markOptional() {
+	for _, field := range n.Fields {
+		// A field appears at most once per object
+		field.Optional = field.Count < n.Types["object"]
+		field.markOptional()
+	}
+	if n.Items != nil {
+		n.Items.markOptional()
+	}
+}
+
+// handleSchema infers the schema of the JSON values of ?path=
+func (c *Viewer) handleSchema(w http.ResponseWriter, r *http.Request) {
+	bucketPath, err := scopedPathParam(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+	if bucketPath == "" {
+		c.sendErrorCode(w, http.StatusBadRequest, "Missing bucket path", fmt.Errorf("path is required"))
+		return
+	}
+	sample := defaultSchemaSample
+	if s := r.URL.Query().Get("sample"); s != "" {
+		if sample, err = strconv.Atoi(s); err != nil || sample < 1 || sample > maxSchemaSample {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid sample", fmt.Errorf("invalid sample %q, want 1 to %d", s, maxSchemaSample))
+			return
+		}
+	}
+
+	report, err := c.inferSchema(bucketPath, r.URL.Query().Get("key"), r.URL.Query().Get("recursive") == "1", sample)
+	if err != nil {
+		c.sendError(w, "Failed to build report", err)
+		return
+	}
+	c.sendSuccess(w, report)
+}
+
+// errSampleDone ends the sampling walk
+var errSampleDone = errors.New("sample complete")
+
+// inferSchema samples up to sample values of the bucket, only those of key
+// if set, evenly spread over its keys so one kind of entry at the start does
+// not hide the others
+func (c *Viewer) inferSchema(bucketPath, key string, recursive bool, sample int) (*SchemaReport, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SchemaReport{Bucket: bucketPath, Recursive: recursive, Key: key, Schema: &SchemaNode{}}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		walk := func(fn func(bucket string, k, v []byte) error) error {
+			visit := func(bucket string, k, v []byte) error {
+				if key != "" && string(k) != key {
+					return nil
+				}
+				return fn(bucket, k, v)
+			}
+			if recursive {
+				return walkBucketKeys(b, bucketPath, visit)
+			}
+			return b.ForEach(func(k, v []byte) error {
+				if v == nil {
+					return nil
+				}
+				return visit(bucketPath, k, v)
+			})
+		}
+
+		// Counting first is cheap, values are not decoded
+		var scannedBytes int64
+		walk(func(_ string, k, v []byte) error {
+			report.Candidates++
+			scannedBytes += int64(len(k) + len(v))
+			return nil
+		})
+		if report.Candidates == 0 {
+			return nil
+		}
+		stride := (report.Candidates + sample - 1) / sample
+		i := 0
+		err := walk(func(_ string, k, v []byte) error {
+			defer func() { i++ }()
+			if i%stride != 0 {
+				return nil
+			}
+			if report.Sampled == sample {
+				return errSampleDone
+			}
+			report.Sampled++
+			doc, err := exprInput(string(k), v)
+			if err != nil {
+				report.Skipped++
+				return nil
+			}
+			report.Schema.add(doc)
+			return nil
+		})
+		scanned(tx, 2*scannedBytes)
+		if errors.Is(err, errSampleDone) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Schema.markOptional()
+	return report, nil
+}
@@ -0,0 +1,462 @@
+// scripting.go - sandboxed Starlark automation over the read API
+package viewer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+const (
+	// maxScriptSize limits the size of submitted scripts
+	maxScriptSize = 1024 * 1024
+	// maxScriptOutput bytes of printed output kept, like a response the
+	// output of a script is bounded
+	maxScriptOutput = 1024 * 1024
+	// maxScriptSteps bounds the work a single script may do
+	maxScriptSteps = 50_000_000
+	// scriptTimeout bounds the wall clock time of a single script
+	scriptTimeout = time.Minute
+	// scriptContextKey thread local holding the context of a run, which the
+	// builtins walking buckets check since they take no steps
+	scriptContextKey = "context"
+)
+
+// scriptLimits bounds Starlark runs, zero values use maxScriptSteps and
+// scriptTimeout
+type scriptLimits struct {
+	steps   uint64
+	timeout time.Duration
+}
+
+// ScriptResult output of a script run
+type ScriptResult struct {
+	Output   string      `json:"output"`
+	Result   interface{} `json:"result,omitempty"`
+	Steps    uint64      `json:"steps"`
+	Duration string      `json:"duration"`
+}
+
+// handleRunScript runs the Starlark script in the request body
+func (c *Viewer) handleRunScript(w http.ResponseWriter, r *http.Request) {
+	src, err := io.ReadAll(io.LimitReader(r.Body, maxScriptSize+1))
+	if err != nil {
+		c.sendError(w, "Failed to read script", err)
+		return
+	}
+	if len(src) > maxScriptSize {
+		c.sendErrorCode(w, http.StatusRequestEntityTooLarge, "Script too large", nil)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "script.star"
+	}
+
+	result, err := c.runScript(r.Context(), name, src)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Script failed", err)
+		return
+	}
+
+	c.sendSuccess(w, result)
+}
+
+// runScript executes a script with the db module bound to this viewer; the
+// value of a global named "result" is returned alongside printed output
+func (c *Viewer) runScript(ctx context.Context, name string, src []byte) (*ScriptResult, error) {
+	var out bytes.Buffer
+	truncated := false
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			if truncated {
+				return
+			}
+			if out.Len()+len(msg) >= maxScriptOutput {
+				out.WriteString("... (output truncated)\n")
+				truncated = true
+				return
+			}
+			out.WriteString(msg)
+			out.WriteByte('\n')
+		},
+	}
+	steps, timeout := c.scripts.steps, c.scripts.timeout
+	if steps == 0 {
+		steps = maxScriptSteps
+	}
+	if timeout == 0 {
+		timeout = scriptTimeout
+	}
+	thread.SetMaxExecutionSteps(steps)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	thread.SetLocal(scriptContextKey, ctx)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	predeclared := starlark.StringDict{
+		"db":   c.scriptModule(),
+		"json": starlarkjson.Module,
+	}
+
+	// Scripts are analyses rather than configuration, allow loops at top level
+	opts := &syntax.FileOptions{
+		Set:             true,
+		While:           true,
+		TopLevelControl: true,
+		GlobalReassign:  true,
+	}
+
+	start := time.Now()
+	globals, err := starlark.ExecFileOptions(opts, thread, name, src, predeclared)
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			return nil, errors.New(evalErr.Backtrace())
+		}
+		return nil, err
+	}
+
+	result := &ScriptResult{
+		Output:   out.String(),
+		Steps:    thread.ExecutionSteps(),
+		Duration: time.Since(start).String(),
+	}
+	if v, ok := globals["result"]; ok {
+		result.Result = fromStarlark(v)
+	}
+
+	return result, nil
+}
+
+// scriptModule builds the "db" module exposing the read API
+func (c *Viewer) scriptModule() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "db",
+		Members: starlark.StringDict{
+			"buckets": scriptBuiltin("db.buckets", c.starlarkBuckets),
+			"keys":    scriptBuiltin("db.keys", c.starlarkKeys),
+			"get":     scriptBuiltin("db.get", c.starlarkGet),
+			"raw":     scriptBuiltin("db.raw", c.starlarkRaw),
+			"search":  scriptBuiltin("db.search", c.starlarkSearch),
+			"decode":  scriptBuiltin("db.decode", c.starlarkDecode),
+			"stats":   scriptBuiltin("db.stats", c.starlarkStats),
+		},
+	}
+}
+
+// scriptBuiltin a builtin that is not started once its run is cancelled;
+// those walking buckets also check the context of the run as they go
+func scriptBuiltin(name string, fn func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error)) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := scriptContext(thread).Err(); err != nil {
+			return nil, err
+		}
+		return fn(thread, b, args, kwargs)
+	})
+}
+
+// starlarkBuckets implements db.buckets(path="") listing sub-bucket names
+func (c *Viewer) starlarkBuckets(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path?", &path); err != nil {
+		return nil, err
+	}
+
+	names, err := c.listChildren(scriptContext(thread), path, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	return toStarlark(names)
+}
+
+// starlarkKeys implements db.keys(path, limit=0) listing key names
+func (c *Viewer) starlarkKeys(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	var limit int
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "limit?", &limit); err != nil {
+		return nil, err
+	}
+
+	names, err := c.listChildren(scriptContext(thread), path, false, limit)
+	if err != nil {
+		return nil, err
+	}
+	return toStarlark(names)
+}
+
+// starlarkGet implements db.get(path, key): JSON values become dicts and
+// lists, text becomes a string, binary data becomes bytes, missing keys None
+func (c *Viewer) starlarkGet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path, key string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "key", &key); err != nil {
+		return nil, err
+	}
+
+	value, err := c.getRawValue(path, key)
+	if err != nil {
+		return starlark.None, nil
+	}
+
+	var jsonValue interface{}
+	if json.Unmarshal(value, &jsonValue) == nil {
+		return toStarlark(jsonValue)
+	}
+	if c.isUTF8(value) {
+		return starlark.String(value), nil
+	}
+	return starlark.Bytes(value), nil
+}
+
+// starlarkRaw implements db.raw(path, key) returning the raw bytes or None
+func (c *Viewer) starlarkRaw(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path, key string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "key", &key); err != nil {
+		return nil, err
+	}
+
+	value, err := c.getRawValue(path, key)
+	if err != nil {
+		return starlark.None, nil
+	}
+	return starlark.Bytes(value), nil
+}
+
+// starlarkSearch implements db.search(query)
+func (c *Viewer) starlarkSearch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var query string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "query", &query); err != nil {
+		return nil, err
+	}
+
+	results, err := c.searchKeys(scriptContext(thread), query, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return toStarlark(results)
+}
+
+// starlarkDecode implements db.decode(path, key, kind="time"|"protobuf"|"integer"|"gob"|"msgpack"|"cbor"|"base64")
+func (c *Viewer) starlarkDecode(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path, key string
+	kind := "time"
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "key", &key, "kind?", &kind); err != nil {
+		return nil, err
+	}
+
+	value, err := c.getRawValue(path, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded map[string]interface{}
+	switch kind {
+	case "time":
+		decoded, err = decodeTimeValue(value)
+	case "protobuf":
+		decoded, err = decodeProtobufValue(value)
+	case "integer":
+		decoded, err = decodeIntegerValue(value)
+	case "gob":
+		decoded, err = decodeGobValue(value)
+	case "msgpack":
+		decoded, err = decodeMsgpackValue(value)
+	case "cbor":
+		decoded, err = decodeCBORValue(value)
+	case "base64":
+		decoded, err = decodeBase64Value(value)
+	default:
+		return nil, fmt.Errorf("%s: unknown kind %q, expected time, protobuf, integer, gob, msgpack, cbor or base64", b.Name(), kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	return toStarlark(decoded)
+}
+
+// starlarkStats implements db.stats()
+func (c *Viewer) starlarkStats(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+
+	stats, err := c.getDatabaseStats()
+	if err != nil {
+		return nil, err
+	}
+	return toStarlark(stats)
+}
+
+// scriptContext the context of the run a builtin is called from
+func scriptContext(thread *starlark.Thread) context.Context {
+	if ctx, ok := thread.Local(scriptContextKey).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// listChildren lists sub-bucket names (buckets=true) or key names of a
+// bucket, the root level when path is empty, until ctx is done
+func (c *Viewer) listChildren(ctx context.Context, path string, buckets bool, limit int) ([]string, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if strings.Trim(path, "/") == "" {
+			if !buckets {
+				return nil
+			}
+			return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				names = append(names, string(name))
+				return nil
+			})
+		}
+
+		b := c.findBucket(tx, path)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", path)
+		}
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if (v == nil) == buckets {
+				names = append(names, string(k))
+				if limit > 0 && len(names) >= limit {
+					break
+				}
+			}
+		}
+		return nil
+	})
+
+	return names, err
+}
+
+// toStarlark converts a Go value to Starlark through its JSON form, so any
+// API result type can be handed to scripts
+func toStarlark(v interface{}) (starlark.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return jsonToStarlark(generic), nil
+}
+
+// jsonToStarlark converts a decoded JSON value
+func jsonToStarlark(v interface{}) starlark.Value {
+	switch t := v.(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(t)
+	case string:
+		return starlark.String(t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return starlark.MakeInt64(i)
+		}
+		f, _ := t.Float64()
+		return starlark.Float(f)
+	case float64:
+		return starlark.Float(t)
+	case []interface{}:
+		elems := make([]starlark.Value, len(t))
+		for i, e := range t {
+			elems[i] = jsonToStarlark(e)
+		}
+		return starlark.NewList(elems)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := starlark.NewDict(len(t))
+		for _, k := range keys {
+			d.SetKey(starlark.String(k), jsonToStarlark(t[k]))
+		}
+		return d
+	}
+	return starlark.String(fmt.Sprint(v))
+}
+
+// fromStarlark converts a Starlark value into a JSON encodable Go value
+func fromStarlark(v starlark.Value) interface{} {
+	switch t := v.(type) {
+	case starlark.NoneType:
+		return nil
+	case starlark.Bool:
+		return bool(t)
+	case starlark.Int:
+		if i, ok := t.Int64(); ok {
+			return i
+		}
+		return t.String()
+	case starlark.Float:
+		return float64(t)
+	case starlark.String:
+		return string(t)
+	case starlark.Bytes:
+		return []byte(t)
+	case *starlark.List:
+		out := make([]interface{}, t.Len())
+		for i := 0; i < t.Len(); i++ {
+			out[i] = fromStarlark(t.Index(i))
+		}
+		return out
+	case starlark.Tuple:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = fromStarlark(e)
+		}
+		return out
+	case *starlark.Dict:
+		out := make(map[string]interface{}, t.Len())
+		for _, item := range t.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				key = item[0].String()
+			}
+			out[key] = fromStarlark(item[1])
+		}
+		return out
+	}
+	return v.String()
+}
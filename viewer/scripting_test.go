@@ -0,0 +1,111 @@
+package viewer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	"go.starlark.net/starlark"
+)
+
+func TestRunScript(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	script := `
+print("buckets", db.buckets(""))
+result = {
+    "keys": db.keys("misc"),
+    "first": db.keys("misc", limit=1),
+    "nested": db.buckets("misc"),
+    "text": db.get("misc", "text"),
+    "json": db.get("misc", "json")["b"],
+    "missing": db.get("misc", "missing"),
+    "counter": db.decode("misc", "counter", kind="integer")["bigEndian"]["unsigned"],
+}
+`
+	var result ScriptResult
+	s.API(http.MethodPost, "/api/scripts/run", script).Decode(t, &result)
+	got, _ := result.Result.(map[string]interface{})
+	if result.Output != "buckets [\"misc\"]\n" || result.Steps == 0 {
+		t.Errorf("output %q after %d steps", result.Output, result.Steps)
+	}
+	for key, want := range map[string]string{
+		"keys":    "[counter json text]",
+		"first":   "[counter]",
+		"nested":  "[nested]",
+		"text":    "hello",
+		"json":    "x",
+		"missing": "<nil>",
+		"counter": "42",
+	} {
+		if v := fmt.Sprint(got[key]); v != want {
+			t.Errorf("%s = %s, want %s", key, v, want)
+		}
+	}
+
+	for script, want := range map[string]string{
+		"result = (":                     "got end of file",
+		`load("os.star", "getenv")`:      "load not implemented",
+		`db.keys("missing")`:             "bucket not found: missing",
+		`db.decode("misc", "text", "x")`: "unknown kind",
+	} {
+		resp := s.API(http.MethodPost, "/api/scripts/run", script)
+		if resp.Status != http.StatusBadRequest || !strings.Contains(resp.Error, want) {
+			t.Errorf("%s: status %d: %s, want %q", script, resp.Status, resp.Error, want)
+		}
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+	loop := []byte("while True:\n    pass\n")
+
+	c := newViewer(path)
+	t.Cleanup(func() { c.Close() })
+	c.scripts.steps = 10_000
+	if _, err := c.runScript(context.Background(), "loop.star", loop); err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Errorf("step limit: %v", err)
+	}
+
+	c.scripts = scriptLimits{timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := c.runScript(context.Background(), "loop.star", loop); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("timeout: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("timed out script ran %s", elapsed)
+	}
+
+	// A cancelled request stops the script, also inside a builtin
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.runScript(ctx, "loop.star", loop); err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Errorf("cancelled run: %v", err)
+	}
+	if _, err := c.listChildren(ctx, "misc", false, 0); err != context.Canceled {
+		t.Errorf("listing with a cancelled context: %v", err)
+	}
+	if _, err := c.searchKeys(ctx, "text", "", 0); err != context.Canceled {
+		t.Errorf("search with a cancelled context: %v", err)
+	}
+	thread := &starlark.Thread{}
+	thread.SetLocal(scriptContextKey, ctx)
+	get := c.scriptModule().Members["get"]
+	if _, err := starlark.Call(thread, get, starlark.Tuple{starlark.String("misc"), starlark.String("text")}, nil); err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Errorf("db.get in a cancelled run: %v", err)
+	}
+
+	// Printed output is bounded like responses
+	c.scripts = scriptLimits{}
+	result, err := c.runScript(context.Background(), "print.star", []byte("for i in range(100000):\n    print(\"x\" * 100)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Output) > maxScriptOutput || !strings.HasSuffix(result.Output, "... (output truncated)\n") {
+		t.Errorf("output of %d bytes ending %q", len(result.Output), result.Output[len(result.Output)-30:])
+	}
+}
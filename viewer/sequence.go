@@ -0,0 +1,98 @@
+// sequence.go - bucket sequence counters
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BucketSequence the NextSequence counter of a bucket
+type BucketSequence struct {
+	Bucket   string `json:"bucket"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// sequencePath decodes the path route variable
+func sequencePath(r *http.Request) (string, error) {
+	path, err := url.PathUnescape(mux.Vars(r)["path"])
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(path, "/"), nil
+}
+
+// handleGetSequence returns the sequence of a bucket
+func (c *Viewer) handleGetSequence(w http.ResponseWriter, r *http.Request) {
+	bucketPath, err := sequencePath(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		c.sendError(w, "Failed to open database", err)
+		return
+	}
+	seq := BucketSequence{Bucket: bucketPath}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		seq.Sequence = b.Sequence()
+		return nil
+	})
+	if err != nil {
+		c.sendError(w, "Failed to read sequence", err)
+		return
+	}
+	c.sendSuccess(w, seq)
+}
+
+// handleSetSequence sets the sequence of a bucket from a JSON body
+// {"sequence": N}
+func (c *Viewer) handleSetSequence(w http.ResponseWriter, r *http.Request) {
+	bucketPath, err := sequencePath(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid bucket path", err)
+		return
+	}
+	var body struct {
+		Sequence *uint64 `json:"sequence"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&body); err != nil || body.Sequence == nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid sequence", err)
+		return
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		c.sendError(w, "Failed to open database", err)
+		return
+	}
+	var previous uint64
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		previous = b.Sequence()
+		return b.SetSequence(*body.Sequence)
+	})
+	if err != nil {
+		c.sendError(w, "Failed to set sequence", err)
+		return
+	}
+
+	slog.Info("Set sequence", "bucket", bucketPath, "from", previous, "to", *body.Sequence)
+	c.sendSuccess(w, BucketSequence{Bucket: bucketPath, Sequence: *body.Sequence})
+}
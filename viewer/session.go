@@ -0,0 +1,298 @@
+// session.go - recording and replay of investigation sessions
+package viewer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReplaySteps limits how many steps a single replay may execute
+const maxReplaySteps = 1000
+
+// sessionSkipPrefixes API paths that are not part of an investigation
+var sessionSkipPrefixes = []string{
+	"/api/ws",
+	"/api/session",
+	"/api/sources",
+	"/api/databases",
+	"/api/openapi.json",
+}
+
+// SessionStep one recorded API call
+type SessionStep struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"` // escaped request path, replayed as is
+	Query  string    `json:"query,omitempty"`
+}
+
+// ReplayResult outcome of one replayed step
+type ReplayResult struct {
+	Step    int             `json:"step"`
+	Method  string          `json:"method"`
+	Path    string          `json:"path"`
+	Query   string          `json:"query,omitempty"`
+	Status  int             `json:"status"`
+	Skipped string          `json:"skipped,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+// sessionRecorder appends API calls to a JSON lines session file
+type sessionRecorder struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// newSessionRecorder opens the session file for appending
+func newSessionRecorder(path string) (*sessionRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionRecorder{path: path, f: f}, nil
+}
+
+// record appends a step to the session file
+func (s *sessionRecorder) record(step SessionStep) error {
+	line, err := json.Marshal(step)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return fmt.Errorf("session file is closed")
+	}
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+// steps reads all recorded steps back from the session file
+func (s *sessionRecorder) steps() ([]SessionStep, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return parseSessionSteps(data)
+}
+
+// Close closes the session file
+func (s *sessionRecorder) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// parseSessionSteps accepts a JSON lines session file or a JSON array of steps
+func parseSessionSteps(data []byte) ([]SessionStep, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var steps []SessionStep
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &steps); err != nil {
+			return nil, err
+		}
+		return steps, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var step SessionStep
+		if err := json.Unmarshal(text, &step); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, scanner.Err()
+}
+
+// recordSession middleware appends read API calls to the session file
+func (c *Viewer) recordSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.session != nil && r.Method == http.MethodGet && !skipSessionPath(r.URL.Path) {
+			step := SessionStep{
+				Time:   time.Now(),
+				Method: r.Method,
+				Path:   r.URL.EscapedPath(),
+				Query:  r.URL.RawQuery,
+			}
+			if err := c.session.record(step); err != nil {
+				slog.Error("Failed to record session step", "error", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// skipSessionPath reports whether a path is excluded from recording
+func skipSessionPath(path string) bool {
+	for _, prefix := range sessionSkipPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGetSession returns the steps recorded so far
+func (c *Viewer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	if c.session == nil {
+		c.sendSuccess(w, map[string]interface{}{
+			"recording": false,
+		})
+		return
+	}
+
+	steps, err := c.session.steps()
+	if err != nil {
+		c.sendError(w, "Failed to read session", err)
+		return
+	}
+
+	c.sendSuccess(w, map[string]interface{}{
+		"recording": true,
+		"file":      c.session.path,
+		"steps":     steps,
+	})
+}
+
+// handleReplaySession re-executes a session against another database given
+// by the db query parameter (any source location), or the current one.
+// Acquiring another database opens local files or runs scp and aws, so like
+// switching the database on reload it requires the read-write mode and the
+// editor role
+func (c *Viewer) handleReplaySession(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 16*1024*1024))
+	if err != nil {
+		c.sendError(w, "Failed to read session", err)
+		return
+	}
+
+	steps, err := parseSessionSteps(body)
+	if err != nil {
+		c.sendError(w, "Invalid session", err)
+		return
+	}
+	if len(steps) == 0 && c.session != nil {
+		if steps, err = c.session.steps(); err != nil {
+			c.sendError(w, "Failed to read session", err)
+			return
+		}
+	}
+	if len(steps) == 0 {
+		c.sendError(w, "Session has no steps", nil)
+		return
+	}
+	if len(steps) > maxReplaySteps {
+		c.sendError(w, fmt.Sprintf("Session has %d steps, at most %d can be replayed", len(steps), maxReplaySteps), nil)
+		return
+	}
+
+	location := r.URL.Query().Get("db")
+	if location != "" && location != c.databasePath() && location != c.databaseLocation() {
+		if !c.writable() {
+			c.sendErrorCode(w, http.StatusForbidden, "Server is in read-only mode", errors.New("replaying against another database requires the read-write mode"))
+			return
+		}
+		if !canEdit(r) {
+			c.sendErrorCode(w, http.StatusForbidden, "Editor role required", errors.New("replaying against another database requires the editor role"))
+			return
+		}
+	}
+	if location == "" {
+		location = c.databasePath()
+	}
+
+	source, err := acquireSource(r.Context(), location)
+	if err != nil {
+		c.sendError(w, "Failed to acquire replay database", err)
+		return
+	}
+	defer source.Close()
+
+	target := newViewer(source.Path)
+	target.sourceLocation = source.Location
+	defer target.Close()
+
+	results := target.replay(steps)
+
+	c.sendSuccess(w, map[string]interface{}{
+		"source": source.Location,
+		"steps":  results,
+	})
+}
+
+// replay executes recorded steps against the viewer's own routes
+func (c *Viewer) replay(steps []SessionStep) []ReplayResult {
+	handler := c.router()
+	results := make([]ReplayResult, 0, len(steps))
+
+	for i, step := range steps {
+		res := ReplayResult{
+			Step:   i + 1,
+			Method: step.Method,
+			Path:   step.Path,
+			Query:  step.Query,
+		}
+
+		// Replays are read-only by design
+		if step.Method != http.MethodGet {
+			res.Skipped = "only GET steps are replayed"
+			results = append(results, res)
+			continue
+		}
+		if !strings.HasPrefix(step.Path, "/api/") || skipSessionPath(step.Path) {
+			res.Skipped = "not a replayable API path"
+			results = append(results, res)
+			continue
+		}
+
+		target := step.Path
+		if step.Query != "" {
+			target += "?" + step.Query
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		res.Status = rec.Code
+		if json.Valid(rec.Body.Bytes()) {
+			res.Result = json.RawMessage(bytes.TrimSpace(rec.Body.Bytes()))
+		}
+		results = append(results, res)
+	}
+
+	return results
+}
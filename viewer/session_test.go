@@ -0,0 +1,106 @@
+package viewer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+type replayResponse struct {
+	Source string         `json:"source"`
+	Steps  []ReplayResult `json:"steps"`
+}
+
+func TestSessionRecording(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+	file := filepath.Join(t.TempDir(), "session.jsonl")
+	s := newTestServer(t, path, func(c *Viewer) {
+		var err error
+		if c.session, err = newSessionRecorder(file); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	s.Get("/api/key/misc/text")
+	s.Get("/api/buckets?stats=false")
+	s.Get("/api/sources")
+	s.API(http.MethodPut, "/api/key/misc/text", "changed")
+
+	var session struct {
+		Recording bool          `json:"recording"`
+		File      string        `json:"file"`
+		Steps     []SessionStep `json:"steps"`
+	}
+	s.Get("/api/session").Decode(t, &session)
+	if !session.Recording || session.File != file || len(session.Steps) != 2 {
+		t.Fatalf("session = %+v, want the two read calls", session)
+	}
+	if step := session.Steps[1]; step.Method != http.MethodGet || step.Path != "/api/buckets" || step.Query != "stats=false" {
+		t.Errorf("step = %+v", step)
+	}
+
+	// An empty body replays the recorded session against the served file
+	var replay replayResponse
+	s.API(http.MethodPost, "/api/session/replay", "").Decode(t, &replay)
+	if len(replay.Steps) != 2 || replay.Steps[0].Status != http.StatusOK || !strings.Contains(string(replay.Steps[0].Result), "hello") {
+		t.Errorf("replay = %+v", replay)
+	}
+}
+
+func TestSessionReplay(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+	other := textDB(t, "other")
+	session := `{"method":"GET","path":"/api/key/misc/text"}
+{"method":"PUT","path":"/api/key/misc/text"}
+{"method":"GET","path":"/api/session"}
+`
+
+	ro := newTestServer(t, path)
+	var replay replayResponse
+	ro.API(http.MethodPost, "/api/session/replay", session).Decode(t, &replay)
+	if len(replay.Steps) != 3 || !strings.Contains(string(replay.Steps[0].Result), "hello") || replay.Steps[1].Skipped == "" || replay.Steps[2].Skipped == "" {
+		t.Errorf("replay = %+v, want the read replayed and the rest skipped", replay)
+	}
+	if resp := ro.API(http.MethodPost, "/api/session/replay", ""); resp.Success {
+		t.Error("replaying an empty session succeeded")
+	}
+
+	// Acquiring another database needs the read-write mode
+	target := "/api/session/replay?db=" + url.QueryEscape(other)
+	if resp := ro.API(http.MethodPost, target, session); resp.Status != http.StatusForbidden {
+		t.Errorf("replay against another database in read-only mode: status %d, want 403", resp.Status)
+	}
+	ro.API(http.MethodPost, "/api/session/replay?db="+url.QueryEscape(path), session).Decode(t, &replay)
+	if !strings.Contains(string(replay.Steps[0].Result), "hello") {
+		t.Errorf("replay against the served database = %+v", replay)
+	}
+
+	rw := newTestServer(t, path, func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+	rw.API(http.MethodPost, target, session).Decode(t, &replay)
+	if !strings.Contains(string(replay.Steps[0].Result), "other") {
+		t.Errorf("replay against %s = %+v", other, replay)
+	}
+
+	// and the editor role
+	viewer := newViewer(path)
+	viewer.mode = ModeReadWrite
+	t.Cleanup(func() { viewer.Close() })
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(session))
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, &User{Subject: "v", Role: RoleViewer}))
+	rec := httptest.NewRecorder()
+	viewer.Handler().ServeHTTP(rec, req)
+	var resp APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusForbidden || !strings.HasPrefix(resp.Error, "Editor role required") {
+		t.Errorf("replay as viewer: status %d: %s", rec.Code, resp.Error)
+	}
+}
@@ -0,0 +1,206 @@
+// snapshot.go - reads served from a consistent copy of the database, so a
+// browsing session sees one state while another process writes
+package viewer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// snapshotRetireDelay how long a replaced snapshot stays open for requests
+// that obtained it before the swap
+const snapshotRetireDelay = time.Minute
+
+// dbSnapshot a copy of the database written by Tx.WriteTo
+type dbSnapshot struct {
+	db  *bolt.DB
+	dir string
+	// source the state of the database file when it was copied
+	source dbFileState
+	txid   int
+	taken  time.Time
+}
+
+// SnapshotInfo the snapshot served, reported by /api/stats
+type SnapshotInfo struct {
+	// TxID the last transaction of the database included in the copy
+	TxID  int       `json:"txid"`
+	Taken time.Time `json:"taken"`
+	// Interval how often the database is checked for changes to copy
+	Interval string `json:"interval"`
+}
+
+// takeSnapshot copies the database at path in one read transaction; the
+// database is only opened, and locked, for the duration of the copy
+func takeSnapshot(path string, tuning BoltOptions) (*dbSnapshot, error) {
+	info, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := openBolt(path, true, tuning)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dir, err := os.MkdirTemp("", "boltdbui-snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	snap := &dbSnapshot{
+		dir:    dir,
+		source: dbFileState{Size: info.Size(), ModTime: info.ModTime()},
+		taken:  time.Now().UTC(),
+	}
+	copyPath := filepath.Join(dir, "snapshot.db")
+	err = src.View(func(tx *bolt.Tx) error {
+		snap.txid = tx.ID()
+		return tx.CopyFile(copyPath, 0600)
+	})
+	if err == nil {
+		snap.db, err = openBolt(copyPath, true, tuning)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to snapshot %s: %v", path, err)
+	}
+	return snap, nil
+}
+
+// close closes the copy and removes its file
+func (s *dbSnapshot) close() error {
+	err := s.db.Close()
+	if rmErr := os.RemoveAll(s.dir); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// snapshotDB returns the current snapshot, taking the first one and
+// starting the refresh loop on first use; c.mu must be held
+func (c *Viewer) snapshotDB() (*bolt.DB, error) {
+	if c.snapshot != nil {
+		return c.snapshot.db, nil
+	}
+	snap, err := takeSnapshot(c.dbPath, c.boltOptions)
+	if err != nil {
+		return nil, err
+	}
+	c.snapshot = snap
+	slog.Info("Serving snapshot", "path", c.dbPath, "txid", snap.txid)
+	go c.refreshSnapshots()
+	return snap.db, nil
+}
+
+// refreshSnapshots replaces the snapshot every interval in which the
+// database file changed, until the server stops or the viewer is closed
+func (c *Viewer) refreshSnapshots() {
+	ticker := time.NewTicker(c.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		if c.snapshotInfo() == nil {
+			return
+		}
+		if err := c.refreshSnapshot(); err != nil {
+			// Keep serving the previous snapshot, e.g. while the
+			// database is locked by its writer
+			slog.Warn("Failed to refresh snapshot", "error", err)
+		}
+	}
+}
+
+// refreshSnapshot takes a new snapshot if the database file changed since
+// the current one; the previous snapshot is closed after a delay
+func (c *Viewer) refreshSnapshot() error {
+	c.mu.Lock()
+	current := c.snapshot
+	c.mu.Unlock()
+	if current == nil {
+		return nil
+	}
+
+	path := c.databasePath()
+	info, err := statFile(path)
+	if err != nil {
+		return err
+	}
+	if !(dbFileState{Size: info.Size(), ModTime: info.ModTime()}).changedFrom(current.source) {
+		return nil
+	}
+	snap, err := takeSnapshot(path, c.boltOptions)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.snapshot != current {
+		// Closed, or replaced concurrently
+		c.mu.Unlock()
+		return snap.close()
+	}
+	c.retireSnapshot(current)
+	c.snapshot = snap
+	c.mu.Unlock()
+
+	slog.Info("Refreshed snapshot", "path", path, "txid", snap.txid)
+	return nil
+}
+
+// retireSnapshot closes a replaced snapshot after a delay, leaving requests
+// that still use it time to finish; c.mu must be held
+func (c *Viewer) retireSnapshot(snap *dbSnapshot) {
+	c.retiredSnapshots = append(c.retiredSnapshots, snap)
+	time.AfterFunc(snapshotRetireDelay, func() { c.closeRetiredSnapshot(snap) })
+}
+
+// closeRetiredSnapshot closes a replaced snapshot unless Close already did
+func (c *Viewer) closeRetiredSnapshot(snap *dbSnapshot) {
+	c.mu.Lock()
+	found := false
+	for i, s := range c.retiredSnapshots {
+		if s == snap {
+			c.retiredSnapshots = append(c.retiredSnapshots[:i], c.retiredSnapshots[i+1:]...)
+			found = true
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if !found {
+		return
+	}
+	if err := snap.close(); err != nil {
+		slog.Warn("Failed to remove snapshot", "dir", snap.dir, "error", err)
+	}
+}
+
+// servedPath the file reads are served from, the snapshot in snapshot mode
+func (c *Viewer) servedPath() string {
+	if c.snapshotInterval > 0 {
+		if db, err := c.openDB(); err == nil {
+			return db.Path()
+		}
+	}
+	return c.databasePath()
+}
+
+// snapshotInfo describes the served snapshot, nil outside snapshot mode
+func (c *Viewer) snapshotInfo() *SnapshotInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.snapshot == nil {
+		return nil
+	}
+	return &SnapshotInfo{TxID: c.snapshot.txid, Taken: c.snapshot.taken, Interval: c.snapshotInterval.String()}
+}
@@ -0,0 +1,70 @@
+package viewer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSnapshotMode(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+	var viewer *Viewer
+	s := newTestServer(t, path, func(c *Viewer) {
+		c.snapshotInterval = time.Hour
+		viewer = c
+	})
+
+	text := func() string {
+		var kv KeyValuePair
+		s.Get("/api/key/misc/text").Decode(t, &kv)
+		return kv.Preview
+	}
+	if got := text(); got != "hello" {
+		t.Fatalf("text = %q, want hello", got)
+	}
+	first := viewer.snapshotInfo()
+
+	// The viewer holds no lock on the database, a writer opens it while
+	// the old state is still served
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("database locked by the viewer: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("misc")).Put([]byte("text"), []byte("changed"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := text(); got != "hello" {
+		t.Errorf("text before refresh = %q, want the snapshot's hello", got)
+	}
+
+	if err := viewer.refreshSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if got := text(); got != "changed" {
+		t.Errorf("text after refresh = %q, want changed", got)
+	}
+	retired := viewer.retiredSnapshots[0].db.Path()
+	if second := viewer.snapshotInfo(); second.TxID <= first.TxID {
+		t.Errorf("snapshot at transaction %d, want after %d", second.TxID, first.TxID)
+	}
+
+	// Unchanged file, the snapshot is kept
+	served := viewer.servedPath()
+	if err := viewer.refreshSnapshot(); err != nil || viewer.servedPath() != served {
+		t.Errorf("refresh of an unchanged file replaced the snapshot: %v", err)
+	}
+
+	viewer.Close()
+	for _, path := range []string{served, retired} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("snapshot %s left behind: %v", path, err)
+		}
+	}
+}
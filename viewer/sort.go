@@ -0,0 +1,176 @@
+// sort.go - key listings ordered by name or value size
+package viewer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Key orders selected with ?sort= on /api/bucket
+const (
+	sortByName = "name"
+	sortBySize = "size"
+)
+
+// maxKeyLimit the largest ?limit= of a key listing
+const maxKeyLimit = 10000
+
+// keyOrder the order keys of a bucket are listed in; the zero value is
+// bolt's own, ascending by name, without a limit
+type keyOrder struct {
+	by   string // sortByName or sortBySize, empty for name
+	desc bool
+	// limit stops the listing after this many keys, 0 for no limit
+	limit int
+}
+
+// parseKeyOrder reads ?sort=name|size&order=asc|desc and the cursor style
+// ?direction=next|prev&limit=N, direction=prev being order=desc
+func parseKeyOrder(r *http.Request) (keyOrder, error) {
+	var o keyOrder
+	q := r.URL.Query()
+	switch by := q.Get("sort"); by {
+	case "", sortByName:
+	case sortBySize:
+		o.by = sortBySize
+	default:
+		return o, fmt.Errorf("unknown sort %q, want name or size", by)
+	}
+	switch order := q.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		o.desc = true
+	default:
+		return o, fmt.Errorf("unknown order %q, want asc or desc", order)
+	}
+	switch direction := q.Get("direction"); direction {
+	case "":
+	case "next", "prev":
+		if q.Get("order") != "" && o.desc != (direction == "prev") {
+			return o, fmt.Errorf("direction %s contradicts order %s", direction, q.Get("order"))
+		}
+		o.desc = direction == "prev"
+	default:
+		return o, fmt.Errorf("unknown direction %q, want next or prev", direction)
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxKeyLimit {
+			return o, fmt.Errorf("invalid limit %q, want 1 to %d", limit, maxKeyLimit)
+		}
+		o.limit = n
+	}
+	return o, nil
+}
+
+// forEach calls fn for the keys of b in order, starting at the cursor from
+// (see cursor), until fn returns false; sub-buckets are skipped. Keys and
+// values are only valid for the life of the transaction. When the limit
+// ends the listing, the cursor of the next key is returned.
+func (o keyOrder) forEach(b *bolt.Bucket, from []byte, fn func(k, v []byte) bool) (next []byte) {
+	n := 0
+	visit := func(k, v []byte) bool {
+		if o.limit > 0 && n == o.limit {
+			next = o.cursor(k, v)
+			return false
+		}
+		n++
+		return fn(k, v)
+	}
+	if o.by == sortBySize {
+		o.forEachBySize(b, from, visit)
+	} else {
+		o.forEachByName(b, from, visit)
+	}
+	return next
+}
+
+// forEachByName walks the keys with a bolt cursor, from positioned like
+// Seek, or at the last key not after it when descending
+func (o keyOrder) forEachByName(b *bolt.Bucket, from []byte, fn func(k, v []byte) bool) {
+
+	cur := b.Cursor()
+	var k, v []byte
+	switch {
+	case !o.desc && from == nil:
+		k, v = cur.First()
+	case !o.desc:
+		k, v = cur.Seek(from)
+	case from == nil:
+		k, v = cur.Last()
+	default:
+		// The last key not after from
+		if k, v = cur.Seek(from); k == nil {
+			k, v = cur.Last()
+		} else if !bytes.Equal(k, from) {
+			k, v = cur.Prev()
+		}
+	}
+	for k != nil {
+		if v != nil && !fn(k, v) { // v is nil for sub-buckets
+			return
+		}
+		if o.desc {
+			k, v = cur.Prev()
+		} else {
+			k, v = cur.Next()
+		}
+	}
+}
+
+// sizedKey a key and the size of its value
+type sizedKey struct {
+	key  []byte
+	size int
+}
+
+// less orders by size, ties by name ascending in both directions
+func (o keyOrder) less(a, b sizedKey) bool {
+	if a.size != b.size {
+		return (a.size < b.size) != o.desc
+	}
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// forEachBySize sorts the keys by the size of their values, only sizes are
+// held in memory
+func (o keyOrder) forEachBySize(b *bolt.Bucket, from []byte, fn func(k, v []byte) bool) {
+	var keys []sizedKey
+	var n int64
+	b.ForEach(func(k, v []byte) error {
+		n += int64(len(k) + len(v))
+		if v != nil {
+			keys = append(keys, sizedKey{k, len(v)})
+		}
+		return nil
+	})
+	scanned(b.Tx(), n)
+	sort.Slice(keys, func(i, j int) bool { return o.less(keys[i], keys[j]) })
+
+	start := 0
+	if len(from) >= 8 {
+		at := sizedKey{from[8:], int(binary.BigEndian.Uint64(from))}
+		start = sort.Search(len(keys), func(i int) bool { return !o.less(keys[i], at) })
+	}
+	for _, sk := range keys[start:] {
+		if !fn(sk.key, b.Get(sk.key)) {
+			return
+		}
+	}
+}
+
+// cursor returns the cursor continuing the listing at k: the key itself
+// when ordered by name, prefixed by the 8 byte value size when by size
+func (o keyOrder) cursor(k, v []byte) []byte {
+	if o.by == sortBySize {
+		next := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(k)), uint64(len(v)))
+		return append(next, k...)
+	}
+	return append([]byte(nil), k...)
+}
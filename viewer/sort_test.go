@@ -0,0 +1,143 @@
+package viewer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// sortFixture has keys k00..k29 with values of 30 - i bytes, plus pairs of
+// equal sizes so ties are paged too
+func sortFixture(t *testing.T) string {
+	return boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("b"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 30; i++ {
+			size := 30 - i - i%2
+			if err := b.Put([]byte(fmt.Sprintf("k%02d", i)), make([]byte, size+1)); err != nil {
+				return err
+			}
+		}
+		_, err = b.CreateBucket([]byte("k15-sub"))
+		return err
+	})
+}
+
+// listKeys pages through a bucket listing and returns the keys in order
+func listKeys(t *testing.T, s *boltdbtest.Server, query string) []KeyValuePair {
+	t.Helper()
+
+	var keys []KeyValuePair
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("paging does not terminate")
+		}
+		target := "/api/bucket/b?" + query
+		if cursor != "" {
+			target += "&cursor=" + url.QueryEscape(cursor)
+		}
+		resp := s.Get(target)
+		var bucket BucketInfo
+		resp.Decode(t, &bucket)
+		keys = append(keys, bucket.Keys...)
+		if !resp.Partial {
+			return keys
+		}
+		cursor = resp.Cursor
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	s := newTestServer(t, sortFixture(t), func(c *Viewer) {
+		c.maxResponseBytes = 1024
+	})
+
+	desc := listKeys(t, s, "order=desc")
+	if len(desc) != 30 || desc[0].Key != "k29" || desc[29].Key != "k00" {
+		t.Errorf("order=desc = %d keys from %s, want k29..k00", len(desc), desc[0].Key)
+	}
+	for i := 1; i < len(desc); i++ {
+		if desc[i].Key >= desc[i-1].Key {
+			t.Fatalf("order=desc: %s after %s", desc[i].Key, desc[i-1].Key)
+		}
+	}
+
+	for _, query := range []string{"sort=size", "sort=size&order=desc"} {
+		keys := listKeys(t, s, query)
+		if len(keys) != 30 {
+			t.Fatalf("%s: %d keys, want 30", query, len(keys))
+		}
+		seen := map[string]bool{}
+		for i, kv := range keys {
+			if seen[kv.Key] {
+				t.Fatalf("%s: %s returned twice", query, kv.Key)
+			}
+			seen[kv.Key] = true
+			if i == 0 {
+				continue
+			}
+			prev := keys[i-1]
+			ordered := prev.ValueSize < kv.ValueSize
+			if query != "sort=size" {
+				ordered = prev.ValueSize > kv.ValueSize
+			}
+			if !ordered && !(prev.ValueSize == kv.ValueSize && prev.Key < kv.Key) {
+				t.Errorf("%s: %s (%d) after %s (%d)", query, kv.Key, kv.ValueSize, prev.Key, prev.ValueSize)
+			}
+		}
+		if query != "sort=size" && keys[0].Key != "k00" {
+			t.Errorf("largest value = %s, want k00", keys[0].Key)
+		}
+	}
+
+	if status, _ := s.Do(http.MethodGet, "/api/bucket/b?sort=type", nil); status != http.StatusBadRequest {
+		t.Errorf("sort=type status = %d, want 400", status)
+	}
+}
+
+func TestSeekKeys(t *testing.T) {
+	s := newTestServer(t, sortFixture(t))
+
+	names := func(query string) ([]string, *boltdbtest.Response) {
+		resp := s.Get("/api/bucket/b?" + query)
+		var bucket BucketInfo
+		resp.Decode(t, &bucket)
+		var keys []string
+		for _, kv := range bucket.Keys {
+			keys = append(keys, kv.Key)
+		}
+		return keys, resp
+	}
+
+	keys, resp := names("seek=k10&limit=3")
+	if fmt.Sprint(keys) != "[k10 k11 k12]" || !resp.Partial {
+		t.Errorf("next from k10 = %v partial %v, want [k10 k11 k12] and a cursor", keys, resp.Partial)
+	}
+	keys, _ = names("limit=3&cursor=" + url.QueryEscape(resp.Cursor))
+	if fmt.Sprint(keys) != "[k13 k14 k15]" {
+		t.Errorf("continued = %v, want [k13 k14 k15]", keys)
+	}
+
+	// k10a does not exist, prev starts at the key before it
+	keys, _ = names("seek=k10a&direction=prev&limit=3")
+	if fmt.Sprint(keys) != "[k10 k09 k08]" {
+		t.Errorf("prev from k10a = %v, want [k10 k09 k08]", keys)
+	}
+	keys, resp = names("seek=k01&direction=prev&limit=5")
+	if fmt.Sprint(keys) != "[k01 k00]" || resp.Partial {
+		t.Errorf("prev from k01 = %v partial %v, want [k01 k00] and no cursor", keys, resp.Partial)
+	}
+
+	for _, query := range []string{"limit=0", "direction=up", "direction=prev&order=asc", "seek=k01&sort=size"} {
+		if status, _ := s.Do(http.MethodGet, "/api/bucket/b?"+query, nil); status != http.StatusBadRequest {
+			t.Errorf("%s status = %d, want 400", query, status)
+		}
+	}
+}
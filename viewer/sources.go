@@ -0,0 +1,350 @@
+// sources.go - pluggable acquisition of bolt database files
+package viewer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SourceAdapter acquires a database from a location and makes it available
+// as a local file that bolt can open
+type SourceAdapter interface {
+	// Scheme is the location scheme handled by the adapter, e.g. "ssh"
+	Scheme() string
+	// Description is a short human readable summary
+	Description() string
+	// Example is an example location
+	Example() string
+	// Available reports whether the adapter can be used on this host
+	Available() bool
+	// Acquire fetches the database referenced by location (without scheme)
+	Acquire(ctx context.Context, location string) (*Source, error)
+}
+
+// Source an acquired database file
+type Source struct {
+	Location string
+	Path     string
+	// Cleanup removes temporary files created during acquisition, may be nil
+	Cleanup func() error
+}
+
+// Close releases temporary files of the source
+func (s *Source) Close() error {
+	if s == nil || s.Cleanup == nil {
+		return nil
+	}
+	return s.Cleanup()
+}
+
+// SourceAdapterInfo adapter description returned by /api/sources
+type SourceAdapterInfo struct {
+	Scheme      string `json:"scheme"`
+	Description string `json:"description"`
+	Example     string `json:"example"`
+	Available   bool   `json:"available"`
+}
+
+var (
+	sourceAdaptersMu sync.RWMutex
+	sourceAdapters   = make(map[string]SourceAdapter)
+)
+
+// RegisterSourceAdapter makes an adapter available for its scheme
+func RegisterSourceAdapter(a SourceAdapter) {
+	sourceAdaptersMu.Lock()
+	defer sourceAdaptersMu.Unlock()
+
+	if _, dup := sourceAdapters[a.Scheme()]; dup {
+		panic("source adapter already registered for scheme " + a.Scheme())
+	}
+	sourceAdapters[a.Scheme()] = a
+}
+
+func init() {
+	RegisterSourceAdapter(fileSource{})
+	RegisterSourceAdapter(copySource{})
+	RegisterSourceAdapter(tarSource{maxBytes: maxTarMemberBytes})
+	RegisterSourceAdapter(uploadSource{})
+	RegisterSourceAdapter(nodeSource{})
+	RegisterSourceAdapter(commandSource{
+		scheme:      "ssh",
+		description: "Copy a database from a remote host with scp",
+		example:     "ssh://root@node-1/var/lib/containerd/io.containerd.metadata.v1.bolt/meta.db",
+		command:     "scp",
+		args:        scpArgs,
+	})
+	RegisterSourceAdapter(commandSource{
+		scheme:      "s3",
+		description: "Download a database object with the aws CLI",
+		example:     "s3://support-bundles/case-1234/meta.db",
+		command:     "aws",
+		args:        s3Args,
+	})
+}
+
+// scpArgs copies [user@]host/path to dst; a host starting with '-' would be
+// read by scp as an option such as -oProxyCommand
+func scpArgs(location, dst string) ([]string, error) {
+	host, path, ok := strings.Cut(location, "/")
+	if !ok || host == "" || path == "" {
+		return nil, fmt.Errorf("expected ssh://[user@]host/path, got %q", location)
+	}
+	if strings.HasPrefix(host, "-") || strings.ContainsAny(host, ": ") {
+		return nil, fmt.Errorf("invalid host %q", host)
+	}
+	return []string{"-q", "--", host + ":/" + path, dst}, nil
+}
+
+// s3Args downloads bucket/key to dst
+func s3Args(location, dst string) ([]string, error) {
+	bucket, key, ok := strings.Cut(location, "/")
+	if !ok || bucket == "" || key == "" {
+		return nil, fmt.Errorf("expected s3://bucket/key, got %q", location)
+	}
+	if strings.HasPrefix(bucket, "-") {
+		return nil, fmt.Errorf("invalid bucket %q", bucket)
+	}
+	return []string{"s3", "cp", "--only-show-errors", "s3://" + location, dst}, nil
+}
+
+// acquireSource resolves a location such as "/path/meta.db" or
+// "ssh://host/path" through the registered adapters
+func acquireSource(ctx context.Context, location string) (*Source, error) {
+	scheme, rest, ok := strings.Cut(location, "://")
+	if !ok {
+		scheme, rest = "file", location
+	}
+
+	sourceAdaptersMu.RLock()
+	a, found := sourceAdapters[scheme]
+	sourceAdaptersMu.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("no source adapter registered for scheme %q", scheme)
+	}
+	if !a.Available() {
+		return nil, fmt.Errorf("source adapter %q is not available on this host", scheme)
+	}
+
+	src, err := a.Acquire(ctx, rest)
+	if err != nil {
+		return nil, fmt.Errorf("%s source: %v", scheme, err)
+	}
+	src.Location = location
+
+	return src, nil
+}
+
+// listSourceAdapters describes all registered adapters sorted by scheme
+func listSourceAdapters() []SourceAdapterInfo {
+	sourceAdaptersMu.RLock()
+	defer sourceAdaptersMu.RUnlock()
+
+	infos := make([]SourceAdapterInfo, 0, len(sourceAdapters))
+	for _, a := range sourceAdapters {
+		infos = append(infos, SourceAdapterInfo{
+			Scheme:      a.Scheme(),
+			Description: a.Description(),
+			Example:     a.Example(),
+			Available:   a.Available(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Scheme < infos[j].Scheme
+	})
+
+	return infos
+}
+
+// handleGetSources lists the available source adapters
+func (c *Viewer) handleGetSources(w http.ResponseWriter, r *http.Request) {
+	c.sendSuccess(w, map[string]interface{}{
+		"current":  c.databaseLocation(),
+		"adapters": listSourceAdapters(),
+	})
+}
+
+// fileSource opens a local file in place
+type fileSource struct{}
+
+func (fileSource) Scheme() string      { return "file" }
+func (fileSource) Description() string { return "Open a local database file in place (default)" }
+func (fileSource) Example() string {
+	return "file:///var/lib/containerd/io.containerd.metadata.v1.bolt/meta.db"
+}
+func (fileSource) Available() bool { return true }
+
+func (fileSource) Acquire(ctx context.Context, location string) (*Source, error) {
+	if _, err := os.Stat(location); err != nil {
+		return nil, fmt.Errorf("database file does not exist: %s", location)
+	}
+	return &Source{Path: location}, nil
+}
+
+// copySource copies a local file to a temporary location first, so the
+// viewer never holds a lock on the live database
+type copySource struct{}
+
+func (copySource) Scheme() string { return "copy" }
+func (copySource) Description() string {
+	return "Copy a local database to a temporary file before opening"
+}
+func (copySource) Example() string {
+	return "copy:///var/lib/containerd/io.containerd.metadata.v1.bolt/meta.db"
+}
+func (copySource) Available() bool { return true }
+
+func (copySource) Acquire(ctx context.Context, location string) (*Source, error) {
+	in, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	return writeTempSource(filepath.Base(location), in)
+}
+
+// maxTarMemberBytes largest database extracted from a tarball, a gzipped
+// archive may expand far beyond its own size
+const maxTarMemberBytes = 8 << 30
+
+// tarSource extracts a database from a (optionally gzipped) tarball, the
+// member is selected with "#path/in/archive" or defaults to the first *.db.
+// Only the base name of the member is used for the extracted file.
+type tarSource struct {
+	// maxBytes largest member extracted
+	maxBytes int64
+}
+
+func (tarSource) Scheme() string { return "tar" }
+func (tarSource) Description() string {
+	return "Extract a database from a .tar or .tar.gz support bundle"
+}
+func (tarSource) Example() string { return "tar:///tmp/bundle.tar.gz#meta.db" }
+func (tarSource) Available() bool { return true }
+
+func (s tarSource) Acquire(ctx context.Context, location string) (*Source, error) {
+	archive, member, _ := strings.Cut(location, "#")
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(archive, ".gz") || strings.HasSuffix(archive, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if (member != "" && samePath(name, strings.TrimPrefix(member, "./"))) ||
+			(member == "" && strings.HasSuffix(name, ".db")) {
+			if hdr.Size > s.maxBytes {
+				return nil, fmt.Errorf("%s is %d bytes, larger than the limit of %d", name, hdr.Size, s.maxBytes)
+			}
+			return writeTempSource(filepath.Base(name), tr)
+		}
+	}
+
+	if member == "" {
+		return nil, fmt.Errorf("no *.db file found in %s", archive)
+	}
+	return nil, fmt.Errorf("%s not found in %s", member, archive)
+}
+
+// commandSource downloads a database into a temporary file with an external tool
+type commandSource struct {
+	scheme      string
+	description string
+	example     string
+	command     string
+	args        func(location, dst string) ([]string, error)
+}
+
+func (s commandSource) Scheme() string      { return s.scheme }
+func (s commandSource) Description() string { return s.description }
+func (s commandSource) Example() string     { return s.example }
+
+func (s commandSource) Available() bool {
+	_, err := exec.LookPath(s.command)
+	return err == nil
+}
+
+func (s commandSource) Acquire(ctx context.Context, location string) (*Source, error) {
+	dir, err := os.MkdirTemp("", "boltdbui-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() error { return os.RemoveAll(dir) }
+
+	dst := filepath.Join(dir, "source.db")
+	args, err := s.args(location, dst)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	if out, err := exec.CommandContext(ctx, s.command, args...).CombinedOutput(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("%s failed: %v: %s", s.command, err, strings.TrimSpace(string(out)))
+	}
+
+	return &Source{Path: dst, Cleanup: cleanup}, nil
+}
+
+// writeTempSource stores r in a new temporary directory, name is sanitized
+// so archive member names containing e.g. ':' can be created on any platform
+func writeTempSource(name string, r io.Reader) (*Source, error) {
+	dir, err := os.MkdirTemp("", "boltdbui-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() error { return os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, tempFileName(name))
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		cleanup()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	return &Source{Path: path, Cleanup: cleanup}, nil
+}
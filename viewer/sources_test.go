@@ -0,0 +1,233 @@
+package viewer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// writeTarball creates a gzipped tarball of the members in order
+func writeTarball(t *testing.T, members ...[2]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, m := range members {
+		if err := tw.WriteHeader(&tar.Header{Name: m[0], Mode: 0o600, Size: int64(len(m[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(m[1]))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLocalSources(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+
+	for _, location := range []string{path, "file://" + path} {
+		src, err := acquireSource(context.Background(), location)
+		if err != nil || src.Path != path || src.Location != location {
+			t.Errorf("%s: %+v, %v", location, src, err)
+		}
+	}
+
+	src, err := acquireSource(context.Background(), "copy://"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Path == path || filepath.Base(src.Path) != filepath.Base(path) {
+		t.Errorf("copy path = %s, want a copy of %s", src.Path, path)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src.Path); !os.IsNotExist(err) {
+		t.Errorf("copy left after close: %v", err)
+	}
+
+	for _, location := range []string{
+		filepath.Join(t.TempDir(), "missing.db"),
+		"copy://" + filepath.Join(t.TempDir(), "missing.db"),
+		"ftp://host/meta.db",
+	} {
+		if src, err := acquireSource(context.Background(), location); err == nil {
+			src.Close()
+			t.Errorf("%s acquired", location)
+		}
+	}
+}
+
+func TestTarSource(t *testing.T) {
+	archive := writeTarball(t,
+		[2]string{"README", "bundle"},
+		[2]string{"./state/meta.db", "metadata"},
+		[2]string{"../../escape.db", "escaped"},
+		[2]string{"big.db", strings.Repeat("x", 2048)},
+	)
+	tarball := tarSource{maxBytes: 1024}
+
+	for _, tc := range []struct {
+		location string
+		name     string
+		content  string
+		err      string
+	}{
+		{location: archive, name: "meta.db", content: "metadata"},
+		{location: archive + "#state/meta.db", name: "meta.db", content: "metadata"},
+		{location: archive + "#./state/meta.db", name: "meta.db", content: "metadata"},
+		// A member outside the archive root is extracted into the temporary
+		// directory like any other
+		{location: archive + "#../../escape.db", name: "escape.db", content: "escaped"},
+		{location: archive + "#big.db", err: "larger than the limit of 1024"},
+		{location: archive + "#other.db", err: "other.db not found"},
+		{location: filepath.Join(t.TempDir(), "missing.tar"), err: "no such file"},
+	} {
+		src, err := tarball.Acquire(context.Background(), tc.location)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: error %v, want %q", tc.location, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.location, err)
+			continue
+		}
+		data, _ := os.ReadFile(src.Path)
+		if filepath.Base(src.Path) != tc.name || string(data) != tc.content {
+			t.Errorf("%s: extracted %s holding %q, want %s holding %q", tc.location, src.Path, data, tc.name, tc.content)
+		}
+		if !strings.HasPrefix(src.Path, os.TempDir()) {
+			t.Errorf("%s: extracted to %s outside the temporary directory", tc.location, src.Path)
+		}
+		src.Close()
+	}
+
+	if _, err := (tarSource{maxBytes: 1024}).Acquire(context.Background(), writeTarball(t, [2]string{"notes.txt", "x"})); err == nil || !strings.Contains(err.Error(), "no *.db file") {
+		t.Errorf("archive without a database: %v", err)
+	}
+}
+
+func TestCommandSourceArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args     func(location, dst string) ([]string, error)
+		location string
+		want     string
+	}{
+		{scpArgs, "root@node-1/var/lib/meta.db", "-q -- root@node-1:/var/lib/meta.db /tmp/dst.db"},
+		{scpArgs, "node-1/meta.db", "-q -- node-1:/meta.db /tmp/dst.db"},
+		{scpArgs, "-oProxyCommand=touch pwned/meta.db", ""},
+		{scpArgs, "-F/tmp/config@node-1/meta.db", ""},
+		{scpArgs, "node-1:22/meta.db", ""},
+		{scpArgs, "node-1", ""},
+		{scpArgs, "/meta.db", ""},
+		{scpArgs, "node-1/", ""},
+		{s3Args, "bundles/case-1/meta.db", "s3 cp --only-show-errors s3://bundles/case-1/meta.db /tmp/dst.db"},
+		{s3Args, "--endpoint-url=http://attacker/meta.db", ""},
+		{s3Args, "bundles", ""},
+	} {
+		args, err := tc.args(tc.location, "/tmp/dst.db")
+		if got := strings.Join(args, " "); got != tc.want || (err == nil) != (tc.want != "") {
+			t.Errorf("%s: args %q, %v, want %q", tc.location, got, err, tc.want)
+		}
+	}
+}
+
+func TestCommandSourceAcquire(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake scp is a shell script")
+	}
+	// A fake scp copying the fixture to its last argument
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\ncp \"$FAKE_SCP_SOURCE\" \"$last\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "scp"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SCP_SOURCE", boltdbtest.Tiny(t))
+
+	src, err := acquireSource(context.Background(), "ssh://root@node-1/var/lib/meta.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkBoltFile(src.Path); err != nil {
+		t.Errorf("downloaded %s: %v", src.Path, err)
+	}
+	src.Close()
+	if _, err := os.Stat(src.Path); !os.IsNotExist(err) {
+		t.Errorf("download left after close: %v", err)
+	}
+
+	if _, err := acquireSource(context.Background(), "ssh://-oProxyCommand=sh/meta.db"); err == nil || !strings.Contains(err.Error(), "invalid host") {
+		t.Errorf("host starting with -: %v", err)
+	}
+}
+
+func TestUploadAndNodeSources(t *testing.T) {
+	var viewer *Viewer
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+		viewer = c
+	})
+	data, err := os.ReadFile(boltdbtest.Tiny(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info DatabaseInfo
+	upload(t, s, "meta.db", data).Decode(t, &info)
+
+	src, err := acquireSource(context.Background(), "upload://"+info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := checkBoltFile(src.Path); err != nil {
+		t.Errorf("upload copy %s: %v", src.Path, err)
+	}
+	if db, ok := viewer.uploads.get(info.ID); !ok || db.viewer.databaseLocation() != "upload://"+info.ID {
+		t.Errorf("upload %s not served as upload://%s", info.ID, info.ID)
+	}
+
+	// The copy outlives the upload
+	s.API(http.MethodDelete, "/api/databases/"+info.ID, "")
+	if _, err := checkBoltFile(src.Path); err != nil {
+		t.Errorf("upload copy after the delete: %v", err)
+	}
+	if _, err := acquireSource(context.Background(), "upload://"+info.ID); err == nil || !strings.Contains(err.Error(), "no upload") {
+		t.Errorf("deleted upload: %v", err)
+	}
+
+	if _, err := acquireSource(context.Background(), "node://node-1"); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("node source: %v", err)
+	}
+	schemes := map[string]bool{}
+	for _, a := range listSourceAdapters() {
+		schemes[a.Scheme] = a.Available
+	}
+	if available, ok := schemes["upload"]; !ok || !available {
+		t.Errorf("upload adapter listed %v, available %v", ok, available)
+	}
+	if available, ok := schemes["node"]; !ok || available {
+		t.Errorf("node adapter listed %v, available %v", ok, available)
+	}
+}
@@ -0,0 +1,243 @@
+// statseries.go - db.Stats() and the last transaction sampled periodically,
+// so metadata churn can be lined up with image pulls and other activity
+package viewer
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Defaults of the stats sampler
+const (
+	// defaultStatsInterval how often the database statistics are sampled
+	defaultStatsInterval = 10 * time.Second
+	// defaultStatsSamples samples kept, an hour at the default interval
+	defaultStatsSamples = 360
+)
+
+// StatsSample the database at one point in time; counters are the change
+// since the previous sample
+type StatsSample struct {
+	Time time.Time `json:"time"`
+	// TxID the last committed write transaction, Commits those committed
+	// since the previous sample by any process, containerd included
+	TxID    int `json:"txid"`
+	Commits int `json:"commits"`
+	// Size the bytes of the database as of TxID, Growth its change
+	Size   int64 `json:"size"`
+	Growth int64 `json:"growth"`
+
+	// Freelist of this process's handle; read-only handles do not load
+	// it, these are 0 unless the server runs in read-write mode
+	FreePageN     int `json:"freePageN"`
+	PendingPageN  int `json:"pendingPageN"`
+	FreeAlloc     int `json:"freeAlloc"`
+	FreelistInuse int `json:"freelistInuse"`
+
+	// TxN read transactions started since the previous sample, OpenTxN
+	// those open at the time of the sample
+	TxN     int `json:"txN"`
+	OpenTxN int `json:"openTxN"`
+
+	// Page allocations, cursors, nodes and writes of this process's
+	// transactions since the previous sample
+	PageCount   int64 `json:"pageCount"`
+	PageAlloc   int64 `json:"pageAlloc"`
+	CursorCount int64 `json:"cursorCount"`
+	NodeCount   int64 `json:"nodeCount"`
+	Rebalance   int64 `json:"rebalance"`
+	Split       int64 `json:"split"`
+	Spill       int64 `json:"spill"`
+	Write       int64 `json:"write"`
+}
+
+// StatsTimeseries the samples kept, oldest first
+type StatsTimeseries struct {
+	// Interval between samples in seconds, Capacity the samples kept
+	Interval float64       `json:"interval"`
+	Capacity int           `json:"capacity"`
+	Samples  []StatsSample `json:"samples"`
+}
+
+// statsSeries the sampler of a viewer and its ring of samples, started on
+// the first use of the database
+type statsSeries struct {
+	interval time.Duration
+	size     int
+
+	start    sync.Once
+	stopOnce sync.Once
+	stopped  chan struct{}
+
+	mu      sync.Mutex
+	samples []StatsSample
+	prev    *bolt.Stats
+
+	// checking is held by the doctor; tx.Check loads the freelist of a
+	// read-only handle unsynchronized with other transactions, samples
+	// are skipped meanwhile
+	checking sync.RWMutex
+}
+
+// newStatsSeries keeps size samples taken every interval, 0 disables
+// sampling
+func newStatsSeries(interval time.Duration, size int) *statsSeries {
+	return &statsSeries{interval: interval, size: size, stopped: make(chan struct{})}
+}
+
+// stop ends the sampler, if running
+func (s *statsSeries) stop() {
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+// add appends a sample, dropping the oldest once size are kept
+func (s *statsSeries) add(sample StatsSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) == s.size {
+		copy(s.samples, s.samples[1:])
+		s.samples = s.samples[:len(s.samples)-1]
+	}
+	s.samples = append(s.samples, sample)
+}
+
+// since returns the samples taken after t, all for the zero time
+func (s *statsSeries) since(t time.Time) []StatsSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samples := []StatsSample{}
+	for _, sample := range s.samples {
+		if sample.Time.After(t) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// startStatsSampler starts sampling once; c.mu is held by openDB
+func (c *Viewer) startStatsSampler() {
+	if c.stats.interval <= 0 {
+		return
+	}
+	c.stats.start.Do(func() {
+		go c.sampleStats()
+	})
+}
+
+// sampleStats samples the database every interval until the server stops
+// or the viewer is closed
+func (c *Viewer) sampleStats() {
+	ticker := time.NewTicker(c.stats.interval)
+	defer ticker.Stop()
+	for {
+		if err := c.takeStatsSample(); err != nil {
+			slog.Debug("Failed to sample database stats", "error", err)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-c.stats.stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// takeStatsSample records the current statistics against the previous ones
+func (c *Viewer) takeStatsSample() error {
+	// Do not reopen the database of a closed viewer
+	select {
+	case <-c.stats.stopped:
+		return nil
+	default:
+	}
+	if !c.stats.checking.TryRLock() {
+		return nil
+	}
+	defer c.stats.checking.RUnlock()
+	db, err := c.openDB()
+	if err != nil {
+		return err
+	}
+	sample := StatsSample{Time: time.Now().UTC()}
+	// Read directly, sampling is not a request to measure
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		sample.TxID = tx.ID()
+		sample.Size = tx.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	stats := db.Stats()
+
+	s := c.stats
+	s.mu.Lock()
+	prev := s.prev
+	var last *StatsSample
+	if n := len(s.samples); n > 0 {
+		last = &s.samples[n-1]
+	}
+	if last != nil {
+		// Reloads may switch to an older database
+		if sample.TxID >= last.TxID {
+			sample.Commits = sample.TxID - last.TxID
+		}
+		sample.Growth = sample.Size - last.Size
+	}
+	s.prev = &stats
+	s.mu.Unlock()
+
+	diff := stats.Sub(prev)
+	sample.FreePageN = diff.FreePageN
+	sample.PendingPageN = diff.PendingPageN
+	sample.FreeAlloc = diff.FreeAlloc
+	sample.FreelistInuse = diff.FreelistInuse
+	sample.TxN = diff.TxN
+	sample.OpenTxN = stats.OpenTxN
+	tx := diff.TxStats
+	sample.PageCount = tx.GetPageCount()
+	sample.PageAlloc = tx.GetPageAlloc()
+	sample.CursorCount = tx.GetCursorCount()
+	sample.NodeCount = tx.GetNodeCount()
+	sample.Rebalance = tx.GetRebalance()
+	sample.Split = tx.GetSplit()
+	sample.Spill = tx.GetSpill()
+	sample.Write = tx.GetWrite()
+	s.add(sample)
+	return nil
+}
+
+// handleStatsTimeseries returns the samples kept, ?since= (RFC 3339) only
+// those taken after it
+func (c *Viewer) handleStatsTimeseries(w http.ResponseWriter, r *http.Request) {
+	if c.stats.interval <= 0 {
+		c.sendErrorCode(w, http.StatusNotFound, "Stats sampling is disabled", fmt.Errorf("stats sampling is disabled"))
+		return
+	}
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid since", err)
+			return
+		}
+		since = t
+	}
+	// The sampler starts with the database, the first request may be
+	// the first use
+	if _, err := c.openDB(); err != nil {
+		c.sendError(w, "Failed to open database", err)
+		return
+	}
+	c.sendSuccess(w, StatsTimeseries{
+		Interval: c.stats.interval.Seconds(),
+		Capacity: c.stats.size,
+		Samples:  c.stats.since(since),
+	})
+}
@@ -0,0 +1,88 @@
+package viewer
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestStatsTimeseries(t *testing.T) {
+	var viewer *Viewer
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+		// Only the first sample is taken by the sampler, the test takes
+		// the others
+		c.stats.interval = time.Hour
+		c.stats.size = 3
+		viewer = c
+	})
+
+	var series StatsTimeseries
+	s.Get("/api/stats/timeseries").Decode(t, &series)
+	if series.Interval != 3600 || series.Capacity != 3 {
+		t.Errorf("series = %+v, want hourly samples, three kept", series)
+	}
+	// The first request started the sampler
+	deadline := time.Now().Add(5 * time.Second)
+	for len(viewer.stats.since(time.Time{})) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	first := viewer.stats.since(time.Time{})
+	if len(first) != 1 || first[0].TxID == 0 || first[0].Size == 0 {
+		t.Fatalf("samples = %+v, want the first", first)
+	}
+
+	for _, value := range []string{"a", "b"} {
+		if resp := s.API(http.MethodPut, "/api/key/misc/text", value); !resp.Success {
+			t.Fatalf("PUT: %+v", resp)
+		}
+	}
+	if err := viewer.takeStatsSample(); err != nil {
+		t.Fatal(err)
+	}
+	s.Get("/api/stats/timeseries").Decode(t, &series)
+	if n := len(series.Samples); n != 2 || series.Samples[1].Commits != 2 || series.Samples[1].TxID != first[0].TxID+2 {
+		t.Fatalf("samples = %+v, want two commits in the second", series.Samples)
+	}
+	if series.Samples[1].TxN == 0 || series.Samples[1].PageCount == 0 {
+		t.Errorf("sample = %+v, want the transactions of the PUTs", series.Samples[1])
+	}
+
+	// Only the last three are kept
+	for i := 0; i < 2; i++ {
+		viewer.takeStatsSample()
+	}
+	s.Get("/api/stats/timeseries?since="+url.QueryEscape(first[0].Time.Format(time.RFC3339Nano))).Decode(t, &series)
+	if len(series.Samples) != 3 || series.Samples[0].Commits != 2 {
+		t.Errorf("samples = %+v, want the last three", series.Samples)
+	}
+
+	if r := s.API(http.MethodGet, "/api/stats/timeseries?since=yesterday", ""); r.Status != http.StatusBadRequest {
+		t.Errorf("since=yesterday: status %d, want 400", r.Status)
+	}
+}
+
+// Run with -race, tx.Check used to race with the sampler's transactions
+func TestStatsSampledDuringDoctor(t *testing.T) {
+	c := newViewer(boltdbtest.Containerd(t))
+	t.Cleanup(func() { c.Close() })
+	c.stats.interval = time.Millisecond
+
+	for i := 0; i < 20; i++ {
+		if _, err := c.runDoctor(time.Now(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No sample is taken while the doctor checks
+	c.stats.checking.Lock()
+	n := len(c.stats.since(time.Time{}))
+	c.takeStatsSample()
+	if after := len(c.stats.since(time.Time{})); after != n {
+		t.Errorf("%d samples taken during the checks", after-n)
+	}
+	c.stats.checking.Unlock()
+}
@@ -0,0 +1,97 @@
+// stream.go - bucket listings written to the response while the cursor moves
+package viewer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// streamFlushBytes buffered response bytes written to the client at once
+const streamFlushBytes = 64 * 1024
+
+// streamBucketDetails writes the APIResponse of getBucketDetails without
+// building the key slice: keys are encoded one by one as the cursor visits
+// them, so memory stays bounded for buckets of any size. Errors found before
+// the first byte is written are returned, later ones end the response early.
+func (c *Viewer) streamBucketDetails(w http.ResponseWriter, bucketPath string, order keyOrder, from []byte, budget *responseBudget) error {
+	db, err := c.openDB()
+	if err != nil {
+		return err
+	}
+
+	return db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+
+		// The bucket without keys, "keys" is spliced in before the closing brace
+		head, err := json.Marshal(c.buildBucketInfo(b, filepath.Base(bucketPath), bucketPath, 0, true))
+		if err != nil {
+			return err
+		}
+		budget.reserveBytes(len(head))
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		out := bufio.NewWriterSize(w, streamFlushBytes)
+		out.WriteString(`{"success":true,"data":`)
+		out.Write(head[:len(head)-1])
+		out.WriteString(`,"keys":[`)
+
+		var next []byte
+		n, gone := 0, false
+		limited := order.forEach(b, from, func(k, v []byte) bool {
+			data, err := json.Marshal(c.parseKeyValue(k, v))
+			if err != nil {
+				slog.Error("Failed to encode key", "bucket", bucketPath, "key", string(k), "error", err)
+				return true
+			}
+			if !budget.takeBytes(len(data)) {
+				next = order.cursor(k, v)
+				return false
+			}
+			if n > 0 {
+				out.WriteByte(',')
+			}
+			if _, err := out.Write(data); err != nil {
+				// The client went away, nothing left to report to
+				slog.Warn("Stopped streaming bucket", "bucket", bucketPath, "error", err)
+				gone = true
+				return false
+			}
+			n++
+			return true
+		})
+		if gone {
+			return nil
+		}
+		if next == nil {
+			next = limited
+		}
+
+		out.WriteString(`]}`)
+		if next != nil {
+			fmt.Fprintf(out, `,"partial":true,"cursor":%q`, encodeCursor(next))
+		}
+		// The keys are only all counted when one response holds them
+		meta := ListMeta{Returned: n, NextCursor: encodeCursor(next), Truncated: next != nil}
+		if from == nil && next == nil {
+			meta.Total = &n
+		}
+		if data, err := json.Marshal(meta); err == nil {
+			out.WriteString(`,"meta":`)
+			out.Write(data)
+		}
+		out.WriteString("}\n")
+		if err := out.Flush(); err != nil {
+			slog.Warn("Stopped streaming bucket", "bucket", bucketPath, "error", err)
+		}
+		return nil
+	})
+}
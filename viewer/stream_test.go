@@ -0,0 +1,49 @@
+package viewer
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestStreamBucketDetails(t *testing.T) {
+	path := boltdbtest.Huge(t, boltdbtest.HugeOptions{Buckets: 1, KeysPerBucket: 2000})
+	s := newTestServer(t, path, func(c *Viewer) {
+		c.maxResponseBytes = 0
+	})
+
+	c := newViewer(path)
+	defer c.Close()
+	want, next, err := c.getBucketDetails("bucket-0000", keyOrder{}, nil, nil)
+	if err != nil || next != nil {
+		t.Fatalf("getBucketDetails: next %q err %v", next, err)
+	}
+
+	resp := s.Get("/api/bucket/bucket-0000")
+	var got BucketInfo
+	resp.Decode(t, &got)
+	if resp.Partial {
+		t.Error("unlimited response is partial")
+	}
+	if len(got.Keys) != 2000 {
+		t.Fatalf("%d keys streamed, want 2000", len(got.Keys))
+	}
+	// Compare as the client sees both, values decode as generic JSON
+	data, _ := json.Marshal(want)
+	var decoded BucketInfo
+	json.Unmarshal(data, &decoded)
+	if !reflect.DeepEqual(got, decoded) {
+		t.Errorf("streamed bucket differs from getBucketDetails")
+	}
+}
+
+func TestStreamBucketNotFound(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	if resp := s.API(http.MethodGet, "/api/bucket/missing", ""); resp.Success || resp.Status != http.StatusInternalServerError {
+		t.Errorf("missing bucket: success %v status %d, want a 500 error", resp.Success, resp.Status)
+	}
+}
@@ -0,0 +1,267 @@
+// treecache.go - cached bucket tree of /api/buckets
+package viewer
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultTreeCacheTTL how long a bucket tree is served without walking the
+// database again, unless the database version changes first
+const defaultTreeCacheTTL = time.Minute
+
+// defaultTreeWorkers top level buckets whose trees are built at once, one
+// per CPU up to 8
+var defaultTreeWorkers = min(runtime.NumCPU(), 8)
+
+// treeCache the bucket tree of one database version
+type treeCache struct {
+	mu sync.Mutex
+	// ttl 0 disables the cache
+	ttl     time.Duration
+	version string
+	built   time.Time
+	buckets []BucketInfo
+	// light the tree was built without bucket statistics
+	light bool
+	// workers top level trees built at once, 1 builds them one after
+	// another in a single transaction
+	workers int
+}
+
+// bucketTree returns the tree of all top level buckets, cached while the
+// database version (see dbVersion) is unchanged and for at most the TTL; ok
+// is false if the cache is disabled. A cached tree with statistics also
+// serves requests without, not the other way round. The result is shared,
+// do not modify it.
+func (c *Viewer) bucketTree(withStats bool) (buckets []BucketInfo, ok bool, err error) {
+	t := &c.tree
+	if t.ttl <= 0 {
+		return nil, false, nil
+	}
+	version, err := c.dbVersion()
+	if err != nil {
+		return nil, true, err
+	}
+
+	// Concurrent misses wait for one walk instead of running their own
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.buckets != nil && t.version == version && time.Since(t.built) < t.ttl && (!t.light || !withStats) {
+		return t.buckets, true, nil
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		return nil, true, err
+	}
+	if buckets, _, _, err = c.topLevelTrees(db, nil, nil, withStats); err != nil {
+		return nil, true, err
+	}
+	if buckets == nil {
+		buckets = []BucketInfo{}
+	}
+
+	t.version, t.built, t.buckets, t.light = version, time.Now(), buckets, !withStats
+	slog.Info("Cached bucket tree", "version", version, "buckets", len(buckets), "stats", withStats)
+	return buckets, true, nil
+}
+
+// topLevelTrees builds the trees of the top level buckets from after on,
+// until one does not fit budget; next is that bucket. Up to c.tree.workers
+// sub-bucket trees are built at once, each worker in a read transaction of
+// its own as a bolt.Tx is not safe for concurrent use; should a commit land
+// between those transactions the trees are built again in one.
+func (c *Viewer) topLevelTrees(db *meteredDB, after []byte, budget *responseBudget, withStats bool) (buckets []BucketInfo, total int, next []byte, err error) {
+	var names [][]byte
+	var txid int
+	err = db.View(func(tx *bolt.Tx) error {
+		txid = tx.ID()
+		// Top-level buckets are few, counting them is cheap
+		cur := tx.Cursor()
+		for k, _ := cur.First(); k != nil; k, _ = cur.Next() {
+			total++
+			if after == nil || string(k) >= string(after) {
+				names = append(names, append([]byte(nil), k...))
+			}
+		}
+		if c.tree.workers > 1 {
+			return nil
+		}
+		buckets, next = c.takeTrees(tx, names, budget, withStats)
+		return nil
+	})
+	if err != nil || c.tree.workers <= 1 {
+		return buckets, total, next, err
+	}
+
+	var saved responseBudget
+	if budget != nil {
+		saved = *budget
+	}
+	// With a budget trees are built a batch of one per worker at a time, so
+	// a full budget wastes at most one batch
+	size := len(names)
+	if budget != nil && budget.limit > 0 {
+		size = c.tree.workers
+	}
+	for start := 0; start < len(names); start += size {
+		batch := names[start:min(start+size, len(names))]
+		trees, consistent, err := c.buildTreesConcurrently(db, txid, batch, withStats)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if !consistent {
+			slog.Debug("Database changed while building the bucket tree, building it in one transaction")
+			if budget != nil {
+				*budget = saved
+			}
+			err = db.View(func(tx *bolt.Tx) error {
+				buckets, next = c.takeTrees(tx, names, budget, withStats)
+				return nil
+			})
+			return buckets, total, next, err
+		}
+		for i, tree := range trees {
+			if !budget.take(tree) {
+				return buckets, total, batch[i], nil
+			}
+			buckets = append(buckets, tree)
+		}
+	}
+	return buckets, total, nil, nil
+}
+
+// takeTrees builds the trees of names in tx until one does not fit budget,
+// next is that bucket
+func (c *Viewer) takeTrees(tx *bolt.Tx, names [][]byte, budget *responseBudget, withStats bool) (buckets []BucketInfo, next []byte) {
+	for _, name := range names {
+		b := tx.Bucket(name)
+		if b == nil {
+			continue // deleted since names were listed
+		}
+		bucket := c.buildBucketInfo(b, string(name), string(name), 0, withStats)
+		if !budget.take(bucket) {
+			return buckets, name
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// treeJob a unit of a concurrent tree build: top level bucket top itself,
+// or with child the tree of one of its sub-buckets, so the namespaces below
+// containerd's single v1 bucket are built at once too
+type treeJob struct {
+	top   int
+	child []byte
+	tree  BucketInfo
+}
+
+// buildTreesConcurrently builds the trees of names with up to
+// c.tree.workers read transactions at once; consistent is false if a
+// transaction saw another version than txid
+func (c *Viewer) buildTreesConcurrently(db *meteredDB, txid int, names [][]byte, withStats bool) (trees []BucketInfo, consistent bool, err error) {
+	var jobs []*treeJob
+	err = db.View(func(tx *bolt.Tx) error {
+		if tx.ID() != txid {
+			return nil
+		}
+		consistent = true
+		for i, name := range names {
+			jobs = append(jobs, &treeJob{top: i})
+			tx.Bucket(name).ForEach(func(k, v []byte) error {
+				if v == nil {
+					jobs = append(jobs, &treeJob{top: i, child: append([]byte(nil), k...)})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil || !consistent {
+		return nil, false, err
+	}
+
+	workers := min(c.tree.workers, len(jobs))
+	queue := make(chan *treeJob)
+	errs := make([]error, workers)
+	var stale atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Drain what a failed transaction left
+			defer func() {
+				for range queue {
+				}
+			}()
+			errs[w] = db.View(func(tx *bolt.Tx) error {
+				if tx.ID() != txid {
+					stale.Store(true)
+					return nil
+				}
+				for job := range queue {
+					name := string(names[job.top])
+					b := tx.Bucket(names[job.top])
+					if job.child == nil {
+						job.tree = c.newBucketInfo(b, name, name, 0, withStats)
+						continue
+					}
+					job.tree = c.buildBucketInfo(b.Bucket(job.child), string(job.child), name+"/"+string(job.child), 1, withStats)
+				}
+				return nil
+			})
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if stale.Load() {
+		return nil, false, nil
+	}
+
+	// Jobs are in key order, each top level bucket before its sub-buckets
+	trees = make([]BucketInfo, len(names))
+	for _, job := range jobs {
+		if job.child == nil {
+			trees[job.top] = job.tree
+		} else {
+			trees[job.top].SubBuckets = append(trees[job.top].SubBuckets, job.tree)
+		}
+	}
+	return trees, true, nil
+}
+
+// invalidate drops the cached tree
+func (t *treeCache) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.version, t.built, t.buckets, t.light = "", time.Time{}, nil, false
+}
+
+// handleInvalidateCache drops cached results so the next request walks the
+// database again
+func (c *Viewer) handleInvalidateCache(w http.ResponseWriter, r *http.Request) {
+	c.tree.invalidate()
+	slog.Info("Bucket tree cache invalidated")
+	c.sendSuccess(w, map[string]interface{}{
+		"invalidated": true,
+	})
+}
@@ -0,0 +1,177 @@
+package viewer
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBucketTreeCache(t *testing.T) {
+	c := newViewer(boltdbtest.Tiny(t))
+	c.mode = ModeReadWrite
+	defer c.Close()
+	s := boltdbtest.NewServer(t, c.router())
+
+	tree := func() []BucketInfo {
+		t.Helper()
+		buckets, ok, err := c.bucketTree(true)
+		if !ok || err != nil {
+			t.Fatalf("bucketTree: ok %v err %v", ok, err)
+		}
+		return buckets
+	}
+	same := func(a, b []BucketInfo) bool { return &a[0] == &b[0] }
+
+	first := tree()
+	if !same(first, tree()) {
+		t.Error("unchanged database walked again")
+	}
+
+	if resp := s.API(http.MethodPut, "/api/key/misc/text", "changed"); !resp.Success {
+		t.Fatalf("write failed: %s %s", resp.Error, resp.Message)
+	}
+	changed := tree()
+	if same(first, changed) {
+		t.Error("tree cached across a write")
+	}
+
+	if resp := s.API(http.MethodPost, "/api/cache/invalidate", ""); !resp.Success {
+		t.Fatalf("invalidate failed: %s %s", resp.Error, resp.Message)
+	}
+	if same(changed, tree()) {
+		t.Error("tree cached across an invalidation")
+	}
+
+	c.tree.ttl = 0
+	if _, ok, _ := c.bucketTree(true); ok {
+		t.Error("disabled cache returned a tree")
+	}
+}
+
+func TestBucketTreeCachePaging(t *testing.T) {
+	path := boltdbtest.Huge(t, boltdbtest.HugeOptions{Buckets: 20, KeysPerBucket: 10})
+	s := newTestServer(t, path, func(c *Viewer) {
+		c.maxResponseBytes = 2048
+	})
+
+	var names []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 20 {
+			t.Fatal("paging does not terminate")
+		}
+		target := "/api/buckets"
+		if cursor != "" {
+			target += "?cursor=" + url.QueryEscape(cursor)
+		}
+		resp := s.Get(target)
+		var buckets []BucketInfo
+		resp.Decode(t, &buckets)
+		for _, b := range buckets {
+			names = append(names, b.Name)
+		}
+		if !resp.Partial {
+			break
+		}
+		cursor = resp.Cursor
+	}
+
+	if len(names) != 20 || names[0] != "bucket-0000" || names[19] != "bucket-0019" {
+		t.Errorf("paged buckets = %v, want bucket-0000 to bucket-0019 once", names)
+	}
+}
+
+func TestBucketTreeWithoutStats(t *testing.T) {
+	for _, ttl := range []time.Duration{0, time.Minute} {
+		s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+			c.tree.ttl = ttl
+		})
+		var light []BucketInfo
+		s.Get("/api/buckets?stats=false").Decode(t, &light)
+		if len(light) != 1 || !light[0].StatsOmitted || light[0].KeyCount != 0 ||
+			len(light[0].SubBuckets) != 1 || light[0].SubBuckets[0].Path != "misc/nested" || !light[0].SubBuckets[0].StatsOmitted {
+			t.Errorf("ttl %s: light tree = %+v", ttl, light)
+		}
+
+		// A light tree in the cache is not served to requests for statistics
+		var full []BucketInfo
+		s.Get("/api/buckets").Decode(t, &full)
+		if len(full) != 1 || full[0].StatsOmitted || full[0].KeyCount != 5 || full[0].SubBuckets[0].KeyCount != 1 {
+			t.Errorf("ttl %s: tree = %+v", ttl, full)
+		}
+		if status, _ := s.Do(http.MethodGet, "/api/buckets?stats=some", nil); status != http.StatusBadRequest {
+			t.Errorf("ttl %s: invalid stats status %d", ttl, status)
+		}
+	}
+
+	c := newViewer(boltdbtest.Tiny(t))
+	defer c.Close()
+	full, _, _ := c.bucketTree(true)
+	if light, _, _ := c.bucketTree(false); &light[0] != &full[0] {
+		t.Error("cached tree with statistics not served without")
+	}
+}
+
+func TestParallelBucketTree(t *testing.T) {
+	path := boltdbtest.Huge(t, boltdbtest.HugeOptions{Buckets: 20, KeysPerBucket: 10})
+	c := newViewer(path)
+	defer c.Close()
+	db, err := c.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(workers int, after []byte, budget *responseBudget) ([]BucketInfo, int, []byte) {
+		t.Helper()
+		c.tree.workers = workers
+		buckets, total, next, err := c.topLevelTrees(db, after, budget, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buckets, total, next
+	}
+	want, _, _ := build(1, nil, nil)
+	got, total, next := build(4, nil, nil)
+	if !reflect.DeepEqual(got, want) || total != 20 || next != nil {
+		t.Errorf("parallel tree differs: %d of %d buckets, next %q", len(got), total, next)
+	}
+
+	// A budget stops both at the same bucket
+	wantPage, _, wantNext := build(1, []byte("bucket-0005"), &responseBudget{limit: 2048})
+	gotPage, _, gotNext := build(3, []byte("bucket-0005"), &responseBudget{limit: 2048})
+	if !reflect.DeepEqual(gotPage, wantPage) || string(gotNext) != string(wantNext) || gotPage[0].Name != "bucket-0005" || gotNext == nil {
+		t.Errorf("page = %d buckets, next %q; want %d, next %q", len(gotPage), gotNext, len(wantPage), wantNext)
+	}
+
+	// The namespaces below containerd's single top level bucket are built
+	// at once too
+	containerd := newViewer(boltdbtest.Containerd(t))
+	defer containerd.Close()
+	cdb, err := containerd.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trees [2][]BucketInfo
+	for i, workers := range []int{1, 4} {
+		containerd.tree.workers = workers
+		if trees[i], _, _, err = containerd.topLevelTrees(cdb, nil, nil, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(trees[0], trees[1]) || len(trees[1]) != 1 || len(trees[1][0].SubBuckets) < 2 {
+		t.Errorf("containerd tree differs:\n%+v\n%+v", trees[0], trees[1])
+	}
+
+	// Transactions of another version than the listing are noticed
+	c.tree.workers = 2
+	var txid int
+	db.View(func(tx *bolt.Tx) error { txid = tx.ID(); return nil })
+	if _, consistent, err := c.buildTreesConcurrently(db, txid-1, [][]byte{[]byte("bucket-0000")}, true); consistent || err != nil {
+		t.Errorf("stale transaction: consistent %v, err %v", consistent, err)
+	}
+}
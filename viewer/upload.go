@@ -0,0 +1,373 @@
+// upload.go - databases uploaded for offline analysis
+package viewer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultMaxUploadBytes largest database accepted by /api/databases/upload
+	defaultMaxUploadBytes = 1 << 30
+	// maxUploads databases kept in the workspace at once
+	maxUploads = 20
+	// uploadFormField multipart field holding the database file
+	uploadFormField = "file"
+)
+
+// DatabaseInfo a database served by the viewer; URL is relative to the
+// page, the configured database is served at the root
+type DatabaseInfo struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Uploaded time.Time `json:"uploaded,omitempty"`
+	// Kind of a discovered database, e.g. metadata or snapshotter, see
+	// discover.go
+	Kind string `json:"kind,omitempty"`
+	URL  string `json:"url"`
+}
+
+// uploadPaths the files of the uploads of all workspaces by id, resolved
+// by the upload source adapter
+var uploadPaths sync.Map
+
+// uploadSource copies an upload by its id, so deleting the upload does not
+// remove a database still open
+type uploadSource struct{}
+
+func (uploadSource) Scheme() string { return "upload" }
+func (uploadSource) Description() string {
+	return "Copy a database uploaded to /api/databases/upload, by its id"
+}
+func (uploadSource) Example() string { return "upload://3f2a9c0d1e4b5a6f" }
+func (uploadSource) Available() bool { return true }
+
+func (uploadSource) Acquire(ctx context.Context, id string) (*Source, error) {
+	path, ok := uploadPaths.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("no upload %s", id)
+	}
+	return copySource{}.Acquire(ctx, path.(string))
+}
+
+// uploadedDB a database of the workspace, or a discovered one, with the
+// viewer serving it
+type uploadedDB struct {
+	info    DatabaseInfo
+	viewer  *Viewer
+	handler http.Handler
+}
+
+// uploadWorkspace temporary directory of uploaded databases, created on the
+// first upload and removed when the viewer closes
+type uploadWorkspace struct {
+	// maxBytes per upload, 0 disables uploads
+	maxBytes int64
+
+	mu  sync.Mutex
+	dir string
+	dbs map[string]*uploadedDB
+	// pending uploads still being received or checked, counted against
+	// maxUploads
+	pending int
+}
+
+// handleUploadDatabase stores the multipart "file" field in the workspace
+// and serves it read-only below db/{id}/
+func (c *Viewer) handleUploadDatabase(w http.ResponseWriter, r *http.Request) {
+	ws := &c.uploads
+	if ws.maxBytes <= 0 {
+		c.sendErrorCode(w, http.StatusForbidden, "Uploads are disabled", nil)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, ws.maxBytes)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Expected a multipart/form-data upload", err)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			c.sendErrorCode(w, http.StatusBadRequest, fmt.Sprintf("Missing %q field", uploadFormField), nil)
+			return
+		}
+		if err != nil {
+			c.sendErrorCode(w, uploadErrorStatus(err), "Failed to read upload", err)
+			return
+		}
+		if part.FormName() != uploadFormField {
+			part.Close()
+			continue
+		}
+
+		info, err := c.addUpload(part.FileName(), part)
+		part.Close()
+		if err != nil {
+			c.sendErrorCode(w, uploadErrorStatus(err), "Failed to store upload", err)
+			return
+		}
+		c.sendSuccess(w, info)
+		return
+	}
+}
+
+// uploadErrorStatus 413 for uploads over the limit, 400 otherwise
+func uploadErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// addUpload writes r to the workspace, checks that bolt can open it and
+// creates the viewer serving it. The upload is streamed and checked without
+// holding the workspace lock, which is only taken to reserve its directory
+// and to register it
+func (c *Viewer) addUpload(name string, r io.Reader) (*DatabaseInfo, error) {
+	ws := &c.uploads
+	id, dir, err := ws.reserve()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = "upload.db"
+	}
+	path := filepath.Join(dir, tempFileName(filepath.Base(name)))
+	size, err := writeUpload(path, r)
+	if err == nil {
+		err = checkBolt(path)
+	}
+	if err != nil {
+		ws.mu.Lock()
+		ws.pending--
+		ws.mu.Unlock()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	v := c.subViewer(path, "upload://"+id)
+	db := &uploadedDB{
+		info: DatabaseInfo{
+			ID:       id,
+			Name:     name,
+			Size:     size,
+			Uploaded: time.Now(),
+			URL:      "db/" + id + "/",
+		},
+		viewer:  v,
+		handler: subViewerHandler(id, v),
+	}
+
+	ws.mu.Lock()
+	ws.pending--
+	if ws.dbs == nil {
+		err = errors.New("workspace was closed")
+	} else {
+		ws.dbs[id] = db
+		uploadPaths.Store(id, path)
+	}
+	ws.mu.Unlock()
+	if err != nil {
+		v.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	slog.Info("Stored uploaded database", "name", name, "size", size, "id", id)
+	return &db.info, nil
+}
+
+// reserve creates the directory of a new upload, and the workspace on the
+// first one; the upload is pending until addUpload registers or drops it
+func (ws *uploadWorkspace) reserve() (id, dir string, err error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if len(ws.dbs)+ws.pending >= maxUploads {
+		return "", "", fmt.Errorf("workspace holds %d databases already, delete one first", maxUploads)
+	}
+	if ws.dir == "" {
+		dir, err := os.MkdirTemp("", "boltdbui-uploads-")
+		if err != nil {
+			return "", "", err
+		}
+		ws.dir, ws.dbs = dir, map[string]*uploadedDB{}
+	}
+
+	if id, err = newUploadID(); err != nil {
+		return "", "", err
+	}
+	dir = filepath.Join(ws.dir, id)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", "", err
+	}
+	ws.pending++
+	return id, dir, nil
+}
+
+// subViewer creates the viewer of an uploaded or discovered database: they
+// are browsed read-only with the settings of the configured database, the
+// parent logs and authenticates requests
+func (c *Viewer) subViewer(path, location string) *Viewer {
+	v := newViewer(path)
+	v.sourceLocation = location
+	v.maxResponseBytes = c.maxResponseBytes
+	v.tree.ttl = c.tree.ttl
+	v.staticDir = c.staticDir
+	v.requestLog.level = RequestLogNone
+	v.uploads.maxBytes = 0
+	v.boltOptions = c.boltOptions
+	return v
+}
+
+// subViewerHandler serves the UI and API of a sub viewer below /db/{id}
+func subViewerHandler(id string, v *Viewer) http.Handler {
+	return http.StripPrefix("/db/"+id, v.router())
+}
+
+// writeUpload copies r to a new file at path
+func writeUpload(path string, r io.Reader) (int64, error) {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return size, err
+}
+
+// checkBolt opens path read-only to reject files that are not bolt databases
+func checkBolt(path string) error {
+	db, err := openBolt(path, true, BoltOptions{})
+	if err != nil {
+		return fmt.Errorf("not a bolt database: %v", err)
+	}
+	return db.Close()
+}
+
+// newUploadID random identifier of an upload, used in its URL
+func newUploadID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handleListDatabases lists the configured database, the discovered ones
+// and the uploads
+func (c *Viewer) handleListDatabases(w http.ResponseWriter, r *http.Request) {
+	dbs := []DatabaseInfo{{ID: "default", Name: c.databaseLocation(), URL: "./"}}
+	if info, err := statFile(c.databasePath()); err == nil {
+		dbs[0].Size = info.Size()
+	}
+	if c.discovery != nil {
+		c.refreshDiscovered()
+		dbs = append(dbs, c.discovery.list()...)
+	}
+
+	ws := &c.uploads
+	ws.mu.Lock()
+	uploads := make([]DatabaseInfo, 0, len(ws.dbs))
+	for _, db := range ws.dbs {
+		uploads = append(uploads, db.info)
+	}
+	ws.mu.Unlock()
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].Uploaded.Before(uploads[j].Uploaded) })
+
+	c.sendSuccess(w, append(dbs, uploads...))
+}
+
+// handleDeleteDatabase removes an upload from the workspace
+func (c *Viewer) handleDeleteDatabase(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := c.uploads.remove(id); err != nil {
+		c.sendErrorCode(w, http.StatusNotFound, "Failed to delete database", err)
+		return
+	}
+	c.sendSuccess(w, map[string]interface{}{
+		"deleted": id,
+	})
+}
+
+// serveUpload serves the UI and API of an upload or a discovered database
+// below db/{id}/
+func (c *Viewer) serveUpload(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	db, ok := c.uploads.get(id)
+	if !ok && c.discovery != nil {
+		db, ok = c.discoveredDB(id)
+	}
+	if !ok {
+		c.sendErrorCode(w, http.StatusNotFound, "Database not found", fmt.Errorf("no upload %s", id))
+		return
+	}
+	if r.URL.Path == "/db/"+id {
+		// The page resolves its URLs relative to itself
+		http.Redirect(w, r, id+"/", http.StatusMovedPermanently)
+		return
+	}
+	db.handler.ServeHTTP(w, r)
+}
+
+// get returns an upload by id
+func (ws *uploadWorkspace) get(id string) (*uploadedDB, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	db, ok := ws.dbs[id]
+	return db, ok
+}
+
+// remove closes the viewer of an upload and deletes its file
+func (ws *uploadWorkspace) remove(id string) error {
+	ws.mu.Lock()
+	db, ok := ws.dbs[id]
+	delete(ws.dbs, id)
+	uploadPaths.Delete(id)
+	ws.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no upload %s", id)
+	}
+
+	db.viewer.closeWebSockets()
+	db.viewer.Close()
+	slog.Info("Deleted uploaded database", "name", db.info.Name, "id", id)
+	return os.RemoveAll(filepath.Dir(db.viewer.dbPath))
+}
+
+// close removes all uploads and the workspace directory
+func (ws *uploadWorkspace) close() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for id, db := range ws.dbs {
+		uploadPaths.Delete(id)
+		db.viewer.closeWebSockets()
+		db.viewer.Close()
+	}
+	ws.dbs = nil
+	if ws.dir == "" {
+		return nil
+	}
+	dir := ws.dir
+	ws.dir = ""
+	return os.RemoveAll(dir)
+}
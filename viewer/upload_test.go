@@ -0,0 +1,185 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+// upload posts data as the multipart file field of /api/databases/upload
+func upload(t *testing.T, s *boltdbtest.Server, name string, data []byte) *boltdbtest.Response {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile(uploadFormField, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	res, err := s.Client().Post(s.URL+"/api/databases/upload", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	resp := &boltdbtest.Response{}
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		t.Fatalf("upload response is not JSON (status %d): %v", res.StatusCode, err)
+	}
+	resp.Status = res.StatusCode
+	return resp
+}
+
+func TestUploadDatabase(t *testing.T) {
+	var viewer *Viewer
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		viewer = c
+	})
+	data, err := os.ReadFile(boltdbtest.Containerd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Uploading is a mutation like any other
+	if resp := upload(t, s, "colleague-meta.db", data); resp.Status != http.StatusForbidden {
+		t.Errorf("upload in read-only mode: status %d, want 403", resp.Status)
+	}
+	viewer.mode = ModeReadWrite
+	resp := upload(t, s, "colleague-meta.db", data)
+	if !resp.Success {
+		t.Fatalf("upload failed: %d %s %s", resp.Status, resp.Error, resp.Message)
+	}
+	var info DatabaseInfo
+	resp.Decode(t, &info)
+	if info.Name != "colleague-meta.db" || info.Size != int64(len(data)) || info.URL != "db/"+info.ID+"/" {
+		t.Errorf("info = %+v", info)
+	}
+
+	// The upload is browsable with the full API below its URL
+	var buckets []BucketInfo
+	s.Get("/"+info.URL+"api/buckets").Decode(t, &buckets)
+	if len(buckets) != 1 || buckets[0].Name != "v1" {
+		t.Errorf("upload buckets = %+v, want v1", buckets)
+	}
+	if status, _ := s.Do(http.MethodGet, "/"+info.URL, nil); status != http.StatusOK {
+		t.Errorf("upload page status = %d, want 200", status)
+	}
+
+	var dbs []DatabaseInfo
+	s.Get("/api/databases").Decode(t, &dbs)
+	if len(dbs) != 2 || dbs[0].ID != "default" || dbs[1].ID != info.ID {
+		t.Errorf("databases = %+v, want default and the upload", dbs)
+	}
+
+	viewer.mode = ModeReadOnly
+	if resp := s.API(http.MethodDelete, "/api/databases/"+info.ID, ""); resp.Status != http.StatusForbidden {
+		t.Errorf("delete in read-only mode: status %d, want 403", resp.Status)
+	}
+	viewer.mode = ModeReadWrite
+	if resp := s.API(http.MethodDelete, "/api/databases/"+info.ID, ""); !resp.Success {
+		t.Fatalf("delete failed: %s", resp.Error)
+	}
+	if resp := s.API(http.MethodGet, "/"+info.URL+"api/buckets", ""); resp.Status != http.StatusNotFound {
+		t.Errorf("deleted upload status = %d, want 404", resp.Status)
+	}
+}
+
+func TestSlowUploadDoesNotBlock(t *testing.T) {
+	var viewer *Viewer
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		viewer = c
+	})
+	data, err := os.ReadFile(boltdbtest.Tiny(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := viewer.addUpload("slow.db", pr)
+		done <- err
+	}()
+	pw.Write(data[:len(data)/2])
+
+	// The workspace answers while the upload is still being received
+	listed := make(chan []DatabaseInfo, 1)
+	go func() {
+		var dbs []DatabaseInfo
+		s.Get("/api/databases").Decode(t, &dbs)
+		listed <- dbs
+	}()
+	select {
+	case dbs := <-listed:
+		if len(dbs) != 1 {
+			t.Errorf("databases during the upload = %+v, want only the default", dbs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listing the databases blocked on the upload")
+	}
+
+	pw.Write(data[len(data)/2:])
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	var dbs []DatabaseInfo
+	s.Get("/api/databases").Decode(t, &dbs)
+	if len(dbs) != 2 || dbs[1].Name != "slow.db" {
+		t.Errorf("databases = %+v, want the upload", dbs)
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+		c.uploads.maxBytes = 64 * 1024
+	})
+
+	if resp := upload(t, s, "notes.txt", []byte("not a database")); resp.Status != http.StatusBadRequest {
+		t.Errorf("non-bolt upload status = %d, want 400", resp.Status)
+	}
+	if resp := upload(t, s, "big.db", make([]byte, 128*1024)); resp.Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload status = %d, want 413", resp.Status)
+	}
+
+	s = newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+		c.uploads.maxBytes = 0
+	})
+	if resp := upload(t, s, "meta.db", nil); resp.Status != http.StatusForbidden {
+		t.Errorf("disabled upload status = %d, want 403", resp.Status)
+	}
+}
+
+func TestPendingUploadsCount(t *testing.T) {
+	var viewer *Viewer
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+		viewer = c
+	})
+	data, err := os.ReadFile(boltdbtest.Tiny(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Uploads still being received fill the workspace
+	for i := 0; i < maxUploads; i++ {
+		if _, _, err := viewer.uploads.reserve(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp := upload(t, s, "meta.db", data); resp.Success || !strings.Contains(resp.Error, "delete one first") {
+		t.Errorf("upload to a full workspace: %+v", resp)
+	}
+}
@@ -0,0 +1,1952 @@
+// viewer.go - containerd metadata viewer backend service
+
+// Package viewer serves a web UI and JSON API for browsing bolt databases
+// such as containerd's meta.db. Embed it in another HTTP server with
+// NewViewer and Handler, or run the boltdbui command with Main.
+package viewer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// shutdownTimeout bounds how long in-flight requests may drain on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Viewer containerd metadata viewer
+type Viewer struct {
+	// dbPath the served file, guarded by mu since POST /api/reload may
+	// switch it, see reload.go
+	dbPath   string
+	upgrader websocket.Upgrader
+
+	// location the database was acquired from, see sources.go
+	sourceLocation string
+
+	// records API calls when session recording is enabled, may be nil
+	session *sessionRecorder
+
+	// OIDC authentication, nil when authentication is disabled
+	auth *oidcAuth
+
+	// server mode, ModeReadOnly unless started with --mode read-write
+	mode string
+
+	// shared database handle, opened on first use
+	mu sync.Mutex
+	db *bolt.DB
+
+	// tuning of bolt.Open, see platform.go
+	boltOptions BoltOptions
+
+	// closed on shutdown to release WebSocket handlers
+	done      chan struct{}
+	closeDone sync.Once
+	wsConns   sync.WaitGroup
+
+	// exit on idle (--idle-timeout) or after one browser session (--once)
+	idleTimeout time.Duration
+	once        bool
+	activity    activityTracker
+	stop        chan string
+
+	// per-response byte budget, 0 disables it, see quota.go
+	maxResponseBytes int64
+
+	// directory overriding the embedded templates and assets, see web.go
+	staticDir string
+
+	// URL path the routes are served below, empty for the root, see
+	// basepath.go
+	basePath string
+
+	// bucket tree of /api/buckets, see treecache.go
+	tree treeCache
+
+	// recently viewed buckets and keys of each session, see history.go
+	history viewHistory
+
+	// sidecar bolt file of /api/bookmarks and /api/preferences, empty
+	// disables both, see bookmarks.go
+	bookmarksPath string
+
+	// how often the snapshot is refreshed if the file changed, 0 serves
+	// the file directly; snapshot and the replaced ones still open for
+	// in-flight requests are guarded by mu, see snapshot.go
+	snapshotInterval time.Duration
+	snapshot         *dbSnapshot
+	retiredSnapshots []*dbSnapshot
+
+	// how often WebSocket handlers poll the file for changes, 0 disables
+	// it, see watch.go
+	watchInterval time.Duration
+
+	// db.Stats() sampled periodically for /api/stats/timeseries, see
+	// statseries.go
+	stats *statsSeries
+
+	// scans running in the background, see jobs.go
+	jobs jobRegistry
+
+	// concurrent identical scans, see dedup.go
+	flight singleflight.Group
+
+	// serve /debug/pprof/ and /debug/vars, see debug.go
+	enablePprof bool
+
+	// request logging, see requestlog.go
+	requestLog requestLogger
+	// audit log of requests, nil if disabled, see accesslog.go
+	accessLog *accessLog
+
+	// databases uploaded for offline analysis, see upload.go
+	uploads uploadWorkspace
+
+	// bounds of Starlark runs, see scripting.go
+	scripts scriptLimits
+
+	// databases found below the --discover roots, nil unless enabled, see
+	// discover.go
+	discovery *discovery
+
+	// per-node agents of a frontend, nil unless configured, and the node
+	// an agent runs on, see daemonset.go
+	agents   *agentPool
+	nodeName string
+}
+
+// BucketInfo bucket information
+type BucketInfo struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Level    int    `json:"level"`
+	KeyCount int    `json:"keyCount"`
+	// Sequence the bucket's NextSequence counter
+	Sequence   uint64         `json:"sequence"`
+	SubBuckets []BucketInfo   `json:"subBuckets,omitempty"`
+	Keys       []KeyValuePair `json:"keys,omitempty"`
+	Stats      BucketStats    `json:"stats"`
+	IsExpanded bool           `json:"isExpanded"`
+	// StatsOmitted KeyCount and Stats were not computed, for trees listed
+	// with ?stats=false; /api/bucket/{path}?keys=none fills them in
+	StatsOmitted bool `json:"statsOmitted,omitempty"`
+}
+
+// KeyValuePair key-value pair
+type KeyValuePair struct {
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value"`
+	ValueType string      `json:"valueType"`
+	ValueSize int         `json:"valueSize"`
+	IsJSON    bool        `json:"isJson"`
+	IsBinary  bool        `json:"isBinary"`
+	Preview   string      `json:"preview"`
+	// DecodeHints decoders of /api/decode likely to apply, e.g. integer
+	DecodeHints []string `json:"decodeHints,omitempty"`
+	// Compression gzip or zstd for compressed values, whose type and
+	// preview are those of the content; ValueSize stays the stored size
+	Compression      string `json:"compression,omitempty"`
+	DecompressedSize int    `json:"decompressedSize,omitempty"`
+	// DecompressedPartial only the first DecompressedSize bytes were
+	// inflated, listings do not decompress large values whole
+	DecompressedPartial bool `json:"decompressedPartial,omitempty"`
+	// Digests content digests in the value linked to their blobs, in key
+	// details only
+	Digests []DigestRef `json:"digests,omitempty"`
+	// Offset and Length of the bytes of a value returned in chunks
+	Offset int `json:"offset,omitempty"`
+	Length int `json:"length,omitempty"`
+}
+
+// BucketStats bucket statistics
+type BucketStats struct {
+	BranchPageN     int `json:"branchPageN"`
+	BranchOverflowN int `json:"branchOverflowN"`
+	LeafPageN       int `json:"leafPageN"`
+	LeafOverflowN   int `json:"leafOverflowN"`
+	KeyN            int `json:"keyN"`
+	Depth           int `json:"depth"`
+	BranchInuse     int `json:"branchInuse"`
+	LeafInuse       int `json:"leafInuse"`
+	BranchAlloc     int `json:"branchAlloc"`
+	LeafAlloc       int `json:"leafAlloc"`
+	// BranchFill, LeafFill and Fill the percentage of the allocated bytes
+	// in use, of branch pages, leaf pages and both; 0 without pages
+	BranchFill float64 `json:"branchFill"`
+	LeafFill   float64 `json:"leafFill"`
+	Fill       float64 `json:"fill"`
+}
+
+// APIResponse API response
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Buckets interface{} `json:"buckets,omitempty"` // for frontend compatibility
+	Bucket  interface{} `json:"bucket,omitempty"`  // for frontend compatibility
+	Error   string      `json:"error,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Partial bool        `json:"partial,omitempty"` // response size budget reached
+	Cursor  string      `json:"cursor,omitempty"`  // pass as ?cursor= to continue
+	Meta    *ListMeta   `json:"meta,omitempty"`    // of list responses
+}
+
+// Options configure a Viewer created with NewViewer
+type Options struct {
+	// DBPath bolt database file to serve
+	DBPath string
+	// Mode ModeReadOnly (default) or ModeReadWrite
+	Mode string
+	// MaxResponseBytes per-response byte budget, 0 uses the default of 32MB,
+	// a negative value disables it
+	MaxResponseBytes int64
+	// StaticDir directory overriding the embedded frontend, empty for none
+	StaticDir string
+	// TreeCacheTTL how long the bucket tree is cached, 0 uses the default of
+	// one minute, a negative value disables the cache
+	TreeCacheTTL time.Duration
+	// TreeWorkers top level buckets whose trees are built at once, each in
+	// a read transaction of its own; 0 uses the default of one per CPU up to
+	// 8, 1 or a negative value builds them one after another
+	TreeWorkers int
+	// HistorySize how many recently viewed buckets and keys /api/history
+	// keeps per session, 0 uses the default of 50, a negative value disables
+	// the history
+	HistorySize int
+	// BookmarksFile bolt file storing /api/bookmarks and /api/preferences,
+	// created when the first is saved; empty disables both
+	BookmarksFile string
+	// SnapshotInterval serves reads from a consistent copy of the database,
+	// taken with Tx.WriteTo and replaced at this interval when the file
+	// changed; 0 serves the file directly. Read-only mode only.
+	SnapshotInterval time.Duration
+	// WatchInterval how often the database file is polled for changes made
+	// by other processes, pushed to the page over the WebSocket; 0 uses the
+	// default of two seconds, a negative value disables polling
+	WatchInterval time.Duration
+	// StatsInterval how often db.Stats() and the last transaction are
+	// sampled for /api/stats/timeseries, the last 360 samples are kept; 0
+	// uses the default of ten seconds, a negative value disables sampling
+	StatsInterval time.Duration
+	// EnablePprof serves net/http/pprof below /debug/pprof/ and expvar at
+	// /debug/vars
+	EnablePprof bool
+	// MaxUploadBytes largest database accepted by /api/databases/upload, 0
+	// uses the default of 1GB, a negative value disables uploads
+	MaxUploadBytes int64
+	// Bolt tuning of bolt.Open, e.g. how long it waits for the file lock
+	Bolt BoltOptions
+	// DiscoverRoots directories searched for more bolt databases, e.g.
+	// /var/lib/containerd, each served read-only below db/{id}/; empty
+	// disables discovery
+	DiscoverRoots []string
+	// RequestLog RequestLogAll (default), RequestLogErrors or RequestLogNone
+	RequestLog string
+	// RequestLogFormat RequestLogText (default, entries of the diagnostic log) or RequestLogJSON
+	// (JSON lines on stderr)
+	RequestLogFormat string
+	// AccessLog audits every request to a file of its own, separate from
+	// the request log
+	AccessLog AccessLogOptions
+	// Agents "node=http://host:port" viewers that requests naming a node
+	// are proxied to; with Agents or AgentService DBPath may be empty
+	Agents []string
+	// AgentService host:port of a headless service whose pods are agents,
+	// e.g. boltdbui-agent.kube-system.svc:8081
+	AgentService string
+	// NodeName node reported by an agent in /api/capabilities
+	NodeName string
+	// OIDC enables authentication when IssuerURL is set
+	OIDC OIDCConfig
+	// BasePath serves the routes below a URL path such as /boltdbui, for
+	// reverse proxies routing by path without stripping it; Handler
+	// expects it in the request paths
+	BasePath string
+}
+
+// NewViewer creates a viewer for embedding in another HTTP server, see
+// Handler; the database is opened on the first request
+func NewViewer(opts Options) (*Viewer, error) {
+	frontend := len(opts.Agents) > 0 || opts.AgentService != ""
+	if opts.DBPath == "" && !frontend {
+		return nil, fmt.Errorf("database path is required")
+	}
+
+	c := newViewer(opts.DBPath)
+	c.sourceLocation = opts.DBPath
+	c.nodeName = opts.NodeName
+
+	var err error
+	if frontend {
+		if c.agents, err = newAgentPool(opts.Agents, opts.AgentService); err != nil {
+			return nil, err
+		}
+	}
+	if c.mode, err = parseMode(opts.Mode); err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.MaxResponseBytes > 0:
+		c.maxResponseBytes = opts.MaxResponseBytes
+	case opts.MaxResponseBytes < 0:
+		c.maxResponseBytes = 0
+	}
+	switch {
+	case opts.MaxUploadBytes > 0:
+		c.uploads.maxBytes = opts.MaxUploadBytes
+	case opts.MaxUploadBytes < 0:
+		c.uploads.maxBytes = 0
+	}
+	if err := opts.Bolt.validate(); err != nil {
+		return nil, err
+	}
+	c.boltOptions = opts.Bolt
+	if len(opts.DiscoverRoots) > 0 {
+		c.discovery = &discovery{roots: opts.DiscoverRoots}
+	}
+	c.enablePprof = opts.EnablePprof
+	if c.requestLog.level, c.requestLog.format, err = parseRequestLog(opts.RequestLog, opts.RequestLogFormat); err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.TreeCacheTTL > 0:
+		c.tree.ttl = opts.TreeCacheTTL
+	case opts.TreeCacheTTL < 0:
+		c.tree.ttl = 0
+	}
+	switch {
+	case opts.TreeWorkers > 0:
+		c.tree.workers = opts.TreeWorkers
+	case opts.TreeWorkers < 0:
+		c.tree.workers = 1
+	}
+	switch {
+	case opts.HistorySize > 0:
+		c.history.size = opts.HistorySize
+	case opts.HistorySize < 0:
+		c.history.size = 0
+	}
+	c.bookmarksPath = opts.BookmarksFile
+	if opts.SnapshotInterval > 0 {
+		if c.writable() {
+			return nil, fmt.Errorf("snapshot mode serves a copy and cannot be combined with %s mode", ModeReadWrite)
+		}
+		c.snapshotInterval = opts.SnapshotInterval
+	}
+	switch {
+	case opts.WatchInterval > 0:
+		c.watchInterval = opts.WatchInterval
+	case opts.WatchInterval < 0:
+		c.watchInterval = 0
+	}
+	switch {
+	case opts.StatsInterval > 0:
+		c.stats.interval = opts.StatsInterval
+	case opts.StatsInterval < 0:
+		c.stats.interval = 0
+	}
+	if opts.StaticDir != "" {
+		if info, err := os.Stat(opts.StaticDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("static dir %s is not a directory", opts.StaticDir)
+		}
+		c.staticDir = opts.StaticDir
+	}
+	if c.basePath, err = parseBasePath(opts.BasePath); err != nil {
+		return nil, err
+	}
+	if opts.OIDC.IssuerURL != "" {
+		if c.auth, err = newOIDCAuth(context.Background(), opts.OIDC); err != nil {
+			return nil, fmt.Errorf("failed to configure OIDC: %v", err)
+		}
+	}
+	if c.accessLog, err = newAccessLog(opts.AccessLog); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Handler returns the UI and API. Mount it below a prefix with
+// http.StripPrefix, the page resolves its URLs relative to itself:
+//
+//	mux.Handle("/debug/boltdb/", http.StripPrefix("/debug/boltdb", v.Handler()))
+//
+// or serve the prefix itself with Options.BasePath.
+func (c *Viewer) Handler() http.Handler {
+	return c.withBasePath(c.router())
+}
+
+// newViewer creates a viewer with defaults for dbPath
+func newViewer(dbPath string) *Viewer {
+	return &Viewer{
+		dbPath: dbPath,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true // allow cross-origin
+			},
+		},
+		done:             make(chan struct{}),
+		stop:             make(chan string, 1),
+		maxResponseBytes: defaultMaxResponseBytes,
+		tree:             treeCache{ttl: defaultTreeCacheTTL, workers: defaultTreeWorkers},
+		watchInterval:    defaultWatchInterval,
+		stats:            newStatsSeries(defaultStatsInterval, defaultStatsSamples),
+		history:          viewHistory{size: defaultHistorySize},
+		requestLog:       requestLogger{level: RequestLogAll, format: RequestLogText},
+		uploads:          uploadWorkspace{maxBytes: defaultMaxUploadBytes},
+	}
+}
+
+// router builds the HTTP routes of the viewer
+func (c *Viewer) router() *mux.Router {
+	r := mux.NewRouter()
+	// ensure routes preserve encoded paths for server-side decoding
+	r.UseEncodedPath()
+	// Middlewares only run for matched routes, unmatched ones are logged too
+	r.NotFoundHandler = c.logRequests(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = c.logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	r.Use(c.logRequests)
+	r.Use(c.trackActivity)
+	r.Use(c.authenticate)
+	r.Use(c.routeToNode)
+
+	// authentication routes
+	r.HandleFunc("/auth/login", c.handleLogin).Methods("GET")
+	r.HandleFunc("/auth/callback", c.handleCallback).Methods("GET")
+	r.HandleFunc("/auth/logout", c.handleLogout).Methods("GET", "POST")
+
+	c.registerDebugRoutes(r)
+	r.HandleFunc("/metrics", c.handleMetrics).Methods("GET")
+
+	// uploaded databases, each with its own UI and API
+	r.PathPrefix("/db/{id}").HandlerFunc(c.serveUpload)
+
+	// static file service, embedded unless overridden by --static-dir
+	r.PathPrefix("/static/").Handler(c.staticHandler())
+
+	// API routes
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(c.measureRequests)
+	api.Use(c.localize)
+	api.Use(c.negotiateYAML)
+	api.Use(c.recordSession)
+	api.Use(c.recordHistory)
+	api.HandleFunc("/buckets", c.versioned(c.deduplicated(c.handleGetBuckets))).Methods("GET")
+	api.HandleFunc("/bucket/{path:.*}", c.versioned(c.deduplicated(c.handleGetBucket))).Methods("GET")
+	api.HandleFunc("/sequence/{path:.*}", c.handleGetSequence).Methods("GET")
+	api.HandleFunc("/sequence/{path:.*}", c.mutating(c.handleSetSequence)).Methods("PUT")
+	api.HandleFunc("/key/{bucketPath:.*}/{key}", c.versioned(c.handleGetKey)).Methods("GET")
+	api.HandleFunc("/key/{bucketPath:.*}/{key}", c.mutating(c.handlePutKey)).Methods("PUT")
+	api.HandleFunc("/key/{bucketPath:.*}/{key}", c.mutating(c.handleDeleteKey)).Methods("DELETE")
+	api.HandleFunc("/download/{bucketPath:.*}/{key}", c.handleDownload).Methods("GET")
+	api.HandleFunc("/decode/time/{bucketPath:.*}/{key}", c.handleDecodeTime).Methods("GET")
+	api.HandleFunc("/decode/protobuf/{bucketPath:.*}/{key}", c.handleDecodeProtobuf).Methods("GET")
+	api.HandleFunc("/decode/integer/{bucketPath:.*}/{key}", c.decodeHandler(decodeIntegerValue)).Methods("GET")
+	api.HandleFunc("/decode/gob/{bucketPath:.*}/{key}", c.decodeHandler(decodeGobValue)).Methods("GET")
+	api.HandleFunc("/decode/msgpack/{bucketPath:.*}/{key}", c.decodeHandler(decodeMsgpackValue)).Methods("GET")
+	api.HandleFunc("/decode/cbor/{bucketPath:.*}/{key}", c.decodeHandler(decodeCBORValue)).Methods("GET")
+	api.HandleFunc("/decode/base64/{bucketPath:.*}/{key}", c.decodeHandler(decodeBase64Value)).Methods("GET")
+	api.HandleFunc("/search", c.versioned(c.deduplicated(c.handleSearch))).Methods("GET")
+	api.HandleFunc("/info", c.handleGetInfo).Methods("GET")
+	api.HandleFunc("/stats", c.versioned(c.deduplicated(c.handleGetStats))).Methods("GET")
+	api.HandleFunc("/stats/timeseries", c.handleStatsTimeseries).Methods("GET")
+	api.HandleFunc("/sources", c.handleGetSources).Methods("GET")
+	api.HandleFunc("/whoami", c.handleWhoAmI).Methods("GET")
+	api.HandleFunc("/capabilities", c.handleGetCapabilities).Methods("GET")
+	api.HandleFunc("/locale", c.handleGetLocale).Methods("GET")
+	api.HandleFunc("/session", c.handleGetSession).Methods("GET")
+	api.HandleFunc("/session/replay", c.handleReplaySession).Methods("POST")
+	api.HandleFunc("/scripts/run", c.handleRunScript).Methods("POST")
+	api.HandleFunc("/doctor", c.handleDoctor).Methods("GET")
+	api.HandleFunc("/pages/{id:[0-9]+}", c.handleGetPage).Methods("GET")
+	api.HandleFunc("/compact", c.mutating(c.handleCompact)).Methods("POST")
+	api.HandleFunc("/copy", c.mutating(c.handleCopy)).Methods("POST")
+	api.HandleFunc("/rename", c.mutating(c.handleRename)).Methods("POST")
+	api.HandleFunc("/cache/invalidate", c.handleInvalidateCache).Methods("POST")
+	api.HandleFunc("/reload", c.handleReload).Methods("POST")
+	api.HandleFunc("/perf", c.handleGetPerf).Methods("GET")
+	api.HandleFunc("/export/ndjson", c.handleExportNDJSON).Methods("GET")
+	api.HandleFunc("/history", c.handleGetHistory).Methods("GET")
+	api.HandleFunc("/history", c.handleClearHistory).Methods("DELETE")
+	api.HandleFunc("/preferences", c.handleGetPreferences).Methods("GET")
+	api.HandleFunc("/preferences", c.handlePutPreferences).Methods("PUT")
+	api.HandleFunc("/bookmarks", c.handleListBookmarks).Methods("GET")
+	api.HandleFunc("/bookmarks", c.handleAddBookmark).Methods("POST")
+	api.HandleFunc("/bookmarks/{id}", c.handleDeleteBookmark).Methods("DELETE")
+	api.HandleFunc("/report/top", c.versioned(c.deduplicated(c.handleTopValues))).Methods("GET")
+	api.HandleFunc("/report/treemap", c.versioned(c.deduplicated(c.handleTreemap))).Methods("GET")
+	api.HandleFunc("/report/types", c.versioned(c.deduplicated(c.handleTypeHistogram))).Methods("GET")
+	api.HandleFunc("/report/schema", c.versioned(c.deduplicated(c.handleSchema))).Methods("GET")
+	api.HandleFunc("/report/fill", c.versioned(c.deduplicated(c.handleFillReport))).Methods("GET")
+	api.HandleFunc("/report/count", c.handleCountKeys).Methods("POST")
+	api.HandleFunc("/jobs", c.handleStartJob).Methods("POST")
+	api.HandleFunc("/jobs", c.handleListJobs).Methods("GET")
+	api.HandleFunc("/jobs/{id}", c.handleGetJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}", c.handleDeleteJob).Methods("DELETE")
+	api.HandleFunc("/jobs/{id}/download", c.handleJobDownload).Methods("GET")
+	api.HandleFunc("/openapi.json", c.handleOpenAPI).Methods("GET")
+	api.HandleFunc("/graphql", c.handleGraphQL).Methods("GET", "POST")
+	api.HandleFunc("/graphql/schema", c.handleGraphQLSchema).Methods("GET")
+
+	// containerd namespaces, ?namespace= scopes listings, search and reports
+	api.HandleFunc("/namespaces", c.versioned(c.handleListNamespaces)).Methods("GET")
+
+	// per-node agents of a frontend
+	api.HandleFunc("/nodes", c.handleListNodes).Methods("GET")
+
+	// uploaded databases
+	api.HandleFunc("/databases", c.handleListDatabases).Methods("GET")
+	api.HandleFunc("/databases/upload", c.mutating(c.handleUploadDatabase)).Methods("POST")
+	api.HandleFunc("/databases/{id}", c.mutating(c.handleDeleteDatabase)).Methods("DELETE")
+
+	// etcd backend routes
+	api.HandleFunc("/etcd/keys", c.versioned(c.deduplicated(c.handleEtcdKeys))).Methods("GET")
+	api.HandleFunc("/etcd/meta", c.handleEtcdMeta).Methods("GET")
+
+	// Docker database routes
+	api.HandleFunc("/docker/networks", c.versioned(c.handleDockerNetworks)).Methods("GET")
+	api.HandleFunc("/docker/volumes", c.versioned(c.handleDockerVolumes)).Methods("GET")
+
+	// containerd analysis routes
+	api.HandleFunc("/containerd/blob", c.handleBlob).Methods("GET")
+	api.HandleFunc("/containerd/containers", c.versioned(c.handleContainers)).Methods("GET")
+	api.HandleFunc("/containerd/images", c.versioned(c.handleImages)).Methods("GET")
+	api.HandleFunc("/containerd/images/duplicates", c.handleImageDuplicates).Methods("GET")
+	api.HandleFunc("/containerd/content/orphans", c.handleContentOrphans).Methods("GET")
+	api.HandleFunc("/containerd/gc-report", c.handleGCReport).Methods("GET")
+	api.HandleFunc("/containerd/leases", c.versioned(c.handleLeases)).Methods("GET")
+	api.HandleFunc("/containerd/search", c.versioned(c.handleLabelSearch)).Methods("GET")
+	api.HandleFunc("/containerd/sandboxes", c.versioned(c.handleSandboxes)).Methods("GET")
+	api.HandleFunc("/containerd/summary", c.versioned(c.handleSummary)).Methods("GET")
+	api.HandleFunc("/containerd/snapshots/chain", c.versioned(c.handleSnapshotChain)).Methods("GET")
+	api.HandleFunc("/containerd/snapshots/disk", c.handleSnapshotDisk).Methods("GET")
+
+	// WebSocket routes
+	api.HandleFunc("/ws", c.handleWebSocket)
+
+	// Home page
+	r.HandleFunc("/", c.handleIndex).Methods("GET")
+	// deep links to a bucket or key, see handleDeepLink
+	r.HandleFunc("/b/{path:.*}", c.handleDeepLink).Methods("GET")
+	r.HandleFunc("/k/{bucketPath:.*}/{key}", c.handleDeepLink).Methods("GET")
+
+	return r
+}
+
+// StartServer starts web server
+func (c *Viewer) StartServer(port int) error {
+	return c.ListenAndServe(fmt.Sprintf(":%d", port))
+}
+
+// ListenAndServe serves on a TCP address or, as unix:///path/to/socket, on
+// a unix domain socket until interrupted or stopped
+func (c *Viewer) ListenAndServe(address string) error {
+	return c.Serve([]Listener{{Address: address}})
+}
+
+// Serve serves on all listeners at once until interrupted or stopped; the
+// server stops as a whole when one of them fails
+func (c *Viewer) Serve(listeners []Listener) error {
+	servers, err := c.openListeners(listeners)
+	if err != nil {
+		c.Close()
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *listenerServer) {
+			errCh <- s.serve()
+		}(s)
+		slog.Info("containerd metadata viewer started", "url", s.url()+c.basePath+"/")
+	}
+	c.logDatabaseInfo()
+
+	c.activity.mu.Lock()
+	c.activity.last = time.Now()
+	c.activity.mu.Unlock()
+	if c.idleTimeout > 0 {
+		slog.Info("Exiting when idle", "idleTimeout", c.idleTimeout)
+		go c.watchIdle()
+	}
+	if c.once {
+		slog.Info("Exiting when the browser session ends")
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errCh:
+		slog.Error("Stopping server", "error", serveErr)
+	case <-ctx.Done():
+	case reason := <-c.stop:
+		slog.Info("Stopping server", "reason", reason)
+	}
+
+	slog.Info("Shutting down server, draining in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, s := range servers {
+		if shutdownErr := s.srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			slog.Error("Server shutdown did not complete", "url", s.url(), "error", shutdownErr)
+			err = shutdownErr
+		}
+	}
+	if serveErr != nil {
+		err = serveErr
+	}
+
+	// Give WebSocket handlers a chance to send their close frames
+	wsDone := make(chan struct{})
+	go func() {
+		c.wsConns.Wait()
+		close(wsDone)
+	}()
+	select {
+	case <-wsDone:
+	case <-shutdownCtx.Done():
+	}
+
+	if closeErr := c.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	slog.Info("Server stopped")
+
+	return err
+}
+
+// closeWebSockets signals all WebSocket handlers to close their connections
+func (c *Viewer) closeWebSockets() {
+	c.closeDone.Do(func() {
+		close(c.done)
+	})
+}
+
+// openDB returns the shared database handle, opening it on first use; the
+// handle is read-only unless the server runs in read-write mode, and its
+// transactions are measured, see metrics.go
+func (c *Viewer) openDB() (*meteredDB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.snapshotInterval > 0 {
+		db, err := c.snapshotDB()
+		if err != nil {
+			return nil, err
+		}
+		c.startStatsSampler()
+		return &meteredDB{db}, nil
+	}
+	if c.db != nil {
+		return &meteredDB{c.db}, nil
+	}
+
+	db, err := openBolt(c.dbPath, !c.writable(), c.boltOptions)
+	if err != nil {
+		// Name what is wrong with a file that is not a bolt database
+		if info, infoErr := checkBoltFile(c.dbPath); infoErr == nil && !info.Valid {
+			return nil, fmt.Errorf("failed to open database: %s is not a valid bolt database: %s", c.dbPath, strings.Join(info.Problems, "; "))
+		}
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	c.db = db
+	c.startStatsSampler()
+
+	return &meteredDB{db}, nil
+}
+
+// Close closes the shared database handle and the session recording
+func (c *Viewer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.stop()
+	c.jobs.close()
+	var err error
+	if c.session != nil {
+		err = c.session.Close()
+	}
+	if uploadErr := c.uploads.close(); uploadErr != nil {
+		err = uploadErr
+	}
+	if c.discovery != nil {
+		c.discovery.close()
+	}
+	if c.accessLog != nil {
+		if closeErr := c.accessLog.close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	if c.snapshot != nil {
+		for _, snap := range append(c.retiredSnapshots, c.snapshot) {
+			if closeErr := snap.close(); closeErr != nil {
+				err = closeErr
+			}
+		}
+		c.snapshot, c.retiredSnapshots = nil, nil
+	}
+
+	if c.db == nil {
+		return err
+	}
+
+	if closeErr := c.db.Close(); closeErr != nil {
+		err = closeErr
+	}
+	c.db = nil
+	return err
+}
+
+// handleGetBuckets gets all buckets
+func (c *Viewer) handleGetBuckets(w http.ResponseWriter, r *http.Request) {
+	after, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+
+	// stats=false lists names and hierarchy only, Stats() of every nested
+	// bucket dominates the walk
+	withStats := true
+	if s := r.URL.Query().Get("stats"); s != "" {
+		if withStats, err = strconv.ParseBool(s); err != nil {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid stats", err)
+			return
+		}
+	}
+
+	buckets, total, next, err := c.getAllBuckets(ns, after, c.newResponseBudget(), withStats)
+	if err != nil {
+		slog.Error("Failed to get buckets", "error", err)
+		c.sendError(w, "Failed to get bucket list", err)
+		return
+	}
+
+	// Set correct response headers
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	response := APIResponse{
+		Success: true,
+		Buckets: buckets,
+		Data:    buckets, // Also set data field for compatibility
+		Partial: next != nil,
+		Cursor:  encodeCursor(next),
+		Meta:    &ListMeta{Total: &total, Returned: len(buckets), NextCursor: encodeCursor(next), Truncated: next != nil},
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+// handleGetBucket gets detailed information for specified bucket
+func (c *Viewer) handleGetBucket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rawPath := vars["path"]
+
+	// Decode path from frontend, handle encoded characters like %2F, %3A
+	decodedPath, err := url.PathUnescape(rawPath)
+	if err != nil {
+		slog.Warn("PathUnescape failed, using original path", "raw", rawPath, "error", err)
+		decodedPath = rawPath
+	}
+	decodedPath = strings.Trim(decodedPath, "/")
+
+	// keys=none only counts, for buckets opened by accident; limit=N
+	// samples the first N keys instead
+	switch keys := r.URL.Query().Get("keys"); keys {
+	case "", "all":
+	case "none":
+		bucket, err := c.getBucketCount(decodedPath)
+		if err != nil {
+			c.sendError(w, "Failed to get bucket details", err)
+			return
+		}
+		c.sendSuccess(w, bucket)
+		return
+	default:
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid keys", fmt.Errorf("unknown keys %q, want all or none", keys))
+		return
+	}
+
+	from, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	// expr= returns what an expression yields for each value instead
+	expr, err := parseExpr(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid expression", err)
+		return
+	}
+	if expr != nil {
+		c.sendBucketExpr(w, expr, decodedPath, r.URL.Query().Get("key"), from)
+		return
+	}
+
+	order, err := parseKeyOrder(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid sort order", err)
+		return
+	}
+	// seek starts a listing at a key, the cursor of a partial response
+	// continues it
+	if seek := r.URL.Query().Get("seek"); seek != "" && from == nil {
+		if order.by == sortBySize {
+			c.sendErrorCode(w, http.StatusBadRequest, "Invalid seek", fmt.Errorf("seek needs keys sorted by name"))
+			return
+		}
+		from = []byte(seek)
+	}
+
+	format, err := listFormat(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid format", err)
+		return
+	}
+	if format == listFormatCSV {
+		if err := c.streamBucketCSV(w, decodedPath, order, from); err != nil {
+			c.sendError(w, "Failed to get bucket details", err)
+		}
+		return
+	}
+
+	// Keys are streamed, the envelope carries the bucket in data only
+	if err := c.streamBucketDetails(w, decodedPath, order, from, c.newResponseBudget()); err != nil {
+		slog.Error("Failed to get bucket details", "bucket", decodedPath, "error", err)
+		c.sendError(w, "Failed to get bucket details", err)
+		return
+	}
+}
+
+// handleGetKey gets detailed information for specified key
+func (c *Viewer) handleGetKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rawBucketPath := vars["bucketPath"]
+	rawKey := vars["key"]
+
+	// Decode path and key, handle %2F and other encodings
+	decodedPath, err := url.PathUnescape(rawBucketPath)
+	if err != nil {
+		slog.Warn("PathUnescape failed, using original bucket path", "raw", rawBucketPath, "error", err)
+		decodedPath = rawBucketPath
+	}
+	decodedPath = strings.Trim(decodedPath, "/")
+
+	decodedKey, err := url.PathUnescape(rawKey)
+	if err != nil {
+		slog.Warn("PathUnescape failed, using original key", "raw", rawKey, "error", err)
+		decodedKey = rawKey
+	}
+
+	expr, err := parseExpr(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid expression", err)
+		return
+	}
+	if expr != nil {
+		c.sendKeyExpr(w, expr, decodedPath, decodedKey)
+		return
+	}
+
+	// Values too large for the response budget, or the full-data view, are
+	// returned in chunks; ?offset= and ?length= request one explicitly
+	offset, err := decodeOffsetCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	chunk, err := parseValueChunk(r, offset)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid chunk", err)
+		return
+	}
+	kv, next, err := c.getKeyChunk(decodedPath, decodedKey, chunk)
+	if err != nil {
+		c.sendError(w, "Failed to get key details", err)
+		return
+	}
+	if kv != nil {
+		c.sendPartial(w, kv, next)
+		return
+	}
+
+	// Check if requesting full data
+	fullParam := r.URL.Query().Get("full")
+	if fullParam == "1" {
+		keyValue, err := c.getFullKeyData(decodedPath, decodedKey)
+		if err != nil {
+			c.sendError(w, "Failed to get full key data", err)
+			return
+		}
+		c.sendSuccess(w, keyValue)
+		return
+	}
+
+	keyValue, err := c.getKeyDetails(decodedPath, decodedKey)
+	if err != nil {
+		c.sendError(w, "Failed to get key details", err)
+		return
+	}
+
+	c.sendSuccess(w, keyValue)
+}
+
+// handleSearch search keys
+func (c *Viewer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		c.sendError(w, "Search query cannot be empty", nil)
+		return
+	}
+
+	offset, err := decodeOffsetCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+
+	format, err := listFormat(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid format", err)
+		return
+	}
+
+	ns, err := parseNamespace(r)
+	if err != nil {
+		c.sendErrorCode(w, http.StatusBadRequest, "Invalid namespace", err)
+		return
+	}
+	root, _ := scopedPath(ns, "")
+
+	results, err := c.searchKeys(r.Context(), query, root, offset)
+	if err != nil {
+		c.sendError(w, "Search failed", err)
+		return
+	}
+	if format == listFormatCSV {
+		c.sendSearchCSV(w, query, results)
+		return
+	}
+
+	budget := c.newResponseBudget()
+	for i, result := range results {
+		if !budget.take(result) {
+			next := strconv.Itoa(offset + i)
+			c.sendList(w, results[:i], ListMeta{Returned: i, NextCursor: next, Truncated: true}, next)
+			return
+		}
+	}
+
+	// Searches stop at searchResultLimit matches, the cursor continues
+	// after them
+	meta := ListMeta{Returned: len(results)}
+	if len(results) == searchResultLimit {
+		meta.Truncated = true
+		meta.NextCursor = strconv.Itoa(offset + len(results))
+	} else if offset == 0 {
+		total := len(results)
+		meta.Total = &total
+	}
+	c.sendList(w, results, meta, "")
+}
+
+// handleDecodeTime decode timestamp
+func (c *Viewer) handleDecodeTime(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucketPath := vars["bucketPath"]
+	key := vars["key"]
+
+	// URL decode
+	decodedPath, err := url.QueryUnescape(bucketPath)
+	if err != nil {
+		c.sendError(w, "Invalid bucket path", err)
+		return
+	}
+
+	decodedKey, err := url.QueryUnescape(key)
+	if err != nil {
+		c.sendError(w, "Invalid key", err)
+		return
+	}
+
+	// Get key value
+	value, err := c.getRawValue(decodedPath, decodedKey)
+	if err != nil {
+		c.sendError(w, "Failed to get key", err)
+		return
+	}
+
+	result, err := decodeTimeValue(value)
+	if err != nil {
+		c.sendError(w, "Failed to decode timestamp", err)
+		return
+	}
+
+	c.sendSuccess(w, result)
+}
+
+// handleDecodeProtobuf handles protobuf decode requests
+func (c *Viewer) handleDecodeProtobuf(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucketPath, err := url.QueryUnescape(vars["bucketPath"])
+	if err != nil {
+		c.sendError(w, "Invalid bucket path", err)
+		return
+	}
+
+	keyName, err := url.QueryUnescape(vars["key"])
+	if err != nil {
+		c.sendError(w, "Invalid key name", err)
+		return
+	}
+
+	value, err := c.getRawValue(bucketPath, keyName)
+	if err != nil {
+		c.sendError(w, "Failed to get key", err)
+		return
+	}
+
+	result, err := decodeProtobufValue(value)
+	if err != nil {
+		c.sendError(w, "Protobuf decoding failed", err)
+		return
+	}
+
+	c.sendSuccess(w, result)
+}
+
+// getRawValue returns a copy of the raw value stored under key
+func (c *Viewer) getRawValue(bucketPath, keyName string) ([]byte, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := c.findBucket(tx, bucketPath)
+		if bucket == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+
+		v := bucket.Get([]byte(keyName))
+		if v == nil {
+			return fmt.Errorf("key not found: %s", keyName)
+		}
+
+		// Copy data as it cannot be accessed outside transaction
+		value = make([]byte, len(v))
+		copy(value, v)
+
+		return nil
+	})
+
+	return value, err
+}
+
+// decodeTimeValue decodes a time.Time stored with MarshalBinary
+func decodeTimeValue(value []byte) (map[string]interface{}, error) {
+	var t time.Time
+	if err := t.UnmarshalBinary(value); err != nil {
+		return nil, err
+	}
+
+	// Return formatted time
+	return map[string]interface{}{
+		"decodedTime": t.Format("2006-01-02 15:04:05 MST"),
+		"timestamp":   t.Unix(),
+		"iso":         t.Format(time.RFC3339),
+	}, nil
+}
+
+// decodeProtobufValue decodes a protobuf Any envelope
+func decodeProtobufValue(value []byte) (map[string]interface{}, error) {
+	var any anypb.Any
+	if err := proto.Unmarshal(value, &any); err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"typeUrl": any.GetTypeUrl(),
+		"value":   string(any.GetValue()),
+		"size":    len(any.GetValue()),
+	}
+	// typeurl stores types that are not protobuf messages, like the OCI
+	// runtime spec, as JSON
+	if any.GetTypeUrl() == runtimeSpecTypeURL {
+		spec, err := decodeRuntimeSpec(any.GetValue())
+		if err != nil {
+			return nil, fmt.Errorf("invalid runtime spec: %v", err)
+		}
+		result["spec"] = spec
+	}
+	if kind := criMetadataKind(any.GetTypeUrl()); kind != "" {
+		md, err := decodeCRIMetadata(kind, any.GetValue())
+		if err != nil {
+			return nil, fmt.Errorf("invalid CRI %s metadata: %v", kind, err)
+		}
+		result["cri"] = md
+	}
+	// Messages of the containerd API, e.g. the runc shim's options
+	if result["spec"] == nil && result["cri"] == nil {
+		if msg, ok := resolveAny(&any); ok {
+			result["message"] = msg
+		}
+	}
+	// Other values, e.g. containerd extensions, are JSON documents or
+	// messages that may hold JSON in their string and bytes fields
+	if result["spec"] == nil && result["cri"] == nil && result["message"] == nil {
+		if doc, ok := parseJSONDocument(any.GetValue()); ok {
+			result["json"] = doc
+		} else if fields, err := decodeProtoFields(any.GetValue(), 0); err == nil && len(fields) > 0 {
+			result["fields"] = fields
+		}
+	}
+	return result, nil
+}
+
+// handleGetStats gets database statistics
+func (c *Viewer) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := c.getDatabaseStats()
+	if err != nil {
+		c.sendError(w, "Failed to get statistics", err)
+		return
+	}
+
+	c.sendSuccess(w, stats)
+}
+
+// handleWebSocket handles WebSocket connections
+func (c *Viewer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Counted before the upgrade hijacks the connection, until then
+	// Shutdown waits for the request so Serve cannot be waiting yet
+	c.wsConns.Add(1)
+	defer c.wsConns.Done()
+
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	// The index page holds this connection open for its lifetime
+	c.sessionOpened()
+	defer c.sessionClosed()
+
+	// Reading is required to notice the client going away; the client
+	// sends searches, see wssearch.go
+	out := &wsWriter{conn: conn}
+	searches := &wsSearches{out: out}
+	defer searches.running.Wait()
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		defer searches.stop()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			searches.handle(c, data)
+		}
+	}()
+
+	// Keep connection and send real-time updates
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	// Changes by other processes, e.g. containerd, make the page stale
+	watch, stopWatch := c.watchTicker()
+	defer stopWatch()
+	state, _ := c.statDB()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-watch:
+			current, err := c.statDB()
+			if err != nil || !current.changedFrom(state) {
+				continue
+			}
+			state = current
+			if err := out.writeJSON(dbChangedEvent(current)); err != nil {
+				return
+			}
+		case <-ticker.C:
+			// Send heartbeat
+			if err := out.writeJSON(map[string]interface{}{
+				"type":      "heartbeat",
+				"timestamp": time.Now().Unix(),
+			}); err != nil {
+				return
+			}
+		case <-c.done:
+			// Server is shutting down, tell the client before closing
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+			return
+		}
+	}
+}
+
+// getAllBuckets gets hierarchical structure of all buckets, starting at the
+// top level bucket after; next is the first bucket that did not fit the
+// budget. Without withStats only names and hierarchy are filled in.
+func (c *Viewer) getAllBuckets(ns string, after []byte, budget *responseBudget, withStats bool) (buckets []BucketInfo, total int, next []byte, err error) {
+	if path := c.databasePath(); path != "" {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, 0, nil, fmt.Errorf("database file does not exist: %s", path)
+		}
+	}
+
+	if tree, ok, err := c.bucketTree(withStats); ok {
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if ns != "" {
+			if tree = scopeBucketTree(tree, ns); len(tree) == 0 {
+				return nil, 0, nil, fmt.Errorf("namespace not found: %s", ns)
+			}
+		}
+		for _, bucket := range tree {
+			if after != nil && bucket.Name < string(after) {
+				continue
+			}
+			if !budget.take(bucket) {
+				return buckets, len(tree), []byte(bucket.Name), nil
+			}
+			buckets = append(buckets, bucket)
+		}
+		return buckets, len(tree), nil, nil
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if ns == "" {
+		return c.topLevelTrees(db, after, budget, withStats)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		// Only the namespace is walked, v1 keeps its own statistics
+		nsb, err := namespaceBucket(tx, ns)
+		if err != nil {
+			return err
+		}
+		v1 := tx.Bucket(bucketKeyVersion)
+		root := BucketInfo{
+			Name:         string(bucketKeyVersion),
+			Path:         string(bucketKeyVersion),
+			Sequence:     v1.Sequence(),
+			IsExpanded:   true,
+			StatsOmitted: !withStats,
+			SubBuckets:   []BucketInfo{c.buildBucketInfo(nsb, ns, namespacePath(ns), 1, withStats)},
+		}
+		if withStats {
+			stats := v1.Stats()
+			root.KeyCount, root.Stats = stats.KeyN, newBucketStats(stats)
+		}
+		buckets = []BucketInfo{root}
+		total = 1
+		return nil
+	})
+	return buckets, total, next, err
+}
+
+// newBucketStats converts bbolt bucket statistics
+func newBucketStats(stats bolt.BucketStats) BucketStats {
+	return BucketStats{
+		BranchPageN:     stats.BranchPageN,
+		BranchOverflowN: stats.BranchOverflowN,
+		LeafPageN:       stats.LeafPageN,
+		LeafOverflowN:   stats.LeafOverflowN,
+		KeyN:            stats.KeyN,
+		Depth:           stats.Depth,
+		BranchInuse:     stats.BranchInuse,
+		LeafInuse:       stats.LeafInuse,
+		BranchAlloc:     stats.BranchAlloc,
+		LeafAlloc:       stats.LeafAlloc,
+		BranchFill:      fillPercent(stats.BranchInuse, stats.BranchAlloc),
+		LeafFill:        fillPercent(stats.LeafInuse, stats.LeafAlloc),
+		Fill:            fillPercent(stats.BranchInuse+stats.LeafInuse, stats.BranchAlloc+stats.LeafAlloc),
+	}
+}
+
+// fillPercent inuse of alloc bytes in percent to one decimal, 0 if nothing
+// is allocated
+func fillPercent(inuse, alloc int) float64 {
+	if alloc == 0 {
+		return 0
+	}
+	return math.Round(float64(inuse)*1000/float64(alloc)) / 10
+}
+
+// buildBucketInfo builds bucket information (recursive), with the
+// statistics of every bucket unless withStats is false
+func (c *Viewer) buildBucketInfo(b *bolt.Bucket, name, path string, level int, withStats bool) BucketInfo {
+	bucket := c.newBucketInfo(b, name, path, level, withStats)
+
+	// Recursively get sub-buckets
+	b.ForEach(func(k, v []byte) error {
+		if v == nil { // This is a sub-bucket
+			subBucket := b.Bucket(k)
+			if subBucket != nil {
+				subPath := path + "/" + string(k)
+				subBucketInfo := c.buildBucketInfo(subBucket, string(k), subPath, level+1, withStats)
+				bucket.SubBuckets = append(bucket.SubBuckets, subBucketInfo)
+			}
+		}
+		return nil
+	})
+
+	return bucket
+}
+
+// newBucketInfo the information of b itself, without sub-buckets
+func (c *Viewer) newBucketInfo(b *bolt.Bucket, name, path string, level int, withStats bool) BucketInfo {
+	bucket := BucketInfo{
+		Name:         name,
+		Path:         path,
+		Level:        level,
+		Sequence:     b.Sequence(),
+		IsExpanded:   level < 2, // Default expand first two levels
+		StatsOmitted: !withStats,
+	}
+	if withStats {
+		stats := b.Stats()
+		// Stats reads every page below b
+		scanned(b.Tx(), int64(stats.BranchInuse+stats.LeafInuse))
+		bucket.KeyCount, bucket.Stats = stats.KeyN, newBucketStats(stats)
+	}
+	return bucket
+}
+
+// getBucketCount gets the statistics of a bucket, KeyN counted from its
+// pages, without visiting keys or sub-buckets
+func (c *Viewer) getBucketCount(bucketPath string) (*BucketInfo, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var bucket *BucketInfo
+	err = db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+		stats := b.Stats()
+		bucket = &BucketInfo{
+			Name:     filepath.Base(bucketPath),
+			Path:     bucketPath,
+			KeyCount: stats.KeyN,
+			Sequence: b.Sequence(),
+			Stats:    newBucketStats(stats),
+		}
+		return nil
+	})
+	return bucket, err
+}
+
+// getBucketDetails gets bucket detailed information including the key-value
+// pairs in order starting at from; next is the cursor of the first key that
+// did not fit the budget
+func (c *Viewer) getBucketDetails(bucketPath string, order keyOrder, from []byte, budget *responseBudget) (bucket *BucketInfo, next []byte, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := c.findBucket(tx, bucketPath)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+
+		bucketInfo := c.buildBucketInfo(b, filepath.Base(bucketPath), bucketPath, 0, true)
+		budget.reserve(bucketInfo)
+
+		// Get key-value pairs until the budget or the limit is used up
+		limited := order.forEach(b, from, func(k, v []byte) bool {
+			kv := c.parseKeyValue(k, v)
+			if !budget.take(kv) {
+				next = order.cursor(k, v)
+				return false
+			}
+			bucketInfo.Keys = append(bucketInfo.Keys, kv)
+			return true
+		})
+		if next == nil {
+			next = limited
+		}
+
+		bucket = &bucketInfo
+		return nil
+	})
+
+	return bucket, next, err
+}
+
+// findBucket finds bucket by path
+func (c *Viewer) findBucket(tx *bolt.Tx, path string) *bolt.Bucket {
+	// Normalize path, remove extra slashes
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	partsRaw := strings.Split(path, "/")
+	// Filter out empty segments to avoid empty names from consecutive slashes
+	parts := make([]string, 0, len(partsRaw))
+	for _, p := range partsRaw {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	slog.Debug("findBucket", "bucket", path, "parts", parts)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	bucket := tx.Bucket([]byte(parts[0]))
+	if bucket == nil {
+		slog.Debug("findBucket: top-level bucket not found", "name", parts[0])
+		return nil
+	}
+	slog.Debug("findBucket: found top-level bucket", "name", parts[0])
+
+	for i := 1; i < len(parts); i++ {
+		name := parts[i]
+		next := bucket.Bucket([]byte(name))
+		if next == nil {
+			// Try to match remaining path as single sub-bucket name (handle names containing '/')
+			remainder := strings.Join(parts[i:], "/")
+			if try := bucket.Bucket([]byte(remainder)); try != nil {
+				slog.Debug("findBucket: matching remaining path as single name", "name", remainder)
+				bucket = try
+				return bucket
+			}
+
+			// Further try longest match, merge segments from right to left
+			matched := false
+			for j := len(parts); j > i+1; j-- {
+				candidate := strings.Join(parts[i:j], "/")
+				if cand := bucket.Bucket([]byte(candidate)); cand != nil {
+					slog.Debug("findBucket: matched sub-bucket by merging segments", "name", candidate, "i", i, "j", j)
+					bucket = cand
+					i = j - 1 // Next loop starts from j
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+
+			// List sub-buckets at current level to help locate actual names
+			kids := make([]string, 0, 20)
+			_ = bucket.ForEach(func(k, v []byte) error {
+				if v == nil {
+					kids = append(kids, string(k))
+				}
+				return nil
+			})
+			if len(kids) > 20 {
+				kids = kids[:20]
+			}
+			slog.Debug("findBucket: sub-bucket not found", "level", i, "name", name, "available", kids)
+			return nil
+		}
+		bucket = next
+		slog.Debug("findBucket: entering sub-bucket", "level", i, "name", name)
+	}
+
+	return bucket
+}
+
+// previewMode how much of a value previews show
+type previewMode int
+
+const (
+	// previewList truncates text previews for bucket listings
+	previewList previewMode = iota
+	// previewDetail keeps text whole, binary previews show the first bytes
+	previewDetail
+	// previewFull hex dumps binary values whole
+	previewFull
+)
+
+// parseKeyValue parses key-value pairs
+func (c *Viewer) parseKeyValue(key, value []byte) KeyValuePair {
+	return c.buildKeyValue(string(key), value, previewList)
+}
+
+// buildKeyValue classifies a value and formats its preview
+func (c *Viewer) buildKeyValue(key string, value []byte, mode previewMode) KeyValuePair {
+	kv := KeyValuePair{
+		Key:       key,
+		ValueSize: len(value),
+	}
+
+	// Compressed values are classified by their content, listings inflate
+	// only the start of large ones
+	limit := maxDecompressedBytes
+	if mode == previewList {
+		limit = previewDecompressedBytes
+	}
+	var note string
+	compression, data, complete, err := decompressPrefix(value, limit)
+	switch {
+	case err == nil && compression != "" && !complete && mode != previewList:
+		err = fmt.Errorf("decompresses to more than %d bytes", maxDecompressedBytes)
+		fallthrough
+	case err != nil:
+		note = fmt.Sprintf("%s, not decompressed: %v\n", compression, err)
+	case compression != "":
+		kv.Compression = compression
+		kv.DecompressedSize = len(data)
+		kv.DecompressedPartial = !complete
+		if complete {
+			note = fmt.Sprintf("%s, %d bytes compressed, %d decompressed\n", compression, len(value), len(data))
+		} else {
+			note = fmt.Sprintf("%s, %d bytes compressed, first %d decompressed\n", compression, len(value), len(data))
+		}
+		value = data
+	}
+	if kv.DecompressedPartial {
+		value = trimPartialRune(value)
+	}
+	kv.IsBinary = !c.isUTF8(value)
+	kv.DecodeHints = decodeHints(value)
+
+	truncate := func(preview string) string {
+		if mode == previewList && len(preview) > 1000 {
+			return preview[:1000] + "\n... (truncated)"
+		}
+		return preview
+	}
+
+	// Try to parse as JSON, also behind the index of Docker's libkv stores
+	var jsonValue interface{}
+	libkvIndex, libkvPayload, isLibkv := splitLibkvValue(value)
+	if json.Unmarshal(value, &jsonValue) == nil || isLibkv && json.Unmarshal(libkvPayload, &jsonValue) == nil {
+		kv.IsJSON = true
+		kv.ValueType = "JSON"
+		kv.Value = jsonValue
+		if hasBase64(jsonValue) {
+			kv.DecodeHints = append(kv.DecodeHints, hintBase64)
+		}
+
+		// Format JSON preview
+		if formatted, err := json.MarshalIndent(jsonValue, "", "  "); err == nil {
+			kv.Preview = string(formatted)
+			if isLibkv {
+				kv.Preview = fmt.Sprintf("libkv index %d\n%s", libkvIndex, kv.Preview)
+			}
+			kv.Preview = truncate(kv.Preview)
+		} else {
+			kv.Preview = string(value)
+		}
+	} else if kv.DecompressedPartial && truncatedJSON(value) {
+		// Only the start of the document was inflated, shown as it is
+		kv.IsJSON = true
+		kv.ValueType = "JSON"
+		kv.Value = string(value)
+		kv.Preview = truncate(string(value))
+	} else if codec, decoded := detectCodec(value); codec != "" {
+		kv.ValueType = codec
+		kv.Value = decoded
+		if formatted, err := json.MarshalIndent(decoded, "", "  "); err == nil {
+			kv.Preview = truncate(string(formatted))
+		}
+	} else if kv.IsBinary {
+		kv.ValueType = "Binary"
+		kv.Value = fmt.Sprintf("<%d bytes binary data>", len(value))
+		if mode == previewFull {
+			// Generate complete hexadecimal preview (no length limit)
+			kv.Preview = "Hexadecimal preview:\n" + hexDump(value, 0)
+		} else {
+			kv.Preview = c.formatBinaryPreview(value)
+		}
+	} else {
+		kv.ValueType = "String"
+		kv.Value = string(value)
+		kv.Preview = truncate(string(value))
+		if _, ok := decodeBase64(strings.TrimSpace(string(value))); ok {
+			kv.DecodeHints = append(kv.DecodeHints, hintBase64)
+		}
+	}
+	kv.Preview = note + kv.Preview
+
+	return kv
+}
+
+// isUTF8 checks if data is valid UTF-8
+func (c *Viewer) isUTF8(data []byte) bool {
+	if len(data) == 0 || len(data) > 1024*1024 { // No more than 1MB
+		return false
+	}
+
+	// Check if contains null characters
+	for _, b := range data {
+		if b == 0 {
+			return false
+		}
+	}
+
+	// Check if valid UTF-8
+	return utf8.ValidString(string(data))
+}
+
+// formatBinaryPreview formats binary data preview
+func (c *Viewer) formatBinaryPreview(data []byte) string {
+	if len(data) == 0 {
+		return "(empty data)"
+	}
+
+	return "Hexadecimal preview:\n" + hexPreview(data, 256)
+}
+
+// getKeyDetails gets detailed information for key
+func (c *Viewer) getKeyDetails(bucketPath, keyName string) (*KeyValuePair, error) {
+	return c.getKeyData(bucketPath, keyName, previewDetail)
+}
+
+// hexDump formats data as hex and ascii lines, offsets start at base; the
+// offset is 64 bit so pages past 2GB dump correctly on 32 bit platforms, and
+// lines end in \n whatever the platform, they are shown by the browser
+func hexDump(data []byte, base int64) string {
+	var sb strings.Builder
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(&sb, "%04x: ", base+int64(i))
+		for j := i; j < i+16; j++ {
+			if j < end {
+				fmt.Fprintf(&sb, "%02x ", data[j])
+			} else {
+				sb.WriteString("   ")
+			}
+		}
+		sb.WriteString(" |")
+		for _, b := range data[i:end] {
+			if b >= 32 && b <= 126 {
+				sb.WriteByte(b)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	return sb.String()
+}
+
+// hexPreview dumps the first max bytes of data, noting how many follow
+func hexPreview(data []byte, max int) string {
+	if len(data) <= max {
+		return hexDump(data, 0)
+	}
+	return hexDump(data[:max], 0) + fmt.Sprintf("... %d more bytes", len(data)-max)
+}
+
+// getFullKeyData gets complete raw data for key (no truncation)
+func (c *Viewer) getFullKeyData(bucketPath, keyName string) (*KeyValuePair, error) {
+	return c.getKeyData(bucketPath, keyName, previewFull)
+}
+
+// getKeyData reads a key of a bucket with the given preview
+func (c *Viewer) getKeyData(bucketPath, keyName string, mode previewMode) (*KeyValuePair, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyValue *KeyValuePair
+
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := c.findBucket(tx, bucketPath)
+		if bucket == nil {
+			return fmt.Errorf("bucket not found: %s", bucketPath)
+		}
+
+		value := bucket.Get([]byte(keyName))
+		if value == nil {
+			return fmt.Errorf("key not found: %s", keyName)
+		}
+
+		kv := c.buildKeyValue(keyName, value, mode)
+		kv.Digests = c.digestRefs(tx, bucketPath, value)
+		keyValue = &kv
+		return nil
+	})
+
+	return keyValue, err
+}
+
+// searchResultLimit matches returned by a search request
+const searchResultLimit = 100
+
+// searchProgressKeys how many keys a search visits between calls of its
+// progress function
+const searchProgressKeys = 4096
+
+// errSearchStopped ends a search walk early
+var errSearchStopped = errors.New("search stopped")
+
+// keySearch the state of a search walk: keys whose name contains query,
+// lower case, are passed to emit until it returns false
+type keySearch struct {
+	query string
+	emit  func(result map[string]interface{}) bool
+	// progress, if set, is called every searchProgressKeys keys and stops
+	// the walk when it returns false
+	progress func() bool
+	scanned  int // keys and sub-buckets visited
+}
+
+// searchKeys search keys below root (the whole database if empty),
+// skipping the first offset matches, until ctx is done
+func (c *Viewer) searchKeys(ctx context.Context, query, root string, offset int) ([]map[string]interface{}, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []map[string]interface{}
+	limit := offset + searchResultLimit
+	search := &keySearch{query: strings.ToLower(query), emit: func(result map[string]interface{}) bool {
+		results = append(results, result)
+		return len(results) < limit
+	}, progress: func() bool {
+		return ctx.Err() == nil
+	}}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if err := c.walkSearch(tx, root, search); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+	if len(results) <= offset {
+		return nil, err
+	}
+
+	return results[offset:], err
+}
+
+// walkSearch runs a search below root, the whole database if empty
+func (c *Viewer) walkSearch(tx *bolt.Tx, root string, s *keySearch) error {
+	var err error
+	if root != "" {
+		b := c.findBucket(tx, root)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", root)
+		}
+		err = c.searchInBucket(tx, b, root, s)
+	} else {
+		err = tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return c.searchInBucket(tx, b, string(name), s)
+		})
+	}
+	if errors.Is(err, errSearchStopped) {
+		return nil
+	}
+	return err
+}
+
+// searchInBucket recursively searches in bucket
+func (c *Viewer) searchInBucket(tx *bolt.Tx, bucket *bolt.Bucket, path string, s *keySearch) error {
+	var n int64
+	defer func() { scanned(tx, n) }()
+	return bucket.ForEach(func(k, v []byte) error {
+		n += int64(len(k) + len(v))
+		s.scanned++
+		if s.progress != nil && s.scanned%searchProgressKeys == 0 && !s.progress() {
+			return errSearchStopped
+		}
+
+		keyName := string(k)
+		currentPath := path
+		if currentPath != "" {
+			currentPath += "/"
+		}
+		currentPath += keyName
+
+		if v == nil { // Sub-bucket
+			subBucket := bucket.Bucket(k)
+			if subBucket != nil {
+				return c.searchInBucket(tx, subBucket, currentPath, s)
+			}
+		} else { // Key-value pair
+			if strings.Contains(strings.ToLower(keyName), s.query) {
+				kv := c.parseKeyValue(k, v)
+				preview := kv.Preview
+				if len(preview) > 200 {
+					preview = preview[:200] + "..."
+				}
+
+				if !s.emit(map[string]interface{}{
+					"bucket":  path,
+					"key":     keyName,
+					"path":    currentPath,
+					"type":    kv.ValueType,
+					"size":    kv.ValueSize,
+					"preview": preview,
+				}) {
+					return errSearchStopped
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// getDatabaseStats gets database statistics
+func (c *Viewer) getDatabaseStats() (map[string]interface{}, error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := db.Stats()
+
+	// Get file information
+	path := c.databasePath()
+	fileInfo, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"database": map[string]interface{}{
+			"path":         path,
+			"size":         fileInfo.Size(),
+			"lastModified": fileInfo.ModTime(),
+			"freePageN":    stats.FreePageN,
+			"pendingPageN": stats.PendingPageN,
+		},
+		"transactions": map[string]interface{}{
+			"txN":     stats.TxN,
+			"openTxN": stats.OpenTxN,
+		},
+	}
+	meta, err := readMetaInfo(db)
+	if err != nil {
+		return nil, err
+	}
+	result["meta"] = meta
+	if snap := c.snapshotInfo(); snap != nil {
+		result["snapshot"] = snap
+	}
+	// Mismatched db versions after a containerd downgrade are a common
+	// support issue; snapshotter databases share the bucket but not the key
+	db.View(func(tx *bolt.Tx) error {
+		if detectDatabaseSchema(tx) == SchemaContainerd {
+			result["schema"] = readSchemaVersion(tx)
+		}
+		return nil
+	})
+	return result, nil
+}
+
+// Helper functions
+func (c *Viewer) sendSuccess(w http.ResponseWriter, data interface{}) {
+	c.sendPartial(w, data, "")
+}
+
+// sendPartial sends data that stopped at the response budget, cursor
+// continues it; an empty cursor marks a complete response
+func (c *Viewer) sendPartial(w http.ResponseWriter, data interface{}, cursor string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response := APIResponse{
+		Success: true,
+		Data:    data,
+		Partial: cursor != "",
+		Cursor:  cursor,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+// sendList sends a list with its meta block; cursor, set when the response
+// budget was reached, also marks the response partial
+func (c *Viewer) sendList(w http.ResponseWriter, data interface{}, meta ListMeta, cursor string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response := APIResponse{
+		Success: true,
+		Data:    data,
+		Partial: cursor != "",
+		Cursor:  cursor,
+		Meta:    &meta,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+func (c *Viewer) sendError(w http.ResponseWriter, message string, err error) {
+	c.sendErrorCode(w, http.StatusInternalServerError, message, err)
+}
+
+func (c *Viewer) sendErrorCode(w http.ResponseWriter, code int, message string, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+
+	errorMsg := c.translate(w.Header().Get("Content-Language"), message)
+	if err != nil {
+		errorMsg += ": " + err.Error()
+	}
+
+	response := APIResponse{
+		Success: false,
+		Error:   errorMsg,
+	}
+
+	if encodeErr := json.NewEncoder(w).Encode(response); encodeErr != nil {
+		slog.Error("Failed to encode error response", "error", encodeErr)
+	}
+}
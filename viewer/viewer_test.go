@@ -0,0 +1,450 @@
+package viewer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// newTestServer serves the viewer for a fixture database, configure adjusts
+// the viewer before the first request
+func newTestServer(t *testing.T, path string, configure ...func(*Viewer)) *boltdbtest.Server {
+	t.Helper()
+
+	viewer := newViewer(path)
+	for _, fn := range configure {
+		fn(viewer)
+	}
+	t.Cleanup(func() { viewer.Close() })
+
+	return boltdbtest.NewServer(t, viewer.Handler())
+}
+
+// bucketURL escapes a bucket path like the frontend
+func bucketURL(path string) string {
+	return url.PathEscape(path)
+}
+
+func TestGetBuckets(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	var buckets []BucketInfo
+	s.Get("/api/buckets").Decode(t, &buckets)
+
+	if len(buckets) != 1 || buckets[0].Name != "misc" {
+		t.Fatalf("buckets = %+v, want misc", buckets)
+	}
+	if len(buckets[0].SubBuckets) != 1 || buckets[0].SubBuckets[0].Path != "misc/nested" {
+		t.Errorf("sub-buckets = %+v, want misc/nested", buckets[0].SubBuckets)
+	}
+}
+
+func TestGetBucketAndKey(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	var bucket BucketInfo
+	s.Get("/api/bucket/misc").Decode(t, &bucket)
+	types := map[string]string{}
+	for _, kv := range bucket.Keys {
+		types[kv.Key] = kv.ValueType
+	}
+	want := map[string]string{"counter": "Binary", "json": "JSON", "text": "String"}
+	for key, typ := range want {
+		if types[key] != typ {
+			t.Errorf("%s type = %q, want %q", key, types[key], typ)
+		}
+	}
+
+	var kv KeyValuePair
+	s.Get("/api/key/"+bucketURL("misc/nested")+"/key").Decode(t, &kv)
+	if kv.Value != "value" {
+		t.Errorf("misc/nested/key = %v, want value", kv.Value)
+	}
+
+	resp := s.API(http.MethodGet, "/api/key/misc/missing", "")
+	if resp.Success {
+		t.Error("missing key succeeded")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Containerd(t))
+
+	var results []map[string]interface{}
+	s.Get("/api/search?q=snapshotkey").Decode(t, &results)
+	if len(results) != len(boltdbtest.Namespaces) {
+		t.Errorf("%d results, want one per namespace: %v", len(results), results)
+	}
+}
+
+func TestResponseBudget(t *testing.T) {
+	path := boltdbtest.Huge(t, boltdbtest.HugeOptions{Buckets: 1, KeysPerBucket: 200})
+	s := newTestServer(t, path, func(c *Viewer) {
+		c.maxResponseBytes = 4096
+	})
+
+	seen := map[string]bool{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 200 {
+			t.Fatal("paging does not terminate")
+		}
+		target := "/api/bucket/bucket-0000"
+		if cursor != "" {
+			target += "?cursor=" + url.QueryEscape(cursor)
+		}
+		resp := s.Get(target)
+
+		var bucket BucketInfo
+		resp.Decode(t, &bucket)
+		if len(bucket.Keys) == 0 {
+			t.Fatalf("page %d is empty", pages)
+		}
+		for _, kv := range bucket.Keys {
+			if seen[kv.Key] {
+				t.Fatalf("key %s returned twice", kv.Key)
+			}
+			seen[kv.Key] = true
+		}
+
+		if !resp.Partial {
+			if pages == 0 {
+				t.Error("response was not split")
+			}
+			break
+		}
+		cursor = resp.Cursor
+	}
+
+	if len(seen) != 200 {
+		t.Errorf("%d keys returned, want 200", len(seen))
+	}
+}
+
+func TestListMeta(t *testing.T) {
+	path := boltdbtest.Huge(t, boltdbtest.HugeOptions{Buckets: 2, KeysPerBucket: 200})
+	s := newTestServer(t, path, func(c *Viewer) {
+		c.maxResponseBytes = 4096
+	})
+	meta := func(resp *boltdbtest.Response) ListMeta {
+		t.Helper()
+		var m ListMeta
+		if err := json.Unmarshal(resp.Meta, &m); err != nil {
+			t.Fatalf("meta %s: %v", resp.Meta, err)
+		}
+		return m
+	}
+
+	resp := s.Get("/api/buckets")
+	if m := meta(resp); m.Total == nil || *m.Total != 2 || m.Returned == 0 || m.Truncated != resp.Partial {
+		t.Errorf("buckets meta = %+v", m)
+	}
+
+	resp = s.Get("/api/bucket/bucket-0000")
+	m := meta(resp)
+	if !m.Truncated || m.NextCursor != resp.Cursor || m.Total != nil || m.Returned == 0 || m.Returned >= 200 {
+		t.Errorf("first page of keys: meta = %+v, cursor %q", m, resp.Cursor)
+	}
+
+	// 400 matches, the first 100 of them unless the budget cuts them short
+	s = newTestServer(t, path)
+	resp = s.Get("/api/search?q=key")
+	if m := meta(resp); !m.Truncated || m.Returned != searchResultLimit || m.NextCursor != "100" || resp.Partial {
+		t.Errorf("search meta = %+v, partial %v", m, resp.Partial)
+	}
+	resp = s.Get("/api/search?q=key-0000000")
+	if m := meta(resp); m.Truncated || m.Total == nil || *m.Total != m.Returned || m.NextCursor != "" {
+		t.Errorf("complete search meta = %+v", m)
+	}
+}
+
+func TestValueChunks(t *testing.T) {
+	value := make([]byte, maxValueChunk+100)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("blobs"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("big"), value)
+	})
+	// Without a response budget
+	s := newTestServer(t, path, func(c *Viewer) { c.maxResponseBytes = 0 })
+
+	resp := s.Get("/api/key/blobs/big?full=1")
+	var kv KeyValuePair
+	resp.Decode(t, &kv)
+	if !resp.Partial || resp.Cursor != strconv.Itoa(maxValueChunk) || kv.Length != maxValueChunk || kv.ValueSize != len(value) {
+		t.Fatalf("full: partial %v cursor %q, length %d of %d", resp.Partial, resp.Cursor, kv.Length, kv.ValueSize)
+	}
+	resp = s.Get("/api/key/blobs/big?full=1&cursor=" + resp.Cursor)
+	kv = KeyValuePair{}
+	resp.Decode(t, &kv)
+	if resp.Partial || kv.Offset != maxValueChunk || kv.Length != 100 || !strings.HasPrefix(kv.Preview, "Hexadecimal preview:\n100000: 00 01 02") {
+		t.Errorf("last chunk: partial %v, offset %d, length %d, preview %.60q", resp.Partial, kv.Offset, kv.Length, kv.Preview)
+	}
+
+	resp = s.Get("/api/key/blobs/big?offset=16&length=16")
+	kv = KeyValuePair{}
+	resp.Decode(t, &kv)
+	if kv.Offset != 16 || kv.Length != 16 || !strings.Contains(kv.Preview, "0010: 10 11 12") || strings.Count(kv.Preview, "\n") != 2 {
+		t.Errorf("explicit chunk: offset %d, length %d, preview %q", kv.Offset, kv.Length, kv.Preview)
+	}
+	for _, q := range []string{"offset=-1", "length=0", "length=" + strconv.Itoa(maxValueChunk+1)} {
+		if r := s.API(http.MethodGet, "/api/key/blobs/big?"+q, ""); r.Status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", q, r.Status)
+		}
+	}
+}
+
+func TestTextValueChunks(t *testing.T) {
+	text := "a€b😀c"
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("misc"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("text"), []byte(text))
+	})
+	s := newTestServer(t, path)
+
+	// Chunks shorter than a character still hold one
+	var chunks []string
+	for cursor := "0"; cursor != ""; {
+		resp := s.Get("/api/key/misc/text?length=1&cursor=" + cursor)
+		var kv KeyValuePair
+		resp.Decode(t, &kv)
+		if kv.Length == 0 || len(chunks) > len(text) {
+			t.Fatalf("chunk at %s: %+v, cursor %q", cursor, kv, resp.Cursor)
+		}
+		chunks = append(chunks, kv.Preview)
+		cursor = resp.Cursor
+	}
+	if got := strings.Join(chunks, "|"); got != "a|€|b|😀|c" {
+		t.Errorf("chunks = %s", got)
+	}
+
+	// An offset inside a character starts at the character
+	resp := s.Get("/api/key/misc/text?offset=2&length=2")
+	var kv KeyValuePair
+	resp.Decode(t, &kv)
+	if kv.Offset != 1 || kv.Preview != "€" || resp.Cursor != "4" {
+		t.Errorf("offset 2: offset %d, preview %q, cursor %q", kv.Offset, kv.Preview, resp.Cursor)
+	}
+}
+
+func TestModes(t *testing.T) {
+	path := boltdbtest.Tiny(t)
+
+	ro := newTestServer(t, path)
+	if resp := ro.API(http.MethodPut, "/api/key/misc/text", "changed"); resp.Status != http.StatusForbidden {
+		t.Errorf("write in read-only mode: status %d, want 403", resp.Status)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	viewer := newViewer(boltdbtest.Tiny(t))
+	viewer.mode = ModeReadWrite
+	t.Cleanup(func() { viewer.Close() })
+	handler := viewer.Handler()
+	// As authenticate stores the verified user
+	serve := func(method, target, body string, user *User) (*httptest.ResponseRecorder, APIResponse) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey{}, user))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp APIResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, target, err, rec.Body)
+		}
+		return rec, resp
+	}
+
+	config := OIDCConfig{EditorGroups: []string{"sre"}}
+	editor := &User{Subject: "e", Groups: []string{"dev", "sre"}, Role: config.role([]string{"dev", "sre"})}
+	reader := &User{Subject: "v", Groups: []string{"dev"}, Role: config.role([]string{"dev"})}
+	if editor.Role != RoleEditor || reader.Role != RoleViewer || (OIDCConfig{}).role(nil) != RoleEditor {
+		t.Fatalf("roles %s and %s", editor.Role, reader.Role)
+	}
+
+	if rec, _ := serve(http.MethodPut, "/api/key/misc/text", "changed", reader); rec.Code != http.StatusForbidden {
+		t.Errorf("write as viewer: status %d, want 403", rec.Code)
+	}
+	if rec, _ := serve(http.MethodGet, "/api/key/misc/text", "", reader); rec.Code != http.StatusOK {
+		t.Errorf("read as viewer: status %d", rec.Code)
+	}
+	if rec, resp := serve(http.MethodPut, "/api/key/misc/text", "changed", editor); !resp.Success {
+		t.Errorf("write as editor: status %d: %s", rec.Code, resp.Error)
+	}
+
+	for _, tc := range []struct {
+		user *User
+		edit bool
+	}{{reader, false}, {editor, true}, {nil, true}} {
+		var caps Capabilities
+		_, resp := serve(http.MethodGet, "/api/capabilities", "", tc.user)
+		data, _ := json.Marshal(resp.Data)
+		json.Unmarshal(data, &caps)
+		if caps.Actions["write"] != tc.edit || caps.ReadOnly == tc.edit || caps.Mode != ModeReadWrite {
+			t.Errorf("capabilities of %+v = %+v", tc.user, caps)
+		}
+		if tc.user != nil && caps.Role != tc.user.Role {
+			t.Errorf("role = %q, want %q", caps.Role, tc.user.Role)
+		}
+	}
+}
+
+func TestWriteKey(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+
+	if resp := s.API(http.MethodPut, "/api/key/misc/text", "changed"); !resp.Success {
+		t.Fatalf("write failed: %s %s", resp.Error, resp.Message)
+	}
+	var kv KeyValuePair
+	s.Get("/api/key/misc/text").Decode(t, &kv)
+	if kv.Value != "changed" {
+		t.Errorf("misc/text = %v, want changed", kv.Value)
+	}
+
+	if resp := s.API(http.MethodDelete, "/api/key/misc/text", ""); !resp.Success {
+		t.Fatalf("delete failed: %s %s", resp.Error, resp.Message)
+	}
+	if resp := s.API(http.MethodGet, "/api/key/misc/text", ""); resp.Success {
+		t.Error("deleted key still readable")
+	}
+}
+
+func TestSequence(t *testing.T) {
+	fill := func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("ids"))
+		if err != nil {
+			return err
+		}
+		return b.SetSequence(41)
+	}
+
+	ro := newTestServer(t, boltdbtest.New(t, fill))
+	var seq BucketSequence
+	ro.Get("/api/sequence/ids").Decode(t, &seq)
+	if seq.Sequence != 41 {
+		t.Errorf("sequence = %d, want 41", seq.Sequence)
+	}
+	if resp := ro.API(http.MethodPut, "/api/sequence/ids", `{"sequence":7}`); resp.Status != http.StatusForbidden {
+		t.Errorf("set in read-only mode: status %d, want 403", resp.Status)
+	}
+
+	rw := newTestServer(t, boltdbtest.New(t, fill), func(c *Viewer) {
+		c.mode = ModeReadWrite
+	})
+	if resp := rw.API(http.MethodPut, "/api/sequence/ids", `{"sequence":"x"}`); resp.Status != http.StatusBadRequest {
+		t.Errorf("invalid sequence: status %d, want 400", resp.Status)
+	}
+	if resp := rw.API(http.MethodPut, "/api/sequence/ids", `{"sequence":1000}`); !resp.Success {
+		t.Fatalf("set failed: %s %s", resp.Error, resp.Message)
+	}
+	var bucket BucketInfo
+	rw.Get("/api/bucket/ids").Decode(t, &bucket)
+	if bucket.Sequence != 1000 {
+		t.Errorf("bucket sequence = %d, want 1000", bucket.Sequence)
+	}
+}
+
+func TestHandlerBelowPrefix(t *testing.T) {
+	viewer, err := NewViewer(Options{DBPath: boltdbtest.Tiny(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { viewer.Close() })
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/boltdb/", http.StripPrefix("/debug/boltdb", viewer.Handler()))
+	s := boltdbtest.NewServer(t, mux)
+
+	var buckets []BucketInfo
+	s.Get("/debug/boltdb/api/buckets").Decode(t, &buckets)
+	if len(buckets) != 1 {
+		t.Errorf("buckets = %+v, want misc", buckets)
+	}
+	if status, _ := s.Do(http.MethodGet, "/debug/boltdb/static/app.js", nil); status != http.StatusOK {
+		t.Errorf("static asset: status %d", status)
+	}
+}
+
+func TestNewViewerOptions(t *testing.T) {
+	if _, err := NewViewer(Options{}); err == nil {
+		t.Error("viewer without database path created")
+	}
+	if _, err := NewViewer(Options{DBPath: "meta.db", Mode: "rwx"}); err == nil {
+		t.Error("viewer with invalid mode created")
+	}
+}
+
+func TestBucketKeyCountOnly(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	var bucket BucketInfo
+	s.Get("/api/bucket/misc?keys=none").Decode(t, &bucket)
+	if len(bucket.Keys) != 0 || len(bucket.SubBuckets) != 0 {
+		t.Errorf("keys=none listed %d keys and %d buckets", len(bucket.Keys), len(bucket.SubBuckets))
+	}
+	// KeyN counts the nested bucket and its key too
+	if bucket.KeyCount != 5 || bucket.Stats.KeyN != 5 || bucket.Path != "misc" {
+		t.Errorf("bucket = %+v, want 5 keys", bucket)
+	}
+
+	if status, _ := s.Do(http.MethodGet, "/api/bucket/misc?keys=some", nil); status != http.StatusBadRequest {
+		t.Errorf("keys=some status = %d, want 400", status)
+	}
+}
+
+func TestShutdownClosesWebSockets(t *testing.T) {
+	c := newViewer(boltdbtest.Tiny(t))
+	address, stopped := serveViewer(t, c)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+address+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	c.requestStop("test")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+			t.Errorf("read after shutdown: %v, want going away", err)
+		}
+		break
+	}
+	waitStopped(t, stopped, 5*time.Second)
+	// Shutdown does not wait for the socket until its timeout
+	if elapsed := time.Since(start); elapsed > shutdownTimeout/2 {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+	if _, err := http.Get("http://" + address + "/api/buckets"); err == nil {
+		t.Error("server still answers after shutdown")
+	}
+}
@@ -0,0 +1,52 @@
+// watch.go - database changes noticed by polling the file, pushed to the UI
+package viewer
+
+import (
+	"time"
+)
+
+// defaultWatchInterval how often WebSocket handlers check the database file
+// for changes made by other processes
+const defaultWatchInterval = 2 * time.Second
+
+// dbFileState the size and mtime of the database file; bolt writes change at
+// least one of them, no fsnotify needed
+type dbFileState struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// statDB returns the current state of the database file, of the snapshot
+// in snapshot mode so the page is told once the new snapshot is served
+func (c *Viewer) statDB() (dbFileState, error) {
+	info, err := statFile(c.servedPath())
+	if err != nil {
+		return dbFileState{}, err
+	}
+	return dbFileState{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// changedFrom reports whether the file changed since prev
+func (s dbFileState) changedFrom(prev dbFileState) bool {
+	return s.Size != prev.Size || !s.ModTime.Equal(prev.ModTime)
+}
+
+// dbChangedEvent the WebSocket message telling the page its data is stale
+func dbChangedEvent(state dbFileState) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "dbChanged",
+		"size":      state.Size,
+		"modTime":   state.ModTime.UTC().Format(time.RFC3339Nano),
+		"timestamp": time.Now().Unix(),
+	}
+}
+
+// watchTicker ticks every watch interval, its channel is nil and never
+// fires when watching is disabled
+func (c *Viewer) watchTicker() (<-chan time.Time, func()) {
+	if c.watchInterval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(c.watchInterval)
+	return ticker.C, ticker.Stop
+}
@@ -0,0 +1,41 @@
+package viewer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestWebSocketDBChanged(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.mode = ModeReadWrite
+		c.watchInterval = 10 * time.Millisecond
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Let the handler record the initial state before writing
+	time.Sleep(50 * time.Millisecond)
+	if r := s.API("PUT", "/api/key/misc/changed", "value"); !r.Success {
+		t.Fatalf("put failed: %+v", r)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg map[string]interface{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["type"] != "dbChanged" {
+		t.Errorf("message = %v, want dbChanged", msg)
+	}
+	if _, ok := msg["modTime"].(string); !ok {
+		t.Errorf("modTime = %v, want a time", msg["modTime"])
+	}
+}
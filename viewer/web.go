@@ -0,0 +1,178 @@
+// web.go - embedded frontend templates and static assets
+package viewer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// webFiles the frontend: templates/index.html and the assets below static/
+//
+//go:embed web
+var webFiles embed.FS
+
+// indexTemplateName the page template below templates/
+const indexTemplateName = "templates/index.html"
+
+var (
+	embeddedIndexOnce sync.Once
+	embeddedIndex     *template.Template
+	embeddedIndexErr  error
+)
+
+// indexPage data of the index template
+type indexPage struct {
+	Title string
+	// Base the <base href> of deep links, relative so the page still works
+	// below a prefix; empty for the index itself
+	Base string
+	// Bucket and Key the view a deep link opens
+	Bucket string
+	Key    string
+	// Lang the negotiated locale, Messages its bundle for app.js
+	Lang     string
+	Messages map[string]string
+}
+
+// T translates a string of the template to the page's locale
+func (p indexPage) T(text string) string {
+	if t, ok := p.Messages[text]; ok && t != "" {
+		return t
+	}
+	return text
+}
+
+// overlayFS serves files from upper, falling back to lower for files upper
+// does not have, so a theme only needs the files it changes
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.lower.Open(name)
+	}
+	return f, err
+}
+
+// webAssets returns the frontend files, --static-dir overrides the embedded
+// ones file by file
+func (c *Viewer) webAssets() fs.FS {
+	embedded, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err) // the embedded directory always exists
+	}
+	if c.staticDir == "" {
+		return embedded
+	}
+	return overlayFS{upper: os.DirFS(c.staticDir), lower: embedded}
+}
+
+// staticHandler serves the assets below static/
+func (c *Viewer) staticHandler() http.Handler {
+	static, err := fs.Sub(c.webAssets(), "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+}
+
+// indexTemplate parses the page template; the embedded one is parsed once,
+// one from --static-dir on every request so edits show up on reload
+func (c *Viewer) indexTemplate() (*template.Template, error) {
+	if c.staticDir != "" {
+		return template.ParseFS(c.webAssets(), indexTemplateName)
+	}
+
+	embeddedIndexOnce.Do(func() {
+		embeddedIndex, embeddedIndexErr = template.ParseFS(c.webAssets(), indexTemplateName)
+	})
+	return embeddedIndex, embeddedIndexErr
+}
+
+// handleIndex handles home page requests
+func (c *Viewer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	c.renderIndex(w, r, indexPage{})
+}
+
+// handleDeepLink serves the page with a bucket, /b/{path}, or a key,
+// /k/{bucketPath}/{key}, opened; the path may be one escaped segment, as
+// the page links it, or readable with slashes
+func (c *Viewer) handleDeepLink(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rawPath, ok := vars["path"]
+	if !ok {
+		rawPath = vars["bucketPath"]
+	}
+	bucketPath, err := url.PathUnescape(rawPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid bucket path: %v", err), http.StatusBadRequest)
+		return
+	}
+	page := indexPage{Bucket: strings.Trim(bucketPath, "/")}
+	if rawKey, ok := vars["key"]; ok {
+		if page.Key, err = url.PathUnescape(rawKey); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid key: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	page.Base = deepLinkBase(r.URL.EscapedPath())
+	c.renderIndex(w, r, page)
+}
+
+// deepLinkBase the relative URL of the index from a deep link path, one
+// "../" per directory the browser resolves relative URLs in
+func deepLinkBase(escapedPath string) string {
+	depth := strings.Count(escapedPath, "/") - 1
+	if depth < 1 {
+		return "./"
+	}
+	return strings.Repeat("../", depth)
+}
+
+// renderIndex renders the page template in the locale of the request
+func (c *Viewer) renderIndex(w http.ResponseWriter, r *http.Request, page indexPage) {
+	page.Lang = negotiateLocale(r, c.availableLocales())
+	messages, err := c.localeMessages(page.Lang)
+	if err != nil {
+		slog.Error("Failed to load locale", "locale", page.Lang, "error", err)
+		page.Lang, messages = defaultLocale, map[string]string{}
+	}
+	page.Messages = messages
+	if c.basePath != "" {
+		// Injected so the page's relative URLs resolve below the base path
+		page.Base = c.basePath + "/"
+	}
+	page.Title = page.T("containerd metadata viewer")
+	tmpl, err := c.indexTemplate()
+	if err != nil {
+		slog.Error("Failed to parse index template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load page template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		slog.Error("Failed to render index template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to render page: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", page.Lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Write(buf.Bytes())
+}
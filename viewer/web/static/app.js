@@ -0,0 +1,1703 @@
+// Global variables
+var expandedBuckets = new Set();
+var allBuckets = [];
+var currentBucketPath = '';
+var currentNamespace = '';
+// sort and order parameters of key listings, e.g. 'sort=size&order=desc'
+var currentKeyOrder = '';
+
+// Translations of the page's locale, embedded by the server; keys are the
+// English strings, see i18n.go
+var i18nMessages = (function() {
+    try {
+        return JSON.parse(document.getElementById('i18nMessages').textContent) || {};
+    } catch (e) {
+        return {};
+    }
+})();
+
+// t translates text and replaces {0}, {1}... with the other arguments
+function t(text) {
+    var args = arguments;
+    var translated = i18nMessages[text] || text;
+    return translated.replace(/\{(\d+)\}/g, function(m, i) {
+        var arg = args[Number(i) + 1];
+        return arg === undefined ? m : String(arg);
+    });
+}
+
+// Initialize draggable splitter
+function initializeResizer() {
+    var resizer = document.getElementById('resizer');
+    var sidebar = document.getElementById('sidebar');
+    var container = document.querySelector('.container');
+
+    var isResizing = false;
+    var startX = 0;
+    var startWidth = 0;
+
+    resizer.addEventListener('mousedown', function(e) {
+        isResizing = true;
+        startX = e.clientX;
+        startWidth = sidebar.offsetWidth;
+
+        document.body.style.cursor = 'col-resize';
+        document.body.style.userSelect = 'none';
+
+        e.preventDefault();
+    });
+
+    document.addEventListener('mousemove', function(e) {
+        if (!isResizing) return;
+
+        var deltaX = e.clientX - startX;
+        var newWidth = startWidth + deltaX;
+        var containerWidth = container.offsetWidth;
+
+        var minWidth = 200;
+        var maxWidth = containerWidth * 0.6;
+
+        if (newWidth >= minWidth && newWidth <= maxWidth) {
+            sidebar.style.width = newWidth + 'px';
+        }
+    });
+
+    document.addEventListener('mouseup', function() {
+        if (isResizing) {
+            isResizing = false;
+            document.body.style.cursor = '';
+            document.body.style.userSelect = '';
+            preferences.sidebarWidth = sidebar.offsetWidth;
+            savePreferences();
+        }
+    });
+
+    resizer.addEventListener('dblclick', function() {
+        sidebar.style.width = '350px';
+        delete preferences.sidebarWidth;
+        savePreferences();
+    });
+}
+
+// Load buckets, following cursors when the tree exceeds the response budget
+function loadBuckets(cursor, loaded) {
+    // Names and hierarchy only, fillBucketCounts adds the counts on screen
+    var params = ['stats=false'];
+    if (currentNamespace) params.push('namespace=' + encodeURIComponent(currentNamespace));
+    if (cursor) params.push('cursor=' + encodeURIComponent(cursor));
+    var url = 'api/buckets' + (params.length ? '?' + params.join('&') : '');
+    fetch(url)
+        .then(function(response) {
+            if (!response.ok) {
+                throw new Error('HTTP ' + response.status + ': ' + response.statusText);
+            }
+            return response.json();
+        })
+        .then(function(data) {
+            console.log('API Response:', data);
+            if (data.success) {
+                var buckets = (loaded || []).concat(data.buckets || data.data || []);
+                if (data.partial && data.cursor) {
+                    loadBuckets(data.cursor, buckets);
+                    return;
+                }
+                allBuckets = buckets;
+                renderBuckets(allBuckets);
+                openDeepLink();
+            } else {
+                showError(t('Load failed: {0}', data.error || t('Unknown error')));
+            }
+        })
+        .catch(function(error) {
+            console.error('Fetch error:', error);
+            showError(t('Network error: {0}', error.message));
+        });
+}
+
+function renderBuckets(buckets, filter) {
+    var container = document.getElementById('treeContainer');
+
+    if (!buckets || buckets.length === 0) {
+        container.innerHTML = '<div class="empty-state">' + t('No buckets found') + '</div>';
+        return;
+    }
+
+    var totalHtml = '';
+    buckets.forEach(function(bucket) {
+        totalHtml += renderBucketItem(bucket, filter, 0);
+    });
+
+    if (totalHtml) {
+        container.innerHTML = totalHtml;
+        fillBucketCounts();
+    } else {
+        container.innerHTML = '<div class="empty-state">' + (filter ? t('No matching buckets found') : t('No buckets found')) + '</div>';
+    }
+}
+
+// Render single bucket item (returns DOM element or null)
+function renderBucketItem(bucket, filter, level) {
+    var hasSubBuckets = bucket.subBuckets && bucket.subBuckets.length > 0;
+
+    var subBucketsHtml = '';
+    var hasVisibleChildren = false;
+    if (hasSubBuckets) {
+        bucket.subBuckets.forEach(function(subBucket) {
+            var childHtml = renderBucketItem(subBucket, filter, level + 1);
+            if (childHtml) {
+                subBucketsHtml += childHtml;
+                hasVisibleChildren = true;
+            }
+        });
+    }
+
+    var isMatch = !filter || bucket.name.toLowerCase().indexOf(filter.toLowerCase()) > -1;
+    if (!isMatch && !hasVisibleChildren) {
+        return '';
+    }
+
+    var isExpanded = bucket.isExpanded || expandedBuckets.has(bucket.path) || (filter && filter.length > 0);
+    var expandedClass = isExpanded ? 'expanded' : '';
+    var childrenDisplay = isExpanded ? 'block' : 'none';
+
+    var itemHtml = 
+        '<div class="tree-item ' + (hasSubBuckets ? 'has-children ' : '') + expandedClass + '" data-path="' + bucket.path + '" style="padding-left: ' + (level * 1.1 + 1.0) + 'rem;">' +
+            '<div class="tree-toggle"></div>' +
+            '<div class="tree-item-content">' +
+                '<div class="tree-item-name" title="' + bucket.path + '">' + bucket.name + '</div>' +
+                '<div class="item-count">' + (bucket.statsOmitted ? '' : (bucket.keyCount || 0)) + '</div>' +
+            '</div>' +
+        '</div>' +
+        (hasVisibleChildren ? '<div class="sub-buckets-container" style="display: ' + childrenDisplay + ';">' + subBucketsHtml + '</div>' : '');
+
+    return itemHtml;
+}
+
+// Key counts of a tree loaded without statistics, fetched for the buckets
+// on screen a few at a time
+var bucketCountQueue = [];
+var bucketCountsRunning = 0;
+var maxBucketCountRequests = 4;
+
+function fillBucketCounts() {
+    var byPath = {};
+    (function index(buckets) {
+        buckets.forEach(function(b) {
+            byPath[b.path] = b;
+            if (b.subBuckets) index(b.subBuckets);
+        });
+    })(allBuckets);
+    document.querySelectorAll('#treeContainer .tree-item').forEach(function(item) {
+        if (item.offsetParent === null) return; // in a collapsed bucket
+        var bucket = byPath[item.getAttribute('data-path')];
+        if (!bucket || !bucket.statsOmitted || bucket.countRequested) return;
+        bucket.countRequested = true;
+        bucketCountQueue.push(bucket);
+    });
+    while (bucketCountsRunning < maxBucketCountRequests && bucketCountQueue.length) {
+        fetchBucketCount(bucketCountQueue.shift());
+    }
+}
+
+function fetchBucketCount(bucket) {
+    bucketCountsRunning++;
+    fetch('api/bucket/' + encodeURIComponent(bucket.path) + '?keys=none')
+        .then(function(response) { return response.json(); })
+        .then(function(data) {
+            if (!data.success) return;
+            bucket.keyCount = data.data.keyCount;
+            bucket.stats = data.data.stats;
+            bucket.statsOmitted = false;
+            var count = document.querySelector('#treeContainer .tree-item[data-path="' + CSS.escape(bucket.path) + '"] .item-count');
+            if (count) count.textContent = bucket.keyCount || 0;
+        })
+        .catch(function(error) {
+            console.error('Count error:', error);
+        })
+        .finally(function() {
+            bucketCountsRunning--;
+            if (bucketCountQueue.length) fetchBucketCount(bucketCountQueue.shift());
+        });
+}
+
+function findBucketByPath(buckets, path) {
+    for (var i = 0; i < buckets.length; i++) {
+        if (buckets[i].path === path) {
+            return buckets[i];
+        }
+        if (buckets[i].subBuckets) {
+            var found = findBucketByPath(buckets[i].subBuckets, path);
+            if (found) {
+                return found;
+            }
+        }
+    }
+    return null;
+}
+
+// Select bucket
+function selectBucket(bucket, item) {
+    console.log('Selecting bucket:', bucket.path);
+    currentBucketPath = bucket.path;
+    var activeItems = document.querySelectorAll('.tree-item.active');
+    activeItems.forEach(function(i) {
+        i.classList.remove('active');
+    });
+
+    if (item) {
+        item.classList.add('active');
+    } else {
+        var selector = '.tree-item[data-path="' + bucket.path.replace(/"/g, '\"') + '"]';
+        var currentItem = document.querySelector(selector);
+        if (currentItem) {
+            currentItem.classList.add('active');
+        } else {
+            console.error('Could not find item to activate for path:', bucket.path);
+        }
+    }
+
+    loadBucketDetails(bucket.path);
+}
+
+// Load bucket details
+function loadBucketDetails(bucketPath) {
+    var mainContent = document.getElementById('mainContent');
+    mainContent.innerHTML = 
+        '<div class="content-header">' +
+            '<div class="content-title">' + bucketPath.split('/').pop() + '</div>' +
+            '<div class="content-subtitle">' + t('Loading details...') + '</div>' +
+        '</div>' +
+        '<div class="content-body">' +
+            '<div class="loading">' + t('Loading...') + '</div>' +
+        '</div>';
+
+    fetch(bucketURL(bucketPath, ''))
+        .then(function(response) {
+            if (!response.ok) {
+                throw new Error('HTTP ' + response.status + ': ' + response.statusText);
+            }
+            return response.json();
+        })
+        .then(function(data) {
+            console.log('Bucket details:', data);
+            if (data.success) {
+                var bucket = data.bucket || data.data;
+                bucket.nextCursor = data.partial ? data.cursor : '';
+                renderBucketDetails(bucket);
+            } else {
+                showError(t('Failed to load details: {0}', data.error || t('Unknown error')));
+            }
+        })
+        .catch(function(error) {
+            console.error('Fetch error:', error);
+            showError(t('Network error: {0}', error.message));
+        });
+}
+
+// bucketURL the key listing of a bucket in the selected order, with more
+// query parameters in extra
+function bucketURL(bucketPath, extra) {
+    var params = [currentKeyOrder, extra].filter(function(p) { return p; });
+    return 'api/bucket/' + encodeURIComponent(bucketPath) + (params.length ? '?' + params.join('&') : '');
+}
+
+// Render bucket details
+function renderBucketDetails(bucket) {
+    var mainContent = document.getElementById('mainContent');
+
+    var statsHtml = '';
+    if (bucket.stats) {
+        statsHtml = 
+            '<div class="stats-section">' +
+                '<h3>' + t('Statistics') + '</h3>' +
+                '<div class="stats-grid">' +
+                    '<div class="stat-card">' +
+                        '<div class="stat-value">' + (bucket.stats.keyN || bucket.stats.KeyN || 0) + '</div>' +
+                        '<div class="stat-label">' + t('Key Count') + '</div>' +
+                    '</div>' +
+                    '<div class="stat-card">' +
+                        '<div class="stat-value">' + (bucket.stats.leafPageN || bucket.stats.LeafPageN || 0) + '</div>' +
+                        '<div class="stat-label">' + t('Leaf Pages') + '</div>' +
+                    '</div>' +
+                    '<div class="stat-card">' +
+                        '<div class="stat-value">' + (bucket.stats.branchPageN || bucket.stats.BranchPageN || 0) + '</div>' +
+                        '<div class="stat-label">' + t('Branch Pages') + '</div>' +
+                    '</div>' +
+                    '<div class="stat-card">' +
+                        '<div class="stat-value">' + (bucket.stats.depth || bucket.stats.Depth || 0) + '</div>' +
+                        '<div class="stat-label">' + t('Depth') + '</div>' +
+                    '</div>' +
+                    '<div class="stat-card">' +
+                        '<div class="stat-value">' + (bucket.stats.fill || 0) + '%</div>' +
+                        '<div class="stat-label">' + t('Fill') + '</div>' +
+                    '</div>' +
+                    '<div class="stat-card">' +
+                        '<div class="stat-value">' + (bucket.sequence || 0) + '</div>' +
+                        '<div class="stat-label">' + t('Sequence') + '</div>' +
+                    '</div>' +
+                '</div>' +
+            '</div>';
+    }
+
+    var keysHtml = '';
+    if (bucket.keys && bucket.keys.length > 0) {
+        var keyItems = '';
+        for (var i = 0; i < bucket.keys.length; i++) {
+            var key = bucket.keys[i];
+            var keyName = (key.key || key.Key);
+            var bucketPathForBtn = (bucket.path || bucket.Path || '');
+            var valueSize = key.valueSize || key.ValueSize || 0;
+            var sizeText = t('{0} bytes', valueSize);
+            if (key.compression) {
+                // Compressed values are typed and previewed by their content
+                sizeText = key.decompressedPartial ?
+                    t('{0} {1} bytes, more than {2} decompressed', key.compression, valueSize, key.decompressedSize) :
+                    t('{0} {1} bytes, {2} decompressed', key.compression, valueSize, key.decompressedSize);
+                valueSize = Math.max(valueSize, key.decompressedSize);
+            }
+            // Large stored values are paged through with Range requests
+            var rangeAttr = !key.compression && valueSize > valueRangeThreshold ? ' data-value-size="' + valueSize + '"' : '';
+            var btnHtml = valueSize > 256 ? '<button class="view-full-btn" data-key-name="' + keyName + '"' + rangeAttr + '>' + t('View Full') + '</button>' : '';
+            var downloadUrl = 'api/download/' + encodeURIComponent(bucketPathForBtn) + '/' + encodeURIComponent(keyName);
+            btnHtml += '<a class="download-link" href="' + downloadUrl + '">.bin</a>' +
+                '<a class="download-link" href="' + downloadUrl + '?format=hex">.hex</a>';
+            // Digests in containerd records link to the blob of the namespace
+            var digest = /sha256:[0-9a-f]{64}/.exec(String(key.preview || ''));
+            var ns = /^v1\/([^\/]+)\//.exec(bucketPathForBtn);
+            if (digest && ns) {
+                var blobPath = 'v1/' + ns[1] + '/content/blob/' + digest[0];
+                btnHtml += '<a href="#" class="download-link bucket-link" data-bucket-path="' + escapeHTML(blobPath) + '" title="' + escapeHTML(blobPath) + '">blob</a>';
+            }
+            var decodeBtnHtml = '';
+            // Timestamp decode button
+            if (keyName.indexOf('createdat') !== -1 || keyName.indexOf('updatedat') !== -1) {
+                decodeBtnHtml += '<button class="decode-btn" data-key-name="' + keyName + '" data-decode-type="time">' + t('Decode Time') + '</button>';
+            }
+            // Protobuf decode button (for io.cri-containerd.container.metadata path, spec or runtime options key)
+            if (keyName == 'io.cri-containerd.container.metadata' || keyName == 'io.cri-containerd.sandbox.metadata' || keyName === 'spec' || keyName === 'metadata' || keyName === 'options') {
+                decodeBtnHtml += '<button class="decode-btn" data-key-name="' + keyName + '" data-decode-type="protobuf">' + t('Decode Protobuf') + '</button>';
+            }
+            (key.decodeHints || []).forEach(function(hint) {
+                decodeBtnHtml += '<button class="decode-btn" data-key-name="' + keyName + '" data-decode-type="' + hint + '">' + t('Decode {0}', hint.charAt(0).toUpperCase() + hint.slice(1)) + '</button>';
+            });
+            keyItems += 
+                '<div class="key-item">' +
+                    '<div class="key-header">' +
+                        '<span class="key-name">' + keyName + '</span>' +
+                        '<span class="key-type">' + (key.valueType || key.ValueType) + '</span>' +
+                        '<span class="key-size">' + sizeText + '</span>' +
+                        btnHtml +
+                        decodeBtnHtml +
+                    '</div>' +
+                    '<div class="key-preview">' + previewText(key.preview || key.Preview) + '</div>' +
+                '</div>';
+        }
+        var moreHtml = bucket.nextCursor ?
+            '<button class="load-more-btn" id="loadMoreKeys">' + t('Load more (response size limit reached)') + '</button>' : '';
+        keysHtml = 
+            '<div class="keys-section">' +
+                '<h3>' + t('Key-Value Pairs ({0})', bucket.keys.length + (bucket.nextCursor ? '+' : '')) +
+                    '<a class="download-link" href="' + bucketURL(bucket.path, 'format=csv') + '" title="' + t('Download all keys as CSV') + '">.csv</a>' +
+                    '<select class="key-order-select" id="keyOrderSelect" title="' + t('Order of the keys') + '">' +
+                        keyOrderOptions() +
+                    '</select>' +
+                    '<select class="key-order-select" id="previewSizeSelect" title="' + t('Characters of each value previewed') + '">' +
+                        previewSizeOptions() +
+                    '</select>' +
+                '</h3>' +
+                keyItems +
+                moreHtml +
+            '</div>';
+    } else {
+        keysHtml = '<div class="empty-state">' + t('No key-value pairs in this bucket') + '</div>';
+    }
+
+    mainContent.innerHTML = 
+        '<div class="content-header">' +
+            '<div class="content-title">' + bucket.name +
+                '<a class="deep-link" href="' + escapeHTML(bucketLink(bucket.path)) + '" title="' + t('Link to this bucket') + '">🔗</a>' +
+                (bookmarksEnabled ? '<button class="bookmark-btn" id="bookmarkBtn">' + (findBookmark(bucket.path) ? '★ ' + t('Bookmarked') : '☆ ' + t('Bookmark')) + '</button>' : '') +
+            '</div>' +
+            '<div class="content-subtitle">' + t('Bucket Details') + '</div>' +
+        '</div>' +
+        '<div class="content-body">' +
+            statsHtml +
+            keysHtml +
+        '</div>' +
+        '<div id="fullDataModal" class="modal">' +
+            '<div class="modal-content">' +
+                '<div class="modal-header">' +
+                    '<div class="modal-title">' + t('Full Data') + '</div>' +
+                    '<button class="close" id="closeFullDataModal">×</button>' +
+                '</div>' +
+                '<div class="modal-body">' +
+                    '<pre class="full-data-content" id="fullDataContent"></pre>' +
+                '</div>' +
+            '</div>' +
+        '</div>';
+
+    var bookmarkBtn = document.getElementById('bookmarkBtn');
+    if (bookmarkBtn) {
+        bookmarkBtn.addEventListener('click', toggleBookmark);
+    }
+
+    var previewSizeSelect = document.getElementById('previewSizeSelect');
+    if (previewSizeSelect) {
+        previewSizeSelect.addEventListener('change', function() {
+            preferences.previewSize = parseInt(previewSizeSelect.value, 10) || 0;
+            savePreferences();
+            renderBucketDetails(bucket);
+        });
+    }
+
+    var keyOrderSelect = document.getElementById('keyOrderSelect');
+    if (keyOrderSelect) {
+        keyOrderSelect.addEventListener('change', function() {
+            currentKeyOrder = keyOrderSelect.value;
+            loadBucketDetails(bucket.path);
+        });
+    }
+
+    var loadMore = document.getElementById('loadMoreKeys');
+    if (loadMore) {
+        loadMore.addEventListener('click', function() {
+            loadMore.disabled = true;
+            loadMoreKeys(bucket);
+        });
+    }
+}
+
+// keyOrderOptions the choices of the key order select, the current one selected
+function keyOrderOptions() {
+    var orders = [
+        ['', t('Name ascending')],
+        ['order=desc', t('Name descending')],
+        ['sort=size&order=desc', t('Largest first')],
+        ['sort=size', t('Smallest first')]
+    ];
+    return orders.map(function(o) {
+        return '<option value="' + o[0] + '"' + (o[0] === currentKeyOrder ? ' selected' : '') + '>' + o[1] + '</option>';
+    }).join('');
+}
+
+// previewSizeOptions the choices of the preview size select, 0 shows the
+// previews as the server truncates them
+function previewSizeOptions() {
+    var sizes = [[0, t('Full preview')], [80, t('{0} chars', 80)], [200, t('{0} chars', 200)], [500, t('{0} chars', 500)]];
+    return sizes.map(function(s) {
+        return '<option value="' + s[0] + '"' + (s[0] === (preferences.previewSize || 0) ? ' selected' : '') + '>' + s[1] + '</option>';
+    }).join('');
+}
+
+// previewText shortens a key list preview to the preferred size
+function previewText(preview) {
+    var size = preferences.previewSize || 0;
+    if (size > 0 && preview && preview.length > size) {
+        return preview.slice(0, size) + '…';
+    }
+    return preview;
+}
+
+// Append the next page of keys to the displayed bucket
+function loadMoreKeys(bucket) {
+    var url = bucketURL(bucket.path, 'cursor=' + encodeURIComponent(bucket.nextCursor));
+    fetch(url)
+        .then(function(res){ if(!res.ok) throw new Error('HTTP '+res.status); return res.json(); })
+        .then(function(data){
+            if (!data.success) {
+                showError(t('Failed to load details: {0}', data.error || t('Unknown error')));
+                return;
+            }
+            var page = data.bucket || data.data;
+            bucket.keys = bucket.keys.concat(page.keys || []);
+            bucket.nextCursor = data.partial ? data.cursor : '';
+            renderBucketDetails(bucket);
+        })
+        .catch(function(error) {
+            showError(t('Network error: {0}', error.message));
+        });
+}
+
+// Utility: escape HTML
+function escapeHTML(str) {
+    if (str == null) return '';
+    return String(str)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+// Show/hide modal
+function openFullDataModal(content, title) {
+    var modal = document.getElementById('fullDataModal');
+    if (!modal) {
+        // Header views can open it before any bucket was rendered
+        modal = document.createElement('div');
+        modal.id = 'fullDataModal';
+        modal.className = 'modal';
+        modal.innerHTML =
+            '<div class="modal-content">' +
+                '<div class="modal-header">' +
+                    '<div class="modal-title">' + t('Full Data') + '</div>' +
+                    '<button class="close" id="closeFullDataModal">×</button>' +
+                '</div>' +
+                '<div class="modal-body">' +
+                    '<pre class="full-data-content" id="fullDataContent"></pre>' +
+                '</div>' +
+            '</div>';
+        document.getElementById('mainContent').appendChild(modal);
+    }
+    var pre = document.getElementById('fullDataContent');
+    document.querySelector('#fullDataModal .modal-title').textContent = title || t('Full Data');
+    pre.textContent = content;
+    ['digestLinks', 'rangeNav'].forEach(function(id) {
+        var el = document.getElementById(id);
+        if (el) el.parentNode.removeChild(el);
+    });
+    modal.style.display = 'block';
+}
+
+// showDigestLinks lists the digests of the value in the modal, those with a
+// content blob link to its bucket
+function showDigestLinks(digests) {
+    if (!digests || !digests.length) return;
+    var list = document.createElement('div');
+    list.id = 'digestLinks';
+    list.className = 'digest-links';
+    list.innerHTML = '<h4>' + t('Referenced content') + '</h4>' + digests.map(function(d) {
+        if (!d.path) {
+            return '<div class="digest-ref missing" title="' + t('No content blob in this database') + '">' + escapeHTML(d.digest) + '</div>';
+        }
+        return '<div class="digest-ref"><a href="#" class="bucket-link" data-bucket-path="' + escapeHTML(d.path) + '">' + escapeHTML(d.digest) + '</a></div>';
+    }).join('');
+    document.getElementById('fullDataContent').parentNode.appendChild(list);
+}
+
+// Deep links: /b/<bucket path> and /k/<bucket path>/<key>, each path one
+// escaped segment, serve the page with the target on <body data-bucket>
+function bucketLink(path) {
+    return 'b/' + encodeURIComponent(path);
+}
+
+function keyLink(bucketPath, keyName) {
+    return 'k/' + encodeURIComponent(bucketPath) + '/' + encodeURIComponent(keyName);
+}
+
+// openDeepLink opens the target of a deep link once, after the tree loaded
+var deepLinkOpened = false;
+function openDeepLink() {
+    var target = document.body.dataset;
+    if (deepLinkOpened || !target.bucket) return;
+    deepLinkOpened = true;
+    openBookmark({ bucket: target.bucket, key: target.key });
+}
+
+// openBucketPath shows a bucket by path, selected in the tree if it is loaded
+function openBucketPath(path) {
+    var bucket = findBucketByPath(allBuckets, path);
+    if (bucket) {
+        selectBucket(bucket);
+    } else {
+        currentBucketPath = path;
+        loadBucketDetails(path);
+    }
+}
+function closeFullDataModal() {
+    var modal = document.getElementById('fullDataModal');
+    modal.style.display = 'none';
+}
+
+// Decode timestamp
+function fetchAndDecodeTime(bucketPath, keyName) {
+    if (!bucketPath || !keyName) return;
+    var url = 'api/decode/time/' + encodeURIComponent(bucketPath) + '/' + encodeURIComponent(keyName);
+    fetch(url)
+        .then(function(res){ if(!res.ok) throw new Error('HTTP '+res.status); return res.json(); })
+        .then(function(json){
+            var data = json.data || json;
+            var decodedTime = data.decodedTime || '';
+            var timestamp = data.timestamp || '';
+            var iso = data.iso || '';
+            var title = t('Decoded Time: {0}', keyName);
+            var content = t('Formatted Time: {0}', decodedTime) + '\n' +
+                          t('Unix Timestamp: {0}', timestamp) + '\n' +
+                          t('ISO Format: {0}', iso);
+            if (json.partial) {
+                content += '\n\n' + t('... (response size limit reached, showing part of {0} bytes)', data.valueSize || 0);
+            }
+            openFullDataModal(content, title);
+        })
+        .catch(function(err){
+            openFullDataModal(t('Decode failed: {0}', err.message), t('Error'));
+        });
+}
+
+// fetchAndDecode shows the result of api/decode/{kind} as JSON
+function fetchAndDecode(kind, bucketPath, keyName) {
+    if (!bucketPath || !keyName) return;
+    var url = 'api/decode/' + kind + '/' + encodeURIComponent(bucketPath) + '/' + encodeURIComponent(keyName);
+    fetch(url)
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('decode failed'));
+            openFullDataModal(JSON.stringify(json.data, null, 2), t('Decoded {0}: {1}', kind, keyName));
+        })
+        .catch(function(err){
+            openFullDataModal(t('Decode failed: {0}', err.message), t('Error'));
+        });
+}
+
+function fetchAndDecodeProtobuf(bucketPath, keyName) {
+    if (!bucketPath || !keyName) return;
+    var url = 'api/decode/protobuf/' + encodeURIComponent(bucketPath) + '/' + encodeURIComponent(keyName);
+    fetch(url)
+        .then(function(res){ if(!res.ok) throw new Error('HTTP '+res.status); return res.json(); })
+        .then(function(json){
+            var data = json.data || json;
+            var typeUrl = data.typeUrl || '';
+            var value = data.value || '';
+            var size = data.size || 0;
+            var title = t('Protobuf Decoded: {0}', keyName);
+            var content = t('Type URL: {0}', typeUrl) + '\n' +
+                         t('Size: {0} bytes', size) + '\n';
+            if (data.spec) {
+                content += '\n' + formatRuntimeSpec(data.spec);
+            } else if (data.cri) {
+                content += '\n' + formatCRIMetadata(data.cri);
+            } else if (data.message) {
+                content += '\n' + formatRuntimeOptions(data.message);
+            } else {
+                content += t('Value: {0}', value);
+            }
+            openFullDataModal(content, title);
+        })
+        .catch(function(err){
+            openFullDataModal(t('Protobuf decode failed: {0}', err.message), t('Error'));
+        });
+}
+
+// formatRuntimeSpec summarizes an OCI runtime spec above its full JSON
+function formatRuntimeSpec(spec) {
+    var lines = [];
+    var p = spec.process || {};
+    var linux = spec.linux || {};
+    var res = linux.resources || {};
+    if (p.args) lines.push('Args: ' + p.args.join(' '));
+    if (p.cwd) lines.push('Cwd: ' + p.cwd);
+    if (p.user) lines.push('User: ' + p.user.uid + ':' + p.user.gid);
+    (p.env || []).forEach(function(e){ lines.push('Env: ' + e); });
+    (spec.mounts || []).forEach(function(m){
+        lines.push('Mount: ' + (m.source || m.type || '') + ' -> ' + m.destination + (m.options ? ' (' + m.options.join(',') + ')' : ''));
+    });
+    (linux.namespaces || []).forEach(function(n){
+        lines.push('Namespace: ' + n.type + (n.path ? ' ' + n.path : ''));
+    });
+    if (linux.cgroupsPath) lines.push('Cgroup: ' + linux.cgroupsPath);
+    if (res.memory && res.memory.limit) lines.push('Memory limit: ' + res.memory.limit);
+    if (res.cpu && res.cpu.quota) lines.push('CPU quota: ' + res.cpu.quota + '/' + (res.cpu.period || 100000));
+    if (res.cpu && res.cpu.shares) lines.push('CPU shares: ' + res.cpu.shares);
+    if (res.pids) lines.push('Pids limit: ' + res.pids.limit);
+    return lines.join('\n') + '\n\n' + JSON.stringify(spec, null, 2);
+}
+
+// formatRuntimeOptions summarizes runc shim and CRI runtime options above
+// the full message
+function formatRuntimeOptions(opts) {
+    var lines = [];
+    if (opts.binary_name || opts.runtime) lines.push('Runtime binary: ' + (opts.binary_name || opts.runtime));
+    if (opts.root || opts.runtime_root) lines.push('Runtime root: ' + (opts.root || opts.runtime_root));
+    if (opts.systemd_cgroup !== undefined) lines.push('Cgroup driver: ' + (opts.systemd_cgroup ? 'systemd' : 'cgroupfs'));
+    if (opts.criu_path) lines.push('CRIU: ' + opts.criu_path);
+    if (opts.shim_cgroup) lines.push('Shim cgroup: ' + opts.shim_cgroup);
+    if (opts.config_path) lines.push('Shim config: ' + opts.config_path);
+    if (opts.type_url) lines.push('Options type: ' + opts.type_url);
+    var full = JSON.stringify(opts, null, 2);
+    return lines.length ? lines.join('\n') + '\n\n' + full : full;
+}
+
+// formatCRIMetadata summarizes CRI container or sandbox metadata above its config
+function formatCRIMetadata(md) {
+    var lines = ['CRI ' + md.kind + ' metadata ' + md.version, 'ID: ' + md.id, 'Name: ' + md.name];
+    if (md.podName) lines.push('Pod: ' + (md.podNamespace ? md.podNamespace + '/' : '') + md.podName);
+    if (md.podUid) lines.push('Pod UID: ' + md.podUid);
+    if (md.containerName) lines.push('Container: ' + md.containerName);
+    lines.push('Attempt: ' + md.attempt);
+    if (md.sandboxId) lines.push('Sandbox: ' + md.sandboxId);
+    if (md.image) lines.push('Image: ' + md.image);
+    if (md.imageRef) lines.push('Image ref: ' + md.imageRef);
+    if (md.logPath) lines.push('Log: ' + md.logPath);
+    if (md.netnsPath) lines.push('Netns: ' + md.netnsPath);
+    if (md.ip) lines.push('IP: ' + [md.ip].concat(md.additionalIps || []).join(', '));
+    if (md.runtimeHandler) lines.push('Runtime handler: ' + md.runtimeHandler);
+    var config = md.config ? '\n\nConfig:\n' + JSON.stringify(md.config, null, 2) : '';
+    return lines.join('\n') + config;
+}
+
+// Request full data based on current selected bucketPath and keyName
+function fetchAndShowFullKey(bucketPath, keyName) {
+    if (!bucketPath || !keyName) return;
+    var url = 'api/key/' + encodeURIComponent(bucketPath) + '/' + encodeURIComponent(keyName) + '?full=1';
+    fetch(url)
+        .then(function(res){ if(!res.ok) throw new Error('HTTP '+res.status); return res.json(); })
+        .then(function(json){
+            var data = json.data || json;
+            var value = data.value || data.Value;
+            var valueType = data.valueType || data.ValueType;
+            var isBinary = (data.isBinary || data.IsBinary) ? true : false;
+            var preview = data.preview || data.Preview;
+            var title = t('Key: {0} ({1})', keyName, valueType || '');
+            var content;
+            if (isBinary || (valueType && String(valueType).toLowerCase() === 'binary')) {
+                content = typeof preview === 'string' ? preview : String(value || '');
+            } else if (typeof value === 'object' && value !== null) {
+                try { content = JSON.stringify(value, null, 2); }
+                catch (e) { content = String(value); }
+            } else {
+                content = String(value);
+            }
+            openFullDataModal(content, title);
+            showDigestLinks(data.digests);
+            if (json.partial && json.cursor) {
+                showMoreChunks(url, json.cursor);
+            }
+            var link = document.createElement('a');
+            link.className = 'deep-link';
+            link.href = keyLink(bucketPath, keyName);
+            link.title = t('Link to this key');
+            link.textContent = '🔗';
+            document.querySelector('#fullDataModal .modal-title').appendChild(link);
+        })
+        .catch(function(err){
+            openFullDataModal(t('Load failed: {0}', err.message), t('Error'));
+        });
+}
+
+// showMoreChunks offers the chunks of a value after the first, each
+// appended to the full-data view as it is loaded
+function showMoreChunks(url, cursor) {
+    var nav = document.createElement('div');
+    nav.id = 'rangeNav';
+    nav.className = 'range-nav';
+    var more = document.createElement('button');
+    more.className = 'load-more-btn';
+    more.textContent = t('Load more (response size limit reached)');
+    more.onclick = function() {
+        more.disabled = true;
+        fetch(url + '&cursor=' + encodeURIComponent(cursor))
+            .then(function(res){ if(!res.ok) throw new Error('HTTP '+res.status); return res.json(); })
+            .then(function(json){
+                var data = json.data || {};
+                document.getElementById('fullDataContent').textContent += data.isBinary ? '\n' + data.preview.replace(/^Hexadecimal preview:\n/, '') : data.value;
+                cursor = json.partial ? json.cursor : '';
+                more.disabled = !cursor;
+            })
+            .catch(function(err){
+                more.textContent = t('Load failed: {0}', err.message);
+            });
+    };
+    nav.appendChild(more);
+    var pre = document.getElementById('fullDataContent');
+    pre.parentNode.appendChild(nav);
+}
+
+// Values larger than valueRangeThreshold bytes are shown valueRangePage
+// bytes at a time, fetched with Range requests from the download endpoint
+var valueRangeThreshold = 1024 * 1024;
+var valueRangePage = 64 * 1024;
+
+// showValueRange shows the page of a large value starting at offset, with
+// buttons to the previous and next pages
+function showValueRange(bucketPath, keyName, offset, size) {
+    var url = 'api/download/' + encodeURIComponent(bucketPath) + '/' + encodeURIComponent(keyName);
+    var end = Math.min(offset + valueRangePage, size) - 1;
+    fetch(url, { headers: { 'Range': 'bytes=' + offset + '-' + end } })
+        .then(function(res) {
+            if (res.status !== 206 && !res.ok) throw new Error('HTTP ' + res.status);
+            // The value may have changed size since the key list was loaded
+            var range = /\/(\d+)$/.exec(res.headers.get('Content-Range') || '');
+            if (range) size = parseInt(range[1], 10);
+            return res.arrayBuffer();
+        })
+        .then(function(buf) {
+            var bytes = new Uint8Array(buf);
+            if (bytes.length > valueRangePage) {
+                // Served whole, the server ignored the range
+                bytes = bytes.subarray(offset, offset + valueRangePage);
+            }
+            var content = rangeText(bytes, offset);
+            openFullDataModal(content, t('Key: {0} ({1})', keyName, t('bytes {0}-{1} of {2}', offset, offset + bytes.length - 1, size)));
+            var nav = document.createElement('div');
+            nav.id = 'rangeNav';
+            nav.className = 'range-nav';
+            var prev = document.createElement('button');
+            prev.textContent = t('Previous');
+            prev.disabled = offset === 0;
+            prev.onclick = function() { showValueRange(bucketPath, keyName, Math.max(0, offset - valueRangePage), size); };
+            var next = document.createElement('button');
+            next.textContent = t('Next');
+            next.disabled = offset + bytes.length >= size;
+            next.onclick = function() { showValueRange(bucketPath, keyName, offset + bytes.length, size); };
+            nav.appendChild(prev);
+            nav.appendChild(next);
+            var pre = document.getElementById('fullDataContent');
+            pre.parentNode.insertBefore(nav, pre);
+        })
+        .catch(function(err) {
+            openFullDataModal(t('Load failed: {0}', err.message), t('Error'));
+        });
+}
+
+// rangeText the bytes of a page as text, a hex dump like the server's if
+// they are not UTF-8; a character split at the page boundary is dumped too
+function rangeText(bytes, offset) {
+    try {
+        return new TextDecoder('utf-8', { fatal: true }).decode(bytes);
+    } catch (e) {
+        return hexDumpBytes(bytes, offset);
+    }
+}
+
+// hexDumpBytes formats 16 bytes per line with their offset and ASCII
+function hexDumpBytes(bytes, base) {
+    var lines = [];
+    for (var i = 0; i < bytes.length; i += 16) {
+        var hex = '', ascii = '';
+        for (var j = i; j < i + 16; j++) {
+            if (j < bytes.length) {
+                hex += ('0' + bytes[j].toString(16)).slice(-2) + ' ';
+                ascii += bytes[j] >= 32 && bytes[j] <= 126 ? String.fromCharCode(bytes[j]) : '.';
+            } else {
+                hex += '   ';
+            }
+        }
+        var addr = (base + i).toString(16);
+        while (addr.length < 4) addr = '0' + addr;
+        lines.push(addr + ': ' + hex + ' |' + ascii + '|');
+    }
+    return lines.join('\n');
+}
+
+// Page inspector: decode a raw bolt page like `bbolt page`
+var lastPageId = '0';
+function inspectPage(id) {
+    if (id === undefined) {
+        id = prompt(t('Page id'), lastPageId);
+        if (id === null) return;
+    }
+    id = String(id).trim();
+    if (!/^[0-9]+$/.test(id)) {
+        openFullDataModal(t('Invalid page id: {0}', id), t('Error'));
+        return;
+    }
+    lastPageId = id;
+    fetch('api/pages/' + id + '?hex=1')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('request failed'));
+            openFullDataModal(formatPage(json.data), t('Page {0} ({1})', id, json.data.type));
+        })
+        .catch(function(err){
+            openFullDataModal(t('Page inspection failed: {0}', err.message), t('Error'));
+        });
+}
+
+function formatPage(p) {
+    var lines = [
+        'Page ID:    ' + p.id,
+        'Page Type:  ' + p.type + (p.free ? ' (free)' : ''),
+        'Flags:      0x' + p.flags.toString(16),
+        'Count:      ' + p.count,
+        'Overflow:   ' + p.overflow,
+        'Total Size: ' + (p.pageSize * (p.overflow + 1)) + ' bytes'
+    ];
+    if (p.meta) {
+        var m = p.meta;
+        lines.push('', 'Magic:      0x' + m.magic.toString(16), 'Version:    ' + m.version,
+            'Page Size:  ' + m.pageSize, 'Root:       <pgid=' + m.root + '>',
+            'Freelist:   <pgid=' + m.freelist + '>', 'HWM:        <pgid=' + m.highWater + '>',
+            'Txn ID:     ' + m.txid, 'Checksum:   ' + m.checksum + (m.checksumValid ? ' (valid)' : ' (INVALID)'));
+    }
+    (p.elements || []).forEach(function(el) {
+        if (p.type === 'branch') {
+            lines.push('[' + el.index + '] key=' + el.key + ' -> <pgid=' + el.child + '>');
+        } else {
+            lines.push('[' + el.index + '] ' + (el.bucket ? 'bucket ' : '') + 'key=' + el.key +
+                ' (' + el.keySize + 'B) value=' + (el.value || '') + ' (' + el.valueSize + 'B)');
+        }
+    });
+    if (p.freelist) {
+        lines.push('', 'Free pages: ' + p.freelist.join(', '));
+    }
+    if (p.truncated) {
+        lines.push('... (truncated)');
+    }
+    if (p.problems) {
+        lines.push('', 'Problems:');
+        p.problems.forEach(function(problem) { lines.push('  ' + problem); });
+    }
+    if (p.hex) {
+        lines.push('', p.hex);
+    }
+    return lines.join('\n');
+}
+
+// UI preferences of the user or browser session, stored by the server so
+// they survive browser changes; see savePreferences
+var preferences = {};
+var preferencesEnabled = false;
+var savePreferencesTimer = null;
+
+// loadPreferences applies the saved preferences before the tree is loaded,
+// it never fails so startup goes on without them
+function loadPreferences() {
+    return fetch('api/preferences')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('request failed'));
+            preferences = json.data || {};
+            if (preferences.sidebarWidth) {
+                document.getElementById('sidebar').style.width = preferences.sidebarWidth + 'px';
+            }
+            (preferences.expandedBuckets || []).forEach(function(path) {
+                expandedBuckets.add(path);
+            });
+            if (preferences.namespace) {
+                currentNamespace = preferences.namespace;
+            }
+        })
+        .catch(function(err){
+            console.log('Preferences unavailable:', err);
+        });
+}
+
+// savePreferences stores the current preferences shortly after the last
+// change, e.g. once a splitter drag or several tree toggles are over
+function savePreferences() {
+    if (!preferencesEnabled) return;
+    clearTimeout(savePreferencesTimer);
+    savePreferencesTimer = setTimeout(function() {
+        preferences.expandedBuckets = Array.from(expandedBuckets);
+        preferences.namespace = currentNamespace || undefined;
+        fetch('api/preferences', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(preferences)
+        })
+            .then(function(res){ return res.json(); })
+            .then(function(json){
+                if (!json.success) throw new Error(json.error || t('request failed'));
+            })
+            .catch(function(err){
+                console.log('Failed to save preferences:', err);
+            });
+    }, 500);
+}
+
+// Recently viewed buckets and keys of this browser session, kept by the
+// server and reloaded whenever the menu is opened
+var recentEntries = [];
+
+function loadHistory() {
+    fetch('api/history')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('request failed'));
+            recentEntries = json.data || [];
+            var select = document.getElementById('historySelect');
+            select.innerHTML = '<option value="">↶ ' + t('Recent') + '</option>' +
+                recentEntries.map(function(e, i) {
+                    var label = e.key ? e.bucket + ' : ' + e.key : e.bucket;
+                    return '<option value="' + i + '">' + escapeHTML(label) + '</option>';
+                }).join('');
+        })
+        .catch(function(err){
+            console.log('History unavailable:', err);
+        });
+}
+
+// Bookmarks of buckets and keys, stored by the server
+var bookmarksEnabled = false;
+var bookmarks = [];
+
+function loadBookmarks() {
+    fetch('api/bookmarks')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('request failed'));
+            bookmarks = json.data || [];
+            renderBookmarks();
+        })
+        .catch(function(err){
+            console.log('Bookmarks unavailable:', err);
+        });
+}
+
+function renderBookmarks() {
+    var select = document.getElementById('bookmarkSelect');
+    select.innerHTML = '<option value="">★ ' + t('Bookmarks ({0})', bookmarks.length) + '</option>' +
+        bookmarks.map(function(b, i) {
+            var label = b.name || (b.key ? b.bucket + ' : ' + b.key : b.bucket);
+            return '<option value="' + i + '">' + escapeHTML(label) + '</option>';
+        }).join('');
+    select.style.display = '';
+    var btn = document.getElementById('bookmarkBtn');
+    if (btn) {
+        btn.textContent = findBookmark(currentBucketPath) ? '★ ' + t('Bookmarked') : '☆ ' + t('Bookmark');
+    }
+}
+
+// findBookmark returns the bookmark of a bucket, not of one of its keys
+function findBookmark(bucketPath) {
+    for (var i = 0; i < bookmarks.length; i++) {
+        if (bookmarks[i].bucket === bucketPath && !bookmarks[i].key) return bookmarks[i];
+    }
+    return null;
+}
+
+// toggleBookmark bookmarks the current bucket or removes its bookmark
+function toggleBookmark() {
+    var existing = findBookmark(currentBucketPath);
+    var request = existing ?
+        fetch('api/bookmarks/' + existing.id, { method: 'DELETE' }) :
+        fetch('api/bookmarks', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ bucket: currentBucketPath })
+        });
+    request
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('request failed'));
+            loadBookmarks();
+        })
+        .catch(function(err){
+            alert(t('Bookmark failed: {0}', err.message));
+        });
+}
+
+// openBookmark shows the bucket of a bookmark and the value of its key
+function openBookmark(b) {
+    openBucketPath(b.bucket);
+    if (b.key) {
+        fetchAndShowFullKey(b.bucket, b.key);
+    }
+}
+
+// Frontend mode: API requests carry the selected node, the frontend
+// proxies them to that node's agent
+var currentNode = '';
+var fetchDirect = window.fetch.bind(window);
+window.fetch = function(url, options) {
+    if (typeof url === 'string' && url.indexOf('api/') === 0) {
+        options = options || {};
+        var headers = new Headers(options.headers || {});
+        if (currentNode) {
+            headers.set('X-Boltdbui-Node', currentNode);
+        }
+        // API errors in the locale of the page, which ?lang= may override
+        headers.set('Accept-Language', document.documentElement.lang);
+        options.headers = headers;
+    }
+    return fetchDirect(url, options);
+};
+
+// Select the node of the previous visit, or the first one
+function loadNodes() {
+    return fetchDirect('api/nodes')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            var nodes = (json.success && json.data) || [];
+            if (!nodes.length) return;
+            var select = document.getElementById('nodeSelect');
+            var saved = localStorage.getItem('boltdbui.node');
+            nodes.forEach(function(n) {
+                var option = document.createElement('option');
+                option.value = option.textContent = n.name;
+                select.appendChild(option);
+                if (n.name === saved) currentNode = saved;
+            });
+            currentNode = currentNode || nodes[0].name;
+            select.value = currentNode;
+            select.style.display = '';
+            select.addEventListener('change', function() {
+                localStorage.setItem('boltdbui.node', select.value);
+                window.location.reload();
+            });
+        })
+        .catch(function(err){
+            console.log('Nodes unavailable:', err);
+        });
+}
+
+// containerd namespaces: scope the bucket tree to one of them
+function loadNamespaces() {
+    fetch('api/namespaces')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success || !json.data.length) return;
+            var select = document.getElementById('namespaceSelect');
+            json.data.forEach(function(ns) {
+                var option = document.createElement('option');
+                option.value = ns.name;
+                option.textContent = t('{0} ({1} images, {2} containers)', ns.name, ns.images, ns.containers);
+                select.appendChild(option);
+            });
+            select.value = currentNamespace;
+            if (select.value !== currentNamespace) {
+                // The saved namespace is gone, show all of them
+                currentNamespace = '';
+                loadBuckets();
+            }
+            select.style.display = '';
+            select.addEventListener('change', function() {
+                currentNamespace = select.value;
+                savePreferences();
+                loadBuckets();
+            });
+        })
+        .catch(function(err){
+            console.log('Namespaces unavailable:', err);
+        });
+}
+
+// Show the views of the detected database kind
+function loadCapabilities() {
+    fetch('api/capabilities')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            var features = (json.success && json.data.features) || {};
+            if (features.etcd) {
+                document.getElementById('etcdKeysBtn').style.display = '';
+            }
+            if (features.upload) {
+                document.getElementById('uploadBtn').style.display = '';
+            }
+            if (features.discover) {
+                loadDatabases();
+            }
+            if (features.reload) {
+                document.getElementById('reloadBtn').style.display = '';
+            }
+            if (features.history) {
+                document.getElementById('historySelect').style.display = '';
+            }
+            preferencesEnabled = !!features.preferences;
+            if (features.bookmarks) {
+                bookmarksEnabled = true;
+                loadBookmarks();
+            }
+            if (features.dockerNetwork || features.dockerVolumes) {
+                var btn = document.getElementById('dockerBtn');
+                btn.setAttribute('data-kind', features.dockerNetwork ? 'networks' : 'volumes');
+                btn.style.display = '';
+            }
+        })
+        .catch(function(err){
+            console.log('Capabilities unavailable:', err);
+        });
+}
+
+// etcd view: the latest revision of every live key below a prefix
+var etcdPrefix = '';
+function loadEtcdKeys(prefix, cursor, loaded) {
+    etcdPrefix = prefix;
+    var url = 'api/etcd/keys?prefix=' + encodeURIComponent(prefix) +
+        (cursor ? '&cursor=' + encodeURIComponent(cursor) : '');
+    fetch(url)
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('request failed'));
+            renderEtcdKeys((loaded || []).concat(json.data || []), json.partial ? json.cursor : '');
+        })
+        .catch(function(err){
+            showError(t('Failed to load etcd keys: {0}', escapeHTML(err.message)));
+        });
+}
+
+function renderEtcdKeys(keys, nextCursor) {
+    var items = keys.map(function(kv) {
+        return '<div class="key-item">' +
+                '<div class="key-header">' +
+                    '<span class="key-name">' + escapeHTML(kv.key) + '</span>' +
+                    '<span class="key-type">' + kv.valueType + '</span>' +
+                    '<span class="key-size">' + t('{0} bytes', kv.valueSize) + '</span>' +
+                    '<span class="key-size">' + t('rev {0}, version {1}', kv.modRevision, kv.version) +
+                        (kv.lease ? ', ' + t('lease {0}', kv.lease) : '') + '</span>' +
+                '</div>' +
+                '<div class="key-preview">' + escapeHTML(kv.preview) + '</div>' +
+            '</div>';
+    }).join('');
+
+    document.getElementById('mainContent').innerHTML =
+        '<div class="content-header">' +
+            '<div class="content-title">' + t('etcd keys') + '</div>' +
+            '<div class="content-subtitle">' + t('Latest revision of live keys') + '</div>' +
+        '</div>' +
+        '<div class="content-body">' +
+            '<input type="text" class="search-input" id="etcdPrefixInput" placeholder="' + t('Key prefix, e.g. /registry/pods/') + '" value="' + escapeHTML(etcdPrefix) + '">' +
+            '<div class="keys-section">' +
+                '<h3>' + t('Keys ({0})', keys.length + (nextCursor ? '+' : '')) + '</h3>' +
+                (items || '<div class="empty-state">' + t('No keys below this prefix') + '</div>') +
+                (nextCursor ? '<button class="load-more-btn" id="loadMoreEtcdKeys">' + t('Load more (response size limit reached)') + '</button>' : '') +
+            '</div>' +
+        '</div>';
+
+    document.getElementById('etcdPrefixInput').addEventListener('keydown', function(e) {
+        if (e.key === 'Enter') loadEtcdKeys(e.target.value.trim());
+    });
+    var loadMore = document.getElementById('loadMoreEtcdKeys');
+    if (loadMore) {
+        loadMore.addEventListener('click', function() {
+            loadMore.disabled = true;
+            loadEtcdKeys(etcdPrefix, nextCursor, keys);
+        });
+    }
+}
+
+// Docker view: networks of local-kv.db or volumes of metadata.db
+function showDocker(kind) {
+    fetch('api/docker/' + kind)
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || t('request failed'));
+            var text = kind === 'networks' ? formatDockerNetworks(json.data) : formatDockerVolumes(json.data);
+            openFullDataModal(text, t('Docker {0}', kind));
+        })
+        .catch(function(err){
+            openFullDataModal(t('Docker {0} failed: {1}', kind, err.message), t('Error'));
+        });
+}
+
+function formatDockerNetworks(report) {
+    var lines = [];
+    report.networks.forEach(function(n) {
+        lines.push(n.name + ' (' + n.driver + (n.scope ? ', ' + n.scope : '') + ') ' + n.id);
+        n.endpoints.forEach(function(e) {
+            lines.push('  ' + e.name + ' ' + (e.address || '-') + ' ' + (e.mac || '') + (e.sandbox ? ' sandbox=' + e.sandbox : ''));
+        });
+    });
+    if (report.orphaned.length) {
+        lines.push('', t('Endpoints of removed networks:'));
+        report.orphaned.forEach(function(e) { lines.push('  ' + e.name + ' ' + e.id); });
+    }
+    var other = Object.keys(report.other);
+    if (other.length) {
+        lines.push('', t('Other objects: {0}', other.map(function(k) { return k + '=' + report.other[k]; }).join(', ')));
+    }
+    return lines.join('\n') || t('No networks');
+}
+
+function formatDockerVolumes(volumes) {
+    return volumes.map(function(v) {
+        var line = v.name + ' (' + v.driver + ')';
+        if (v.options) line += ' options=' + JSON.stringify(v.options);
+        if (v.labels) line += ' labels=' + JSON.stringify(v.labels);
+        return line;
+    }).join('\n') || t('No volumes');
+}
+
+// List the discovered databases, choosing one opens its page
+function loadDatabases() {
+    fetch('api/databases')
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success || json.data.length < 2) return;
+            var select = document.getElementById('databaseSelect');
+            select.innerHTML = '';
+            json.data.forEach(function(db) {
+                var option = document.createElement('option');
+                option.value = db.url;
+                option.textContent = (db.kind ? db.kind + ': ' : '') + db.name;
+                select.appendChild(option);
+            });
+            select.style.display = '';
+            select.addEventListener('change', function() {
+                window.location.href = select.value;
+            });
+        })
+        .catch(function(err){
+            console.log('Databases unavailable:', err);
+        });
+}
+
+// Upload a database and open it, the server serves it below its own URL
+function uploadDatabase(file) {
+    var form = new FormData();
+    form.append('file', file);
+    var btn = document.getElementById('uploadBtn');
+    btn.disabled = true;
+    btn.textContent = t('Uploading...');
+    fetch('api/databases/upload', { method: 'POST', body: form })
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || json.message || t('upload failed'));
+            window.location.href = json.data.url;
+        })
+        .catch(function(err){
+            openFullDataModal(t('Upload of {0} failed: {1}', file.name, err.message), t('Error'));
+        })
+        .finally(function(){
+            btn.disabled = false;
+            btn.textContent = t('Upload');
+        });
+}
+
+// Reopen the database on the server, e.g. after containerd replaced the file
+function reloadDatabase() {
+    var btn = document.getElementById('reloadBtn');
+    btn.disabled = true;
+    fetch('api/reload', { method: 'POST' })
+        .then(function(res){ return res.json(); })
+        .then(function(json){
+            if (!json.success) throw new Error(json.error || json.message || t('reload failed'));
+            refreshStaleData();
+        })
+        .catch(function(err){
+            openFullDataModal(t('Reload failed: {0}', err.message), t('Error'));
+        })
+        .finally(function(){
+            btn.disabled = false;
+        });
+}
+
+// Filter buckets
+function filterBuckets(query) {
+    var filteredBuckets = allBuckets.filter(function(bucket) {
+        return bucket.name.toLowerCase().indexOf(query.toLowerCase()) !== -1;
+    });
+    renderBuckets(filteredBuckets, query);
+}
+
+// Show error
+function showError(message) {
+    var mainContent = document.getElementById('mainContent');
+    mainContent.innerHTML = 
+        '<div class="content-header">' +
+            '<div class="content-title">' + t('Error') + '</div>' +
+            '<div class="content-subtitle">' + t('An error occurred while loading') + '</div>' +
+        '</div>' +
+        '<div class="content-body">' +
+            '<div class="error-message">' + message + '</div>' +
+        '</div>';
+}
+
+// Hold a WebSocket open for the lifetime of the page so the server
+// knows when the browser session ends (--once)
+var sessionSocket = null;
+function connectSession() {
+    // Relative to the page so the viewer works below a path prefix
+    var url = new URL('api/ws', document.baseURI); // deep links set <base>
+    url.protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    if (currentNode) {
+        url.searchParams.set('node', currentNode);
+    }
+    try {
+        sessionSocket = new WebSocket(url.href);
+    } catch (e) {
+        console.log('WebSocket unavailable:', e);
+        return;
+    }
+    sessionSocket.onmessage = function(e) {
+        var msg;
+        try {
+            msg = JSON.parse(e.data);
+        } catch (err) {
+            return;
+        }
+        if (msg.type === 'dbChanged') {
+            console.log('Database changed:', msg);
+            showStaleBanner(msg);
+        } else if (msg.type === 'searchResults' || msg.type === 'searchDone') {
+            onSearchMessage(msg);
+        }
+    };
+}
+
+// Key search: over the WebSocket the results show up as the server walks
+// the database, without it /api/search returns the first 100 at once
+var keySearch = null;
+var keySearchCount = 0;
+function searchAllKeys(query) {
+    if (!query) return;
+    stopKeySearch();
+    keySearch = { id: String(++keySearchCount), query: query, results: [], scanned: 0, done: null };
+    renderKeySearch();
+    if (sessionSocket && sessionSocket.readyState === WebSocket.OPEN) {
+        sessionSocket.send(JSON.stringify({ type: 'search', id: keySearch.id, query: query, namespace: currentNamespace || undefined }));
+        return;
+    }
+    var search = keySearch;
+    var url = 'api/search?q=' + encodeURIComponent(query) +
+        (currentNamespace ? '&namespace=' + encodeURIComponent(currentNamespace) : '');
+    fetch(url)
+        .then(function(res){ return res.json(); })
+        .then(function(result) {
+            if (search !== keySearch) return;
+            if (!result.success) throw new Error(result.error);
+            search.results = result.data || [];
+            var meta = result.meta || {};
+            search.done = { total: search.results.length, truncated: meta.truncated !== undefined ? meta.truncated : !!result.cursor || search.results.length >= 100 };
+            renderKeySearch();
+        })
+        .catch(function(err) {
+            if (search !== keySearch) return;
+            search.done = { error: err.message };
+            renderKeySearch();
+        });
+}
+
+function stopKeySearch() {
+    if (keySearch && !keySearch.done && sessionSocket && sessionSocket.readyState === WebSocket.OPEN) {
+        sessionSocket.send(JSON.stringify({ type: 'cancel', id: keySearch.id }));
+    }
+}
+
+function onSearchMessage(msg) {
+    if (!keySearch || msg.id !== keySearch.id) return;
+    if (msg.type === 'searchResults') {
+        keySearch.results = keySearch.results.concat(msg.results || []);
+        keySearch.scanned = msg.scanned;
+    } else {
+        keySearch.scanned = msg.scanned;
+        keySearch.done = msg;
+    }
+    renderKeySearch();
+}
+
+function renderKeySearch() {
+    var search = keySearch;
+    var status;
+    if (!search.done) {
+        status = t('{0} matches, {1} keys scanned...', search.results.length, search.scanned);
+    } else if (search.done.error) {
+        status = t('Search failed: {0}', search.done.error);
+    } else if (search.done.durationMs !== undefined) {
+        status = t('{0} matches of {1} keys in {2} ms', search.done.total, search.done.scanned, Math.round(search.done.durationMs));
+    } else {
+        status = t('{0} matches', search.done.total);
+    }
+    if (search.done && search.done.truncated) {
+        status += ' ' + t('Showing the first {0} matches', search.results.length);
+    }
+
+    var items = search.results.map(function(r, i) {
+        return '<div class="key-item search-result" data-index="' + i + '">' +
+                '<div class="key-header">' +
+                    '<span class="key-name">' + escapeHTML(r.key) + '</span>' +
+                    '<span class="key-type">' + r.type + '</span>' +
+                    '<span class="key-size">' + t('{0} bytes', r.size) + '</span>' +
+                '</div>' +
+                '<div class="key-preview">' + escapeHTML(r.bucket) + '</div>' +
+                '<div class="key-preview">' + escapeHTML(r.preview) + '</div>' +
+            '</div>';
+    }).join('');
+
+    var mainContent = document.getElementById('mainContent');
+    mainContent.innerHTML =
+        '<div class="content-header">' +
+            '<div class="content-title">' + t('Search results for {0}', escapeHTML(search.query)) + '</div>' +
+            '<div class="content-subtitle">' + escapeHTML(status) + '</div>' +
+        '</div>' +
+        '<div class="content-body">' +
+            (search.done ? '' : '<button class="load-more-btn" id="stopKeySearch">' + t('Stop') + '</button>') +
+            '<div class="keys-section">' +
+                (items || (search.done ? '<div class="empty-state">' + t('No keys match') + '</div>' : '')) +
+            '</div>' +
+        '</div>';
+
+    var stop = document.getElementById('stopKeySearch');
+    if (stop) {
+        stop.addEventListener('click', function() {
+            stop.disabled = true;
+            stopKeySearch();
+        });
+    }
+    mainContent.querySelectorAll('.search-result').forEach(function(item) {
+        item.addEventListener('click', function() {
+            var r = search.results[Number(item.getAttribute('data-index'))];
+            openBookmark({ bucket: r.bucket, key: r.key });
+        });
+    });
+}
+
+// Tell the user the page shows data from before the database changed on disk
+function showStaleBanner(msg) {
+    var banner = document.getElementById('staleBanner');
+    banner.title = t('Modified {0}, {1} bytes', new Date(msg.modTime).toLocaleString(), msg.size);
+    banner.style.display = '';
+}
+
+// Reload the bucket tree and the selected bucket
+function refreshStaleData() {
+    document.getElementById('staleBanner').style.display = 'none';
+    loadBuckets();
+    if (currentBucketPath) {
+        loadBucketDetails(currentBucketPath);
+    }
+}
+
+// Initialize
+document.addEventListener('DOMContentLoaded', function() {
+    initializeResizer();
+    loadNodes().then(loadPreferences).then(function() {
+        loadBuckets();
+        loadNamespaces();
+        loadCapabilities();
+        connectSession();
+    });
+
+    var historySelect = document.getElementById('historySelect');
+    historySelect.addEventListener('focus', loadHistory);
+    historySelect.addEventListener('change', function(e) {
+        var entry = recentEntries[e.target.value];
+        e.target.value = '';
+        e.target.blur(); // reload the list when it is opened next
+        if (entry) openBookmark(entry);
+    });
+
+    document.getElementById('bookmarkSelect').addEventListener('change', function(e) {
+        var b = bookmarks[e.target.value];
+        e.target.value = '';
+        if (b) openBookmark(b);
+    });
+
+    document.getElementById('staleRefreshBtn').addEventListener('click', refreshStaleData);
+    document.getElementById('staleDismissBtn').addEventListener('click', function() {
+        document.getElementById('staleBanner').style.display = 'none';
+    });
+
+    document.getElementById('uploadInput').addEventListener('change', function(e) {
+        if (e.target.files.length) {
+            uploadDatabase(e.target.files[0]);
+            e.target.value = '';
+        }
+    });
+
+    var searchInput = document.getElementById('searchInput');
+    searchInput.addEventListener('input', function(e) {
+        renderBuckets(allBuckets, e.target.value);
+    });
+    searchInput.addEventListener('keydown', function(e) {
+        if (e.key === 'Enter') searchAllKeys(e.target.value.trim());
+    });
+
+    document.getElementById('treeContainer').addEventListener('click', function(e) {
+        console.log('Clicked on:', e.target);
+        var item = e.target.closest('.tree-item');
+        console.log('Found item:', item);
+        if (!item) {
+            return;
+        }
+
+        var path = item.getAttribute('data-path');
+        console.log('Item path:', path);
+        var bucket = findBucketByPath(allBuckets, path);
+        console.log('Found bucket:', bucket);
+
+        if (!bucket) {
+            return;
+        }
+
+        if (e.target.classList.contains('tree-toggle')) {
+            console.log('Toggle clicked');
+            var subBucketsContainer = item.nextElementSibling;
+            if (subBucketsContainer && subBucketsContainer.classList.contains('sub-buckets-container')) {
+                var isExpanded = item.classList.toggle('expanded');
+                subBucketsContainer.style.display = isExpanded ? 'block' : 'none';
+                bucket.isExpanded = isExpanded;
+                if (isExpanded) {
+                    expandedBuckets.add(bucket.path);
+                    fillBucketCounts();
+                } else {
+                    expandedBuckets.delete(bucket.path);
+                }
+                savePreferences();
+            }
+        } else {
+            console.log('Content clicked');
+            selectBucket(bucket, item);
+        }
+    });
+
+    // Global delegation: handle "View Full" buttons and modal close
+    document.addEventListener('click', function(e) {
+        // Close button
+        if (e.target.id === 'closeFullDataModal' || e.target.closest('#closeFullDataModal')) {
+            closeFullDataModal();
+            return;
+        }
+        if (e.target.id === 'etcdKeysBtn') {
+            loadEtcdKeys(etcdPrefix);
+            return;
+        }
+        if (e.target.id === 'uploadBtn') {
+            document.getElementById('uploadInput').click();
+            return;
+        }
+        if (e.target.id === 'reloadBtn') {
+            reloadDatabase();
+            return;
+        }
+        if (e.target.id === 'dockerBtn') {
+            showDocker(e.target.getAttribute('data-kind'));
+            return;
+        }
+        if (e.target.id === 'pageInspectorBtn') {
+            inspectPage();
+            return;
+        }
+        // Click overlay to close
+        if (e.target.id === 'fullDataModal') {
+            closeFullDataModal();
+            return;
+        }
+        // Links to buckets, e.g. the content blob of a digest
+        var bucketLink = e.target.closest('.bucket-link');
+        if (bucketLink) {
+            e.preventDefault();
+            openBucketPath(bucketLink.getAttribute('data-bucket-path'));
+            return;
+        }
+        // View full button
+        var btn = e.target.closest('.view-full-btn');
+        if (btn) {
+            var keyName = btn.getAttribute('data-key-name');
+            var rangeSize = parseInt(btn.getAttribute('data-value-size') || '0', 10);
+            if (rangeSize > 0) {
+                showValueRange(currentBucketPath, keyName, 0, rangeSize);
+            } else {
+                fetchAndShowFullKey(currentBucketPath, keyName);
+            }
+        }
+        // Decode button
+        var decodeBtn = e.target.closest('.decode-btn');
+        if (decodeBtn) {
+            var keyName = decodeBtn.getAttribute('data-key-name');
+            var decodeType = decodeBtn.getAttribute('data-decode-type');
+            if (decodeType === 'time') {
+                fetchAndDecodeTime(currentBucketPath, keyName);
+            } else if (decodeType === 'protobuf') {
+                fetchAndDecodeProtobuf(currentBucketPath, keyName);
+            } else {
+                fetchAndDecode(decodeType, currentBucketPath, keyName);
+            }
+        }
+    });
+
+    document.addEventListener('keydown', function(e) {
+        if (e.ctrlKey || e.metaKey) {
+            switch(e.key) {
+                case 'f':
+                    e.preventDefault();
+                    searchInput.focus();
+                    break;
+                case 'r':
+                    e.preventDefault();
+                    loadBuckets();
+                    break;
+            }
+        }
+    });
+});
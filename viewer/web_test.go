@@ -0,0 +1,105 @@
+package viewer
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+)
+
+func TestEmbeddedFrontend(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	status, page := s.Do(http.MethodGet, "/", nil)
+	if status != http.StatusOK || !strings.Contains(string(page), `<script src="static/app.js">`) {
+		t.Fatalf("index: status %d: %s", status, page)
+	}
+	for _, asset := range []string{"/static/app.js", "/static/app.css"} {
+		if status, body := s.Do(http.MethodGet, asset, nil); status != http.StatusOK || len(body) == 0 {
+			t.Errorf("%s: status %d, %d bytes", asset, status, len(body))
+		}
+	}
+}
+
+func TestDeepLinks(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/b/misc%2Fnested", `<base href="../"`},
+		{"/b/misc/nested", `<base href="../../"`},
+		{"/k/misc%2Fnested/key", `data-bucket="misc/nested" data-key="key"`},
+		{"/k/misc/nested/a%20%22key%22", `data-key="a &#34;key&#34;"`},
+	} {
+		status, page := s.Do(http.MethodGet, tc.path, nil)
+		if status != http.StatusOK || !strings.Contains(string(page), tc.want) {
+			t.Errorf("%s: status %d, want %s in:\n%s", tc.path, status, tc.want, page)
+		}
+	}
+	if _, page := s.Do(http.MethodGet, "/", nil); strings.Contains(string(page), "<base") {
+		t.Errorf("index has a <base>")
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	if _, err := parseBasePath("/a?b"); err == nil {
+		t.Error("base path with a query accepted")
+	}
+	base, err := parseBasePath("boltdbui/")
+	if err != nil || base != "/boltdbui" {
+		t.Fatalf("base path %q: %v", base, err)
+	}
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) { c.basePath = base })
+
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/boltdbui/", `<base href="/boltdbui/"`},
+		{"/boltdbui/b/misc/nested", `<base href="/boltdbui/"`},
+		{"/boltdbui/api/buckets", `"misc"`},
+		{"/boltdbui/static/app.js", "function"},
+	} {
+		status, body := s.Do(http.MethodGet, tc.path, nil)
+		if status != http.StatusOK || !strings.Contains(string(body), tc.want) {
+			t.Errorf("%s: status %d, want %s", tc.path, status, tc.want)
+		}
+	}
+	if status, _ := s.Do(http.MethodGet, "/api/buckets", nil); status != http.StatusNotFound {
+		t.Errorf("outside the base path: status %d, want 404", status)
+	}
+
+	client := s.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(s.URL + "/boltdbui?lang=zh-CN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusMovedPermanently || loc != "/boltdbui/?lang=zh-CN" {
+		t.Errorf("base path: status %d, Location %q", resp.StatusCode, loc)
+	}
+}
+
+func TestStaticDirOverride(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "static"), 0755)
+	os.WriteFile(filepath.Join(dir, "static", "app.css"), []byte("body { color: red; }"), 0644)
+
+	s := newTestServer(t, boltdbtest.Tiny(t), func(c *Viewer) {
+		c.staticDir = dir
+	})
+
+	if _, css := s.Do(http.MethodGet, "/static/app.css", nil); string(css) != "body { color: red; }" {
+		t.Errorf("app.css = %q, want the override", css)
+	}
+	if status, _ := s.Do(http.MethodGet, "/static/app.js", nil); status != http.StatusOK {
+		t.Errorf("app.js: status %d, want the embedded file", status)
+	}
+	if status, _ := s.Do(http.MethodGet, "/", nil); status != http.StatusOK {
+		t.Errorf("index: status %d, want the embedded template", status)
+	}
+}
@@ -0,0 +1,202 @@
+// wssearch.go - key searches over the page's WebSocket, results streamed in
+// batches as the walk finds them instead of after it
+package viewer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Result limits of WebSocket searches; unlike /api/search nothing is
+// collected, so the default is well above its 100
+const (
+	wsSearchDefaultLimit = 1000
+	wsSearchMaxLimit     = 100000
+)
+
+// wsSearchBatch results are sent once this many are pending, or
+// wsSearchFlushInterval after the previous batch
+const (
+	wsSearchBatch         = 50
+	wsSearchFlushInterval = 100 * time.Millisecond
+)
+
+// WSRequest a message of the client on /api/ws
+type WSRequest struct {
+	// Type "search" starts a search, cancelling the running one, "cancel"
+	// stops it
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Query     string `json:"query,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Limit the number of results, 1000 if 0
+	Limit int `json:"limit,omitempty"`
+}
+
+// WSSearchResults a batch of results of the search id, sent as type
+// "searchResults"
+type WSSearchResults struct {
+	Type    string                   `json:"type"`
+	ID      string                   `json:"id"`
+	Results []map[string]interface{} `json:"results"`
+	// Scanned the keys and sub-buckets visited so far
+	Scanned int `json:"scanned"`
+}
+
+// WSSearchDone the last message of the search id, sent as type "searchDone"
+type WSSearchDone struct {
+	Type       string  `json:"type"`
+	ID         string  `json:"id"`
+	Total      int     `json:"total"`
+	Scanned    int     `json:"scanned"`
+	Truncated  bool    `json:"truncated"`
+	Cancelled  bool    `json:"cancelled"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// wsWriter serializes the writes of the connection's loop and its searches,
+// gorilla/websocket supports one concurrent writer
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *wsWriter) writeJSON(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn.WriteJSON(v)
+}
+
+// wsSearches the search running on a connection; only the connection's
+// reader starts and cancels them
+type wsSearches struct {
+	out     *wsWriter
+	running sync.WaitGroup
+	cancel  context.CancelFunc
+}
+
+// handle dispatches a message of the client, ignoring unknown types so
+// newer pages keep working against older servers
+func (s *wsSearches) handle(c *Viewer, data []byte) {
+	var req WSRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		slog.Debug("Ignoring WebSocket message", "error", err)
+		return
+	}
+	switch req.Type {
+	case "search":
+		s.stop()
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			s.out.writeJSON(c.runWSSearch(ctx, req, s.out))
+		}()
+	case "cancel":
+		s.stop()
+	}
+}
+
+// stop cancels the running search
+func (s *wsSearches) stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// runWSSearch walks the database sending batches of results to out and
+// returns the final message; it stops when ctx is cancelled or a write fails
+func (c *Viewer) runWSSearch(ctx context.Context, req WSRequest, out *wsWriter) WSSearchDone {
+	start := time.Now()
+	done := WSSearchDone{Type: "searchDone", ID: req.ID}
+	finish := func(err error) WSSearchDone {
+		if err != nil {
+			done.Error = err.Error()
+		}
+		done.Cancelled = ctx.Err() != nil
+		done.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		return done
+	}
+
+	if req.Query == "" {
+		return finish(fmt.Errorf("search query cannot be empty"))
+	}
+	if err := checkNamespace(req.Namespace); err != nil {
+		return finish(err)
+	}
+	root, _ := scopedPath(req.Namespace, "")
+	limit := req.Limit
+	if limit <= 0 {
+		limit = wsSearchDefaultLimit
+	}
+	if limit > wsSearchMaxLimit {
+		limit = wsSearchMaxLimit
+	}
+
+	db, err := c.openDB()
+	if err != nil {
+		return finish(err)
+	}
+
+	batch := WSSearchResults{Type: "searchResults", ID: req.ID}
+	flushed := time.Now()
+	var writeErr error
+	// Also sent without results, for the client to show the progress
+	flush := func() bool {
+		writeErr = out.writeJSON(batch)
+		batch.Results = nil
+		flushed = time.Now()
+		return writeErr == nil && ctx.Err() == nil
+	}
+
+	var search *keySearch
+	search = &keySearch{
+		query: strings.ToLower(req.Query),
+		emit: func(result map[string]interface{}) bool {
+			done.Total++
+			batch.Results = append(batch.Results, result)
+			batch.Scanned = search.scanned
+			if len(batch.Results) >= wsSearchBatch || time.Since(flushed) >= wsSearchFlushInterval {
+				if !flush() {
+					return false
+				}
+			}
+			if done.Total >= limit {
+				done.Truncated = true
+				return false
+			}
+			return true
+		},
+		progress: func() bool {
+			batch.Scanned = search.scanned
+			if time.Since(flushed) >= wsSearchFlushInterval {
+				return flush()
+			}
+			return ctx.Err() == nil
+		},
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return c.walkSearch(tx, root, search)
+	})
+	done.Scanned = search.scanned
+	if err == nil && writeErr == nil && ctx.Err() == nil && len(batch.Results) > 0 {
+		batch.Scanned = search.scanned
+		flush()
+	}
+	if err == nil {
+		err = writeErr
+	}
+	return finish(err)
+}
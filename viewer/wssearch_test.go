@@ -0,0 +1,95 @@
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// readSearch collects the messages of the search id up to its searchDone
+func readSearch(t *testing.T, conn *websocket.Conn, id string) ([]WSSearchResults, WSSearchDone) {
+	t.Helper()
+
+	var batches []WSSearchResults
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID != id {
+			continue
+		}
+		switch msg.Type {
+		case "searchResults":
+			var batch WSSearchResults
+			json.Unmarshal(data, &batch)
+			batches = append(batches, batch)
+		case "searchDone":
+			var done WSSearchDone
+			json.Unmarshal(data, &done)
+			return batches, done
+		}
+	}
+}
+
+func TestWebSocketSearch(t *testing.T) {
+	path := boltdbtest.New(t, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("items"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 120; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("item-%03d", i)), []byte("value")); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte("other"), []byte("value"))
+	})
+	s := newTestServer(t, path)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(WSRequest{Type: "search", ID: "1", Query: "ITEM"})
+	batches, done := readSearch(t, conn, "1")
+	results := 0
+	for _, batch := range batches {
+		if len(batch.Results) > wsSearchBatch {
+			t.Errorf("batch of %d results, want at most %d", len(batch.Results), wsSearchBatch)
+		}
+		results += len(batch.Results)
+	}
+	if len(batches) < 3 || results != 120 {
+		t.Errorf("%d results in %d batches, want 120 in three or more", results, len(batches))
+	}
+	if done.Total != 120 || done.Scanned != 121 || done.Truncated || done.Cancelled || done.Error != "" {
+		t.Errorf("done = %+v, want 120 results of 121 keys", done)
+	}
+
+	conn.WriteJSON(WSRequest{Type: "search", ID: "2", Query: "item", Limit: 10})
+	if _, done := readSearch(t, conn, "2"); done.Total != 10 || !done.Truncated {
+		t.Errorf("limited search: done = %+v, want 10 results truncated", done)
+	}
+
+	conn.WriteJSON(WSRequest{Type: "search", ID: "3", Query: "item", Namespace: "../x"})
+	if _, done := readSearch(t, conn, "3"); !strings.Contains(done.Error, "invalid namespace") {
+		t.Errorf("invalid namespace: done = %+v, want an error", done)
+	}
+}
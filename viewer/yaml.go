@@ -0,0 +1,166 @@
+// yaml.go - JSON responses of read endpoints rendered as YAML on request,
+// decoded OCI specs and CRI configs read much better that way
+package viewer
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// listFormatYAML selects YAML with ?format=, on any read endpoint
+const listFormatYAML = "yaml"
+
+// yamlMediaTypes the Accept types asking for YAML
+var yamlMediaTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+}
+
+// wantsYAML reports whether a request asks for YAML: ?format=yaml, or an
+// Accept header that weighs a YAML type above application/json
+func wantsYAML(r *http.Request) bool {
+	if r.URL.Query().Get("format") == listFormatYAML {
+		return true
+	}
+	var yamlQ, jsonQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		switch mediaType := strings.ToLower(fields[0]); {
+		case yamlMediaTypes[mediaType]:
+			yamlQ = max(yamlQ, q)
+		case mediaType == "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return yamlQ > 0 && yamlQ > jsonQ
+}
+
+// negotiateYAML converts the JSON responses of GET requests that want YAML;
+// other responses, CSV and downloads among them, pass unchanged
+func (c *Viewer) negotiateYAML(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		if !wantsYAML(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		y := &yamlWriter{w: w, status: http.StatusOK}
+		next.ServeHTTP(y, r)
+		y.finish()
+	})
+}
+
+// yamlWriter holds back JSON responses to convert them once complete, and
+// passes any other response through as it is written
+type yamlWriter struct {
+	w           http.ResponseWriter
+	status      int
+	wroteHeader bool
+	convert     bool
+	buf         bytes.Buffer
+}
+
+func (y *yamlWriter) Header() http.Header { return y.w.Header() }
+
+func (y *yamlWriter) WriteHeader(status int) {
+	if y.wroteHeader {
+		return
+	}
+	y.status, y.wroteHeader = status, true
+	y.convert = strings.HasPrefix(y.w.Header().Get("Content-Type"), "application/json") &&
+		status != http.StatusNotModified
+	if !y.convert {
+		y.w.WriteHeader(status)
+	}
+}
+
+func (y *yamlWriter) Write(p []byte) (int, error) {
+	if !y.wroteHeader {
+		y.WriteHeader(http.StatusOK)
+	}
+	if y.convert {
+		return y.buf.Write(p)
+	}
+	return y.w.Write(p)
+}
+
+// Flush passes through responses that are not converted, a converted one
+// is written in one piece by finish
+func (y *yamlWriter) Flush() {
+	if y.convert {
+		return
+	}
+	if f, ok := y.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish writes the YAML of a held back response, the JSON itself if it
+// does not parse
+func (y *yamlWriter) finish() {
+	if !y.convert {
+		return
+	}
+	body, err := jsonToYAML(y.buf.Bytes())
+	if err != nil {
+		slog.Error("Failed to convert response to YAML", "error", err)
+		y.w.WriteHeader(y.status)
+		y.w.Write(y.buf.Bytes())
+		return
+	}
+	y.w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	y.w.Header().Del("Content-Length")
+	y.w.WriteHeader(y.status)
+	y.w.Write(body)
+}
+
+// jsonToYAML renders a JSON document as block-style YAML; JSON is YAML,
+// parsed as nodes it keeps the order of its keys and the digits of its
+// numbers
+func jsonToYAML(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle drops the flow and quoting styles of parsed JSON, the encoder
+// quotes where YAML needs it and uses literal blocks for multi-line strings
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "\n") {
+		n.Style = yaml.LiteralStyle
+	}
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,76 @@
+package viewer
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hysyeah/boltdbui/boltdbtest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestJSONToYAML(t *testing.T) {
+	out, err := jsonToYAML([]byte(`{"z":1,"a":"true","n":12345678901234567890,"s":"a\nb","l":[],"o":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "z: 1\na: \"true\"\nn: 12345678901234567890\ns: |-\n  a\n  b\nl: []\no: {}\n"
+	if string(out) != want {
+		t.Errorf("yaml =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestYAMLResponses(t *testing.T) {
+	s := newTestServer(t, boltdbtest.Tiny(t))
+	get := func(path, accept string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, s.URL+path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	for _, tc := range []struct{ path, accept string }{
+		{"/api/key/misc/json?format=yaml", ""},
+		{"/api/key/misc/json", "application/yaml"},
+		{"/api/key/misc/json", "application/json;q=0.5, application/yaml"},
+	} {
+		resp, body := get(tc.path, tc.accept)
+		var doc struct {
+			Success bool `yaml:"success"`
+			Data    struct {
+				Key string `yaml:"key"`
+			} `yaml:"data"`
+		}
+		if err := yaml.Unmarshal([]byte(body), &doc); err != nil || strings.HasPrefix(body, "{") {
+			t.Errorf("%s (Accept %q): not YAML: %v\n%s", tc.path, tc.accept, err, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/yaml") || !doc.Success || doc.Data.Key != "json" {
+			t.Errorf("%s (Accept %q): %s %+v", tc.path, tc.accept, ct, doc)
+		}
+	}
+
+	// Browsers and JSON clients get JSON
+	if resp, _ := get("/api/key/misc/json", "text/html,*/*;q=0.8"); !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Errorf("Content-Type %s, want JSON", resp.Header.Get("Content-Type"))
+	}
+	// Errors keep their status, streamed keys are converted too
+	if resp, body := get("/api/search?q=x&cursor=-1&format=yaml", ""); resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "success: false") {
+		t.Errorf("error: status %d\n%s", resp.StatusCode, body)
+	}
+	if _, body := get("/api/bucket/misc?format=yaml", ""); !strings.Contains(body, "- key: counter") {
+		t.Errorf("bucket:\n%s", body)
+	}
+	// Other formats pass unchanged
+	if resp, _ := get("/api/bucket/misc?format=csv", "application/yaml"); !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Errorf("csv: Content-Type %s", resp.Header.Get("Content-Type"))
+	}
+}